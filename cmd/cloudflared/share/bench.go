@@ -0,0 +1,125 @@
+package share
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/simpleclient"
+	"github.com/cloudflare/cloudflared/simpleserver"
+)
+
+func buildBenchCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "bench",
+		Action:    cliutil.ConfiguredAction(bench),
+		Usage:     "Load test a running upload server with concurrent uploads and downloads",
+		UsageText: "cloudflared share bench --to URL [bench command options]",
+		Description: `Uploads and downloads files of --size with --concurrency transfers at once
+against the upload server at --to, for --duration or until --requests were
+made, and prints the throughput, latencies and errors of each. Failed
+transfers are not retried. The uploaded files are deleted afterwards unless
+--keep is given.`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "to",
+				Usage:   "URL of the upload server",
+				EnvVars: []string{"TUNNEL_SHARE_URL"},
+			},
+			&cli.StringFlag{
+				Name:    "auth-token",
+				Usage:   "Bearer token the upload server requires",
+				EnvVars: []string{"TUNNEL_SHARE_AUTH_TOKEN"},
+			},
+			&cli.StringFlag{
+				Name:  "size",
+				Value: "1M",
+				Usage: "Size of every file, such as 512K, 10M or 1G",
+			},
+			&cli.IntFlag{
+				Name:  "concurrency",
+				Value: 8,
+				Usage: "How many transfers run at once",
+			},
+			&cli.DurationFlag{
+				Name:  "duration",
+				Value: 10 * time.Second,
+				Usage: "How long the test runs",
+			},
+			&cli.IntFlag{
+				Name:  "requests",
+				Usage: "End the test after that many transfers, if before --duration",
+			},
+			&cli.StringFlag{
+				Name:  "mode",
+				Value: "mixed",
+				Usage: "What to measure: upload, download or mixed",
+			},
+			&cli.BoolFlag{
+				Name:  "keep",
+				Usage: "Leave the uploaded files on the server",
+			},
+		},
+	}
+}
+
+func bench(c *cli.Context) error {
+	to := c.String("to")
+	if to == "" {
+		return cliutil.UsageError("--to is required")
+	}
+	size, err := simpleserver.ParseSize(c.String("size"))
+	if err != nil {
+		return cliutil.UsageError("--size: %v", err)
+	}
+	opts := simpleclient.BenchOptions{
+		Size:        size,
+		Concurrency: c.Int("concurrency"),
+		Duration:    c.Duration("duration"),
+		Requests:    c.Int("requests"),
+		Keep:        c.Bool("keep"),
+	}
+	switch c.String("mode") {
+	case "upload":
+		opts.Uploads = true
+	case "download":
+		opts.Downloads = true
+	case "mixed":
+		opts.Uploads, opts.Downloads = true, true
+	default:
+		return cliutil.UsageError("--mode must be upload, download or mixed")
+	}
+	if opts.Concurrency < 1 {
+		return cliutil.UsageError("--concurrency must be at least 1")
+	}
+
+	client := simpleclient.New(to, c.String("auth-token"))
+	report, err := client.Bench(c.Context, opts)
+	if report != nil {
+		printBenchResult("upload", report.Upload)
+		printBenchResult("download", report.Download)
+	}
+	return err
+}
+
+func printBenchResult(name string, r *simpleclient.BenchResult) {
+	if r == nil {
+		return
+	}
+	fmt.Printf("%-8s %d requests, %d errors (%.1f%%), %s in %s, %s/s, p50 %s, p99 %s, max %s\n",
+		name, r.Requests, r.Errors, r.ErrorRate()*100, formatBytes(r.Bytes), r.Elapsed.Round(time.Millisecond),
+		formatBytes(int64(r.Throughput())), r.P50.Round(time.Microsecond), r.P99.Round(time.Microsecond), r.Max.Round(time.Microsecond))
+	if len(r.ErrorCodes) == 0 {
+		return
+	}
+	codes := make([]string, 0, len(r.ErrorCodes))
+	for code, n := range r.ErrorCodes {
+		codes = append(codes, fmt.Sprintf("%s %d", code, n))
+	}
+	sort.Strings(codes)
+	fmt.Printf("%-8s errors: %s\n", "", strings.Join(codes, ", "))
+}
@@ -0,0 +1,215 @@
+package share
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/tunnel"
+	"github.com/cloudflare/cloudflared/simpleclient"
+)
+
+const progressBarWidth = 30
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:      "share",
+		Action:    cliutil.ConfiguredAction(quickShare),
+		Usage:     "Share a file or directory through a quick tunnel, or files through a running upload server",
+		ArgsUsage: "FILE|DIR",
+		Description: `Started with a file or directory, serves it through a new quick tunnel on
+trycloudflare.com and prints its public HTTPS link. A directory is shared as
+a zip archive of its files. The upload server behind the tunnel listens on a
+free local port and only accepts uploads from this command. Ctrl-C stops the
+tunnel and removes the shared copy.
+
+The upload, download and bench commands talk to an upload server that is already
+running. The purge, verify, stats, export and import commands work on the
+files of one that is stopped.`,
+		// The quick tunnel reads its settings from the tunnel flags.
+		Flags: tunnel.Flags(),
+		Subcommands: []*cli.Command{
+			buildUploadCommand(),
+			buildDownloadCommand(),
+			buildBenchCommand(),
+			buildHealthcheckCommand(),
+			buildPurgeCommand(),
+			buildVerifyCommand(),
+			buildStatsCommand(),
+			buildExportCommand(),
+			buildImportCommand(),
+		},
+	}
+}
+
+func buildUploadCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "upload",
+		Action:    cliutil.ConfiguredAction(upload),
+		Usage:     "Upload files and print their download links",
+		UsageText: "cloudflared share upload --to URL [upload command options] FILE...",
+		Description: `Streams every file to the upload server at --to, which verifies it against
+the checksum computed locally. Uploads failing with network or server errors
+are retried. The download link of every file is printed on its own line.`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "to",
+				Usage:   "URL of the upload server",
+				EnvVars: []string{"TUNNEL_SHARE_URL"},
+			},
+			&cli.StringFlag{
+				Name:    "auth-token",
+				Usage:   "Bearer token the upload server requires",
+				EnvVars: []string{"TUNNEL_SHARE_AUTH_TOKEN"},
+			},
+			&cli.UintFlag{
+				Name:  "retries",
+				Value: simpleclient.DefaultRetries,
+				Usage: "How often a failed upload is retried",
+			},
+			&cli.BoolFlag{
+				Name:  "no-progress",
+				Usage: "Do not draw a progress bar",
+			},
+		},
+	}
+}
+
+func buildDownloadCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "download",
+		Action:    cliutil.ConfiguredAction(download),
+		Usage:     "Download a shared file, resuming where an earlier attempt stopped",
+		UsageText: "cloudflared share download [download command options] URL",
+		Description: `Saves the file at URL, first to <output>.part so a broken download resumes
+where it stopped, and verifies it against the X-Checksum the server sends.
+With --connections, big files are fetched in that many ranges in parallel,
+which helps over high-latency tunnels.`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "File to save the download as. Defaults to the name in the URL",
+			},
+			&cli.IntFlag{
+				Name:  "connections",
+				Value: 1,
+				Usage: "How many ranges of the file to fetch in parallel",
+			},
+			&cli.StringFlag{
+				Name:    "auth-token",
+				Usage:   "Bearer token the upload server requires for downloads",
+				EnvVars: []string{"TUNNEL_SHARE_AUTH_TOKEN"},
+			},
+			&cli.UintFlag{
+				Name:  "retries",
+				Value: simpleclient.DefaultRetries,
+				Usage: "How often a failed range is retried",
+			},
+			&cli.BoolFlag{
+				Name:  "no-progress",
+				Usage: "Do not draw a progress bar",
+			},
+		},
+	}
+}
+
+func download(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return cliutil.UsageError("expected exactly one URL to download")
+	}
+	rawURL := c.Args().First()
+	dest := c.String("output")
+	if dest == "" {
+		name, err := simpleclient.DownloadName(rawURL)
+		if err != nil {
+			return cliutil.UsageError("%v, use --output to name the download", err)
+		}
+		dest = name
+	}
+	client := simpleclient.New("", c.String("auth-token"))
+	client.Retries = c.Uint("retries")
+	showProgress := !c.Bool("no-progress") && term.IsTerminal(int(os.Stderr.Fd()))
+	if showProgress {
+		client.Progress = progressBar(dest)
+	}
+	result, err := client.Download(c.Context, rawURL, dest, c.Int("connections"))
+	if showProgress {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", rawURL, err)
+	}
+	fmt.Printf("%s (%s, SHA-256 %s)\n", result.Path, formatBytes(result.Size), result.SHA256)
+	return nil
+}
+
+func upload(c *cli.Context) error {
+	to := c.String("to")
+	if to == "" {
+		return cliutil.UsageError("--to is required")
+	}
+	if c.NArg() == 0 {
+		return cliutil.UsageError("no files to upload")
+	}
+	client := simpleclient.New(to, c.String("auth-token"))
+	client.Retries = c.Uint("retries")
+	showProgress := !c.Bool("no-progress") && term.IsTerminal(int(os.Stderr.Fd()))
+	for _, path := range c.Args().Slice() {
+		if showProgress {
+			client.Progress = progressBar(path)
+		}
+		result, err := client.UploadFile(c.Context, path)
+		if showProgress {
+			fmt.Fprint(os.Stderr, "\r\033[K")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to upload %s: %w", path, err)
+		}
+		fmt.Println(result.URL)
+	}
+	return nil
+}
+
+// progressBar draws the progress of transferring path on stderr, at most
+// ten times a second. Transfers of unknown size only count their bytes.
+func progressBar(path string) func(sent, total int64) {
+	var mu sync.Mutex
+	var last time.Time
+	return func(sent, total int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		now := time.Now()
+		if now.Sub(last) < 100*time.Millisecond && sent != total {
+			return
+		}
+		last = now
+		if total <= 0 {
+			fmt.Fprintf(os.Stderr, "\r%s %s", path, formatBytes(sent))
+			return
+		}
+		filled := int(min(sent, total) * progressBarWidth / total)
+		fmt.Fprintf(os.Stderr, "\r%s [%s%s] %3d%% %s/%s", path,
+			strings.Repeat("=", filled), strings.Repeat(" ", progressBarWidth-filled),
+			sent*100/total, formatBytes(sent), formatBytes(total))
+	}
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
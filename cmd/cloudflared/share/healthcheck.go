@@ -0,0 +1,64 @@
+package share
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+)
+
+const healthcheckTimeout = 5 * time.Second
+
+func buildHealthcheckCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "healthcheck",
+		Action:    cliutil.ConfiguredAction(healthcheck),
+		Usage:     "Exit with 0 when the upload server on this machine is healthy",
+		UsageText: "cloudflared share healthcheck [healthcheck command options]",
+		Description: `Requests /healthz, or /readyz with --ready, from the upload server listening
+on --port and fails unless it answers 200. Container images without curl or
+wget can use it as their health check:
+
+  HEALTHCHECK CMD ["cloudflared", "share", "healthcheck"]`,
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:    "port",
+				Value:   8080,
+				Usage:   "Port the upload server listens on",
+				EnvVars: []string{"SIMPLESERVER_PORT"},
+			},
+			&cli.StringFlag{
+				Name:  "url",
+				Usage: "URL to check instead of the server on --port",
+			},
+			&cli.BoolFlag{
+				Name:  "ready",
+				Usage: "Check /readyz, which also fails while the upload dir or storage are unusable",
+			},
+		},
+	}
+}
+
+func healthcheck(c *cli.Context) error {
+	url := c.String("url")
+	if url == "" {
+		path := "/healthz"
+		if c.Bool("ready") {
+			path = "/readyz"
+		}
+		url = fmt.Sprintf("http://127.0.0.1:%d%s", c.Int("port"), path)
+	}
+	client := http.Client{Timeout: healthcheckTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("health check failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check failed: %s answered %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package share
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/simpleserver"
+)
+
+// The maintenance commands open the store of a stopped upload server, so
+// they take the same flags as the server to find it.
+
+func buildPurgeCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "purge",
+		Action:    cliutil.ConfiguredAction(purge),
+		Usage:     "Delete the uploads older than --older-than from a stopped upload server",
+		UsageText: "cloudflared share purge --older-than 7d [upload server options]",
+		Description: `Deletes every upload created before --older-than, such as 24h or 7d, from the
+upload dir or storage and metadata store the upload server options point at,
+skipping the trash. Run it while the upload server is stopped.`,
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:     "older-than",
+				Usage:    "Age of the uploads to delete, such as 24h or 7d",
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Only list the uploads that would be deleted",
+			},
+		}, simpleserver.Flags()...),
+	}
+}
+
+func buildVerifyCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "verify",
+		Action:    cliutil.ConfiguredAction(verify),
+		Usage:     "Check the stored uploads of a stopped upload server against their checksums",
+		UsageText: "cloudflared share verify [upload server options]",
+		Description: `Reads every stored upload back and compares its SHA-256 with the one recorded
+when it was uploaded. Fails listing the uploads that are missing or changed.`,
+		Flags: simpleserver.Flags(),
+	}
+}
+
+func buildStatsCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "stats",
+		Action:    cliutil.ConfiguredAction(stats),
+		Usage:     "Summarize the stored uploads of a stopped upload server",
+		UsageText: "cloudflared share stats [stats command options]",
+		Description: `Prints the number of uploads and share dirs, their size and downloads, as
+GET /admin/stats does, without the upload server running.`,
+		Flags: append([]cli.Flag{
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "Print the summary as JSON",
+			},
+		}, simpleserver.Flags()...),
+	}
+}
+
+func buildExportCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "export",
+		Action:    cliutil.ConfiguredAction(exportStore),
+		Usage:     "Write the uploads of a stopped upload server to an archive",
+		UsageText: "cloudflared share export --to backup.tar.zst [upload server options]",
+		Description: `Packs every upload with its metadata, including its expiry, short link and
+delete token, into a zstd compressed tar archive. Importing it into a server
+on another host or storage backend keeps the existing links working.`,
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:     "to",
+				Usage:    "Archive to write",
+				Required: true,
+			},
+		}, simpleserver.Flags()...),
+	}
+}
+
+func buildImportCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "import",
+		Action:    cliutil.ConfiguredAction(importStore),
+		Usage:     "Restore the uploads of an archive written by export into a stopped upload server",
+		UsageText: "cloudflared share import --from backup.tar.zst [upload server options]",
+		Description: `Stores every upload of the archive under its original link, compressed and
+encrypted at rest as the upload server options ask. Uploads already there
+are skipped, so an interrupted import can be run again.`,
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:     "from",
+				Usage:    "Archive to read",
+				Required: true,
+			},
+		}, simpleserver.Flags()...),
+	}
+}
+
+// openStore opens the store the upload server options of c point at.
+func openStore(c *cli.Context) (*simpleserver.Server, error) {
+	s := simpleserver.WithCtx(c)
+	if err := s.Open(); err != nil {
+		return nil, fmt.Errorf("failed to open the upload store: %w", err)
+	}
+	return s, nil
+}
+
+func purge(c *cli.Context) error {
+	olderThan, err := simpleserver.ParseAge(c.String("older-than"))
+	if err != nil {
+		return cliutil.UsageError("--older-than: %v", err)
+	}
+	s, err := openStore(c)
+	if err != nil {
+		return err
+	}
+	purged, err := s.Purge(olderThan, c.Bool("dry-run"))
+	var size int64
+	for _, file := range purged {
+		fmt.Printf("%s/%s\n", file.Dir, file.Name)
+		size += file.Size
+	}
+	if err != nil {
+		return err
+	}
+	verb := "Deleted"
+	if c.Bool("dry-run") {
+		verb = "Would delete"
+	}
+	fmt.Fprintf(os.Stderr, "%s %d uploads, %s\n", verb, len(purged), formatBytes(size))
+	return nil
+}
+
+func verify(c *cli.Context) error {
+	s, err := openStore(c)
+	if err != nil {
+		return err
+	}
+	checked := 0
+	failures, err := s.Verify(c.Context, func(simpleserver.FileInfo) { checked++ })
+	for _, failure := range failures {
+		fmt.Printf("%s/%s: %v\n", failure.File.Dir, failure.File.Name, failure.Err)
+	}
+	if err != nil {
+		return err
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d uploads failed verification", len(failures), checked)
+	}
+	fmt.Fprintf(os.Stderr, "Verified %d uploads\n", checked)
+	return nil
+}
+
+func stats(c *cli.Context) error {
+	s, err := openStore(c)
+	if err != nil {
+		return err
+	}
+	summary := s.Stats()
+	if c.Bool("json") {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(summary)
+	}
+	fmt.Printf("Uploads:      %d in %d dirs\n", summary.Files, summary.Dirs)
+	fmt.Printf("Size:         %s, %s stored\n", formatBytes(summary.TotalSize), formatBytes(summary.StoredBytes))
+	if summary.DedupedBytes > 0 {
+		fmt.Printf("Deduplicated: %s\n", formatBytes(summary.DedupedBytes))
+	}
+	fmt.Printf("Downloads:    %d, %s served\n", summary.Downloads, formatBytes(summary.BytesServed))
+	fmt.Printf("Pending:      %d\n", summary.Pending)
+	fmt.Printf("Expired:      %d\n", summary.Expired)
+	if summary.OldestUpload != nil {
+		fmt.Printf("Oldest:       %s\n", summary.OldestUpload.Format("2006-01-02 15:04:05 MST"))
+		fmt.Printf("Newest:       %s\n", summary.NewestUpload.Format("2006-01-02 15:04:05 MST"))
+	}
+	return nil
+}
+
+func exportStore(c *cli.Context) error {
+	s, err := openStore(c)
+	if err != nil {
+		return err
+	}
+	// The archive is written next to its destination and only renamed
+	// into place once complete.
+	dest := c.String("to")
+	tmp, err := os.CreateTemp(filepath.Dir(dest), filepath.Base(dest)+".*.part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	n, err := s.Export(c.Context, tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to export: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d uploads to %s\n", n, dest)
+	return nil
+}
+
+func importStore(c *cli.Context) error {
+	s, err := openStore(c)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(c.String("from"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	n, err := s.Import(c.Context, f)
+	if err != nil {
+		return fmt.Errorf("failed after importing %d uploads: %w", n, err)
+	}
+	fmt.Fprintf(os.Stderr, "Imported %d uploads\n", n)
+	return nil
+}
@@ -0,0 +1,188 @@
+package share
+
+import (
+	"archive/zip"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/tunnel"
+	"github.com/cloudflare/cloudflared/simpleclient"
+)
+
+// quickShare serves path through a new quick tunnel. The upload server runs
+// on a free local port with a temporary upload dir and a random auth token,
+// so only this command uploads to it. A directory is shared as a zip of its
+// files. Everything is removed again when the tunnel stops.
+func quickShare(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return cliutil.UsageError("expected exactly one file or directory to share")
+	}
+	path := c.Args().First()
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	workDir, err := os.MkdirTemp("", "cloudflared-share-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+	if info.IsDir() {
+		archive := filepath.Join(workDir, filepath.Base(filepath.Clean(path))+".zip")
+		if err := zipDir(path, archive); err != nil {
+			return fmt.Errorf("failed to archive %s: %w", path, err)
+		}
+		path = archive
+		if info, err = os.Stat(path); err != nil {
+			return err
+		}
+	}
+
+	port, err := freePort()
+	if err != nil {
+		return err
+	}
+	token := c.String("auth-token")
+	if token == "" {
+		token = randomToken()
+	}
+	settings := map[string]string{
+		"port":       strconv.Itoa(port),
+		"upload-dir": filepath.Join(workDir, "uploads"),
+		"auth-token": token,
+		"url":        fmt.Sprintf("http://localhost:%d", port),
+	}
+	if size := int(info.Size()>>20) + 1; size > c.Int("maxsize") {
+		settings["maxsize"] = strconv.Itoa(size)
+	}
+	for name, value := range settings {
+		if err := c.Set(name, value); err != nil {
+			return err
+		}
+	}
+
+	return tunnel.RunQuickTunnelFromContext(c, func(tunnelURL string) {
+		client := simpleclient.New(settings["url"], token)
+		// The upload server is still starting, which the retries of the
+		// upload ride out.
+		result, err := client.UploadFile(c.Context, path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to share %s: %v\n", path, err)
+			stop()
+			return
+		}
+		link, err := publicURL(tunnelURL, result.URL)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to share %s: %v\n", path, err)
+			stop()
+			return
+		}
+		for _, line := range tunnel.AsciiBox([]string{
+			"Sharing " + c.Args().First() + " at (it may take some time to be reachable):",
+			link,
+		}, 2) {
+			fmt.Println(line)
+		}
+	})
+}
+
+// publicURL moves the link the local upload server handed out to the host
+// of the tunnel.
+func publicURL(tunnelURL, localURL string) (string, error) {
+	public, err := url.Parse(tunnelURL)
+	if err != nil {
+		return "", err
+	}
+	local, err := url.Parse(localURL)
+	if err != nil {
+		return "", err
+	}
+	local.Scheme, local.Host = public.Scheme, public.Host
+	return local.String(), nil
+}
+
+// stop tears the tunnel down as Ctrl-C does.
+func stop() {
+	process, err := os.FindProcess(os.Getpid())
+	if err == nil {
+		err = process.Signal(os.Interrupt)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+func freePort() (int, error) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, err
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// zipDir writes the regular files below dir to a zip archive at dest.
+func zipDir(dir, dest string) error {
+	file, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	archive := zip.NewWriter(file)
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		header.Method = zip.Deflate
+		w, err := archive.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(w, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
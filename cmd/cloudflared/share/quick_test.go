@@ -0,0 +1,40 @@
+package share
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublicURL(t *testing.T) {
+	link, err := publicURL("https://example-share.trycloudflare.com", "http://localhost:41234/Ab3dEf/my%20notes.txt")
+	require.NoError(t, err)
+	require.Equal(t, "https://example-share.trycloudflare.com/Ab3dEf/my%20notes.txt", link)
+}
+
+func TestZipDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte("b"), 0644))
+	dest := filepath.Join(t.TempDir(), "dir.zip")
+	require.NoError(t, zipDir(dir, dest))
+
+	archive, err := zip.OpenReader(dest)
+	require.NoError(t, err)
+	defer archive.Close()
+	files := map[string]string{}
+	for _, file := range archive.File {
+		r, err := file.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(r)
+		require.NoError(t, err)
+		r.Close()
+		files[file.Name] = string(content)
+	}
+	require.Equal(t, map[string]string{"a.txt": "a", "sub/b.txt": "b"}, files)
+}
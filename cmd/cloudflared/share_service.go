@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/cliutil"
+	"github.com/cloudflare/cloudflared/cmd/cloudflared/tunnel"
+)
+
+const (
+	shareServiceUserFlag = "service-user"
+	shareUploadDirFlag   = "upload-dir"
+)
+
+func shareServiceCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "service",
+		Usage: "Manages the upload server system service",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "install",
+				Usage:     "Install the upload server as a system service",
+				UsageText: "cloudflared share service install [install command options] [TOKEN]",
+				Description: `Installs a service running the tunnel and its upload server with every flag
+given to this command, from the command line, the environment or the config
+file. Given a tunnel token, the service runs that tunnel; otherwise it runs
+the tunnel of the config file, or a quick tunnel for --url.
+
+Uploads are stored in --upload-dir, or in a system directory when it is not
+set. The directory is created and handed over to --service-user, who the
+service runs as.`,
+				Action: cliutil.ConfiguredAction(installShareService),
+				Flags: append(tunnel.Flags(), &cli.StringFlag{
+					Name:  shareServiceUserFlag,
+					Usage: "User the service runs as and who owns the upload directory. Defaults to root",
+				}),
+			},
+			{
+				Name:   "uninstall",
+				Usage:  "Uninstall the upload server service, keeping its uploads",
+				Action: cliutil.ConfiguredAction(uninstallShareService),
+			},
+			{
+				Name:   "status",
+				Usage:  "Show whether the upload server service is running",
+				Action: cliutil.ConfiguredAction(shareServiceStatus),
+			},
+		},
+	}
+}
+
+// shareServiceUploadDir returns the absolute upload directory of the
+// service, fallback when --upload-dir is not set.
+func shareServiceUploadDir(c *cli.Context, fallback string) (string, error) {
+	dir := c.String(shareUploadDirFlag)
+	if dir == "" {
+		return fallback, nil
+	}
+	return filepath.Abs(dir)
+}
+
+// buildArgsForShareService returns the arguments the service runs
+// cloudflared with: the flags set for install, with uploadDir as
+// --upload-dir, then the tunnel command.
+func buildArgsForShareService(c *cli.Context, uploadDir string) ([]string, error) {
+	args := []string{"--" + shareUploadDirFlag, uploadDir}
+	for _, f := range c.Command.Flags {
+		name := f.Names()[0]
+		if name == shareServiceUserFlag || name == shareUploadDirFlag || !c.IsSet(name) {
+			continue
+		}
+		switch value := c.Value(name).(type) {
+		case cli.StringSlice:
+			for _, v := range value.Value() {
+				args = append(args, "--"+name, v)
+			}
+		case bool:
+			args = append(args, fmt.Sprintf("--%s=%t", name, value))
+		default:
+			args = append(args, "--"+name, fmt.Sprint(value))
+		}
+	}
+	if c.NArg() == 0 {
+		return append(args, "tunnel"), nil
+	}
+	token := c.Args().First()
+	if _, err := tunnel.ParseToken(token); err != nil {
+		return nil, cliutil.UsageError("Provided tunnel token is not valid (%s).", err)
+	}
+	return append(args, "tunnel", "run", "--token", token), nil
+}
+
+// prepareShareUploadDir creates the upload directory and, given a service
+// user, makes it theirs.
+func prepareShareUploadDir(dir, username string) error {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return fmt.Errorf("error creating upload directory %s: %v", dir, err)
+	}
+	if username == "" {
+		return nil
+	}
+	u, err := user.Lookup(username)
+	if err != nil {
+		return fmt.Errorf("error looking up service user %s: %v", username, err)
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return fmt.Errorf("service user %s has no numeric uid", username)
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return fmt.Errorf("service user %s has no numeric gid", username)
+	}
+	if err := os.Chown(dir, uid, gid); err != nil {
+		return fmt.Errorf("error handing upload directory %s to %s: %v", dir, username, err)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+//go:build darwin
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/logger"
+)
+
+const (
+	shareLaunchdIdentifier = "com.cloudflare.cloudflared-share"
+	defaultShareUploadDir  = "/usr/local/var/cloudflared/uploads"
+)
+
+// newShareLaunchdTemplate returns the launch daemon of the upload server.
+// It is only readable by root as the flags may carry secrets.
+func newShareLaunchdTemplate(serviceUser string) *ServiceTemplate {
+	userKey := ""
+	if serviceUser != "" {
+		userKey = fmt.Sprintf("\n\t\t<key>UserName</key>\n\t\t<string>%s</string>", plistEscape(serviceUser))
+	}
+	return &ServiceTemplate{
+		Path:     fmt.Sprintf("/Library/LaunchDaemons/%s.plist", shareLaunchdIdentifier),
+		FileMode: 0o600,
+		Content: fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+	<dict>
+		<key>Label</key>
+		<string>%[1]s</string>%[2]s
+		<key>ProgramArguments</key>
+		<array>
+			<string>{{ .Path }}</string>
+			<string>--no-autoupdate</string>
+			{{- range $i, $item := .ExtraArgs}}
+			<string>{{ $item }}</string>
+			{{- end}}
+		</array>
+		<key>RunAtLoad</key>
+		<true/>
+		<key>StandardOutPath</key>
+		<string>/Library/Logs/%[1]s.out.log</string>
+		<key>StandardErrorPath</key>
+		<string>/Library/Logs/%[1]s.err.log</string>
+		<key>KeepAlive</key>
+		<dict>
+			<key>SuccessfulExit</key>
+			<false/>
+		</dict>
+		<key>ThrottleInterval</key>
+		<integer>5</integer>
+	</dict>
+</plist>`, shareLaunchdIdentifier, userKey),
+	}
+}
+
+func plistEscape(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+func installShareService(c *cli.Context) error {
+	log := logger.CreateLoggerFromContext(c, logger.EnableTerminalLog)
+
+	if !isRootUser() {
+		return fmt.Errorf("the upload server service is a system launch daemon, install it with root permission")
+	}
+	etPath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("error determining executable path: %v", err)
+	}
+	uploadDir, err := shareServiceUploadDir(c, defaultShareUploadDir)
+	if err != nil {
+		return fmt.Errorf("error determining upload directory: %v", err)
+	}
+	extraArgs, err := buildArgsForShareService(c, uploadDir)
+	if err != nil {
+		return err
+	}
+	for i, arg := range extraArgs {
+		extraArgs[i] = plistEscape(arg)
+	}
+	serviceUser := c.String(shareServiceUserFlag)
+	if err := prepareShareUploadDir(uploadDir, serviceUser); err != nil {
+		return err
+	}
+
+	launchdTemplate := newShareLaunchdTemplate(serviceUser)
+	if err := launchdTemplate.Generate(&ServiceTemplateArgs{Path: etPath, ExtraArgs: extraArgs}); err != nil {
+		log.Err(err).Msg("error generating launchd template")
+		return err
+	}
+	plistPath, err := launchdTemplate.ResolvePath()
+	if err != nil {
+		log.Err(err).Msg("error resolving launchd template path")
+		return err
+	}
+	if err := runCommand("launchctl", "load", plistPath); err != nil {
+		log.Err(err).Msg("error loading launchd")
+		return err
+	}
+	log.Info().Msgf("Outputs are logged to /Library/Logs/%s.err.log and /Library/Logs/%s.out.log", shareLaunchdIdentifier, shareLaunchdIdentifier)
+	log.Info().Msgf("Upload server service installed successfully, uploads are stored in %s", uploadDir)
+	return nil
+}
+
+func uninstallShareService(c *cli.Context) error {
+	log := logger.CreateLoggerFromContext(c, logger.EnableTerminalLog)
+
+	launchdTemplate := newShareLaunchdTemplate("")
+	plistPath, err := launchdTemplate.ResolvePath()
+	if err != nil {
+		log.Err(err).Msg("error resolving launchd template path")
+		return err
+	}
+	if _, err := os.Stat(plistPath); err != nil {
+		return fmt.Errorf("the upload server service is not installed")
+	}
+	if err := runCommand("launchctl", "unload", plistPath); err != nil {
+		log.Err(err).Msg("error unloading launchd")
+		return err
+	}
+	if err := launchdTemplate.Remove(); err != nil {
+		return err
+	}
+	log.Info().Msg("Upload server service uninstalled successfully, its uploads were kept")
+	return nil
+}
+
+func shareServiceStatus(c *cli.Context) error {
+	if plistPath, err := newShareLaunchdTemplate("").ResolvePath(); err != nil {
+		return err
+	} else if _, err := os.Stat(plistPath); err != nil {
+		return fmt.Errorf("the upload server service is not installed")
+	}
+	cmd := exec.Command("launchctl", "list", shareLaunchdIdentifier)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
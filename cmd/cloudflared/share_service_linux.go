@@ -0,0 +1,150 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/cloudflare/cloudflared/logger"
+)
+
+const (
+	shareService          = "cloudflared-share.service"
+	defaultShareUploadDir = "/var/lib/cloudflared/uploads"
+)
+
+// newShareSystemdTemplate returns the unit of the upload server service.
+// It is only readable by root as the flags may carry secrets.
+func newShareSystemdTemplate(serviceUser string) *ServiceTemplate {
+	userLine := ""
+	if serviceUser != "" {
+		userLine = fmt.Sprintf("User=%s\n", serviceUser)
+	}
+	return &ServiceTemplate{
+		Path:     fmt.Sprintf("/etc/systemd/system/%s", shareService),
+		FileMode: 0o600,
+		Content: fmt.Sprintf(`[Unit]
+Description=cloudflared upload server
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+TimeoutStartSec=0
+Type=notify
+%sExecStart={{ .Path }} --no-autoupdate{{ range .ExtraArgs }} {{ . }}{{ end }}
+Restart=on-failure
+RestartSec=5s
+
+[Install]
+WantedBy=multi-user.target
+`, userLine),
+	}
+}
+
+// systemdQuote escapes arg for an ExecStart line, which expands specifiers
+// and variables and splits words on whitespace.
+func systemdQuote(arg string) string {
+	arg = strings.NewReplacer("%", "%%", "$", "$$").Replace(arg)
+	if arg == "" || strings.ContainsAny(arg, " \t\"'\\;") {
+		return strconv.Quote(arg)
+	}
+	return arg
+}
+
+func installShareService(c *cli.Context) error {
+	log := logger.CreateLoggerFromContext(c, logger.EnableTerminalLog)
+
+	if !isSystemd() {
+		return fmt.Errorf("the upload server service requires systemd")
+	}
+	etPath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("error determining executable path: %v", err)
+	}
+	uploadDir, err := shareServiceUploadDir(c, defaultShareUploadDir)
+	if err != nil {
+		return fmt.Errorf("error determining upload directory: %v", err)
+	}
+	extraArgs, err := buildArgsForShareService(c, uploadDir)
+	if err != nil {
+		return err
+	}
+	for i, arg := range extraArgs {
+		extraArgs[i] = systemdQuote(arg)
+	}
+	serviceUser := c.String(shareServiceUserFlag)
+	if err := prepareShareUploadDir(uploadDir, serviceUser); err != nil {
+		return err
+	}
+
+	serviceTemplate := newShareSystemdTemplate(serviceUser)
+	if err := serviceTemplate.Generate(&ServiceTemplateArgs{Path: etPath, ExtraArgs: extraArgs}); err != nil {
+		log.Err(err).Msg("error generating service template")
+		return err
+	}
+	if err := runCommand("systemctl", "daemon-reload"); err != nil {
+		log.Err(err).Msg("systemctl daemon-reload error")
+		return err
+	}
+	if err := runCommand("systemctl", "enable", shareService); err != nil {
+		log.Err(err).Msgf("systemctl enable %s error", shareService)
+		return err
+	}
+	if err := runCommand("systemctl", "start", shareService); err != nil {
+		log.Err(err).Msgf("systemctl start %s error", shareService)
+		return err
+	}
+	log.Info().Msgf("Upload server service installed successfully, uploads are stored in %s", uploadDir)
+	return nil
+}
+
+func uninstallShareService(c *cli.Context) error {
+	log := logger.CreateLoggerFromContext(c, logger.EnableTerminalLog)
+
+	serviceTemplate := newShareSystemdTemplate("")
+	path, err := serviceTemplate.ResolvePath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("the upload server service is not installed")
+	}
+	if err := runCommand("systemctl", "disable", shareService); err != nil {
+		log.Err(err).Msgf("systemctl disable %s error", shareService)
+		return err
+	}
+	if err := runCommand("systemctl", "stop", shareService); err != nil {
+		log.Err(err).Msgf("systemctl stop %s error", shareService)
+		return err
+	}
+	if err := serviceTemplate.Remove(); err != nil {
+		log.Err(err).Msg("error removing service template")
+		return err
+	}
+	if err := runCommand("systemctl", "daemon-reload"); err != nil {
+		log.Err(err).Msg("systemctl daemon-reload error")
+		return err
+	}
+	log.Info().Msg("Upload server service uninstalled successfully, its uploads were kept")
+	return nil
+}
+
+func shareServiceStatus(c *cli.Context) error {
+	if path, err := newShareSystemdTemplate("").ResolvePath(); err != nil {
+		return err
+	} else if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("the upload server service is not installed")
+	}
+	// systemctl exits with a non-zero code unless the service is running,
+	// which is passed on to scripts.
+	cmd := exec.Command("systemctl", "status", "--no-pager", shareService)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,22 @@
+//go:build !windows && !darwin && !linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/urfave/cli/v2"
+)
+
+func installShareService(c *cli.Context) error {
+	return fmt.Errorf("the upload server service is not supported on %s", runtime.GOOS)
+}
+
+func uninstallShareService(c *cli.Context) error {
+	return fmt.Errorf("the upload server service is not supported on %s", runtime.GOOS)
+}
+
+func shareServiceStatus(c *cli.Context) error {
+	return fmt.Errorf("the upload server service is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,133 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+
+	"github.com/cloudflare/cloudflared/logger"
+)
+
+const (
+	shareWindowsServiceName        = "CloudflaredShare"
+	shareWindowsServiceDescription = "Cloudflared upload server"
+)
+
+var shareServiceStates = map[svc.State]string{
+	svc.Stopped:         "stopped",
+	svc.StartPending:    "starting",
+	svc.StopPending:     "stopping",
+	svc.Running:         "running",
+	svc.ContinuePending: "continuing",
+	svc.PausePending:    "pausing",
+	svc.Paused:          "paused",
+}
+
+func installShareService(c *cli.Context) error {
+	log := logger.CreateLoggerFromContext(c, logger.EnableTerminalLog).
+		With().
+		Str(LogFieldWindowsServiceName, shareWindowsServiceName).Logger()
+
+	if c.IsSet(shareServiceUserFlag) {
+		return fmt.Errorf("--%s is not supported for Windows services, which run as LocalSystem", shareServiceUserFlag)
+	}
+	exepath, err := os.Executable()
+	if err != nil {
+		return errors.Wrap(err, "Cannot find path name that start the process")
+	}
+	uploadDir, err := shareServiceUploadDir(c, filepath.Join(os.Getenv("ProgramData"), "cloudflared", "uploads"))
+	if err != nil {
+		return errors.Wrap(err, "Cannot determine upload directory")
+	}
+	extraArgs, err := buildArgsForShareService(c, uploadDir)
+	if err != nil {
+		return err
+	}
+	if err := prepareShareUploadDir(uploadDir, ""); err != nil {
+		return err
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return errors.Wrap(err, "Cannot establish a connection to the service control manager")
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(shareWindowsServiceName)
+	if err == nil {
+		s.Close()
+		return fmt.Errorf(serviceAlreadyExistsWarn(shareWindowsServiceName))
+	}
+	config := mgr.Config{StartType: mgr.StartAutomatic, DisplayName: shareWindowsServiceDescription}
+	s, err = m.CreateService(shareWindowsServiceName, exepath, config, append([]string{"--no-autoupdate"}, extraArgs...)...)
+	if err != nil {
+		return errors.Wrap(err, "Cannot install service")
+	}
+	defer s.Close()
+
+	if err := configRecoveryOption(s.Handle); err != nil {
+		log.Err(err).Msg("Cannot set service recovery actions")
+		log.Info().Msgf("See %s to manually configure service recovery actions", windowsServiceUrl)
+	}
+	if err := s.Start(); err != nil {
+		return errors.Wrap(err, "Cannot start service")
+	}
+	log.Info().Msgf("Upload server service installed successfully, uploads are stored in %s", uploadDir)
+	return nil
+}
+
+func uninstallShareService(c *cli.Context) error {
+	log := logger.CreateLoggerFromContext(c, logger.EnableTerminalLog).
+		With().
+		Str(LogFieldWindowsServiceName, shareWindowsServiceName).Logger()
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return errors.Wrap(err, "Cannot establish a connection to the service control manager")
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(shareWindowsServiceName)
+	if err != nil {
+		return fmt.Errorf("the upload server service is not installed")
+	}
+	defer s.Close()
+
+	if status, err := s.Query(); err == nil && status.State == svc.Running {
+		if _, err := s.Control(svc.Stop); err != nil {
+			log.Info().Err(err).Msg("Failed to stop the upload server service, you may need to stop it manually to complete uninstall.")
+		}
+	}
+	if err := s.Delete(); err != nil {
+		return errors.Wrap(err, "Cannot delete service")
+	}
+	log.Info().Msg("Upload server service uninstalled successfully, its uploads were kept")
+	return nil
+}
+
+func shareServiceStatus(c *cli.Context) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return errors.Wrap(err, "Cannot establish a connection to the service control manager")
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(shareWindowsServiceName)
+	if err != nil {
+		return fmt.Errorf("the upload server service is not installed")
+	}
+	defer s.Close()
+	status, err := s.Query()
+	if err != nil {
+		return errors.Wrap(err, "Cannot query service")
+	}
+	fmt.Printf("%s is %s\n", shareWindowsServiceName, shareServiceStates[status.State])
+	if status.State != svc.Running {
+		return cli.Exit("", 3)
+	}
+	return nil
+}
@@ -391,7 +391,11 @@ func StartServer(
 	namedTunnel *connection.TunnelProperties,
 	log *zerolog.Logger,
 ) error {
-	go simpleserver.WithCtx(c).Start()
+	go func() {
+		if err := simpleserver.WithCtx(c).Start(); err != nil {
+			log.Err(err).Msg("Upload server stopped")
+		}
+	}()
 	err := sentry.Init(sentry.ClientOptions{
 		Dsn:     sentryDSN,
 		Release: c.App.Version,
@@ -10,6 +10,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
 
 	"github.com/cloudflare/cloudflared/connection"
 )
@@ -22,6 +23,21 @@ const disclaimer = "Thank you for trying Cloudflare Tunnel. Doing so, without a
 // We use this to power quick tunnels on trycloudflare.com, but the
 // service is open-source and could be used by anyone.
 func RunQuickTunnel(sc *subcommandContext) error {
+	return runQuickTunnel(sc, nil)
+}
+
+// RunQuickTunnelFromContext runs a quick tunnel for the flags of c. created
+// is called in a goroutine of its own with the URL of the tunnel, as the
+// connections to the edge and the upload server start.
+func RunQuickTunnelFromContext(c *cli.Context, created func(url string)) error {
+	sc, err := newSubcommandContext(c)
+	if err != nil {
+		return err
+	}
+	return runQuickTunnel(sc, created)
+}
+
+func runQuickTunnel(sc *subcommandContext, created func(url string)) error {
 	sc.log.Info().Msg(disclaimer)
 	sc.log.Info().Msg("Requesting new quick Tunnel on trycloudflare.com...")
 
@@ -89,6 +105,9 @@ func RunQuickTunnel(sc *subcommandContext) error {
 	// Override the number of connections used. Quick tunnels shouldn't be used for production usage,
 	// so, use a single connection instead.
 	sc.c.Set(haConnectionsFlag, "1")
+	if created != nil {
+		go created(url)
+	}
 	return StartServer(
 		sc.c,
 		buildInfo,
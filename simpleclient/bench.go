@@ -0,0 +1,316 @@
+package simpleclient
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// benchBlockSize is the size of the random block bench uploads repeat, so
+// big files need not be held in memory.
+const benchBlockSize = 1 << 20
+
+var errShortDownload = errors.New("the download is shorter than the file")
+
+// BenchOptions configure a load test run by Bench.
+type BenchOptions struct {
+	// Size is the size in bytes of every file uploaded and downloaded.
+	Size int64
+	// Concurrency is how many transfers run at once.
+	Concurrency int
+	// Duration ends the test, unless Requests are made before.
+	Duration time.Duration
+	// Requests, when above zero, is how many transfers are made in all.
+	Requests int
+	// Uploads and Downloads choose the transfers measured. With both, they
+	// take turns.
+	Uploads, Downloads bool
+	// Keep leaves the uploaded files on the server instead of deleting them
+	// once the test is over.
+	Keep bool
+}
+
+// BenchResult sums up the transfers of one kind.
+type BenchResult struct {
+	Requests int
+	Errors   int
+	// ErrorCodes counts the errors by the code the server answered with,
+	// its status when it sent none, or "network".
+	ErrorCodes map[string]int
+	// Bytes is what the successful transfers moved, in Elapsed.
+	Bytes   int64
+	Elapsed time.Duration
+	// Latencies of the successful transfers, from sending the request to
+	// reading the whole response.
+	P50, P99, Max time.Duration
+
+	latencies []time.Duration
+}
+
+// Throughput is the bytes moved per second by all transfers together.
+func (r *BenchResult) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) / r.Elapsed.Seconds()
+}
+
+// ErrorRate is the share of transfers that failed, between 0 and 1.
+func (r *BenchResult) ErrorRate() float64 {
+	if r.Requests == 0 {
+		return 0
+	}
+	return float64(r.Errors) / float64(r.Requests)
+}
+
+func (r *BenchResult) add(latency time.Duration, bytes int64, err error) {
+	r.Requests++
+	if err != nil {
+		r.Errors++
+		r.ErrorCodes[benchErrorCode(err)]++
+		return
+	}
+	r.Bytes += bytes
+	r.latencies = append(r.latencies, latency)
+}
+
+func (r *BenchResult) finish(elapsed time.Duration) {
+	r.Elapsed = elapsed
+	if len(r.latencies) == 0 {
+		return
+	}
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	r.P50 = percentile(r.latencies, 50)
+	r.P99 = percentile(r.latencies, 99)
+	r.Max = r.latencies[len(r.latencies)-1]
+}
+
+// percentile returns the latency p percent of the sorted latencies are no
+// slower than.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p + 99) / 100
+	return sorted[max(i-1, 0)]
+}
+
+func benchErrorCode(err error) string {
+	var statusErr *StatusError
+	switch {
+	case errors.As(err, &statusErr) && statusErr.Code != "":
+		return statusErr.Code
+	case errors.As(err, &statusErr):
+		return strconv.Itoa(statusErr.StatusCode)
+	case errors.Is(err, errChecksumMismatch):
+		return "CHECKSUM_MISMATCH"
+	case errors.Is(err, errShortDownload):
+		return "SHORT_DOWNLOAD"
+	}
+	return "network"
+}
+
+// BenchReport is the outcome of Bench. Upload and Download are nil when
+// they were not measured.
+type BenchReport struct {
+	Upload   *BenchResult
+	Download *BenchResult
+}
+
+// benchPayload is the content of bench uploads: a random block repeated up
+// to size, and its checksum.
+type benchPayload struct {
+	block []byte
+	size  int64
+	sum   string
+}
+
+func newBenchPayload(size int64) (*benchPayload, error) {
+	p := &benchPayload{block: make([]byte, min(size, benchBlockSize)), size: size}
+	if _, err := rand.Read(p.block); err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, p.reader()); err != nil {
+		return nil, err
+	}
+	p.sum = hex.EncodeToString(hash.Sum(nil))
+	return p, nil
+}
+
+func (p *benchPayload) reader() io.Reader {
+	return &repeatReader{block: p.block, left: p.size}
+}
+
+type repeatReader struct {
+	block []byte
+	off   int
+	left  int64
+}
+
+func (r *repeatReader) Read(b []byte) (int, error) {
+	if r.left <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(b)) > r.left {
+		b = b[:r.left]
+	}
+	n := copy(b, r.block[r.off:])
+	r.off = (r.off + n) % len(r.block)
+	r.left -= int64(n)
+	return n, nil
+}
+
+// Bench drives concurrent uploads and downloads of Size bytes against the
+// server, without retrying failures, until Duration passes or Requests
+// were made. Downloads fetch a file uploaded beforehand. Every upload
+// carries the same content, so a server deduplicating uploads stores it
+// once.
+func (c *Client) Bench(ctx context.Context, opts BenchOptions) (*BenchReport, error) {
+	if !opts.Uploads && !opts.Downloads {
+		return nil, errors.New("nothing to measure, neither uploads nor downloads are enabled")
+	}
+	if opts.Concurrency < 1 {
+		return nil, fmt.Errorf("concurrency must be at least 1, not %d", opts.Concurrency)
+	}
+	if opts.Duration <= 0 && opts.Requests <= 0 {
+		return nil, errors.New("either a duration or a number of requests must end the test")
+	}
+	payload, err := newBenchPayload(opts.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	var uploaded []*Result
+	report := &BenchReport{}
+	if opts.Uploads {
+		report.Upload = &BenchResult{ErrorCodes: make(map[string]int)}
+	}
+	if opts.Downloads {
+		report.Download = &BenchResult{ErrorCodes: make(map[string]int)}
+		file, err := c.upload(ctx, "bench.bin", payload.reader(), payload.size, payload.sum)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload the file to download: %w", err)
+		}
+		uploaded = append(uploaded, file)
+	}
+	downloadURL := ""
+	if len(uploaded) > 0 {
+		downloadURL = uploaded[0].URL
+	}
+
+	runCtx := ctx
+	if opts.Duration > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, opts.Duration)
+		defer cancel()
+	}
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				n := next.Add(1)
+				if opts.Requests > 0 && n > int64(opts.Requests) || runCtx.Err() != nil {
+					return
+				}
+				isUpload := opts.Uploads && (!opts.Downloads || n%2 == 1)
+				began := time.Now()
+				var file *Result
+				var err error
+				if isUpload {
+					file, err = c.upload(runCtx, fmt.Sprintf("bench-%d.bin", n), payload.reader(), payload.size, payload.sum)
+				} else {
+					err = c.benchDownload(runCtx, downloadURL, payload.size)
+				}
+				latency := time.Since(began)
+				// Transfers cut off by the end of the test are not counted.
+				if err != nil && runCtx.Err() != nil {
+					return
+				}
+				mu.Lock()
+				if isUpload {
+					report.Upload.add(latency, payload.size, err)
+					if file != nil {
+						uploaded = append(uploaded, file)
+					}
+				} else {
+					report.Download.add(latency, payload.size, err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	for _, result := range []*BenchResult{report.Upload, report.Download} {
+		if result != nil {
+			result.finish(elapsed)
+		}
+	}
+
+	if !opts.Keep {
+		for _, file := range uploaded {
+			if err := c.deleteUpload(ctx, file); err != nil {
+				return report, fmt.Errorf("failed to delete %s: %w", file.URL, err)
+			}
+		}
+	}
+	return report, nil
+}
+
+func (c *Client) benchDownload(ctx context.Context, rawURL string, size int64) error {
+	req, err := c.newRequest(ctx, http.MethodGet, rawURL)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	n, err := io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return errShortDownload
+	}
+	return nil
+}
+
+// deleteUpload deletes file through its delete link, or with the auth token
+// when the server hands out none.
+func (c *Client) deleteUpload(ctx context.Context, file *Result) error {
+	rawURL := file.DeleteURL
+	if rawURL == "" {
+		rawURL = file.URL
+	}
+	req, err := c.newRequest(ctx, http.MethodDelete, rawURL)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return responseError(resp)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package simpleclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflare/cloudflared/simpleserver"
+)
+
+// benchServer runs a simpleserver storing its uploads in the returned dir.
+func benchServer(t *testing.T, opts ...simpleserver.Option) (*httptest.Server, string) {
+	t.Helper()
+	dir := t.TempDir()
+	s := simpleserver.New(append([]simpleserver.Option{simpleserver.WithUploadDir(dir), simpleserver.WithAuthToken("secret")}, opts...)...)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(ts.URL + "/startupz")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+	return ts, dir
+}
+
+// storedFiles counts the uploads left in the upload dir of a server.
+func storedFiles(t *testing.T, dir string) int {
+	t.Helper()
+	n := 0
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name()[0] == '.' {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(dir, entry.Name()))
+		require.NoError(t, err)
+		n += len(files)
+	}
+	return n
+}
+
+func TestBench(t *testing.T) {
+	ts, dir := benchServer(t)
+	client := New(ts.URL, "secret")
+	report, err := client.Bench(context.Background(), BenchOptions{
+		Size: 3<<20 + 5, Concurrency: 4, Duration: time.Minute, Requests: 10, Uploads: true, Downloads: true,
+	})
+	require.NoError(t, err)
+	for _, result := range []*BenchResult{report.Upload, report.Download} {
+		require.Equal(t, 5, result.Requests)
+		require.Zero(t, result.Errors, result.ErrorCodes)
+		require.Equal(t, int64(5*(3<<20+5)), result.Bytes)
+		require.Positive(t, result.Throughput())
+		require.Positive(t, result.P50)
+		require.LessOrEqual(t, result.P50, result.P99)
+		require.LessOrEqual(t, result.P99, result.Max)
+	}
+	require.Zero(t, storedFiles(t, dir))
+
+	report, err = client.Bench(context.Background(), BenchOptions{Size: 10, Concurrency: 2, Requests: 3, Uploads: true, Keep: true})
+	require.NoError(t, err)
+	require.Nil(t, report.Download)
+	require.Equal(t, 3, report.Upload.Requests)
+	require.Equal(t, 3, storedFiles(t, dir))
+}
+
+func TestBenchCountsErrors(t *testing.T) {
+	ts, _ := benchServer(t, simpleserver.WithMaxSize(1))
+	report, err := New(ts.URL, "secret").Bench(context.Background(), BenchOptions{Size: 2 << 20, Concurrency: 2, Requests: 4, Uploads: true})
+	require.NoError(t, err)
+	require.Equal(t, 4, report.Upload.Requests)
+	require.Equal(t, 4, report.Upload.Errors)
+	require.Equal(t, 1.0, report.Upload.ErrorRate())
+	require.Equal(t, map[string]int{"FILE_TOO_LARGE": 4}, report.Upload.ErrorCodes)
+	require.Zero(t, report.Upload.P99)
+
+	_, err = New(ts.URL, "wrong").Bench(context.Background(), BenchOptions{Size: 1, Concurrency: 1, Requests: 1, Downloads: true})
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	require.Equal(t, "UNAUTHORIZED", statusErr.Code)
+
+	_, err = New(ts.URL, "secret").Bench(context.Background(), BenchOptions{Size: 1, Concurrency: 1, Requests: 1})
+	require.Error(t, err)
+}
+
+func TestPercentile(t *testing.T) {
+	var latencies []time.Duration
+	for i := 1; i <= 200; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	require.Equal(t, 100*time.Millisecond, percentile(latencies, 50))
+	require.Equal(t, 198*time.Millisecond, percentile(latencies, 99))
+	require.Equal(t, time.Millisecond, percentile(latencies[:1], 99))
+}
@@ -0,0 +1,198 @@
+// Package simpleclient uploads files to and downloads them from a running
+// simpleserver.
+package simpleclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cloudflared/retry"
+)
+
+const (
+	// contentSHA256Header makes the server reject an upload that does not
+	// match the checksum computed here.
+	contentSHA256Header = "Content-SHA256"
+	// DefaultRetries is how often a failed upload is retried.
+	DefaultRetries = 3
+)
+
+var errChecksumMismatch = errors.New("the server stored a different checksum than the file has")
+
+// Client uploads files to the simpleserver at BaseURL.
+type Client struct {
+	BaseURL string
+	// AuthToken is sent as bearer token when the server requires one.
+	AuthToken  string
+	HTTPClient *http.Client
+	// Retries is how often an upload is retried after network errors and
+	// server side failures.
+	Retries uint
+	// RetryBaseTime is the first backoff between retries, doubling with
+	// each of them. Defaults to a second.
+	RetryBaseTime time.Duration
+	// Progress is called with the bytes sent so far as the upload is read.
+	// It starts over from zero when an upload is retried.
+	Progress func(sent, total int64)
+}
+
+// New returns a client for the server at baseURL.
+func New(baseURL, authToken string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		AuthToken:  authToken,
+		HTTPClient: http.DefaultClient,
+		Retries:    DefaultRetries,
+	}
+}
+
+// Result describes a stored upload, as the server reports it.
+type Result struct {
+	URL         string     `json:"url"`
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Size        int64      `json:"size"`
+	SHA256      string     `json:"sha256"`
+	ContentType string     `json:"content_type"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	ShortURL    string     `json:"short_url,omitempty"`
+	// DeleteURL deletes the upload with DELETE.
+	DeleteURL string `json:"delete_url,omitempty"`
+}
+
+// StatusError is a request the server rejected.
+type StatusError struct {
+	StatusCode int
+	// Code is the code of the error the server answered with, such as
+	// FILE_TOO_LARGE, and empty when it sent none.
+	Code    string
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("request failed with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("request failed with status %d: %s", e.StatusCode, e.Message)
+}
+
+// temporary reports whether the same request may succeed when retried.
+func (e *StatusError) temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500 && e.StatusCode != http.StatusInsufficientStorage
+}
+
+// UploadFile uploads the file at path under its base name. The checksum of
+// the file is computed first, so the server verifies the upload against it
+// and the client verifies the server's answer.
+func (c *Client) UploadFile(ctx context.Context, path string) (*Result, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	backoff := retry.NewBackoff(c.Retries, c.RetryBaseTime, false)
+	for {
+		result, err := c.upload(ctx, filepath.Base(path), io.NewSectionReader(file, 0, info.Size()), info.Size(), sum)
+		var statusErr *StatusError
+		switch {
+		case err == nil:
+			return result, nil
+		case errors.As(err, &statusErr) && !statusErr.temporary(), errors.Is(err, errChecksumMismatch), ctx.Err() != nil:
+			return nil, err
+		}
+		if !backoff.Backoff(ctx) {
+			return nil, err
+		}
+	}
+}
+
+func (c *Client) upload(ctx context.Context, name string, content io.Reader, size int64, sum string) (*Result, error) {
+	body := &progressReader{r: content, total: size, progress: c.Progress}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.BaseURL+"/"+url.PathEscape(name), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set(contentSHA256Header, sum)
+	if c.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+	var result Result
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to read the upload response: %w", err)
+	}
+	if result.SHA256 != sum {
+		return nil, errChecksumMismatch
+	}
+	return &result, nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// responseError reads the {"code": ..., "message": ...} the server answers
+// failures with, falling back to the plain text body.
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var decoded struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &decoded) == nil && decoded.Message != "" {
+		return &StatusError{StatusCode: resp.StatusCode, Code: decoded.Code, Message: decoded.Message}
+	}
+	return &StatusError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+}
+
+type progressReader struct {
+	r        io.Reader
+	sent     int64
+	total    int64
+	progress func(sent, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.sent += int64(n)
+	if p.progress != nil {
+		p.progress(p.sent, p.total)
+	}
+	return n, err
+}
@@ -0,0 +1,94 @@
+package simpleclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+// fakeServer answers uploads like simpleserver does, failing the first
+// failures of them with status.
+func fakeServer(t *testing.T, failures, status int) (*httptest.Server, *int) {
+	t.Helper()
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		if attempts <= failures {
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]string{"code": "TRY_AGAIN", "message": "try again"})
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		sum := sha256.Sum256(body)
+		require.Equal(t, hex.EncodeToString(sum[:]), r.Header.Get(contentSHA256Header))
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(Result{
+			URL:    "http://" + r.Host + "/abc123" + r.URL.Path,
+			ID:     "abc123",
+			Name:   r.URL.Path[1:],
+			Size:   int64(len(body)),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &attempts
+}
+
+func TestUploadFile(t *testing.T) {
+	ts, attempts := fakeServer(t, 1, http.StatusServiceUnavailable)
+	client := New(ts.URL+"/", "secret")
+	client.RetryBaseTime = time.Millisecond
+	var sent, total int64
+	client.Progress = func(s, t int64) { sent, total = s, t }
+
+	result, err := client.UploadFile(context.Background(), writeFile(t, "notes.txt", "meeting notes"))
+	require.NoError(t, err)
+	require.Equal(t, 2, *attempts)
+	require.Equal(t, ts.URL+"/abc123/notes.txt", result.URL)
+	require.Equal(t, int64(len("meeting notes")), result.Size)
+	require.Equal(t, result.Size, sent)
+	require.Equal(t, result.Size, total)
+}
+
+func TestUploadFileGivesUpOnClientErrors(t *testing.T) {
+	ts, attempts := fakeServer(t, 5, http.StatusRequestEntityTooLarge)
+	client := New(ts.URL, "secret")
+	client.RetryBaseTime = time.Millisecond
+	_, err := client.UploadFile(context.Background(), writeFile(t, "big.bin", "big"))
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	require.Equal(t, http.StatusRequestEntityTooLarge, statusErr.StatusCode)
+	require.Equal(t, "TRY_AGAIN", statusErr.Code)
+	require.Equal(t, "try again", statusErr.Message)
+	require.Equal(t, 1, *attempts)
+
+	ts, attempts = fakeServer(t, 5, http.StatusBadGateway)
+	client = New(ts.URL, "secret")
+	client.RetryBaseTime = time.Millisecond
+	client.Retries = 2
+	_, err = client.UploadFile(context.Background(), writeFile(t, "a.txt", "a"))
+	require.ErrorAs(t, err, &statusErr)
+	require.Equal(t, 3, *attempts)
+}
@@ -0,0 +1,305 @@
+package simpleclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cloudflare/cloudflared/retry"
+)
+
+const (
+	// checksumHeader carries the hex SHA-256 of a download.
+	checksumHeader = "X-Checksum"
+	// partialSuffix marks a download that can be resumed.
+	partialSuffix = ".part"
+	// minChunkSize keeps small files from being split among connections.
+	minChunkSize = 1 << 20
+)
+
+var (
+	errDownloadChecksum = errors.New("the download does not match its checksum")
+	errFileChanged      = errors.New("the file changed during the download")
+)
+
+// DownloadResult describes a completed download.
+type DownloadResult struct {
+	Path   string
+	Size   int64
+	SHA256 string
+}
+
+// DownloadName is the file name a download from rawURL is saved as.
+func DownloadName(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		return "", fmt.Errorf("%s does not name a file", rawURL)
+	}
+	return name, nil
+}
+
+// remoteFile is what a HEAD request tells about a download.
+type remoteFile struct {
+	size   int64
+	sha256 string
+	etag   string
+	ranges bool
+}
+
+// Download saves the file at rawURL to dest. Bytes go to dest.part first,
+// so an interrupted download resumes where it stopped when the server
+// serves ranges, and dest only appears once the checksum the server
+// reports was verified. With more than one connection, big files are
+// fetched in that many ranges in parallel.
+func (c *Client) Download(ctx context.Context, rawURL, dest string, connections int) (*DownloadResult, error) {
+	remote, err := c.head(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	partial := dest + partialSuffix
+	file, err := os.OpenFile(partial, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := info.Size()
+	if !remote.ranges || remote.size < 0 || offset > remote.size {
+		offset = 0
+	}
+	if err := file.Truncate(offset); err != nil {
+		return nil, err
+	}
+
+	var sent atomic.Int64
+	sent.Store(offset)
+	progress := func(n int) {
+		total := sent.Add(int64(n))
+		if c.Progress != nil {
+			c.Progress(total, remote.size)
+		}
+	}
+	chunks := splitRange(offset, remote.size, connections)
+	if !remote.ranges || len(chunks) == 0 {
+		// Without ranges there is nothing to resume or split: fetch it whole.
+		chunks = []*chunk{{start: 0, end: remote.size}}
+	}
+	err = c.fetchChunks(ctx, rawURL, remote, file, chunks, progress)
+	if err != nil {
+		// Keep the bytes every chunk got in a row, so the next attempt
+		// resumes after them.
+		if errors.Is(err, errFileChanged) {
+			file.Close()
+			os.Remove(partial)
+		} else if remote.ranges {
+			file.Truncate(contiguous(chunks))
+		}
+		return nil, err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return nil, err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if remote.sha256 != "" && sum != remote.sha256 {
+		file.Close()
+		os.Remove(partial)
+		return nil, errDownloadChecksum
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(partial, dest); err != nil {
+		return nil, err
+	}
+	return &DownloadResult{Path: dest, Size: size, SHA256: sum}, nil
+}
+
+func (c *Client) newRequest(ctx context.Context, method, rawURL string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Compressed responses would break byte ranges and the checksum.
+	req.Header.Set("Accept-Encoding", "identity")
+	if c.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	}
+	return req, nil
+}
+
+func (c *Client) head(ctx context.Context, rawURL string) (*remoteFile, error) {
+	req, err := c.newRequest(ctx, http.MethodHead, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	}
+	return &remoteFile{
+		size:   resp.ContentLength,
+		sha256: resp.Header.Get(checksumHeader),
+		etag:   resp.Header.Get("ETag"),
+		ranges: resp.Header.Get("Accept-Ranges") == "bytes" && resp.ContentLength >= 0,
+	}, nil
+}
+
+// chunk is the byte range [start, end) of a download. end is -1 when the
+// size is unknown.
+type chunk struct {
+	start, end int64
+	written    int64
+}
+
+// splitRange divides [offset, size) into up to connections chunks of at
+// least minChunkSize bytes.
+func splitRange(offset, size int64, connections int) []*chunk {
+	if size < 0 || offset >= size {
+		return nil
+	}
+	remaining := size - offset
+	n := int64(max(connections, 1))
+	n = max(min(n, remaining/minChunkSize), 1)
+	chunks := make([]*chunk, 0, n)
+	step := remaining / n
+	for i := int64(0); i < n; i++ {
+		start := offset + i*step
+		end := start + step
+		if i == n-1 {
+			end = size
+		}
+		chunks = append(chunks, &chunk{start: start, end: end})
+	}
+	return chunks
+}
+
+// contiguous is how far the file is complete from its start.
+func contiguous(chunks []*chunk) int64 {
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].start < chunks[j].start })
+	var done int64
+	for _, ch := range chunks {
+		done = ch.start + ch.written
+		if ch.end < 0 || done < ch.end {
+			break
+		}
+	}
+	return done
+}
+
+// fetchChunks downloads every chunk in parallel, retrying each of them
+// from where it stopped.
+func (c *Client) fetchChunks(ctx context.Context, rawURL string, remote *remoteFile, file *os.File, chunks []*chunk, progress func(int)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make([]error, len(chunks))
+	for i, ch := range chunks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			backoff := retry.NewBackoff(c.Retries, c.RetryBaseTime, false)
+			for {
+				err := c.fetchChunk(ctx, rawURL, remote, file, ch, progress)
+				var statusErr *StatusError
+				permanent := errors.As(err, &statusErr) && !statusErr.temporary() || errors.Is(err, errFileChanged)
+				if err == nil || permanent || !backoff.Backoff(ctx) {
+					errs[i] = err
+					if err != nil {
+						cancel()
+					}
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (c *Client) fetchChunk(ctx context.Context, rawURL string, remote *remoteFile, file *os.File, ch *chunk, progress func(int)) error {
+	req, err := c.newRequest(ctx, http.MethodGet, rawURL)
+	if err != nil {
+		return err
+	}
+	if !remote.ranges && ch.written > 0 {
+		// Start over, the server can only send the whole file.
+		progress(-int(ch.written))
+		ch.written = 0
+	}
+	from := ch.start + ch.written
+	ranged := remote.ranges && (from > 0 || ch.end < remote.size)
+	if ranged {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", from, ch.end-1))
+		if remote.etag != "" {
+			req.Header.Set("If-Range", remote.etag)
+		}
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case ranged && resp.StatusCode == http.StatusPartialContent:
+	case !ranged && resp.StatusCode == http.StatusOK:
+	case ranged && resp.StatusCode == http.StatusOK:
+		// The file changed since the bytes fetched before, which belong to
+		// another version of it.
+		return errFileChanged
+	default:
+		return responseError(resp)
+	}
+	w := &chunkWriter{file: file, ch: ch, progress: progress}
+	var body io.Reader = resp.Body
+	if ch.end >= 0 {
+		body = io.LimitReader(resp.Body, ch.end-from)
+	}
+	if _, err := io.Copy(w, body); err != nil {
+		return err
+	}
+	if ch.end >= 0 && ch.start+ch.written < ch.end {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// chunkWriter writes a chunk at its place in the file.
+type chunkWriter struct {
+	file     *os.File
+	ch       *chunk
+	progress func(int)
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	n, err := w.file.WriteAt(p, w.ch.start+w.ch.written)
+	w.ch.written += int64(n)
+	w.progress(n)
+	return n, err
+}
@@ -0,0 +1,109 @@
+package simpleclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// rangeServer serves content with ranges, an ETag and its checksum, the way
+// simpleserver serves stored files. It counts the ranged requests.
+func rangeServer(t *testing.T, content []byte, checksum string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var ranged atomic.Int32
+	if checksum == "" {
+		sum := sha256.Sum256(content)
+		checksum = hex.EncodeToString(sum[:])
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			ranged.Add(1)
+		}
+		w.Header().Set(checksumHeader, checksum)
+		w.Header().Set("ETag", `"`+checksum+`"`)
+		w.Header().Set("Accept-Ranges", "bytes")
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &ranged
+}
+
+func randomContent(n int) []byte {
+	content := make([]byte, n)
+	rand.New(rand.NewSource(1)).Read(content)
+	return content
+}
+
+func TestDownloadInParallel(t *testing.T) {
+	content := randomContent(3*minChunkSize + 17)
+	ts, ranged := rangeServer(t, content, "")
+	dest := filepath.Join(t.TempDir(), "file.bin")
+
+	result, err := New(ts.URL, "").Download(context.Background(), ts.URL+"/abc/file.bin", dest, 4)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(content)), result.Size)
+	require.Equal(t, int32(3), ranged.Load())
+	saved, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	require.Equal(t, content, saved)
+	_, err = os.Stat(dest + partialSuffix)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadResumes(t *testing.T) {
+	content := randomContent(1000)
+	ts, ranged := rangeServer(t, content, "")
+	dest := filepath.Join(t.TempDir(), "file.bin")
+	require.NoError(t, os.WriteFile(dest+partialSuffix, content[:400], 0644))
+
+	client := New(ts.URL, "")
+	var sent int64
+	client.Progress = func(s, total int64) { sent = s }
+	_, err := client.Download(context.Background(), ts.URL+"/abc/file.bin", dest, 1)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), ranged.Load())
+	require.Equal(t, int64(len(content)), sent)
+	saved, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	require.Equal(t, content, saved)
+}
+
+func TestDownloadVerifiesChecksum(t *testing.T) {
+	ts, _ := rangeServer(t, []byte("hello"), strings.Repeat("0", 64))
+	dest := filepath.Join(t.TempDir(), "file.bin")
+	_, err := New(ts.URL, "").Download(context.Background(), ts.URL+"/abc/file.bin", dest, 1)
+	require.ErrorIs(t, err, errDownloadChecksum)
+	_, err = os.Stat(dest)
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(dest + partialSuffix)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestContiguous(t *testing.T) {
+	chunks := []*chunk{
+		{start: 10, end: 20, written: 3},
+		{start: 0, end: 10, written: 10},
+		{start: 20, end: 30, written: 10},
+	}
+	require.Equal(t, int64(13), contiguous(chunks))
+}
+
+func TestDownloadName(t *testing.T) {
+	name, err := DownloadName("https://example.com/abc/my%20notes.txt?inline=true")
+	require.NoError(t, err)
+	require.Equal(t, "my notes.txt", name)
+	_, err = DownloadName("https://example.com/")
+	require.Error(t, err)
+}
@@ -0,0 +1,146 @@
+package simpleserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	accessJWTHeader = "Cf-Access-Jwt-Assertion"
+	// accessDirPrefix starts the upload directories of Access identities.
+	// Slugs cannot contain it, so no other upload can take their place.
+	accessDirPrefix       = "~"
+	defaultIdentityClaim  = "email"
+	cloudflareAccessCerts = "/cdn-cgi/access/certs"
+)
+
+// requestIdentityKey holds the identity a request authenticated as, for the
+// request log.
+const requestIdentityKey = "simpleserver.identity"
+
+var (
+	errNoAccessToken   = errors.New("no access token in request")
+	errAccessAudience  = errors.New("access token is for another application")
+	errNoIdentityClaim = errors.New("access token has no identity claim")
+)
+
+// accessVerifier validates the JWTs Cloudflare Access, or another OIDC
+// provider, issues for the clients it lets through.
+type accessVerifier struct {
+	verifier  *oidc.IDTokenVerifier
+	audiences []string
+	claim     string
+}
+
+// newAccessVerifier builds the verifier of Config.AccessTeamDomain or
+// Config.OIDCIssuer. The Access signing keys are fetched on first use, an
+// OIDC issuer is discovered right away.
+func newAccessVerifier(ctx context.Context, config Config) (*accessVerifier, error) {
+	v := &accessVerifier{audiences: config.AccessAUD, claim: config.AccessIdentityClaim}
+	if v.claim == "" {
+		v.claim = defaultIdentityClaim
+	}
+	// Audiences are checked by hand, Access tokens carry the application's
+	// tag rather than a client ID.
+	oidcConfig := &oidc.Config{SkipClientIDCheck: true}
+	if config.AccessTeamDomain != "" {
+		issuer := "https://" + strings.TrimSuffix(strings.TrimPrefix(config.AccessTeamDomain, "https://"), "/")
+		keys := oidc.NewRemoteKeySet(context.Background(), issuer+cloudflareAccessCerts)
+		v.verifier = oidc.NewVerifier(issuer, keys, oidcConfig)
+		return v, nil
+	}
+	provider, err := oidc.NewProvider(ctx, config.OIDCIssuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC issuer %s: %w", config.OIDCIssuer, err)
+	}
+	v.verifier = provider.Verifier(oidcConfig)
+	return v, nil
+}
+
+// identity returns the identity claim of the token r carries, either in the
+// header set by Cloudflare Access or as an OIDC bearer token.
+func (v *accessVerifier) identity(ctx context.Context, r *http.Request) (string, error) {
+	raw := r.Header.Get(accessJWTHeader)
+	if raw == "" {
+		// Bearer tokens that are not JWTs are upload or admin tokens.
+		if bearer, ok := strings.CutPrefix(r.Header.Get(echo.HeaderAuthorization), "Bearer "); ok && strings.Count(bearer, ".") == 2 {
+			raw = bearer
+		}
+	}
+	if raw == "" {
+		return "", errNoAccessToken
+	}
+	token, err := v.verifier.Verify(ctx, raw)
+	if err != nil {
+		return "", err
+	}
+	if !v.acceptsAudience(token.Audience) {
+		return "", errAccessAudience
+	}
+	var claims map[string]any
+	if err := token.Claims(&claims); err != nil {
+		return "", err
+	}
+	identity, _ := claims[v.claim].(string)
+	if identity == "" {
+		return "", errNoIdentityClaim
+	}
+	return identity, nil
+}
+
+// acceptsAudience reports whether one of audiences is configured.
+func (v *accessVerifier) acceptsAudience(audiences []string) bool {
+	for _, audience := range audiences {
+		for _, accepted := range v.audiences {
+			if audience == accepted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// requireAccess rejects requests without a valid access token when Access
+// or OIDC validation is enabled, so the server cannot be reached by going
+// around Cloudflare Access. Probes are always answered.
+func (s *Server) requireAccess(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		// Peers authenticate with the cluster secret instead.
+		if s.access == nil || isProbePath(c.Request().URL.Path) || strings.HasPrefix(c.Request().URL.Path, clusterBlobsPath+"/") {
+			return next(c)
+		}
+		identity, err := s.access.identity(c.Request().Context(), c.Request())
+		if err != nil {
+			log.Printf("Rejected access token from %s: %v\n", c.RealIP(), err)
+			return fail(c, http.StatusForbidden, "Forbidden")
+		}
+		c.Set(requestIdentityKey, identity)
+		c.Set(requestUserKey, identityDir(identity))
+		return next(c)
+	}
+}
+
+// identityDir is the upload directory of an Access identity, e.g.
+// ~alice_example.com for alice@example.com.
+func identityDir(identity string) string {
+	dir := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '_'
+	}, identity)
+	if max := maxSlugLength - len(accessDirPrefix); len(dir) > max {
+		dir = dir[:max]
+	}
+	return accessDirPrefix + dir
+}
@@ -0,0 +1,100 @@
+package simpleserver
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testAccessIssuer = "https://testteam.cloudflareaccess.com"
+	testAccessAUD    = "d7ec5b7fda23ffa8f8c8559fb37c66a2278208a78dbe376a3394b5ffec6911ba"
+)
+
+type testAccessClaims struct {
+	Email string `json:"email,omitempty"`
+	jwt.Claims
+}
+
+// newAccessServer starts a server validating tokens signed by the returned
+// key instead of the ones published by the team domain.
+func newAccessServer(t *testing.T) (*Server, *ecdsa.PrivateKey) {
+	t.Helper()
+	s := newTestServer(t, Config{AccessTeamDomain: "testteam.cloudflareaccess.com", AccessAUD: []string{testAccessAUD}})
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	keys := &oidc.StaticKeySet{PublicKeys: []crypto.PublicKey{key.Public()}}
+	s.access.verifier = oidc.NewVerifier(testAccessIssuer, keys, &oidc.Config{
+		SkipClientIDCheck:    true,
+		SupportedSigningAlgs: []string{string(jose.ES256)},
+	})
+	return s, key
+}
+
+func signAccessToken(t *testing.T, key *ecdsa.PrivateKey, email, audience string) string {
+	t.Helper()
+	now := time.Now()
+	claims := testAccessClaims{Email: email, Claims: jwt.Claims{
+		Issuer:   testAccessIssuer,
+		Audience: jwt.Audience{audience},
+		Expiry:   jwt.NewNumericDate(now.Add(time.Hour)),
+		IssuedAt: jwt.NewNumericDate(now),
+	}}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, nil)
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	jws, err := signer.Sign(payload)
+	require.NoError(t, err)
+	token, err := jws.CompactSerialize()
+	require.NoError(t, err)
+	return token
+}
+
+func TestAccessTokenMapsIdentityToDirectory(t *testing.T) {
+	s, key := newAccessServer(t)
+	upload := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("hello"))
+		if token != "" {
+			req.Header.Set(accessJWTHeader, token)
+		}
+		return serve(s, req)
+	}
+
+	require.Equal(t, http.StatusForbidden, upload("").Code)
+	require.Equal(t, http.StatusForbidden, upload(signAccessToken(t, key, "alice@example.com", "other-app")).Code)
+	require.Equal(t, http.StatusOK, serve(s, httptest.NewRequest(http.MethodGet, livePath, nil)).Code, "probes need no token")
+
+	rec := upload(signAccessToken(t, key, "Alice@example.com", testAccessAUD))
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	require.Contains(t, rec.Body.String(), "/~alice_example.com/notes.txt")
+
+	// Only the owner lists the directory, OIDC clients send the token as a
+	// bearer token.
+	listing := func(email string) int {
+		req := httptest.NewRequest(http.MethodGet, "/~alice_example.com", nil)
+		req.Header.Set("Authorization", "Bearer "+signAccessToken(t, key, email, testAccessAUD))
+		return serve(s, req).Code
+	}
+	require.Equal(t, http.StatusOK, listing("alice@example.com"))
+	require.Equal(t, http.StatusUnauthorized, listing("mallory@example.com"))
+}
+
+func TestIdentityDir(t *testing.T) {
+	require.Equal(t, "~alice_example.com", identityDir("alice@example.com"))
+	require.Equal(t, "~.._etc_passwd", identityDir("../etc/passwd"))
+	require.True(t, isShareDir(identityDir("../etc/passwd")))
+	require.LessOrEqual(t, len(identityDir(strings.Repeat("a", 100))), maxSlugLength)
+}
@@ -0,0 +1,70 @@
+package simpleserver
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// requireAdmin guards the /admin routes with the configured admin token.
+func (s *Server) requireAdmin(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !validBearer(c.Request(), s.settings().AdminToken) {
+			return adminUnauthorized(c)
+		}
+		if requestIdentity(c) == "" {
+			c.Set(requestIdentityKey, "admin")
+		}
+		return next(c)
+	}
+}
+
+func adminUnauthorized(c echo.Context) error {
+	c.Response().Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+	return fail(c, http.StatusUnauthorized, "Unauthorized")
+}
+
+// validBearer reports whether r carries "Authorization: Bearer <token>".
+func validBearer(r *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+	presented, ok := strings.CutPrefix(r.Header.Get(echo.HeaderAuthorization), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(presented), []byte(token)) == 1
+}
+
+// registerAdminRoutes serves the /admin routes when an admin token is set at
+// startup. Reloads may change the token but not add or remove the routes.
+func (s *Server) registerAdminRoutes(e *echo.Echo) {
+	if s.config.AdminToken == "" {
+		return
+	}
+	admin := e.Group("/admin", s.requireAdmin)
+	admin.GET("/tokens/:token/usage", s.handleTokenUsage)
+	admin.GET("/usage", s.handleUsage)
+	admin.GET("/files", s.handleAdminFiles)
+	admin.DELETE("/files/:dir/*", s.handleAdminDelete, s.rejectWhenReadOnly)
+	admin.GET("/trash", s.handleTrash)
+	admin.POST("/files/:id/restore", s.handleRestore, s.rejectWhenReadOnly)
+	admin.GET("/stats", s.handleAdminStats)
+	admin.GET("/stats/export", s.handleStatsExport)
+	admin.GET("/config", s.handleConfig)
+	admin.POST("/presign-upload", s.handlePresign)
+	admin.POST("/shares/:dir/link", s.handleShareLink)
+	admin.GET("/gc", s.handleGC)
+	admin.POST("/gc", s.handleGC, s.rejectWhenReadOnly)
+	admin.GET("/integrity", s.handleIntegrity)
+	admin.POST("/integrity", s.handleIntegrity, s.rejectWhenReadOnly)
+	admin.GET("/maintenance", s.handleMaintenanceStatus)
+	admin.POST("/maintenance", s.handleMaintenance)
+	admin.GET("/mode", s.handleMode)
+	admin.POST("/mode", s.handleMode)
+	admin.GET("/replication", s.handleReplication)
+	admin.GET("/reconcile", s.handleReconcile)
+	if s.config.AuditLog != "" {
+		admin.GET("/audit", s.handleAudit)
+	}
+	e.GET(eventsPath, s.handleEvents, s.requireAdmin)
+}
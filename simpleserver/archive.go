@@ -0,0 +1,87 @@
+package simpleserver
+
+import (
+	"archive/zip"
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const zipSuffix = ".zip"
+
+// wantsZip reports whether a request for an upload directory asks for all
+// of its files as one archive, with GET /:dir.zip or GET /:dir?format=zip.
+func wantsZip(c echo.Context) (string, bool) {
+	dir := c.Param("dir")
+	if trimmed := strings.TrimSuffix(dir, zipSuffix); trimmed != dir {
+		return trimmed, true
+	}
+	return dir, c.QueryParam("format") == "zip"
+}
+
+// zipFiles returns the files of dir a zip archive may hold.
+func (s *Server) zipFiles(dir string) []FileMeta {
+	var files []FileMeta
+	now := time.Now()
+	for _, meta := range s.index.inDir(dir) {
+		if !meta.servedInBulk(now) || !meta.listed() {
+			continue
+		}
+		files = append(files, meta)
+	}
+	return files
+}
+
+// handleZip streams the files of dir as a zip archive. Entries are stored
+// rather than deflated, so the archive costs little more CPU than serving the
+// files one by one, and nothing is buffered on disk. Once the archive has
+// started, failures can only be logged and leave it truncated.
+func (s *Server) handleZip(c echo.Context, dir string) error {
+	files := s.zipFiles(dir)
+	if !isShareDir(dir) || len(files) == 0 {
+		return fail(c, http.StatusNotFound, "Directory not found")
+	}
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, "application/zip")
+	header.Set(echo.HeaderContentDisposition, contentDisposition("attachment", dir+zipSuffix))
+	c.Response().WriteHeader(http.StatusOK)
+
+	zw := zip.NewWriter(c.Response())
+	for _, meta := range files {
+		if err := s.addToZip(c.Request().Context(), zw, meta); err != nil {
+			log.Printf("Failed to add %s/%s to zip archive: %v\n", meta.Dir, meta.Name, err)
+			return nil
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("Failed to finish zip archive of %s: %v\n", dir, err)
+	}
+	return nil
+}
+
+func (s *Server) addToZip(ctx context.Context, zw *zip.Writer, meta FileMeta) error {
+	obj, err := s.storage.Get(ctx, meta.key())
+	if err != nil {
+		return err
+	}
+	defer obj.Content.Close()
+	r, err := s.decodedReader(obj.Content, meta)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     meta.Name,
+		Method:   zip.Store,
+		Modified: meta.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = copyBuffer(w, r)
+	return err
+}
@@ -0,0 +1,70 @@
+package simpleserver
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readZip(t *testing.T, body []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	require.NoError(t, err)
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		require.Equal(t, zip.Store, f.Method)
+		r, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(r)
+		r.Close()
+		require.NoError(t, err)
+		files[f.Name] = string(content)
+	}
+	return files
+}
+
+func TestZipDirectory(t *testing.T) {
+	s := newTestServer(t, Config{AuthToken: testAuthToken, CompressAtRest: true, PreservePaths: true})
+	rec := serve(s, authorized(multipartRequest(t, http.MethodPost, "/",
+		testPart{"a.txt", strings.Repeat("a", 1000)},
+		testPart{"docs/b.txt", "bb"},
+	), testAuthToken))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	dir := shareDirs(t, s)[0]
+
+	for _, target := range []string{"/" + dir + ".zip", "/" + dir + "?format=zip"} {
+		rec = serve(s, authorized(httptest.NewRequest(http.MethodGet, target, nil), testAuthToken))
+		require.Equal(t, http.StatusOK, rec.Code, target)
+		require.Equal(t, "application/zip", rec.Header().Get("Content-Type"))
+		require.Equal(t, `attachment; filename="`+dir+`.zip"`, rec.Header().Get("Content-Disposition"))
+		require.Equal(t, map[string]string{"a.txt": strings.Repeat("a", 1000), "docs/b.txt": "bb"}, readZip(t, rec.Body.Bytes()))
+	}
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, "/"+dir+".zip", nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = serve(s, authorized(httptest.NewRequest(http.MethodGet, "/nosuchdir.zip", nil), testAuthToken))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestZipSkipsProtectedFiles(t *testing.T) {
+	s := newTestServer(t, Config{AuthToken: testAuthToken})
+	rec := serve(s, authorized(httptest.NewRequest(http.MethodPut, "/open.txt", strings.NewReader("open")), testAuthToken))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	open := findMeta(t, s, "open.txt")
+	// Batches share their options, so protect copies of the file instead.
+	secret, once := open, open
+	secret.Name, secret.PasswordHash = "secret.txt", "hash"
+	once.Name, once.Once = "once.txt", true
+	require.NoError(t, s.index.put(secret))
+	require.NoError(t, s.index.put(once))
+
+	rec = serve(s, authorized(httptest.NewRequest(http.MethodGet, "/"+open.Dir+".zip", nil), testAuthToken))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, map[string]string{"open.txt": "open"}, readZip(t, rec.Body.Bytes()))
+}
@@ -0,0 +1,181 @@
+package simpleserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// AuditAuthFailure is recorded for requests rejected with 401 or 403.
+	AuditAuthFailure = "auth_failure"
+
+	defaultAuditLimit = 1000
+	maxAuditLimit     = 100000
+)
+
+// AuditRecord is a line of the audit log.
+type AuditRecord struct {
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	ClientIP string    `json:"client_ip,omitempty"`
+	Identity string    `json:"identity,omitempty"`
+	// File is the <dir>/<filename> the record is about.
+	File   string `json:"file,omitempty"`
+	Bytes  int64  `json:"bytes,omitempty"`
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Status int    `json:"status,omitempty"`
+}
+
+// auditLog appends AuditRecords as JSON lines to Config.AuditLog. The file
+// is only ever appended to, rotating it is left to the operator.
+type auditLog struct {
+	path string
+	mu   sync.Mutex
+	file *os.File
+}
+
+func openAuditLog(path string) (*auditLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{path: path, file: file}, nil
+}
+
+func (a *auditLog) record(record AuditRecord) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("Failed to encode audit record: %v\n", err)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		log.Printf("Failed to write audit log %s: %v\n", a.path, err)
+	}
+}
+
+// query returns the last limit records of the log matching filter, oldest
+// first.
+func (a *auditLog) query(filter func(AuditRecord) bool, limit int) ([]AuditRecord, error) {
+	file, err := os.Open(a.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []AuditRecord{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	records := []AuditRecord{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// A line torn by a crash should not hide the rest of the log.
+			continue
+		}
+		if !filter(record) {
+			continue
+		}
+		if len(records) == limit {
+			records = append(records[:0], records[1:]...)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// requestIdentity is the user or Access identity c authenticated as.
+func requestIdentity(c echo.Context) string {
+	identity, _ := c.Get(requestIdentityKey).(string)
+	return identity
+}
+
+// audit records event in the audit log, when one is configured.
+func (s *Server) audit(event Event) {
+	if s.auditLog == nil {
+		return
+	}
+	record := AuditRecord{
+		Time:     event.Time,
+		Type:     event.Type,
+		ClientIP: event.ClientIP,
+		Identity: event.Identity,
+		File:     metaKey(event.Dir, event.Filename),
+		Bytes:    event.Bytes,
+	}
+	if event.Type == EventUpload {
+		record.Bytes = event.Size
+	}
+	s.auditLog.record(record)
+}
+
+// auditAuthFailures records the requests answered with 401 or 403.
+func (s *Server) auditAuthFailures(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		err := next(c)
+		status := c.Response().Status
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			status = httpErr.Code
+		}
+		if s.auditLog != nil && (status == http.StatusUnauthorized || status == http.StatusForbidden) {
+			s.auditLog.record(AuditRecord{
+				Time:     time.Now().UTC(),
+				Type:     AuditAuthFailure,
+				ClientIP: c.RealIP(),
+				Identity: requestIdentity(c),
+				Method:   c.Request().Method,
+				Path:     c.Request().URL.Path,
+				Status:   status,
+			})
+		}
+		return err
+	}
+}
+
+// handleAudit answers GET /admin/audit. since and until take RFC 3339 times,
+// type an event type, and limit caps the records returned, the latest ones
+// are kept.
+func (s *Server) handleAudit(c echo.Context) error {
+	var since, until time.Time
+	for name, bound := range map[string]*time.Time{"since": &since, "until": &until} {
+		if value := c.QueryParam(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return fail(c, http.StatusBadRequest, name+" must be an RFC 3339 time")
+			}
+			*bound = parsed
+		}
+	}
+	limit := defaultAuditLimit
+	if value := c.QueryParam("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > maxAuditLimit {
+			return fail(c, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxAuditLimit))
+		}
+		limit = n
+	}
+	eventType := c.QueryParam("type")
+	records, err := s.auditLog.query(func(record AuditRecord) bool {
+		return (since.IsZero() || !record.Time.Before(since)) &&
+			(until.IsZero() || record.Time.Before(until)) &&
+			(eventType == "" || record.Type == eventType)
+	}, limit)
+	if err != nil {
+		log.Printf("Failed to read audit log %s: %v\n", s.auditLog.path, err)
+		return fail(c, http.StatusInternalServerError, "Failed to read audit log")
+	}
+	return c.JSON(http.StatusOK, records)
+}
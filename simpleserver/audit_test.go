@@ -0,0 +1,64 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func queryAudit(t *testing.T, s *Server, query string) []AuditRecord {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/admin/audit"+query, nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	rec := serve(s, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var records []AuditRecord
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &records))
+	return records
+}
+
+func TestAuditLogRecordsFileAccess(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: "admin", AuditLog: filepath.Join(t.TempDir(), "audit.jsonl")})
+	start := time.Now().UTC().Add(-time.Second)
+
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("hello")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	url := downloadURLs(t, rec.Body.String())[0]
+	require.Equal(t, "hello", download(t, s, url).Body.String())
+	dir := shareDirs(t, s)[0]
+
+	req := httptest.NewRequest(http.MethodDelete, "/admin/files/"+dir+"/notes.txt", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	require.Equal(t, http.StatusUnauthorized, serve(s, req).Code)
+	req.Header.Set("Authorization", "Bearer admin")
+	require.Equal(t, http.StatusNoContent, serve(s, req).Code)
+
+	records := queryAudit(t, s, "")
+	require.Len(t, records, 4)
+	types := make([]string, len(records))
+	for i, record := range records {
+		types[i] = record.Type
+	}
+	require.Equal(t, []string{EventUpload, EventDownload, AuditAuthFailure, EventDelete}, types)
+	require.Equal(t, dir+"/notes.txt", records[0].File)
+	require.Equal(t, int64(5), records[0].Bytes)
+	require.Equal(t, int64(5), records[1].Bytes)
+	require.Equal(t, http.StatusUnauthorized, records[2].Status)
+	require.Equal(t, "admin", records[3].Identity)
+
+	require.Len(t, queryAudit(t, s, "?type=auth_failure"), 1)
+	require.Len(t, queryAudit(t, s, "?limit=2"), 2)
+	require.Equal(t, EventDelete, queryAudit(t, s, "?limit=1")[0].Type, "limit keeps the latest records")
+	require.Len(t, queryAudit(t, s, "?since="+start.Format(time.RFC3339)), 4)
+	require.Empty(t, queryAudit(t, s, "?until="+start.Format(time.RFC3339)))
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/audit?since=yesterday", nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	require.Equal(t, http.StatusBadRequest, serve(s, req).Code)
+}
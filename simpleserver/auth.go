@@ -0,0 +1,57 @@
+package simpleserver
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// requireUploadAuth guards uploads with Config.AuthToken. Uploads into a
+// bucket may present the bucket's own token instead, with Config.UsersFile
+// users upload with their own credentials, and pre-signed URLs need none.
+func (s *Server) requireUploadAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if _, signed, valid := s.presignedGrant(c); signed {
+			if !valid {
+				return fail(c, http.StatusForbidden, "Invalid or expired signature")
+			}
+			return next(c)
+		}
+		settings := s.settings()
+		if (settings.AuthToken == "" && len(s.users) == 0) || validBearer(c.Request(), settings.AuthToken) {
+			return next(c)
+		}
+		if _, ok := s.requestUser(c); ok {
+			return next(c)
+		}
+		if bucket, ok := settings.Buckets[requestBucket(c)]; ok && validBearer(c.Request(), bucket.AuthToken) {
+			return next(c)
+		}
+		return authUnauthorized(c)
+	}
+}
+
+// requireDownloadAuth guards downloads with Config.AuthToken when
+// ProtectDownloads is set. Signed links are let through without it.
+func (s *Server) requireDownloadAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	if !s.config.ProtectDownloads {
+		return next
+	}
+	return func(c echo.Context) error {
+		token := s.settings().AuthToken
+		if token == "" || validBearer(c.Request(), token) {
+			return next(c)
+		}
+		if dir, name, err := downloadTarget(c.Request()); err == nil {
+			if _, valid := s.signedDownload(c, dir, name); valid {
+				return next(c)
+			}
+		}
+		return authUnauthorized(c)
+	}
+}
+
+func authUnauthorized(c echo.Context) error {
+	c.Response().Header().Set("WWW-Authenticate", `Bearer realm="simpleserver"`)
+	return fail(c, http.StatusUnauthorized, "Unauthorized")
+}
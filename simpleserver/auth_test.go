@@ -0,0 +1,65 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testAuthToken = "upload-secret"
+
+func authorized(req *http.Request, token string) *http.Request {
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestAuthTokenGuardsUploads(t *testing.T) {
+	s := newTestServer(t, Config{AuthToken: testAuthToken})
+
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("a")))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Header().Get("WWW-Authenticate"), "Bearer")
+
+	rec = serve(s, authorized(httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("a")), "wrong"))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(s, multipartRequest(t, http.MethodPost, "/", testPart{"b.txt", "b"}))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(s, tusRequest(http.MethodPost, tusPath, nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(s, authorized(httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("a")), testAuthToken))
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	// Downloads stay open without ProtectDownloads.
+	require.Equal(t, "a", download(t, s, downloadURLs(t, rec.Body.String())[0]).Body.String())
+}
+
+func TestAuthTokenAcceptsBucketToken(t *testing.T) {
+	s := newTestServer(t, Config{
+		AuthToken: testAuthToken,
+		Buckets:   map[string]BucketConfig{"team": {AuthToken: "team-secret"}},
+	})
+
+	req := authorized(httptest.NewRequest(http.MethodPut, "/a.txt?bucket=team", strings.NewReader("a")), "team-secret")
+	require.Equal(t, http.StatusCreated, serve(s, req).Code)
+
+	req = authorized(httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("a")), "team-secret")
+	require.Equal(t, http.StatusUnauthorized, serve(s, req).Code)
+}
+
+func TestProtectDownloads(t *testing.T) {
+	s := newTestServer(t, Config{AuthToken: testAuthToken, ProtectDownloads: true})
+	rec := serve(s, authorized(httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("a")), testAuthToken))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	u := downloadURLs(t, rec.Body.String())[0]
+
+	require.Equal(t, http.StatusUnauthorized, download(t, s, u).Code)
+	rec = serve(s, authorized(httptest.NewRequest(http.MethodGet, mustRequestURI(t, u), nil), testAuthToken))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "a", rec.Body.String())
+}
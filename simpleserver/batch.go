@@ -0,0 +1,411 @@
+package simpleserver
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// A batch stores several files into one share all at once, described by a
+// manifest listing their names and, optionally, their checksums:
+//
+//	{"files": [{"name": "app.tar.gz", "sha256": "..."}, {"name": "app.sig"}]}
+//
+// Clients either POST /batch a multipart body whose first part is the
+// manifest field and the rest the files, or PUT the files one by one with a
+// shared X-Batch-Id header and then POST /batch the manifest as JSON with
+// that header. Files stay hidden until the manifest is committed, and are
+// deleted when the batch does not match it.
+const (
+	batchPath          = "/batch"
+	batchIDHeader      = "X-Batch-Id"
+	batchManifestField = "manifest"
+	// batchManifestName is the file a committed batch is described in.
+	batchManifestName    = "manifest.json"
+	maxBatchManifestSize = 1 << 20
+	minBatchIDLen        = 8
+	// batchTimeout deletes the files of batches never committed.
+	batchTimeout = time.Hour
+)
+
+var errInvalidBatch = errors.New("invalid batch")
+
+// batchManifest lists the files of a batch. The stored manifest.json adds
+// where each of them can be downloaded.
+type batchManifest struct {
+	Files []batchEntry `json:"files"`
+}
+
+type batchEntry struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256,omitempty"`
+	URL    string `json:"url,omitempty"`
+}
+
+// batchStage holds the files of a batch until its manifest is committed.
+type batchStage struct {
+	dir      string
+	identity string
+	started  time.Time
+	// files maps the names the client sent to the files stored for them.
+	files map[string]FileMeta
+}
+
+func (b *batchStage) stored() []FileMeta {
+	files := make([]FileMeta, 0, len(b.files))
+	for _, meta := range b.files {
+		files = append(files, meta)
+	}
+	return files
+}
+
+// batchStager tracks the batches being uploaded with X-Batch-Id and the
+// files of any batch that are not committed yet.
+type batchStager struct {
+	mu      sync.Mutex
+	batches map[string]*batchStage
+	staged  map[string]bool
+}
+
+func newBatchStager() *batchStager {
+	return &batchStager{batches: make(map[string]*batchStage), staged: make(map[string]bool)}
+}
+
+// open returns the batch id, started by the same client, or starts it in
+// the dir newDir returns.
+func (b *batchStager) open(id, identity string, newDir func() string) (*batchStage, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if stage, ok := b.batches[id]; ok {
+		if stage.identity != identity {
+			return nil, fmt.Errorf("%w: batch %s belongs to another client", errInvalidBatch, id)
+		}
+		return stage, nil
+	}
+	stage := &batchStage{dir: newDir(), identity: identity, started: time.Now(), files: make(map[string]FileMeta)}
+	b.batches[id] = stage
+	return stage, nil
+}
+
+// reserve refuses a second file of the same name in a batch.
+func (b *batchStager) reserve(stage *batchStage, name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := stage.files[name]; ok {
+		return fmt.Errorf("%w: %q was already uploaded", errInvalidBatch, name)
+	}
+	return nil
+}
+
+func (b *batchStager) add(stage *batchStage, name string, meta FileMeta) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stage.files[name] = meta
+	b.staged[meta.key()] = true
+}
+
+// take ends batch id so its manifest can be committed. Its files stay
+// hidden until they are released.
+func (b *batchStager) take(id, identity string) (*batchStage, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stage, ok := b.batches[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: no file was uploaded in batch %s", errInvalidBatch, id)
+	}
+	if stage.identity != identity {
+		return nil, fmt.Errorf("%w: batch %s belongs to another client", errInvalidBatch, id)
+	}
+	delete(b.batches, id)
+	return stage, nil
+}
+
+// release makes the files of a batch visible, or forgets them once deleted.
+func (b *batchStager) release(stage *batchStage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, meta := range stage.files {
+		delete(b.staged, meta.key())
+	}
+}
+
+// isStaged reports whether the file key belongs to an uncommitted batch.
+func (b *batchStager) isStaged(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.staged[key]
+}
+
+// abandoned ends the batches started before now-batchTimeout.
+func (b *batchStager) abandoned(now time.Time) []*batchStage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var stages []*batchStage
+	for id, stage := range b.batches {
+		if now.Sub(stage.started) >= batchTimeout {
+			stages = append(stages, stage)
+			delete(b.batches, id)
+		}
+	}
+	return stages
+}
+
+// reapBatches deletes the files of batches that were never committed and
+// returns how many were removed.
+func (s *Server) reapBatches(now time.Time) int {
+	removed := 0
+	for _, stage := range s.batches.abandoned(now) {
+		removed += s.discardBatch(stage)
+	}
+	return removed
+}
+
+func (s *Server) discardBatch(stage *batchStage) int {
+	removed := 0
+	for _, meta := range stage.stored() {
+		if err := s.deleteFile(meta); err != nil {
+			log.Printf("Failed to delete %s of a discarded batch: %v\n", meta.key(), err)
+			continue
+		}
+		removed++
+	}
+	s.batches.release(stage)
+	return removed
+}
+
+// validate checks that the manifest names every file once, by a name it
+// would be stored with.
+func (m batchManifest) validate(s *Server) error {
+	if len(m.Files) == 0 {
+		return fmt.Errorf("%w: the manifest lists no file", errInvalidBatch)
+	}
+	seen := make(map[string]bool, len(m.Files))
+	for _, entry := range m.Files {
+		if name, err := s.storedName(entry.Name); err != nil || name != entry.Name || name == batchManifestName {
+			return fmt.Errorf("%w: %q cannot be stored under that name", errInvalidBatch, entry.Name)
+		}
+		if seen[entry.Name] {
+			return fmt.Errorf("%w: %q is listed twice", errInvalidBatch, entry.Name)
+		}
+		seen[entry.Name] = true
+		if entry.SHA256 != "" {
+			if sum, err := hex.DecodeString(entry.SHA256); err != nil || len(sum) != 32 {
+				return fmt.Errorf("%w: %q has an invalid sha256", errInvalidBatch, entry.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func (m batchManifest) entry(name string) (batchEntry, bool) {
+	for _, entry := range m.Files {
+		if entry.Name == name {
+			return entry, true
+		}
+	}
+	return batchEntry{}, false
+}
+
+// check matches the files stored for a batch against the manifest.
+func (m batchManifest) check(files map[string]FileMeta) error {
+	for _, entry := range m.Files {
+		meta, ok := files[entry.Name]
+		if !ok {
+			return fmt.Errorf("%w: %q was not uploaded", errInvalidBatch, entry.Name)
+		}
+		if entry.SHA256 != "" && !strings.EqualFold(entry.SHA256, meta.SHA256) {
+			return fmt.Errorf("%w of %q", errChecksumMismatch, entry.Name)
+		}
+	}
+	for name := range files {
+		if _, ok := m.entry(name); !ok {
+			return fmt.Errorf("%w: %q is not in the manifest", errInvalidBatch, name)
+		}
+	}
+	return nil
+}
+
+func decodeBatchManifest(r io.Reader) (batchManifest, error) {
+	var manifest batchManifest
+	if err := json.NewDecoder(io.LimitReader(r, maxBatchManifestSize)).Decode(&manifest); err != nil {
+		return manifest, fmt.Errorf("%w: the manifest is not valid JSON", errInvalidBatch)
+	}
+	return manifest, nil
+}
+
+// stageBatchUpload stores a file PUT with X-Batch-Id into its batch.
+func (s *Server) stageBatchUpload(c echo.Context, id string) error {
+	if len(id) < minBatchIDLen || !validSlug(id) {
+		return s.uploadError(c, fmt.Errorf("%w: %s must be at least %d letters, digits, '-' or '_'", errInvalidBatch, batchIDHeader, minBatchIDLen))
+	}
+	filename, err := s.uploadFilename(c.Request().URL.Path)
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	stage, err := s.batches.open(id, requestIdentity(c), func() string { return s.uploadDirFor(c) })
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	if err := s.batches.reserve(stage, filename); err != nil {
+		return s.uploadError(c, err)
+	}
+	limit := int64(s.maxSize()) << 20
+	if size := c.Request().ContentLength; size > limit {
+		return s.uploadError(c, &sizeLimitError{limit: limit, over: size - limit})
+	}
+	meta, err := s.saveUpload(c, stage.dir, filename, &maxBytesReader{r: c.Request().Body, n: limit})
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	s.batches.add(stage, filename, meta)
+	c.Response().Header().Set(checksumHeader, meta.SHA256)
+	if s.wantsJSON(c) {
+		return c.JSON(http.StatusAccepted, batchEntry{Name: filename, Size: meta.Size, SHA256: meta.SHA256})
+	}
+	return c.String(http.StatusAccepted, fmt.Sprintf("Staged %s in batch %s, POST the manifest to %s to commit it\n", filename, id, batchPath))
+}
+
+// handleBatch answers POST /batch, committing the files PUT with the
+// X-Batch-Id of the request or those sent along with the manifest.
+func (s *Server) handleBatch(c echo.Context) error {
+	if isMultipart(c.Request()) {
+		return s.handleBatchMultipart(c)
+	}
+	id := c.Request().Header.Get(batchIDHeader)
+	if id == "" {
+		return fail(c, http.StatusBadRequest, "POST /batch expects a multipart body or the manifest of the "+batchIDHeader+" batch")
+	}
+	manifest, err := decodeBatchManifest(c.Request().Body)
+	if err == nil {
+		err = manifest.validate(s)
+	}
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	stage, err := s.batches.take(id, requestIdentity(c))
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	return s.commitBatch(c, stage, manifest)
+}
+
+func (s *Server) handleBatchMultipart(c echo.Context) error {
+	reader, err := c.Request().MultipartReader()
+	if err != nil {
+		return fail(c, http.StatusBadRequest, "Invalid multipart body")
+	}
+	part, err := reader.NextPart()
+	if err != nil || part.FormName() != batchManifestField {
+		return s.uploadError(c, fmt.Errorf("%w: the first part must be the %s field", errInvalidBatch, batchManifestField))
+	}
+	manifest, err := decodeBatchManifest(part)
+	if err == nil {
+		err = manifest.validate(s)
+	}
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	opts, err := s.uploadOptions(c)
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+
+	stage := &batchStage{dir: s.uploadDirFor(c), started: time.Now(), files: make(map[string]FileMeta)}
+	fail := func(err error) error {
+		s.discardBatch(stage)
+		return s.uploadError(c, err)
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fail(errMalformedPart)
+		}
+		clientName, err := partFilename(part)
+		if err != nil {
+			return fail(err)
+		}
+		if clientName == "" {
+			continue
+		}
+		entry, ok := manifest.entry(clientName)
+		if !ok {
+			return fail(fmt.Errorf("%w: %q is not in the manifest", errInvalidBatch, clientName))
+		}
+		if _, ok := stage.files[entry.Name]; ok {
+			return fail(fmt.Errorf("%w: %q was sent twice", errInvalidBatch, entry.Name))
+		}
+		fileOpts := opts
+		fileOpts.SHA256 = strings.ToLower(entry.SHA256)
+		meta, err := s.saveUploadWith(c, stage.dir, entry.Name, part, fileOpts)
+		if err != nil {
+			return fail(err)
+		}
+		s.batches.add(stage, entry.Name, meta)
+	}
+	return s.commitBatch(c, stage, manifest)
+}
+
+// commitBatch checks the files of stage against manifest and, when they
+// match, stores manifest.json next to them and makes them visible.
+func (s *Server) commitBatch(c echo.Context, stage *batchStage, manifest batchManifest) error {
+	if err := manifest.check(stage.files); err != nil {
+		s.discardBatch(stage)
+		return s.uploadError(c, err)
+	}
+	stored := batchManifest{Files: make([]batchEntry, 0, len(manifest.Files))}
+	for _, entry := range manifest.Files {
+		meta := stage.files[entry.Name]
+		stored.Files = append(stored.Files, batchEntry{
+			Name:   entry.Name,
+			Size:   meta.Size,
+			SHA256: meta.SHA256,
+			URL:    s.downloadURL(c, meta.Dir, meta.Name),
+		})
+	}
+	content, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		s.discardBatch(stage)
+		return s.uploadError(c, err)
+	}
+	opts, err := s.uploadOptions(c)
+	if err != nil {
+		s.discardBatch(stage)
+		return s.uploadError(c, err)
+	}
+	opts.SHA256, opts.Trailer = "", nil
+	manifestMeta, err := s.storeFile(c.Request().Context(), stage.dir, batchManifestName, bytes.NewReader(content), opts)
+	if err != nil {
+		s.discardBatch(stage)
+		return s.uploadError(c, err)
+	}
+	s.batches.release(stage)
+
+	manifestURL := s.downloadURL(c, manifestMeta.Dir, manifestMeta.Name)
+	if s.wantsJSON(c) {
+		resp := batchResponse{Manifest: manifestURL, Files: make([]uploadResponse, 0, len(manifest.Files))}
+		for _, entry := range manifest.Files {
+			resp.Files = append(resp.Files, s.uploadResponse(c, stage.files[entry.Name]))
+		}
+		return c.JSON(http.StatusCreated, resp)
+	}
+	var b strings.Builder
+	b.WriteString("Batch uploaded successfully. Manifest at:\n" + manifestURL + "\n")
+	for _, entry := range stored.Files {
+		fmt.Fprintf(&b, "%s  %s\n", entry.SHA256, entry.URL)
+	}
+	return c.String(http.StatusCreated, b.String())
+}
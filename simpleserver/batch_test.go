@@ -0,0 +1,116 @@
+package simpleserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func batchRequest(t *testing.T, manifest string, parts ...testPart) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	require.NoError(t, w.WriteField(batchManifestField, manifest))
+	for _, p := range parts {
+		pw, err := w.CreateFormFile("file", p.filename)
+		require.NoError(t, err)
+		_, err = pw.Write([]byte(p.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	req := httptest.NewRequest(http.MethodPost, batchPath, &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set("Accept", "application/json")
+	return req
+}
+
+func TestBatchMultipartCommitsManifest(t *testing.T) {
+	s := newTestServer(t, Config{})
+	manifest := fmt.Sprintf(`{"files": [{"name": "app.bin", "sha256": %q}, {"name": "app.sig"}]}`, sha256Hex("binary"))
+	rec := serve(s, batchRequest(t, manifest, testPart{"app.bin", "binary"}, testPart{"app.sig", "signature"}))
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var resp batchResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.Files, 2)
+	require.Equal(t, resp.Files[0].ID, resp.Files[1].ID, "one share")
+
+	rec = download(t, s, resp.Manifest)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var stored batchManifest
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stored))
+	require.Equal(t, []batchEntry{
+		{Name: "app.bin", Size: 6, SHA256: sha256Hex("binary"), URL: resp.Files[0].URL},
+		{Name: "app.sig", Size: 9, SHA256: sha256Hex("signature"), URL: resp.Files[1].URL},
+	}, stored.Files)
+	require.Equal(t, "signature", download(t, s, resp.Files[1].URL).Body.String())
+}
+
+func TestBatchMultipartIsAllOrNothing(t *testing.T) {
+	s := newTestServer(t, Config{})
+	for manifest, parts := range map[string][]testPart{
+		`{"files": [{"name": "a.txt"}, {"name": "b.txt"}]}`:                         {{"a.txt", "a"}},
+		`{"files": [{"name": "a.txt"}]}`:                                            {{"a.txt", "a"}, {"b.txt", "b"}},
+		fmt.Sprintf(`{"files": [{"name": "a.txt", "sha256": %q}]}`, sha256Hex("x")): {{"a.txt", "a"}},
+		`{"files": [{"name": "manifest.json"}]}`:                                    {{"manifest.json", "{}"}},
+		`{"files": []}`:                                                             {{"a.txt", "a"}},
+		`not json`:                                                                  {{"a.txt", "a"}},
+	} {
+		rec := serve(s, batchRequest(t, manifest, parts...))
+		require.Equal(t, http.StatusBadRequest, rec.Code, manifest)
+	}
+	require.Zero(t, s.index.len())
+}
+
+func stageFile(s *Server, id, name, content string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/"+name, strings.NewReader(content))
+	req.Header.Set(batchIDHeader, id)
+	return serve(s, req)
+}
+
+func commitBatch(s *Server, id, manifest string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, batchPath, strings.NewReader(manifest))
+	req.Header.Set(batchIDHeader, id)
+	req.Header.Set("Content-Type", "application/json")
+	return serve(s, req)
+}
+
+func TestBatchOfSequentialPuts(t *testing.T) {
+	s := newTestServer(t, Config{})
+	require.Equal(t, http.StatusAccepted, stageFile(s, "release-1", "a.txt", "first").Code)
+	require.Equal(t, http.StatusAccepted, stageFile(s, "release-1", "b.txt", "second").Code)
+	require.Equal(t, http.StatusBadRequest, stageFile(s, "release-1", "b.txt", "again").Code)
+	require.Equal(t, http.StatusBadRequest, stageFile(s, "short", "c.txt", "c").Code)
+	staged := findMeta(t, s, "a.txt")
+	require.Equal(t, http.StatusNotFound, download(t, s, "/"+staged.key()).Code, "hidden until committed")
+
+	rec := commitBatch(s, "release-1", `{"files": [{"name": "a.txt"}, {"name": "b.txt"}]}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	urls := downloadURLs(t, rec.Body.String())
+	require.True(t, strings.HasSuffix(urls[0], "/"+staged.Dir+"/"+batchManifestName))
+	require.Equal(t, "first", download(t, s, "/"+staged.key()).Body.String())
+	require.Contains(t, rec.Body.String(), sha256Hex("second"))
+
+	require.Equal(t, http.StatusBadRequest, commitBatch(s, "release-1", `{"files": [{"name": "a.txt"}]}`).Code, "committed once")
+}
+
+func TestBatchMismatchAndAbandonedBatchesAreDeleted(t *testing.T) {
+	s := newTestServer(t, Config{})
+	require.Equal(t, http.StatusAccepted, stageFile(s, "release-2", "a.txt", "a").Code)
+	require.Equal(t, http.StatusBadRequest, commitBatch(s, "release-2", `{"files": [{"name": "a.txt"}, {"name": "b.txt"}]}`).Code)
+	require.Zero(t, s.index.len())
+
+	require.Equal(t, http.StatusAccepted, stageFile(s, "release-3", "a.txt", "a").Code)
+	abandoned := findMeta(t, s, "a.txt")
+	require.Zero(t, s.reapBatches(time.Now()))
+	require.Equal(t, 1, s.reapBatches(time.Now().Add(batchTimeout)))
+	require.Zero(t, s.index.len())
+	require.False(t, s.batches.isStaged(abandoned.key()))
+}
@@ -0,0 +1,93 @@
+package simpleserver
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const bucketHeader = "X-Bucket"
+
+var (
+	errUnknownBucket      = errors.New("unknown bucket")
+	errBucketUnauthorized = errors.New("bucket requires authorization")
+)
+
+// BucketConfig overrides global upload settings for uploads made into a named
+// bucket. Zero values fall back to the global settings.
+type BucketConfig struct {
+	// MaxSize is the largest accepted upload in MB.
+	MaxSize int `yaml:"maxSize" json:"maxSize"`
+	// AllowedTypes lists accepted content types, or type prefixes ending in
+	// "/". Any type is accepted when empty.
+	AllowedTypes []string      `yaml:"allowedTypes" json:"allowedTypes"`
+	TTL          time.Duration `yaml:"ttl" json:"ttl"`
+	// AuthToken, when set, must be presented as a bearer token to upload.
+	AuthToken string `yaml:"authToken" json:"authToken"`
+}
+
+// requestBucket returns the bucket an upload targets, if any.
+func requestBucket(c echo.Context) string {
+	if bucket := c.Request().Header.Get(bucketHeader); bucket != "" {
+		return bucket
+	}
+	return c.QueryParam("bucket")
+}
+
+// uploadOptions resolves the limits that apply to an upload request,
+// combining the global settings with those of the requested bucket.
+func (s *Server) uploadOptions(c echo.Context) (uploadOptions, error) {
+	opts := uploadOptions{Bucket: requestBucket(c), TTL: s.config.TTL, Once: requestOnce(c), Password: requestPassword(c)}
+	sum, err := requestChecksum(c)
+	if err != nil {
+		return opts, err
+	}
+	opts.SHA256 = sum
+	if isSingleFileUpload(c) && announcesTrailer(c.Request(), contentSHA256Header) {
+		opts.Trailer = c.Request().Trailer
+	}
+	if opts.MaxDownloads, err = requestMaxDownloads(c); err != nil {
+		return opts, err
+	}
+	if opts.Visibility, opts.AllowedEmails, err = s.requestVisibility(c); err != nil {
+		return opts, err
+	}
+	meta, err := requestMeta(c)
+	if err != nil {
+		return opts, err
+	}
+	opts.Description, opts.Tags = meta.Description, meta.Tags
+	// The recipients are only emailed once the upload is answered, they are
+	// checked here so a bad header fails it before anything is stored.
+	if _, err := s.requestNotify(c); err != nil {
+		return opts, err
+	}
+	if opts.Bucket == "" {
+		return opts, nil
+	}
+	bucket, ok := s.settings().Buckets[opts.Bucket]
+	if !ok {
+		return opts, errUnknownBucket
+	}
+	if bucket.AuthToken != "" && !validBearer(c.Request(), bucket.AuthToken) {
+		return opts, errBucketUnauthorized
+	}
+	opts.MaxBytes = int64(bucket.MaxSize) << 20
+	opts.AllowedTypes = bucket.AllowedTypes
+	if bucket.TTL > 0 {
+		opts.TTL = bucket.TTL
+	}
+	return opts, nil
+}
+
+func bucketErrorStatus(err error) (int, bool) {
+	switch {
+	case errors.Is(err, errUnknownBucket):
+		return http.StatusNotFound, true
+	case errors.Is(err, errBucketUnauthorized):
+		return http.StatusUnauthorized, true
+	}
+	return 0, false
+}
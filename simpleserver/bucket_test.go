@@ -0,0 +1,124 @@
+package simpleserver
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testBucketsConfig = `
+buckets:
+  notes:
+    maxSize: 1
+    allowedTypes: ["text/"]
+  images:
+    maxSize: 2
+    allowedTypes: ["image/"]
+    ttl: 1h
+    authToken: img-secret
+`
+
+func bucketUpload(s *Server, bucket, token, name string, content []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/"+name, bytes.NewReader(content))
+	req.Header.Set(bucketHeader, bucket)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return serve(s, req)
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "simpleserver.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testBucketsConfig), 0600))
+
+	var config Config
+	require.NoError(t, loadConfigFile(path, &config))
+	require.Len(t, config.Buckets, 2)
+	require.Equal(t, 1, config.Buckets["notes"].MaxSize)
+	require.Equal(t, []string{"image/"}, config.Buckets["images"].AllowedTypes)
+	require.Equal(t, time.Hour, config.Buckets["images"].TTL)
+	require.Equal(t, "img-secret", config.Buckets["images"].AuthToken)
+
+	jsonPath := filepath.Join(t.TempDir(), "simpleserver.json")
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{"buckets": {"logs": {"maxSize": 3}}}`), 0600))
+	require.NoError(t, loadConfigFile(jsonPath, &config))
+	require.Equal(t, 3, config.Buckets["logs"].MaxSize)
+
+	badPath := filepath.Join(t.TempDir(), "bad.yaml")
+	require.NoError(t, os.WriteFile(badPath, []byte("buckets:\n  .meta:\n    maxSize: 1\n"), 0600))
+	require.Error(t, loadConfigFile(badPath, &config))
+}
+
+func TestBucketsEnforceTheirOwnRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "simpleserver.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testBucketsConfig), 0600))
+	var config Config
+	require.NoError(t, loadConfigFile(path, &config))
+	s := newTestServer(t, config)
+
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 1024)...)
+	oneAndAHalfMB := bytes.Repeat([]byte("a"), 3<<19)
+
+	// notes: text only, up to 1MB, no auth.
+	require.Equal(t, http.StatusCreated, bucketUpload(s, "notes", "", "a.txt", []byte("hello")).Code)
+	require.Equal(t, http.StatusUnsupportedMediaType, bucketUpload(s, "notes", "", "a.png", png).Code)
+	require.Equal(t, http.StatusRequestEntityTooLarge, bucketUpload(s, "notes", "", "big.txt", oneAndAHalfMB).Code)
+
+	// images: images only, up to 2MB, bearer token required.
+	require.Equal(t, http.StatusUnauthorized, bucketUpload(s, "images", "", "a.png", png).Code)
+	require.Equal(t, http.StatusUnauthorized, bucketUpload(s, "images", "wrong", "a.png", png).Code)
+	require.Equal(t, http.StatusUnsupportedMediaType, bucketUpload(s, "images", "img-secret", "a.txt", []byte("hello")).Code)
+	big := append(append([]byte{}, png...), oneAndAHalfMB...)
+	rec := bucketUpload(s, "images", "img-secret", "big.png", big)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	require.Equal(t, http.StatusNotFound, bucketUpload(s, "missing", "", "a.txt", []byte("hello")).Code)
+
+	// Uploads outside of any bucket keep the global behavior.
+	require.Equal(t, http.StatusCreated, serve(s, httptest.NewRequest(http.MethodPut, "/free.png", bytes.NewReader(png))).Code)
+
+	meta := findMeta(t, s, "big.png")
+	require.Equal(t, "images", meta.Bucket)
+	require.WithinDuration(t, time.Now().Add(time.Hour), meta.ExpiresAt, time.Minute)
+	require.True(t, findMeta(t, s, "a.txt").ExpiresAt.IsZero())
+}
+
+func TestExpiredDownloadIsGone(t *testing.T) {
+	s := newTestServer(t, Config{Buckets: map[string]BucketConfig{"short": {TTL: time.Millisecond}}})
+	rec := bucketUpload(s, "short", "", "gone.txt", []byte("soon gone"))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	time.Sleep(5 * time.Millisecond)
+	require.Equal(t, http.StatusGone, download(t, s, downloadURLs(t, rec.Body.String())[0]).Code)
+}
+
+// findMeta returns the metadata of the only upload stored under name.
+func findMeta(t *testing.T, s *Server, name string) FileMeta {
+	t.Helper()
+	s.index.mu.RLock()
+	defer s.index.mu.RUnlock()
+	for _, meta := range s.index.files {
+		if meta.Name == name {
+			return meta
+		}
+	}
+	t.Fatalf("no metadata for %s", name)
+	return FileMeta{}
+}
+
+func TestMaxBytesReader(t *testing.T) {
+	r := &maxBytesReader{r: strings.NewReader("12345"), n: 5}
+	buf := make([]byte, 16)
+	n, _ := r.Read(buf)
+	require.Equal(t, 5, n)
+
+	r = &maxBytesReader{r: strings.NewReader("123456"), n: 5}
+	_, err := r.Read(buf)
+	require.ErrorIs(t, err, errTooLarge)
+}
@@ -0,0 +1,119 @@
+package simpleserver
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"sync"
+)
+
+const (
+	// cacheHeader tells whether a download was served from the cache.
+	cacheHeader = "X-Cache"
+	// maxCachedFile bounds the files the download cache takes, which is
+	// meant for small popular files rather than a few big ones.
+	maxCachedFile = 8 << 20
+)
+
+// downloadCache keeps the stored content of small files that were
+// downloaded before in memory, least recently used first out once it holds
+// more than its size. Entries are validated against the ETag of the file,
+// its SHA-256, so a file replaced in place is never served stale.
+type downloadCache struct {
+	maxBytes int64
+	maxEntry int64
+
+	mu      sync.Mutex
+	size    int64
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	ObjectInfo
+	sha256 string
+	data   []byte
+}
+
+// newDownloadCache returns a cache of maxBytes, or nil when it is 0.
+func newDownloadCache(maxBytes int64) *downloadCache {
+	if maxBytes <= 0 {
+		return nil
+	}
+	return &downloadCache{
+		maxBytes: maxBytes,
+		maxEntry: min(maxBytes/8, maxCachedFile),
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// get opens the cached content of meta if it is current.
+func (dc *downloadCache) get(meta FileMeta) (*Object, bool) {
+	if dc == nil {
+		return nil, false
+	}
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	elem, ok := dc.entries[meta.key()]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if entry.sha256 != meta.SHA256 {
+		dc.removeElement(elem)
+		return nil, false
+	}
+	dc.order.MoveToFront(elem)
+	return &Object{ObjectInfo: entry.ObjectInfo, Content: bytesObject{bytes.NewReader(entry.data)}}, true
+}
+
+// fill reads obj, just opened from the storage, into the cache when meta is
+// worth caching: small, with a checksum to validate it, and downloaded
+// before. It returns the object to serve in place of obj.
+func (dc *downloadCache) fill(meta FileMeta, obj *Object) (*Object, error) {
+	if dc == nil || meta.SHA256 == "" || meta.Downloads == 0 || obj.Size > dc.maxEntry {
+		return obj, nil
+	}
+	data, err := io.ReadAll(obj.Content)
+	obj.Content.Close()
+	if err != nil {
+		return nil, err
+	}
+	info := obj.ObjectInfo
+	info.Key = meta.key()
+	dc.put(&cacheEntry{ObjectInfo: info, sha256: meta.SHA256, data: data})
+	return &Object{ObjectInfo: info, Content: bytesObject{bytes.NewReader(data)}}, nil
+}
+
+func (dc *downloadCache) put(entry *cacheEntry) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if elem, ok := dc.entries[entry.Key]; ok {
+		dc.removeElement(elem)
+	}
+	dc.entries[entry.Key] = dc.order.PushFront(entry)
+	dc.size += int64(len(entry.data))
+	for dc.size > dc.maxBytes {
+		dc.removeElement(dc.order.Back())
+	}
+}
+
+// remove drops the entry of key, if any.
+func (dc *downloadCache) remove(key string) {
+	if dc == nil {
+		return
+	}
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if elem, ok := dc.entries[key]; ok {
+		dc.removeElement(elem)
+	}
+}
+
+// removeElement drops elem. The caller must hold dc.mu.
+func (dc *downloadCache) removeElement(elem *list.Element) {
+	entry := dc.order.Remove(elem).(*cacheEntry)
+	delete(dc.entries, entry.Key)
+	dc.size -= int64(len(entry.data))
+}
@@ -0,0 +1,76 @@
+package simpleserver
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadCacheServesRepeatedDownloads(t *testing.T) {
+	s := newTestServer(t, Config{CacheSize: "1M"})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/hot.txt", strings.NewReader("popular")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	link := downloadURLs(t, rec.Body.String())[0]
+
+	// The first download is not cached, the second fills the cache.
+	for _, want := range []string{"MISS", "MISS", "HIT", "HIT"} {
+		rec = download(t, s, link)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, "popular", rec.Body.String())
+		require.Equal(t, want, rec.Header().Get(cacheHeader))
+	}
+
+	meta := findMeta(t, s, "hot.txt")
+	require.NoError(t, s.removeFile(meta))
+	require.Equal(t, http.StatusNotFound, download(t, s, link).Code)
+}
+
+func TestDownloadCacheIsNotServedStale(t *testing.T) {
+	s := newTestServer(t, Config{AuthToken: "secret", CacheSize: "1M"})
+	require.Equal(t, http.StatusCreated, conditionalPut(s, "/docs/notes.txt", "v1", map[string]string{"If-None-Match": "*"}).Code)
+	download(t, s, "/docs/notes.txt")
+	download(t, s, "/docs/notes.txt")
+	require.Equal(t, "HIT", download(t, s, "/docs/notes.txt").Header().Get(cacheHeader))
+
+	rec := conditionalPut(s, "/docs/notes.txt", "v2", map[string]string{"If-Match": `"` + sha256Hex("v1") + `"`})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	rec = download(t, s, "/docs/notes.txt")
+	require.Equal(t, "v2", rec.Body.String())
+	require.Equal(t, "MISS", rec.Header().Get(cacheHeader))
+}
+
+func TestDownloadCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	dc := newDownloadCache(80)
+	fill := func(name, content string) {
+		meta := FileMeta{Dir: "d", Name: name, SHA256: sha256Hex(content), Downloads: 1}
+		obj := &Object{ObjectInfo: ObjectInfo{Size: int64(len(content))}, Content: bytesObject{bytes.NewReader([]byte(content))}}
+		_, err := dc.fill(meta, obj)
+		require.NoError(t, err)
+	}
+	cached := func(name, content string) bool {
+		_, ok := dc.get(FileMeta{Dir: "d", Name: name, SHA256: sha256Hex(content)})
+		return ok
+	}
+	fill("a", "0123456789")
+	fill("b", "0123456789")
+	require.True(t, cached("a", "0123456789"))
+	// Entries are capped to an eighth of the cache.
+	fill("big", strings.Repeat("x", 11))
+	require.False(t, cached("big", strings.Repeat("x", 11)))
+
+	for _, name := range []string{"c", "d", "e", "f", "g", "h", "i"} {
+		fill(name, "0123456789")
+	}
+	require.True(t, cached("a", "0123456789"))
+	require.False(t, cached("b", "0123456789"))
+	require.EqualValues(t, 80, dc.size)
+}
+
+func TestValidateRejectsBadCacheSize(t *testing.T) {
+	require.NoError(t, Config{UploadDir: t.TempDir(), CacheSize: "512M"}.Validate())
+	require.ErrorContains(t, Config{UploadDir: t.TempDir(), CacheSize: "lots"}.Validate(), "--cache-size")
+}
@@ -0,0 +1,40 @@
+package simpleserver
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// setCacheHeaders sets Last-Modified and Cache-Control on a download of
+// meta, so it can be revalidated and kept by caches it is safe for.
+func (s *Server) setCacheHeaders(c echo.Context, meta FileMeta) {
+	header := c.Response().Header()
+	if !meta.CreatedAt.IsZero() {
+		header.Set(echo.HeaderLastModified, meta.CreatedAt.UTC().Format(http.TimeFormat))
+	}
+	header.Set(echo.HeaderCacheControl, s.cacheControl(meta, time.Now()))
+}
+
+// cacheControl picks the Cache-Control of a download of meta. Files that are
+// used up by downloads are never stored, those behind a credential only by
+// the browser, and public ones are kept by shared caches for CacheMaxAge,
+// though never past their expiry.
+func (s *Server) cacheControl(meta FileMeta, now time.Time) string {
+	if meta.Once || meta.MaxDownloads > 0 {
+		return "no-store"
+	}
+	if meta.PasswordHash != "" || meta.Visibility == visibilityRestricted || s.config.ProtectDownloads || s.access != nil {
+		return "private, no-cache"
+	}
+	maxAge := s.config.CacheMaxAge
+	if !meta.ExpiresAt.IsZero() {
+		maxAge = min(maxAge, meta.ExpiresAt.Sub(now))
+	}
+	if seconds := int64(maxAge / time.Second); seconds > 0 {
+		return fmt.Sprintf("public, max-age=%d", seconds)
+	}
+	return "no-cache"
+}
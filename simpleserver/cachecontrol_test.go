@@ -0,0 +1,60 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadsCanBeRevalidated(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/report.txt", strings.NewReader("quarterly")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	link := downloadURLs(t, rec.Body.String())[0]
+
+	rec = download(t, s, link)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "no-cache", rec.Header().Get("Cache-Control"))
+	lastModified := rec.Header().Get("Last-Modified")
+	modTime, err := http.ParseTime(lastModified)
+	require.NoError(t, err)
+
+	for since, want := range map[string]int{
+		lastModified: http.StatusNotModified,
+		modTime.Add(-time.Second).Format(http.TimeFormat): http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodGet, link, nil)
+		req.Header.Set("If-Modified-Since", since)
+		require.Equal(t, want, serve(s, req).Code, since)
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since.
+	req := httptest.NewRequest(http.MethodGet, link, nil)
+	req.Header.Set("If-None-Match", `"`+sha256Hex("other")+`"`)
+	req.Header.Set("If-Modified-Since", lastModified)
+	require.Equal(t, http.StatusOK, serve(s, req).Code)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	require.Equal(t, http.StatusNotModified, serve(s, req).Code)
+}
+
+func TestCacheControl(t *testing.T) {
+	now := time.Now()
+	s := newTestServer(t, Config{CacheMaxAge: time.Hour})
+	for want, meta := range map[string]FileMeta{
+		"public, max-age=3600": {},
+		"public, max-age=600":  {ExpiresAt: now.Add(10 * time.Minute)},
+		"no-cache":             {ExpiresAt: now.Add(-time.Minute)},
+		"no-store":             {MaxDownloads: 3},
+		"private, no-cache":    {PasswordHash: "hash"},
+	} {
+		require.Equal(t, want, s.cacheControl(meta, now))
+	}
+	require.Equal(t, "no-store", s.cacheControl(FileMeta{Once: true}, now))
+
+	s = newTestServer(t, Config{AuthToken: "secret", ProtectDownloads: true, CacheMaxAge: time.Hour})
+	require.Equal(t, "private, no-cache", s.cacheControl(FileMeta{}, now))
+}
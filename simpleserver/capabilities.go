@@ -0,0 +1,142 @@
+package simpleserver
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// uploadLimits describes what an upload target accepts.
+type uploadLimits struct {
+	MaxSize      int64    `json:"max_size"`
+	AllowedTypes []string `json:"allowed_types"`
+	TTLSeconds   int64    `json:"ttl_seconds"`
+	AuthRequired bool     `json:"auth_required"`
+}
+
+// capabilities is the document served at GET /capabilities so clients can
+// discover what this instance supports.
+type capabilities struct {
+	uploadLimits
+	AllowedExtensions []string                `json:"allowed_extensions"`
+	UploadTokens      bool                    `json:"upload_tokens"`
+	Buckets           map[string]uploadLimits `json:"buckets"`
+	NameStrategy      string                  `json:"name_strategy"`
+	Multipart         bool                    `json:"multipart"`
+	TarExtract        bool                    `json:"tar_extract"`
+	Resumable         bool                    `json:"resumable"`
+	ChunkedUploads    bool                    `json:"chunked_uploads"`
+	ShortLinks        bool                    `json:"short_links"`
+	CustomPaths       bool                    `json:"custom_paths"`
+	QRCodes           bool                    `json:"qr_codes"`
+	DownloadOnce      bool                    `json:"download_once"`
+	MaxDownloads      bool                    `json:"max_downloads"`
+	Passwords         bool                    `json:"passwords"`
+	Visibility        []string                `json:"visibility"`
+	Receipts          bool                    `json:"receipts"`
+	JSONResponses     bool                    `json:"json_responses"`
+	DirectoryListing  bool                    `json:"directory_listing"`
+	Search            bool                    `json:"search"`
+	ZipDownloads      bool                    `json:"zip_downloads"`
+	SignedURLs        bool                    `json:"signed_urls"`
+	DeltaSync         bool                    `json:"delta_sync"`
+	WebDAV            bool                    `json:"webdav"`
+	SFTPPort          int                     `json:"sftp_port,omitempty"`
+	FTPPort           int                     `json:"ftp_port,omitempty"`
+	GRPCPort          int                     `json:"grpc_port,omitempty"`
+	S3Port            int                     `json:"s3_port,omitempty"`
+	ResponseEncodings []string                `json:"response_encodings"`
+	AtRestCompression []string                `json:"at_rest_compression"`
+	AtRestEncryption  []string                `json:"at_rest_encryption"`
+	MaxRanges         int                     `json:"max_ranges"`
+	UploadsPaused     bool                    `json:"uploads_paused"`
+	ReadOnly          bool                    `json:"read_only"`
+	Progress          bool                    `json:"progress"`
+	Fetch             bool                    `json:"fetch"`
+	EmailNotify       bool                    `json:"email_notify"`
+}
+
+func (s *Server) capabilities() capabilities {
+	caps := capabilities{
+		uploadLimits: uploadLimits{
+			MaxSize:      int64(s.maxSize()) << 20,
+			AllowedTypes: []string{},
+			TTLSeconds:   int64(s.config.TTL.Seconds()),
+			AuthRequired: s.settings().AuthToken != "",
+		},
+		AllowedExtensions: append([]string{}, s.config.AllowExtensions...),
+		UploadTokens:      len(s.settings().UploadTokens) > 0,
+		Buckets:           make(map[string]uploadLimits, len(s.settings().Buckets)),
+		NameStrategy:      s.config.NameStrategy,
+		Multipart:         true,
+		TarExtract:        true,
+		Resumable:         true,
+		ChunkedUploads:    true,
+		ShortLinks:        s.config.ShortLinks,
+		CustomPaths:       true,
+		QRCodes:           s.config.EnableQR,
+		DownloadOnce:      true,
+		MaxDownloads:      true,
+		Passwords:         true,
+		Visibility:        []string{visibilityPublic, visibilityUnlisted},
+		Receipts:          s.receiptKey != nil,
+		JSONResponses:     s.config.JSONResponses,
+		DirectoryListing:  s.settings().AuthToken != "",
+		Search:            s.searchAvailable(),
+		ZipDownloads:      s.settings().AuthToken != "",
+		SignedURLs:        s.settings().AuthToken != "",
+		DeltaSync:         s.settings().AuthToken != "",
+		WebDAV:            s.config.WebDAV && s.settings().AuthToken != "",
+		SFTPPort:          s.config.SFTPPort,
+		FTPPort:           s.config.FTPPort,
+		GRPCPort:          s.config.GRPCPort,
+		S3Port:            s.config.S3Port,
+		ResponseEncodings: responseEncodings,
+		AtRestCompression: []string{},
+		AtRestEncryption:  []string{},
+		MaxRanges:         s.config.MaxRanges,
+		UploadsPaused:     s.uploadsOff(),
+		ReadOnly:          s.readOnly.Load(),
+		Progress:          true,
+		Fetch:             !s.config.NoFetch,
+		EmailNotify:       s.mailer != nil,
+	}
+	if caps.NameStrategy == "" {
+		caps.NameStrategy = NameOriginal
+	}
+	if caps.MaxRanges <= 0 {
+		caps.MaxRanges = defaultMaxRanges
+	}
+	if s.config.CompressAtRest {
+		caps.AtRestCompression = append(caps.AtRestCompression, encodingGzip)
+	}
+	if s.access != nil || len(s.users) > 0 {
+		caps.Visibility = append(caps.Visibility, visibilityRestricted)
+	}
+	if s.cipher != nil {
+		caps.AtRestEncryption = append(caps.AtRestEncryption, encryptionAESGCM)
+	}
+	for name, bucket := range s.settings().Buckets {
+		limits := uploadLimits{
+			MaxSize:      caps.MaxSize,
+			AllowedTypes: bucket.AllowedTypes,
+			TTLSeconds:   caps.TTLSeconds,
+			AuthRequired: bucket.AuthToken != "" || caps.AuthRequired,
+		}
+		if bucket.TTL > 0 {
+			limits.TTLSeconds = int64(bucket.TTL.Seconds())
+		}
+		if bucket.MaxSize > 0 && int64(bucket.MaxSize)<<20 < limits.MaxSize {
+			limits.MaxSize = int64(bucket.MaxSize) << 20
+		}
+		if limits.AllowedTypes == nil {
+			limits.AllowedTypes = []string{}
+		}
+		caps.Buckets[name] = limits
+	}
+	return caps
+}
+
+func (s *Server) handleCapabilities(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.capabilities())
+}
@@ -0,0 +1,57 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapabilitiesReflectConfig(t *testing.T) {
+	s := newTestServer(t, Config{
+		MaxSize:        20,
+		CompressAtRest: true,
+		ShortLinks:     true,
+		NameStrategy:   NameHash,
+		UploadTokens:   []UploadToken{{Token: "t1"}},
+		Buckets: map[string]BucketConfig{
+			"images": {MaxSize: 5, AllowedTypes: []string{"image/"}, TTL: time.Hour, AuthToken: "secret"},
+			"public": {},
+		},
+	})
+	rec := serve(s, httptest.NewRequest(http.MethodGet, "/capabilities", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var caps capabilities
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &caps))
+	require.Equal(t, int64(20<<20), caps.MaxSize)
+	require.False(t, caps.AuthRequired)
+	require.Zero(t, caps.TTLSeconds)
+	require.True(t, caps.UploadTokens)
+	require.True(t, caps.ShortLinks)
+	require.False(t, caps.Receipts)
+	require.True(t, caps.Resumable)
+	require.Equal(t, NameHash, caps.NameStrategy)
+	require.Equal(t, []string{encodingGzip}, caps.AtRestCompression)
+	require.Equal(t, defaultMaxRanges, caps.MaxRanges)
+	require.Equal(t, map[string]uploadLimits{
+		"images": {MaxSize: 5 << 20, AllowedTypes: []string{"image/"}, TTLSeconds: 3600, AuthRequired: true},
+		"public": {MaxSize: 20 << 20, AllowedTypes: []string{}},
+	}, caps.Buckets)
+}
+
+func TestCapabilitiesDefaults(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodGet, "/capabilities", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var caps map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &caps))
+	require.Equal(t, float64(100<<20), caps["max_size"])
+	require.Equal(t, false, caps["auth_required"])
+	require.Equal(t, float64(0), caps["ttl_seconds"])
+	require.Equal(t, NameOriginal, caps["name_strategy"])
+	require.Equal(t, []any{}, caps["at_rest_compression"])
+}
@@ -0,0 +1,92 @@
+package simpleserver
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// checksumHeader carries the hex SHA-256 of a file in upload responses
+	// and downloads.
+	checksumHeader = "X-Checksum"
+	// contentSHA256Header lets clients send the hex SHA-256 they expect the
+	// upload to have.
+	contentSHA256Header = "Content-SHA256"
+)
+
+var (
+	errInvalidChecksum  = errors.New(contentSHA256Header + " must be a hex encoded SHA-256")
+	errChecksumMismatch = errors.New("upload does not match its " + contentSHA256Header)
+)
+
+func requestChecksum(c echo.Context) (string, error) {
+	return parseChecksum(c.Request().Header.Get(contentSHA256Header))
+}
+
+// parseChecksum reads a hex SHA-256 sent by a client, which is optional.
+func parseChecksum(value string) (string, error) {
+	sum := strings.ToLower(strings.TrimSpace(value))
+	if sum == "" {
+		return "", nil
+	}
+	if decoded, err := hex.DecodeString(sum); err != nil || len(decoded) != 32 {
+		return "", errInvalidChecksum
+	}
+	return sum, nil
+}
+
+// announcesTrailer reports whether r declares the trailer name, which
+// chunked uploads use to send their checksum after the content.
+func announcesTrailer(r *http.Request, name string) bool {
+	_, ok := r.Trailer[http.CanonicalHeaderKey(name)]
+	return ok
+}
+
+// trailerChecksum returns the hex SHA-256 sent in the Content-SHA256
+// trailer, if any. trailer must only be read once the body is.
+func trailerChecksum(trailer http.Header) (string, error) {
+	return parseChecksum(trailer.Get(contentSHA256Header))
+}
+
+// setChecksumHeaders exposes the SHA-256 of meta on a download, as the
+// X-Checksum header and as a strong ETag.
+func setChecksumHeaders(c echo.Context, meta FileMeta) {
+	if meta.SHA256 == "" {
+		return
+	}
+	header := c.Response().Header()
+	header.Set(checksumHeader, meta.SHA256)
+	header.Set("ETag", `"`+meta.SHA256+`"`)
+}
+
+// notModified reports whether the request's If-None-Match names the ETag
+// set by setChecksumHeaders or, without one, whether the file was stored no
+// later than its If-Modified-Since. http.ServeContent does the same for
+// files served in ranges.
+func notModified(r *http.Request, meta FileMeta) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return meta.SHA256 != "" && matchesETag(inm, meta)
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || meta.CreatedAt.IsZero() {
+		return false
+	}
+	return !meta.CreatedAt.Truncate(time.Second).After(since)
+}
+
+// matchesETag reports whether the list of entity tags in header, as sent
+// with If-Match and If-None-Match, names the ETag of meta or is "*".
+func matchesETag(header string, meta FileMeta) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || (meta.SHA256 != "" && tag == `"`+meta.SHA256+`"`) {
+			return true
+		}
+	}
+	return false
+}
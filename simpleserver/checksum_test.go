@@ -0,0 +1,92 @@
+package simpleserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestUploadReturnsChecksum(t *testing.T) {
+	s := newTestServer(t, Config{})
+	sum := sha256Hex("hello world")
+
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/hello.txt", strings.NewReader("hello world")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Equal(t, sum, rec.Header().Get(checksumHeader))
+	require.Equal(t, sum, responseLine(t, rec.Body.String(), "SHA-256: "))
+	require.Equal(t, sum, findMeta(t, s, "hello.txt").SHA256)
+
+	u := downloadURLs(t, rec.Body.String())[0]
+	rec = download(t, s, u)
+	require.Equal(t, sum, rec.Header().Get(checksumHeader))
+	require.Equal(t, `"`+sum+`"`, rec.Header().Get("ETag"))
+
+	req := httptest.NewRequest(http.MethodGet, mustRequestURI(t, u), nil)
+	req.Header.Set("If-None-Match", `"`+sum+`"`)
+	require.Equal(t, http.StatusNotModified, serve(s, req).Code)
+}
+
+func TestNotModifiedForFilesServedWhole(t *testing.T) {
+	s := newTestServer(t, Config{CompressAtRest: true})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/hello.txt", strings.NewReader("hello world")))
+	u := downloadURLs(t, rec.Body.String())[0]
+
+	req := httptest.NewRequest(http.MethodGet, mustRequestURI(t, u), nil)
+	req.Header.Set("If-None-Match", `"other", "`+sha256Hex("hello world")+`"`)
+	require.Equal(t, http.StatusNotModified, serve(s, req).Code)
+}
+
+func TestUploadVerifiesContentSHA256(t *testing.T) {
+	s := newTestServer(t, Config{})
+
+	req := httptest.NewRequest(http.MethodPut, "/hello.txt", strings.NewReader("hello world"))
+	req.Header.Set(contentSHA256Header, strings.ToUpper(sha256Hex("hello world")))
+	require.Equal(t, http.StatusCreated, serve(s, req).Code)
+
+	req = httptest.NewRequest(http.MethodPut, "/hello.txt", strings.NewReader("hello world"))
+	req.Header.Set(contentSHA256Header, sha256Hex("something else"))
+	rec := serve(s, req)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Equal(t, errorResponse{Code: codeChecksumMismatch, Message: errChecksumMismatch.Error()}, errorOf(t, rec.Body.String()))
+
+	req = httptest.NewRequest(http.MethodPut, "/hello.txt", strings.NewReader("hello world"))
+	req.Header.Set(contentSHA256Header, "not-hex")
+	rec = serve(s, req)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Equal(t, errInvalidChecksum.Error(), errorOf(t, rec.Body.String()).Message)
+
+	require.Equal(t, 1, s.index.len())
+}
+
+func TestUploadVerifiesContentSHA256Trailer(t *testing.T) {
+	s := newTestServer(t, Config{})
+	ts := httptest.NewServer(s.newRouter())
+	defer ts.Close()
+	put := func(sum string) *http.Response {
+		t.Helper()
+		// Without a known length the body is chunked and can carry trailers.
+		req, err := http.NewRequest(http.MethodPut, ts.URL+"/hello.txt", io.MultiReader(strings.NewReader("hello world")))
+		require.NoError(t, err)
+		req.Trailer = http.Header{contentSHA256Header: []string{sum}}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	require.Equal(t, http.StatusCreated, put(sha256Hex("hello world")).StatusCode)
+	require.Equal(t, http.StatusBadRequest, put(sha256Hex("something else")).StatusCode)
+	require.Equal(t, http.StatusBadRequest, put("not-hex").StatusCode)
+	require.Equal(t, 1, s.index.len())
+}
@@ -0,0 +1,467 @@
+package simpleserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Chunked uploads let clients send a very large file as numbered parts, in
+// any order and in parallel, much like S3 multipart uploads:
+//
+//	POST   /uploads                    {"filename": "disk.img"} starts one
+//	PUT    /uploads/:id/parts/:n       stores part n, 1 to maxChunkParts
+//	GET    /uploads/:id                lists the parts stored so far
+//	POST   /uploads/:id/complete       joins the parts and stores the file
+//	DELETE /uploads/:id                drops the upload
+//
+// Each part may come with its own Content-SHA256 and is answered with the
+// SHA-256 it was stored with, which the complete request may list again to
+// make sure the file is assembled from the expected parts:
+//
+//	{"parts": [{"part": 1, "sha256": "..."}, {"part": 2, "sha256": "..."}]}
+//
+// Without a list every stored part is used in order. The complete request
+// is answered like any other upload, and its headers set the upload options
+// such as X-TTL, or the Content-SHA256 of the whole file.
+const (
+	chunkedPath = "/uploads"
+	// chunkedDirName holds the state and parts of chunked uploads, each in
+	// a dir of its own.
+	chunkedDirName  = ".uploads"
+	chunkedIDLength = 16
+	maxChunkParts   = 10000
+	// maxChunkedRequestSize bounds the JSON bodies of the start and complete
+	// requests.
+	maxChunkedRequestSize = 1 << 20
+)
+
+var (
+	errInvalidPart  = errors.New("part number must be between 1 and " + strconv.Itoa(maxChunkParts))
+	errMissingPart  = errors.New("part was not uploaded")
+	errPartMismatch = errors.New("part does not match its sha256")
+)
+
+// chunkPart describes a stored part.
+type chunkPart struct {
+	Part   int    `json:"part"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// chunkedUpload is the state of a chunked upload, persisted as state.json in
+// its dir next to the parts.
+type chunkedUpload struct {
+	ID        string      `json:"id"`
+	Filename  string      `json:"filename"`
+	CreatedAt time.Time   `json:"created_at"`
+	Parts     []chunkPart `json:"parts"`
+	// Dir and Name locate the stored file once the upload is complete.
+	Dir  string `json:"dir,omitempty"`
+	Name string `json:"name,omitempty"`
+	// URL is only filled in responses.
+	URL string `json:"url,omitempty"`
+}
+
+func (u chunkedUpload) complete() bool {
+	return u.Dir != ""
+}
+
+func (u chunkedUpload) size() int64 {
+	var size int64
+	for _, part := range u.Parts {
+		size += part.Size
+	}
+	return size
+}
+
+// setPart records part, keeping the parts sorted by number.
+func (u *chunkedUpload) setPart(part chunkPart) {
+	i := sort.Search(len(u.Parts), func(i int) bool { return u.Parts[i].Part >= part.Part })
+	if i < len(u.Parts) && u.Parts[i].Part == part.Part {
+		u.Parts[i] = part
+		return
+	}
+	u.Parts = append(u.Parts, chunkPart{})
+	copy(u.Parts[i+1:], u.Parts[i:])
+	u.Parts[i] = part
+}
+
+func (u chunkedUpload) part(n int) (chunkPart, bool) {
+	for _, part := range u.Parts {
+		if part.Part == n {
+			return part, true
+		}
+	}
+	return chunkPart{}, false
+}
+
+// chunkedStore keeps chunked uploads under <upload-dir>/.uploads. Parts are
+// written concurrently, while changes to the state of an upload are
+// serialized through locks.
+type chunkedStore struct {
+	root  string
+	locks sync.Map
+}
+
+func newChunkedStore(uploadDir string) *chunkedStore {
+	return &chunkedStore{root: filepath.Join(uploadDir, chunkedDirName)}
+}
+
+func (t *chunkedStore) dir(id string) string {
+	return filepath.Join(t.root, id)
+}
+
+func (t *chunkedStore) statePath(id string) string {
+	return filepath.Join(t.dir(id), "state.json")
+}
+
+func (t *chunkedStore) partPath(id string, n int) string {
+	return filepath.Join(t.dir(id), strconv.Itoa(n)+partSuffix)
+}
+
+// lock waits until no other request changes the state of upload id.
+func (t *chunkedStore) lock(id string) (unlock func()) {
+	mu, _ := t.locks.LoadOrStore(id, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+func (t *chunkedStore) get(id string) (chunkedUpload, error) {
+	// Chunked upload ids are drawn like tus ones.
+	if !validTusID(id) {
+		return chunkedUpload{}, fs.ErrNotExist
+	}
+	content, err := os.ReadFile(t.statePath(id))
+	if err != nil {
+		return chunkedUpload{}, err
+	}
+	var upload chunkedUpload
+	if err := json.Unmarshal(content, &upload); err != nil {
+		return chunkedUpload{}, err
+	}
+	return upload, nil
+}
+
+// save renames the state into place, as parts read it without the lock of
+// the upload and must never see it half written.
+func (t *chunkedStore) save(upload chunkedUpload) error {
+	content, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	state := t.statePath(upload.ID)
+	tmp := state + "." + base58(8) + partSuffix
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, state); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func (t *chunkedStore) create(upload chunkedUpload) error {
+	if err := os.MkdirAll(t.dir(upload.ID), 0755); err != nil {
+		return err
+	}
+	if err := t.save(upload); err != nil {
+		os.RemoveAll(t.dir(upload.ID))
+		return err
+	}
+	return nil
+}
+
+func (t *chunkedStore) remove(id string) error {
+	return os.RemoveAll(t.dir(id))
+}
+
+// removeParts drops the parts of a complete upload. Its state is kept so a
+// client whose last response got lost can still learn the download link.
+func (t *chunkedStore) removeParts(upload chunkedUpload) {
+	for _, part := range upload.Parts {
+		os.Remove(t.partPath(upload.ID, part.Part))
+	}
+}
+
+// stale returns the dirs of the uploads whose state was last changed before
+// now-stalePartAge.
+func (t *chunkedStore) stale(now time.Time) []string {
+	entries, err := os.ReadDir(t.root)
+	if err != nil {
+		return nil
+	}
+	var dirs []string
+	for _, entry := range entries {
+		info, err := os.Stat(t.statePath(entry.Name()))
+		if err != nil || now.Sub(info.ModTime()) >= stalePartAge {
+			dirs = append(dirs, t.dir(entry.Name()))
+		}
+	}
+	return dirs
+}
+
+func (s *Server) registerChunkedRoutes(e *echo.Echo) {
+	g := e.Group(chunkedPath, s.requireUploadAuth)
+	g.POST("", s.handleChunkedStart, s.rejectInMaintenance)
+	g.GET("/:id", s.handleChunkedStatus)
+	g.PUT("/:id/parts/:n", s.handleChunkedPart, s.rejectInMaintenance)
+	g.POST("/:id/complete", s.handleChunkedComplete, s.rejectInMaintenance, s.limitUploadsPerUser, s.queueUploads)
+	g.DELETE("/:id", s.handleChunkedAbort, s.rejectWhenReadOnly)
+}
+
+// chunkedMaxSize is the largest file a chunked upload may assemble.
+func (s *Server) chunkedMaxSize(opts uploadOptions) int64 {
+	limit := int64(s.maxSize()) << 20
+	if opts.MaxBytes > 0 && opts.MaxBytes < limit {
+		return opts.MaxBytes
+	}
+	return limit
+}
+
+func (s *Server) chunkedResponse(c echo.Context, upload chunkedUpload) chunkedUpload {
+	if upload.complete() {
+		upload.URL = s.downloadURL(c, upload.Dir, upload.Name)
+	}
+	if upload.Parts == nil {
+		upload.Parts = []chunkPart{}
+	}
+	return upload
+}
+
+func chunkedLookupError(c echo.Context, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fail(c, http.StatusNotFound, "Upload not found")
+	}
+	log.Printf("Failed to read chunked upload: %v\n", err)
+	return fail(c, http.StatusInternalServerError, "Failed to read upload")
+}
+
+func (s *Server) handleChunkedStart(c echo.Context) error {
+	var req struct {
+		Filename string `json:"filename"`
+	}
+	if err := json.NewDecoder(io.LimitReader(c.Request().Body, maxChunkedRequestSize)).Decode(&req); err != nil {
+		return fail(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+	}
+	if _, err := s.uploadOptions(c); err != nil {
+		return s.uploadError(c, err)
+	}
+	filename, err := s.uploadFilename(req.Filename)
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	if !s.extensionAllowed(filename) {
+		return s.uploadError(c, errExtensionNotAllowed)
+	}
+
+	upload := chunkedUpload{
+		ID:        base58(chunkedIDLength),
+		Filename:  filename,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.chunked.create(upload); err != nil {
+		log.Printf("Failed to create chunked upload: %v\n", err)
+		return fail(c, http.StatusInternalServerError, "Failed to create upload")
+	}
+	c.Response().Header().Set(echo.HeaderLocation, basePath(c)+chunkedPath+"/"+upload.ID)
+	return c.JSON(http.StatusCreated, s.chunkedResponse(c, upload))
+}
+
+func (s *Server) handleChunkedStatus(c echo.Context) error {
+	upload, err := s.chunked.get(c.Param("id"))
+	if err != nil {
+		return chunkedLookupError(c, err)
+	}
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	return c.JSON(http.StatusOK, s.chunkedResponse(c, upload))
+}
+
+func (s *Server) handleChunkedPart(c echo.Context) error {
+	id := c.Param("id")
+	n, err := strconv.Atoi(c.Param("n"))
+	if err != nil || n < 1 || n > maxChunkParts {
+		return fail(c, http.StatusBadRequest, errInvalidPart.Error())
+	}
+	want, err := requestChecksum(c)
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	opts, err := s.uploadOptions(c)
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	upload, err := s.chunked.get(id)
+	if err != nil {
+		return chunkedLookupError(c, err)
+	}
+	if upload.complete() {
+		return fail(c, http.StatusConflict, "Upload is already complete")
+	}
+
+	// Parts of the same upload arrive in parallel, so each one is written
+	// to a file of its own and only recorded once it is complete.
+	limit := s.chunkedMaxSize(opts) - upload.size()
+	if existing, ok := upload.part(n); ok {
+		limit += existing.Size
+	}
+	part, tmp, err := s.chunked.writePart(id, c.Request().Body, limit)
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	defer os.Remove(tmp)
+	if want != "" && want != part.SHA256 {
+		return s.uploadError(c, errChecksumMismatch)
+	}
+	part.Part = n
+
+	unlock := s.chunked.lock(id)
+	defer unlock()
+	if upload, err = s.chunked.get(id); err != nil {
+		return chunkedLookupError(c, err)
+	}
+	if upload.complete() {
+		return fail(c, http.StatusConflict, "Upload is already complete")
+	}
+	if err := os.Rename(tmp, s.chunked.partPath(id, n)); err != nil {
+		log.Printf("Failed to store part %d of chunked upload %s: %v\n", n, id, err)
+		return fail(c, http.StatusInternalServerError, "Failed to save part")
+	}
+	upload.setPart(part)
+	if err := s.chunked.save(upload); err != nil {
+		log.Printf("Failed to save chunked upload %s: %v\n", id, err)
+		return fail(c, http.StatusInternalServerError, "Failed to save part")
+	}
+	c.Response().Header().Set(checksumHeader, part.SHA256)
+	c.Response().Header().Set("ETag", `"`+part.SHA256+`"`)
+	return c.JSON(http.StatusOK, part)
+}
+
+// writePart copies r into a temporary file of upload id, refusing more than
+// limit bytes, and returns the file along with the size and SHA-256 of what
+// was written.
+func (t *chunkedStore) writePart(id string, r io.Reader, limit int64) (chunkPart, string, error) {
+	file, err := os.CreateTemp(t.dir(id), "part-*.tmp")
+	if err != nil {
+		return chunkPart{}, "", err
+	}
+	hash := sha256.New()
+	size, err := copyBuffer(io.MultiWriter(file, hash), &maxBytesReader{r: r, n: max(limit, 0)})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return chunkPart{}, "", err
+	}
+	return chunkPart{Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}, file.Name(), nil
+}
+
+// completedParts picks the parts a complete request names, or all of them
+// when it names none.
+func completedParts(upload chunkedUpload, r io.Reader) ([]chunkPart, error) {
+	var req struct {
+		Parts []chunkPart `json:"parts"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r, maxChunkedRequestSize)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if len(req.Parts) == 0 {
+		return upload.Parts, nil
+	}
+	parts := make([]chunkPart, 0, len(req.Parts))
+	for i, listed := range req.Parts {
+		if i > 0 && listed.Part <= req.Parts[i-1].Part {
+			return nil, errors.New("parts must be listed in ascending order")
+		}
+		part, ok := upload.part(listed.Part)
+		if !ok {
+			return nil, fmt.Errorf("%w: %d", errMissingPart, listed.Part)
+		}
+		if listed.SHA256 != "" && listed.SHA256 != part.SHA256 {
+			return nil, fmt.Errorf("%w: %d", errPartMismatch, listed.Part)
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+func (s *Server) handleChunkedComplete(c echo.Context) error {
+	id := c.Param("id")
+	unlock := s.chunked.lock(id)
+	defer unlock()
+	upload, err := s.chunked.get(id)
+	if err != nil {
+		return chunkedLookupError(c, err)
+	}
+	if upload.complete() {
+		c.Response().Header().Set(downloadURLHeader, s.downloadURL(c, upload.Dir, upload.Name))
+		return fail(c, http.StatusConflict, "Upload is already complete")
+	}
+	parts, err := completedParts(upload, c.Request().Body)
+	if err != nil {
+		return fail(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+	}
+	opts, err := s.uploadOptions(c)
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	var size int64
+	for _, part := range parts {
+		size += part.Size
+	}
+	if size > s.chunkedMaxSize(opts) {
+		return s.uploadError(c, errTooLarge)
+	}
+
+	readers := make([]io.Reader, 0, len(parts))
+	for _, part := range parts {
+		file, err := os.Open(s.chunked.partPath(id, part.Part))
+		if err != nil {
+			return s.uploadError(c, err)
+		}
+		defer file.Close()
+		readers = append(readers, file)
+	}
+	// The parts are kept when storing fails, so the client can replace
+	// the wrong ones and complete again.
+	meta, err := s.saveUploadWith(c, s.uploadDirFor(c), upload.Filename, io.MultiReader(readers...), opts)
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	s.chunked.removeParts(upload)
+	upload.Dir, upload.Name = meta.Dir, meta.Name
+	if err := s.chunked.save(upload); err != nil {
+		log.Printf("Failed to save chunked upload %s: %v\n", id, err)
+	}
+	return s.uploaded(c, meta)
+}
+
+func (s *Server) handleChunkedAbort(c echo.Context) error {
+	id := c.Param("id")
+	unlock := s.chunked.lock(id)
+	defer unlock()
+	if _, err := s.chunked.get(id); err != nil {
+		return chunkedLookupError(c, err)
+	}
+	if err := s.chunked.remove(id); err != nil {
+		log.Printf("Failed to remove chunked upload %s: %v\n", id, err)
+		return fail(c, http.StatusInternalServerError, "Failed to remove upload")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
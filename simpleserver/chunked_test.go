@@ -0,0 +1,135 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func chunkedStart(t *testing.T, s *Server, filename string) string {
+	t.Helper()
+	rec := serve(s, httptest.NewRequest(http.MethodPost, chunkedPath, strings.NewReader(`{"filename": "`+filename+`"}`)))
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var upload chunkedUpload
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &upload))
+	require.Equal(t, chunkedPath+"/"+upload.ID, rec.Header().Get("Location"))
+	return rec.Header().Get("Location")
+}
+
+func chunkedPart(s *Server, location string, n int, content, sum string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("%s/parts/%d", location, n), strings.NewReader(content))
+	if sum != "" {
+		req.Header.Set(contentSHA256Header, sum)
+	}
+	return serve(s, req)
+}
+
+func TestChunkedUploadInParallel(t *testing.T) {
+	s := newTestServer(t, Config{})
+	location := chunkedStart(t, s, "disk.img")
+
+	parts := []string{"first ", "second ", "third"}
+	recs := make([]*httptest.ResponseRecorder, len(parts))
+	// The router is built once, as building one per request races.
+	h := s.newRouter()
+	var wg sync.WaitGroup
+	for i := len(parts) - 1; i >= 0; i-- {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("%s/parts/%d", location, i+1), strings.NewReader(parts[i]))
+			req.Header.Set(contentSHA256Header, sha256Hex(parts[i]))
+			recs[i] = httptest.NewRecorder()
+			h.ServeHTTP(recs[i], req)
+		}(i)
+	}
+	wg.Wait()
+	for i, rec := range recs {
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		require.Equal(t, `"`+sha256Hex(parts[i])+`"`, rec.Header().Get("ETag"))
+	}
+
+	rec := serve(s, httptest.NewRequest(http.MethodGet, location, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var upload chunkedUpload
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &upload))
+	require.Equal(t, []chunkPart{
+		{Part: 1, Size: 6, SHA256: sha256Hex("first ")},
+		{Part: 2, Size: 7, SHA256: sha256Hex("second ")},
+		{Part: 3, Size: 5, SHA256: sha256Hex("third")},
+	}, upload.Parts)
+
+	req := httptest.NewRequest(http.MethodPost, location+"/complete", nil)
+	req.Header.Set(contentSHA256Header, sha256Hex("first second third"))
+	rec = serve(s, req)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	link := downloadURLs(t, rec.Body.String())[0]
+	require.Equal(t, "first second third", download(t, s, link).Body.String())
+	require.Equal(t, "disk.img", findMeta(t, s, "disk.img").Name)
+
+	// The state outlives the parts, so a lost answer can be recovered.
+	require.NoFileExists(t, s.chunked.partPath(upload.ID, 1))
+	rec = serve(s, httptest.NewRequest(http.MethodGet, location, nil))
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &upload))
+	require.Equal(t, link, upload.URL)
+	require.Equal(t, http.StatusConflict, serve(s, httptest.NewRequest(http.MethodPost, location+"/complete", nil)).Code)
+	require.Equal(t, http.StatusConflict, chunkedPart(s, location, 4, "late", "").Code)
+}
+
+func TestChunkedUploadChecksPartsAndSizes(t *testing.T) {
+	s := newTestServer(t, Config{MaxSize: 1})
+	location := chunkedStart(t, s, "big.bin")
+
+	require.Equal(t, http.StatusBadRequest, chunkedPart(s, location, 0, "zero", "").Code)
+	require.Equal(t, http.StatusBadRequest, chunkedPart(s, location, maxChunkParts+1, "many", "").Code)
+	require.Equal(t, http.StatusBadRequest, chunkedPart(s, location, 1, "corrupt", sha256Hex("original")).Code)
+	require.Equal(t, http.StatusOK, chunkedPart(s, location, 1, strings.Repeat("a", 1<<19), "").Code)
+	require.Equal(t, http.StatusOK, chunkedPart(s, location, 2, "tail", "").Code)
+	// Together the parts may not exceed MaxSize.
+	require.Equal(t, http.StatusRequestEntityTooLarge, chunkedPart(s, location, 3, strings.Repeat("b", 1<<19), "").Code)
+
+	complete := func(body string) *httptest.ResponseRecorder {
+		return serve(s, httptest.NewRequest(http.MethodPost, location+"/complete", strings.NewReader(body)))
+	}
+	require.Equal(t, http.StatusBadRequest, complete(`{"parts": [{"part": 2}, {"part": 1}]}`).Code)
+	require.Equal(t, http.StatusBadRequest, complete(`{"parts": [{"part": 1}, {"part": 3}]}`).Code)
+	require.Equal(t, http.StatusBadRequest, complete(`{"parts": [{"part": 2, "sha256": "`+sha256Hex("other")+`"}]}`).Code)
+
+	// Parts left out of the list are not part of the file.
+	rec := complete(`{"parts": [{"part": 2, "sha256": "` + sha256Hex("tail") + `"}]}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	require.Equal(t, "tail", download(t, s, downloadURLs(t, rec.Body.String())[0]).Body.String())
+}
+
+func TestChunkedUploadAbortAndCleanup(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken})
+	require.Equal(t, http.StatusNotFound, serve(s, httptest.NewRequest(http.MethodGet, chunkedPath+"/../../etc", nil)).Code)
+
+	location := chunkedStart(t, s, "aborted.txt")
+	require.Equal(t, http.StatusOK, chunkedPart(s, location, 1, "partial", "").Code)
+	require.Equal(t, http.StatusNoContent, serve(s, httptest.NewRequest(http.MethodDelete, location, nil)).Code)
+	require.Equal(t, http.StatusNotFound, serve(s, httptest.NewRequest(http.MethodGet, location, nil)).Code)
+
+	location = chunkedStart(t, s, "abandoned.txt")
+	id := strings.TrimPrefix(location, chunkedPath+"/")
+	old := time.Now().Add(-2 * stalePartAge)
+	require.NoError(t, os.Chtimes(s.chunked.statePath(id), old, old))
+	require.Equal(t, []string{chunkedDirName + "/" + id}, gcRequest(t, s, http.MethodPost).StaleParts)
+	require.NoDirExists(t, s.chunked.dir(id))
+}
+
+func TestChunkedUploadsRequireUploadAuth(t *testing.T) {
+	s := newTestServer(t, Config{AuthToken: "secret"})
+	rec := serve(s, httptest.NewRequest(http.MethodPost, chunkedPath, strings.NewReader(`{"filename": "a.txt"}`)))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.True(t, s.capabilities().ChunkedUploads)
+	require.True(t, reservedSlugs["uploads"])
+}
@@ -0,0 +1,125 @@
+package simpleserver
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Clips are held in memory only and never reach the upload directory or the
+// storage backend, for secrets passed between machines:
+//
+//	cat secret | curl -T - host/clip/x
+//	curl host/clip/x
+const (
+	clipPath       = "/clip"
+	defaultClipTTL = 10 * time.Minute
+	maxClipSize    = 8 << 20
+	// maxClipMemory caps the memory all clips hold together.
+	maxClipMemory = 64 << 20
+)
+
+var errClipboardFull = errors.New("too many clips are held, retry once some expired")
+
+type clip struct {
+	content   []byte
+	expiresAt time.Time
+}
+
+// clipboard holds the clips until they expire. Expired clips are dropped as
+// the clipboard is used.
+type clipboard struct {
+	mu    sync.Mutex
+	clips map[string]clip
+	size  int
+}
+
+func newClipboard() *clipboard {
+	return &clipboard{clips: make(map[string]clip)}
+}
+
+func (b *clipboard) put(name string, content []byte, expiresAt time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.prune(time.Now())
+	size := b.size - len(b.clips[name].content) + len(content)
+	if size > maxClipMemory {
+		return errClipboardFull
+	}
+	b.clips[name] = clip{content: content, expiresAt: expiresAt}
+	b.size = size
+	return nil
+}
+
+func (b *clipboard) get(name string) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.prune(time.Now())
+	c, ok := b.clips[name]
+	return c.content, ok
+}
+
+func (b *clipboard) prune(now time.Time) {
+	for name, c := range b.clips {
+		if !now.Before(c.expiresAt) {
+			b.size -= len(c.content)
+			delete(b.clips, name)
+		}
+	}
+}
+
+func (s *Server) clipTTL() time.Duration {
+	if s.config.ClipTTL > 0 {
+		return s.config.ClipTTL
+	}
+	return defaultClipTTL
+}
+
+// handleClipPut answers PUT /clip/:name, replacing the clip of that name.
+// ?ttl= expires it sooner than Config.ClipTTL.
+func (s *Server) handleClipPut(c echo.Context) error {
+	name := c.Param("name")
+	if !validSlug(name) {
+		return s.uploadError(c, errInvalidSlug)
+	}
+	ttl := s.clipTTL()
+	if value := c.QueryParam("ttl"); value != "" {
+		requested, err := parseTTL(value)
+		if err != nil {
+			return s.uploadError(c, err)
+		}
+		ttl = min(ttl, requested)
+	}
+	limit := min(int64(s.maxSize())<<20, maxClipSize)
+	if size := c.Request().ContentLength; size > limit {
+		return s.uploadError(c, &sizeLimitError{limit: limit, over: size - limit})
+	}
+	content, err := io.ReadAll(&maxBytesReader{r: c.Request().Body, n: limit})
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	if err := s.clips.put(name, content, time.Now().Add(ttl)); err != nil {
+		return fail(c, http.StatusInsufficientStorage, err.Error())
+	}
+	return c.String(http.StatusCreated, s.baseURL(c)+clipPath+"/"+name+"\n")
+}
+
+// handleClipGet answers GET /clip/:name. Clips are served as plain text or
+// bytes and never cached.
+func (s *Server) handleClipGet(c echo.Context) error {
+	content, ok := s.clips.get(c.Param("name"))
+	if !ok {
+		return fail(c, http.StatusNotFound, "Clip not found")
+	}
+	contentType := echo.MIMEOctetStream
+	if strings.HasPrefix(http.DetectContentType(content), "text/") {
+		contentType = echo.MIMETextPlainCharsetUTF8
+	}
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.Blob(http.StatusOK, contentType, content)
+}
@@ -0,0 +1,70 @@
+package simpleserver
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClipRoundTripStaysInMemory(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, clipPath+"/x", strings.NewReader("hunter2")))
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	require.True(t, strings.HasSuffix(strings.TrimSpace(rec.Body.String()), clipPath+"/x"))
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, clipPath+"/x", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "hunter2", rec.Body.String())
+	require.Equal(t, "text/plain; charset=UTF-8", rec.Header().Get("Content-Type"))
+	require.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+
+	require.Zero(t, s.index.len())
+	filepath.WalkDir(s.getUploadDir(), func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			content, _ := os.ReadFile(path)
+			require.NotContains(t, string(content), "hunter2", path)
+		}
+		return nil
+	})
+
+	rec = serve(s, httptest.NewRequest(http.MethodPut, clipPath+"/x", strings.NewReader("\x00\x01")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	rec = serve(s, httptest.NewRequest(http.MethodGet, clipPath+"/x", nil))
+	require.Equal(t, "application/octet-stream", rec.Header().Get("Content-Type"))
+}
+
+func TestClipsExpire(t *testing.T) {
+	s := newTestServer(t, Config{ClipTTL: time.Hour})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, clipPath+"/short?ttl=60", strings.NewReader("soon gone")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	rec = serve(s, httptest.NewRequest(http.MethodPut, clipPath+"/long?ttl=24h", strings.NewReader("capped")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	s.clips.prune(time.Now().Add(2 * time.Minute))
+	require.Equal(t, http.StatusNotFound, serve(s, httptest.NewRequest(http.MethodGet, clipPath+"/short", nil)).Code)
+	require.Equal(t, http.StatusOK, serve(s, httptest.NewRequest(http.MethodGet, clipPath+"/long", nil)).Code)
+	s.clips.prune(time.Now().Add(2 * time.Hour))
+	require.Equal(t, http.StatusNotFound, serve(s, httptest.NewRequest(http.MethodGet, clipPath+"/long", nil)).Code)
+	require.Zero(t, s.clips.size)
+}
+
+func TestClipLimits(t *testing.T) {
+	s := newTestServer(t, Config{MaxSize: 1})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, clipPath+"/big", strings.NewReader(strings.Repeat("x", 2<<20))))
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	rec = serve(s, httptest.NewRequest(http.MethodPut, clipPath+"/no.dots", strings.NewReader("x")))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	for i := 0; i < maxClipMemory/maxClipSize; i++ {
+		require.NoError(t, s.clips.put(strings.Repeat("a", i+1), make([]byte, maxClipSize), time.Now().Add(time.Hour)))
+	}
+	require.ErrorIs(t, s.clips.put("full", []byte("x"), time.Now().Add(time.Hour)), errClipboardFull)
+	require.NoError(t, s.clips.put("a", []byte("x"), time.Now().Add(time.Hour)), "replacing a clip frees its memory")
+}
@@ -0,0 +1,245 @@
+package simpleserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// clusterBlobsPath serves the stored objects of a server to its peers.
+	clusterBlobsPath = "/cluster/blobs"
+	// clusterSyncInterval is how often servers sharing a metadata store
+	// reload it, to pick up the uploads and deletions of the others.
+	clusterSyncInterval = 30 * time.Second
+)
+
+var errNotOnPeers = errors.New("no peer holds the file")
+
+// refresh reloads the entry of key from a shared store, which other servers
+// may have changed, and returns the entry it dropped when the file is gone.
+// Failures keep the entry as it is.
+func (ix *metaIndex) refresh(key string) (dropped FileMeta, gone bool) {
+	shared, ok := ix.store.(sharedStore)
+	if !ok {
+		return FileMeta{}, false
+	}
+	ix.mu.RLock()
+	writes := ix.writes
+	ix.mu.RUnlock()
+	meta, found, err := shared.Lookup(key)
+	if err != nil {
+		log.Printf("Failed to look up %s in the shared metadata store: %v\n", key, err)
+		return FileMeta{}, false
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	// A change made here meanwhile is newer than what was looked up.
+	if ix.writes != writes {
+		return FileMeta{}, false
+	}
+	old, had := ix.files[key]
+	if had {
+		if ix.aliases[old.Alias] == key {
+			delete(ix.aliases, old.Alias)
+		}
+		ix.dropBlob(old)
+		ix.dropTerms(old)
+		ix.dropDir(old)
+	}
+	if !found {
+		delete(ix.files, key)
+		return old, had
+	}
+	ix.files[key] = meta
+	ix.addBlob(meta)
+	ix.addTerms(meta)
+	ix.addDir(meta)
+	if meta.Alias != "" {
+		ix.aliases[meta.Alias] = key
+	}
+	return FileMeta{}, false
+}
+
+// sync reloads a shared store whole and returns the entries it dropped. A
+// sync that raced with a change made here is skipped until the next one.
+func (ix *metaIndex) sync() ([]FileMeta, error) {
+	ix.mu.RLock()
+	writes := ix.writes
+	ix.mu.RUnlock()
+	files, tokens, err := ix.store.Load()
+	if err != nil {
+		return nil, err
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if ix.writes != writes {
+		return nil, nil
+	}
+	var dropped []FileMeta
+	for key, meta := range ix.files {
+		if _, ok := files[key]; !ok {
+			dropped = append(dropped, meta)
+		}
+	}
+	ix.replace(files, tokens)
+	return dropped, nil
+}
+
+// startClusterSync keeps the index in step with the other servers sharing
+// its metadata store.
+func (s *Server) startClusterSync() {
+	if _, ok := s.index.store.(sharedStore); !ok {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(clusterSyncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stopC:
+				return
+			case <-ticker.C:
+			}
+			dropped, err := s.index.sync()
+			if err != nil {
+				log.Printf("Failed to sync with the shared metadata store: %v\n", err)
+				continue
+			}
+			for _, meta := range dropped {
+				s.forgetFile(meta)
+			}
+		}
+	}()
+}
+
+// refreshFile brings the entry of dir/name up to date before it is served.
+func (s *Server) refreshFile(dir, name string) {
+	if dropped, gone := s.index.refresh(metaKey(dir, name)); gone {
+		s.forgetFile(dropped)
+	}
+}
+
+// forgetFile removes the local copy of an upload another server deleted.
+func (s *Server) forgetFile(meta FileMeta) {
+	if err := s.storage.Delete(context.Background(), meta.key()); err != nil {
+		log.Printf("Failed to remove %s, deleted by a peer: %v\n", meta.key(), err)
+	}
+	s.cache.remove(meta.key())
+	s.dropVariants(meta)
+}
+
+// peersFor orders the peers by rendezvous hashing on key, so every server
+// asks them in the same order and copies pile up on the same few peers.
+func (s *Server) peersFor(key string) []string {
+	peers := append([]string(nil), s.config.Peers...)
+	weight := func(peer string) uint64 {
+		h := fnv.New64a()
+		h.Write([]byte(peer + "\n" + key))
+		return h.Sum64()
+	}
+	sort.Slice(peers, func(i, j int) bool { return weight(peers[i]) > weight(peers[j]) })
+	return peers
+}
+
+// fetchFromPeers copies the stored object of meta from the first peer that
+// holds it, so a download landing on a server without it can be served.
+func (s *Server) fetchFromPeers(ctx context.Context, meta FileMeta) error {
+	var errs []error
+	for _, peer := range s.peersFor(meta.key()) {
+		err := s.fetchFromPeer(ctx, peer, meta)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("%s: %w", peer, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return errNotOnPeers
+}
+
+// getFromPeers opens the object of meta once it is copied from a peer. It
+// fails with fs.ErrNotExist when no peer has it.
+func (s *Server) getFromPeers(ctx context.Context, meta FileMeta) (*Object, error) {
+	if err := s.fetchFromPeers(ctx, meta); err != nil {
+		if !errors.Is(err, errNotOnPeers) {
+			log.Printf("Failed to fetch %s from the peers: %v\n", meta.key(), err)
+		}
+		return nil, fs.ErrNotExist
+	}
+	return s.storage.Get(ctx, meta.key())
+}
+
+func (s *Server) fetchFromPeer(ctx context.Context, peer string, meta FileMeta) error {
+	segments := strings.Split(meta.key(), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(peer, "/")+clusterBlobsPath+"/"+strings.Join(segments, "/"), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+s.config.ClusterSecret)
+	// The object is copied as stored, which must not be compressed on the
+	// way so its length can be checked.
+	req.Header.Set("Accept-Encoding", "identity")
+	resp, err := s.peerClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fs.ErrNotExist
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("peer answered with status %d", resp.StatusCode)
+	case resp.ContentLength != meta.storedBytes():
+		return fmt.Errorf("peer holds %d bytes instead of %d", resp.ContentLength, meta.storedBytes())
+	}
+	if err := s.storage.Put(ctx, meta.key(), resp.Body); err != nil {
+		s.storage.Delete(context.Background(), meta.key())
+		return err
+	}
+	return nil
+}
+
+// handlePeerBlob serves a stored object as is to a peer presenting the
+// cluster secret. Only the local storage is consulted.
+func (s *Server) handlePeerBlob(c echo.Context) error {
+	if !validBearer(c.Request(), s.config.ClusterSecret) {
+		return fail(c, http.StatusUnauthorized, "Unauthorized")
+	}
+	dir, name, err := parseTarget(strings.TrimPrefix(c.Request().URL.EscapedPath(), clusterBlobsPath+"/"))
+	if err != nil {
+		return fail(c, http.StatusNotFound, "File not found")
+	}
+	obj, err := s.storage.Get(c.Request().Context(), metaKey(dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fail(c, http.StatusNotFound, "File not found")
+	}
+	if err != nil {
+		log.Printf("Failed to open %s/%s for a peer: %v\n", dir, name, err)
+		return fail(c, http.StatusInternalServerError, "Failed to read file")
+	}
+	defer obj.Content.Close()
+	c.Response().Header().Set(echo.HeaderContentLength, strconv.FormatInt(obj.Size, 10))
+	c.Response().Header().Set(echo.HeaderContentType, "application/octet-stream")
+	c.Response().WriteHeader(http.StatusOK)
+	_, err = io.Copy(c.Response(), obj.Content)
+	return err
+}
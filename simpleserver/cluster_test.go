@@ -0,0 +1,79 @@
+package simpleserver
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCluster starts two servers sharing a metadata store, each storing
+// files in its own upload dir.
+func newTestCluster(t *testing.T) (a, b *Server) {
+	t.Helper()
+	store := "redis://" + fakeRedisHashes(t)
+	var servers [2]*Server
+	var urls [2]string
+	for i := range servers {
+		i := i
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			servers[i].newRouter().ServeHTTP(w, r)
+		}))
+		t.Cleanup(ts.Close)
+		urls[i] = ts.URL
+	}
+	for i := range servers {
+		servers[i] = newTestServer(t, Config{MetadataStore: store, Peers: []string{urls[1-i]}, ClusterSecret: "cluster"})
+	}
+	return servers[0], servers[1]
+}
+
+func TestClusterServesFilesOfPeers(t *testing.T) {
+	a, b := newTestCluster(t)
+	rec := serve(a, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("shared")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	url := downloadURLs(t, rec.Body.String())[0]
+	token := rec.Header().Get(deleteTokenHeader)
+	meta := findMeta(t, a, "notes.txt")
+
+	rec = download(t, b, url)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "shared", rec.Body.String())
+	obj, err := b.storage.Get(context.Background(), meta.key())
+	require.NoError(t, err, "the copy is kept")
+	obj.Content.Close()
+
+	req := httptest.NewRequest(http.MethodDelete, "/"+meta.key(), nil)
+	req.Header.Set(deleteTokenHeader, token)
+	require.Equal(t, http.StatusNoContent, serve(a, req).Code)
+	require.Equal(t, http.StatusNotFound, download(t, b, url).Code)
+	_, err = b.storage.Get(context.Background(), meta.key())
+	require.True(t, errors.Is(err, fs.ErrNotExist), "the copy goes with the file")
+}
+
+func TestPeerBlobNeedsClusterSecret(t *testing.T) {
+	a, _ := newTestCluster(t)
+	rec := serve(a, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("shared")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	target := clusterBlobsPath + "/" + findMeta(t, a, "notes.txt").key()
+
+	require.Equal(t, http.StatusUnauthorized, serve(a, httptest.NewRequest(http.MethodGet, target, nil)).Code)
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("Authorization", "Bearer cluster")
+	rec = serve(a, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "shared", rec.Body.String())
+}
+
+func TestValidatePeers(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, Config{UploadDir: dir, MetadataStore: "redis://cache", Peers: []string{"http://node2:8080"}, ClusterSecret: "s"}.Validate())
+	require.ErrorContains(t, Config{UploadDir: dir, MetadataStore: "redis://cache", Peers: []string{"http://node2:8080"}}.Validate(), "--cluster-secret")
+	require.ErrorContains(t, Config{UploadDir: dir, Peers: []string{"http://node2:8080"}, ClusterSecret: "s"}.Validate(), "--metadata-store")
+	require.ErrorContains(t, Config{UploadDir: dir, MetadataStore: "redis://cache", Peers: []string{"node2"}, ClusterSecret: "s"}.Validate(), "--peers")
+}
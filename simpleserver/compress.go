@@ -0,0 +1,329 @@
+package simpleserver
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	encodingGzip = "gzip"
+	encodingZstd = "zstd"
+	// responseGzipLevel trades ratio for the CPU spent on every response.
+	responseGzipLevel = 5
+	// sniffLen is how much of an upload http.DetectContentType looks at.
+	sniffLen = 512
+)
+
+// defaultCompressSkipTypes lists content that is already compressed and would
+// only waste CPU when gzipped again.
+var defaultCompressSkipTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/x-bzip2",
+	"application/x-xz",
+	"application/zstd",
+	"application/x-7z-compressed",
+	"application/vnd.rar",
+	"application/pdf",
+}
+
+// detectContentType sniffs the type from the first bytes of the content, so
+// renaming a file does not change how it is served. The extension only
+// refines results the magic bytes cannot tell apart, e.g. CSS from plain
+// text, and decides alone when there is no content to look at.
+func detectContentType(name string, head []byte) string {
+	byExt := mime.TypeByExtension(path.Ext(name))
+	if len(head) == 0 && byExt != "" {
+		return byExt
+	}
+	sniffed := sniffContentType(head)
+	switch {
+	case byExt == "":
+	case sniffed == "application/octet-stream":
+		return byExt
+	case strings.HasPrefix(sniffed, "text/plain") && textContentType(byExt):
+		return byExt
+	}
+	return sniffed
+}
+
+// textContentType reports whether contentType is a textual format.
+func textContentType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "json") || strings.HasSuffix(mediaType, "xml") ||
+		mediaType == "application/javascript"
+}
+
+// matchContentType reports whether contentType is one of patterns. A pattern
+// ending in "/" matches every subtype, e.g. "image/".
+func matchContentType(patterns []string, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	for _, p := range patterns {
+		if strings.HasSuffix(p, "/") && strings.HasPrefix(mediaType, p) || mediaType == p {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) compressible(contentType string) bool {
+	skip := s.config.CompressSkipTypes
+	if skip == nil {
+		skip = defaultCompressSkipTypes
+	}
+	return !matchContentType(skip, contentType)
+}
+
+// copyEncoded copies r into w using the given at-rest encoding and returns the
+// number of bytes read from r.
+func copyEncoded(w io.Writer, r io.Reader, encoding string) (int64, error) {
+	if encoding != encodingGzip {
+		return copyBuffer(w, r)
+	}
+	gz := gzip.NewWriter(w)
+	n, err := copyBuffer(gz, r)
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	return n, err
+}
+
+// serveWhole streams the full content of a file that cannot be served in
+// ranges, decoding any at-rest encoding back to the bytes originally uploaded.
+func (s *Server) serveWhole(c echo.Context, stored io.Reader, meta FileMeta) error {
+	r, err := s.decodedReader(stored, meta)
+	if errors.Is(err, errUnknownKey) {
+		return fail(c, http.StatusInternalServerError, "File cannot be decrypted")
+	}
+	if err != nil {
+		return fail(c, http.StatusInternalServerError, "Failed to read file")
+	}
+	defer r.Close()
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentLength, strconv.FormatInt(meta.Size, 10))
+	header.Set("Accept-Ranges", "none")
+	c.Response().WriteHeader(http.StatusOK)
+	if c.Request().Method == http.MethodHead {
+		return nil
+	}
+	return sendBody(c, r)
+}
+
+// decodedReader undoes the at-rest encryption and encoding of meta on the
+// stored bytes.
+func (s *Server) decodedReader(stored io.Reader, meta FileMeta) (io.ReadCloser, error) {
+	if meta.Encryption != "" {
+		if s.cipher == nil || s.cipher.keyID != meta.KeyID {
+			return nil, errUnknownKey
+		}
+		var err error
+		if stored, err = s.cipher.decrypter(stored); err != nil {
+			return nil, err
+		}
+	}
+	if meta.Encoding == encodingGzip {
+		return gzip.NewReader(stored)
+	}
+	return io.NopCloser(stored), nil
+}
+
+// responseEncodings are the encodings responses are compressed with, in
+// order of preference. Brotli is left out, the standard library and the
+// vendored modules only offer gzip and zstd encoders.
+var responseEncodings = []string{encodingZstd, encodingGzip}
+
+// negotiateEncoding picks the offer the Accept-Encoding header value accept
+// rates highest, preferring earlier offers on ties. It returns "" when the
+// client takes none of them.
+func negotiateEncoding(accept string, offers []string) string {
+	quality := make(map[string]float64)
+	for _, part := range strings.Split(accept, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if coding = strings.ToLower(coding); coding != "" {
+			quality[coding] = q
+		}
+	}
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		q, ok := quality[offer]
+		if !ok {
+			q, ok = quality["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+var (
+	gzipWriters = sync.Pool{New: func() any {
+		w, _ := gzip.NewWriterLevel(io.Discard, responseGzipLevel)
+		return w
+	}}
+	zstdWriters = sync.Pool{New: func() any {
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+		return w
+	}}
+)
+
+// encoder is the part of gzip.Writer and zstd.Encoder responses use.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+func newEncoder(encoding string, w io.Writer) encoder {
+	if encoding == encodingZstd {
+		enc := zstdWriters.Get().(*zstd.Encoder)
+		enc.Reset(w)
+		return enc
+	}
+	enc := gzipWriters.Get().(*gzip.Writer)
+	enc.Reset(w)
+	return enc
+}
+
+func releaseEncoder(enc encoder) {
+	switch enc := enc.(type) {
+	case *zstd.Encoder:
+		zstdWriters.Put(enc)
+	case *gzip.Writer:
+		gzipWriters.Put(enc)
+	}
+}
+
+// compressResponses compresses responses with the best encoding the client
+// accepts. Whether a response is compressed is only settled once its headers
+// are written: content that is already compressed, as told by its type, is
+// sent as is, and so is anything a handler encoded itself.
+func (s *Server) compressResponses(skip func(echo.Context) bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			encoding := negotiateEncoding(c.Request().Header.Get("Accept-Encoding"), responseEncodings)
+			if encoding == "" || c.Request().Method == http.MethodHead || skip(c) {
+				return next(c)
+			}
+			res := c.Response()
+			w := &compressWriter{ResponseWriter: res.Writer, server: s, encoding: encoding}
+			res.Writer = w
+			defer func() {
+				w.close()
+				res.Writer = w.ResponseWriter
+			}()
+			return next(c)
+		}
+	}
+}
+
+// compressWriter decides on the first header or body write whether the
+// response is compressed.
+type compressWriter struct {
+	http.ResponseWriter
+	server   *Server
+	encoding string
+	decided  bool
+	enc      encoder
+}
+
+func (w *compressWriter) decide(code int) {
+	w.decided = true
+	header := w.Header()
+	contentType := header.Get(echo.HeaderContentType)
+	if code < http.StatusOK || code == http.StatusNoContent || code == http.StatusNotModified ||
+		contentType == "" || !w.server.compressible(contentType) {
+		return
+	}
+	if header.Get(echo.HeaderContentEncoding) != "" {
+		return
+	}
+	header.Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+	header.Del(echo.HeaderContentLength)
+	header.Set(echo.HeaderContentEncoding, w.encoding)
+	w.enc = newEncoder(w.encoding, w.ResponseWriter)
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if !w.decided {
+		w.decide(code)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		if w.Header().Get(echo.HeaderContentType) == "" {
+			w.Header().Set(echo.HeaderContentType, http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.enc != nil {
+		return w.enc.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// ReadFrom lets files that are sent uncompressed reach the ReadFrom of the
+// connection.
+func (w *compressWriter) ReadFrom(r io.Reader) (int64, error) {
+	if !w.decided {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.enc != nil {
+		return copyBuffer(w.enc, r)
+	}
+	return copyBuffer(w.ResponseWriter, r)
+}
+
+func (w *compressWriter) Flush() {
+	if w.enc != nil {
+		w.enc.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressWriter) close() {
+	if w.enc == nil {
+		return
+	}
+	w.enc.Close()
+	releaseEncoder(w.enc)
+	w.enc = nil
+}
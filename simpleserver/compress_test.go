@@ -0,0 +1,169 @@
+package simpleserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+func storedFileSize(t *testing.T, s *Server, name string) int64 {
+	t.Helper()
+	for _, dir := range shareDirs(t, s) {
+		info, err := os.Stat(filepath.Join(s.config.UploadDir, dir, name))
+		if err == nil {
+			return info.Size()
+		}
+	}
+	t.Fatalf("%s is not stored", name)
+	return 0
+}
+
+func TestCompressAtRest(t *testing.T) {
+	s := newTestServer(t, Config{CompressAtRest: true})
+	text := strings.Repeat("all work and no play makes jack a dull boy\n", 500)
+
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader(text)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	textURL := downloadURLs(t, rec.Body.String())[0]
+	require.Less(t, storedFileSize(t, s, "notes.txt"), int64(len(text)))
+
+	rec = download(t, s, textURL)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, text, rec.Body.String())
+	require.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+
+	jpeg := append([]byte{0xff, 0xd8, 0xff, 0xe0}, bytes.Repeat([]byte{0}, 2048)...)
+	rec = serve(s, httptest.NewRequest(http.MethodPut, "/photo.jpg", bytes.NewReader(jpeg)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	photoURL := downloadURLs(t, rec.Body.String())[0]
+	require.Equal(t, int64(len(jpeg)), storedFileSize(t, s, "photo.jpg"))
+
+	rec = download(t, s, photoURL)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, jpeg, rec.Body.Bytes())
+}
+
+func TestCompressAtRestRecordsMetadata(t *testing.T) {
+	s := newTestServer(t, Config{CompressAtRest: true})
+	text := strings.Repeat("a", 4096)
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader(text)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	meta, ok := s.index.get(shareDirs(t, s)[0], "a.txt")
+	require.True(t, ok)
+	require.Equal(t, encodingGzip, meta.Encoding)
+	require.Equal(t, int64(len(text)), meta.Size)
+	require.Equal(t, storedFileSize(t, s, "a.txt"), meta.StoredSize)
+}
+
+func TestCompressible(t *testing.T) {
+	s := newTestServer(t, Config{CompressSkipTypes: []string{"image/", "application/zip"}})
+	require.True(t, s.compressible("text/plain; charset=utf-8"))
+	require.True(t, s.compressible("application/json"))
+	require.False(t, s.compressible("image/png"))
+	require.False(t, s.compressible("application/zip"))
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	for accept, want := range map[string]string{
+		"":                        "",
+		"identity":                "",
+		"gzip":                    encodingGzip,
+		"gzip, deflate, br, zstd": encodingZstd,
+		"zstd;q=0.5, gzip":        encodingGzip,
+		"GZIP;q=0.8":              encodingGzip,
+		"gzip;q=0, zstd;q=0":      "",
+		"*":                       encodingZstd,
+		"zstd;q=0, *;q=0.1":       encodingGzip,
+	} {
+		require.Equal(t, want, negotiateEncoding(accept, responseEncodings), accept)
+	}
+}
+
+func decodeResponse(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var r io.Reader = rec.Body
+	switch rec.Header().Get("Content-Encoding") {
+	case encodingGzip:
+		gz, err := gzip.NewReader(r)
+		require.NoError(t, err)
+		r = gz
+	case encodingZstd:
+		zr, err := zstd.NewReader(r)
+		require.NoError(t, err)
+		defer zr.Close()
+		r = zr
+	}
+	body, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestResponseCompressionFollowsContentType(t *testing.T) {
+	s := newTestServer(t, Config{})
+	text := strings.Repeat("all work and no play makes jack a dull boy\n", 500)
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader(text)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	textURL := downloadURLs(t, rec.Body.String())[0]
+	jpeg := append([]byte{0xff, 0xd8, 0xff, 0xe0}, bytes.Repeat([]byte{0}, 2048)...)
+	rec = serve(s, httptest.NewRequest(http.MethodPut, "/photo.jpg", bytes.NewReader(jpeg)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	photoURL := downloadURLs(t, rec.Body.String())[0]
+
+	for accept, encoding := range map[string]string{"gzip, zstd": encodingZstd, "gzip": encodingGzip, "": ""} {
+		req := httptest.NewRequest(http.MethodGet, textURL, nil)
+		req.Header.Set("Accept-Encoding", accept)
+		rec = serve(s, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, encoding, rec.Header().Get("Content-Encoding"), accept)
+		require.Equal(t, text, decodeResponse(t, rec))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, photoURL, nil)
+	req.Header.Set("Accept-Encoding", "gzip, zstd")
+	rec = serve(s, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Empty(t, rec.Header().Get("Content-Encoding"), "images are already compressed")
+	require.Equal(t, jpeg, rec.Body.Bytes())
+}
+
+func TestPrecompressedVariants(t *testing.T) {
+	s := newTestServer(t, Config{Precompress: true})
+	text := strings.Repeat("all work and no play makes jack a dull boy\n", 500)
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader(text)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	url := downloadURLs(t, rec.Body.String())[0]
+	meta, ok := s.index.get(shareDirs(t, s)[0], "notes.txt")
+	require.True(t, ok)
+	variant, err := os.ReadFile(s.variantPath(meta.SHA256, encodingGzip))
+	require.NoError(t, err)
+	require.FileExists(t, s.variantPath(meta.SHA256, encodingZstd))
+
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec = serve(s, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, encodingGzip, rec.Header().Get("Content-Encoding"))
+	require.Equal(t, variant, rec.Body.Bytes(), "the stored variant is served as is")
+	require.Equal(t, text, decodeResponse(t, rec))
+
+	// Ranges address the file itself.
+	req.Header.Set("Range", "bytes=0-9")
+	rec = serve(s, req)
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	require.Empty(t, rec.Header().Get("Content-Encoding"))
+	require.Equal(t, text[:10], rec.Body.String())
+
+	require.NoError(t, s.deleteFile(meta))
+	require.NoFileExists(t, s.variantPath(meta.SHA256, encodingGzip))
+	require.NoFileExists(t, s.variantPath(meta.SHA256, encodingZstd))
+}
@@ -0,0 +1,166 @@
+package simpleserver
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// concurrencyLimiter caps how many requests a single key may have in flight.
+type concurrencyLimiter struct {
+	limit    int
+	mu       sync.Mutex
+	inflight map[string]int
+}
+
+func newConcurrencyLimiter(limit int) *concurrencyLimiter {
+	return &concurrencyLimiter{limit: limit, inflight: make(map[string]int)}
+}
+
+// setLimit changes the limit. Requests in flight over a lowered limit are
+// let finish.
+func (l *concurrencyLimiter) setLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+}
+
+func (l *concurrencyLimiter) acquire(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inflight[key] >= l.limit {
+		return false
+	}
+	l.inflight[key]++
+	return true
+}
+
+func (l *concurrencyLimiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inflight[key] <= 1 {
+		delete(l.inflight, key)
+		return
+	}
+	l.inflight[key]--
+}
+
+// uploaderIdentity names who is uploading: the upload token, AuthToken or
+// user the request authenticates with, the client IP otherwise. Credentials
+// that do not validate count as the IP, so clients cannot escape per client
+// limits by making up a new one for every request.
+func (s *Server) uploaderIdentity(c echo.Context) string {
+	if identity, ok := s.tokenIdentity(c); ok {
+		return identity
+	}
+	if name, ok := s.requestUser(c); ok {
+		return "user:" + name
+	}
+	return "ip:" + c.RealIP()
+}
+
+// tokenIdentity names the upload token or AuthToken the request carries,
+// when it is a valid one. Both take a lookup to check, unlike passwords.
+func (s *Server) tokenIdentity(c echo.Context) (string, bool) {
+	if token := requestToken(c); token != "" {
+		if _, ok := s.tokens.lookup(token); ok {
+			return "token:" + token, true
+		}
+	}
+	if token := s.settings().AuthToken; validBearer(c.Request(), token) {
+		return "bearer:" + token, true
+	}
+	return "", false
+}
+
+// limitUploadsPerUser rejects an upload with 429 while the same uploader
+// already has MaxUploadsPerUser uploads in progress.
+func (s *Server) limitUploadsPerUser(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if s.settings().MaxUploadsPerUser <= 0 {
+			return next(c)
+		}
+		identity := s.uploaderIdentity(c)
+		if !s.userUploads.acquire(identity) {
+			c.Response().Header().Set("Retry-After", "1")
+			return fail(c, http.StatusTooManyRequests, "Too many concurrent uploads")
+		}
+		defer s.userUploads.release(identity)
+		return next(c)
+	}
+}
+
+// transferQueue admits a fixed number of transfers at once across all
+// clients. Further ones wait for a slot to free up.
+type transferQueue struct {
+	slots chan struct{}
+}
+
+// newTransferQueue returns nil, which admits everything, for limits of 0.
+func newTransferQueue(limit int) *transferQueue {
+	if limit <= 0 {
+		return nil
+	}
+	return &transferQueue{slots: make(chan struct{}, limit)}
+}
+
+// acquire takes a slot, waiting at most timeout for one. It reports false
+// when none freed up in time or ctx ended first.
+func (q *transferQueue) acquire(ctx context.Context, timeout time.Duration) bool {
+	select {
+	case q.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if timeout <= 0 {
+		return false
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case q.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (q *transferQueue) release() {
+	<-q.slots
+}
+
+// queueTransfers holds a request until q has a slot for it, answering 429
+// once QueueTimeout passed without one.
+func (s *Server) queueTransfers(q *transferQueue, message string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if q == nil || c.Request().Method == http.MethodHead {
+				return next(c)
+			}
+			if !q.acquire(c.Request().Context(), s.config.QueueTimeout) {
+				retry := math.Max(1, math.Ceil(s.config.QueueTimeout.Seconds()))
+				c.Response().Header().Set("Retry-After", strconv.Itoa(int(retry)))
+				return fail(c, http.StatusTooManyRequests, message)
+			}
+			defer q.release()
+			return next(c)
+		}
+	}
+}
+
+// queueUploads and queueDownloads apply MaxConcurrentUploads and
+// MaxConcurrentDownloads.
+func (s *Server) queueUploads(next echo.HandlerFunc) echo.HandlerFunc {
+	return s.queueTransfers(s.uploadQueue, "Too many uploads in progress, try again later")(next)
+}
+
+func (s *Server) queueDownloads(next echo.HandlerFunc) echo.HandlerFunc {
+	return s.queueTransfers(s.downloadQueue, "Too many downloads in progress, try again later")(next)
+}
@@ -0,0 +1,140 @@
+package simpleserver
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// slowUpload starts an upload whose body stays open until the returned writer
+// is closed, keeping the upload in flight.
+func slowUpload(t *testing.T, s *Server, token string) (*io.PipeWriter, <-chan int) {
+	t.Helper()
+	body, writer := io.Pipe()
+	req := httptest.NewRequest(http.MethodPut, "/slow.bin", body)
+	req.Header.Set(uploadTokenHeader, token)
+	done := make(chan int, 1)
+	go func() { done <- serve(s, req).Code }()
+	_, err := writer.Write([]byte("first chunk"))
+	require.NoError(t, err)
+	return writer, done
+}
+
+func TestMaxUploadsPerUser(t *testing.T) {
+	s := newTestServer(t, Config{
+		MaxUploadsPerUser: 1,
+		UploadTokens:      []UploadToken{{Token: "alice"}, {Token: "bob"}},
+	})
+
+	writer, done := slowUpload(t, s, "alice")
+
+	rec := tokenUpload(s, "alice", "second.txt", "second")
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	rec = tokenUpload(s, "bob", "other.txt", "other")
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	// Anonymous uploads are limited per client IP.
+	rec = serve(s, httptest.NewRequest(http.MethodPut, "/anon.txt", strings.NewReader("anon")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	require.NoError(t, writer.Close())
+	select {
+	case code := <-done:
+		require.Equal(t, http.StatusCreated, code)
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow upload did not finish")
+	}
+
+	rec = tokenUpload(s, "alice", "third.txt", "third")
+	require.Equal(t, http.StatusCreated, rec.Code)
+}
+
+func TestMaxUploadsPerAnonymousIP(t *testing.T) {
+	s := newTestServer(t, Config{MaxUploadsPerUser: 1})
+
+	body, writer := io.Pipe()
+	done := make(chan int, 1)
+	go func() { done <- serve(s, httptest.NewRequest(http.MethodPut, "/slow.bin", body)).Code }()
+	_, err := writer.Write([]byte("chunk"))
+	require.NoError(t, err)
+
+	sameIP := httptest.NewRequest(http.MethodPut, "/again.txt", strings.NewReader("again"))
+	require.Equal(t, http.StatusTooManyRequests, serve(s, sameIP).Code)
+
+	otherIP := httptest.NewRequest(http.MethodPut, "/other.txt", strings.NewReader("other"))
+	otherIP.RemoteAddr = "198.51.100.7:4242"
+	require.Equal(t, http.StatusCreated, serve(s, otherIP).Code)
+
+	require.NoError(t, writer.Close())
+	require.Equal(t, http.StatusCreated, <-done)
+}
+
+func TestMaxUploadsPerUserIgnoresInvalidCredentials(t *testing.T) {
+	s := newTestServer(t, Config{MaxUploadsPerUser: 1})
+
+	body, writer := io.Pipe()
+	done := make(chan int, 1)
+	go func() { done <- serve(s, httptest.NewRequest(http.MethodPut, "/slow.bin", body)).Code }()
+	_, err := writer.Write([]byte("chunk"))
+	require.NoError(t, err)
+
+	for _, header := range []string{uploadTokenHeader, "Authorization"} {
+		req := httptest.NewRequest(http.MethodPut, "/again.txt", strings.NewReader("again"))
+		req.Header.Set(header, "Bearer another")
+		require.Equal(t, http.StatusTooManyRequests, serve(s, req).Code, header)
+	}
+
+	require.NoError(t, writer.Close())
+	require.Equal(t, http.StatusCreated, <-done)
+}
+
+func TestMaxConcurrentUploadsQueues(t *testing.T) {
+	s := newTestServer(t, Config{
+		MaxConcurrentUploads: 1,
+		QueueTimeout:         5 * time.Second,
+		UploadTokens:         []UploadToken{{Token: "alice"}, {Token: "bob"}},
+	})
+
+	writer, first := slowUpload(t, s, "alice")
+	second := make(chan int, 1)
+	go func() { second <- tokenUpload(s, "bob", "queued.txt", "queued").Code }()
+	select {
+	case code := <-second:
+		t.Fatalf("queued upload finished with %d while the slot was taken", code)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	require.NoError(t, writer.Close())
+	for _, done := range []<-chan int{first, second} {
+		select {
+		case code := <-done:
+			require.Equal(t, http.StatusCreated, code)
+		case <-time.After(5 * time.Second):
+			t.Fatal("upload did not finish")
+		}
+	}
+}
+
+func TestMaxConcurrentDownloadsTimesOut(t *testing.T) {
+	s := newTestServer(t, Config{MaxConcurrentDownloads: 1, QueueTimeout: 50 * time.Millisecond})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("hello")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	url := downloadURLs(t, rec.Body.String())[0]
+
+	require.True(t, s.downloadQueue.acquire(context.Background(), 0))
+	rec = serve(s, httptest.NewRequest(http.MethodGet, url, nil))
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.Equal(t, "1", rec.Header().Get("Retry-After"))
+	require.Equal(t, http.StatusOK, serve(s, httptest.NewRequest(http.MethodHead, url, nil)).Code, "HEAD requests transfer nothing")
+
+	s.downloadQueue.release()
+	require.Equal(t, "hello", download(t, s, url).Body.String())
+}
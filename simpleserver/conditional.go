@@ -0,0 +1,191 @@
+package simpleserver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	errPreconditionFailed  = errors.New("precondition failed, the file changed")
+	errOverwriteForbidden  = errors.New("writing into an existing share needs the auth token")
+	errInvalidContentRange = errors.New("invalid Content-Range, expected bytes <start>-<end>/<total or *> matching the body")
+)
+
+// conditionalWrite reports whether a PUT carries If-Match or If-None-Match,
+// which make it write to exactly the /<dir>/<name> it names.
+func conditionalWrite(r *http.Request) bool {
+	return r.Header.Get("If-Match") != "" || r.Header.Get("If-None-Match") != ""
+}
+
+// checkPreconditions evaluates the If-Match and If-None-Match headers of r
+// against current, the stored file if exists.
+func checkPreconditions(r *http.Request, current FileMeta, exists bool) error {
+	if header := r.Header.Get("If-Match"); header != "" && (!exists || !matchesETag(header, current)) {
+		return errPreconditionFailed
+	}
+	if header := r.Header.Get("If-None-Match"); header != "" && exists && matchesETag(header, current) {
+		return errPreconditionFailed
+	}
+	return nil
+}
+
+// mayOverwrite reports whether c may write into dir, which holds files
+// already: with the auth token, or as the user owning it.
+func (s *Server) mayOverwrite(c echo.Context, dir string) bool {
+	if s.isUserDir(dir) {
+		user, ok := s.requestUser(c)
+		return ok && user == dir
+	}
+	token := s.settings().AuthToken
+	return token != "" && validBearer(c.Request(), token)
+}
+
+// claimWrite resolves the file a conditional write targets and holds it
+// until release, so concurrent writes cannot both pass their preconditions.
+// New files are named like other uploads.
+func (s *Server) claimWrite(c echo.Context) (dir, name string, release func(), err error) {
+	dir, name, err = downloadTarget(c.Request())
+	if err != nil {
+		return "", "", nil, err
+	}
+	if s.claimedByDropShare(dir) || (!validSlug(dir) && !s.isUserDir(dir)) {
+		return "", "", nil, errInvalidSlug
+	}
+	if _, exists := s.index.get(dir, name); !exists {
+		if name, err = s.uploadFilename(name); err != nil {
+			return "", "", nil, err
+		}
+	}
+	release, err = s.claimFile(c, dir, name)
+	return dir, name, release, err
+}
+
+// claimFile holds dir/name for a write by c until release.
+func (s *Server) claimFile(c echo.Context, dir, name string) (release func(), err error) {
+	if (s.index.hasDir(dir) || s.isUserDir(dir)) && !s.mayOverwrite(c, dir) {
+		return nil, errOverwriteForbidden
+	}
+	key := metaKey(dir, name)
+	if _, busy := s.writeClaims.LoadOrStore(key, struct{}{}); busy {
+		return nil, errPreconditionFailed
+	}
+	return func() { s.writeClaims.Delete(key) }, nil
+}
+
+// replaceFile stores r as dir/name in place of current, if it exists.
+func (s *Server) replaceFile(c echo.Context, dir, name string, current FileMeta, exists bool, r io.Reader) (FileMeta, error) {
+	meta, err := s.saveUpload(c, dir, name, r)
+	if err != nil || !exists {
+		return meta, err
+	}
+	// Name strategies may have stored the new content under a new name.
+	if meta.Name != current.Name {
+		if err := s.removeFile(current); err != nil {
+			log.Printf("Failed to remove replaced %s: %v\n", current.key(), err)
+		}
+	} else if meta.SHA256 != current.SHA256 {
+		s.dropVariants(current)
+	}
+	return meta, nil
+}
+
+// handleConditionalUpload stores a PUT with If-Match or If-None-Match at its
+// path, overwriting the file there when the preconditions hold. Anything
+// else fails with 412 rather than landing in a new share.
+func (s *Server) handleConditionalUpload(c echo.Context) error {
+	dir, name, release, err := s.claimWrite(c)
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	defer release()
+	current, exists := s.index.get(dir, name)
+	if err := checkPreconditions(c.Request(), current, exists); err != nil {
+		return s.uploadError(c, err)
+	}
+	limit := int64(s.maxSize()) << 20
+	if size := c.Request().ContentLength; size > limit {
+		return s.uploadError(c, &sizeLimitError{limit: limit, over: size - limit})
+	}
+	meta, err := s.replaceFile(c, dir, name, current, exists, &maxBytesReader{r: c.Request().Body, n: limit})
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	return s.uploaded(c, meta)
+}
+
+// handleAppend appends the body of PATCH /<dir>/<name> to the file, which
+// is created when missing. Its Content-Range must start at the current
+// size, so appends of concurrent writers never interleave.
+func (s *Server) handleAppend(c echo.Context) error {
+	start, end, err := parseContentRange(c.Request().Header.Get("Content-Range"))
+	if err != nil || c.Request().ContentLength != end-start+1 {
+		return s.uploadError(c, errInvalidContentRange)
+	}
+	dir, name, release, err := s.claimWrite(c)
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	defer release()
+	current, exists := s.index.get(dir, name)
+	if err := checkPreconditions(c.Request(), current, exists); err != nil {
+		return s.uploadError(c, err)
+	}
+	if start != current.Size {
+		return fail(c, http.StatusPreconditionFailed, fmt.Sprintf("Content-Range must start at %d, the current size", current.Size))
+	}
+	limit := int64(s.maxSize()) << 20
+	if end >= limit {
+		return s.uploadError(c, &sizeLimitError{limit: limit, over: end + 1 - limit})
+	}
+	var content io.Reader = c.Request().Body
+	if exists {
+		obj, err := s.storage.Get(c.Request().Context(), current.key())
+		if err != nil {
+			return s.uploadError(c, err)
+		}
+		defer obj.Content.Close()
+		stored, err := s.decodedReader(obj.Content, current)
+		if err != nil {
+			return s.uploadError(c, err)
+		}
+		defer stored.Close()
+		content = io.MultiReader(stored, c.Request().Body)
+	}
+	meta, err := s.replaceFile(c, dir, name, current, exists, &maxBytesReader{r: content, n: end + 1})
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	return s.uploaded(c, meta)
+}
+
+// parseContentRange parses "bytes <start>-<end>/<total>", where total may
+// be * and otherwise must end with end, as appends end the file.
+func parseContentRange(value string) (start, end int64, err error) {
+	spec, ok := strings.CutPrefix(value, "bytes ")
+	if !ok {
+		return 0, 0, errInvalidContentRange
+	}
+	span, total, _ := strings.Cut(spec, "/")
+	first, last, _ := strings.Cut(span, "-")
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, errInvalidContentRange
+	}
+	end, err = strconv.ParseInt(last, 10, 64)
+	if err != nil || end < start {
+		return 0, 0, errInvalidContentRange
+	}
+	if total != "*" {
+		if size, err := strconv.ParseInt(total, 10, 64); err != nil || size != end+1 {
+			return 0, 0, errInvalidContentRange
+		}
+	}
+	return start, end, nil
+}
@@ -0,0 +1,87 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func conditionalPut(s *Server, target, content string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, target, strings.NewReader(content))
+	req.Header.Set("Authorization", "Bearer secret")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	return serve(s, req)
+}
+
+func appendTo(s *Server, target, content, contentRange string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, target, strings.NewReader(content))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Content-Range", contentRange)
+	return serve(s, req)
+}
+
+func TestConditionalPutOverwrites(t *testing.T) {
+	s := newTestServer(t, Config{AuthToken: "secret"})
+	rec := conditionalPut(s, "/docs/notes.txt", "v1", map[string]string{"If-None-Match": "*"})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	etag := `"` + sha256Hex("v1") + `"`
+
+	rec = conditionalPut(s, "/docs/notes.txt", "again", map[string]string{"If-None-Match": "*"})
+	require.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	rec = conditionalPut(s, "/docs/notes.txt", "v2", map[string]string{"If-Match": `"` + sha256Hex("other") + `"`})
+	require.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+	rec = conditionalPut(s, "/docs/notes.txt", "v2", map[string]string{"If-Match": etag})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	rec = download(t, s, "/docs/notes.txt")
+	require.Equal(t, "v2", rec.Body.String())
+	require.Equal(t, `"`+sha256Hex("v2")+`"`, rec.Header().Get("ETag"))
+	require.Len(t, s.index.inDir("docs"), 1)
+
+	rec = conditionalPut(s, "/docs/missing.txt", "v1", map[string]string{"If-Match": "*"})
+	require.Equal(t, http.StatusPreconditionFailed, rec.Code)
+}
+
+func TestConditionalPutNeedsAuthTokenForExistingShares(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("mine")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	meta := findMeta(t, s, "notes.txt")
+
+	rec = conditionalPut(s, "/"+meta.key(), "theirs", map[string]string{"If-Match": "*"})
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	rec = conditionalPut(s, "/fresh/notes.txt", "new", map[string]string{"If-None-Match": "*"})
+	require.Equal(t, http.StatusCreated, rec.Code, "new shares are open like custom paths")
+}
+
+func TestAppend(t *testing.T) {
+	s := newTestServer(t, Config{AuthToken: "secret"})
+	rec := appendTo(s, "/logs/app.log", "one\n", "bytes 0-3/*")
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	rec = appendTo(s, "/logs/app.log", "two\n", "bytes 4-7/8")
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	rec = appendTo(s, "/logs/app.log", "old\n", "bytes 4-7/*")
+	require.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	require.Contains(t, rec.Body.String(), "start at 8")
+	rec = appendTo(s, "/logs/app.log", "short", "bytes 8-20/*")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = download(t, s, "/logs/app.log")
+	require.Equal(t, "one\ntwo\n", rec.Body.String())
+}
+
+func TestParseContentRange(t *testing.T) {
+	start, end, err := parseContentRange("bytes 10-19/20")
+	require.NoError(t, err)
+	require.Equal(t, []int64{10, 19}, []int64{start, end})
+	for _, value := range []string{"", "bytes 10-9/*", "bytes 0-9/30", "items 0-9/*", "bytes -1-9/*", "bytes 0-x/*"} {
+		_, _, err := parseContentRange(value)
+		require.ErrorIs(t, err, errInvalidContentRange, value)
+	}
+}
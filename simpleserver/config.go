@@ -0,0 +1,427 @@
+package simpleserver
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	yaml "gopkg.in/yaml.v3"
+
+	"github.com/cloudflare/cloudflared/watcher"
+)
+
+// fileConfig is the layout of the file passed with --simpleserver-config.
+// YAML is a superset of JSON, so both formats are accepted. Settings missing
+// from the file keep the value of their flag.
+type fileConfig struct {
+	Port      *int           `yaml:"port"`
+	MaxSize   *int           `yaml:"maxSize"`
+	UploadDir *string        `yaml:"uploadDir"`
+	Storage   *string        `yaml:"storage"`
+	TTL       *time.Duration `yaml:"ttl"`
+
+	AuthToken    *string   `yaml:"authToken"`
+	AdminToken   *string   `yaml:"adminToken"`
+	UploadTokens *[]string `yaml:"uploadTokens"`
+
+	MaxTotalSize      *int     `yaml:"maxTotalSize"`
+	MaxUploadsPerUser *int     `yaml:"maxUploadsPerUser"`
+	RateLimit         *float64 `yaml:"rateLimit"`
+	BandwidthLimit    *int     `yaml:"bandwidthLimit"`
+
+	Buckets map[string]BucketConfig `yaml:"buckets"`
+}
+
+// loadConfigFile merges the settings found in path into config.
+func loadConfigFile(path string, config *Config) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var parsed fileConfig
+	if err := yaml.Unmarshal(content, &parsed); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for name, bucket := range parsed.Buckets {
+		if !isShareDir(name) {
+			return fmt.Errorf("invalid bucket name %q in %s", name, path)
+		}
+		if bucket.MaxSize < 0 || bucket.TTL < 0 {
+			return fmt.Errorf("bucket %q in %s has a negative limit", name, path)
+		}
+	}
+	if parsed.Port != nil && (*parsed.Port < 0 || *parsed.Port > 65535) {
+		return fmt.Errorf("port %d in %s is out of range", *parsed.Port, path)
+	}
+	for name, value := range map[string]*int{
+		"maxSize":           parsed.MaxSize,
+		"maxTotalSize":      parsed.MaxTotalSize,
+		"maxUploadsPerUser": parsed.MaxUploadsPerUser,
+		"bandwidthLimit":    parsed.BandwidthLimit,
+	} {
+		if value != nil && *value < 0 {
+			return fmt.Errorf("%s in %s is negative", name, path)
+		}
+	}
+	if (parsed.TTL != nil && *parsed.TTL < 0) || (parsed.RateLimit != nil && *parsed.RateLimit < 0) {
+		return fmt.Errorf("%s has a negative limit", path)
+	}
+	var tokens []UploadToken
+	if parsed.UploadTokens != nil {
+		tokens = []UploadToken{}
+		for _, value := range *parsed.UploadTokens {
+			token, err := parseUploadToken(value)
+			if err != nil {
+				return fmt.Errorf("%w in %s", err, path)
+			}
+			tokens = append(tokens, token)
+		}
+	}
+
+	setFromFile(&config.Port, parsed.Port)
+	setFromFile(&config.MaxSize, parsed.MaxSize)
+	setFromFile(&config.UploadDir, parsed.UploadDir)
+	setFromFile(&config.Storage, parsed.Storage)
+	setFromFile(&config.TTL, parsed.TTL)
+	setFromFile(&config.AuthToken, parsed.AuthToken)
+	setFromFile(&config.AdminToken, parsed.AdminToken)
+	if tokens != nil {
+		config.UploadTokens = tokens
+	}
+	setFromFile(&config.MaxTotalSize, parsed.MaxTotalSize)
+	setFromFile(&config.MaxUploadsPerUser, parsed.MaxUploadsPerUser)
+	setFromFile(&config.RateLimit, parsed.RateLimit)
+	setFromFile(&config.BandwidthLimit, parsed.BandwidthLimit)
+	config.Buckets = parsed.Buckets
+	return nil
+}
+
+func setFromFile[T any](setting *T, value *T) {
+	if value != nil {
+		*setting = *value
+	}
+}
+
+// Validate reports a setting the server cannot start with. The
+// upload dir is created when missing, so a bad one fails here rather than
+// on the first upload.
+func (c Config) Validate() error {
+	for flag, port := range map[string]int{
+		"port":         c.Port,
+		"metrics-port": c.MetricsPort,
+		"sftp-port":    c.SFTPPort,
+		"ftp-port":     c.FTPPort,
+		"grpc-port":    c.GRPCPort,
+		"s3-port":      c.S3Port,
+		"smtp-port":    c.SMTPPort,
+	} {
+		if port < 0 || port > 65535 {
+			return fmt.Errorf("--%s %d is not a port between 0 and 65535", flag, port)
+		}
+	}
+	for flag, size := range map[string]int{
+		"maxsize":                  c.MaxSize,
+		"max-total-size":           c.MaxTotalSize,
+		"min-free-space":           c.MinFreeSpace,
+		"tar-max-entries":          c.TarMaxEntries,
+		"tar-max-size":             c.TarMaxSize,
+		"tar-max-entry-size":       c.TarMaxEntrySize,
+		"slug-length":              c.SlugLength,
+		"processing-workers":       c.ProcessingWorkers,
+		"bandwidth-limit":          c.BandwidthLimit,
+		"max-uploads-per-user":     c.MaxUploadsPerUser,
+		"max-ranges":               c.MaxRanges,
+		"max-concurrent-uploads":   c.MaxConcurrentUploads,
+		"max-concurrent-downloads": c.MaxConcurrentDownloads,
+	} {
+		if size < 0 {
+			return fmt.Errorf("--%s %d must not be negative", flag, size)
+		}
+	}
+	for flag, duration := range map[string]time.Duration{
+		"ttl":              c.TTL,
+		"reap-interval":    c.ReapInterval,
+		"ack-timeout":      c.AckTimeout,
+		"processing-delay": c.ProcessingDelay,
+		"queue-timeout":    c.QueueTimeout,
+		"trash-period":     c.TrashPeriod,
+		"fetch-timeout":    c.FetchTimeout,
+		"clip-ttl":         c.ClipTTL,
+		"gc-interval":      c.GCInterval,
+		"scrub-interval":   c.ScrubInterval,
+		"read-timeout":     c.ReadTimeout,
+		"write-timeout":    c.WriteTimeout,
+		"idle-timeout":     c.IdleTimeout,
+		"stall-timeout":    c.StallTimeout,
+		"cache-max-age":    c.CacheMaxAge,
+	} {
+		if duration < 0 {
+			return fmt.Errorf("--%s %s must not be negative", flag, duration)
+		}
+	}
+	for _, addr := range c.Listen {
+		if _, port, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("--listen %q is not a host:port address: %w", addr, err)
+		} else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+			return fmt.Errorf("--listen %q has an invalid port", addr)
+		}
+	}
+	for flag, speed := range map[string]string{
+		"max-download-speed": c.MaxDownloadSpeed,
+		"max-upload-speed":   c.MaxUploadSpeed,
+		"scrub-speed":        c.ScrubSpeed,
+		"min-upload-speed":   c.MinUploadSpeed,
+	} {
+		if _, err := parseSpeed(speed); err != nil {
+			return fmt.Errorf("--%s %w", flag, err)
+		}
+	}
+	minUpload, _ := parseSpeed(c.MinUploadSpeed)
+	if maxUpload, _ := parseSpeed(c.MaxUploadSpeed); minUpload > 0 && maxUpload > 0 && minUpload > maxUpload {
+		return fmt.Errorf("--min-upload-speed %s is above --max-upload-speed %s", c.MinUploadSpeed, c.MaxUploadSpeed)
+	}
+	if _, err := newIDGenerator(c.IDScheme, c.SlugLength); err != nil {
+		return fmt.Errorf("--id-scheme: %w", err)
+	}
+	if _, err := parseByteSize(c.CacheSize, "size"); err != nil {
+		return fmt.Errorf("--cache-size %w", err)
+	}
+	if c.RateLimit < 0 {
+		return fmt.Errorf("--rate-limit %g must not be negative", c.RateLimit)
+	}
+	if c.StateDir != "" {
+		if err := c.checkStateDir(); err != nil {
+			return err
+		}
+	}
+	if err := checkWritableDir(c.uploadDir()); err != nil {
+		return fmt.Errorf("upload dir %s is not writable: %w", c.uploadDir(), err)
+	}
+	if c.ServeDir != "" {
+		if err := checkServeDir(c.ServeDir); err != nil {
+			return fmt.Errorf("--serve-dir: %w", err)
+		}
+	}
+	if c.TemplatesDir != "" {
+		if _, err := loadTemplates(c.TemplatesDir); err != nil {
+			return fmt.Errorf("--templates-dir: %w", err)
+		}
+	}
+	if c.Lang != "" && !knownLang(c.Lang) {
+		return fmt.Errorf("--lang %q is not one of %s", c.Lang, strings.Join(languages(), ", "))
+	}
+	if c.SMTPHost != "" {
+		if _, err := mail.ParseAddress(c.SMTPFrom); err != nil {
+			return fmt.Errorf("--smtp-from %q is not an email address", c.SMTPFrom)
+		}
+	}
+	if c.PublicURL != "" {
+		if u, err := url.Parse(c.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("--public-url %q is not an http or https URL", c.PublicURL)
+		}
+	}
+	if c.AccessTeamDomain != "" && c.OIDCIssuer != "" {
+		return fmt.Errorf("--access-team-domain and --oidc-issuer cannot be combined")
+	}
+	if (c.AccessTeamDomain != "" || c.OIDCIssuer != "") && len(c.AccessAUD) == 0 {
+		return fmt.Errorf("--access-aud is required to validate access tokens")
+	}
+	if c.OIDCIssuer != "" {
+		if u, err := url.Parse(c.OIDCIssuer); err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("--oidc-issuer %q is not an https URL", c.OIDCIssuer)
+		}
+	}
+	switch strings.ToUpper(c.FrameOptions) {
+	case "", "DENY", "SAMEORIGIN", "OFF":
+	default:
+		return fmt.Errorf("--frame-options %q is not DENY, SAMEORIGIN or off", c.FrameOptions)
+	}
+	for flag, values := range map[string][]string{
+		"allow-cidr":      c.AllowCIDRs,
+		"deny-cidr":       c.DenyCIDRs,
+		"trusted-proxies": c.TrustedProxies,
+	} {
+		if _, err := parsePrefixes(values); err != nil {
+			return fmt.Errorf("--%s: %w", flag, err)
+		}
+	}
+	if err := c.validateCORS(); err != nil {
+		return err
+	}
+	if c.DownloadWebhookURL != "" && c.DownloadWebhookURL == c.WebhookURL {
+		return fmt.Errorf("--download-webhook-url is --webhook-url, which already receives every download")
+	}
+	if c.OTelEndpoint != "" && !validOTelEndpoint(c.OTelEndpoint) {
+		return fmt.Errorf("--otel-endpoint %q is not an http or https URL", c.OTelEndpoint)
+	}
+	if c.ProxyTarget != "" {
+		if _, err := parseProxyTarget(c.ProxyTarget); err != nil {
+			return fmt.Errorf("--proxy-target: %w", err)
+		}
+	}
+	for _, peer := range c.Peers {
+		if u, err := url.Parse(peer); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("--peers %q is not an http or https URL", peer)
+		}
+	}
+	if len(c.Peers) > 0 && c.ClusterSecret == "" {
+		return fmt.Errorf("--cluster-secret is required with --peers")
+	}
+	if len(c.Peers) > 0 && !strings.HasPrefix(c.MetadataStore, "redis://") {
+		return fmt.Errorf("--peers needs a --metadata-store redis://... shared by the cluster")
+	}
+	if c.MirrorTo != "" {
+		if err := c.checkMirrorTo(); err != nil {
+			return fmt.Errorf("--mirror-to: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkWritableDir creates dir when missing and makes sure files can be
+// created in it.
+func checkWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	probe, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return err
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// liveSettings are the settings a reload of Config.ConfigFile changes while
+// requests are being served. Everything else in Config is fixed at startup.
+type liveSettings struct {
+	AuthToken         string
+	AdminToken        string
+	UploadTokens      []UploadToken
+	Buckets           map[string]BucketConfig
+	MaxTotalSize      int
+	MaxUploadsPerUser int
+	RateLimit         float64
+	BandwidthLimit    int
+}
+
+func newLiveSettings(config Config) *liveSettings {
+	return &liveSettings{
+		AuthToken:         config.AuthToken,
+		AdminToken:        config.AdminToken,
+		UploadTokens:      config.UploadTokens,
+		Buckets:           config.Buckets,
+		MaxTotalSize:      config.MaxTotalSize,
+		MaxUploadsPerUser: config.MaxUploadsPerUser,
+		RateLimit:         config.RateLimit,
+		BandwidthLimit:    config.BandwidthLimit,
+	}
+}
+
+// settings returns the reloadable settings currently in effect. Callers
+// reading several of them should hold on to one result, so a concurrent
+// reload cannot mix old and new values.
+func (s *Server) settings() *liveSettings {
+	return s.live.Load()
+}
+
+func (s *Server) applySettings(live *liveSettings) {
+	s.live.Store(live)
+	s.tokens.setTokens(live.UploadTokens)
+	s.userUploads.setLimit(live.MaxUploadsPerUser)
+}
+
+// reloadConfig reads Config.ConfigFile again and applies its reloadable
+// settings. In-flight requests finish with the settings they started with.
+// Settings removed from the file keep their current value.
+func (s *Server) reloadConfig() error {
+	config := s.config
+	current := s.settings()
+	config.AuthToken, config.AdminToken, config.UploadTokens = current.AuthToken, current.AdminToken, current.UploadTokens
+	config.MaxTotalSize, config.MaxUploadsPerUser = current.MaxTotalSize, current.MaxUploadsPerUser
+	config.RateLimit, config.BandwidthLimit = current.RateLimit, current.BandwidthLimit
+	if err := loadConfigFile(s.config.ConfigFile, &config); err != nil {
+		return err
+	}
+	if changed := restartSettings(s.config, config); len(changed) > 0 {
+		log.Printf("Changes to %s in %s take effect on restart\n", strings.Join(changed, ", "), s.config.ConfigFile)
+	}
+	s.applySettings(newLiveSettings(config))
+	return nil
+}
+
+// restartSettings names the settings that differ between old and updated
+// but cannot change while the server runs.
+func restartSettings(old, updated Config) []string {
+	var changed []string
+	if old.Port != updated.Port {
+		changed = append(changed, "port")
+	}
+	if old.MaxSize != updated.MaxSize {
+		changed = append(changed, "maxSize")
+	}
+	if old.UploadDir != updated.UploadDir {
+		changed = append(changed, "uploadDir")
+	}
+	if old.Storage != updated.Storage {
+		changed = append(changed, "storage")
+	}
+	if old.TTL != updated.TTL {
+		changed = append(changed, "ttl")
+	}
+	return changed
+}
+
+// configNotifier signals changes of the watched config file.
+type configNotifier chan struct{}
+
+func (n configNotifier) WatcherItemDidChange(string) {
+	select {
+	case n <- struct{}{}:
+	default:
+	}
+}
+
+func (n configNotifier) WatcherDidError(err error) {
+	log.Printf("Failed to watch the simpleserver config file: %v\n", err)
+}
+
+// watchConfig reloads Config.ConfigFile on SIGHUP and whenever the file is
+// written, until shutdownC is closed.
+func (s *Server) watchConfig(shutdownC <-chan struct{}) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	changes := make(configNotifier, 1)
+	if files, err := watcher.NewFile(); err != nil {
+		log.Printf("Failed to watch %s, reload it with SIGHUP: %v\n", s.config.ConfigFile, err)
+	} else if err := files.Add(s.config.ConfigFile); err != nil {
+		log.Printf("Failed to watch %s, reload it with SIGHUP: %v\n", s.config.ConfigFile, err)
+	} else {
+		go files.Start(changes)
+		defer files.Shutdown()
+	}
+
+	for {
+		select {
+		case <-hangups:
+		case <-changes:
+		case <-shutdownC:
+			return
+		}
+		if err := s.reloadConfig(); err != nil {
+			log.Printf("Failed to reload %s, keeping the current settings: %v\n", s.config.ConfigFile, err)
+			continue
+		}
+		log.Printf("Reloaded %s\n", s.config.ConfigFile)
+	}
+}
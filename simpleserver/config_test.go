@@ -0,0 +1,100 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+}
+
+func TestLoadConfigFileServerSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "simpleserver.yaml")
+	writeConfigFile(t, path, `
+port: 9090
+maxSize: 5
+uploadDir: /srv/uploads
+ttl: 24h
+authToken: secret
+uploadTokens: ["guest:3:10"]
+rateLimit: 2.5
+`)
+	config := Config{Port: 8080, MaxSize: 100, BandwidthLimit: 7}
+	require.NoError(t, loadConfigFile(path, &config))
+	require.Equal(t, 9090, config.Port)
+	require.Equal(t, 5, config.MaxSize)
+	require.Equal(t, "/srv/uploads", config.UploadDir)
+	require.Equal(t, 24*time.Hour, config.TTL)
+	require.Equal(t, "secret", config.AuthToken)
+	require.Len(t, config.UploadTokens, 1)
+	require.Equal(t, "guest", config.UploadTokens[0].Token)
+	require.Equal(t, 2.5, config.RateLimit)
+	require.Equal(t, 7, config.BandwidthLimit, "settings missing from the file keep their flag value")
+
+	writeConfigFile(t, path, "port: 70000\n")
+	require.Error(t, loadConfigFile(path, &config))
+	writeConfigFile(t, path, "maxSize: -1\n")
+	require.Error(t, loadConfigFile(path, &config))
+	require.Equal(t, 5, config.MaxSize, "a rejected file changes nothing")
+}
+
+func TestReloadConfigAppliesLiveSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "simpleserver.yaml")
+	writeConfigFile(t, path, "authToken: old\n")
+	config := Config{ConfigFile: path, Port: 8080}
+	require.NoError(t, loadConfigFile(path, &config))
+	s := newTestServer(t, config)
+	router := s.newRouter()
+
+	upload := func(token string) int {
+		req := httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("hello"))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	require.Equal(t, http.StatusCreated, upload("old"))
+
+	writeConfigFile(t, path, "authToken: new\nrateLimit: 1\nport: 9090\n")
+	require.NoError(t, s.reloadConfig())
+	require.Equal(t, http.StatusUnauthorized, upload("old"))
+	require.Equal(t, http.StatusCreated, upload("new"))
+	require.Equal(t, http.StatusTooManyRequests, upload("new"), "the rate limit applies without rebuilding the router")
+	require.Equal(t, 8080, s.config.Port, "the port only changes on restart")
+
+	writeConfigFile(t, path, "authToken: [broken\n")
+	require.Error(t, s.reloadConfig())
+	require.Equal(t, "new", s.settings().AuthToken)
+}
+
+func TestConfigValidate(t *testing.T) {
+	require.NoError(t, Config{UploadDir: t.TempDir(), Port: 8080, MaxSize: 10}.Validate())
+
+	for name, config := range map[string]Config{
+		"port out of range":  {Port: 70000},
+		"negative max size":  {MaxSize: -1},
+		"negative ttl":       {TTL: -time.Minute},
+		"bad proxy target":   {ProxyTarget: "ftp://example.com"},
+		"missing serve dir":  {ServeDir: filepath.Join(t.TempDir(), "missing")},
+		"upload dir is file": {UploadDir: filepath.Join(t.TempDir(), "file")},
+		"webhook sent twice": {WebhookURL: "http://hooks.example.com", DownloadWebhookURL: "http://hooks.example.com"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if config.UploadDir == "" {
+				config.UploadDir = t.TempDir()
+			} else {
+				writeConfigFile(t, config.UploadDir, "not a dir")
+			}
+			require.Error(t, config.Validate())
+		})
+	}
+}
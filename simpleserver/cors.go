@@ -0,0 +1,45 @@
+package simpleserver
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// corsConfig applies the CORS settings. tus discovery requests are OPTIONS
+// requests as well and are left to the tus handler.
+func (s *Server) corsConfig() middleware.CORSConfig {
+	methods := make([]string, len(s.config.CORSMethods))
+	for i, method := range s.config.CORSMethods {
+		methods[i] = strings.ToUpper(method)
+	}
+	return middleware.CORSConfig{
+		Skipper:          isTusDiscovery,
+		AllowOrigins:     s.config.CORSOrigins,
+		AllowMethods:     methods,
+		AllowCredentials: s.config.CORSCredentials,
+	}
+}
+
+// validateCORS refuses origins that are not a bare scheme://host[:port] and
+// credentials for any origin, which would let every site act on behalf of
+// signed in users.
+func (c Config) validateCORS() error {
+	wildcard := len(c.CORSOrigins) == 0
+	for _, origin := range c.CORSOrigins {
+		if origin == "*" {
+			wildcard = true
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+			return fmt.Errorf("--cors-origins %q is not an origin such as https://app.example.com", origin)
+		}
+	}
+	if c.CORSCredentials && wildcard && !c.NoCORS {
+		return fmt.Errorf("--cors-credentials needs --cors-origins naming the allowed origins")
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func preflight(s *Server, origin, method string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodOptions, "/notes.txt", nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", method)
+	return serve(s, req)
+}
+
+func TestCORSAllowsAnyOriginByDefault(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := preflight(s, "https://anywhere.example", http.MethodPut)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+	require.Empty(t, rec.Header().Get("Access-Control-Allow-Credentials"))
+}
+
+func TestCORSConfiguredOrigins(t *testing.T) {
+	s := newTestServer(t, Config{
+		CORSOrigins:     []string{"https://app.example.com"},
+		CORSMethods:     []string{"get", "put"},
+		CORSCredentials: true,
+	})
+	rec := preflight(s, "https://app.example.com", http.MethodPut)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.Equal(t, "https://app.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "GET,PUT", rec.Header().Get("Access-Control-Allow-Methods"))
+	require.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"))
+
+	rec = preflight(s, "https://evil.example", http.MethodPut)
+	require.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestNoCORS(t *testing.T) {
+	s := newTestServer(t, Config{NoCORS: true})
+	rec := preflight(s, "https://anywhere.example", http.MethodPut)
+	require.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+	req := httptest.NewRequest(http.MethodGet, healthPath, nil)
+	req.Header.Set("Origin", "https://anywhere.example")
+	rec = serve(s, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestValidateCORS(t *testing.T) {
+	dir := t.TempDir()
+	require.ErrorContains(t, Config{UploadDir: dir, CORSCredentials: true}.Validate(), "--cors-credentials")
+	require.ErrorContains(t, Config{UploadDir: dir, CORSCredentials: true, CORSOrigins: []string{"*"}}.Validate(), "--cors-credentials")
+	require.ErrorContains(t, Config{UploadDir: dir, CORSOrigins: []string{"app.example.com"}}.Validate(), "--cors-origins")
+	require.ErrorContains(t, Config{UploadDir: dir, CORSOrigins: []string{"https://app.example.com/path"}}.Validate(), "--cors-origins")
+	require.NoError(t, Config{UploadDir: dir, CORSCredentials: true, CORSOrigins: []string{"https://app.example.com"}}.Validate())
+}
@@ -0,0 +1,116 @@
+package simpleserver
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// linker is implemented by backends that can store an object under a second
+// key without copying it. Deleting either key leaves the other intact, so
+// the blob lives as long as one upload references it.
+type linker interface {
+	Link(ctx context.Context, existing, key string) error
+}
+
+// Link hardlinks existing to key through a hidden temporary name, replacing
+// any object already stored under key.
+func (l localStorage) Link(ctx context.Context, existing, key string) error {
+	dst := l.path(key)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(dst), "."+base58(12)+partSuffix)
+	if err := os.Link(l.path(existing), tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Link shares the content of existing, which is never modified in place.
+func (m *memoryStorage) Link(ctx context.Context, existing, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	obj, ok := m.objects[existing]
+	if !ok {
+		return fs.ErrNotExist
+	}
+	m.objects[key] = obj
+	return nil
+}
+
+// dedupeEnabled reports whether identical uploads share one stored blob.
+// Backends that cannot link objects store every upload on its own.
+func (s *Server) dedupeEnabled() bool {
+	_, ok := s.storage.(linker)
+	return s.config.Dedupe && ok
+}
+
+// linkDuplicate stores meta by linking it to an upload with the same content
+// and at rest encoding, and reports whether it did. meta then shares the
+// blob of that upload.
+func (s *Server) linkDuplicate(ctx context.Context, meta *FileMeta) bool {
+	source, ok := s.index.blobSource(*meta, time.Now())
+	if !ok {
+		return false
+	}
+	if err := s.storage.(linker).Link(ctx, source.key(), meta.key()); err != nil {
+		// The source may have been deleted since it was looked up; the
+		// upload is then stored as a new blob.
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Failed to link %s to %s: %v\n", meta.key(), source.key(), err)
+		}
+		return false
+	}
+	meta.Blob, meta.StoredSize = source.Blob, source.StoredSize
+	return true
+}
+
+// blobSource finds a processed upload whose blob meta can share.
+func (ix *metaIndex) blobSource(meta FileMeta, now time.Time) (FileMeta, bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	for key := range ix.blobs[meta.SHA256] {
+		source := ix.files[key]
+		if source.Pending || source.expired(now) {
+			continue
+		}
+		if source.Encoding == meta.Encoding && source.Encryption == meta.Encryption && source.KeyID == meta.KeyID {
+			return source, true
+		}
+	}
+	return FileMeta{}, false
+}
+
+// addBlob and dropBlob track the uploads sharing blobs by content. The
+// caller must hold ix.mu.
+func (ix *metaIndex) addBlob(meta FileMeta) {
+	if meta.Blob == "" {
+		return
+	}
+	keys, ok := ix.blobs[meta.SHA256]
+	if !ok {
+		keys = make(map[string]struct{})
+		ix.blobs[meta.SHA256] = keys
+	}
+	keys[meta.key()] = struct{}{}
+}
+
+func (ix *metaIndex) dropBlob(meta FileMeta) {
+	keys, ok := ix.blobs[meta.SHA256]
+	if !ok {
+		return
+	}
+	delete(keys, meta.key())
+	if len(keys) == 0 {
+		delete(ix.blobs, meta.SHA256)
+	}
+}
@@ -0,0 +1,97 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func dedupeUpload(t *testing.T, s *Server, name, content string) FileMeta {
+	t.Helper()
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/"+name, strings.NewReader(content)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	return findMeta(t, s, name)
+}
+
+func TestDedupeLinksIdenticalUploads(t *testing.T) {
+	s := newTestServer(t, Config{Dedupe: true, AdminToken: testAdminToken})
+	artifact := strings.Repeat("artifact ", 1000)
+	first := dedupeUpload(t, s, "build-1.bin", artifact)
+	second := dedupeUpload(t, s, "build-2.bin", artifact)
+	other := dedupeUpload(t, s, "other.bin", "something else")
+
+	require.NotEmpty(t, first.Blob)
+	require.Equal(t, first.Blob, second.Blob)
+	require.NotEqual(t, first.Blob, other.Blob)
+	firstInfo, err := os.Stat(filepath.Join(s.getUploadDir(), first.Dir, first.Name))
+	require.NoError(t, err)
+	secondInfo, err := os.Stat(filepath.Join(s.getUploadDir(), second.Dir, second.Name))
+	require.NoError(t, err)
+	require.True(t, os.SameFile(firstInfo, secondInfo))
+	require.Equal(t, int64(len(artifact)+len("something else")), s.index.storedBytes())
+
+	rec := serve(s, adminRequest(http.MethodGet, "/admin/stats", ""))
+	var stats Stats
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+	require.Equal(t, int64(len(artifact)), stats.DedupedBytes)
+
+	require.NoError(t, s.deleteFile(first))
+	rec = download(t, s, "/"+second.Dir+"/"+second.Name)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, artifact, rec.Body.String())
+
+	third := dedupeUpload(t, s, "build-3.bin", artifact)
+	require.Equal(t, second.Blob, third.Blob, "remaining uploads keep sharing the blob")
+	require.NoError(t, s.expireFile(second))
+	require.NoError(t, s.deleteFile(third))
+	require.Equal(t, int64(len("something else")), s.index.storedBytes())
+}
+
+func TestDedupeKeepsEncodingsApart(t *testing.T) {
+	plainServer := newTestServer(t, Config{Dedupe: true})
+	content := strings.Repeat("compress me ", 1000)
+	plain := dedupeUpload(t, plainServer, "logs.txt", content)
+
+	s := newTestServer(t, Config{UploadDir: plainServer.config.UploadDir, Dedupe: true, CompressAtRest: true})
+	compressed := dedupeUpload(t, s, "compressed.txt", content)
+	require.NotEqual(t, plain.Encoding, compressed.Encoding)
+	require.NotEqual(t, plain.Blob, compressed.Blob)
+
+	again := dedupeUpload(t, s, "more.txt", content)
+	require.Equal(t, compressed.Blob, again.Blob)
+	require.Equal(t, compressed.StoredSize, again.StoredSize)
+	require.Equal(t, content, download(t, s, "/"+again.Dir+"/more.txt").Body.String())
+}
+
+func TestDedupeInMemoryStorage(t *testing.T) {
+	s := newTestServer(t, Config{Dedupe: true, Storage: "memory"})
+	first := dedupeUpload(t, s, "a.txt", "same")
+	second := dedupeUpload(t, s, "b.txt", "same")
+	require.Equal(t, first.Blob, second.Blob)
+	require.NoError(t, s.deleteFile(first))
+	require.Equal(t, "same", download(t, s, "/"+second.Dir+"/b.txt").Body.String())
+}
+
+func TestDedupeSurvivesRestart(t *testing.T) {
+	s := newTestServer(t, Config{Dedupe: true})
+	first := dedupeUpload(t, s, "a.txt", "same")
+
+	restarted := newTestServer(t, Config{UploadDir: s.config.UploadDir, Dedupe: true})
+	second := dedupeUpload(t, restarted, "b.txt", "same")
+	require.Equal(t, first.Blob, second.Blob)
+}
+
+func TestWithoutDedupeUploadsAreCopies(t *testing.T) {
+	s := newTestServer(t, Config{})
+	first := dedupeUpload(t, s, "a.txt", "same")
+	second := dedupeUpload(t, s, "b.txt", "same")
+	require.Empty(t, first.Blob)
+	require.Empty(t, second.Blob)
+	require.Equal(t, int64(8), s.index.storedBytes())
+}
@@ -0,0 +1,85 @@
+package simpleserver
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// deleteTokenHeader carries the token that lets the uploader delete a
+	// file, in upload responses and in DELETE requests.
+	deleteTokenHeader = "X-Delete-Token"
+	// deleteTokensKey holds the delete tokens of the files a request stored,
+	// by key, until they are handed to the client.
+	deleteTokensKey = "simpleserver.deleteTokens"
+)
+
+// hashDeleteToken returns the hash of token kept in the metadata. Tokens are
+// random, so a plain SHA-256 is enough.
+func hashDeleteToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// rememberDeleteToken keeps the delete token of meta, stored by c, for the
+// response.
+func rememberDeleteToken(c echo.Context, meta FileMeta, token string) {
+	tokens, ok := c.Get(deleteTokensKey).(map[string]string)
+	if !ok {
+		tokens = make(map[string]string)
+		c.Set(deleteTokensKey, tokens)
+	}
+	tokens[meta.key()] = token
+}
+
+// deleteTokenOf returns the delete token of meta if it was stored by c.
+func deleteTokenOf(c echo.Context, meta FileMeta) string {
+	tokens, _ := c.Get(deleteTokensKey).(map[string]string)
+	return tokens[meta.key()]
+}
+
+// deleteURL returns the link that deletes meta with DELETE.
+func (s *Server) deleteURL(c echo.Context, meta FileMeta, token string) string {
+	return s.downloadURL(c, meta.Dir, meta.Name) + "?delete_token=" + url.QueryEscape(token)
+}
+
+// validDeleteToken reports whether token is the delete token of meta.
+func validDeleteToken(meta FileMeta, token string) bool {
+	if meta.DeleteTokenHash == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashDeleteToken(token)), []byte(meta.DeleteTokenHash)) == 1
+}
+
+// handleDelete deletes /<dir>/<name> for the client presenting its delete
+// token, in the X-Delete-Token header or the delete_token query parameter.
+// Without one, users may still delete the files in their own directory.
+func (s *Server) handleDelete(c echo.Context) error {
+	dir, name, err := downloadTarget(c.Request())
+	if err != nil {
+		return fail(c, http.StatusNotFound, "File not found")
+	}
+	token := c.Request().Header.Get(deleteTokenHeader)
+	if token == "" {
+		token = c.QueryParam("delete_token")
+	}
+	if token == "" && s.isUserDir(dir) {
+		return s.handleUserDelete(c)
+	}
+	meta, ok := s.index.get(dir, name)
+	if !ok {
+		return fail(c, http.StatusNotFound, "File not found")
+	}
+	if !validDeleteToken(meta, token) {
+		return fail(c, http.StatusForbidden, "Invalid delete token")
+	}
+	if err := s.deleteFileFor(c, meta); err != nil {
+		return deleteFailed(c, meta, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
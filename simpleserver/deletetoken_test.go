@@ -0,0 +1,59 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteWithToken(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("mine")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	token := rec.Header().Get(deleteTokenHeader)
+	require.NotEmpty(t, token)
+	require.Contains(t, rec.Body.String(), "delete_token="+token)
+	meta := findMeta(t, s, "notes.txt")
+	require.NotContains(t, meta.DeleteTokenHash, token)
+
+	target := "/" + meta.key()
+	require.Equal(t, http.StatusForbidden, serve(s, httptest.NewRequest(http.MethodDelete, target, nil)).Code)
+	req := httptest.NewRequest(http.MethodDelete, target, nil)
+	req.Header.Set(deleteTokenHeader, "wrong")
+	require.Equal(t, http.StatusForbidden, serve(s, req).Code)
+
+	req = httptest.NewRequest(http.MethodDelete, target, nil)
+	req.Header.Set(deleteTokenHeader, token)
+	require.Equal(t, http.StatusNoContent, serve(s, req).Code)
+	_, ok := s.index.get(meta.Dir, meta.Name)
+	require.False(t, ok)
+	require.Equal(t, http.StatusNotFound, serve(s, req).Code)
+}
+
+func TestDeleteURL(t *testing.T) {
+	s := newTestServer(t, Config{})
+	req := httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("mine"))
+	req.Header.Set("Accept", "application/json")
+	rec := serve(s, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var resp uploadResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, rec.Header().Get(deleteTokenHeader), resp.DeleteToken)
+
+	other := serve(s, httptest.NewRequest(http.MethodPut, "/other.txt", strings.NewReader("theirs")))
+	otherMeta := findMeta(t, s, "other.txt")
+	wrong := httptest.NewRequest(http.MethodDelete, "/"+otherMeta.key()+"?delete_token="+url.QueryEscape(resp.DeleteToken), nil)
+	require.Equal(t, http.StatusForbidden, serve(s, wrong).Code, "tokens only delete their own file")
+	require.NotEqual(t, resp.DeleteToken, other.Header().Get(deleteTokenHeader))
+
+	u, err := url.Parse(resp.DeleteURL)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, serve(s, httptest.NewRequest(http.MethodDelete, u.RequestURI(), nil)).Code)
+	_, ok := s.index.get(resp.ID, resp.Name)
+	require.False(t, ok)
+}
@@ -0,0 +1,222 @@
+package simpleserver
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	signaturePathSuffix = "signature"
+	// deltaMagic starts every delta, so a file posted by mistake is not
+	// taken for one.
+	deltaMagic = "rsd1"
+	// Delta operations: copy length bytes at offset of the stored file,
+	// insert length literal bytes that follow, or end the delta.
+	deltaCopy    = 'C'
+	deltaLiteral = 'L'
+	deltaEnd     = 'E'
+
+	minSignatureBlockSize = 512
+	maxSignatureBlockSize = 16 << 20
+	// maxSignatureBlocks bounds the size of a signature, larger files get
+	// larger blocks.
+	maxSignatureBlocks = 1 << 18
+	// strongSumSize is how much of the SHA-256 of a block a signature keeps,
+	// as rsync truncates its strong sums.
+	strongSumSize = 16
+)
+
+var (
+	errInvalidDelta  = errors.New("invalid delta, expected " + deltaMagic + " followed by copy and literal operations")
+	errDeltaNeedsTag = errors.New("a delta must carry If-Match with the ETag of the file it was computed against")
+)
+
+// blockSignature is the weak rolling checksum and the truncated SHA-256 of
+// one block of a file.
+type blockSignature struct {
+	Weak   uint32 `json:"weak"`
+	Strong string `json:"strong"`
+}
+
+// fileSignature lets a client holding a newer version of a file find the
+// blocks the server already has, as with rsync and librsync. Every block is
+// BlockSize bytes but the last.
+type fileSignature struct {
+	Size      int64            `json:"size"`
+	SHA256    string           `json:"sha256"`
+	BlockSize int              `json:"block_size"`
+	Blocks    []blockSignature `json:"blocks"`
+}
+
+// weakSum is the rolling checksum of rsync: a is the sum of the bytes and b
+// the sum of the running values of a, both modulo 2^16. Clients slide it
+// over their file a byte at a time to find blocks of the signature.
+func weakSum(block []byte) uint32 {
+	var a, b uint32
+	for i, c := range block {
+		a += uint32(c)
+		b += uint32(len(block)-i) * uint32(c)
+	}
+	return a&0xffff | b<<16
+}
+
+// signatureBlockSize picks the block size of the signature of a file of
+// size bytes: the one asked for, or about its square root as rsync does,
+// but never so small that the signature gets more than maxSignatureBlocks.
+func signatureBlockSize(size int64, requested int) int {
+	blockSize := requested
+	if blockSize == 0 {
+		blockSize = int(math.Sqrt(float64(size))) &^ 7
+	}
+	blockSize = max(blockSize, int((size+maxSignatureBlocks-1)/maxSignatureBlocks), minSignatureBlockSize)
+	return min(blockSize, maxSignatureBlockSize)
+}
+
+// signatureTarget reports whether name asks for the signature of a stored
+// file, as in /<dir>/<filename>/signature.
+func (s *Server) signatureTarget(dir, name string) (string, bool) {
+	return s.suffixTarget(dir, name, signaturePathSuffix)
+}
+
+// serveSignature answers GET /<dir>/<filename>/signature?block_size=<n>
+// with the signature of the file. Like the delta it prepares, it needs the
+// right to write into dir.
+func (s *Server) serveSignature(c echo.Context, dir, name string) error {
+	if !s.mayOverwrite(c, dir) {
+		return s.uploadError(c, errOverwriteForbidden)
+	}
+	meta, _ := s.index.get(dir, name)
+	if meta.expired(time.Now()) {
+		return fail(c, http.StatusGone, "File has expired")
+	}
+	var requested int
+	if value := c.QueryParam("block_size"); value != "" {
+		var err error
+		requested, err = strconv.Atoi(value)
+		if err != nil || requested < minSignatureBlockSize || requested > maxSignatureBlockSize {
+			return fail(c, http.StatusBadRequest, fmt.Sprintf("block_size must be between %d and %d", minSignatureBlockSize, maxSignatureBlockSize))
+		}
+	}
+	sig := fileSignature{Size: meta.Size, SHA256: meta.SHA256, BlockSize: signatureBlockSize(meta.Size, requested), Blocks: []blockSignature{}}
+	file := &davFile{s: s, ctx: c.Request().Context(), meta: meta}
+	defer file.Close()
+	block := make([]byte, sig.BlockSize)
+	for {
+		n, err := io.ReadFull(file, block)
+		if n > 0 {
+			strong := sha256.Sum256(block[:n])
+			sig.Blocks = append(sig.Blocks, blockSignature{Weak: weakSum(block[:n]), Strong: hex.EncodeToString(strong[:strongSumSize])})
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return s.uploadError(c, err)
+		}
+	}
+	c.Response().Header().Set("ETag", `"`+meta.SHA256+`"`)
+	return c.JSON(http.StatusOK, sig)
+}
+
+// handleDelta answers POST /<dir>/<filename>/delta by rebuilding the file
+// from the blocks it already holds and the literal bytes of the delta in
+// the body, so updating a large file only sends what changed. The delta is
+// deltaMagic followed by operations:
+//
+//	'C' <offset uint64> <length uint32>   copy bytes of the stored file
+//	'L' <length uint32> <bytes>           insert bytes
+//	'E'                                   end
+//
+// with integers in big endian. If-Match must name the version the delta was
+// computed against.
+func (s *Server) handleDelta(c echo.Context, dir, name string) error {
+	if c.Request().Header.Get("If-Match") == "" {
+		return s.uploadError(c, errDeltaNeedsTag)
+	}
+	release, err := s.claimFile(c, dir, name)
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	defer release()
+	current, exists := s.index.get(dir, name)
+	if err := checkPreconditions(c.Request(), current, exists); err != nil {
+		return s.uploadError(c, err)
+	}
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		basis := &davFile{s: s, ctx: c.Request().Context(), meta: current}
+		defer basis.Close()
+		pw.CloseWithError(applyDelta(pw, basis, bufio.NewReader(c.Request().Body)))
+	}()
+	// The body may only be read while the request is being handled.
+	defer func() {
+		pr.Close()
+		<-done
+	}()
+	limit := int64(s.maxSize()) << 20
+	meta, err := s.replaceFile(c, dir, name, current, exists, &maxBytesReader{r: pr, n: limit})
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	return s.uploaded(c, meta)
+}
+
+// applyDelta writes the file delta describes to w, copying from basis.
+func applyDelta(w io.Writer, basis *davFile, delta *bufio.Reader) error {
+	magic := make([]byte, len(deltaMagic))
+	if _, err := io.ReadFull(delta, magic); err != nil || string(magic) != deltaMagic {
+		return errInvalidDelta
+	}
+	for {
+		op, err := delta.ReadByte()
+		if err != nil {
+			return errInvalidDelta
+		}
+		switch op {
+		case deltaCopy:
+			var args struct {
+				Offset uint64
+				Length uint32
+			}
+			if err := binary.Read(delta, binary.BigEndian, &args); err != nil {
+				return errInvalidDelta
+			}
+			if args.Offset > uint64(basis.meta.Size) || uint64(args.Length) > uint64(basis.meta.Size)-args.Offset {
+				return errInvalidDelta
+			}
+			if _, err := basis.Seek(int64(args.Offset), io.SeekStart); err != nil {
+				return err
+			}
+			if _, err := io.CopyN(w, basis, int64(args.Length)); err != nil {
+				return err
+			}
+		case deltaLiteral:
+			var length uint32
+			if err := binary.Read(delta, binary.BigEndian, &length); err != nil {
+				return errInvalidDelta
+			}
+			if _, err := io.CopyN(w, delta, int64(length)); errors.Is(err, io.EOF) {
+				return errInvalidDelta
+			} else if err != nil {
+				return err
+			}
+		case deltaEnd:
+			return nil
+		default:
+			return errInvalidDelta
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package simpleserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// computeDelta is the client side of a delta update: it slides the rolling
+// checksum over content, copying the blocks the signature matches.
+func computeDelta(sig fileSignature, content []byte) []byte {
+	blocks := make(map[uint32][]int)
+	for i, block := range sig.Blocks {
+		blocks[block.Weak] = append(blocks[block.Weak], i)
+	}
+	var delta, literal bytes.Buffer
+	delta.WriteString(deltaMagic)
+	flush := func() {
+		if literal.Len() > 0 {
+			delta.WriteByte(deltaLiteral)
+			binary.Write(&delta, binary.BigEndian, uint32(literal.Len()))
+			delta.Write(literal.Bytes())
+			literal.Reset()
+		}
+	}
+	n := sig.BlockSize
+	var a, b uint32
+	rolled := false
+	for pos := 0; pos < len(content); {
+		end := min(pos+n, len(content))
+		if !rolled {
+			sum := weakSum(content[pos:end])
+			a, b = sum&0xffff, sum>>16
+		}
+		match := -1
+		for _, i := range blocks[a&0xffff|b<<16] {
+			strong := sha256.Sum256(content[pos:end])
+			length := min(n, int(sig.Size)-i*n)
+			if length == end-pos && sig.Blocks[i].Strong == hex.EncodeToString(strong[:strongSumSize]) {
+				match = i
+				break
+			}
+		}
+		if match >= 0 {
+			flush()
+			delta.WriteByte(deltaCopy)
+			binary.Write(&delta, binary.BigEndian, uint64(match*n))
+			binary.Write(&delta, binary.BigEndian, uint32(end-pos))
+			pos, rolled = end, false
+			continue
+		}
+		literal.WriteByte(content[pos])
+		if end-pos < n || end == len(content) {
+			// Past the last full window the sums are computed afresh.
+			pos, rolled = pos+1, false
+			continue
+		}
+		out, in := uint32(content[pos]), uint32(content[end])
+		a = (a - out + in) & 0xffff
+		b = (b - uint32(n)*out + a) & 0xffff
+		pos, rolled = pos+1, true
+	}
+	flush()
+	delta.WriteByte(deltaEnd)
+	return delta.Bytes()
+}
+
+func fetchSignature(t *testing.T, s *Server, target string) fileSignature {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target+"/"+signaturePathSuffix+"?block_size=1024", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := serve(s, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var sig fileSignature
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &sig))
+	return sig
+}
+
+func postDelta(s *Server, target string, delta []byte, etag string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target+"/delta", bytes.NewReader(delta))
+	req.Header.Set("Authorization", "Bearer secret")
+	if etag != "" {
+		req.Header.Set("If-Match", etag)
+	}
+	return serve(s, req)
+}
+
+func TestDeltaUpdate(t *testing.T) {
+	s := newTestServer(t, Config{AuthToken: "secret"})
+	old := make([]byte, 64<<10)
+	rand.New(rand.NewSource(1)).Read(old)
+	rec := conditionalPut(s, "/images/disk.img", string(old), map[string]string{"If-None-Match": "*"})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	sig := fetchSignature(t, s, "/images/disk.img")
+	require.Equal(t, 1024, sig.BlockSize)
+	require.Len(t, sig.Blocks, 64)
+	require.Equal(t, sha256Hex(string(old)), sig.SHA256)
+
+	// Bytes inserted and changed in the middle shift every block after
+	// them, which the rolling checksum still finds.
+	updated := append([]byte{}, old[:20000]...)
+	updated = append(updated, "inserted"...)
+	updated = append(updated, old[20000:40000]...)
+	updated = append(updated, bytes.Repeat([]byte{'x'}, 100)...)
+	updated = append(updated, old[40100:]...)
+	delta := computeDelta(sig, updated)
+	require.Less(t, len(delta), 4<<10)
+
+	rec = postDelta(s, "/images/disk.img", delta, "")
+	require.Equal(t, http.StatusPreconditionRequired, rec.Code)
+	rec = postDelta(s, "/images/disk.img", delta, `"`+sha256Hex("other")+`"`)
+	require.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+	rec = postDelta(s, "/images/disk.img", delta, `"`+sig.SHA256+`"`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	require.Equal(t, sha256Hex(string(updated)), rec.Header().Get(checksumHeader))
+	rec = download(t, s, "/images/disk.img")
+	require.Equal(t, string(updated), rec.Body.String())
+	require.Len(t, s.index.inDir("images"), 1)
+}
+
+func TestDeltaRejectsInvalidDeltas(t *testing.T) {
+	s := newTestServer(t, Config{AuthToken: "secret"})
+	rec := conditionalPut(s, "/docs/notes.txt", "original", map[string]string{"If-None-Match": "*"})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	etag := `"` + sha256Hex("original") + `"`
+
+	beyond := []byte(deltaMagic + "C")
+	beyond = binary.BigEndian.AppendUint64(beyond, 4)
+	beyond = binary.BigEndian.AppendUint32(beyond, 5)
+	for _, delta := range [][]byte{[]byte("original"), []byte(deltaMagic + "L\x00\x00\x00\x09short"), append(beyond, deltaEnd), []byte(deltaMagic)} {
+		rec = postDelta(s, "/docs/notes.txt", delta, etag)
+		require.Equal(t, http.StatusBadRequest, rec.Code, string(delta))
+	}
+	rec = download(t, s, "/docs/notes.txt")
+	require.Equal(t, "original", rec.Body.String())
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, "/docs/notes.txt/"+signaturePathSuffix, nil))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+}
@@ -0,0 +1,317 @@
+package simpleserver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+var errEncodedSeparator = errors.New("encoded path separator in download path")
+
+// downloadTarget decodes the share dir and file path of a download request.
+// It works on the escaped path rather than echo's params because echo keeps
+// params escaped whenever the URL needs a RawPath, e.g. when it contains %2F.
+// Each segment is decoded exactly once, and a segment that decodes to a path
+// separator is rejected instead of being silently turned into a nested path.
+func downloadTarget(r *http.Request) (dir, name string, err error) {
+	return parseTarget(strings.TrimPrefix(r.URL.EscapedPath(), "/"))
+}
+
+// parseTarget decodes an escaped "<dir>/<name>" path.
+func parseTarget(escaped string) (dir, name string, err error) {
+	segments := strings.Split(escaped, "/")
+	if len(segments) < 2 {
+		return "", "", errUnsafePath
+	}
+	for i, segment := range segments {
+		decoded, err := url.PathUnescape(segment)
+		if err != nil {
+			return "", "", errUnsafePath
+		}
+		if strings.ContainsAny(decoded, "/\\") {
+			return "", "", errEncodedSeparator
+		}
+		segments[i] = decoded
+	}
+	if !isShareDir(segments[0]) {
+		return "", "", errUnsafePath
+	}
+	name, err = cleanRelativePath(strings.Join(segments[1:], "/"))
+	if err != nil {
+		return "", "", err
+	}
+	return segments[0], name, nil
+}
+
+func (s *Server) handleDownload(c echo.Context) error {
+	dir, name, err := downloadTarget(c.Request())
+	if errors.Is(err, errEncodedSeparator) {
+		return fail(c, http.StatusBadRequest, "Encoded path separators are not allowed in file names")
+	}
+	if err != nil || s.batches.isStaged(metaKey(dir, name)) {
+		return s.fileNotFound(c)
+	}
+	if signed, valid := s.signedDownload(c, dir, name); signed && !valid {
+		return fail(c, http.StatusForbidden, "Invalid or expired signature")
+	}
+	if meta, ok := s.shareFile(dir, name); ok && !s.mayDownload(c, meta) {
+		return s.restrictedDownload(c)
+	}
+	if target, ok := s.qrTarget(dir, name); ok {
+		return s.serveQR(c, dir, target)
+	}
+	if target, ok := s.thumbTarget(dir, name); ok {
+		return s.serveThumb(c, dir, target)
+	}
+	if target, ok := s.previewTarget(dir, name); ok {
+		return s.servePreview(c, dir, target)
+	}
+	if target, ok := s.rawTarget(dir, name); ok {
+		return s.serveFile(c, dir, target)
+	}
+	if target, ok := s.signatureTarget(dir, name); ok {
+		return s.serveSignature(c, dir, target)
+	}
+	if meta, ok := s.index.get(dir, name); ok && !s.config.NoSharePage {
+		// The same link serves browsers the share page and other clients
+		// the file.
+		c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+		if s.wantsSharePage(c, meta) {
+			return s.serveSharePage(c, meta)
+		}
+	}
+	if meta, ok := s.index.get(dir, name); ok && meta.Paste && previewable(meta) && c.Request().Method == http.MethodGet {
+		return s.servePreview(c, dir, name)
+	}
+	return s.serveFile(c, dir, name)
+}
+
+// suffixTarget reports whether name is a stored file followed by /suffix,
+// as in /<dir>/<filename>/qr, and returns that file. A file actually stored
+// under name wins.
+func (s *Server) suffixTarget(dir, name, suffix string) (string, bool) {
+	if path.Base(name) != suffix || name == suffix {
+		return "", false
+	}
+	if _, ok := s.index.get(dir, name); ok {
+		return "", false
+	}
+	target := path.Dir(name)
+	_, ok := s.index.get(dir, target)
+	return target, ok
+}
+
+// openFile opens the stored object of dir/name, from the download cache when
+// it holds it. meta is its entry if known.
+func (s *Server) openFile(c echo.Context, dir, name string, meta FileMeta, known bool) (*Object, error) {
+	ctx := c.Request().Context()
+	if known {
+		if obj, ok := s.cache.get(meta); ok {
+			c.Response().Header().Set(cacheHeader, "HIT")
+			return obj, nil
+		}
+	}
+	start := time.Now()
+	obj, err := s.storage.Get(ctx, metaKey(dir, name))
+	recordStorageLatency(ctx, start)
+	if errors.Is(err, fs.ErrNotExist) && known && len(s.config.Peers) > 0 {
+		obj, err = s.getFromPeers(ctx, meta)
+	}
+	if err != nil || s.cache == nil {
+		return obj, err
+	}
+	c.Response().Header().Set(cacheHeader, "MISS")
+	if !known || c.Request().Method == http.MethodHead {
+		return obj, nil
+	}
+	return s.cache.fill(meta, obj)
+}
+
+// serveFile answers a download of the stored file dir/name.
+func (s *Server) serveFile(c echo.Context, dir, name string) error {
+	if s.hiddenDropShare(c, dir) {
+		return s.fileNotFound(c)
+	}
+	// The index is consulted before the backend: a download once file is
+	// removed from the backend first, so it can never be found there once
+	// its metadata is gone.
+	ctx, span := s.tracer.Start(c.Request().Context(), "download")
+	defer span.End()
+	c.SetRequest(c.Request().WithContext(ctx))
+	s.refreshFile(dir, name)
+	meta, ok := s.index.get(dir, name)
+	obj, err := s.openFile(c, dir, name, meta, ok)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s.fileNotFound(c)
+	}
+	if err != nil {
+		log.Printf("Failed to open %s/%s: %v\n", dir, name, err)
+		return fail(c, http.StatusInternalServerError, "Failed to read file")
+	}
+	defer obj.Content.Close()
+
+	if ok && meta.exhausted() {
+		return failWith(c, http.StatusGone, codeDownloadLimit, "Download limit reached")
+	}
+	if ok && meta.expired(time.Now()) {
+		return fail(c, http.StatusGone, "File has expired")
+	}
+	if ok && meta.Pending {
+		return s.tooEarly(c, meta)
+	}
+	if !ok {
+		meta = FileMeta{Dir: dir, Name: name, Size: obj.Size, CreatedAt: obj.ModTime}
+	}
+	noteFile(c, meta)
+	span.SetAttributes(fileAttributes(meta)...)
+	if meta.PasswordHash != "" && !checkPassword(c, meta) {
+		return passwordRequired(c, meta)
+	}
+	if err := s.checkHooks(ctx, beforeDownload, meta); err != nil {
+		return fail(c, http.StatusForbidden, err.Error())
+	}
+	head := c.Request().Method == http.MethodHead
+	// Counting the download would change the store.
+	if (meta.Once || meta.MaxDownloads > 0) && !head && s.readOnly.Load() {
+		return readOnlyRefused(c)
+	}
+	if meta.Once && !head {
+		if !s.claimOnce(meta.key()) {
+			return failWith(c, http.StatusGone, codeAlreadyDownloaded, "File is already being downloaded")
+		}
+		defer s.releaseOnce(meta.key())
+		if _, ok := s.index.get(dir, name); !ok {
+			return s.fileNotFound(c)
+		}
+	}
+	limited := meta.MaxDownloads > 0
+	if limited && !head {
+		remaining, ok := s.index.reserveDownload(meta.key())
+		if !ok {
+			return failWith(c, http.StatusGone, codeDownloadLimit, "Download limit reached")
+		}
+		defer s.index.releaseDownload(meta.key())
+		c.Response().Header().Set(downloadsRemainingHeader, strconv.FormatInt(remaining, 10))
+	} else if limited {
+		c.Response().Header().Set(downloadsRemainingHeader, strconv.FormatInt(meta.MaxDownloads-meta.Downloads, 10))
+	}
+	// Backends that cannot seek answer ranged requests with the full content
+	// rather than risk serving the wrong bytes. Download once and limited
+	// files are always sent whole, a partial download must not use them up.
+	content, seekable := obj.Content.(io.ReadSeeker)
+	seekable = seekable && s.storage.Seekable(meta) && !meta.Once && !limited
+	if seekable && s.tooManyRanges(c.Request()) {
+		return rangeNotSatisfiable(c, meta.Size)
+	}
+	setContentHeaders(c, meta)
+	setChecksumHeaders(c, meta)
+	s.setCacheHeaders(c, meta)
+	if !seekable && notModified(c.Request(), meta) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	if variant, encoding := s.openVariant(c, meta); variant != nil {
+		if notModified(c.Request(), meta) {
+			variant.Close()
+			return c.NoContent(http.StatusNotModified)
+		}
+		err = serveVariant(c, variant, encoding)
+	} else if seekable {
+		c.Response().Header().Set("Accept-Ranges", "bytes")
+		http.ServeContent(sendfileResponse{c.Response()}, c.Request(), path.Base(name), meta.CreatedAt, content)
+	} else {
+		err = s.serveWhole(c, obj.Content, meta)
+	}
+	if err != nil {
+		return err
+	}
+	if status := c.Response().Status; !head && (status == http.StatusOK || status == http.StatusPartialContent) {
+		s.notifyDownload(DownloadEvent{
+			Event:    "download",
+			Dir:      dir,
+			Filename: name,
+			Bytes:    c.Response().Size,
+			ClientIP: c.RealIP(),
+			Ranged:   status == http.StatusPartialContent,
+			Time:     time.Now().UTC(),
+		})
+		s.runHooks(ctx, afterDownload, meta)
+		if err := s.index.addServed(dir, name, c.Response().Size); err != nil {
+			log.Printf("Failed to record download of %s/%s: %v\n", dir, name, err)
+		}
+		s.publishEvent(Event{
+			Type:     EventDownload,
+			Dir:      dir,
+			Filename: name,
+			Size:     meta.Size,
+			Bytes:    c.Response().Size,
+			ClientIP: c.RealIP(),
+			Identity: requestIdentity(c),
+		})
+		if meta.Once && c.Response().Size == meta.Size {
+			if err := s.deleteFile(meta); err != nil {
+				log.Printf("Failed to delete download once file %s/%s: %v\n", dir, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// setContentHeaders declares the recorded type of meta and asks browsers to
+// save it rather than render it. ?inline=true displays the file in the
+// browser instead, except for types that can run scripts in the server's
+// origin. Pastes are always shown inline as plain text.
+func setContentHeaders(c echo.Context, meta FileMeta) {
+	header := c.Response().Header()
+	contentType := meta.contentType()
+	if meta.Paste {
+		contentType = echo.MIMETextPlainCharsetUTF8
+	}
+	header.Set(echo.HeaderContentType, contentType)
+	header.Set(echo.HeaderXContentTypeOptions, "nosniff")
+	disposition := "attachment"
+	if inline, _ := strconv.ParseBool(c.QueryParam("inline")); meta.Paste || inline && !activeContentType(contentType) {
+		disposition = "inline"
+	}
+	header.Set(echo.HeaderContentDisposition, contentDisposition(disposition, meta.displayName()))
+}
+
+// activeContentType reports whether browsers may execute scripts embedded in
+// content of this type.
+func activeContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return true
+	}
+	switch mediaType {
+	case "text/html", "application/xhtml+xml", "image/svg+xml", "text/xml", "application/xml",
+		"text/javascript", "application/javascript":
+		return true
+	}
+	return false
+}
+
+// contentDisposition formats a Content-Disposition header, adding the RFC 6266
+// filename* parameter when the name is not plain ASCII.
+func contentDisposition(dispositionType, filename string) string {
+	ascii := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, filename)
+	if ascii == filename {
+		return fmt.Sprintf(`%s; filename="%s"`, dispositionType, filename)
+	}
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, dispositionType, ascii, url.PathEscape(filename))
+}
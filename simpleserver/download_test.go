@@ -0,0 +1,98 @@
+package simpleserver
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadRejectsEncodedSlash(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("notes")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	dir := shareDirs(t, s)[0]
+
+	for _, target := range []string{
+		"/" + dir + "/..%2Fnotes.txt",
+		"/" + dir + "/sub%2Fnotes.txt",
+		"/" + dir + "/sub%5Cnotes.txt",
+		"/" + dir + "/%2e%2e%2F%2e%2e%2Fetc%2Fpasswd",
+	} {
+		rec := serve(s, httptest.NewRequest(http.MethodGet, target, nil))
+		require.Equal(t, http.StatusBadRequest, rec.Code, target)
+	}
+}
+
+func TestDownloadEncodedSpace(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/my%20report.txt", strings.NewReader("quarterly")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	urls := downloadURLs(t, rec.Body.String())
+	require.True(t, strings.HasSuffix(urls[0], "/my%20report.txt"))
+
+	rec = download(t, s, urls[0])
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "quarterly", rec.Body.String())
+
+	// Other legitimately encoded characters decode as usual, even when the
+	// URL is forced to carry a RawPath.
+	dir := shareDirs(t, s)[0]
+	rec = serve(s, httptest.NewRequest(http.MethodGet, "/"+dir+"/my%20r%65port.txt", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "quarterly", rec.Body.String())
+}
+
+func TestDownloadRejectsMetadataDir(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("notes")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	dir := shareDirs(t, s)[0]
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, "/"+metaDirName+"/"+dir+"/notes.txt.json", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestDownloadContentType(t *testing.T) {
+	s := newTestServer(t, Config{})
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 64)...)
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/photo.txt", bytes.NewReader(png)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	meta := findMeta(t, s, "photo.txt")
+	require.Equal(t, "image/png", meta.ContentType)
+
+	rec = download(t, s, downloadURLs(t, rec.Body.String())[0])
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+	require.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"))
+	require.Equal(t, `attachment; filename="photo.txt"`, rec.Header().Get("Content-Disposition"))
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, "/"+meta.Dir+"/photo.txt?inline=true", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, `inline; filename="photo.txt"`, rec.Header().Get("Content-Disposition"))
+}
+
+func TestHTMLIsNeverInline(t *testing.T) {
+	s := newTestServer(t, Config{CompressAtRest: true})
+	page := "<html><script>alert(document.cookie)</script></html>"
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader(page)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	meta := findMeta(t, s, "notes.txt")
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, "/"+meta.Dir+"/notes.txt?inline=true", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, page, rec.Body.String())
+	require.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	require.Equal(t, `attachment; filename="notes.txt"`, rec.Header().Get("Content-Disposition"))
+}
+
+func TestDetectContentType(t *testing.T) {
+	require.Equal(t, "text/css; charset=utf-8", detectContentType("site.css", []byte("body { color: red }")))
+	require.Equal(t, "application/pdf", detectContentType("report.txt", []byte("%PDF-1.4")))
+	require.Equal(t, "text/plain; charset=utf-8", detectContentType("photo.png", []byte("plain words")))
+	require.Equal(t, "application/octet-stream", detectContentType("blob", []byte{0, 1, 2}))
+	require.Equal(t, "image/png", detectContentType("photo.png", nil))
+}
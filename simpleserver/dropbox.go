@@ -0,0 +1,321 @@
+package simpleserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const dropSharesPath = "/shares"
+
+// dropSharesFileName stores the drop shares inside the metadata dir.
+const dropSharesFileName = ".shares.json"
+
+var (
+	errDropShareExpired = errors.New("share has expired")
+	errDropShareFull    = errors.New("share has no uploads left")
+)
+
+// DropShare is an upload directory created by an admin for others to upload
+// into. Anyone holding Token may add files to it, but only admins can list
+// or download them. Zero limits mean unlimited.
+type DropShare struct {
+	ID    string `json:"id"`
+	Token string `json:"token"`
+	// MaxFiles is the number of files the share accepts.
+	MaxFiles int `json:"max_files,omitempty"`
+	// MaxSize is the largest accepted upload in MB.
+	MaxSize   int        `json:"max_size,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func (d DropShare) expired(now time.Time) bool {
+	return d.ExpiresAt != nil && !now.Before(*d.ExpiresAt)
+}
+
+// dropShares holds the drop shares, persisted as JSON in the metadata dir.
+// inflight holds the names of uploads in progress per share, so concurrent
+// uploads can neither overshoot MaxFiles nor pick the same name.
+type dropShares struct {
+	path     string
+	mu       sync.Mutex
+	shares   map[string]DropShare
+	inflight map[string]map[string]struct{}
+}
+
+func newDropShares(uploadDir string) *dropShares {
+	return &dropShares{
+		path:     filepath.Join(uploadDir, metaDirName, dropSharesFileName),
+		shares:   make(map[string]DropShare),
+		inflight: make(map[string]map[string]struct{}),
+	}
+}
+
+func (d *dropShares) load() error {
+	content, err := os.ReadFile(d.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	shares := make(map[string]DropShare)
+	if err := json.Unmarshal(content, &shares); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", d.path, err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.shares = shares
+	return nil
+}
+
+// save writes the shares, including their tokens, readable by the owner
+// only. The caller holds d.mu.
+func (d *dropShares) save() error {
+	content, err := json.Marshal(d.shares)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(d.path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(d.path, content, 0600)
+}
+
+func (d *dropShares) add(share DropShare) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.shares[share.ID] = share
+	if err := d.save(); err != nil {
+		delete(d.shares, share.ID)
+		return err
+	}
+	return nil
+}
+
+func (d *dropShares) get(id string) (DropShare, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	share, ok := d.shares[id]
+	return share, ok
+}
+
+// has reports whether dir belongs to a drop share.
+func (d *dropShares) has(dir string) bool {
+	_, ok := d.get(dir)
+	return ok
+}
+
+// reserve claims a file name in share for one upload. name is kept when it
+// is free, otherwise a number is added before the extension, so uploaders
+// cannot replace each other's files. The returned release must be called
+// once the upload is stored or failed.
+func (d *dropShares) reserve(share DropShare, name string, index *metaIndex) (reserved string, release func(), err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	inflight := d.inflight[share.ID]
+	if share.MaxFiles > 0 && len(index.inDir(share.ID))+len(inflight) >= share.MaxFiles {
+		return "", nil, errDropShareFull
+	}
+	taken := func(candidate string) bool {
+		_, stored := index.get(share.ID, candidate)
+		_, uploading := inflight[candidate]
+		return stored || uploading
+	}
+	reserved = name
+	ext := path.Ext(name)
+	for i := 2; taken(reserved); i++ {
+		reserved = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	if inflight == nil {
+		inflight = make(map[string]struct{})
+		d.inflight[share.ID] = inflight
+	}
+	inflight[reserved] = struct{}{}
+	release = func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		delete(d.inflight[share.ID], reserved)
+		if len(d.inflight[share.ID]) == 0 {
+			delete(d.inflight, share.ID)
+		}
+	}
+	return reserved, release, nil
+}
+
+// claimedByDropShare reports whether dir is taken by a drop share, even an
+// empty one, so random and custom slugs never land in it.
+func (s *Server) claimedByDropShare(dir string) bool {
+	return s.drops != nil && s.drops.has(dir)
+}
+
+// hiddenDropShare reports whether dir/... must not be served to c: files of
+// drop shares are only readable with the admin token.
+func (s *Server) hiddenDropShare(c echo.Context, dir string) bool {
+	return s.claimedByDropShare(dir) && !validBearer(c.Request(), s.settings().AdminToken)
+}
+
+type createDropShareRequest struct {
+	MaxFiles  int    `json:"max_files"`
+	MaxSize   int    `json:"max_size"`
+	ExpiresIn string `json:"expires_in"`
+}
+
+type dropShareResponse struct {
+	DropShare
+	UploadURL string `json:"upload_url"`
+}
+
+type dropShareListing struct {
+	DropShare
+	Files []listedFile `json:"files"`
+}
+
+// registerDropShareRoutes serves drop shares. They are created and read with
+// the admin token, so they only exist when one is set at startup.
+func (s *Server) registerDropShareRoutes(e *echo.Echo) {
+	if s.config.AdminToken == "" {
+		return
+	}
+	e.POST(dropSharesPath, s.handleCreateDropShare, s.requireAdmin, s.rejectInMaintenance)
+	e.GET(dropSharesPath+"/:id", s.handleDropShareListing, s.requireAdmin)
+	e.GET(dropSharesPath+"/:id/*", s.handleDropShareDownload, s.requireAdmin)
+	e.PUT(dropSharesPath+"/:id/*", s.handleDropShareUpload, s.rejectInMaintenance, s.limitUploadsPerUser, s.queueUploads)
+}
+
+// handleCreateDropShare creates a drop share with its own upload token. The
+// optional body sets max_files, max_size in MB and expires_in as a
+// duration such as "72h".
+func (s *Server) handleCreateDropShare(c echo.Context) error {
+	var req createDropShareRequest
+	if c.Request().ContentLength != 0 {
+		if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+			return fail(c, http.StatusBadRequest, "Invalid JSON body")
+		}
+	}
+	if req.MaxFiles < 0 || req.MaxSize < 0 {
+		return fail(c, http.StatusBadRequest, "max_files and max_size must not be negative")
+	}
+	share := DropShare{ID: s.newShareDir(), MaxFiles: req.MaxFiles, MaxSize: req.MaxSize, CreatedAt: time.Now().UTC()}
+	if req.ExpiresIn != "" {
+		ttl, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || ttl <= 0 {
+			return fail(c, http.StatusBadRequest, "expires_in must be a positive duration such as 72h")
+		}
+		expires := share.CreatedAt.Add(ttl)
+		share.ExpiresAt = &expires
+	}
+	token, err := newDropShareToken()
+	if err != nil {
+		return err
+	}
+	share.Token = token
+	if err := s.drops.add(share); err != nil {
+		log.Printf("Failed to save drop share %s: %v\n", share.ID, err)
+		return fail(c, http.StatusInternalServerError, "Failed to create share")
+	}
+	return c.JSON(http.StatusCreated, dropShareResponse{DropShare: share, UploadURL: s.dropShareURL(c, share.ID, "")})
+}
+
+func newDropShareToken() (string, error) {
+	token := make([]byte, 24)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+func (s *Server) dropShareURL(c echo.Context, id, name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return fmt.Sprintf("%s%s/%s/%s", s.baseURL(c), dropSharesPath, id, strings.Join(segments, "/"))
+}
+
+// handleDropShareUpload stores a file sent with PUT /shares/<id>/<filename>.
+// The share's token is presented as a bearer token. The answer names the
+// stored file but carries no link, uploaders cannot read the share.
+func (s *Server) handleDropShareUpload(c echo.Context) error {
+	share, ok := s.drops.get(c.Param("id"))
+	if !ok {
+		return fail(c, http.StatusNotFound, "Share not found")
+	}
+	if !validBearer(c.Request(), share.Token) {
+		return authUnauthorized(c)
+	}
+	if share.expired(time.Now()) {
+		return fail(c, http.StatusGone, errDropShareExpired.Error())
+	}
+	filename, err := s.uploadFilename(strings.TrimPrefix(c.Request().URL.Path, dropSharesPath+"/"+share.ID+"/"))
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	filename, release, err := s.drops.reserve(share, filename, s.index)
+	if err != nil {
+		return fail(c, http.StatusConflict, err.Error())
+	}
+	defer release()
+
+	limit := int64(s.maxSize()) << 20
+	if share.MaxSize > 0 {
+		limit = min(limit, int64(share.MaxSize)<<20)
+	}
+	if size := c.Request().ContentLength; size > limit {
+		return s.uploadError(c, &sizeLimitError{limit: limit, over: size - limit})
+	}
+	meta, err := s.saveUpload(c, share.ID, filename, &maxBytesReader{r: c.Request().Body, n: limit})
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	c.Response().Header().Set(checksumHeader, meta.SHA256)
+	if s.wantsJSON(c) {
+		return c.JSON(http.StatusCreated, map[string]any{"name": meta.Name, "size": meta.Size, "sha256": meta.SHA256})
+	}
+	return c.String(http.StatusCreated, fmt.Sprintf("File uploaded successfully as %s\nSHA-256: %s\n", meta.Name, meta.SHA256))
+}
+
+// handleDropShareListing lists a drop share and the files uploaded to it.
+func (s *Server) handleDropShareListing(c echo.Context) error {
+	share, ok := s.drops.get(c.Param("id"))
+	if !ok {
+		return fail(c, http.StatusNotFound, "Share not found")
+	}
+	listing := dropShareListing{DropShare: share, Files: []listedFile{}}
+	for _, meta := range s.index.inDir(share.ID) {
+		if meta.Pending {
+			continue
+		}
+		listing.Files = append(listing.Files, listedFile{
+			Name:      meta.Name,
+			URL:       s.dropShareURL(c, meta.Dir, meta.Name),
+			Size:      meta.Size,
+			SHA256:    meta.SHA256,
+			CreatedAt: meta.CreatedAt,
+		})
+	}
+	return c.JSON(http.StatusOK, listing)
+}
+
+func (s *Server) handleDropShareDownload(c echo.Context) error {
+	id, name, err := parseTarget(strings.TrimPrefix(c.Request().URL.EscapedPath(), dropSharesPath+"/"))
+	if err != nil || !s.drops.has(id) {
+		return fail(c, http.StatusNotFound, "File not found")
+	}
+	return s.serveFile(c, id, name)
+}
@@ -0,0 +1,101 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func createDropShare(t *testing.T, s *Server, body string) dropShareResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/shares", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer admin")
+	rec := serve(s, req)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var share dropShareResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &share))
+	return share
+}
+
+func dropUpload(s *Server, id, token, name, content string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/shares/"+id+"/"+name, strings.NewReader(content))
+	req.Header.Set("Authorization", "Bearer "+token)
+	return serve(s, req)
+}
+
+func TestDropShareAcceptsUploadsOnlyAdminsCanRead(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: "admin", AuthToken: "secret"})
+
+	req := httptest.NewRequest(http.MethodPost, "/shares", nil)
+	require.Equal(t, http.StatusUnauthorized, serve(s, req).Code)
+
+	share := createDropShare(t, s, "")
+	require.NotEmpty(t, share.Token)
+	require.Equal(t, "http://example.com/shares/"+share.ID+"/", share.UploadURL)
+
+	require.Equal(t, http.StatusUnauthorized, dropUpload(s, share.ID, "secret", "report.pdf", "first").Code)
+	require.Equal(t, http.StatusNotFound, dropUpload(s, "missing", share.Token, "report.pdf", "first").Code)
+	rec := dropUpload(s, share.ID, share.Token, "report.pdf", "first")
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	require.NotContains(t, rec.Body.String(), "http")
+	rec = dropUpload(s, share.ID, share.Token, "report.pdf", "second")
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Contains(t, rec.Body.String(), "report (2).pdf", "uploads never replace each other")
+
+	// Neither the share token nor the regular auth token can read the share.
+	for _, token := range []string{share.Token, "secret"} {
+		req := httptest.NewRequest(http.MethodGet, "/"+share.ID+"/report.pdf", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		require.Equal(t, http.StatusNotFound, serve(s, req).Code)
+		req = httptest.NewRequest(http.MethodGet, "/"+share.ID, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		require.NotEqual(t, http.StatusOK, serve(s, req).Code)
+		req = httptest.NewRequest(http.MethodGet, "/shares/"+share.ID, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		require.Equal(t, http.StatusUnauthorized, serve(s, req).Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/shares/"+share.ID, nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	rec = serve(s, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var listing dropShareListing
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &listing))
+	require.Len(t, listing.Files, 2)
+
+	req = httptest.NewRequest(http.MethodGet, "/shares/"+share.ID+"/report%20%282%29.pdf", nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	rec = serve(s, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "second", rec.Body.String())
+
+	// Shares survive a restart.
+	restarted := newTestServer(t, Config{AdminToken: "admin", UploadDir: s.config.UploadDir})
+	require.Equal(t, http.StatusCreated, dropUpload(restarted, share.ID, share.Token, "notes.txt", "third").Code)
+}
+
+func TestDropShareLimits(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: "admin"})
+
+	share := createDropShare(t, s, `{"max_files": 1, "max_size": 1}`)
+	rec := dropUpload(s, share.ID, share.Token, "big.bin", strings.Repeat("x", 1<<20+1))
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	require.Equal(t, http.StatusCreated, dropUpload(s, share.ID, share.Token, "a.txt", "a").Code)
+	require.Equal(t, http.StatusConflict, dropUpload(s, share.ID, share.Token, "b.txt", "b").Code)
+
+	share = createDropShare(t, s, `{"expires_in": "1h"}`)
+	require.Equal(t, http.StatusCreated, dropUpload(s, share.ID, share.Token, "a.txt", "a").Code)
+	expired := time.Now().Add(-time.Minute)
+	share.ExpiresAt = &expired
+	require.NoError(t, s.drops.add(share.DropShare))
+	require.Equal(t, http.StatusGone, dropUpload(s, share.ID, share.Token, "b.txt", "b").Code)
+
+	req := httptest.NewRequest(http.MethodPost, "/shares", strings.NewReader(`{"expires_in": "soon"}`))
+	req.Header.Set("Authorization", "Bearer admin")
+	require.Equal(t, http.StatusBadRequest, serve(s, req).Code)
+}
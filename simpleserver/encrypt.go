@@ -0,0 +1,194 @@
+package simpleserver
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+)
+
+// Files are encrypted at rest with AES-256-GCM in independently sealed
+// chunks, so they can be written and read as a stream. A stored file starts
+// with a random nonce prefix, followed by chunks of up to encryptChunkSize
+// plaintext bytes each sealed with the nonce prefix || chunk counter || last
+// flag. The last flag keeps a truncated file from decrypting cleanly.
+const (
+	encryptionAESGCM   = "aes-256-gcm"
+	encryptAutoKey     = "auto"
+	encryptChunkSize   = 64 << 10
+	encryptPrefixSize  = 7
+	encryptKeyIDLength = 8
+)
+
+var (
+	errEncryptedCorrupt = errors.New("encrypted file is corrupt or truncated")
+	// errUnknownKey is returned for files encrypted with another key than
+	// the one the server runs with.
+	errUnknownKey = errors.New("file was encrypted with a key this server does not have")
+)
+
+// fileCipher encrypts uploads with the key given by --encrypt-key.
+type fileCipher struct {
+	aead cipher.AEAD
+	// keyID identifies the key in the metadata of the files it encrypted.
+	keyID string
+}
+
+// newFileCipher parses a hex encoded 32 byte key. "auto" generates a key
+// that only lives as long as the process.
+func newFileCipher(encoded string) (*fileCipher, error) {
+	var key []byte
+	if encoded == encryptAutoKey {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		log.Printf("Encrypting uploads with a generated key, they cannot be read back after a restart\n")
+	} else {
+		var err error
+		key, err = hex.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("encrypt key must be 32 hex encoded bytes or %q", encryptAutoKey)
+		}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+	return &fileCipher{aead: aead, keyID: hex.EncodeToString(sum[:encryptKeyIDLength])}, nil
+}
+
+func chunkNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, 0, encryptPrefixSize+5)
+	nonce = append(nonce, prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, counter)
+	if last {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+// encryptWriter seals everything written to it into w. Close must be called
+// to write the last chunk; it does not close w.
+type encryptWriter struct {
+	aead    cipher.AEAD
+	w       io.Writer
+	prefix  []byte
+	counter uint32
+	buf     []byte
+}
+
+func (fc *fileCipher) encrypter(w io.Writer) (io.WriteCloser, error) {
+	prefix := make([]byte, encryptPrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(prefix); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{aead: fc.aead, w: w, prefix: prefix, buf: make([]byte, 0, encryptChunkSize)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data follows, since the
+		// last chunk has to be sealed differently.
+		if len(e.buf) == encryptChunkSize {
+			if err := e.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(e.buf[len(e.buf):encryptChunkSize], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (e *encryptWriter) seal(last bool) error {
+	sealed := e.aead.Seal(nil, chunkNonce(e.prefix, e.counter, last), e.buf, nil)
+	e.counter++
+	e.buf = e.buf[:0]
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+func (e *encryptWriter) Close() error {
+	return e.seal(true)
+}
+
+// decryptReader opens the chunks written by encryptWriter.
+type decryptReader struct {
+	aead    cipher.AEAD
+	r       *bufio.Reader
+	prefix  []byte
+	counter uint32
+	sealed  []byte
+	plain   []byte
+	done    bool
+}
+
+func (fc *fileCipher) decrypter(r io.Reader) (io.Reader, error) {
+	prefix := make([]byte, encryptPrefixSize)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, errEncryptedCorrupt
+	}
+	return &decryptReader{
+		aead:   fc.aead,
+		r:      bufio.NewReader(r),
+		prefix: prefix,
+		sealed: make([]byte, encryptChunkSize+fc.aead.Overhead()),
+	}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *decryptReader) open() error {
+	n, err := io.ReadFull(d.r, d.sealed)
+	switch {
+	case err == io.ErrUnexpectedEOF:
+		d.done = true
+	case err == io.EOF:
+		return errEncryptedCorrupt
+	case err != nil:
+		return err
+	default:
+		// A full chunk is the last one when nothing follows it.
+		if _, peekErr := d.r.Peek(1); peekErr == io.EOF {
+			d.done = true
+		}
+	}
+	plain, err := d.aead.Open(d.sealed[:0:0], chunkNonce(d.prefix, d.counter, d.done), d.sealed[:n], nil)
+	if err != nil {
+		return errEncryptedCorrupt
+	}
+	d.counter++
+	d.plain = plain
+	return nil
+}
@@ -0,0 +1,109 @@
+package simpleserver
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testEncryptKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+func encryptBytes(t *testing.T, fc *fileCipher, plain []byte) []byte {
+	t.Helper()
+	var sealed bytes.Buffer
+	w, err := fc.encrypter(&sealed)
+	require.NoError(t, err)
+	_, err = w.Write(plain)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return sealed.Bytes()
+}
+
+func decryptBytes(fc *fileCipher, sealed []byte) ([]byte, error) {
+	r, err := fc.decrypter(bytes.NewReader(sealed))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	fc, err := newFileCipher(testEncryptKey)
+	require.NoError(t, err)
+	for _, size := range []int{0, 1, encryptChunkSize, encryptChunkSize + 1, 2*encryptChunkSize + 5} {
+		plain := make([]byte, size)
+		_, err := rand.Read(plain)
+		require.NoError(t, err)
+
+		sealed := encryptBytes(t, fc, plain)
+		got, err := decryptBytes(fc, sealed)
+		require.NoError(t, err, "size %d", size)
+		require.Equal(t, plain, got, "size %d", size)
+	}
+}
+
+func TestDecryptDetectsTampering(t *testing.T) {
+	fc, err := newFileCipher(testEncryptKey)
+	require.NoError(t, err)
+	sealed := encryptBytes(t, fc, make([]byte, 2*encryptChunkSize))
+
+	// Dropping the last chunk leaves a file that ends on a full chunk.
+	_, err = decryptBytes(fc, sealed[:len(sealed)-fc.aead.Overhead()])
+	require.ErrorIs(t, err, errEncryptedCorrupt)
+	_, err = decryptBytes(fc, sealed[:encryptPrefixSize+encryptChunkSize+fc.aead.Overhead()])
+	require.ErrorIs(t, err, errEncryptedCorrupt)
+
+	flipped := bytes.Clone(sealed)
+	flipped[len(flipped)/2] ^= 1
+	_, err = decryptBytes(fc, flipped)
+	require.ErrorIs(t, err, errEncryptedCorrupt)
+}
+
+func TestInvalidEncryptKey(t *testing.T) {
+	_, err := newFileCipher("abcd")
+	require.Error(t, err)
+}
+
+func TestEncryptedUpload(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		dir := t.TempDir()
+		s := newTestServer(t, Config{UploadDir: dir, EncryptKey: testEncryptKey, CompressAtRest: compress})
+		content := strings.Repeat("confidential ", 1000)
+
+		rec := serve(s, httptest.NewRequest(http.MethodPut, "/plans.txt", strings.NewReader(content)))
+		require.Equal(t, http.StatusCreated, rec.Code)
+		u := downloadURLs(t, rec.Body.String())[0]
+
+		meta := findMeta(t, s, "plans.txt")
+		require.Equal(t, encryptionAESGCM, meta.Encryption)
+		stored, err := os.ReadFile(filepath.Join(dir, meta.Dir, meta.Name))
+		require.NoError(t, err)
+		require.NotContains(t, string(stored), "confidential")
+		require.Equal(t, int64(len(stored)), meta.StoredSize)
+
+		rec = serve(s, rangeRequest(u, "bytes=0-3"))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, "none", rec.Header().Get("Accept-Ranges"))
+		require.Equal(t, content, rec.Body.String())
+	}
+}
+
+func TestEncryptedUploadWithAnotherKey(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestServer(t, Config{UploadDir: dir, EncryptKey: testEncryptKey})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/plans.txt", strings.NewReader("secret")))
+	u := downloadURLs(t, rec.Body.String())[0]
+
+	s = newTestServer(t, Config{UploadDir: dir, EncryptKey: encryptAutoKey})
+	rec = download(t, s, u)
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	require.Equal(t, "File cannot be decrypted", errorOf(t, rec.Body.String()).Message)
+}
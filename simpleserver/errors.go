@@ -0,0 +1,164 @@
+package simpleserver
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Codes of errorResponse. Clients branch on these rather than on messages,
+// which are translated and may change.
+const (
+	codeBadRequest           = "BAD_REQUEST"
+	codeUnauthorized         = "UNAUTHORIZED"
+	codeForbidden            = "FORBIDDEN"
+	codeNotFound             = "NOT_FOUND"
+	codeMethodNotAllowed     = "METHOD_NOT_ALLOWED"
+	codeTimeout              = "TIMEOUT"
+	codeConflict             = "CONFLICT"
+	codeExpired              = "EXPIRED"
+	codePreconditionFailed   = "PRECONDITION_FAILED"
+	codeFileTooLarge         = "FILE_TOO_LARGE"
+	codeUnsupportedType      = "UNSUPPORTED_TYPE"
+	codeRangeNotSatisfiable  = "RANGE_NOT_SATISFIABLE"
+	codeUnprocessable        = "UNPROCESSABLE"
+	codeLocked               = "LOCKED"
+	codeTooEarly             = "TOO_EARLY"
+	codePreconditionRequired = "PRECONDITION_REQUIRED"
+	codeRateLimited          = "RATE_LIMITED"
+	codeInternal             = "INTERNAL"
+	codeBadGateway           = "BAD_GATEWAY"
+	codeUnavailable          = "UNAVAILABLE"
+	codeQuotaExceeded        = "QUOTA_EXCEEDED"
+
+	// Codes more precise than the status they are sent with.
+	codeChecksumMismatch  = "CHECKSUM_MISMATCH"
+	codeContentMismatch   = "CONTENT_MISMATCH"
+	codeTypeNotAllowed    = "TYPE_NOT_ALLOWED"
+	codeInfected          = "INFECTED"
+	codeReadOnly          = "READ_ONLY"
+	codePaused            = "PAUSED"
+	codeDownloadLimit     = "DOWNLOAD_LIMIT"
+	codeAlreadyDownloaded = "ALREADY_DOWNLOADED"
+	codeLinkUsed          = "LINK_USED"
+)
+
+// statusCodes are the codes of errors that have none more precise.
+var statusCodes = map[int]string{
+	http.StatusBadRequest:                   codeBadRequest,
+	http.StatusUnauthorized:                 codeUnauthorized,
+	http.StatusForbidden:                    codeForbidden,
+	http.StatusNotFound:                     codeNotFound,
+	http.StatusMethodNotAllowed:             codeMethodNotAllowed,
+	http.StatusRequestTimeout:               codeTimeout,
+	http.StatusConflict:                     codeConflict,
+	http.StatusGone:                         codeExpired,
+	http.StatusPreconditionFailed:           codePreconditionFailed,
+	http.StatusRequestEntityTooLarge:        codeFileTooLarge,
+	http.StatusUnsupportedMediaType:         codeUnsupportedType,
+	http.StatusRequestedRangeNotSatisfiable: codeRangeNotSatisfiable,
+	http.StatusUnprocessableEntity:          codeUnprocessable,
+	http.StatusLocked:                       codeLocked,
+	http.StatusTooEarly:                     codeTooEarly,
+	http.StatusPreconditionRequired:         codePreconditionRequired,
+	http.StatusTooManyRequests:              codeRateLimited,
+	http.StatusInternalServerError:          codeInternal,
+	http.StatusBadGateway:                   codeBadGateway,
+	http.StatusServiceUnavailable:           codeUnavailable,
+	http.StatusGatewayTimeout:               codeTimeout,
+	http.StatusInsufficientStorage:          codeQuotaExceeded,
+}
+
+// errorCodes lists every code errorResponse may carry, for the OpenAPI
+// document.
+func errorCodes() []string {
+	seen := make(map[string]bool)
+	for _, code := range statusCodes {
+		seen[code] = true
+	}
+	for _, code := range []string{codeChecksumMismatch, codeContentMismatch, codeTypeNotAllowed, codeInfected, codeReadOnly, codePaused, codeDownloadLimit, codeAlreadyDownloaded, codeLinkUsed} {
+		seen[code] = true
+	}
+	codes := make([]string, 0, len(seen))
+	for code := range seen {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// statusCode is the code of an error answered with status.
+func statusCode(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	return strings.ToUpper(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+}
+
+// errorResponse is the body of every error: a Code clients can branch on, a
+// Message in the language of the request and the RequestID of the
+// X-Request-Id header, to find the request in the logs.
+type errorResponse struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// fail answers with an error, coded after status.
+func fail(c echo.Context, status int, message string) error {
+	return failWith(c, status, statusCode(status), message)
+}
+
+// failWith answers with an error under a code more precise than status.
+func failWith(c echo.Context, status int, code, message string) error {
+	return c.JSON(status, errorResponse{
+		Code:      code,
+		Message:   translate(c, strings.TrimSpace(message)),
+		RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+	})
+}
+
+// uploadErrorCode is the code of an error returned by saveUpload, see
+// uploadErrorStatus.
+func uploadErrorCode(err error) string {
+	switch {
+	case errors.Is(err, errChecksumMismatch):
+		return codeChecksumMismatch
+	case errors.As(err, new(*contentMismatchError)):
+		return codeContentMismatch
+	case errors.Is(err, errTypeNotAllowed), errors.Is(err, errExtensionNotAllowed):
+		return codeTypeNotAllowed
+	case errors.Is(err, errInfected):
+		return codeInfected
+	}
+	return statusCode(uploadErrorStatus(err))
+}
+
+// handleHTTPError answers the errors handlers return rather than render:
+// those of echo itself, such as unknown routes, keep their status and
+// message, anything else is logged and answered as an internal error
+// without details, which may name paths of the server.
+func (s *Server) handleHTTPError(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+	status, message := http.StatusInternalServerError, "Internal server error"
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		status = httpErr.Code
+		if text, ok := httpErr.Message.(string); ok {
+			message = text
+		} else {
+			message = http.StatusText(status)
+		}
+	} else {
+		log.Printf("Failed to handle %s %s: %v\n", c.Request().Method, c.Request().URL.Path, err)
+	}
+	if err := fail(c, status, message); err != nil {
+		log.Printf("Failed to answer %s %s: %v\n", c.Request().Method, c.Request().URL.Path, err)
+	}
+}
@@ -0,0 +1,69 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// errorOf decodes an error response, leaving out its request id.
+func errorOf(t *testing.T, body string) errorResponse {
+	t.Helper()
+	var resp errorResponse
+	require.NoError(t, json.Unmarshal([]byte(body), &resp), body)
+	require.NotEmpty(t, resp.RequestID)
+	resp.RequestID = ""
+	return resp
+}
+
+func TestErrorCodes(t *testing.T) {
+	s := newTestServer(t, Config{AuthToken: testAuthToken, MaxSize: 1})
+
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("a")))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Equal(t, codeUnauthorized, errorOf(t, rec.Body.String()).Code)
+
+	rec = serve(s, authorized(httptest.NewRequest(http.MethodPut, "/big.bin", strings.NewReader(strings.Repeat("x", 2<<20))), testAuthToken))
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	require.Equal(t, codeFileTooLarge, errorOf(t, rec.Body.String()).Code)
+
+	req := authorized(httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("a")), testAuthToken)
+	req.Header.Set(contentSHA256Header, sha256Hex("b"))
+	rec = serve(s, req)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Equal(t, codeChecksumMismatch, errorOf(t, rec.Body.String()).Code)
+
+	rec = serve(s, authorized(httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("a")), testAuthToken))
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	meta := findMeta(t, s, "a.txt")
+	meta.ExpiresAt = time.Now().Add(-time.Second)
+	require.NoError(t, s.index.put(meta))
+	rec = download(t, s, "/"+meta.Dir+"/a.txt")
+	require.Equal(t, http.StatusGone, rec.Code)
+	require.Equal(t, errorResponse{Code: codeExpired, Message: "File has expired"}, errorOf(t, rec.Body.String()))
+}
+
+func TestErrorsOfEcho(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodPatch, "/", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	require.Equal(t, errorResponse{Code: codeMethodNotAllowed, Message: "Method Not Allowed"}, errorOf(t, rec.Body.String()))
+}
+
+func TestInternalErrorsHideDetails(t *testing.T) {
+	s := newTestServer(t, Config{})
+	e := s.newRouter()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+	c.Response().Header().Set("X-Request-Id", "abc")
+	s.handleHTTPError(errors.New("open /srv/uploads/.meta/secret.json: permission denied"), c)
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	require.NotContains(t, rec.Body.String(), "/srv")
+	require.Equal(t, errorResponse{Code: codeInternal, Message: "Internal server error"}, errorOf(t, rec.Body.String()))
+}
@@ -0,0 +1,85 @@
+package simpleserver
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Event types published to the EventPublisher.
+const (
+	EventUpload   = "upload"
+	EventDownload = "download"
+	EventDelete   = "delete"
+	EventExpire   = "expire"
+)
+
+const (
+	eventPublishTimeout = 10 * time.Second
+	eventQueueSize      = 256
+)
+
+// Event is the structured message published for every file that is stored,
+// served or removed.
+type Event struct {
+	Type     string    `json:"type"`
+	Dir      string    `json:"dir"`
+	Filename string    `json:"filename"`
+	Size     int64     `json:"size,omitempty"`
+	SHA256   string    `json:"sha256,omitempty"`
+	Bytes    int64     `json:"bytes,omitempty"`
+	ClientIP string    `json:"client_ip,omitempty"`
+	Identity string    `json:"identity,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// EventPublisher delivers events to a message queue.
+type EventPublisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// noopPublisher drops every event. It is used when no queue is configured.
+type noopPublisher struct{}
+
+func (noopPublisher) Publish(context.Context, Event) error {
+	return nil
+}
+
+func newEventPublisher(config Config) EventPublisher {
+	if config.EventsNATSURL == "" {
+		return noopPublisher{}
+	}
+	return newNATSPublisher(config.EventsNATSURL, config.EventsSubject)
+}
+
+// publishEvent queues event for the publisher without blocking the request
+// that triggered it. Events are published one at a time so consumers see
+// them in order. Failures are only logged.
+func (s *Server) publishEvent(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	s.metrics.observe(event)
+	s.audit(event)
+	s.webhooks.enqueue(event)
+	s.feed.publish(event)
+	s.eventsOnce.Do(func() {
+		s.eventQueue = make(chan Event, eventQueueSize)
+		go s.eventLoop()
+	})
+	select {
+	case s.eventQueue <- event:
+	default:
+		log.Printf("Dropping %s event for %s/%s, the event queue is full\n", event.Type, event.Dir, event.Filename)
+	}
+}
+
+func (s *Server) eventLoop() {
+	for event := range s.eventQueue {
+		ctx, cancel := context.WithTimeout(context.Background(), eventPublishTimeout)
+		if err := s.events.Publish(ctx, event); err != nil {
+			log.Printf("Failed to publish %s event for %s/%s: %v\n", event.Type, event.Dir, event.Filename, err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,122 @@
+package simpleserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recordingPublisher collects published events.
+type recordingPublisher chan Event
+
+func (p recordingPublisher) Publish(ctx context.Context, event Event) error {
+	p <- event
+	return nil
+}
+
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("event was not published")
+		return Event{}
+	}
+}
+
+func TestEventsPublished(t *testing.T) {
+	events := make(recordingPublisher, 16)
+	s := New(Config{UploadDir: t.TempDir()})
+	s.events = events
+	require.NoError(t, s.startup())
+
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/report.txt", strings.NewReader("0123456789")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	dir := shareDirs(t, s)[0]
+	upload := nextEvent(t, events)
+	require.Equal(t, EventUpload, upload.Type)
+	require.Equal(t, dir, upload.Dir)
+	require.Equal(t, "report.txt", upload.Filename)
+	require.Equal(t, int64(10), upload.Size)
+	require.Equal(t, findMeta(t, s, "report.txt").SHA256, upload.SHA256)
+	require.NotEmpty(t, upload.ClientIP)
+	require.False(t, upload.Time.IsZero())
+
+	rec = serve(s, rangeRequest("/"+dir+"/report.txt", "bytes=0-3"))
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	served := nextEvent(t, events)
+	require.Equal(t, EventDownload, served.Type)
+	require.Equal(t, "report.txt", served.Filename)
+	require.Equal(t, int64(4), served.Bytes)
+
+	require.NoError(t, s.deleteFile(findMeta(t, s, "report.txt")))
+	deleted := nextEvent(t, events)
+	require.Equal(t, EventDelete, deleted.Type)
+	require.Equal(t, dir, deleted.Dir)
+	require.Equal(t, "report.txt", deleted.Filename)
+}
+
+func TestRejectedUploadPublishesDelete(t *testing.T) {
+	events := make(recordingPublisher, 16)
+	s := New(Config{UploadDir: t.TempDir()})
+	s.events = events
+	s.processors = []processor{func(ctx context.Context, meta FileMeta, content io.Reader) error {
+		return errors.New("rejected")
+	}}
+	require.NoError(t, s.startup())
+
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/bad.txt", strings.NewReader("bad")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Equal(t, EventUpload, nextEvent(t, events).Type)
+	require.Equal(t, EventDelete, nextEvent(t, events).Type)
+}
+
+func TestNATSPublisher(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("INFO {\"server_id\":\"test\"}\r\n"))
+		reader := bufio.NewReader(conn)
+		connect, _ := reader.ReadString('\n')
+		pub, _ := reader.ReadString('\n')
+		fields := strings.Fields(pub)
+		size, _ := strconv.Atoi(fields[len(fields)-1])
+		payload := make([]byte, size+2)
+		io.ReadFull(reader, payload)
+		received <- []string{connect, pub, string(payload[:size])}
+	}()
+
+	publisher := newNATSPublisher("nats://"+ln.Addr().String(), "")
+	event := Event{Type: EventUpload, Dir: "abc123", Filename: "a.txt", Size: 1, Time: time.Unix(0, 0).UTC()}
+	require.NoError(t, publisher.Publish(context.Background(), event))
+
+	select {
+	case lines := <-received:
+		require.True(t, strings.HasPrefix(lines[0], "CONNECT "))
+		require.True(t, strings.HasPrefix(lines[1], "PUB "+defaultEventsSubject+".upload "))
+		var got Event
+		require.NoError(t, json.Unmarshal([]byte(lines[2]), &got))
+		require.Equal(t, event, got)
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing was published")
+	}
+}
@@ -0,0 +1,142 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	fetchPath           = "/fetch"
+	defaultFetchTimeout = 10 * time.Minute
+	// maxFetchRequestSize caps the JSON body of POST /fetch.
+	maxFetchRequestSize = 64 << 10
+)
+
+var (
+	errInvalidFetchURL = errors.New("url must be an http or https URL")
+	errFetchBlocked    = errors.New("url resolves to an address that is not public")
+)
+
+// nonPublicPrefixes are the ranges a fetch may not reach besides the
+// loopback, link-local, multicast and private ones netip knows about.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+}
+
+type fetchRequest struct {
+	URL  string `json:"url"`
+	Name string `json:"name"`
+}
+
+// newFetchClient returns the client of POST /fetch. Addresses are checked
+// as they are dialed, after DNS resolution, so neither redirects nor DNS
+// rebinding reach the host's own network. Proxy settings of the environment
+// are ignored, a proxy would dial on its behalf.
+func newFetchClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if addr, err := netip.ParseAddr(host); err != nil || !publicAddr(addr) {
+				return errFetchBlocked
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: time.Minute,
+		},
+	}
+}
+
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) fetchTimeout() time.Duration {
+	if s.config.FetchTimeout > 0 {
+		return s.config.FetchTimeout
+	}
+	return defaultFetchTimeout
+}
+
+// handleFetch answers POST /fetch by downloading a remote file into a new
+// share, to mirror large artifacts where the tunnel serves them quickly:
+//
+//	curl -d '{"url": "https://example.com/build.iso"}' host/fetch
+//
+// The file is named after the last segment of the URL unless "name" is
+// given, and is held to MaxSize like any upload.
+func (s *Server) handleFetch(c echo.Context) error {
+	var req fetchRequest
+	if err := json.NewDecoder(io.LimitReader(c.Request().Body, maxFetchRequestSize)).Decode(&req); err != nil {
+		return fail(c, http.StatusBadRequest, `Body must be JSON such as {"url": "https://example.com/file"}`)
+	}
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return s.uploadError(c, errInvalidFetchURL)
+	}
+	name := req.Name
+	if name == "" {
+		name = path.Base(target.Path)
+	}
+	filename, err := s.uploadFilename(name)
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	get, err := http.NewRequestWithContext(c.Request().Context(), http.MethodGet, target.String(), nil)
+	if err != nil {
+		return s.uploadError(c, errInvalidFetchURL)
+	}
+	resp, err := s.fetchClient.Do(get)
+	if errors.Is(err, errFetchBlocked) {
+		return s.uploadError(c, errFetchBlocked)
+	}
+	if err != nil {
+		log.Printf("Failed to fetch %s: %v\n", target.Redacted(), err)
+		return fail(c, http.StatusBadGateway, "Failed to fetch "+target.Redacted())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fail(c, http.StatusBadGateway, fmt.Sprintf("Fetching %s answered %s", target.Redacted(), resp.Status))
+	}
+	limit := int64(s.maxSize()) << 20
+	if size := resp.ContentLength; size > limit {
+		return s.uploadError(c, &sizeLimitError{limit: limit, over: size - limit})
+	}
+	meta, err := s.saveUpload(c, s.uploadDirFor(c), filename, &maxBytesReader{r: resp.Body, n: limit})
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	return s.uploaded(c, meta)
+}
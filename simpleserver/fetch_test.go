@@ -0,0 +1,96 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func fetchRequestFor(body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, fetchPath, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func newUpstream(t *testing.T, handler http.HandlerFunc) string {
+	t.Helper()
+	upstream := httptest.NewServer(handler)
+	t.Cleanup(upstream.Close)
+	return upstream.URL
+}
+
+func TestFetchStoresRemoteFile(t *testing.T) {
+	upstream := newUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/dist/notes.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("mirrored"))
+	})
+	s := newTestServer(t, Config{})
+	s.fetchClient = http.DefaultClient
+
+	rec := serve(s, fetchRequestFor(`{"url": "`+upstream+`/dist/notes.txt"}`))
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	url := downloadURLs(t, rec.Body.String())[0]
+	require.True(t, strings.HasSuffix(url, "/notes.txt"), url)
+	rec = download(t, s, url)
+	require.Equal(t, "mirrored", rec.Body.String())
+
+	rec = serve(s, fetchRequestFor(`{"url": "`+upstream+`/dist/notes.txt", "name": "copy.txt"}`))
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	require.True(t, strings.HasSuffix(downloadURLs(t, rec.Body.String())[0], "/copy.txt"))
+
+	rec = serve(s, fetchRequestFor(`{"url": "`+upstream+`/missing"}`))
+	require.Equal(t, http.StatusBadGateway, rec.Code)
+}
+
+func TestFetchIsHeldToMaxSize(t *testing.T) {
+	upstream := newUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 2<<20)))
+	})
+	s := newTestServer(t, Config{MaxSize: 1})
+	s.fetchClient = http.DefaultClient
+
+	rec := serve(s, fetchRequestFor(`{"url": "`+upstream+`/big.bin"}`))
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	require.Zero(t, s.index.len())
+}
+
+func TestFetchRefusesPrivateAddresses(t *testing.T) {
+	upstream := newUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal"))
+	})
+	s := newTestServer(t, Config{})
+	rec := serve(s, fetchRequestFor(`{"url": "`+upstream+`/secret.txt"}`))
+	require.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+
+	for _, body := range []string{`{"url": "ftp://example.com/file"}`, `{"url": "/relative"}`, `not json`} {
+		require.Equal(t, http.StatusBadRequest, serve(s, fetchRequestFor(body)).Code, body)
+	}
+
+	for addr, public := range map[string]bool{
+		"203.0.113.7":     true,
+		"2001:4860::8888": true,
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"169.254.169.254": false,
+		"100.64.0.1":      false,
+		"::ffff:10.0.0.1": false,
+		"fd00::1":         false,
+		"0.0.0.0":         false,
+	} {
+		require.Equal(t, public, publicAddr(netip.MustParseAddr(addr)), addr)
+	}
+}
+
+func TestNoFetch(t *testing.T) {
+	s := newTestServer(t, Config{NoFetch: true})
+	rec := serve(s, fetchRequestFor(`{"url": "https://example.com/file"}`))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	require.False(t, s.capabilities().Fetch)
+}
@@ -0,0 +1,187 @@
+package simpleserver
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const adminFilesPath = "/admin/files"
+
+// all returns every upload, newest first.
+func (ix *metaIndex) all() []FileMeta {
+	ix.mu.RLock()
+	files := make([]FileMeta, 0, len(ix.files))
+	for _, meta := range ix.files {
+		files = append(files, meta)
+	}
+	ix.mu.RUnlock()
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].CreatedAt.Equal(files[j].CreatedAt) {
+			return files[i].CreatedAt.After(files[j].CreatedAt)
+		}
+		return files[i].key() < files[j].key()
+	})
+	return files
+}
+
+type adminFile struct {
+	URL         string     `json:"url"`
+	Dir         string     `json:"dir"`
+	Name        string     `json:"name"`
+	Size        int64      `json:"size"`
+	StoredSize  int64      `json:"stored_size"`
+	SHA256      string     `json:"sha256,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	AgeSeconds  int64      `json:"age_seconds"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	Downloads   int64      `json:"downloads"`
+	BytesServed int64      `json:"bytes_served"`
+	Pending     bool       `json:"pending,omitempty"`
+	Once        bool       `json:"once,omitempty"`
+	Password    bool       `json:"password,omitempty"`
+
+	MaxDownloads int64             `json:"max_downloads,omitempty"`
+	Visibility   string            `json:"visibility,omitempty"`
+	Description  string            `json:"description,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+}
+
+type adminFilesResponse struct {
+	Files []adminFile `json:"files"`
+}
+
+// handleAdminFiles lists every upload with its size and age, newest first.
+// ?dir= narrows the list to a single upload directory and every
+// ?tag=key=value, or ?tag=key, to the uploads tagged so. Unlisted and
+// restricted uploads are left out unless ?unlisted=true.
+func (s *Server) handleAdminFiles(c echo.Context) error {
+	dir := c.QueryParam("dir")
+	unlisted, _ := strconv.ParseBool(c.QueryParam("unlisted"))
+	tags := c.QueryParams()["tag"]
+	now := time.Now()
+	response := adminFilesResponse{Files: []adminFile{}}
+	for _, meta := range s.index.all() {
+		if (dir != "" && meta.Dir != dir) || (!meta.listed() && !unlisted) || !meta.hasTags(tags) {
+			continue
+		}
+		file := adminFile{
+			URL:         s.downloadURL(c, meta.Dir, meta.Name),
+			Dir:         meta.Dir,
+			Name:        meta.Name,
+			Size:        meta.Size,
+			StoredSize:  meta.storedBytes(),
+			SHA256:      meta.SHA256,
+			CreatedAt:   meta.CreatedAt,
+			AgeSeconds:  int64(now.Sub(meta.CreatedAt).Seconds()),
+			Downloads:   meta.Downloads,
+			BytesServed: meta.BytesServed,
+			Pending:     meta.Pending,
+			Once:        meta.Once,
+			Password:    meta.PasswordHash != "",
+		}
+		if !meta.ExpiresAt.IsZero() {
+			file.ExpiresAt = &meta.ExpiresAt
+		}
+		file.MaxDownloads = meta.MaxDownloads
+		file.Visibility = meta.Visibility
+		file.Description = meta.Description
+		file.Tags = meta.Tags
+		response.Files = append(response.Files, file)
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// handleAdminDelete deletes the upload at /admin/files/<dir>/<name>.
+func (s *Server) handleAdminDelete(c echo.Context) error {
+	dir, name, err := parseTarget(strings.TrimPrefix(c.Request().URL.EscapedPath(), adminFilesPath+"/"))
+	if err != nil {
+		return fail(c, http.StatusNotFound, "File not found")
+	}
+	meta, ok := s.index.get(dir, name)
+	if !ok {
+		// Files stored before the index existed only live in the backend.
+		exists, err := s.objectExists(c.Request().Context(), metaKey(dir, name))
+		if err != nil {
+			log.Printf("Failed to look up %s/%s: %v\n", dir, name, err)
+			return fail(c, http.StatusInternalServerError, "Failed to delete file")
+		}
+		if !exists {
+			return fail(c, http.StatusNotFound, "File not found")
+		}
+		meta = FileMeta{Dir: dir, Name: name}
+	}
+	if err := s.deleteFileFor(c, meta); err != nil {
+		return deleteFailed(c, meta, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Stats summarizes the stored uploads, as GET /admin/stats and the stats
+// command report them.
+type Stats struct {
+	Files       int   `json:"files"`
+	Dirs        int   `json:"dirs"`
+	TotalSize   int64 `json:"total_size"`
+	StoredBytes int64 `json:"stored_bytes"`
+	// DedupedBytes is the space saved by uploads sharing a blob.
+	DedupedBytes int64 `json:"deduped_bytes"`
+	// QuotaBytes is the MaxTotalSize quota, 0 when there is none.
+	QuotaBytes    int64      `json:"quota_bytes"`
+	Downloads     int64      `json:"downloads"`
+	BytesServed   int64      `json:"bytes_served"`
+	Pending       int        `json:"pending"`
+	Expired       int        `json:"expired"`
+	OldestUpload  *time.Time `json:"oldest_upload"`
+	NewestUpload  *time.Time `json:"newest_upload"`
+	UploadsPaused bool       `json:"uploads_paused"`
+}
+
+// handleAdminStats summarizes the store.
+func (s *Server) handleAdminStats(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.Stats())
+}
+
+// Stats summarizes the stored uploads.
+func (s *Server) Stats() Stats {
+	files := s.index.all()
+	now := time.Now()
+	stats := Stats{
+		Files:         len(files),
+		QuotaBytes:    int64(s.settings().MaxTotalSize) << 20,
+		UploadsPaused: s.uploadsOff(),
+	}
+	dirs := make(map[string]bool)
+	blobs := make(map[string]bool)
+	for _, meta := range files {
+		dirs[meta.Dir] = true
+		stats.TotalSize += meta.Size
+		if blobs[meta.Blob] {
+			stats.DedupedBytes += meta.storedBytes()
+		} else {
+			stats.StoredBytes += meta.storedBytes()
+		}
+		if meta.Blob != "" {
+			blobs[meta.Blob] = true
+		}
+		stats.Downloads += meta.Downloads
+		stats.BytesServed += meta.BytesServed
+		if meta.Pending {
+			stats.Pending++
+		}
+		if meta.expired(now) {
+			stats.Expired++
+		}
+	}
+	stats.Dirs = len(dirs)
+	if len(files) > 0 {
+		stats.NewestUpload = &files[0].CreatedAt
+		stats.OldestUpload = &files[len(files)-1].CreatedAt
+	}
+	return stats
+}
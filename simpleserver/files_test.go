@@ -0,0 +1,86 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminFilesListsUploads(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken, TTL: time.Hour})
+	for _, name := range []string{"old.txt", "new.txt"} {
+		rec := serve(s, httptest.NewRequest(http.MethodPut, "/"+name, strings.NewReader(name)))
+		require.Equal(t, http.StatusCreated, rec.Code)
+	}
+	old := findMeta(t, s, "old.txt")
+	old.CreatedAt = old.CreatedAt.Add(-time.Hour)
+	require.NoError(t, s.index.put(old))
+
+	rec := serve(s, adminRequest(http.MethodGet, "/admin/files", ""))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp adminFilesResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.Files, 2)
+	require.Equal(t, "new.txt", resp.Files[0].Name)
+	require.Equal(t, "old.txt", resp.Files[1].Name)
+	require.Equal(t, int64(7), resp.Files[1].Size)
+	require.GreaterOrEqual(t, resp.Files[1].AgeSeconds, int64(3600))
+	require.NotNil(t, resp.Files[1].ExpiresAt)
+
+	rec = serve(s, adminRequest(http.MethodGet, "/admin/files?dir="+old.Dir, ""))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.Files, 1)
+	require.Equal(t, "old.txt", resp.Files[0].Name)
+}
+
+func TestAdminDeleteFile(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/a%20b.txt", strings.NewReader("gone")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	url := downloadURLs(t, rec.Body.String())[0]
+	meta := findMeta(t, s, "a b.txt")
+
+	target := "/admin/files/" + meta.Dir + "/a%20b.txt"
+	rec = serve(s, httptest.NewRequest(http.MethodDelete, target, nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(s, adminRequest(http.MethodDelete, target, ""))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	_, ok := s.index.get(meta.Dir, meta.Name)
+	require.False(t, ok)
+	require.Equal(t, http.StatusNotFound, download(t, s, url).Code)
+
+	rec = serve(s, adminRequest(http.MethodDelete, target, ""))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	rec = serve(s, adminRequest(http.MethodDelete, "/admin/files/"+meta.Dir+"/..%2F..%2Fetc", ""))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestAdminStats(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken, MaxTotalSize: 10})
+	rec := serve(s, multipartRequest(t, http.MethodPost, "/", testPart{"a.txt", "aaa"}, testPart{"b.txt", "bb"}))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	rec = serve(s, httptest.NewRequest(http.MethodPut, "/c.txt", strings.NewReader("c")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Equal(t, http.StatusOK, download(t, s, downloadURLs(t, rec.Body.String())[0]).Code)
+
+	rec = serve(s, adminRequest(http.MethodGet, "/admin/stats", ""))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var stats Stats
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+	require.Equal(t, 3, stats.Files)
+	require.Equal(t, 2, stats.Dirs)
+	require.Equal(t, int64(6), stats.TotalSize)
+	require.Equal(t, int64(6), stats.StoredBytes)
+	require.Equal(t, int64(10<<20), stats.QuotaBytes)
+	require.Equal(t, int64(1), stats.Downloads)
+	require.Equal(t, int64(1), stats.BytesServed)
+	require.NotNil(t, stats.OldestUpload)
+	require.NotNil(t, stats.NewestUpload)
+}
@@ -0,0 +1,173 @@
+package simpleserver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+var errExtensionNotAllowed = errors.New("file extension is not allowed")
+
+// contentMismatchError rejects an upload whose content contradicts its
+// extension in a way that could get it run, e.g. HTML named .png.
+type contentMismatchError struct {
+	Detected string
+	Declared string
+}
+
+func (e *contentMismatchError) Error() string {
+	return fmt.Sprintf("content detected as %s contradicts the declared type %s", e.Detected, e.Declared)
+}
+
+// executableSignatures are the magic bytes of native executables, which
+// http.DetectContentType reports as application/octet-stream.
+var executableSignatures = []struct {
+	magic       string
+	contentType string
+}{
+	{"MZ", "application/vnd.microsoft.portable-executable"},
+	{"\x7fELF", "application/x-elf"},
+	{"\xfe\xed\xfa\xce", "application/x-mach-binary"},
+	{"\xfe\xed\xfa\xcf", "application/x-mach-binary"},
+	{"\xce\xfa\xed\xfe", "application/x-mach-binary"},
+	{"\xcf\xfa\xed\xfe", "application/x-mach-binary"},
+}
+
+// executableExtensions maps the executable types to the extensions an
+// AllowExtensions list has to name for them.
+var executableExtensions = map[string][]string{
+	"application/vnd.microsoft.portable-executable": {".exe", ".dll", ".sys", ".scr"},
+	"application/x-elf":                             {".so", ".bin"},
+	"application/x-mach-binary":                     {".dylib", ".bin"},
+}
+
+// sniffContentType identifies content by its magic bytes alone.
+func sniffContentType(head []byte) string {
+	for _, sig := range executableSignatures {
+		// Text starting with "MZ" is common enough to also require the
+		// binary header that follows it.
+		if bytes.HasPrefix(head, []byte(sig.magic)) && bytes.IndexByte(head[:min(len(head), 64)], 0) >= 0 {
+			return sig.contentType
+		}
+	}
+	return http.DetectContentType(head)
+}
+
+// genericContentType reports whether magic bytes failed to tell more than
+// whether the content is text.
+func genericContentType(contentType string) bool {
+	return contentType == "application/octet-stream" || strings.HasPrefix(contentType, "text/plain")
+}
+
+// extensionAllowed reports whether name passes AllowExtensions. Entries are
+// matched case insensitively with or without their leading dot, and may span
+// several dots, e.g. "tar.gz".
+func (s *Server) extensionAllowed(name string) bool {
+	if len(s.config.AllowExtensions) == 0 {
+		return true
+	}
+	name = strings.ToLower(path.Base(name))
+	for _, ext := range s.config.AllowExtensions {
+		if strings.HasSuffix(name, "."+strings.TrimPrefix(strings.ToLower(ext), ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFileType applies AllowExtensions and BlockMIME to an upload named
+// name with the given first bytes. Both the name and the content have to
+// pass, so renaming a file cannot smuggle it past the filters: content whose
+// magic bytes identify it must match its allowed extension, and a blocked
+// type is refused whether it comes from the extension or from the content.
+func (s *Server) checkFileType(name string, head []byte) error {
+	sniffed := sniffContentType(head)
+	byExt := mime.TypeByExtension(path.Ext(name))
+	if len(s.config.AllowExtensions) > 0 {
+		if !s.extensionAllowed(name) {
+			return errExtensionNotAllowed
+		}
+		if !contentMatchesName(strings.ToLower(path.Base(name)), sniffed, byExt) {
+			return errTypeNotAllowed
+		}
+	}
+	if s.config.VerifyContent {
+		if err := verifyContent(name, sniffed, byExt); err != nil {
+			return err
+		}
+	}
+	if len(s.config.BlockMIME) > 0 {
+		for _, contentType := range []string{sniffed, byExt, detectContentType(name, head)} {
+			if contentType != "" && matchContentType(s.config.BlockMIME, contentType) {
+				return errTypeNotAllowed
+			}
+		}
+	}
+	return nil
+}
+
+// verifyContent refuses active content, such as HTML or an executable,
+// under an extension declaring a passive type. Content without an
+// extension declares nothing and passes, as do extensions declaring active
+// content already, e.g. SVG images sniffed as XML.
+func verifyContent(name, sniffed, byExt string) error {
+	name = strings.ToLower(path.Base(name))
+	ext := path.Ext(name)
+	if ext == "" || !runnableContentType(sniffed) || contentMatchesName(name, sniffed, byExt) {
+		return nil
+	}
+	if byExt != "" && runnableContentType(byExt) {
+		return nil
+	}
+	declared := byExt
+	if declared == "" {
+		declared = ext
+	}
+	mediaType, _, _ := mime.ParseMediaType(sniffed)
+	return &contentMismatchError{Detected: mediaType, Declared: declared}
+}
+
+// runnableContentType reports whether browsers may run scripts in content
+// of this type or it is a native executable.
+func runnableContentType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	_, executable := executableExtensions[mediaType]
+	return executable || activeContentType(contentType)
+}
+
+// contentMatchesName reports whether the sniffed type of an upload is
+// plausible for its name. Zip archives also pass for other application
+// formats, as many document and package formats are zip files.
+func contentMatchesName(name, sniffed, byExt string) bool {
+	if genericContentType(sniffed) || sameMediaType(sniffed, byExt) {
+		return true
+	}
+	if sniffed == "application/zip" && (byExt == "" || strings.HasPrefix(byExt, "application/")) {
+		return true
+	}
+	for _, ext := range extensionsByType(sniffed) {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func extensionsByType(contentType string) []string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if exts, ok := executableExtensions[mediaType]; ok {
+		return exts
+	}
+	exts, _ := mime.ExtensionsByType(mediaType)
+	return exts
+}
+
+func sameMediaType(a, b string) bool {
+	mediaA, _, errA := mime.ParseMediaType(a)
+	mediaB, _, errB := mime.ParseMediaType(b)
+	return errA == nil && errB == nil && mediaA == mediaB
+}
@@ -0,0 +1,109 @@
+package simpleserver
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testPNG = append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 64)...)
+	testEXE = append([]byte("MZ\x90\x00\x03\x00\x00\x00"), bytes.Repeat([]byte{0}, 64)...)
+)
+
+func TestAllowExtensions(t *testing.T) {
+	s := newTestServer(t, Config{AllowExtensions: []string{"png", ".TXT", "tar.gz", "docx"}})
+	for _, tc := range []struct {
+		name    string
+		content []byte
+		status  int
+	}{
+		{"photo.png", testPNG, http.StatusCreated},
+		{"PHOTO.PNG", testPNG, http.StatusCreated},
+		{"notes.txt", []byte("notes"), http.StatusCreated},
+		{"backup.tar.gz", []byte("backup"), http.StatusCreated},
+		{"report.docx", []byte("PK\x03\x04\x14\x00\x06\x00"), http.StatusCreated},
+		{"photo.png", []byte("PK\x03\x04\x14\x00\x06\x00"), http.StatusUnsupportedMediaType},
+		{"setup.exe", testEXE, http.StatusUnsupportedMediaType},
+		{"README", []byte("readme"), http.StatusUnsupportedMediaType},
+		// Renamed files are caught by their content.
+		{"setup.png", testEXE, http.StatusUnsupportedMediaType},
+		{"page.txt", []byte("<html><script></script></html>"), http.StatusUnsupportedMediaType},
+	} {
+		rec := serve(s, httptest.NewRequest(http.MethodPut, "/"+tc.name, bytes.NewReader(tc.content)))
+		require.Equal(t, tc.status, rec.Code, tc.name)
+	}
+
+	rec := serve(s, multipartRequest(t, http.MethodPost, "/", testPart{"a.txt", "a"}, testPart{"b.exe", string(testEXE)}))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "b.exe")
+
+	req := httptest.NewRequest(http.MethodPost, tusPath, nil)
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set(uploadLengthHeader, "10")
+	req.Header.Set(uploadMetaHeader, "filename c2V0dXAuZXhl")
+	require.Equal(t, http.StatusUnsupportedMediaType, serve(s, req).Code)
+}
+
+func TestBlockMIME(t *testing.T) {
+	s := newTestServer(t, Config{BlockMIME: []string{"application/vnd.microsoft.portable-executable", "text/html"}})
+	for _, tc := range []struct {
+		name    string
+		content []byte
+		status  int
+	}{
+		{"notes.txt", []byte("notes"), http.StatusCreated},
+		{"photo.png", testPNG, http.StatusCreated},
+		{"setup.exe", testEXE, http.StatusUnsupportedMediaType},
+		{"photo.jpg", testEXE, http.StatusUnsupportedMediaType},
+		{"page.html", []byte("just text"), http.StatusUnsupportedMediaType},
+		{"page.txt", []byte("<!DOCTYPE html><p>hi"), http.StatusUnsupportedMediaType},
+	} {
+		rec := serve(s, httptest.NewRequest(http.MethodPut, "/"+tc.name, bytes.NewReader(tc.content)))
+		require.Equal(t, tc.status, rec.Code, tc.name)
+	}
+	require.Equal(t, 2, s.index.len())
+}
+
+func TestSniffExecutables(t *testing.T) {
+	require.Equal(t, "application/vnd.microsoft.portable-executable", sniffContentType(testEXE))
+	require.Equal(t, "application/x-elf", sniffContentType([]byte("\x7fELF\x02\x01\x01\x00")))
+	require.True(t, strings.HasPrefix(sniffContentType([]byte("MZ is a plain text note")), "text/plain"))
+}
+
+func TestVerifyContent(t *testing.T) {
+	s := newTestServer(t, Config{VerifyContent: true})
+	for _, tc := range []struct {
+		name     string
+		content  []byte
+		status   int
+		detected string
+	}{
+		{"photo.png", testPNG, http.StatusCreated, ""},
+		{"notes.txt", []byte("notes"), http.StatusCreated, ""},
+		{"page.html", []byte("<html><script></script></html>"), http.StatusCreated, ""},
+		{"logo.svg", []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"/>`), http.StatusCreated, ""},
+		{"setup.exe", testEXE, http.StatusCreated, ""},
+		{"page", []byte("<html><script></script></html>"), http.StatusCreated, ""},
+		{"photo.png", []byte("<html><script>alert(1)</script></html>"), http.StatusUnprocessableEntity, "text/html"},
+		{"notes.txt", []byte("<!DOCTYPE html><p>hi"), http.StatusUnprocessableEntity, "text/html"},
+		{"photo.jpg", testEXE, http.StatusUnprocessableEntity, "application/vnd.microsoft.portable-executable"},
+		{"data.custom", []byte("<html><body></body></html>"), http.StatusUnprocessableEntity, "text/html"},
+	} {
+		rec := serve(s, httptest.NewRequest(http.MethodPut, "/"+tc.name, bytes.NewReader(tc.content)))
+		require.Equal(t, tc.status, rec.Code, tc.name)
+		if tc.detected != "" {
+			require.Contains(t, rec.Body.String(), tc.detected, tc.name)
+		}
+	}
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/photo.png", strings.NewReader("<html></html>")))
+	require.Equal(t, errorResponse{Code: codeContentMismatch, Message: "content detected as text/html contradicts the declared type image/png"}, errorOf(t, rec.Body.String()))
+
+	s = newTestServer(t, Config{})
+	rec = serve(s, httptest.NewRequest(http.MethodPut, "/photo.png", strings.NewReader("<html></html>")))
+	require.Equal(t, http.StatusCreated, rec.Code, "only checked with VerifyContent")
+}
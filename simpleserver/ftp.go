@@ -0,0 +1,455 @@
+package simpleserver
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ftpIdleTimeout closes control connections that stay silent this long.
+	ftpIdleTimeout = 5 * time.Minute
+	// ftpDataTimeout is how long a passive listener waits for the client.
+	ftpDataTimeout = 30 * time.Second
+)
+
+// serveFTP accepts FTP connections on FTPPort until shutdownC is closed.
+func (s *Server) serveFTP(shutdownC <-chan struct{}) {
+	minPort, maxPort, err := parsePortRange(s.config.FTPPassivePorts)
+	if err != nil {
+		log.Printf("Failed to serve FTP: %v\n", err)
+		return
+	}
+	ln, err := s.listen(s.config.FTPPort)
+	if err != nil {
+		log.Printf("Failed to serve FTP: %v\n", err)
+		return
+	}
+	fmt.Printf("FTP available on port %d\n", ln.Addr().(*net.TCPAddr).Port)
+	go func() {
+		<-shutdownC
+		ln.Close()
+	}()
+	s.acceptFTP(ln, minPort, maxPort)
+}
+
+func (s *Server) acceptFTP(ln net.Listener, minPort, maxPort int) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		sess := &ftpSession{
+			s:       s,
+			dav:     davFS{s: s},
+			conn:    conn,
+			r:       bufio.NewReader(conn),
+			cwd:     "/",
+			minPort: minPort,
+			maxPort: maxPort,
+		}
+		go sess.serve()
+	}
+}
+
+// parsePortRange parses the passive port range "min-max". An empty range
+// leaves the choice to the OS.
+func parsePortRange(ports string) (int, int, error) {
+	if ports == "" {
+		return 0, 0, nil
+	}
+	lo, hi, ok := strings.Cut(ports, "-")
+	minPort, err1 := strconv.Atoi(lo)
+	maxPort, err2 := strconv.Atoi(hi)
+	if !ok || err1 != nil || err2 != nil || minPort < 1 || maxPort > 65535 || minPort > maxPort {
+		return 0, 0, fmt.Errorf("passive ports %q must be a range like 30000-30009", ports)
+	}
+	return minPort, maxPort, nil
+}
+
+// ftpSession is a single FTP control connection. Every login gets a new
+// share dir, which is the root the client sees, so devices that cannot do
+// anything but upload never see each other's files. Only passive mode is
+// supported.
+type ftpSession struct {
+	s       *Server
+	dav     davFS
+	conn    net.Conn
+	r       *bufio.Reader
+	minPort int
+	maxPort int
+
+	user       string
+	dir        string
+	cwd        string
+	renameFrom string
+	passive    net.Listener
+}
+
+func (sess *ftpSession) reply(code int, format string, args ...any) error {
+	_, err := fmt.Fprintf(sess.conn, "%d %s\r\n", code, fmt.Sprintf(format, args...))
+	return err
+}
+
+func (sess *ftpSession) serve() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer sess.conn.Close()
+	defer sess.closePassive()
+	defer sess.logout(ctx)
+	if sess.reply(220, "simpleserver ready") != nil {
+		return
+	}
+	for {
+		sess.conn.SetReadDeadline(time.Now().Add(ftpIdleTimeout))
+		line, err := sess.r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command, arg, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		command = strings.ToUpper(command)
+		if command == "QUIT" {
+			sess.reply(221, "Goodbye")
+			return
+		}
+		if err := sess.handle(ctx, command, arg); err != nil {
+			return
+		}
+	}
+}
+
+// handle runs a single command. Only failing to write the reply ends the
+// session.
+func (sess *ftpSession) handle(ctx context.Context, command, arg string) error {
+	switch command {
+	case "USER":
+		sess.user = arg
+		return sess.reply(331, "Password required")
+	case "PASS":
+		return sess.login(arg)
+	case "NOOP":
+		return sess.reply(200, "OK")
+	case "SYST":
+		return sess.reply(215, "UNIX Type: L8")
+	case "FEAT":
+		_, err := io.WriteString(sess.conn, "211-Features:\r\n EPSV\r\n PASV\r\n SIZE\r\n MDTM\r\n UTF8\r\n211 End\r\n")
+		return err
+	case "OPTS":
+		if strings.EqualFold(arg, "UTF8 ON") {
+			return sess.reply(200, "UTF8 enabled")
+		}
+		return sess.reply(501, "Unsupported option")
+	}
+	if sess.dir == "" {
+		return sess.reply(530, "Please log in with USER and PASS")
+	}
+	switch command {
+	case "PWD", "XPWD":
+		return sess.reply(257, "%q is the current directory", sess.cwd)
+	case "CWD", "XCWD":
+		return sess.changeDir(ctx, sess.resolve(arg))
+	case "CDUP", "XCUP":
+		return sess.changeDir(ctx, path.Dir(sess.cwd))
+	case "TYPE":
+		// Files are always transferred verbatim.
+		return sess.reply(200, "Type set to %s", arg)
+	case "MODE", "STRU":
+		if strings.EqualFold(arg, "S") || strings.EqualFold(arg, "F") {
+			return sess.reply(200, "OK")
+		}
+		return sess.reply(504, "Unsupported parameter")
+	case "ALLO":
+		return sess.reply(202, "No storage allocation needed")
+	case "PASV":
+		return sess.enterPassive(false)
+	case "EPSV":
+		return sess.enterPassive(true)
+	case "PORT", "EPRT":
+		return sess.reply(502, "Only passive mode is supported")
+	case "LIST", "NLST":
+		return sess.list(ctx, command == "NLST", arg)
+	case "RETR":
+		return sess.retrieve(ctx, sess.resolve(arg))
+	case "STOR":
+		return sess.store(ctx, sess.resolve(arg))
+	case "SIZE", "MDTM":
+		info, err := sess.dav.Stat(ctx, sess.davName(sess.resolve(arg)))
+		if err != nil || info.IsDir() {
+			return sess.reply(550, "No such file")
+		}
+		if command == "SIZE" {
+			return sess.reply(213, "%d", info.Size())
+		}
+		return sess.reply(213, "%s", info.ModTime().UTC().Format("20060102150405"))
+	case "DELE":
+		name := sess.davName(sess.resolve(arg))
+		if info, err := sess.dav.Stat(ctx, name); err != nil || info.IsDir() {
+			return sess.reply(550, "No such file")
+		}
+		if err := sess.dav.RemoveAll(ctx, name); err != nil {
+			return sess.fail(err)
+		}
+		return sess.reply(250, "Deleted")
+	case "MKD", "XMKD":
+		p := sess.resolve(arg)
+		if err := sess.dav.Mkdir(ctx, sess.davName(p), 0755); err != nil {
+			return sess.fail(err)
+		}
+		return sess.reply(257, "%q created", p)
+	case "RMD", "XRMD":
+		p := sess.resolve(arg)
+		info, err := sess.dav.Stat(ctx, sess.davName(p))
+		switch {
+		case p == "/" || err != nil || !info.IsDir():
+			return sess.reply(550, "No such directory")
+		case len(sess.dav.readDir(davPath(sess.davName(p)))) > 0:
+			return sess.reply(550, "Directory not empty")
+		}
+		if err := sess.dav.RemoveAll(ctx, sess.davName(p)); err != nil {
+			return sess.fail(err)
+		}
+		return sess.reply(250, "Removed")
+	case "RNFR":
+		p := sess.resolve(arg)
+		if _, err := sess.dav.Stat(ctx, sess.davName(p)); err != nil {
+			return sess.reply(550, "No such file")
+		}
+		sess.renameFrom = p
+		return sess.reply(350, "Ready for RNTO")
+	case "RNTO":
+		from := sess.renameFrom
+		sess.renameFrom = ""
+		if from == "" {
+			return sess.reply(503, "RNFR first")
+		}
+		if err := sess.dav.Rename(ctx, sess.davName(from), sess.davName(sess.resolve(arg))); err != nil {
+			return sess.fail(err)
+		}
+		return sess.reply(250, "Renamed")
+	}
+	return sess.reply(502, "Command not implemented")
+}
+
+// login checks the password against Config.AuthToken, accepting anyone
+// when no token is configured, and creates the session's share dir.
+func (sess *ftpSession) login(password string) error {
+	if sess.user == "" {
+		return sess.reply(503, "Send USER first")
+	}
+	token := sess.s.settings().AuthToken
+	if token != "" && subtle.ConstantTimeCompare([]byte(password), []byte(token)) != 1 {
+		return sess.reply(530, "Login incorrect")
+	}
+	if sess.dir == "" {
+		sess.dir = sess.s.newShareDir()
+		sess.s.davDirs.Store(sess.dir, struct{}{})
+	}
+	return sess.reply(230, "Logged in, uploads are stored in /%s/", sess.dir)
+}
+
+// logout forgets the share dir of a session that did not upload anything.
+func (sess *ftpSession) logout(ctx context.Context) {
+	if sess.dir != "" && len(sess.s.index.inDir(sess.dir)) == 0 {
+		sess.dav.RemoveAll(ctx, "/"+sess.dir)
+	}
+}
+
+// resolve turns a client path into one relative to the session root.
+func (sess *ftpSession) resolve(p string) string {
+	if strings.HasPrefix(p, "/") {
+		return path.Clean(p)
+	}
+	return path.Join(sess.cwd, p)
+}
+
+// davName maps a session path into the session's share dir.
+func (sess *ftpSession) davName(p string) string {
+	return path.Join("/", sess.dir, p)
+}
+
+func (sess *ftpSession) changeDir(ctx context.Context, p string) error {
+	info, err := sess.dav.Stat(ctx, sess.davName(p))
+	if err != nil || !info.IsDir() {
+		return sess.reply(550, "No such directory")
+	}
+	sess.cwd = p
+	return sess.reply(250, "Directory changed to %s", p)
+}
+
+func (sess *ftpSession) fail(err error) error {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return sess.reply(550, "No such file or directory")
+	case errors.Is(err, os.ErrPermission):
+		return sess.reply(550, "Permission denied")
+	case errors.Is(err, os.ErrExist):
+		return sess.reply(550, "File exists")
+	case errors.Is(err, errTooLarge), errors.Is(err, errQuotaExceeded):
+		return sess.reply(552, "%s", err)
+	}
+	return sess.reply(451, "%s", err)
+}
+
+// enterPassive opens the listener the next transfer connects to, on the
+// address the client reached the control connection on.
+func (sess *ftpSession) enterPassive(extended bool) error {
+	sess.closePassive()
+	host := sess.conn.LocalAddr().(*net.TCPAddr).IP
+	if !extended && host.To4() == nil {
+		return sess.reply(522, "Use EPSV over IPv6")
+	}
+	ln, err := sess.listenPassive(host)
+	if err != nil {
+		return sess.reply(425, "Cannot open data connection")
+	}
+	sess.passive = ln
+	port := ln.Addr().(*net.TCPAddr).Port
+	if extended {
+		return sess.reply(229, "Entering Extended Passive Mode (|||%d|)", port)
+	}
+	ip := host.To4()
+	return sess.reply(227, "Entering Passive Mode (%d,%d,%d,%d,%d,%d)", ip[0], ip[1], ip[2], ip[3], port>>8, port&0xff)
+}
+
+func (sess *ftpSession) listenPassive(host net.IP) (net.Listener, error) {
+	if sess.minPort == 0 {
+		return net.Listen("tcp", net.JoinHostPort(host.String(), "0"))
+	}
+	var err error
+	for port := sess.minPort; port <= sess.maxPort; port++ {
+		var ln net.Listener
+		if ln, err = net.Listen("tcp", net.JoinHostPort(host.String(), strconv.Itoa(port))); err == nil {
+			return ln, nil
+		}
+	}
+	return nil, err
+}
+
+func (sess *ftpSession) closePassive() {
+	if sess.passive != nil {
+		sess.passive.Close()
+		sess.passive = nil
+	}
+}
+
+// dataConn accepts the transfer connection announced by PASV or EPSV. It
+// must come from the client's address, so nobody else can grab the file.
+func (sess *ftpSession) dataConn() (net.Conn, error) {
+	ln := sess.passive
+	sess.passive = nil
+	if ln == nil {
+		return nil, errors.New("use PASV or EPSV first")
+	}
+	defer ln.Close()
+	ln.(*net.TCPListener).SetDeadline(time.Now().Add(ftpDataTimeout))
+	want := sess.conn.RemoteAddr().(*net.TCPAddr).IP
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if conn.RemoteAddr().(*net.TCPAddr).IP.Equal(want) {
+			return conn, nil
+		}
+		conn.Close()
+	}
+}
+
+// transfer runs fn on the data connection, wrapped in the 150 and 226
+// replies.
+func (sess *ftpSession) transfer(fn func(conn net.Conn) error) error {
+	if sess.passive == nil {
+		return sess.reply(425, "Use PASV or EPSV first")
+	}
+	if err := sess.reply(150, "Opening data connection"); err != nil {
+		return err
+	}
+	conn, err := sess.dataConn()
+	if err != nil {
+		return sess.reply(425, "Cannot open data connection")
+	}
+	err = fn(conn)
+	conn.Close()
+	if err != nil {
+		return sess.fail(err)
+	}
+	return sess.reply(226, "Transfer complete")
+}
+
+func (sess *ftpSession) list(ctx context.Context, namesOnly bool, arg string) error {
+	// Clients pass ls options like -la, which all listings ignore.
+	if strings.HasPrefix(arg, "-") {
+		arg = ""
+	}
+	name := sess.davName(sess.resolve(arg))
+	info, err := sess.dav.Stat(ctx, name)
+	if err != nil {
+		return sess.reply(550, "No such file or directory")
+	}
+	entries := []os.FileInfo{info}
+	if info.IsDir() {
+		entries = sess.dav.readDir(davPath(name))
+	}
+	return sess.transfer(func(conn net.Conn) error {
+		w := bufio.NewWriter(conn)
+		for _, entry := range entries {
+			if namesOnly {
+				fmt.Fprintf(w, "%s\r\n", entry.Name())
+			} else {
+				fmt.Fprintf(w, "%s\r\n", lsLine(entry))
+			}
+		}
+		return w.Flush()
+	})
+}
+
+func (sess *ftpSession) retrieve(ctx context.Context, p string) error {
+	name := sess.davName(p)
+	if info, err := sess.dav.Stat(ctx, name); err != nil || info.IsDir() {
+		return sess.reply(550, "No such file")
+	}
+	file, err := sess.dav.OpenFile(ctx, name, os.O_RDONLY, 0)
+	if err != nil {
+		return sess.fail(err)
+	}
+	defer file.Close()
+	return sess.transfer(func(conn net.Conn) error {
+		_, err := io.Copy(conn, file)
+		return err
+	})
+}
+
+// store uploads into the session's share dir. A transfer the client breaks
+// off is dropped instead of stored truncated.
+func (sess *ftpSession) store(ctx context.Context, p string) error {
+	if p == "/" {
+		return sess.reply(553, "File name required")
+	}
+	file, err := sess.dav.OpenFile(ctx, sess.davName(p), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return sess.fail(err)
+	}
+	upload := file.(*davUpload)
+	stored := false
+	err = sess.transfer(func(conn net.Conn) error {
+		if _, err := io.Copy(upload, conn); err != nil {
+			return err
+		}
+		stored = true
+		return upload.Close()
+	})
+	if !stored {
+		upload.abort()
+	}
+	return err
+}
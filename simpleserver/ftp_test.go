@@ -0,0 +1,157 @@
+package simpleserver
+
+import (
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func startFTP(t *testing.T, config Config) (*Server, string) {
+	t.Helper()
+	s := newTestServer(t, config)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go s.acceptFTP(ln, 0, 0)
+	return s, ln.Addr().String()
+}
+
+func dialFTP(t *testing.T, addr string) *textproto.Conn {
+	t.Helper()
+	c, err := textproto.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	_, _, err = c.ReadResponse(220)
+	require.NoError(t, err)
+	return c
+}
+
+// ftpCmd sends a command and returns the reply code and message.
+func ftpCmd(t *testing.T, c *textproto.Conn, format string, args ...any) (int, string) {
+	t.Helper()
+	_, err := c.Cmd(format, args...)
+	require.NoError(t, err)
+	code, msg, err := c.ReadResponse(0)
+	if _, ok := err.(*textproto.Error); !ok {
+		require.NoError(t, err)
+	}
+	return code, msg
+}
+
+// ftpData enters extended passive mode and connects to the data port.
+func ftpData(t *testing.T, c *textproto.Conn, addr string) net.Conn {
+	t.Helper()
+	code, msg := ftpCmd(t, c, "EPSV")
+	require.Equal(t, 229, code, msg)
+	port := strings.TrimSuffix(msg[strings.Index(msg, "|||")+3:], "|)")
+	host, _, _ := net.SplitHostPort(addr)
+	conn, err := net.Dial("tcp", net.JoinHostPort(host, port))
+	require.NoError(t, err)
+	return conn
+}
+
+func TestFTPUploadAndDownload(t *testing.T) {
+	s, addr := startFTP(t, Config{AuthToken: testAuthToken, PreservePaths: true})
+	c := dialFTP(t, addr)
+
+	code, _ := ftpCmd(t, c, "PWD")
+	require.Equal(t, 530, code)
+	code, _ = ftpCmd(t, c, "USER camera")
+	require.Equal(t, 331, code)
+	code, _ = ftpCmd(t, c, "PASS wrong")
+	require.Equal(t, 530, code)
+	code, _ = ftpCmd(t, c, "PASS %s", testAuthToken)
+	require.Equal(t, 230, code)
+	dirs := shareDirs(t, s)
+	require.Len(t, dirs, 0)
+
+	code, _ = ftpCmd(t, c, "MKD photos")
+	require.Equal(t, 257, code)
+	code, _ = ftpCmd(t, c, "CWD photos")
+	require.Equal(t, 250, code)
+
+	data := ftpData(t, c, addr)
+	code, _ = ftpCmd(t, c, "STOR cat.txt")
+	require.Equal(t, 150, code)
+	_, err := io.WriteString(data, "meow")
+	require.NoError(t, err)
+	data.Close()
+	code, _, err = c.ReadResponse(226)
+	require.NoError(t, err, code)
+
+	dir := shareDirs(t, s)[0]
+	meta, ok := s.index.get(dir, "photos/cat.txt")
+	require.True(t, ok)
+	require.Equal(t, int64(len("meow")), meta.Size)
+
+	code, msg := ftpCmd(t, c, "SIZE /photos/cat.txt")
+	require.Equal(t, 213, code)
+	require.Equal(t, strconv.Itoa(len("meow")), msg)
+
+	data = ftpData(t, c, addr)
+	code, _ = ftpCmd(t, c, "RETR cat.txt")
+	require.Equal(t, 150, code)
+	body, err := io.ReadAll(data)
+	require.NoError(t, err)
+	require.Equal(t, "meow", string(body))
+	_, _, err = c.ReadResponse(226)
+	require.NoError(t, err)
+
+	data = ftpData(t, c, addr)
+	code, _ = ftpCmd(t, c, "NLST")
+	require.Equal(t, 150, code)
+	body, err = io.ReadAll(data)
+	require.NoError(t, err)
+	require.Equal(t, "cat.txt\r\n", string(body))
+	_, _, err = c.ReadResponse(226)
+	require.NoError(t, err)
+
+	code, _ = ftpCmd(t, c, "DELE cat.txt")
+	require.Equal(t, 250, code)
+	_, ok = s.index.get(dir, "photos/cat.txt")
+	require.False(t, ok)
+	code, _ = ftpCmd(t, c, "RETR cat.txt")
+	require.Equal(t, 550, code)
+	code, _ = ftpCmd(t, c, "PORT 127,0,0,1,4,1")
+	require.Equal(t, 502, code)
+}
+
+func TestFTPSessionsAreIsolated(t *testing.T) {
+	s, addr := startFTP(t, Config{})
+	for _, name := range []string{"a.txt", "b.txt"} {
+		c := dialFTP(t, addr)
+		ftpCmd(t, c, "USER anonymous")
+		code, _ := ftpCmd(t, c, "PASS guest")
+		require.Equal(t, 230, code)
+		data := ftpData(t, c, addr)
+		ftpCmd(t, c, "STOR ../../%s", name)
+		io.WriteString(data, name)
+		data.Close()
+		_, _, err := c.ReadResponse(226)
+		require.NoError(t, err)
+	}
+	dirs := shareDirs(t, s)
+	require.Len(t, dirs, 2)
+	for _, dir := range dirs {
+		require.Len(t, s.index.inDir(dir), 1)
+	}
+}
+
+func TestParsePortRange(t *testing.T) {
+	minPort, maxPort, err := parsePortRange("30000-30009")
+	require.NoError(t, err)
+	require.Equal(t, 30000, minPort)
+	require.Equal(t, 30009, maxPort)
+	minPort, maxPort, err = parsePortRange("")
+	require.NoError(t, err)
+	require.Zero(t, minPort+maxPort)
+	for _, ports := range []string{"30000", "2-1", "0-10", "1-70000", "a-b"} {
+		_, _, err := parsePortRange(ports)
+		require.Error(t, err, ports)
+	}
+}
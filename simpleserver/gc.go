@@ -0,0 +1,206 @@
+package simpleserver
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultGCInterval = time.Hour
+	// stalePartAge is how old a .part file must be before it is taken for
+	// the leftover of a crashed upload rather than one in progress.
+	stalePartAge = 24 * time.Hour
+)
+
+// gcReport lists what a garbage collection pass removed, or would remove
+// in a dry run.
+type gcReport struct {
+	DryRun bool `json:"dry_run"`
+	// EmptyDirs are share dirs left without any file.
+	EmptyDirs []string `json:"empty_dirs"`
+	// StaleParts are temporary files of uploads that never completed.
+	StaleParts []string `json:"stale_parts"`
+	// MissingFiles are metadata entries whose stored object is gone.
+	MissingFiles []string `json:"missing_files"`
+}
+
+func (r gcReport) removed() int {
+	return len(r.EmptyDirs) + len(r.StaleParts) + len(r.MissingFiles)
+}
+
+func (s *Server) gcInterval() time.Duration {
+	if s.config.GCInterval > 0 {
+		return s.config.GCInterval
+	}
+	return defaultGCInterval
+}
+
+// startGC collects garbage once before the server starts taking requests,
+// then every GCInterval in the background.
+func (s *Server) startGC() {
+	s.runGC()
+	go func() {
+		ticker := time.NewTicker(s.gcInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stopC:
+				return
+			case <-ticker.C:
+			}
+			s.runGC()
+		}
+	}()
+}
+
+func (s *Server) runGC() {
+	if s.readOnly.Load() {
+		return
+	}
+	if report := s.collectGarbage(time.Now(), false); report.removed() > 0 {
+		log.Printf("Garbage collection removed %d empty dirs, %d stale .part files and %d entries of missing files\n",
+			len(report.EmptyDirs), len(report.StaleParts), len(report.MissingFiles))
+	}
+}
+
+// collectGarbage removes what crashes and manual changes to the upload
+// directory leave behind. With dryRun it only reports it.
+func (s *Server) collectGarbage(now time.Time, dryRun bool) gcReport {
+	report := gcReport{DryRun: dryRun, EmptyDirs: []string{}, StaleParts: []string{}, MissingFiles: []string{}}
+	for _, meta := range s.missingFiles() {
+		if !dryRun {
+			if err := s.index.delete(meta.Dir, meta.Name); err != nil {
+				log.Printf("Failed to drop the entry of missing %s: %v\n", meta.key(), err)
+				continue
+			}
+		}
+		report.MissingFiles = append(report.MissingFiles, meta.key())
+	}
+	for _, part := range s.staleParts(now) {
+		if !dryRun {
+			if err := os.Remove(part); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				log.Printf("Failed to remove stale %s: %v\n", part, err)
+				continue
+			}
+		}
+		rel, _ := filepath.Rel(s.getUploadDir(), part)
+		report.StaleParts = append(report.StaleParts, filepath.ToSlash(rel))
+	}
+	for _, dir := range s.chunked.stale(now) {
+		if !dryRun {
+			if err := s.chunked.remove(filepath.Base(dir)); err != nil {
+				log.Printf("Failed to remove stale %s: %v\n", dir, err)
+				continue
+			}
+		}
+		rel, _ := filepath.Rel(s.getUploadDir(), dir)
+		report.StaleParts = append(report.StaleParts, filepath.ToSlash(rel))
+	}
+	for _, dir := range s.emptyShareDirs() {
+		// Remove fails when an upload arrived in the meantime.
+		if !dryRun && os.Remove(filepath.Join(s.getUploadDir(), dir)) != nil {
+			continue
+		}
+		report.EmptyDirs = append(report.EmptyDirs, dir)
+	}
+	return report
+}
+
+// missingFiles returns the metadata entries whose object is not stored.
+func (s *Server) missingFiles() []FileMeta {
+	// In a cluster the file may be stored by another server.
+	if len(s.config.Peers) > 0 {
+		return nil
+	}
+	ctx := context.Background()
+	// Entries are listed before the objects, so uploads stored meanwhile
+	// always have their object listed.
+	files := s.index.all()
+	objects, err := s.storage.List(ctx, "")
+	if err != nil {
+		log.Printf("Failed to list stored files: %v\n", err)
+		return nil
+	}
+	stored := make(map[string]bool, len(objects))
+	for _, obj := range objects {
+		stored[obj.Key] = true
+	}
+	var missing []FileMeta
+	for _, meta := range files {
+		if stored[meta.key()] {
+			continue
+		}
+		// Listings may skip some keys, such as dot files, so each one is
+		// looked up before it is taken for missing.
+		obj, err := s.storage.Get(ctx, meta.key())
+		if err == nil {
+			obj.Content.Close()
+			continue
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			missing = append(missing, meta)
+		}
+	}
+	return missing
+}
+
+// staleParts returns the .part files last written before now-stalePartAge.
+// Resumable uploads keep theirs until they expire, and chunked uploads are
+// collected as a whole.
+func (s *Server) staleParts(now time.Time) []string {
+	var parts []string
+	root := s.getUploadDir()
+	filepath.WalkDir(root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() {
+			if p == filepath.Join(root, tusDirName) || p == filepath.Join(root, chunkedDirName) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(entry.Name(), partSuffix) {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil && now.Sub(info.ModTime()) >= stalePartAge {
+			parts = append(parts, p)
+		}
+		return nil
+	})
+	return parts
+}
+
+// emptyShareDirs returns the share dirs of the upload directory holding no
+// file, except those drop shares claimed.
+func (s *Server) emptyShareDirs() []string {
+	entries, err := os.ReadDir(s.getUploadDir())
+	if err != nil {
+		return nil
+	}
+	var dirs []string
+	for _, entry := range entries {
+		if !entry.IsDir() || !isShareDir(entry.Name()) || s.claimedByDropShare(entry.Name()) {
+			continue
+		}
+		if children, err := os.ReadDir(filepath.Join(s.getUploadDir(), entry.Name())); err == nil && len(children) == 0 {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+	return dirs
+}
+
+// handleGC answers GET /admin/gc with what garbage collection would remove
+// and POST /admin/gc by collecting it right away.
+func (s *Server) handleGC(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.collectGarbage(time.Now(), c.Request().Method != http.MethodPost))
+}
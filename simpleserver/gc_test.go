@@ -0,0 +1,73 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writePart(t *testing.T, path string, age time.Duration) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte("partial"), 0644))
+	modTime := time.Now().Add(-age)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func gcRequest(t *testing.T, s *Server, method string) gcReport {
+	t.Helper()
+	rec := serve(s, adminRequest(method, "/admin/gc", ""))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var report gcReport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	return report
+}
+
+func TestGarbageCollection(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/kept.txt", strings.NewReader("kept")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	url := downloadURLs(t, rec.Body.String())[0]
+
+	root := s.getUploadDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "Empty1"), 0755))
+	writePart(t, filepath.Join(root, spoolDirName, "old"+partSuffix), 2*stalePartAge)
+	writePart(t, filepath.Join(root, spoolDirName, "recent"+partSuffix), time.Minute)
+	writePart(t, filepath.Join(root, tusDirName, "resumable"+partSuffix), 2*stalePartAge)
+	require.NoError(t, s.index.put(FileMeta{Dir: "Gone1", Name: "lost.txt", CreatedAt: time.Now()}))
+
+	want := gcReport{
+		DryRun:       true,
+		EmptyDirs:    []string{"Empty1"},
+		StaleParts:   []string{spoolDirName + "/old" + partSuffix},
+		MissingFiles: []string{"Gone1/lost.txt"},
+	}
+	require.Equal(t, want, gcRequest(t, s, http.MethodGet))
+	require.DirExists(t, filepath.Join(root, "Empty1"), "a dry run removes nothing")
+	require.Equal(t, 2, s.index.len())
+
+	want.DryRun = false
+	require.Equal(t, want, gcRequest(t, s, http.MethodPost))
+	require.NoDirExists(t, filepath.Join(root, "Empty1"))
+	require.NoFileExists(t, filepath.Join(root, spoolDirName, "old"+partSuffix))
+	require.FileExists(t, filepath.Join(root, spoolDirName, "recent"+partSuffix))
+	require.FileExists(t, filepath.Join(root, tusDirName, "resumable"+partSuffix))
+	_, ok := s.index.get("Gone1", "lost.txt")
+	require.False(t, ok)
+	require.Equal(t, "kept", download(t, s, url).Body.String())
+	require.Zero(t, gcRequest(t, s, http.MethodGet).removed())
+}
+
+func TestGarbageCollectionAtStartup(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "Empty1"), 0755))
+	newTestServer(t, Config{UploadDir: dir})
+	require.NoDirExists(t, filepath.Join(dir, "Empty1"))
+}
@@ -0,0 +1,612 @@
+package simpleserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// grpcChunkSize is how much of a file every Download message carries.
+const grpcChunkSize = 64 << 10
+
+// serveGRPC serves FileService on GRPCPort until shutdownC is closed. It
+// uses the same certificate as HTTPS when TLS is enabled.
+func (s *Server) serveGRPC(shutdownC <-chan struct{}) {
+	if s.settings().AuthToken == "" {
+		log.Printf("Failed to serve gRPC: --grpc-port requires --auth-token\n")
+		return
+	}
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		log.Printf("Failed to serve gRPC: %v\n", err)
+		return
+	}
+	ln, err := s.listen(s.config.GRPCPort)
+	if err != nil {
+		log.Printf("Failed to serve gRPC: %v\n", err)
+		return
+	}
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	srv := s.newGRPCServer(opts...)
+	fmt.Printf("gRPC available on port %d\n", ln.Addr().(*net.TCPAddr).Port)
+	go func() {
+		<-shutdownC
+		srv.Stop()
+	}()
+	if err := srv.Serve(ln); err != nil {
+		log.Printf("gRPC server stopped: %v\n", err)
+	}
+}
+
+func (s *Server) newGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.ForceServerCodec(grpcCodec{}),
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := s.grpcAuthorize(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := s.grpcAuthorize(stream.Context()); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	)
+	srv := grpc.NewServer(opts...)
+	srv.RegisterService(&fileServiceDesc, fileService{s: s})
+	return srv
+}
+
+// grpcAuthorize checks the bearer token sent in the authorization metadata.
+func (s *Server) grpcAuthorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		presented, ok := strings.CutPrefix(value, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(presented), []byte(s.settings().AuthToken)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "Unauthorized")
+}
+
+// fileServiceServer is implemented by fileService. It only exists because
+// grpc checks registered services against an interface.
+type fileServiceServer interface {
+	upload(stream grpc.ServerStream) error
+	download(req *downloadRequest, stream grpc.ServerStream) error
+	list(ctx context.Context, req *listRequest) (*listResponse, error)
+	delete(ctx context.Context, req *deleteRequest) (*deleteResponse, error)
+}
+
+// fileServiceDesc describes the service declared in fileservice.proto.
+var fileServiceDesc = grpc.ServiceDesc{
+	ServiceName: "simpleserver.FileService",
+	HandlerType: (*fileServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "List",
+			Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+				req := new(listRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				handler := func(ctx context.Context, req any) (any, error) {
+					return srv.(fileServiceServer).list(ctx, req.(*listRequest))
+				}
+				if interceptor == nil {
+					return handler(ctx, req)
+				}
+				return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/simpleserver.FileService/List"}, handler)
+			},
+		},
+		{
+			MethodName: "Delete",
+			Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+				req := new(deleteRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				handler := func(ctx context.Context, req any) (any, error) {
+					return srv.(fileServiceServer).delete(ctx, req.(*deleteRequest))
+				}
+				if interceptor == nil {
+					return handler(ctx, req)
+				}
+				return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/simpleserver.FileService/Delete"}, handler)
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Upload",
+			ClientStreams: true,
+			Handler: func(srv any, stream grpc.ServerStream) error {
+				return srv.(fileServiceServer).upload(stream)
+			},
+		},
+		{
+			StreamName:    "Download",
+			ServerStreams: true,
+			Handler: func(srv any, stream grpc.ServerStream) error {
+				req := new(downloadRequest)
+				if err := stream.RecvMsg(req); err != nil {
+					return err
+				}
+				return srv.(fileServiceServer).download(req, stream)
+			},
+		},
+	},
+	Metadata: "fileservice.proto",
+}
+
+// fileService serves the same uploads as WebDAV does, leaving out the files
+// that need a password or count their downloads.
+type fileService struct {
+	s *Server
+}
+
+func (f fileService) upload(stream grpc.ServerStream) error {
+	s := f.s
+	first := new(uploadRequest)
+	if err := stream.RecvMsg(first); err != nil {
+		return err
+	}
+	if s.uploadsOff() {
+		return status.Error(codes.Unavailable, "Uploads are paused")
+	}
+	name, err := s.uploadFilename(first.Filename)
+	if err != nil {
+		return grpcUploadError(err)
+	}
+	dir := first.Dir
+	if dir == "" {
+		dir = s.newShareDir()
+	} else if !isShareDir(dir) || len(s.index.inDir(dir)) == 0 {
+		return status.Error(codes.NotFound, "Directory not found")
+	}
+	if _, ok := s.index.get(dir, name); ok {
+		return status.Error(codes.AlreadyExists, "File already exists")
+	}
+	ctx := stream.Context()
+	r := &grpcUploadReader{stream: stream, buf: first.Data}
+	opts := uploadOptions{TTL: s.config.TTL, MaxBytes: int64(s.maxSize()) << 20, SHA256: strings.ToLower(first.SHA256)}
+	meta, err := s.storeFile(ctx, dir, name, r, opts)
+	if err == nil {
+		if err = s.confirmUpload(ctx, meta); err != nil {
+			s.removeFile(meta)
+		}
+	}
+	if err != nil {
+		return grpcUploadError(err)
+	}
+	s.publishEvent(Event{Type: EventUpload, Dir: meta.Dir, Filename: meta.Name, Size: meta.Size, SHA256: meta.SHA256, ClientIP: grpcClientIP(ctx)})
+	return stream.SendMsg(grpcFileInfo(meta))
+}
+
+// grpcUploadReader reads the data of the UploadRequest messages on stream.
+type grpcUploadReader struct {
+	stream grpc.ServerStream
+	buf    []byte
+}
+
+func (r *grpcUploadReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		msg := new(uploadRequest)
+		if err := r.stream.RecvMsg(msg); err != nil {
+			return 0, err
+		}
+		r.buf = msg.Data
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// grpcUploadError maps an error returned by storeFile to a status, the same
+// way uploadErrorStatus does for HTTP.
+func grpcUploadError(err error) error {
+	code := codes.Internal
+	switch uploadErrorStatus(err) {
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity:
+		code = codes.InvalidArgument
+	case http.StatusRequestEntityTooLarge, http.StatusInsufficientStorage, http.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	case http.StatusConflict:
+		code = codes.AlreadyExists
+	case http.StatusUnauthorized, http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		code = codes.Unavailable
+	default:
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		log.Printf("Failed to save gRPC upload: %v\n", err)
+		return status.Error(code, "Failed to save file")
+	}
+	return status.Error(code, err.Error())
+}
+
+func (f fileService) download(req *downloadRequest, stream grpc.ServerStream) error {
+	s := f.s
+	meta, ok := s.index.get(req.Dir, req.Filename)
+	if !ok || !meta.servedInBulk(time.Now()) {
+		return status.Error(codes.NotFound, "File not found")
+	}
+	if req.Offset < 0 || req.Offset > meta.Size {
+		return status.Error(codes.OutOfRange, "Offset is beyond the end of the file")
+	}
+	ctx := stream.Context()
+	file := &davFile{s: s, ctx: ctx, meta: meta, pos: req.Offset}
+	defer file.Close()
+	buf := make([]byte, grpcChunkSize)
+	var sent int64
+	for {
+		n, err := io.ReadFull(file, buf)
+		if n > 0 {
+			if err := stream.SendMsg(&chunk{Data: buf[:n]}); err != nil {
+				return err
+			}
+			sent += int64(n)
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			log.Printf("Failed to read %s/%s: %v\n", meta.Dir, meta.Name, err)
+			return status.Error(codes.Internal, "Failed to read file")
+		}
+	}
+	s.publishEvent(Event{Type: EventDownload, Dir: meta.Dir, Filename: meta.Name, Size: meta.Size, Bytes: sent, ClientIP: grpcClientIP(ctx)})
+	return nil
+}
+
+func (f fileService) list(ctx context.Context, req *listRequest) (*listResponse, error) {
+	files := f.s.index.all()
+	if req.Dir != "" {
+		files = f.s.index.inDir(req.Dir)
+	}
+	now := time.Now()
+	response := &listResponse{}
+	for _, meta := range files {
+		if meta.servedInBulk(now) {
+			response.Files = append(response.Files, grpcFileInfo(meta))
+		}
+	}
+	return response, nil
+}
+
+func (f fileService) delete(ctx context.Context, req *deleteRequest) (*deleteResponse, error) {
+	if f.s.readOnly.Load() {
+		return nil, status.Error(codes.Unavailable, "The server is read-only")
+	}
+	meta, ok := f.s.index.get(req.Dir, req.Filename)
+	if !ok {
+		return nil, status.Error(codes.NotFound, "File not found")
+	}
+	if err := f.s.deleteFile(meta); err != nil {
+		log.Printf("Failed to delete %s/%s: %v\n", meta.Dir, meta.Name, err)
+		return nil, status.Error(codes.Internal, "Failed to delete file")
+	}
+	return &deleteResponse{}, nil
+}
+
+func grpcClientIP(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return host
+		}
+	}
+	return ""
+}
+
+// grpcCodec encodes the messages of fileservice.proto by hand. Its name is
+// "proto", so clients generated from the .proto file talk to it as usual.
+type grpcCodec struct{}
+
+// grpcMessage is a message grpcCodec can encode.
+type grpcMessage interface {
+	marshal() []byte
+	unmarshal(b []byte) error
+}
+
+func (grpcCodec) Marshal(v any) ([]byte, error) {
+	msg, ok := v.(grpcMessage)
+	if !ok {
+		return nil, fmt.Errorf("cannot encode %T", v)
+	}
+	return msg.marshal(), nil
+}
+
+func (grpcCodec) Unmarshal(data []byte, v any) error {
+	msg, ok := v.(grpcMessage)
+	if !ok {
+		return fmt.Errorf("cannot decode %T", v)
+	}
+	return msg.unmarshal(data)
+}
+
+func (grpcCodec) Name() string {
+	return "proto"
+}
+
+// decodeFields calls field with every field of the message b. Length
+// delimited values are passed as []byte, varints as uint64, and fields of
+// other wire types are skipped.
+func decodeFields(b []byte, field func(num protowire.Number, v any)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		var v any
+		switch typ {
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if v != nil {
+			field(num, v)
+		}
+	}
+	return nil
+}
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	return protowire.AppendString(protowire.AppendTag(b, num, protowire.BytesType), v)
+}
+
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	return protowire.AppendBytes(protowire.AppendTag(b, num, protowire.BytesType), v)
+}
+
+func appendInt64(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	return protowire.AppendVarint(protowire.AppendTag(b, num, protowire.VarintType), uint64(v))
+}
+
+// stringField and int64Field convert values passed by decodeFields,
+// leaving out values of the wrong wire type.
+func stringField(v any) string {
+	b, _ := v.([]byte)
+	return string(b)
+}
+
+func int64Field(v any) int64 {
+	n, _ := v.(uint64)
+	return int64(n)
+}
+
+type uploadRequest struct {
+	Dir      string
+	Filename string
+	SHA256   string
+	Data     []byte
+}
+
+func (m *uploadRequest) marshal() []byte {
+	b := appendString(nil, 1, m.Dir)
+	b = appendString(b, 2, m.Filename)
+	b = appendString(b, 3, m.SHA256)
+	return appendBytes(b, 4, m.Data)
+}
+
+func (m *uploadRequest) unmarshal(b []byte) error {
+	return decodeFields(b, func(num protowire.Number, v any) {
+		switch num {
+		case 1:
+			m.Dir = stringField(v)
+		case 2:
+			m.Filename = stringField(v)
+		case 3:
+			m.SHA256 = stringField(v)
+		case 4:
+			data, _ := v.([]byte)
+			// The buffer b may be reused once the message is decoded.
+			m.Data = bytes.Clone(data)
+		}
+	})
+}
+
+type downloadRequest struct {
+	Dir      string
+	Filename string
+	Offset   int64
+}
+
+func (m *downloadRequest) marshal() []byte {
+	b := appendString(nil, 1, m.Dir)
+	b = appendString(b, 2, m.Filename)
+	return appendInt64(b, 3, m.Offset)
+}
+
+func (m *downloadRequest) unmarshal(b []byte) error {
+	return decodeFields(b, func(num protowire.Number, v any) {
+		switch num {
+		case 1:
+			m.Dir = stringField(v)
+		case 2:
+			m.Filename = stringField(v)
+		case 3:
+			m.Offset = int64Field(v)
+		}
+	})
+}
+
+type chunk struct {
+	Data []byte
+}
+
+func (m *chunk) marshal() []byte {
+	return appendBytes(nil, 1, m.Data)
+}
+
+func (m *chunk) unmarshal(b []byte) error {
+	return decodeFields(b, func(num protowire.Number, v any) {
+		if data, ok := v.([]byte); ok && num == 1 {
+			m.Data = append(m.Data, data...)
+		}
+	})
+}
+
+type listRequest struct {
+	Dir string
+}
+
+func (m *listRequest) marshal() []byte {
+	return appendString(nil, 1, m.Dir)
+}
+
+func (m *listRequest) unmarshal(b []byte) error {
+	return decodeFields(b, func(num protowire.Number, v any) {
+		if num == 1 {
+			m.Dir = stringField(v)
+		}
+	})
+}
+
+type listResponse struct {
+	Files []*fileInfo
+}
+
+func (m *listResponse) marshal() []byte {
+	var b []byte
+	for _, file := range m.Files {
+		b = protowire.AppendBytes(protowire.AppendTag(b, 1, protowire.BytesType), file.marshal())
+	}
+	return b
+}
+
+func (m *listResponse) unmarshal(b []byte) error {
+	var err error
+	decodeErr := decodeFields(b, func(num protowire.Number, v any) {
+		if data, ok := v.([]byte); ok && num == 1 && err == nil {
+			file := new(fileInfo)
+			err = file.unmarshal(data)
+			m.Files = append(m.Files, file)
+		}
+	})
+	return errors.Join(decodeErr, err)
+}
+
+type deleteRequest struct {
+	Dir      string
+	Filename string
+}
+
+func (m *deleteRequest) marshal() []byte {
+	b := appendString(nil, 1, m.Dir)
+	return appendString(b, 2, m.Filename)
+}
+
+func (m *deleteRequest) unmarshal(b []byte) error {
+	return decodeFields(b, func(num protowire.Number, v any) {
+		switch num {
+		case 1:
+			m.Dir = stringField(v)
+		case 2:
+			m.Filename = stringField(v)
+		}
+	})
+}
+
+type deleteResponse struct{}
+
+func (m *deleteResponse) marshal() []byte { return nil }
+
+func (m *deleteResponse) unmarshal(b []byte) error {
+	return decodeFields(b, func(protowire.Number, any) {})
+}
+
+type fileInfo struct {
+	Dir         string
+	Filename    string
+	Size        int64
+	SHA256      string
+	ContentType string
+	CreatedAt   int64
+	ExpiresAt   int64
+}
+
+func grpcFileInfo(meta FileMeta) *fileInfo {
+	info := &fileInfo{
+		Dir:         meta.Dir,
+		Filename:    meta.Name,
+		Size:        meta.Size,
+		SHA256:      meta.SHA256,
+		ContentType: meta.contentType(),
+		CreatedAt:   meta.CreatedAt.Unix(),
+	}
+	if !meta.ExpiresAt.IsZero() {
+		info.ExpiresAt = meta.ExpiresAt.Unix()
+	}
+	return info
+}
+
+func (m *fileInfo) marshal() []byte {
+	b := appendString(nil, 1, m.Dir)
+	b = appendString(b, 2, m.Filename)
+	b = appendInt64(b, 3, m.Size)
+	b = appendString(b, 4, m.SHA256)
+	b = appendString(b, 5, m.ContentType)
+	b = appendInt64(b, 6, m.CreatedAt)
+	return appendInt64(b, 7, m.ExpiresAt)
+}
+
+func (m *fileInfo) unmarshal(b []byte) error {
+	return decodeFields(b, func(num protowire.Number, v any) {
+		switch num {
+		case 1:
+			m.Dir = stringField(v)
+		case 2:
+			m.Filename = stringField(v)
+		case 3:
+			m.Size = int64Field(v)
+		case 4:
+			m.SHA256 = stringField(v)
+		case 5:
+			m.ContentType = stringField(v)
+		case 6:
+			m.CreatedAt = int64Field(v)
+		case 7:
+			m.ExpiresAt = int64Field(v)
+		}
+	})
+}
@@ -0,0 +1,154 @@
+package simpleserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func startGRPC(t *testing.T, config Config) (*Server, *grpc.ClientConn) {
+	t.Helper()
+	s := newTestServer(t, config)
+	srv := s.newGRPCServer()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srv.Serve(ln)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient(ln.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(grpcCodec{})))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return s, conn
+}
+
+func grpcContext(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func grpcUpload(ctx context.Context, conn *grpc.ClientConn, msgs ...*uploadRequest) (*fileInfo, error) {
+	stream, err := conn.NewStream(ctx, &fileServiceDesc.Streams[0], "/simpleserver.FileService/Upload")
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range msgs {
+		if err := stream.SendMsg(msg); err != nil {
+			break
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	info := new(fileInfo)
+	return info, stream.RecvMsg(info)
+}
+
+func grpcDownload(t *testing.T, ctx context.Context, conn *grpc.ClientConn, req *downloadRequest) (string, error) {
+	t.Helper()
+	stream, err := conn.NewStream(ctx, &fileServiceDesc.Streams[1], "/simpleserver.FileService/Download")
+	require.NoError(t, err)
+	require.NoError(t, stream.SendMsg(req))
+	require.NoError(t, stream.CloseSend())
+	var content strings.Builder
+	for {
+		c := new(chunk)
+		err := stream.RecvMsg(c)
+		if err == io.EOF {
+			return content.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		content.Write(c.Data)
+	}
+}
+
+func TestGRPCUploadAndDownload(t *testing.T) {
+	s, conn := startGRPC(t, Config{AuthToken: testAuthToken})
+	ctx := grpcContext(testAuthToken)
+	sum := sha256.Sum256([]byte("hello world"))
+
+	info, err := grpcUpload(ctx, conn,
+		&uploadRequest{Filename: "hello.txt", SHA256: hex.EncodeToString(sum[:]), Data: []byte("hello")},
+		&uploadRequest{Data: []byte(" world")})
+	require.NoError(t, err)
+	require.Equal(t, "hello.txt", info.Filename)
+	require.Equal(t, int64(len("hello world")), info.Size)
+	require.Equal(t, hex.EncodeToString(sum[:]), info.SHA256)
+	require.Equal(t, "hello world", download(t, s, "/"+info.Dir+"/hello.txt").Body.String())
+
+	content, err := grpcDownload(t, ctx, conn, &downloadRequest{Dir: info.Dir, Filename: "hello.txt", Offset: 6})
+	require.NoError(t, err)
+	require.Equal(t, "world", content)
+	_, err = grpcDownload(t, ctx, conn, &downloadRequest{Dir: info.Dir, Filename: "missing.txt"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	// A second file can join the share dir, but not replace the first.
+	_, err = grpcUpload(ctx, conn, &uploadRequest{Dir: info.Dir, Filename: "other.txt", Data: []byte("other")})
+	require.NoError(t, err)
+	_, err = grpcUpload(ctx, conn, &uploadRequest{Dir: info.Dir, Filename: "hello.txt", Data: []byte("again")})
+	require.Equal(t, codes.AlreadyExists, status.Code(err))
+	_, err = grpcUpload(ctx, conn, &uploadRequest{Filename: "bad.txt", SHA256: strings.Repeat("0", 64), Data: []byte("bad")})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	list := new(listResponse)
+	require.NoError(t, conn.Invoke(ctx, "/simpleserver.FileService/List", &listRequest{Dir: info.Dir}, list))
+	require.Len(t, list.Files, 2)
+
+	require.NoError(t, conn.Invoke(ctx, "/simpleserver.FileService/Delete", &deleteRequest{Dir: info.Dir, Filename: "hello.txt"}, new(deleteResponse)))
+	_, ok := s.index.get(info.Dir, "hello.txt")
+	require.False(t, ok)
+	err = conn.Invoke(ctx, "/simpleserver.FileService/Delete", &deleteRequest{Dir: info.Dir, Filename: "hello.txt"}, new(deleteResponse))
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestGRPCHidesProtectedFiles(t *testing.T) {
+	s, conn := startGRPC(t, Config{AuthToken: testAuthToken})
+	req := authorized(httptest.NewRequest(http.MethodPut, "/secret.txt", strings.NewReader("secret")), testAuthToken)
+	req.Header.Set("X-Max-Downloads", "1")
+	require.Equal(t, http.StatusCreated, serve(s, req).Code)
+	meta := findMeta(t, s, "secret.txt")
+
+	ctx := grpcContext(testAuthToken)
+	list := new(listResponse)
+	require.NoError(t, conn.Invoke(ctx, "/simpleserver.FileService/List", &listRequest{}, list))
+	require.Empty(t, list.Files)
+	_, err := grpcDownload(t, ctx, conn, &downloadRequest{Dir: meta.Dir, Filename: meta.Name})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestGRPCRequiresAuthToken(t *testing.T) {
+	_, conn := startGRPC(t, Config{AuthToken: testAuthToken})
+	err := conn.Invoke(grpcContext("wrong"), "/simpleserver.FileService/List", &listRequest{}, new(listResponse))
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = grpcUpload(context.Background(), conn, &uploadRequest{Filename: "a.txt", Data: []byte("a")})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestGRPCMessagesRoundTrip(t *testing.T) {
+	info := &fileInfo{Dir: "abc", Filename: "a/b.txt", Size: 1 << 40, SHA256: "00", ContentType: "text/plain", CreatedAt: 1700000000}
+	list := &listResponse{Files: []*fileInfo{info, {Filename: "c"}}}
+	decoded := new(listResponse)
+	require.NoError(t, decoded.unmarshal(list.marshal()))
+	require.Equal(t, list, decoded)
+
+	req := &downloadRequest{Dir: "abc", Filename: "b.txt", Offset: 42}
+	decodedReq := new(downloadRequest)
+	require.NoError(t, decodedReq.unmarshal(req.marshal()))
+	require.Equal(t, req, decodedReq)
+
+	require.Error(t, new(fileInfo).unmarshal([]byte{0x0a, 0x05, 'a'}))
+}
@@ -0,0 +1,57 @@
+package simpleserver
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	// defaultCSP lets the built-in pages show inline styles and images
+	// and post their forms, and nothing else. Uploaded HTML opened in the
+	// browser runs no scripts and loads nothing.
+	defaultCSP            = "default-src 'none'; img-src 'self' data:; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'"
+	defaultFrameOptions   = "DENY"
+	defaultReferrerPolicy = "no-referrer"
+	// uiCSP additionally allows the script of the upload page.
+	uiCSP = "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; frame-ancestors 'none'"
+
+	// headerOff leaves a security header out.
+	headerOff = "off"
+)
+
+// securityHeader returns value, fallback when it is empty, or "" when it is
+// off.
+func securityHeader(value, fallback string) string {
+	switch {
+	case strings.EqualFold(value, headerOff):
+		return ""
+	case value == "":
+		return fallback
+	}
+	return value
+}
+
+// securityHeaders sends the hardened headers with every response. Static
+// sites bring their own scripts and styles, so they get no default CSP.
+func (s *Server) securityHeaders() echo.MiddlewareFunc {
+	csp := defaultCSP
+	if s.config.ServeDir != "" {
+		csp = ""
+	}
+	return middleware.SecureWithConfig(middleware.SecureConfig{
+		ContentTypeNosniff:    "nosniff",
+		XFrameOptions:         securityHeader(s.config.FrameOptions, defaultFrameOptions),
+		ContentSecurityPolicy: securityHeader(s.config.ContentSecurityPolicy, csp),
+		ReferrerPolicy:        securityHeader(s.config.ReferrerPolicy, defaultReferrerPolicy),
+	})
+}
+
+// pageCSP sets the CSP of a built-in page unless the operator configured
+// their own.
+func (s *Server) pageCSP(c echo.Context, csp string) {
+	if s.config.ContentSecurityPolicy == "" {
+		c.Response().Header().Set(echo.HeaderContentSecurityPolicy, csp)
+	}
+}
@@ -0,0 +1,54 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecurityHeadersOnDownloads(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/page.html", strings.NewReader("<script>alert(1)</script>")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = download(t, s, downloadURLs(t, rec.Body.String())[0])
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"))
+	require.Equal(t, "DENY", rec.Header().Get("X-Frame-Options"))
+	require.Equal(t, "no-referrer", rec.Header().Get("Referrer-Policy"))
+	require.Equal(t, defaultCSP, rec.Header().Get("Content-Security-Policy"))
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, uiCSP, rec.Header().Get("Content-Security-Policy"), "the upload page runs its script")
+}
+
+func TestSecurityHeadersConfigurable(t *testing.T) {
+	s := newTestServer(t, Config{
+		ContentSecurityPolicy: "default-src 'self'",
+		FrameOptions:          "off",
+		ReferrerPolicy:        "same-origin",
+	})
+	rec := serve(s, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "default-src 'self'", rec.Header().Get("Content-Security-Policy"))
+	require.Empty(t, rec.Header().Values("X-Frame-Options"))
+	require.Equal(t, "same-origin", rec.Header().Get("Referrer-Policy"))
+	require.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"))
+
+	s = newTestServer(t, Config{ContentSecurityPolicy: "off"})
+	rec = serve(s, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Empty(t, rec.Header().Values("Content-Security-Policy"))
+
+	require.ErrorContains(t, Config{UploadDir: t.TempDir(), FrameOptions: "ALLOW-FROM x"}.Validate(), "--frame-options")
+}
+
+func TestStaticSitesGetNoDefaultCSP(t *testing.T) {
+	s := newStaticServer(t)
+	rec := serve(s, httptest.NewRequest(http.MethodGet, "/site/", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Empty(t, rec.Header().Values("Content-Security-Policy"))
+	require.Equal(t, "DENY", rec.Header().Get("X-Frame-Options"))
+}
@@ -0,0 +1,232 @@
+package simpleserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	startupPath = "/startupz"
+	livePath    = "/livez"
+	healthPath  = "/healthz"
+	readyPath   = "/readyz"
+)
+
+// defaultMinFreeSpace is the MB --min-free-space keeps free by default.
+const defaultMinFreeSpace = 100
+
+// readyTimeout bounds how long the storage backend may take to answer a
+// readiness check.
+const readyTimeout = 5 * time.Second
+
+// probeStatus is the JSON body of /healthz and /readyz. Checks holds the
+// outcome of every readiness check, "ok" or what is wrong.
+type probeStatus struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// startup loads the metadata index and flips the server into the started
+// state. Until then only the probe endpoints answer.
+func (s *Server) startup() error {
+	if err := s.openStore(); err != nil {
+		return err
+	}
+	var err error
+	if s.config.AccessTeamDomain != "" || s.config.OIDCIssuer != "" {
+		if s.access, err = newAccessVerifier(context.Background(), s.config); err != nil {
+			return err
+		}
+	}
+	if s.config.AuditLog != "" {
+		if s.auditLog, err = openAuditLog(s.config.AuditLog); err != nil {
+			return err
+		}
+	}
+	if s.config.TemplatesDir != "" {
+		if s.templates, err = loadTemplates(s.config.TemplatesDir); err != nil {
+			return err
+		}
+	}
+	if s.config.RetentionFile != "" {
+		if s.retention, err = loadRetention(s.config.RetentionFile); err != nil {
+			return err
+		}
+	}
+	if s.config.UsersFile != "" {
+		if s.users, err = loadUsers(s.config.UsersFile); err != nil {
+			return err
+		}
+	}
+	if s.config.ReceiptKeyFile != "" {
+		key, err := loadReceiptKey(s.config.ReceiptKeyFile)
+		if err != nil {
+			return err
+		}
+		s.receiptKey = key
+	}
+	if s.signingKey, err = newSigningKey(s.config.URLSigningKey); err != nil {
+		return err
+	}
+	if s.scanner == nil && s.config.ClamAVAddress != "" {
+		s.scanner = newClamdScanner(s.config.ClamAVAddress)
+	}
+	rates, err := newRateStore(s.config)
+	if err != nil {
+		return err
+	}
+	s.rates = rates
+	// Before garbage collection, which would drop the entries of missing
+	// files without a trace.
+	if !s.config.NoReconcile && !s.readOnly.Load() {
+		s.reconcile(time.Now())
+	}
+	if err := s.startReplication(); err != nil {
+		return err
+	}
+	s.startClusterSync()
+	s.startProcessing()
+	s.startReaper()
+	s.startGC()
+	s.startScrubber()
+	s.started.Store(true)
+	return nil
+}
+
+// openStore opens the storage backend and loads the metadata index, all
+// that is needed to work on the stored files.
+func (s *Server) openStore() error {
+	if err := os.MkdirAll(s.getUploadDir(), 0755); err != nil {
+		return err
+	}
+	if s.storage == nil {
+		storage, err := newStorage(s.config, s.getUploadDir())
+		if err != nil {
+			return err
+		}
+		s.storage = storage
+	}
+	store, err := newMetadataStore(s.config, s.getUploadDir())
+	if err != nil {
+		return err
+	}
+	s.index.store = store
+	if err := s.indexLoader(); err != nil {
+		return err
+	}
+	if err := s.drops.load(); err != nil {
+		return err
+	}
+	if s.config.EncryptKey != "" {
+		if s.cipher, err = newFileCipher(s.config.EncryptKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isProbePath reports whether p is polled by health checks or metric
+// scrapers, which are answered even while starting and never rate limited.
+func isProbePath(p string) bool {
+	return p == startupPath || p == livePath || p == healthPath || p == readyPath || p == metricsPath
+}
+
+// requireStarted rejects regular traffic while the index is still loading, so
+// requests never observe a partially built index.
+func (s *Server) requireStarted(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !s.started.Load() && !isProbePath(c.Request().URL.Path) {
+			c.Response().Header().Set("Retry-After", "1")
+			return fail(c, http.StatusServiceUnavailable, "Server is starting")
+		}
+		return next(c)
+	}
+}
+
+func (s *Server) handleStartup(c echo.Context) error {
+	if !s.started.Load() {
+		return c.JSON(http.StatusServiceUnavailable, probeStatus{Status: "starting"})
+	}
+	return c.JSON(http.StatusOK, probeStatus{Status: "ok"})
+}
+
+func (s *Server) handleLive(c echo.Context) error {
+	return c.String(http.StatusOK, "ok")
+}
+
+// handleHealth answers as long as the process serves requests at all.
+func (s *Server) handleHealth(c echo.Context) error {
+	return c.JSON(http.StatusOK, probeStatus{Status: "ok"})
+}
+
+// handleReady answers 503 while the server starts or any readiness check
+// fails, so load balancers route around the instance.
+func (s *Server) handleReady(c echo.Context) error {
+	if !s.started.Load() {
+		return c.JSON(http.StatusServiceUnavailable, probeStatus{Status: "starting"})
+	}
+	checks := s.readinessChecks(c.Request().Context())
+	for _, result := range checks {
+		if result != "ok" {
+			return c.JSON(http.StatusServiceUnavailable, probeStatus{Status: "unavailable", Checks: checks})
+		}
+	}
+	return c.JSON(http.StatusOK, probeStatus{Status: "ok", Checks: checks})
+}
+
+// readinessChecks checks the dependencies needed to serve requests: that
+// the upload directory takes new files, that the storage backend answers and
+// that the disk keeps MinFreeSpace MB free.
+func (s *Server) readinessChecks(ctx context.Context) map[string]string {
+	checks := map[string]string{
+		"upload_dir": "ok",
+		"storage":    "ok",
+		"disk_space": "ok",
+	}
+	dir := s.getUploadDir()
+	if err := checkWritable(dir); err != nil {
+		checks["upload_dir"] = err.Error()
+	}
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+	if obj, err := s.storage.Get(ctx, readyProbeKey); err == nil {
+		obj.Content.Close()
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		checks["storage"] = err.Error()
+	}
+	if s.config.MinFreeSpace > 0 {
+		free, err := freeSpace(dir)
+		if err != nil {
+			checks["disk_space"] = err.Error()
+		} else if free < int64(s.config.MinFreeSpace)<<20 {
+			checks["disk_space"] = fmt.Sprintf("%d MB free, below %d MB", free>>20, s.config.MinFreeSpace)
+		}
+	}
+	return checks
+}
+
+// readyProbeKey is looked up to tell whether the storage backend answers. It
+// is never stored, a missing object is the expected answer.
+const readyProbeKey = ".readyz"
+
+// checkWritable creates and removes a file in dir. Hidden files are skipped
+// by listings, so a concurrent one never sees it.
+func checkWritable(dir string) error {
+	file, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	name := file.Name()
+	err = file.Close()
+	if removeErr := os.Remove(name); err == nil {
+		err = removeErr
+	}
+	return err
+}
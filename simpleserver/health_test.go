@@ -0,0 +1,98 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartupProbeWaitsForIndexLoad(t *testing.T) {
+	s := New(Config{UploadDir: t.TempDir()})
+	release := make(chan struct{})
+	load := s.indexLoader
+	s.indexLoader = func() error {
+		<-release
+		return load()
+	}
+	done := make(chan error)
+	go func() { done <- s.startup() }()
+
+	rec := serve(s, httptest.NewRequest(http.MethodGet, startupPath, nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.JSONEq(t, `{"status":"starting"}`, rec.Body.String())
+	rec = serve(s, httptest.NewRequest(http.MethodGet, readyPath, nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	rec = serve(s, httptest.NewRequest(http.MethodGet, livePath, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = serve(s, httptest.NewRequest(http.MethodPut, "/early.txt", strings.NewReader("too early")))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	close(release)
+	require.NoError(t, <-done)
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, startupPath, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"status":"ok"}`, rec.Body.String())
+	rec = serve(s, httptest.NewRequest(http.MethodGet, readyPath, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = serve(s, httptest.NewRequest(http.MethodPut, "/late.txt", strings.NewReader("on time")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+}
+
+func TestIndexReloadsFromSidecars(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("notes")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	dir := shareDirs(t, s)[0]
+
+	restarted := newTestServer(t, Config{UploadDir: s.config.UploadDir})
+	meta, ok := restarted.index.get(dir, "notes.txt")
+	require.True(t, ok)
+	require.Equal(t, int64(len("notes")), meta.Size)
+}
+
+func TestHealthAndReadinessReportJSON(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodGet, healthPath, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"status":"ok"}`, rec.Body.String())
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, readyPath, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"status":"ok","checks":{"upload_dir":"ok","storage":"ok","disk_space":"ok"}}`, rec.Body.String())
+	entries, err := os.ReadDir(s.config.UploadDir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		require.False(t, strings.HasPrefix(entry.Name(), ".readyz"), "the write check cleans up")
+	}
+}
+
+func TestReadinessFailsWithoutFreeSpace(t *testing.T) {
+	s := newTestServer(t, Config{MinFreeSpace: math.MaxInt32})
+	rec := serve(s, httptest.NewRequest(http.MethodGet, readyPath, nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	var status probeStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	require.Equal(t, "unavailable", status.Status)
+	require.Contains(t, status.Checks["disk_space"], "MB free")
+	require.Equal(t, "ok", status.Checks["upload_dir"])
+
+	// Liveness does not depend on the disk.
+	require.Equal(t, http.StatusOK, serve(s, httptest.NewRequest(http.MethodGet, healthPath, nil)).Code)
+}
+
+func TestReadinessFailsWhenUploadDirIsGone(t *testing.T) {
+	s := newTestServer(t, Config{})
+	require.NoError(t, os.RemoveAll(s.config.UploadDir))
+	rec := serve(s, httptest.NewRequest(http.MethodGet, readyPath, nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	var status probeStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	require.NotEqual(t, "ok", status.Checks["upload_dir"])
+}
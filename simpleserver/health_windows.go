@@ -0,0 +1,19 @@
+//go:build windows
+
+package simpleserver
+
+import "golang.org/x/sys/windows"
+
+// freeSpace returns the bytes available to the user on the volume holding
+// dir.
+func freeSpace(dir string) (int64, error) {
+	name, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var available uint64
+	if err := windows.GetDiskFreeSpaceEx(name, &available, nil, nil); err != nil {
+		return 0, err
+	}
+	return int64(available), nil
+}
@@ -0,0 +1,215 @@
+package simpleserver
+
+import (
+	"html"
+	"path"
+	"strings"
+)
+
+// syntax describes just enough of a language to color its comments,
+// strings, numbers and keywords. It is no parser: odd constructs such as
+// heredocs or nested comments are colored as well as a line based scan
+// allows.
+type syntax struct {
+	lineComments []string
+	blockComment [2]string
+	// quotes start and end strings. Strings quoted with a backtick may span
+	// lines, the others end at the line.
+	quotes   string
+	keywords map[string]bool
+}
+
+func keywords(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(words) {
+		set[word] = true
+	}
+	return set
+}
+
+var (
+	cSyntax = syntax{
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `"'`,
+		keywords: keywords(`auto break case char const continue default do double else enum extern float for goto if
+			inline int long register return short signed sizeof static struct switch typedef union unsigned void volatile while
+			bool class delete false namespace new nullptr private protected public template this throw true try catch using virtual`),
+	}
+	hashSyntax = syntax{lineComments: []string{"#"}, quotes: `"'`}
+
+	syntaxes = map[string]syntax{
+		"go": {
+			lineComments: []string{"//"},
+			blockComment: [2]string{"/*", "*/"},
+			quotes:       "\"'`",
+			keywords: keywords(`break case chan const continue default defer else fallthrough for func go goto if import
+				interface map package range return select struct switch type var nil true false iota`),
+		},
+		"c": cSyntax,
+		"java": {
+			lineComments: []string{"//"},
+			blockComment: [2]string{"/*", "*/"},
+			quotes:       `"'`,
+			keywords: keywords(`abstract boolean break byte case catch char class const continue default do double else
+				enum extends final finally float for if implements import instanceof int interface long new null package
+				private protected public return short static super switch synchronized this throw throws true false try
+				var void volatile while fun val when object override`),
+		},
+		"js": {
+			lineComments: []string{"//"},
+			blockComment: [2]string{"/*", "*/"},
+			quotes:       "\"'`",
+			keywords: keywords(`async await break case catch class const continue debugger default delete do else export
+				extends false finally for function if import in instanceof let new null return super switch this throw true
+				try typeof undefined var void while yield interface type enum implements`),
+		},
+		"rs": {
+			lineComments: []string{"//"},
+			blockComment: [2]string{"/*", "*/"},
+			quotes:       `"`,
+			keywords: keywords(`as async await break const continue crate else enum extern false fn for if impl in let loop
+				match mod move mut pub ref return self Self static struct super trait true type unsafe use where while`),
+		},
+		"py": {
+			lineComments: []string{"#"},
+			quotes:       `"'`,
+			keywords: keywords(`and as assert async await break class continue def del elif else except False finally for
+				from global if import in is lambda None nonlocal not or pass raise return True try while with yield`),
+		},
+		"rb": {
+			lineComments: []string{"#"},
+			quotes:       `"'`,
+			keywords: keywords(`alias and begin break case class def defined? do else elsif end ensure false for if in
+				module next nil not or redo rescue retry return self super then true undef unless until when while yield`),
+		},
+		"sh": {
+			lineComments: []string{"#"},
+			quotes:       `"'`,
+			keywords: keywords(`if then else elif fi case esac for while until do done in function return local export
+				readonly set unset shift exit`),
+		},
+		"sql": {
+			lineComments: []string{"--"},
+			blockComment: [2]string{"/*", "*/"},
+			quotes:       `'"`,
+			keywords: keywords(`SELECT FROM WHERE INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE DROP ALTER INDEX JOIN
+				LEFT RIGHT INNER OUTER ON AND OR NOT NULL IS IN AS ORDER BY GROUP HAVING LIMIT PRIMARY KEY
+				select from where insert into values update set delete create table drop alter index join
+				left right inner outer on and or not null is in as order by group having limit primary key`),
+		},
+		"json": {quotes: `"`, keywords: keywords("true false null")},
+		"yml":  hashSyntax,
+		"toml": hashSyntax,
+		"conf": hashSyntax,
+	}
+
+	// syntaxAliases maps file extensions, base names and the language names
+	// used on Markdown code fences to syntaxes.
+	syntaxAliases = map[string]string{
+		"golang": "go", "h": "c", "cc": "c", "cpp": "c", "hpp": "c", "cs": "java", "kt": "java", "swift": "java",
+		"javascript": "js", "mjs": "js", "ts": "js", "typescript": "js", "jsx": "js", "tsx": "js",
+		"rust": "rs", "python": "py", "ruby": "rb", "bash": "sh", "shell": "sh", "zsh": "sh", "console": "sh",
+		"dockerfile": "sh", "makefile": "sh", "yaml": "yml", "ini": "conf", "cfg": "conf", "env": "conf",
+	}
+)
+
+// syntaxFor returns the syntax of a language or file name, if it is known.
+func syntaxFor(language string) (syntax, bool) {
+	language = strings.ToLower(language)
+	if alias, ok := syntaxAliases[language]; ok {
+		language = alias
+	}
+	syn, ok := syntaxes[language]
+	return syn, ok
+}
+
+// fileLanguage guesses the language of a file from its name.
+func fileLanguage(name string) string {
+	if ext := path.Ext(name); ext != "" {
+		return strings.TrimPrefix(ext, ".")
+	}
+	return path.Base(name)
+}
+
+// highlight renders src as HTML with comments, strings, numbers and
+// keywords wrapped in spans of class c, s, n and k. Unknown languages are
+// only escaped.
+func highlight(src, language string) string {
+	syn, ok := syntaxFor(language)
+	if !ok {
+		return html.EscapeString(src)
+	}
+	var b strings.Builder
+	span := func(class, text string) {
+		b.WriteString(`<span class="` + class + `">`)
+		b.WriteString(html.EscapeString(text))
+		b.WriteString("</span>")
+	}
+	for i := 0; i < len(src); {
+		rest := src[i:]
+		if syn.startsLineComment(rest) {
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			span("c", rest[:end])
+			i += end
+			continue
+		}
+		if open, close := syn.blockComment[0], syn.blockComment[1]; open != "" && strings.HasPrefix(rest, open) {
+			end := len(rest)
+			if n := strings.Index(rest[len(open):], close); n >= 0 {
+				end = len(open) + n + len(close)
+			}
+			span("c", rest[:end])
+			i += end
+			continue
+		}
+		switch c := src[i]; {
+		case strings.IndexByte(syn.quotes, c) >= 0:
+			end := 1
+			for end < len(rest) && rest[end] != c && (c == '`' || rest[end] != '\n') {
+				if rest[end] == '\\' && end+1 < len(rest) {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(rest))
+			span("s", rest[:end])
+			i += end
+		case isWordByte(c):
+			end := 1
+			for end < len(rest) && (isWordByte(rest[end]) || c >= '0' && c <= '9' && rest[end] == '.') {
+				end++
+			}
+			word := rest[:end]
+			switch {
+			case c >= '0' && c <= '9':
+				span("n", word)
+			case syn.keywords[word]:
+				span("k", word)
+			default:
+				b.WriteString(html.EscapeString(word))
+			}
+			i += end
+		default:
+			b.WriteString(html.EscapeString(src[i : i+1]))
+			i++
+		}
+	}
+	return b.String()
+}
+
+func (syn syntax) startsLineComment(s string) bool {
+	for _, prefix := range syn.lineComments {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
@@ -0,0 +1,137 @@
+package simpleserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// errRejected wraps the error of a hook that stopped an operation.
+var errRejected = errors.New("rejected")
+
+// FileInfo describes a file to the hooks of a program embedding the server.
+type FileInfo struct {
+	Dir         string
+	Name        string
+	Size        int64
+	ContentType string
+	SHA256      string
+	CreatedAt   time.Time
+}
+
+func hookFileInfo(meta FileMeta) FileInfo {
+	return FileInfo{
+		Dir:         meta.Dir,
+		Name:        meta.Name,
+		Size:        meta.Size,
+		ContentType: meta.ContentType,
+		SHA256:      meta.SHA256,
+		CreatedAt:   meta.CreatedAt,
+	}
+}
+
+// Hook is called by the server with a file it is about to store, serve or
+// delete, or just did.
+type Hook func(ctx context.Context, info FileInfo) error
+
+type hookPoint int
+
+const (
+	beforeUpload hookPoint = iota
+	afterUpload
+	beforeDownload
+	afterDownload
+	beforeDelete
+	afterDelete
+	hookPoints
+)
+
+// hookSet holds the hooks registered at every point.
+type hookSet struct {
+	mu    sync.RWMutex
+	hooks [hookPoints][]Hook
+}
+
+func (hs *hookSet) add(point hookPoint, hook Hook) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.hooks[point] = append(hs.hooks[point], hook)
+}
+
+// OnUpload registers a hook called with every upload once it is received,
+// before it is stored. An error rejects the upload with 403 Forbidden.
+func (s *Server) OnUpload(hook Hook) {
+	s.hooks.add(beforeUpload, hook)
+}
+
+// OnDownload registers a hook called before a file is served. An error
+// rejects the download with 403 Forbidden.
+func (s *Server) OnDownload(hook Hook) {
+	s.hooks.add(beforeDownload, hook)
+}
+
+// OnDelete registers a hook called before a client deletes a file. An error
+// rejects the deletion with 403 Forbidden. Files deleted by the server, such
+// as expired ones, do not go through it.
+func (s *Server) OnDelete(hook Hook) {
+	s.hooks.add(beforeDelete, hook)
+}
+
+// AfterUpload registers a hook called with every upload once it is stored.
+// Errors are only logged.
+func (s *Server) AfterUpload(hook Hook) {
+	s.hooks.add(afterUpload, hook)
+}
+
+// AfterDownload registers a hook called once a file is served. Errors are
+// only logged.
+func (s *Server) AfterDownload(hook Hook) {
+	s.hooks.add(afterDownload, hook)
+}
+
+// AfterDelete registers a hook called once a client deleted a file. Errors
+// are only logged.
+func (s *Server) AfterDelete(hook Hook) {
+	s.hooks.add(afterDelete, hook)
+}
+
+// checkHooks runs the hooks of point in the order they were registered and
+// stops at the first error, which it returns wrapped in errRejected.
+func (s *Server) checkHooks(ctx context.Context, point hookPoint, meta FileMeta) error {
+	s.hooks.mu.RLock()
+	hooks := s.hooks.hooks[point]
+	s.hooks.mu.RUnlock()
+	for _, hook := range hooks {
+		if err := hook(ctx, hookFileInfo(meta)); err != nil {
+			return fmt.Errorf("%w: %v", errRejected, err)
+		}
+	}
+	return nil
+}
+
+// runHooks runs the hooks of point, which only notify, logging their errors.
+func (s *Server) runHooks(ctx context.Context, point hookPoint, meta FileMeta) {
+	s.hooks.mu.RLock()
+	hooks := s.hooks.hooks[point]
+	s.hooks.mu.RUnlock()
+	for _, hook := range hooks {
+		if err := hook(ctx, hookFileInfo(meta)); err != nil {
+			log.Printf("Hook failed for %s: %v\n", meta.key(), err)
+		}
+	}
+}
+
+// deleteFailed answers a deletion that failed with err.
+func deleteFailed(c echo.Context, meta FileMeta, err error) error {
+	if errors.Is(err, errRejected) {
+		return fail(c, http.StatusForbidden, err.Error())
+	}
+	log.Printf("Failed to delete %s: %v\n", meta.key(), err)
+	return fail(c, http.StatusInternalServerError, "Failed to delete file")
+}
@@ -0,0 +1,97 @@
+package simpleserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// hookRecorder records the files hooks were called with.
+type hookRecorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *hookRecorder) hook(name string, err error) Hook {
+	return func(ctx context.Context, info FileInfo) error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.calls = append(r.calls, name+" "+info.Name)
+		return err
+	}
+}
+
+func (r *hookRecorder) recorded() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+func TestHooksSeeUploadsDownloadsAndDeletes(t *testing.T) {
+	s := newTestServer(t, Config{})
+	var rec hookRecorder
+	s.OnUpload(rec.hook("before upload", nil))
+	s.AfterUpload(rec.hook("after upload", nil))
+	s.OnDownload(rec.hook("before download", nil))
+	s.AfterDownload(rec.hook("after download", errors.New("only logged")))
+	s.OnDelete(rec.hook("before delete", nil))
+	s.AfterDelete(rec.hook("after delete", nil))
+
+	resp := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("hooked")))
+	require.Equal(t, http.StatusCreated, resp.Code)
+	require.Equal(t, "hooked", download(t, s, downloadURLs(t, resp.Body.String())[0]).Body.String())
+	meta := findMeta(t, s, "notes.txt")
+	req := httptest.NewRequest(http.MethodDelete, "/"+meta.key(), nil)
+	req.Header.Set(deleteTokenHeader, resp.Header().Get(deleteTokenHeader))
+	require.Equal(t, http.StatusNoContent, serve(s, req).Code)
+
+	require.Equal(t, []string{
+		"before upload notes.txt", "after upload notes.txt",
+		"before download notes.txt", "after download notes.txt",
+		"before delete notes.txt", "after delete notes.txt",
+	}, rec.recorded())
+}
+
+func TestHooksCanReject(t *testing.T) {
+	s := newTestServer(t, Config{})
+	s.OnUpload(func(ctx context.Context, info FileInfo) error {
+		if strings.HasSuffix(info.Name, ".exe") {
+			return errors.New("no executables")
+		}
+		return nil
+	})
+	denied := errors.New("billing required")
+	var blocked bool
+	s.OnDownload(func(ctx context.Context, info FileInfo) error {
+		if blocked {
+			return denied
+		}
+		return nil
+	})
+	s.OnDelete(func(ctx context.Context, info FileInfo) error { return denied })
+
+	resp := serve(s, httptest.NewRequest(http.MethodPut, "/setup.exe", strings.NewReader("MZ")))
+	require.Equal(t, http.StatusForbidden, resp.Code)
+	require.Contains(t, resp.Body.String(), "no executables")
+	require.Zero(t, s.index.len())
+
+	resp = serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("hooked")))
+	require.Equal(t, http.StatusCreated, resp.Code)
+	link := downloadURLs(t, resp.Body.String())[0]
+	blocked = true
+	rec := download(t, s, link)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Contains(t, rec.Body.String(), "billing required")
+
+	meta := findMeta(t, s, "notes.txt")
+	req := httptest.NewRequest(http.MethodDelete, "/"+meta.key(), nil)
+	req.Header.Set(deleteTokenHeader, resp.Header().Get(deleteTokenHeader))
+	require.Equal(t, http.StatusForbidden, serve(s, req).Code)
+	require.Equal(t, 1, s.index.len())
+}
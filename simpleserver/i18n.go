@@ -0,0 +1,128 @@
+package simpleserver
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// defaultLang is the language messages are written in.
+	defaultLang = "en"
+	// langKey holds the language negotiated for a request.
+	langKey = "simpleserver.lang"
+)
+
+// Translation catalogs map the English messages of the web UI and of error
+// responses to another language, one JSON object per language named after
+// its ISO 639-1 code, such as i18n/de.json. To add a locale, copy one of
+// them and translate its values: messages a catalog lacks stay in English,
+// and TestCatalogsAreComplete lists them.
+//
+//go:embed i18n/*.json
+var catalogFiles embed.FS
+
+// catalogs holds the translation catalogs by language.
+var catalogs = loadCatalogs()
+
+func loadCatalogs() map[string]map[string]string {
+	entries, err := catalogFiles.ReadDir("i18n")
+	if err != nil {
+		panic(err)
+	}
+	loaded := make(map[string]map[string]string, len(entries))
+	for _, entry := range entries {
+		content, err := catalogFiles.ReadFile(path.Join("i18n", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var catalog map[string]string
+		if err := json.Unmarshal(content, &catalog); err != nil {
+			panic(fmt.Sprintf("i18n/%s: %v", entry.Name(), err))
+		}
+		loaded[strings.TrimSuffix(entry.Name(), ".json")] = catalog
+	}
+	return loaded
+}
+
+// languages lists the languages messages are available in.
+func languages() []string {
+	langs := []string{defaultLang}
+	for lang := range catalogs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs[1:])
+	return langs
+}
+
+func knownLang(lang string) bool {
+	_, ok := catalogs[lang]
+	return ok || lang == defaultLang
+}
+
+// negotiateLang picks the language the Accept-Language header value accept
+// rates highest, matching regional variants such as de-AT by their base
+// language. It returns fallback when the client takes none of them.
+func negotiateLang(accept, fallback string) string {
+	best, bestQ := fallback, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		lang, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if knownLang(lang) && q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
+
+// negotiateLanguage picks the language of every response, from the
+// Accept-Language of the request or else Config.Lang.
+func (s *Server) negotiateLanguage(next echo.HandlerFunc) echo.HandlerFunc {
+	fallback := s.config.Lang
+	if fallback == "" {
+		fallback = defaultLang
+	}
+	return func(c echo.Context) error {
+		c.Set(langKey, negotiateLang(c.Request().Header.Get("Accept-Language"), fallback))
+		return next(c)
+	}
+}
+
+// requestLang returns the language negotiated for c.
+func requestLang(c echo.Context) string {
+	if lang, ok := c.Get(langKey).(string); ok {
+		return lang
+	}
+	return defaultLang
+}
+
+// translate returns message in the language of c. Messages that wrap a
+// known one, like "known message: detail", get the known part translated.
+func translate(c echo.Context, message string) string {
+	catalog := catalogs[requestLang(c)]
+	if catalog == nil {
+		return message
+	}
+	if translated, ok := catalog[message]; ok {
+		return translated
+	}
+	if known, detail, ok := strings.Cut(message, ": "); ok {
+		if translated, ok := catalog[known]; ok {
+			return translated + ": " + detail
+		}
+	}
+	return message
+}
@@ -0,0 +1,97 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateLang(t *testing.T) {
+	for accept, want := range map[string]string{
+		"":                       "en",
+		"de":                     "de",
+		"de-AT,de;q=0.9":         "de",
+		"ja, fr;q=0.5, es;q=0.8": "es",
+		"en-GB, fr;q=0.9":        "en",
+		"pt-BR;q=oops, fr;q=0.1": "fr",
+		"ja, zh-CN":              "en",
+		"FR-ca":                  "fr",
+		"de;q=0, pt;q=0.2":       "pt",
+	} {
+		require.Equal(t, want, negotiateLang(accept, defaultLang), accept)
+	}
+	require.Equal(t, "es", negotiateLang("ja", "es"))
+}
+
+func TestCatalogsAreComplete(t *testing.T) {
+	var keys []string
+	for _, m := range regexp.MustCompile(`call \.T "([^"]+)"`).FindAllStringSubmatch(uiPage, -1) {
+		keys = append(keys, m[1])
+	}
+	require.NotEmpty(t, keys)
+	// Every catalog translates what any other one does.
+	for _, catalog := range catalogs {
+		for key := range catalog {
+			keys = append(keys, key)
+		}
+	}
+	for lang, catalog := range catalogs {
+		var missing []string
+		for _, key := range keys {
+			if _, ok := catalog[key]; !ok {
+				missing = append(missing, key)
+			}
+		}
+		sort.Strings(missing)
+		require.Empty(t, missing, "i18n/%s.json lacks translations", lang)
+	}
+}
+
+func TestMessagesFollowAcceptLanguage(t *testing.T) {
+	s := newTestServer(t, Config{})
+	req := httptest.NewRequest(http.MethodGet, "/abcdef/missing.txt", nil)
+	req.Header.Set("Accept-Language", "de-DE,de;q=0.9,en;q=0.8")
+	rec := serve(s, req)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.Equal(t, "Datei nicht gefunden", errorOf(t, rec.Body.String()).Message)
+
+	req = httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("bonjour"))
+	req.Header.Set("Accept-Language", "fr")
+	rec = serve(s, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.True(t, strings.HasPrefix(rec.Body.String(), "Fichier envoyé."), rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Language", "fr")
+	rec = serve(s, req)
+	require.Equal(t, "fr", rec.Header().Get("Content-Language"))
+	require.Contains(t, rec.Header().Values(echo.HeaderVary), "Accept-Language")
+	require.Contains(t, rec.Body.String(), `<html lang="fr">`)
+	require.Contains(t, rec.Body.String(), "<h1>Envoyer des fichiers</h1>")
+	require.Contains(t, rec.Body.String(), `copy.textContent = "Copié";`)
+}
+
+func TestLangIsTheFallback(t *testing.T) {
+	s := newTestServer(t, Config{Lang: "es"})
+	rec := serve(s, httptest.NewRequest(http.MethodGet, "/abcdef/missing.txt", nil))
+	require.Equal(t, "Archivo no encontrado", errorOf(t, rec.Body.String()).Message)
+
+	req := httptest.NewRequest(http.MethodGet, "/abcdef/missing.txt", nil)
+	req.Header.Set("Accept-Language", "en-US")
+	require.Equal(t, "File not found", errorOf(t, serve(s, req).Body.String()).Message)
+
+	require.ErrorContains(t, Config{UploadDir: t.TempDir(), Lang: "xx"}.Validate(), "--lang")
+}
+
+func TestTranslateKeepsDetails(t *testing.T) {
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	c.Set(langKey, "pt")
+	require.Equal(t, "O envio excede o tamanho máximo: 5 MiB", translate(c, "upload exceeds the maximum size: 5 MiB"))
+	require.Equal(t, "Something else", translate(c, "Something else"))
+}
@@ -0,0 +1,115 @@
+package simpleserver
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	idSchemeBase58 = "base58"
+	idSchemeUUID   = "uuid"
+	idSchemeWords  = "words"
+	// idWords is how many words the words scheme joins, which with a list
+	// of 256 words gives as many random bits as 5 to 6 base58 characters.
+	idWords = 4
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// idWordList holds 256 short words that are easy to read out and type.
+var idWordList = strings.Fields(`
+	acid acorn actor adobe aged agent alarm album alert alley alpha amber angle apple apron arena
+	armor arrow atlas attic audio aunt award axis bacon badge baker banjo barn basil batch beach
+	bead beam bean bell bench berry bike birch blade blank blaze bloom board boat bonus boot
+	brass bread brick brook broom brush cabin cable cacao cadet camel camp canal candy canoe cargo
+	cedar chalk chart chess chief cider cliff clock cloud coast cobra comet coral couch crane creek
+	crest crown cube daisy delta denim depot diary dingo disco dock dome donut dove draft dream
+	drift drum dune eagle easel ember emu epic fable fairy falcon fern ferry fiber field flame
+	flint flute foam focus forge fox frost fudge gala gecko gem ghost giant ginger glade globe
+	goose grape gravy grove guava gull hatch hazel heron hiker hippo honey hoop hotel igloo index
+	iris ivory jade jazz jelly jewel judge juice kayak kettle kiwi koala label lake lamp lark
+	latch lava lemon lilac lime linen llama lobby lotus lunar lyric mango maple marsh medal melon
+	mint moose motor mural nacho navy nectar nest noble north nova oasis ocean olive omega onion
+	opal orbit otter owl paddle panda paper pearl pecan penny pilot pine pixel plaza plum polar
+	pond poppy prism quail quartz quill radar raft raven reef ridge river robin rocket ruby saddle
+	salsa satin scout shell silk slope solar spark spice spoon squid staff stone storm sugar swan
+	tango tiger toast topaz torch tulip tuna ultra umbra urban valve vapor velvet violet wagon zebra
+`)
+
+// IDGenerator makes the random ids of upload directories.
+type IDGenerator interface {
+	NewID() string
+}
+
+// newIDGenerator returns the generator of scheme, base58 when it is empty.
+// length is the length of base58 ids, the other schemes ignore it.
+func newIDGenerator(scheme string, length int) (IDGenerator, error) {
+	switch scheme {
+	case "", idSchemeBase58:
+		return base58Generator{length: length}, nil
+	case idSchemeUUID:
+		return uuidGenerator{}, nil
+	case idSchemeWords:
+		return wordsGenerator{count: idWords}, nil
+	}
+	return nil, fmt.Errorf("unknown id scheme %q, expected base58, uuid or words", scheme)
+}
+
+type base58Generator struct {
+	length int
+}
+
+func (g base58Generator) NewID() string {
+	return base58(g.length)
+}
+
+type uuidGenerator struct{}
+
+func (uuidGenerator) NewID() string {
+	return uuid.NewString()
+}
+
+// wordsGenerator joins random words with dashes, as in otter-lava-plum-reef.
+type wordsGenerator struct {
+	count int
+}
+
+func (g wordsGenerator) NewID() string {
+	picks := make([]byte, g.count)
+	if _, err := rand.Read(picks); err != nil {
+		return "0"
+	}
+	words := make([]string, g.count)
+	for i, p := range picks {
+		words[i] = idWordList[p]
+	}
+	return strings.Join(words, "-")
+}
+
+// base58 returns size random characters of base58Alphabet.
+func base58(size int) string {
+	return randomString(base58Alphabet, size)
+}
+
+// randomString returns size random characters of alphabet. Random bytes
+// that fall beyond the last whole multiple of the alphabet are drawn again,
+// as taking them modulo its length would favor the first characters.
+func randomString(alphabet string, size int) string {
+	limit := 256 - 256%len(alphabet)
+	id := make([]byte, 0, size)
+	buf := make([]byte, size)
+	for len(id) < size {
+		if _, err := rand.Read(buf); err != nil {
+			return "0"
+		}
+		for _, p := range buf {
+			if int(p) < limit && len(id) < size {
+				id = append(id, alphabet[int(p)%len(alphabet)])
+			}
+		}
+	}
+	return string(id)
+}
@@ -0,0 +1,70 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// sequenceIDs hands out ids in order.
+type sequenceIDs struct {
+	ids []string
+}
+
+func (g *sequenceIDs) NewID() string {
+	id := g.ids[0]
+	g.ids = g.ids[1:]
+	return id
+}
+
+func TestIDSchemes(t *testing.T) {
+	for scheme, pattern := range map[string]string{
+		"":      `^[1-9A-HJ-NP-Za-km-z]{8}$`,
+		"uuid":  `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`,
+		"words": `^[a-z]+(-[a-z]+){3}$`,
+	} {
+		ids, err := newIDGenerator(scheme, 8)
+		require.NoError(t, err)
+		id := ids.NewID()
+		require.Regexp(t, regexp.MustCompile(pattern), id, scheme)
+		require.True(t, validSlug(id), id)
+	}
+	require.Len(t, idWordList, 256)
+
+	_, err := newIDGenerator("nanoid", 8)
+	require.Error(t, err)
+	require.ErrorContains(t, Config{UploadDir: t.TempDir(), IDScheme: "nanoid"}.Validate(), "--id-scheme")
+}
+
+func TestBase58IsUniform(t *testing.T) {
+	counts := make(map[rune]int)
+	for _, r := range base58(58 * 1000) {
+		counts[r]++
+	}
+	require.Len(t, counts, len(base58Alphabet))
+	// Taking bytes modulo 58 made the first 24 characters a third likelier.
+	for r, n := range counts {
+		require.InDelta(t, 1000, n, 200, string(r))
+	}
+}
+
+func TestUploadsUseTheIDScheme(t *testing.T) {
+	s := newTestServer(t, Config{IDScheme: "words"})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/hello.txt", strings.NewReader("hello")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Regexp(t, `^[a-z]+(-[a-z]+){3}$`, findMeta(t, s, "hello.txt").Dir)
+}
+
+func TestNewShareDirSkipsDirsInUse(t *testing.T) {
+	s := newTestServer(t, Config{})
+	require.NoError(t, os.MkdirAll(filepath.Join(s.getUploadDir(), "onDisk"), 0755))
+	s.slugClaims.Store("claimed", struct{}{})
+	s.ids = &sequenceIDs{ids: []string{"onDisk", "claimed", "admin", "free"}}
+	require.Equal(t, "free", s.newShareDir())
+}
@@ -0,0 +1,184 @@
+package simpleserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// redacted stands in for the secrets GET /admin/config leaves out.
+const redacted = "REDACTED"
+
+// effectiveConfig is the Config the server runs with: the live settings of
+// the config file applied and the defaults of unset settings filled in.
+func (s *Server) effectiveConfig() Config {
+	config := s.config
+	live := s.settings()
+	config.AuthToken, config.AdminToken, config.UploadTokens = live.AuthToken, live.AdminToken, live.UploadTokens
+	config.MaxTotalSize, config.MaxUploadsPerUser = live.MaxTotalSize, live.MaxUploadsPerUser
+	config.RateLimit, config.BandwidthLimit = live.RateLimit, live.BandwidthLimit
+	config.Buckets = live.Buckets
+
+	if config.Port <= 0 {
+		config.Port = 8080
+	}
+	if config.GracePeriod <= 0 {
+		config.GracePeriod = defaultGracePeriod
+	}
+	if config.Storage == "" {
+		config.Storage = "local"
+	}
+	if config.MetadataStore == "" {
+		config.MetadataStore = metadataStoreFiles
+	}
+	config.MaxSize = s.maxSize()
+	config.UploadDir = s.getUploadDir()
+	config.SlugLength = s.slugLength()
+	config.GCInterval = s.gcInterval()
+	config.FetchTimeout = s.fetchTimeout()
+	config.ClipTTL = s.clipTTL()
+	if len(config.AutoTLSDomains) > 0 {
+		config.AutoTLSCacheDir = config.autoTLSCacheDir()
+	}
+	if config.SFTPPort > 0 {
+		config.SFTPHostKey = config.sftpHostKey()
+	}
+	return config
+}
+
+// sanitizeConfig redacts the tokens and keys of config, and the passwords
+// of URLs pointing at other services.
+func sanitizeConfig(config Config) Config {
+	for _, secret := range []*string{&config.AuthToken, &config.AdminToken, &config.URLSigningKey, &config.EncryptKey, &config.WebhookSecret, &config.ClusterSecret} {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+	tokens := make([]UploadToken, len(config.UploadTokens))
+	for i, token := range config.UploadTokens {
+		token.Token = redacted
+		tokens[i] = token
+	}
+	config.UploadTokens = tokens
+	buckets := make(map[string]BucketConfig, len(config.Buckets))
+	for name, bucket := range config.Buckets {
+		if bucket.AuthToken != "" {
+			bucket.AuthToken = redacted
+		}
+		buckets[name] = bucket
+	}
+	config.Buckets = buckets
+	for _, endpoint := range []*string{&config.RateLimitRedis, &config.EventsNATSURL, &config.WebhookURL, &config.DownloadWebhookURL, &config.ProxyTarget, &config.OTelEndpoint, &config.MirrorTo, &config.MetadataStore} {
+		*endpoint = redactURL(*endpoint)
+	}
+	return config
+}
+
+// redactURL hides the password and query of raw, which may carry
+// credentials as well.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = redacted
+	}
+	return u.Redacted()
+}
+
+// configFields lists the fields of config by name, with durations in their
+// readable form rather than in nanoseconds.
+func configFields(config Config) map[string]any {
+	value := reflect.ValueOf(config)
+	fields := make(map[string]any, value.NumField())
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		if d, ok := field.Interface().(time.Duration); ok {
+			fields[value.Type().Field(i).Name] = d.String()
+			continue
+		}
+		fields[value.Type().Field(i).Name] = field.Interface()
+	}
+	return fields
+}
+
+// handleConfig answers GET /admin/config with the effective configuration,
+// secrets redacted.
+func (s *Server) handleConfig(c echo.Context) error {
+	return c.JSON(http.StatusOK, configFields(sanitizeConfig(s.effectiveConfig())))
+}
+
+// printBanner prints the settings that decide where uploads go, how big
+// they may be and who may send them, so a misconfiguration shows at start.
+func (s *Server) printBanner() {
+	config := s.effectiveConfig()
+	storage := config.Storage
+	if storage == "local" {
+		storage = "local files"
+	}
+	publicURL := config.PublicURL
+	if publicURL == "" {
+		publicURL = "taken from the Host of each request"
+	}
+	fmt.Printf("  Upload dir: %s\n", config.UploadDir)
+	if config.MirrorTo != "" {
+		storage += " mirrored to " + config.MirrorTo
+	}
+	fmt.Printf("  Storage:    %s, metadata in %s\n", storage, redactURL(config.MetadataStore))
+	fmt.Printf("  Limits:     %s\n", strings.Join(s.limits(config), ", "))
+	fmt.Printf("  Auth:       %s\n", strings.Join(s.authModes(config), ", "))
+	fmt.Printf("  Public URL: %s\n", publicURL)
+	if len(config.Peers) > 0 {
+		fmt.Printf("  Peers:      %s\n", strings.Join(config.Peers, ", "))
+	}
+}
+
+func (s *Server) limits(config Config) []string {
+	limits := []string{fmt.Sprintf("%d MB per upload", config.MaxSize)}
+	if config.MaxTotalSize > 0 {
+		limits = append(limits, fmt.Sprintf("%d MB in total", config.MaxTotalSize))
+	}
+	if config.TTL > 0 {
+		limits = append(limits, fmt.Sprintf("files expire after %s", config.TTL))
+	} else {
+		limits = append(limits, "files never expire")
+	}
+	if config.RateLimit > 0 {
+		limits = append(limits, fmt.Sprintf("%g requests per second per client", config.RateLimit))
+	}
+	return limits
+}
+
+func (s *Server) authModes(config Config) []string {
+	var modes []string
+	if config.AuthToken != "" {
+		modes = append(modes, "auth token")
+	}
+	if len(config.UploadTokens) > 0 {
+		modes = append(modes, fmt.Sprintf("%d upload tokens", len(config.UploadTokens)))
+	}
+	if config.UsersFile != "" {
+		modes = append(modes, "users from "+config.UsersFile)
+	}
+	if config.AccessTeamDomain != "" {
+		modes = append(modes, "Cloudflare Access")
+	}
+	if config.OIDCIssuer != "" {
+		modes = append(modes, "OIDC tokens of "+config.OIDCIssuer)
+	}
+	if len(modes) == 0 {
+		modes = append(modes, "none, anyone can upload")
+	} else if config.ProtectDownloads {
+		modes = append(modes, "downloads too")
+	}
+	if config.AdminToken != "" {
+		modes = append(modes, "admin API enabled")
+	}
+	return modes
+}
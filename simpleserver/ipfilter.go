@@ -0,0 +1,154 @@
+package simpleserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// cfConnectingIPHeader carries the address of the client in requests
+// cloudflared forwards from the edge.
+const cfConnectingIPHeader = "CF-Connecting-IP"
+
+// ipFilter admits clients by address and finds that address behind
+// cloudflared and other proxies.
+type ipFilter struct {
+	allow   []netip.Prefix
+	deny    []netip.Prefix
+	trusted []netip.Prefix
+}
+
+// defaultTrustedProxies are where cloudflared connects from when it runs on
+// the same host, as it does in front of a share.
+var defaultTrustedProxies = []string{"127.0.0.0/8", "::1"}
+
+// newIPFilter reads Config.AllowCIDRs, DenyCIDRs and TrustedProxies.
+// Config.Validate reports invalid entries, they are skipped here.
+func newIPFilter(config Config) ipFilter {
+	allow, _ := parsePrefixes(config.AllowCIDRs)
+	deny, _ := parsePrefixes(config.DenyCIDRs)
+	proxies := config.TrustedProxies
+	if len(proxies) == 0 {
+		proxies = defaultTrustedProxies
+	}
+	trusted, _ := parsePrefixes(proxies)
+	return ipFilter{allow: allow, deny: deny, trusted: trusted}
+}
+
+// parsePrefixes reads CIDR ranges such as 10.0.0.0/8 and single addresses.
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	var err error
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if addr, parseErr := netip.ParseAddr(value); parseErr == nil {
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, parseErr := netip.ParsePrefix(value)
+		if parseErr != nil {
+			err = fmt.Errorf("%q is not an address or CIDR range such as 10.0.0.0/8", value)
+			continue
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, err
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseAddr(value string) (netip.Addr, bool) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(value))
+	return addr.Unmap(), err == nil
+}
+
+// clientIP is the echo IPExtractor behind c.RealIP. Only trusted proxies and
+// clients of the unix socket may name the address of the client in
+// CF-Connecting-IP, X-Forwarded-For or X-Real-IP, as cloudflared does.
+// X-Forwarded-For is read from the right up to the first hop that is not a
+// trusted proxy, as any hop before may be made up.
+func (f ipFilter) clientIP(req *http.Request) string {
+	host, peer, isIP := remotePeer(req)
+	if isIP && !containsAddr(f.trusted, peer) {
+		return peer.String()
+	}
+	if addr, ok := parseAddr(req.Header.Get(cfConnectingIPHeader)); ok {
+		return addr.String()
+	}
+	if forwarded := req.Header.Values(echo.HeaderXForwardedFor); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, ok := parseAddr(hops[i])
+			if !ok {
+				break
+			}
+			if i == 0 || !containsAddr(f.trusted, addr) {
+				return addr.String()
+			}
+		}
+	}
+	if addr, ok := parseAddr(req.Header.Get(echo.HeaderXRealIP)); ok {
+		return addr.String()
+	}
+	if isIP {
+		return peer.String()
+	}
+	return host
+}
+
+// trustsPeer reports whether the request comes from a trusted proxy or the
+// unix socket, whose forwarding headers may be believed.
+func (f ipFilter) trustsPeer(req *http.Request) bool {
+	_, peer, isIP := remotePeer(req)
+	return !isIP || containsAddr(f.trusted, peer)
+}
+
+func remotePeer(req *http.Request) (string, netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	peer, isIP := parseAddr(host)
+	return host, peer, isIP
+}
+
+func (f ipFilter) enabled() bool {
+	return len(f.allow) > 0 || len(f.deny) > 0
+}
+
+// admits reports whether ip may use the server. Denied ranges win over
+// allowed ones, and an unknown address only passes without an allowlist.
+func (f ipFilter) admits(ip string) bool {
+	addr, ok := parseAddr(ip)
+	if !ok {
+		return len(f.allow) == 0
+	}
+	if containsAddr(f.deny, addr) {
+		return false
+	}
+	return len(f.allow) == 0 || containsAddr(f.allow, addr)
+}
+
+// filterClients refuses the clients Config.AllowCIDRs and DenyCIDRs keep
+// out. Probes stay reachable for load balancers and orchestrators.
+func (s *Server) filterClients(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if isProbePath(c.Request().URL.Path) || s.clients.admits(c.RealIP()) {
+			return next(c)
+		}
+		return fail(c, http.StatusForbidden, "Forbidden")
+	}
+}
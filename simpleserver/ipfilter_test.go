@@ -0,0 +1,92 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func requestFrom(remote string, headers map[string]string) *http.Request {
+	req := httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("notes"))
+	req.RemoteAddr = remote
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	return req
+}
+
+func TestAllowAndDenyCIDRs(t *testing.T) {
+	s := newTestServer(t, Config{AllowCIDRs: []string{"10.0.0.0/8", "2001:db8::/32"}, DenyCIDRs: []string{"10.6.6.6"}})
+	for remote, want := range map[string]int{
+		"10.1.2.3:4242":       http.StatusCreated,
+		"[2001:db8::1]:4242":  http.StatusCreated,
+		"10.6.6.6:4242":       http.StatusForbidden,
+		"198.51.100.7:4242":   http.StatusForbidden,
+		"[::ffff:10.0.0.1]:1": http.StatusCreated,
+	} {
+		require.Equal(t, want, serve(s, requestFrom(remote, nil)).Code, remote)
+	}
+	rec := serve(s, httptest.NewRequest(http.MethodGet, healthPath, nil))
+	require.Equal(t, http.StatusOK, rec.Code, "probes stay reachable")
+}
+
+func TestTrustedProxies(t *testing.T) {
+	s := newTestServer(t, Config{AllowCIDRs: []string{"203.0.113.0/24"}, TrustedProxies: []string{"127.0.0.1"}})
+	for _, tc := range []struct {
+		remote  string
+		headers map[string]string
+		want    int
+	}{
+		{"127.0.0.1:4242", map[string]string{cfConnectingIPHeader: "203.0.113.7"}, http.StatusCreated},
+		{"127.0.0.1:4242", map[string]string{"X-Forwarded-For": "198.51.100.7, 203.0.113.7"}, http.StatusCreated},
+		{"127.0.0.1:4242", map[string]string{"X-Forwarded-For": "203.0.113.7, 198.51.100.7"}, http.StatusForbidden},
+		{"198.51.100.7:4242", map[string]string{cfConnectingIPHeader: "203.0.113.7"}, http.StatusForbidden},
+		{"@", map[string]string{cfConnectingIPHeader: "203.0.113.7"}, http.StatusCreated},
+		{"127.0.0.1:4242", nil, http.StatusForbidden},
+	} {
+		require.Equal(t, tc.want, serve(s, requestFrom(tc.remote, tc.headers)).Code, "%s %v", tc.remote, tc.headers)
+	}
+}
+
+func TestLoopbackProxiesAreTrustedByDefault(t *testing.T) {
+	s := newTestServer(t, Config{DenyCIDRs: []string{"198.51.100.0/24"}})
+	rec := serve(s, requestFrom("127.0.0.1:4242", map[string]string{cfConnectingIPHeader: "198.51.100.7", "X-Forwarded-For": "203.0.113.7"}))
+	require.Equal(t, http.StatusForbidden, rec.Code, "CF-Connecting-IP comes first")
+	rec = serve(s, requestFrom("[::1]:4242", map[string]string{"X-Forwarded-For": "198.51.100.7"}))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	// Anyone else could name any address.
+	rec = serve(s, requestFrom("198.51.100.7:4242", map[string]string{cfConnectingIPHeader: "203.0.113.7", "X-Forwarded-For": "203.0.113.7"}))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	s = newTestServer(t, Config{DenyCIDRs: []string{"198.51.100.0/24"}, TrustedProxies: []string{"0.0.0.0/0", "::/0"}})
+	rec = serve(s, requestFrom("198.51.100.7:4242", map[string]string{"X-Forwarded-For": "203.0.113.7"}))
+	require.Equal(t, http.StatusCreated, rec.Code)
+}
+
+func TestRealIPOnlyTrustsLoopbackByDefault(t *testing.T) {
+	s := newTestServer(t, Config{})
+	var seen []string
+	e := s.newRouter()
+	e.GET("/whoami", func(c echo.Context) error {
+		seen = append(seen, c.RealIP())
+		return c.NoContent(http.StatusNoContent)
+	})
+	for _, remote := range []string{"127.0.0.1:4242", "192.0.2.9:4242"} {
+		req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+		req.RemoteAddr = remote
+		req.Header.Set(cfConnectingIPHeader, "203.0.113.7")
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	require.Equal(t, []string{"203.0.113.7", "192.0.2.9"}, seen)
+}
+
+func TestValidateCIDRs(t *testing.T) {
+	dir := t.TempDir()
+	require.ErrorContains(t, Config{UploadDir: dir, AllowCIDRs: []string{"10.0.0.0/33"}}.Validate(), "--allow-cidr")
+	require.ErrorContains(t, Config{UploadDir: dir, TrustedProxies: []string{"localhost"}}.Validate(), "--trusted-proxies")
+	require.NoError(t, Config{UploadDir: dir, AllowCIDRs: []string{"10.0.0.0/8", "::1"}, DenyCIDRs: []string{"10.0.0.1"}}.Validate())
+}
@@ -0,0 +1,102 @@
+package simpleserver
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Option configures a Server built by New. A Config is an Option too, that
+// sets every setting at once, so options following it adjust it.
+type Option interface {
+	apply(*Config)
+}
+
+type optionFunc func(*Config)
+
+func (f optionFunc) apply(config *Config) {
+	f(config)
+}
+
+func (c Config) apply(config *Config) {
+	*config = c
+}
+
+// WithUploadDir stores uploads and their metadata in dir.
+func WithUploadDir(dir string) Option {
+	return optionFunc(func(c *Config) { c.UploadDir = dir })
+}
+
+// WithAuthToken requires uploads to present token as a bearer token.
+func WithAuthToken(token string) Option {
+	return optionFunc(func(c *Config) { c.AuthToken = token })
+}
+
+// WithMaxSize caps every upload at mb MB.
+func WithMaxSize(mb int) Option {
+	return optionFunc(func(c *Config) { c.MaxSize = mb })
+}
+
+// WithTTL deletes uploads once they are ttl old.
+func WithTTL(ttl time.Duration) Option {
+	return optionFunc(func(c *Config) { c.TTL = ttl })
+}
+
+// WithPublicURL makes download links start with publicURL, such as the
+// prefix Handler is mounted under.
+func WithPublicURL(publicURL string) Option {
+	return optionFunc(func(c *Config) { c.PublicURL = publicURL })
+}
+
+// New builds a server from opts. It is run standalone with Start, or
+// mounted in another program with Handler and stopped with Shutdown.
+func New(opts ...Option) *Server {
+	var config Config
+	for _, opt := range opts {
+		opt.apply(&config)
+	}
+	return newServer(config)
+}
+
+// Handler returns the endpoints of the server for another program to serve,
+// for example mounted with http.StripPrefix under a path of its own mux.
+// The first call loads the index in the background, and until it is loaded
+// requests are answered with 503 Service Unavailable, as while Start starts.
+// An invalid configuration is logged and leaves the server starting; the
+// listeners of Start, such as SFTP or metrics, are not opened.
+func (s *Server) Handler() http.Handler {
+	s.handlerOnce.Do(func() {
+		s.handler = s.newRouter()
+		go func() {
+			if err := s.prepare(); err != nil {
+				log.Printf("Failed to start: %v\n", err)
+				return
+			}
+			if err := s.startup(); err != nil {
+				log.Printf("Failed to load upload index: %v\n", err)
+			}
+		}()
+	})
+	return s.handler
+}
+
+// prepare checks the configuration before the server takes requests.
+func (s *Server) prepare() error {
+	if err := s.config.Validate(); err != nil {
+		return err
+	}
+	return s.config.useStateTempDir()
+}
+
+// Shutdown stops the background work of the server, such as deleting
+// expired uploads, and sends the traces still buffered. Requests still
+// being served by Handler are left to the http.Server serving it, which
+// should be shut down first.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stopC) })
+	if s.tracerProvider == nil {
+		return nil
+	}
+	return s.tracerProvider.Shutdown(ctx)
+}
@@ -0,0 +1,58 @@
+package simpleserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAppliesOptionsInOrder(t *testing.T) {
+	dir := t.TempDir()
+	s := New(Config{UploadDir: "/elsewhere", MaxSize: 5}, WithUploadDir(dir), WithTTL(time.Hour))
+	require.Equal(t, dir, s.config.UploadDir)
+	require.Equal(t, 5, s.config.MaxSize)
+	require.Equal(t, time.Hour, s.config.TTL)
+}
+
+func TestHandlerMountsInAnotherMux(t *testing.T) {
+	s := New(WithUploadDir(t.TempDir()), WithAuthToken("secret"), WithPublicURL("http://example.com/files"))
+	mux := http.NewServeMux()
+	mux.Handle("/files/", http.StripPrefix("/files", s.Handler()))
+	send := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	require.Eventually(t, func() bool {
+		return send(httptest.NewRequest(http.MethodGet, "/files/startupz", nil)).Code == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+
+	req := httptest.NewRequest(http.MethodPut, "/files/hello.txt", strings.NewReader("embedded"))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := send(req)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	link := downloadURLs(t, rec.Body.String())[0]
+	require.True(t, strings.HasPrefix(link, "http://example.com/files/"), link)
+
+	u, err := url.Parse(link)
+	require.NoError(t, err)
+	rec = send(httptest.NewRequest(http.MethodGet, u.RequestURI(), nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "embedded", rec.Body.String())
+
+	require.NoError(t, s.Shutdown(context.Background()))
+	require.NoError(t, s.Shutdown(context.Background()))
+}
+
+func TestHandlerStaysStartingWithAnInvalidConfig(t *testing.T) {
+	s := New(WithUploadDir(t.TempDir()), WithMaxSize(-1))
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/capabilities", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
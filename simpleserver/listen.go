@@ -0,0 +1,170 @@
+package simpleserver
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// autoPortAttempts bounds how many ports after the configured one are tried
+// with --auto-port.
+const autoPortAttempts = 100
+
+// listen binds the TCP port the server will serve on. A busy port is reported
+// plainly, or skipped when AutoPort is set.
+func (s *Server) listen(port int) (net.Listener, error) {
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		return ln, err
+	}
+	if !s.config.AutoPort {
+		return nil, fmt.Errorf("port %d is already in use", port)
+	}
+	for next := port + 1; next <= port+autoPortAttempts && next <= 65535; next++ {
+		ln, err = net.Listen("tcp", fmt.Sprintf(":%d", next))
+		if err == nil {
+			log.Printf("Port %d is already in use, listening on %d instead\n", port, next)
+			return ln, nil
+		}
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("port %d and the next %d ports are already in use", port, autoPortAttempts)
+}
+
+// listenHTTP binds the addresses uploads are served on: Config.Listen and
+// Config.UnixSocket when either is set, port otherwise.
+func (s *Server) listenHTTP(port int) (net.Listener, error) {
+	if len(s.config.Listen) == 0 && s.config.UnixSocket == "" {
+		return s.listen(port)
+	}
+	var listeners []net.Listener
+	fail := func(err error) (net.Listener, error) {
+		for _, ln := range listeners {
+			ln.Close()
+		}
+		return nil, err
+	}
+	for _, addr := range s.config.Listen {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fail(fmt.Errorf("failed to listen on %s: %w", addr, err))
+		}
+		listeners = append(listeners, ln)
+	}
+	if s.config.UnixSocket != "" {
+		ln, err := listenUnix(s.config.UnixSocket)
+		if err != nil {
+			return fail(fmt.Errorf("failed to listen on %s: %w", s.config.UnixSocket, err))
+		}
+		listeners = append(listeners, ln)
+	}
+	if len(listeners) == 1 {
+		return listeners[0], nil
+	}
+	return newMultiListener(listeners), nil
+}
+
+// listenAddrs describes where listenHTTP serves for the startup message.
+func (s *Server) listenAddrs(ln net.Listener) string {
+	if len(s.config.Listen) == 0 && s.config.UnixSocket == "" {
+		return fmt.Sprintf("port %d", ln.Addr().(*net.TCPAddr).Port)
+	}
+	addrs := append([]string{}, s.config.Listen...)
+	if s.config.UnixSocket != "" {
+		addrs = append(addrs, "unix:"+s.config.UnixSocket)
+	}
+	return strings.Join(addrs, ", ")
+}
+
+// listenUnix binds a unix socket at path. A socket left behind by a server
+// that did not shut down cleanly is replaced, one still accepting
+// connections is not.
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, errors.New("socket is already in use")
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+// multiListener accepts the connections of several listeners as one, so a
+// single HTTP server serves all of them.
+type multiListener struct {
+	listeners []net.Listener
+	accepted  chan acceptResult
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newMultiListener(listeners []net.Listener) *multiListener {
+	m := &multiListener{
+		listeners: listeners,
+		accepted:  make(chan acceptResult),
+		closed:    make(chan struct{}),
+	}
+	for _, ln := range listeners {
+		go m.acceptFrom(ln)
+	}
+	return m
+}
+
+func (m *multiListener) acceptFrom(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		select {
+		case m.accepted <- acceptResult{conn: conn, err: err}:
+		case <-m.closed:
+			if conn != nil {
+				conn.Close()
+			}
+			return
+		}
+	}
+}
+
+func (m *multiListener) Accept() (net.Conn, error) {
+	select {
+	case result := <-m.accepted:
+		return result.conn, result.err
+	case <-m.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (m *multiListener) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		close(m.closed)
+		for _, ln := range m.listeners {
+			if closeErr := ln.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	})
+	return err
+}
+
+// Addr is the address of the first listener.
+func (m *multiListener) Addr() net.Addr {
+	return m.listeners[0].Addr()
+}
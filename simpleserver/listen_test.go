@@ -0,0 +1,77 @@
+package simpleserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func bindPort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestStartReportsPortInUse(t *testing.T) {
+	port := bindPort(t)
+	s := New(Config{Port: port, UploadDir: t.TempDir()})
+	err := s.Start()
+	require.EqualError(t, err, fmt.Sprintf("port %d is already in use", port))
+}
+
+func TestAutoPortPicksFreePort(t *testing.T) {
+	port := bindPort(t)
+	s := New(Config{Port: port, AutoPort: true, UploadDir: t.TempDir()})
+	ln, err := s.listen(port)
+	require.NoError(t, err)
+	defer ln.Close()
+	require.Greater(t, ln.Addr().(*net.TCPAddr).Port, port)
+}
+
+func TestListenOnSeveralAddresses(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "simpleserver.sock")
+	// A socket left behind by a crashed server is replaced.
+	stale, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	s := New(Config{Listen: []string{"127.0.0.1:0", "127.0.0.1:0"}, UnixSocket: socket, UploadDir: t.TempDir()})
+	ln, err := s.listenHTTP(8080)
+	require.NoError(t, err)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})}
+	go server.Serve(ln)
+	defer server.Close()
+
+	get := func(client *http.Client, url string) {
+		t.Helper()
+		resp, err := client.Get(url)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, "ok", string(body))
+	}
+	for _, listener := range ln.(*multiListener).listeners[:2] {
+		get(http.DefaultClient, "http://"+listener.Addr().String()+"/")
+	}
+	unixClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	get(unixClient, "http://simpleserver/")
+
+	_, err = listenUnix(socket)
+	require.EqualError(t, err, "socket is already in use")
+}
@@ -0,0 +1,174 @@
+package simpleserver
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// inDir returns the files of the upload directory dir ordered by name.
+func (ix *metaIndex) inDir(dir string) []FileMeta {
+	ix.mu.RLock()
+	var files []FileMeta
+	for _, meta := range ix.files {
+		if meta.Dir == dir {
+			files = append(files, meta)
+		}
+	}
+	ix.mu.RUnlock()
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	return files
+}
+
+// listedFile describes a file in a directory listing. Password protected
+// files are listed, they still ask for the password when downloaded.
+type listedFile struct {
+	Name      string     `json:"name"`
+	URL       string     `json:"url"`
+	Size      int64      `json:"size"`
+	SHA256    string     `json:"sha256,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	Password  bool       `json:"password,omitempty"`
+	Once      bool       `json:"once,omitempty"`
+	ThumbURL  string     `json:"thumb_url,omitempty"`
+
+	Description string            `json:"description,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+type listingResponse struct {
+	ID    string       `json:"id"`
+	Files []listedFile `json:"files"`
+	// ZipURL downloads the listed files as one archive, except for the
+	// password protected and download once ones.
+	ZipURL string `json:"zip_url"`
+}
+
+var listingPage = template.Must(template.New("listing").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.ID}}</title>
+</head>
+<body style="font-family: system-ui, sans-serif; max-width: 50rem; margin: 3rem auto; padding: 0 1rem">
+<h1>{{.ID}}</h1>
+<table style="width: 100%; border-collapse: collapse">
+<tr><th></th><th align="left">Name</th><th align="right">Size</th><th align="right">Uploaded</th></tr>
+{{range .Files}}<tr><td>{{if .ThumbURL}}<img src="{{.ThumbURL}}?w=64" alt="" loading="lazy" style="max-height: 4rem">{{end}}</td><td><a href="{{.URL}}">{{.Name}}</a></td><td align="right">{{.Size}}</td><td align="right">{{.CreatedAt.Format "2006-01-02 15:04"}}</td></tr>
+{{end}}</table>
+<p><a href="{{.ZipURL}}">Download all as zip</a></p>
+</body>
+</html>
+`))
+
+// requireListingAuth guards directory listings with Config.AuthToken. They
+// are only served when one is configured, except for the directories of
+// users, which only their owner may list, and for links signed by
+// handleShareLink.
+func (s *Server) requireListingAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		dir, _ := wantsZip(c)
+		if signed, valid := s.signedListing(c, dir); signed {
+			if !valid {
+				return fail(c, http.StatusForbidden, "Invalid or expired signature")
+			}
+			return next(c)
+		}
+		if s.isUserDir(dir) {
+			if user, ok := s.requestUser(c); !ok || user != dir {
+				return userUnauthorized(c)
+			}
+			return next(c)
+		}
+		token := s.settings().AuthToken
+		if token == "" {
+			return fail(c, http.StatusNotFound, "Not found")
+		}
+		if !validBearer(c.Request(), token) {
+			return authUnauthorized(c)
+		}
+		return next(c)
+	}
+}
+
+func (s *Server) listedFile(c echo.Context, meta FileMeta) listedFile {
+	file := listedFile{
+		Name:      meta.Name,
+		URL:       s.downloadURL(c, meta.Dir, meta.Name),
+		Size:      meta.Size,
+		SHA256:    meta.SHA256,
+		CreatedAt: meta.CreatedAt,
+		Password:  meta.PasswordHash != "",
+		Once:      meta.Once,
+
+		Description: meta.Description,
+		Tags:        meta.Tags,
+	}
+	if !meta.ExpiresAt.IsZero() {
+		file.ExpiresAt = &meta.ExpiresAt
+	}
+	if s.thumbnailable(meta) {
+		file.ThumbURL = s.thumbURL(c, meta)
+	}
+	return file
+}
+
+// handleListing lists the files of an upload directory, as JSON for clients
+// asking for it and as an HTML page otherwise. Expired files and files still
+// being processed are left out. Listings in zip format download the files
+// instead. A listing opened with a signed link signs the links of its files
+// and its zip until the same deadline.
+func (s *Server) handleListing(c echo.Context) error {
+	dir, zipped := wantsZip(c)
+	if s.hiddenDropShare(c, dir) {
+		return fail(c, http.StatusNotFound, "Directory not found")
+	}
+	if zipped {
+		return s.handleZip(c, dir)
+	}
+	if !isShareDir(dir) {
+		return fail(c, http.StatusNotFound, "Directory not found")
+	}
+	resp := listingResponse{ID: dir, Files: []listedFile{}, ZipURL: s.baseURL(c) + "/" + dir + zipSuffix}
+	var expires int64
+	if _, valid := s.signedListing(c, dir); valid {
+		expires, _ = strconv.ParseInt(c.QueryParam("expires"), 10, 64)
+		resp.ZipURL += signedQuery(expires, s.signListing(dir, expires))
+	}
+	now := time.Now()
+	for _, meta := range s.index.inDir(dir) {
+		if meta.expired(now) || meta.Pending || !meta.listed() {
+			continue
+		}
+		file := s.listedFile(c, meta)
+		if expires != 0 {
+			file.URL += signedQuery(expires, s.signDownload(dir, meta.Name, expires))
+			// Thumbnails are not signed, they would not show where
+			// downloads need credentials.
+			if s.config.ProtectDownloads {
+				file.ThumbURL = ""
+			}
+		}
+		resp.Files = append(resp.Files, file)
+	}
+	if len(resp.Files) == 0 {
+		return fail(c, http.StatusNotFound, "Directory not found")
+	}
+	if s.wantsJSON(c) {
+		return c.JSON(http.StatusOK, resp)
+	}
+	var page strings.Builder
+	if err := listingPage.Execute(&page, resp); err != nil {
+		return err
+	}
+	return c.HTML(http.StatusOK, page.String())
+}
@@ -0,0 +1,83 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListingJSON(t *testing.T) {
+	s := newTestServer(t, Config{AuthToken: testAuthToken})
+	rec := serve(s, authorized(multipartRequest(t, http.MethodPost, "/",
+		testPart{"b.txt", "bb"},
+		testPart{"a.txt", "a"},
+	), testAuthToken))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	dir := shareDirs(t, s)[0]
+
+	for _, target := range []string{"/" + dir, "/" + dir + "/"} {
+		req := authorized(jsonRequest(httptest.NewRequest(http.MethodGet, target, nil)), testAuthToken)
+		rec = serve(s, req)
+		require.Equal(t, http.StatusOK, rec.Code, target)
+		var resp listingResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		require.Equal(t, dir, resp.ID)
+		require.Len(t, resp.Files, 2)
+		require.Equal(t, "a.txt", resp.Files[0].Name)
+		require.Equal(t, "b.txt", resp.Files[1].Name)
+		require.Equal(t, int64(2), resp.Files[1].Size)
+		require.Equal(t, "http://example.com/"+dir+"/a.txt", resp.Files[0].URL)
+		require.Nil(t, resp.Files[0].ExpiresAt)
+	}
+}
+
+func TestListingHTML(t *testing.T) {
+	s := newTestServer(t, Config{AuthToken: testAuthToken})
+	rec := serve(s, authorized(httptest.NewRequest(http.MethodPut, "/<b>.txt", strings.NewReader("x")), testAuthToken))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	dir := shareDirs(t, s)[0]
+
+	rec = serve(s, authorized(httptest.NewRequest(http.MethodGet, "/"+dir+"/", nil), testAuthToken))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Header().Get("Content-Type"), "text/html")
+	require.Contains(t, rec.Body.String(), "&lt;b&gt;.txt")
+	require.NotContains(t, rec.Body.String(), "<b>.txt")
+}
+
+func TestListingRequiresAuthToken(t *testing.T) {
+	s := newTestServer(t, Config{AuthToken: testAuthToken})
+	rec := serve(s, authorized(httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("a")), testAuthToken))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	dir := shareDirs(t, s)[0]
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, "/"+dir+"/", nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = serve(s, authorized(httptest.NewRequest(http.MethodGet, "/"+dir+"/", nil), "wrong"))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// Without an auth token there is nothing to gate listings with.
+	s = newTestServer(t, Config{})
+	rec = serve(s, httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("a")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	rec = serve(s, httptest.NewRequest(http.MethodGet, "/"+shareDirs(t, s)[0]+"/", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestListingSkipsExpiredAndUnknownDirs(t *testing.T) {
+	s := newTestServer(t, Config{AuthToken: testAuthToken})
+	rec := serve(s, authorized(httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("a")), testAuthToken))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	meta := findMeta(t, s, "a.txt")
+	meta.ExpiresAt = time.Now().Add(-time.Minute)
+	require.NoError(t, s.index.put(meta))
+
+	rec = serve(s, authorized(httptest.NewRequest(http.MethodGet, "/"+meta.Dir, nil), testAuthToken))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	rec = serve(s, authorized(httptest.NewRequest(http.MethodGet, "/nothere", nil), testAuthToken))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,127 @@
+package simpleserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+
+	requestLogKey = "simpleserver.files"
+)
+
+// newLogger builds the request logger for LogLevel and LogFormat.
+func newLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if level != "" {
+		if err := lvl.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("invalid log level %q, expected debug, info, warn or error", level)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: lvl, ReplaceAttr: cloudflaredAttrs}
+	switch format {
+	case "", logFormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case logFormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("invalid log format %q, expected %s or %s", format, logFormatJSON, logFormatText)
+}
+
+// cloudflaredAttrs writes the built in attributes the way cloudflared's own
+// JSON logs do: a lowercase level, the text under "message" and an RFC 3339
+// UTC time, so both can be fed to the same pipeline.
+func cloudflaredAttrs(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
+	}
+	switch a.Key {
+	case slog.TimeKey:
+		return slog.String(slog.TimeKey, a.Value.Time().UTC().Format(time.RFC3339))
+	case slog.LevelKey:
+		return slog.String(slog.LevelKey, strings.ToLower(a.Value.String()))
+	case slog.MessageKey:
+		a.Key = "message"
+	}
+	return a
+}
+
+// requestFiles collects the files a request stored or served for its log
+// line.
+type requestFiles struct {
+	dir   string
+	names []string
+	size  int64
+}
+
+// noteFile adds meta to the log line of the request.
+func noteFile(c echo.Context, meta FileMeta) {
+	files, ok := c.Get(requestLogKey).(*requestFiles)
+	if !ok {
+		return
+	}
+	files.dir = meta.Dir
+	files.names = append(files.names, meta.Name)
+	files.size += meta.Size
+}
+
+// requestLogger logs every request once it is done, at warn level for client
+// errors and error level for server errors.
+func (s *Server) requestLogger() echo.MiddlewareFunc {
+	return middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
+		BeforeNextFunc: func(c echo.Context) {
+			c.Set(requestLogKey, &requestFiles{})
+		},
+		LogLatency:      true,
+		LogRemoteIP:     true,
+		LogMethod:       true,
+		LogURI:          true,
+		LogStatus:       true,
+		LogError:        true,
+		LogResponseSize: true,
+		LogRequestID:    true,
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			level := slog.LevelInfo
+			switch {
+			case v.Status >= 500:
+				level = slog.LevelError
+			case v.Status >= 400:
+				level = slog.LevelWarn
+			}
+			attrs := []slog.Attr{
+				slog.String("method", v.Method),
+				slog.String("uri", v.URI),
+				slog.Int("status", v.Status),
+				slog.Duration("duration", v.Latency),
+				slog.String("client_ip", v.RemoteIP),
+				slog.Int64("bytes_out", v.ResponseSize),
+				slog.String("request_id", v.RequestID),
+			}
+			if files, ok := c.Get(requestLogKey).(*requestFiles); ok && len(files.names) > 0 {
+				attrs = append(attrs, slog.String("share_id", files.dir), slog.Int64("size", files.size))
+				if len(files.names) == 1 {
+					attrs = append(attrs, slog.String("filename", files.names[0]))
+				} else {
+					attrs = append(attrs, slog.Int("files", len(files.names)))
+				}
+			}
+			if identity, ok := c.Get(requestIdentityKey).(string); ok {
+				attrs = append(attrs, slog.String("user", identity))
+			}
+			if v.Error != nil {
+				attrs = append(attrs, slog.String("error", v.Error.Error()))
+			}
+			s.logger.LogAttrs(context.Background(), level, "request", attrs...)
+			return nil
+		},
+	})
+}
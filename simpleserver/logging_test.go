@@ -0,0 +1,83 @@
+package simpleserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry), line)
+		lines = append(lines, entry)
+	}
+	buf.Reset()
+	return lines
+}
+
+func TestRequestLogsJSON(t *testing.T) {
+	s := newTestServer(t, Config{})
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "info", logFormatJSON)
+	require.NoError(t, err)
+	s.logger = logger
+
+	req := httptest.NewRequest(http.MethodPut, "/hello.txt", strings.NewReader("hello"))
+	req.RemoteAddr = "127.0.0.1:4242"
+	req.Header.Set("X-Real-IP", "203.0.113.7")
+	rec := serve(s, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	meta := findMeta(t, s, "hello.txt")
+
+	lines := logLines(t, &buf)
+	require.Len(t, lines, 1)
+	entry := lines[0]
+	require.Equal(t, "info", entry["level"])
+	require.Equal(t, "request", entry["message"])
+	require.Equal(t, "PUT", entry["method"])
+	require.Equal(t, float64(http.StatusCreated), entry["status"])
+	require.Equal(t, "203.0.113.7", entry["client_ip"])
+	require.Equal(t, meta.Dir, entry["share_id"])
+	require.Equal(t, "hello.txt", entry["filename"])
+	require.Equal(t, float64(5), entry["size"])
+	require.Contains(t, entry, "duration")
+	_, err = time.Parse(time.RFC3339, entry["time"].(string))
+	require.NoError(t, err)
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, "/"+meta.Dir+"/missing.txt", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	entry = logLines(t, &buf)[0]
+	require.Equal(t, "warn", entry["level"])
+	require.NotContains(t, entry, "share_id")
+}
+
+func TestRequestLogLevel(t *testing.T) {
+	s := newTestServer(t, Config{})
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "warn", logFormatText)
+	require.NoError(t, err)
+	s.logger = logger
+
+	require.Equal(t, http.StatusCreated, serve(s, httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("a"))).Code)
+	require.Empty(t, buf.String())
+	require.Equal(t, http.StatusNotFound, serve(s, httptest.NewRequest(http.MethodGet, "/nodir/a.txt", nil)).Code)
+	require.Contains(t, buf.String(), "level=warn message=request method=GET uri=/nodir/a.txt status=404")
+}
+
+func TestNewLoggerRejectsUnknownSettings(t *testing.T) {
+	_, err := newLogger(&bytes.Buffer{}, "loud", "")
+	require.Error(t, err)
+	_, err = newLogger(&bytes.Buffer{}, "", "xml")
+	require.Error(t, err)
+	_, err = newLogger(&bytes.Buffer{}, "DEBUG", logFormatJSON)
+	require.NoError(t, err)
+}
@@ -0,0 +1,106 @@
+package simpleserver
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maintenanceRetryAfter is the Retry-After, in seconds, sent with uploads
+// refused during maintenance.
+const maintenanceRetryAfter = "60"
+
+type maintenanceResponse struct {
+	Uploads string `json:"uploads"`
+}
+
+func (s *Server) maintenanceStatus() maintenanceResponse {
+	if s.uploadsOff() {
+		return maintenanceResponse{Uploads: "off"}
+	}
+	return maintenanceResponse{Uploads: "on"}
+}
+
+// modeRequest is the body of POST /admin/mode.
+type modeRequest struct {
+	ReadOnly *bool `json:"read_only"`
+}
+
+type modeResponse struct {
+	ReadOnly      bool `json:"read_only"`
+	UploadsPaused bool `json:"uploads_paused"`
+}
+
+// uploadsOff reports whether new uploads are refused, because an operator
+// paused them or the server is read-only.
+func (s *Server) uploadsOff() bool {
+	return s.uploadsPaused.Load() || s.readOnly.Load()
+}
+
+// rejectInMaintenance refuses requests that write to the store while
+// uploads are paused or the server is read-only. Downloads are left alone.
+func (s *Server) rejectInMaintenance(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if s.readOnly.Load() {
+			return readOnlyRefused(c)
+		}
+		if s.uploadsPaused.Load() {
+			c.Response().Header().Set("Retry-After", maintenanceRetryAfter)
+			return failWith(c, http.StatusServiceUnavailable, codePaused, "Uploads are paused for maintenance")
+		}
+		return next(c)
+	}
+}
+
+// rejectWhenReadOnly refuses requests that change the store while the
+// server is read-only, such as admin deletes, which pausing uploads allows.
+func (s *Server) rejectWhenReadOnly(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if s.readOnly.Load() {
+			return readOnlyRefused(c)
+		}
+		return next(c)
+	}
+}
+
+func readOnlyRefused(c echo.Context) error {
+	c.Response().Header().Set("Retry-After", maintenanceRetryAfter)
+	return failWith(c, http.StatusServiceUnavailable, codeReadOnly, "The server is read-only for maintenance")
+}
+
+// handleMaintenance switches uploads off or back on with ?uploads=off|on.
+func (s *Server) handleMaintenance(c echo.Context) error {
+	switch c.QueryParam("uploads") {
+	case "off":
+		s.uploadsPaused.Store(true)
+	case "on":
+		s.uploadsPaused.Store(false)
+	default:
+		return fail(c, http.StatusBadRequest, "uploads must be on or off")
+	}
+	return c.JSON(http.StatusOK, s.maintenanceStatus())
+}
+
+func (s *Server) handleMaintenanceStatus(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.maintenanceStatus())
+}
+
+// handleMode answers GET /admin/mode with whether the server is read-only,
+// and POST /admin/mode {"read_only": true} switches read-only mode on or
+// off. While it is on nothing changes the store: every request that would
+// is refused with 503 and Retry-After, and expiry, garbage collection and
+// scrubbing wait, so the upload directory can be backed up or migrated
+// while downloads go on.
+func (s *Server) handleMode(c echo.Context) error {
+	if c.Request().Method == http.MethodPost {
+		var req modeRequest
+		if err := c.Bind(&req); err != nil || req.ReadOnly == nil {
+			return fail(c, http.StatusBadRequest, `Expected {"read_only": true} or {"read_only": false}`)
+		}
+		if s.readOnly.Swap(*req.ReadOnly) != *req.ReadOnly {
+			log.Printf("Read-only mode switched %s\n", map[bool]string{true: "on", false: "off"}[*req.ReadOnly])
+		}
+	}
+	return c.JSON(http.StatusOK, modeResponse{ReadOnly: s.readOnly.Load(), UploadsPaused: s.uploadsPaused.Load()})
+}
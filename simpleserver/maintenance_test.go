@@ -0,0 +1,100 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenanceModePausesUploads(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/before.txt", strings.NewReader("before")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	fileURL := downloadURLs(t, rec.Body.String())[0]
+
+	rec = serve(s, adminRequest(http.MethodPost, "/admin/maintenance?uploads=off", ""))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"uploads":"off"}`, rec.Body.String())
+
+	rec = serve(s, httptest.NewRequest(http.MethodPut, "/during.txt", strings.NewReader("during")))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Equal(t, maintenanceRetryAfter, rec.Header().Get("Retry-After"))
+	rec = serve(s, httptest.NewRequest(http.MethodPost, "/"+shareDirs(t, s)[0]+"/before.txt/move", strings.NewReader("{}")))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	rec = download(t, s, fileURL)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "before", rec.Body.String())
+
+	rec = serve(s, adminRequest(http.MethodPost, "/admin/maintenance?uploads=on", ""))
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = serve(s, httptest.NewRequest(http.MethodPut, "/after.txt", strings.NewReader("after")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+}
+
+func TestMaintenanceRequiresAdmin(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken})
+	rec := serve(s, httptest.NewRequest(http.MethodPost, "/admin/maintenance?uploads=off", nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = serve(s, adminRequest(http.MethodPost, "/admin/maintenance?uploads=maybe", ""))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = serve(s, adminRequest(http.MethodGet, "/admin/maintenance", ""))
+	require.JSONEq(t, `{"uploads":"on"}`, rec.Body.String())
+}
+
+func setReadOnly(t *testing.T, s *Server, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := adminRequest(http.MethodPost, "/admin/mode", body)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	return serve(s, req)
+}
+
+func TestReadOnlyMode(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/before.txt", strings.NewReader("before")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	fileURL := downloadURLs(t, rec.Body.String())[0]
+	req := httptest.NewRequest(http.MethodPut, "/once.txt", strings.NewReader("once"))
+	req.Header.Set(onceHeader, "true")
+	rec = serve(s, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	onceURL := downloadURLs(t, rec.Body.String())[0]
+
+	rec = setReadOnly(t, s, `{"read_only": true}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"read_only":true,"uploads_paused":false}`, rec.Body.String())
+
+	rec = serve(s, httptest.NewRequest(http.MethodPut, "/during.txt", strings.NewReader("during")))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Equal(t, maintenanceRetryAfter, rec.Header().Get("Retry-After"))
+	rec = serve(s, adminRequest(http.MethodDelete, "/admin/files/"+shareDirs(t, s)[0]+"/before.txt", ""))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	rec = download(t, s, onceURL)
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	rec = download(t, s, fileURL)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "before", rec.Body.String())
+	require.Len(t, s.index.all(), 2)
+
+	rec = setReadOnly(t, s, `{"read_only": false}`)
+	require.JSONEq(t, `{"read_only":false,"uploads_paused":false}`, rec.Body.String())
+	rec = serve(s, httptest.NewRequest(http.MethodPut, "/after.txt", strings.NewReader("after")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	rec = download(t, s, onceURL)
+	require.Equal(t, "once", rec.Body.String())
+}
+
+func TestReadOnlyFlag(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken, ReadOnly: true})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/file.txt", strings.NewReader("data")))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	rec = serve(s, adminRequest(http.MethodGet, "/admin/mode", ""))
+	require.JSONEq(t, `{"read_only":true,"uploads_paused":false}`, rec.Body.String())
+	rec = setReadOnly(t, s, `{}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,65 @@
+package simpleserver
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// maxDownloadsHeader, or the max_downloads query parameter, limits how
+	// many times an upload can be downloaded before its link answers 410.
+	maxDownloadsHeader = "X-Max-Downloads"
+	// downloadsRemainingHeader tells a download how many are left after it.
+	downloadsRemainingHeader = "X-Downloads-Remaining"
+)
+
+var errInvalidMaxDownloads = errors.New(maxDownloadsHeader + " must be a positive integer")
+
+func requestMaxDownloads(c echo.Context) (int64, error) {
+	value := strings.TrimSpace(c.Request().Header.Get(maxDownloadsHeader))
+	if value == "" {
+		value = c.QueryParam("max_downloads")
+	}
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, errInvalidMaxDownloads
+	}
+	return n, nil
+}
+
+// exhausted reports whether meta has used up its downloads.
+func (m FileMeta) exhausted() bool {
+	return m.MaxDownloads > 0 && m.Downloads >= m.MaxDownloads
+}
+
+// reserveDownload claims one of the downloads left to a limited upload and
+// returns how many remain after it. Reservations are held until
+// releaseDownload, so concurrent requests can never exceed the limit.
+func (ix *metaIndex) reserveDownload(key string) (int64, bool) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	meta, ok := ix.files[key]
+	if !ok {
+		return 0, false
+	}
+	used := meta.Downloads + ix.reserved[key]
+	if used >= meta.MaxDownloads {
+		return 0, false
+	}
+	ix.reserved[key]++
+	return meta.MaxDownloads - used - 1, true
+}
+
+func (ix *metaIndex) releaseDownload(key string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if ix.reserved[key]--; ix.reserved[key] <= 0 {
+		delete(ix.reserved, key)
+	}
+}
@@ -0,0 +1,74 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxDownloads(t *testing.T) {
+	s := newTestServer(t, Config{})
+	req := httptest.NewRequest(http.MethodPut, "/report.txt", strings.NewReader("twice"))
+	req.Header.Set(maxDownloadsHeader, "2")
+	u := onceUpload(t, s, req)
+
+	rec := download(t, s, u)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "1", rec.Header().Get(downloadsRemainingHeader))
+	rec = serve(s, rangeRequest(u, "bytes=0-1"))
+	require.Equal(t, http.StatusOK, rec.Code, "limited files are sent whole")
+	require.Equal(t, "twice", rec.Body.String())
+	require.Equal(t, "0", rec.Header().Get(downloadsRemainingHeader))
+
+	rec = download(t, s, u)
+	require.Equal(t, http.StatusGone, rec.Code)
+	require.Equal(t, errorResponse{Code: codeDownloadLimit, Message: "Download limit reached"}, errorOf(t, rec.Body.String()))
+	require.Equal(t, int64(2), findMeta(t, s, "report.txt").Downloads)
+
+	require.Equal(t, 1, s.reapExpired(time.Now()))
+	require.Zero(t, s.index.len())
+}
+
+func TestMaxDownloadsQueryAndJSON(t *testing.T) {
+	s := newTestServer(t, Config{})
+	req := httptest.NewRequest(http.MethodPut, "/report.txt?max_downloads=3", strings.NewReader("thrice"))
+	req.Header.Set("Accept", "application/json")
+	rec := serve(s, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Contains(t, rec.Body.String(), `"max_downloads":3`)
+
+	head := httptest.NewRequest(http.MethodHead, "/"+findMeta(t, s, "report.txt").Dir+"/report.txt", nil)
+	rec = serve(s, head)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "3", rec.Header().Get(downloadsRemainingHeader))
+}
+
+func TestMaxDownloadsConcurrent(t *testing.T) {
+	s := newTestServer(t, Config{})
+	u := onceUpload(t, s, httptest.NewRequest(http.MethodPut, "/report.txt?max_downloads=1", strings.NewReader("one")))
+	key := findMeta(t, s, "report.txt").key()
+
+	remaining, ok := s.index.reserveDownload(key)
+	require.True(t, ok)
+	require.Zero(t, remaining)
+	rec := download(t, s, u)
+	require.Equal(t, http.StatusGone, rec.Code)
+	require.Equal(t, codeDownloadLimit, errorOf(t, rec.Body.String()).Code)
+	s.index.releaseDownload(key)
+	require.Equal(t, "one", download(t, s, u).Body.String())
+	require.Equal(t, http.StatusGone, download(t, s, u).Code)
+}
+
+func TestMaxDownloadsRejectsInvalid(t *testing.T) {
+	s := newTestServer(t, Config{})
+	for _, value := range []string{"0", "-1", "many"} {
+		req := httptest.NewRequest(http.MethodPut, "/report.txt", strings.NewReader("x"))
+		req.Header.Set(maxDownloadsHeader, value)
+		require.Equal(t, http.StatusBadRequest, serve(s, req).Code, value)
+	}
+	require.Zero(t, s.index.len())
+}
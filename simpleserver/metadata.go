@@ -0,0 +1,389 @@
+package simpleserver
+
+import (
+	"log"
+	"maps"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// metaDirName holds the metadata describing every upload. Share ids
+// never start with a dot, so it cannot collide with an upload directory.
+const metaDirName = ".meta"
+
+// FileMeta describes a stored upload. Size is always the size clients see;
+// StoredSize differs from it when the file is encoded or encrypted on disk.
+type FileMeta struct {
+	Dir  string `json:"dir"`
+	Name string `json:"name"`
+	// OriginalName is the client supplied filename when the stored name
+	// differs from it.
+	OriginalName string `json:"original_name,omitempty"`
+	Bucket       string `json:"bucket,omitempty"`
+	Size         int64  `json:"size"`
+	SHA256       string `json:"sha256,omitempty"`
+	// ContentType is sniffed from the content when the file is stored.
+	ContentType string `json:"content_type,omitempty"`
+	// Alias is the short link id resolved by GET /s/:alias.
+	Alias      string `json:"alias,omitempty"`
+	StoredSize int64  `json:"stored_size,omitempty"`
+	Encoding   string `json:"encoding,omitempty"`
+	// Encryption is the at-rest cipher and KeyID identifies its key.
+	Encryption string    `json:"encryption,omitempty"`
+	KeyID      string    `json:"key_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at,omitempty"`
+	// Pending is set until the processing pool has released the upload.
+	Pending bool `json:"pending,omitempty"`
+	// Once deletes the upload after its first complete download.
+	Once bool `json:"once,omitempty"`
+	// MaxDownloads, when set, refuses downloads once Downloads reaches it.
+	MaxDownloads int64 `json:"max_downloads,omitempty"`
+	// Paste marks text posted to /paste, whose link shows it highlighted
+	// and whose /raw variant serves it as plain text.
+	Paste bool `json:"paste,omitempty"`
+	// Blob identifies the stored object of a deduplicated upload. Uploads
+	// with the same Blob are links to a single copy.
+	Blob string `json:"blob,omitempty"`
+	// PasswordHash is the bcrypt hash of the download password, if any.
+	PasswordHash string `json:"password_hash,omitempty"`
+	// Visibility is unlisted or restricted, or empty for public files.
+	// AllowedEmails are the identities that may download a restricted file.
+	Visibility    string   `json:"visibility,omitempty"`
+	AllowedEmails []string `json:"allowed_emails,omitempty"`
+	// DeleteTokenHash is the SHA-256 of the token that lets the uploader
+	// delete the file with DELETE.
+	DeleteTokenHash string `json:"delete_token_hash,omitempty"`
+	// Downloads and BytesServed count successful downloads, including the
+	// partial ones, and the body bytes sent for them.
+	Downloads   int64 `json:"downloads,omitempty"`
+	BytesServed int64 `json:"bytes_served,omitempty"`
+	// Description and Tags are what the uploader told about the file, see
+	// requestMeta.
+	Description string            `json:"description,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+func (m FileMeta) key() string {
+	return metaKey(m.Dir, m.Name)
+}
+
+func metaKey(dir, name string) string {
+	return path.Join(dir, name)
+}
+
+// tokensFileName stores per upload token usage inside the metadata dir.
+const tokensFileName = ".tokens.json"
+
+// metaIndex keeps every FileMeta in memory and records each change in a
+// MetadataStore so the index can be rebuilt on startup. Every change is made
+// to the index under mu first, then written to the store outside of it.
+type metaIndex struct {
+	store MetadataStore
+	// storeMu is held from a change to the index until it is stored, so
+	// the store receives the changes in the order the index made them.
+	// It is taken before mu.
+	storeMu sync.Mutex
+	mu      sync.RWMutex
+	files   map[string]FileMeta
+	tokens  map[string]TokenUsage
+	aliases map[string]string
+	// reserved counts the downloads of limited uploads in progress.
+	reserved map[string]int64
+	// blobs maps a SHA-256 to the keys of the deduplicated uploads with
+	// that content.
+	blobs map[string]map[string]struct{}
+	// terms maps the search terms of the files to their keys, see search.
+	terms map[string]map[string]struct{}
+	// dirs counts the files in every upload directory, see hasDir.
+	dirs map[string]int
+	// writes counts the changes made through the index, so a sync with a
+	// shared store can tell that it raced with one.
+	writes uint64
+}
+
+func newMetaIndex(store MetadataStore) *metaIndex {
+	return &metaIndex{
+		store:    store,
+		files:    make(map[string]FileMeta),
+		tokens:   make(map[string]TokenUsage),
+		aliases:  make(map[string]string),
+		reserved: make(map[string]int64),
+		blobs:    make(map[string]map[string]struct{}),
+		terms:    make(map[string]map[string]struct{}),
+		dirs:     make(map[string]int),
+	}
+}
+
+// load reads the store, replacing the in-memory state.
+func (ix *metaIndex) load() error {
+	files, tokens, err := ix.store.Load()
+	if err != nil {
+		return err
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.replace(files, tokens)
+	return nil
+}
+
+// replace swaps the in-memory state for files and tokens. The caller must
+// hold ix.mu.
+func (ix *metaIndex) replace(files map[string]FileMeta, tokens map[string]TokenUsage) {
+	aliases := make(map[string]string)
+	ix.blobs = make(map[string]map[string]struct{})
+	ix.terms = make(map[string]map[string]struct{})
+	ix.dirs = make(map[string]int)
+	for key, meta := range files {
+		ix.addBlob(meta)
+		ix.addTerms(meta)
+		ix.addDir(meta)
+		if meta.Alias != "" {
+			aliases[meta.Alias] = key
+		}
+	}
+	ix.files = files
+	ix.tokens = tokens
+	ix.aliases = aliases
+}
+
+func (ix *metaIndex) put(meta FileMeta) error {
+	ix.storeMu.Lock()
+	defer ix.storeMu.Unlock()
+	ix.mu.Lock()
+	old, had := ix.files[meta.key()]
+	ix.set(meta)
+	ix.mu.Unlock()
+	if err := ix.store.Put(meta); err != nil {
+		// Undo the change, so the index holds what the store does.
+		ix.mu.Lock()
+		if had {
+			ix.set(old)
+		} else {
+			ix.remove(meta.key())
+		}
+		ix.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// set puts meta in the index. The caller must hold ix.mu.
+func (ix *metaIndex) set(meta FileMeta) {
+	if old, ok := ix.files[meta.key()]; ok {
+		ix.dropBlob(old)
+		ix.dropTerms(old)
+		ix.dropDir(old)
+	}
+	ix.files[meta.key()] = meta
+	ix.addBlob(meta)
+	ix.addTerms(meta)
+	ix.addDir(meta)
+	if meta.Alias != "" {
+		ix.aliases[meta.Alias] = meta.key()
+	}
+	ix.writes++
+}
+
+// remove drops key from the index. The caller must hold ix.mu.
+func (ix *metaIndex) remove(key string) {
+	if meta, ok := ix.files[key]; ok {
+		if ix.aliases[meta.Alias] == key {
+			delete(ix.aliases, meta.Alias)
+		}
+		ix.dropBlob(meta)
+		ix.dropTerms(meta)
+		ix.dropDir(meta)
+	}
+	delete(ix.files, key)
+	ix.writes++
+}
+
+// addServed charges a download of n bytes to dir/name. The count is taken
+// and raised under mu, and the result stored like any other change, so
+// concurrent downloads and puts never store a stale count.
+func (ix *metaIndex) addServed(dir, name string, n int64) error {
+	key := metaKey(dir, name)
+	ix.storeMu.Lock()
+	defer ix.storeMu.Unlock()
+	ix.mu.Lock()
+	meta, ok := ix.files[key]
+	if ok {
+		meta.Downloads++
+		meta.BytesServed += n
+		ix.files[key] = meta
+		ix.writes++
+	}
+	ix.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return ix.store.Put(meta)
+}
+
+// expired returns the files whose expiry has passed at now.
+func (ix *metaIndex) expired(now time.Time) []FileMeta {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	var expired []FileMeta
+	for _, meta := range ix.files {
+		if meta.expired(now) {
+			expired = append(expired, meta)
+		}
+	}
+	return expired
+}
+
+// topServed returns up to limit files ordered by bytes served.
+func (ix *metaIndex) topServed(limit int) []FileMeta {
+	ix.mu.RLock()
+	files := make([]FileMeta, 0, len(ix.files))
+	for _, meta := range ix.files {
+		if meta.Downloads > 0 {
+			files = append(files, meta)
+		}
+	}
+	ix.mu.RUnlock()
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].BytesServed != files[j].BytesServed {
+			return files[i].BytesServed > files[j].BytesServed
+		}
+		return files[i].key() < files[j].key()
+	})
+	if len(files) > limit {
+		files = files[:limit]
+	}
+	return files
+}
+
+func (ix *metaIndex) get(dir, name string) (FileMeta, bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	meta, ok := ix.files[metaKey(dir, name)]
+	return meta, ok
+}
+
+func (ix *metaIndex) delete(dir, name string) error {
+	key := metaKey(dir, name)
+	ix.storeMu.Lock()
+	defer ix.storeMu.Unlock()
+	ix.mu.Lock()
+	ix.remove(key)
+	ix.mu.Unlock()
+	return ix.store.Delete(key)
+}
+
+// pending returns the uploads still waiting for processing.
+func (ix *metaIndex) pending() []FileMeta {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	var pending []FileMeta
+	for _, meta := range ix.files {
+		if meta.Pending {
+			pending = append(pending, meta)
+		}
+	}
+	return pending
+}
+
+// nextAlias reserves a new short link id for key. It is taken under the
+// write lock, so concurrent uploads never get the same one. Servers sharing
+// a store reserve it there too, as they do not see each other's reservations.
+func (ix *metaIndex) nextAlias(key string) string {
+	shared, _ := ix.store.(sharedStore)
+	for {
+		alias := base62(aliasLength)
+		ix.mu.Lock()
+		_, taken := ix.aliases[alias]
+		if !taken {
+			ix.aliases[alias] = key
+		}
+		ix.mu.Unlock()
+		if taken {
+			continue
+		}
+		if shared == nil {
+			return alias
+		}
+		reserved, err := shared.ReserveAlias(alias, key)
+		if err != nil {
+			log.Printf("Failed to reserve short link id %s in the shared store: %v\n", alias, err)
+			return alias
+		}
+		if reserved {
+			return alias
+		}
+		ix.mu.Lock()
+		if ix.aliases[alias] == key {
+			delete(ix.aliases, alias)
+		}
+		ix.mu.Unlock()
+	}
+}
+
+func (ix *metaIndex) resolveAlias(alias string) (FileMeta, bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	meta, ok := ix.files[ix.aliases[alias]]
+	return meta, ok
+}
+
+func (ix *metaIndex) len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.files)
+}
+
+func (ix *metaIndex) tokenUsage(token string) TokenUsage {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.tokens[token]
+}
+
+func (ix *metaIndex) putTokenUsage(token string, usage TokenUsage) error {
+	ix.storeMu.Lock()
+	defer ix.storeMu.Unlock()
+	ix.mu.Lock()
+	ix.tokens[token] = usage
+	tokens := maps.Clone(ix.tokens)
+	ix.mu.Unlock()
+	return ix.store.PutTokens(tokens)
+}
+
+// expired reports whether meta is past its expiry at now or out of
+// downloads. Either way it is refused with 410 and left to the reaper.
+func (m FileMeta) expired(now time.Time) bool {
+	return m.exhausted() || !m.ExpiresAt.IsZero() && now.After(m.ExpiresAt)
+}
+
+// servedInBulk reports whether meta may be handed out by zip archives and
+// WebDAV. Password protected, download once, download limited and restricted
+// files are left out, as those would serve them without the password,
+// without counting the download or to anyone.
+func (m FileMeta) servedInBulk(now time.Time) bool {
+	return !m.expired(now) && !m.Pending && m.PasswordHash == "" && !m.Once && m.MaxDownloads == 0 && m.Visibility != visibilityRestricted
+}
+
+// storedVerbatim reports whether the stored bytes are the uploaded ones.
+func (m FileMeta) storedVerbatim() bool {
+	return m.Encoding == "" && m.Encryption == ""
+}
+
+// contentType is the type downloads are served with. Files stored before
+// types were recorded fall back to their extension.
+func (m FileMeta) contentType() string {
+	if m.ContentType != "" {
+		return m.ContentType
+	}
+	return detectContentType(m.Name, nil)
+}
+
+// displayName is the filename clients should see for the upload.
+func (m FileMeta) displayName() string {
+	if m.OriginalName != "" {
+		return m.OriginalName
+	}
+	return path.Base(m.Name)
+}
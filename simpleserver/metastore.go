@@ -0,0 +1,327 @@
+package simpleserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	metadataStoreFiles   = "files"
+	metadataStoreJournal = "journal"
+)
+
+// journalFileName is the single file index kept inside the metadata dir.
+const journalFileName = ".index.jsonl"
+
+// journalCompactMin is the number of stale records the journal may hold
+// before it is rewritten.
+const journalCompactMin = 1024
+
+// MetadataStore persists the metadata index. The index itself always lives in
+// memory; a store only has to replay it on startup and record every change.
+type MetadataStore interface {
+	Load() (map[string]FileMeta, map[string]TokenUsage, error)
+	Put(meta FileMeta) error
+	Delete(key string) error
+	PutTokens(tokens map[string]TokenUsage) error
+}
+
+// newMetadataStore builds the store selected by Config.MetadataStore: one
+// JSON sidecar per upload when empty or "files", "journal", or a
+// redis:// URL shared by the servers of a cluster.
+func newMetadataStore(config Config, uploadDir string) (MetadataStore, error) {
+	root := filepath.Join(uploadDir, metaDirName)
+	switch {
+	case config.MetadataStore == "" || config.MetadataStore == metadataStoreFiles:
+		return sidecarStore{root: root}, nil
+	case config.MetadataStore == metadataStoreJournal:
+		return &journalStore{path: filepath.Join(root, journalFileName), sidecars: sidecarStore{root: root}, fsync: config.Fsync}, nil
+	case strings.HasPrefix(config.MetadataStore, "redis://"):
+		return newRedisMetaStore(config.MetadataStore)
+	}
+	return nil, fmt.Errorf("unknown metadata store %q, expected %s, %s or redis://host[:port][/db]", redactURL(config.MetadataStore), metadataStoreFiles, metadataStoreJournal)
+}
+
+// sidecarStore writes every FileMeta to <upload-dir>/.meta/<dir>/<name>.json.
+type sidecarStore struct {
+	root string
+}
+
+func (ss sidecarStore) path(key string) string {
+	return filepath.Join(ss.root, filepath.FromSlash(key)) + ".json"
+}
+
+// Load walks all sidecars.
+func (ss sidecarStore) Load() (map[string]FileMeta, map[string]TokenUsage, error) {
+	files := make(map[string]FileMeta)
+	err := filepath.WalkDir(ss.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && p == ss.root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(p, ".json") || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		var meta FileMeta
+		if err := json.Unmarshal(content, &meta); err != nil {
+			// A torn sidecar should not keep the whole server from starting.
+			return nil
+		}
+		files[meta.key()] = meta
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	tokens := make(map[string]TokenUsage)
+	content, err := os.ReadFile(filepath.Join(ss.root, tokensFileName))
+	if err == nil {
+		if err := json.Unmarshal(content, &tokens); err != nil {
+			return nil, nil, err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, err
+	}
+	return files, tokens, nil
+}
+
+func (ss sidecarStore) Put(meta FileMeta) error {
+	content, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	p := ss.path(meta.key())
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, content, 0644)
+}
+
+func (ss sidecarStore) Delete(key string) error {
+	err := os.Remove(ss.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (ss sidecarStore) PutTokens(tokens map[string]TokenUsage) error {
+	content, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(ss.root, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(ss.root, tokensFileName), content, 0644)
+}
+
+// journalRecord is one line of the journal.
+type journalRecord struct {
+	Op     string                `json:"op"`
+	Meta   *FileMeta             `json:"meta,omitempty"`
+	Key    string                `json:"key,omitempty"`
+	Tokens map[string]TokenUsage `json:"tokens,omitempty"`
+}
+
+const (
+	journalPut    = "put"
+	journalDelete = "delete"
+	journalTokens = "tokens"
+)
+
+// journalStore keeps the whole index in a single append-only file, so
+// startup reads one file instead of walking a sidecar per upload. Stale
+// records are compacted away once they outnumber the live ones. It is the
+// embedded index in place of SQLite or bbolt, which the module does not
+// depend on: listing, quotas, expiry and stats are answered by the index in
+// memory, so the store only has to record changes durably and in order.
+type journalStore struct {
+	path string
+	// sidecars is imported when the journal does not exist yet.
+	sidecars sidecarStore
+	fsync    bool
+
+	mu     sync.Mutex
+	file   *os.File
+	files  map[string]FileMeta
+	tokens map[string]TokenUsage
+	// records counts the lines in the journal.
+	records int
+}
+
+// Load replays the journal and rewrites it without stale records.
+func (js *journalStore) Load() (map[string]FileMeta, map[string]TokenUsage, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	if err := js.load(); err != nil {
+		return nil, nil, err
+	}
+	return maps.Clone(js.files), maps.Clone(js.tokens), nil
+}
+
+// load imports the sidecars when there is no journal yet. The caller must
+// hold js.mu.
+func (js *journalStore) load() error {
+	if js.file != nil {
+		js.file.Close()
+		js.file = nil
+	}
+	files, tokens, err := js.replay()
+	if errors.Is(err, fs.ErrNotExist) {
+		files, tokens, err = js.sidecars.Load()
+	}
+	if err != nil {
+		return err
+	}
+	js.files, js.tokens = files, tokens
+	return js.compact()
+}
+
+func (js *journalStore) replay() (map[string]FileMeta, map[string]TokenUsage, error) {
+	file, err := os.Open(js.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	files := make(map[string]FileMeta)
+	tokens := make(map[string]TokenUsage)
+	r := bufio.NewReader(file)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var record journalRecord
+			// A torn or corrupt record, typically the last one written
+			// before a crash, is skipped like a torn sidecar.
+			if json.Unmarshal(line, &record) == nil {
+				applyJournalRecord(files, tokens, record)
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	return files, tokens, nil
+}
+
+func applyJournalRecord(files map[string]FileMeta, tokens map[string]TokenUsage, record journalRecord) {
+	switch record.Op {
+	case journalPut:
+		if record.Meta != nil {
+			files[record.Meta.key()] = *record.Meta
+		}
+	case journalDelete:
+		delete(files, record.Key)
+	case journalTokens:
+		clear(tokens)
+		for token, usage := range record.Tokens {
+			tokens[token] = usage
+		}
+	}
+}
+
+func (js *journalStore) Put(meta FileMeta) error {
+	return js.append(journalRecord{Op: journalPut, Meta: &meta})
+}
+
+func (js *journalStore) Delete(key string) error {
+	return js.append(journalRecord{Op: journalDelete, Key: key})
+}
+
+func (js *journalStore) PutTokens(tokens map[string]TokenUsage) error {
+	return js.append(journalRecord{Op: journalTokens, Tokens: maps.Clone(tokens)})
+}
+
+func (js *journalStore) append(record journalRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	// Compaction rewrites the journal from memory, so it must never run
+	// before the existing records were read.
+	if js.file == nil {
+		if err := js.load(); err != nil {
+			return err
+		}
+	}
+	if _, err := js.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if js.fsync {
+		if err := js.file.Sync(); err != nil {
+			return err
+		}
+	}
+	applyJournalRecord(js.files, js.tokens, record)
+	js.records++
+	if js.records-js.live() > max(js.live(), journalCompactMin) {
+		return js.compact()
+	}
+	return nil
+}
+
+// live is the number of records a compacted journal holds.
+func (js *journalStore) live() int {
+	return len(js.files) + 1
+}
+
+// compact atomically replaces the journal with one record per upload. The
+// caller must hold js.mu.
+func (js *journalStore) compact() error {
+	if err := os.MkdirAll(filepath.Dir(js.path), 0755); err != nil {
+		return err
+	}
+	tmp := js.path + partSuffix
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	err = enc.Encode(journalRecord{Op: journalTokens, Tokens: js.tokens})
+	for _, meta := range js.files {
+		if err != nil {
+			break
+		}
+		err = enc.Encode(journalRecord{Op: journalPut, Meta: &meta})
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, js.path); err != nil {
+		return err
+	}
+	if js.file != nil {
+		js.file.Close()
+	}
+	js.file, err = os.OpenFile(js.path, os.O_WRONLY|os.O_APPEND, 0644)
+	js.records = js.live()
+	return err
+}
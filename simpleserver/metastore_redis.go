@@ -0,0 +1,143 @@
+package simpleserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+const (
+	redisMetaKey   = "simpleserver:meta"
+	redisTokensKey = "simpleserver:tokens"
+	redisAliasKey  = "simpleserver:aliases"
+)
+
+// sharedStore is implemented by metadata stores that several servers use at
+// once, so their entries may change behind the back of the index.
+type sharedStore interface {
+	// Lookup reads the current entry of key.
+	Lookup(key string) (FileMeta, bool, error)
+	// ReserveAlias claims a short link id for key, unless a server has
+	// claimed it before.
+	ReserveAlias(alias, key string) (bool, error)
+}
+
+// redisMetaStore keeps the index in Redis hashes, one field per upload, so
+// every server of a cluster sees the uploads of the others.
+type redisMetaStore struct {
+	client *redisClient
+}
+
+func newRedisMetaStore(rawURL string) (*redisMetaStore, error) {
+	client, err := newRedisClient(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &redisMetaStore{client: client}, nil
+}
+
+// Load reads both hashes whole.
+func (rs *redisMetaStore) Load() (map[string]FileMeta, map[string]TokenUsage, error) {
+	files := make(map[string]FileMeta)
+	err := rs.scan(redisMetaKey, func(key string, value []byte) {
+		var meta FileMeta
+		if err := json.Unmarshal(value, &meta); err != nil {
+			log.Printf("Skipping unreadable metadata of %s in Redis: %v\n", key, err)
+			return
+		}
+		files[key] = meta
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	tokens := make(map[string]TokenUsage)
+	err = rs.scan(redisTokensKey, func(token string, value []byte) {
+		var usage TokenUsage
+		if err := json.Unmarshal(value, &usage); err == nil {
+			tokens[token] = usage
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return files, tokens, nil
+}
+
+// scan calls fn with every field of the hash key.
+func (rs *redisMetaStore) scan(key string, fn func(field string, value []byte)) error {
+	reply, err := rs.client.do(context.Background(), "HGETALL", key)
+	if err != nil {
+		return err
+	}
+	fields, ok := reply.([]interface{})
+	if !ok || len(fields)%2 != 0 {
+		return fmt.Errorf("unexpected Redis reply %v", reply)
+	}
+	for i := 0; i < len(fields); i += 2 {
+		field, _ := fields[i].(string)
+		value, _ := fields[i+1].(string)
+		fn(field, []byte(value))
+	}
+	return nil
+}
+
+func (rs *redisMetaStore) Put(meta FileMeta) error {
+	content, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	_, err = rs.client.do(context.Background(), "HSET", redisMetaKey, meta.key(), string(content))
+	return err
+}
+
+func (rs *redisMetaStore) Delete(key string) error {
+	_, err := rs.client.do(context.Background(), "HDEL", redisMetaKey, key)
+	return err
+}
+
+func (rs *redisMetaStore) PutTokens(tokens map[string]TokenUsage) error {
+	if len(tokens) == 0 {
+		return nil
+	}
+	args := []string{"HSET", redisTokensKey}
+	for token, usage := range tokens {
+		content, err := json.Marshal(usage)
+		if err != nil {
+			return err
+		}
+		args = append(args, token, string(content))
+	}
+	_, err := rs.client.do(context.Background(), args...)
+	return err
+}
+
+func (rs *redisMetaStore) Lookup(key string) (FileMeta, bool, error) {
+	reply, err := rs.client.do(context.Background(), "HGET", redisMetaKey, key)
+	if err != nil || reply == nil {
+		return FileMeta{}, false, err
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return FileMeta{}, false, fmt.Errorf("unexpected Redis reply %v", reply)
+	}
+	var meta FileMeta
+	if err := json.Unmarshal([]byte(value), &meta); err != nil {
+		return FileMeta{}, false, err
+	}
+	return meta, true, nil
+}
+
+// ReserveAlias claims alias with HSETNX, so only one server gets it.
+// Reservations are kept after a delete, so an id is never handed out twice.
+func (rs *redisMetaStore) ReserveAlias(alias, key string) (bool, error) {
+	reply, err := rs.client.do(context.Background(), "HSETNX", redisAliasKey, alias, key)
+	if err != nil {
+		return false, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return false, fmt.Errorf("unexpected Redis reply %v", reply)
+	}
+	return n == 1, nil
+}
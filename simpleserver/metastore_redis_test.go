@@ -0,0 +1,113 @@
+package simpleserver
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedisHashes serves the hash commands of redisMetaStore from memory.
+func fakeRedisHashes(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	var mu sync.Mutex
+	hashes := make(map[string]map[string]string)
+	bulk := func(s string) string { return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n" }
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					reply, err := readRESP(reader)
+					if err != nil {
+						return
+					}
+					items := reply.([]interface{})
+					args := make([]string, len(items))
+					for i, item := range items {
+						args[i] = item.(string)
+					}
+					mu.Lock()
+					hash := hashes[args[min(1, len(args)-1)]]
+					if hash == nil {
+						hash = make(map[string]string)
+						hashes[args[min(1, len(args)-1)]] = hash
+					}
+					var out string
+					switch args[0] {
+					case "HSET":
+						for i := 2; i+1 < len(args); i += 2 {
+							hash[args[i]] = args[i+1]
+						}
+						out = ":1\r\n"
+					case "HGET":
+						if value, ok := hash[args[2]]; ok {
+							out = bulk(value)
+						} else {
+							out = "$-1\r\n"
+						}
+					case "HDEL":
+						delete(hash, args[2])
+						out = ":1\r\n"
+					case "HGETALL":
+						out = "*" + strconv.Itoa(2*len(hash)) + "\r\n"
+						for field, value := range hash {
+							out += bulk(field) + bulk(value)
+						}
+					case "HSETNX":
+						out = ":0\r\n"
+						if _, ok := hash[args[2]]; !ok {
+							hash[args[2]] = args[3]
+							out = ":1\r\n"
+						}
+					default:
+						out = "-ERR unknown command\r\n"
+					}
+					mu.Unlock()
+					conn.Write([]byte(out))
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestRedisMetaStore(t *testing.T) {
+	rs, err := newRedisMetaStore("redis://" + fakeRedisHashes(t))
+	require.NoError(t, err)
+	meta := FileMeta{Dir: "abc", Name: "notes.txt", Size: 4}
+	require.NoError(t, rs.Put(meta))
+	require.NoError(t, rs.PutTokens(map[string]TokenUsage{"token": {Uploads: 2}}))
+
+	found, ok, err := rs.Lookup("abc/notes.txt")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, meta.Size, found.Size)
+	files, tokens, err := rs.Load()
+	require.NoError(t, err)
+	require.Contains(t, files, "abc/notes.txt")
+	require.EqualValues(t, 2, tokens["token"].Uploads)
+
+	require.NoError(t, rs.Delete("abc/notes.txt"))
+	_, ok, err = rs.Lookup("abc/notes.txt")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	reserved, err := rs.ReserveAlias("a1B2c", "abc/notes.txt")
+	require.NoError(t, err)
+	require.True(t, reserved)
+	reserved, err = rs.ReserveAlias("a1B2c", "def/other.txt")
+	require.NoError(t, err)
+	require.False(t, reserved, "another server claimed the id")
+}
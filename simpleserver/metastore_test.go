@@ -0,0 +1,133 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournalStoreReloadsIndex(t *testing.T) {
+	s := newTestServer(t, Config{MetadataStore: metadataStoreJournal})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("notes")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	rec = serve(s, httptest.NewRequest(http.MethodPut, "/gone.txt", strings.NewReader("gone")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.NoError(t, s.deleteFile(findMeta(t, s, "gone.txt")))
+	notes := findMeta(t, s, "notes.txt")
+	require.Equal(t, http.StatusOK, download(t, s, "/"+notes.Dir+"/notes.txt").Code)
+
+	_, err := os.Stat(filepath.Join(s.config.UploadDir, metaDirName, notes.Dir))
+	require.ErrorIs(t, err, os.ErrNotExist, "journal must not write sidecars")
+
+	restarted := newTestServer(t, Config{UploadDir: s.config.UploadDir, MetadataStore: metadataStoreJournal})
+	require.Equal(t, 1, restarted.index.len())
+	meta, ok := restarted.index.get(notes.Dir, "notes.txt")
+	require.True(t, ok)
+	require.Equal(t, int64(len("notes")), meta.Size)
+	require.Equal(t, int64(1), meta.Downloads)
+}
+
+func TestJournalStoreImportsSidecars(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("notes")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	dir := shareDirs(t, s)[0]
+
+	restarted := newTestServer(t, Config{UploadDir: s.config.UploadDir, MetadataStore: metadataStoreJournal})
+	_, ok := restarted.index.get(dir, "notes.txt")
+	require.True(t, ok)
+	_, err := os.Stat(filepath.Join(s.config.UploadDir, metaDirName, journalFileName))
+	require.NoError(t, err)
+}
+
+func TestJournalStoreSkipsTornRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), journalFileName)
+	js := &journalStore{path: path}
+	require.NoError(t, js.Put(FileMeta{Dir: "abc", Name: "a.txt", Size: 1}))
+	require.NoError(t, js.PutTokens(map[string]TokenUsage{"tok": {Uploads: 2}}))
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"op":"put","meta":{"dir":"abc","na`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	files, tokens, err := (&journalStore{path: path}).Load()
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.Equal(t, int64(1), files["abc/a.txt"].Size)
+	require.Equal(t, int64(2), tokens["tok"].Uploads)
+}
+
+func TestJournalStoreCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), journalFileName)
+	js := &journalStore{path: path}
+	meta := FileMeta{Dir: "abc", Name: "a.txt"}
+	for i := 0; i < 3*journalCompactMin; i++ {
+		meta.Downloads++
+		require.NoError(t, js.Put(meta))
+	}
+	require.LessOrEqual(t, js.records, journalCompactMin+js.live())
+
+	files, _, err := (&journalStore{path: path}).Load()
+	require.NoError(t, err)
+	require.Equal(t, int64(3*journalCompactMin), files["abc/a.txt"].Downloads)
+}
+
+func TestNewMetadataStoreRejectsUnknown(t *testing.T) {
+	_, err := newMetadataStore(Config{MetadataStore: "sqlite"}, t.TempDir())
+	require.Error(t, err)
+}
+
+// gatedStore holds every Put of a wrapped store until gate is closed.
+type gatedStore struct {
+	MetadataStore
+	gate chan struct{}
+}
+
+func (g gatedStore) Put(meta FileMeta) error {
+	<-g.gate
+	return g.MetadataStore.Put(meta)
+}
+
+func TestMetaIndexStoresChangesInOrder(t *testing.T) {
+	store := gatedStore{MetadataStore: sidecarStore{root: t.TempDir()}, gate: make(chan struct{})}
+	ix := newMetaIndex(store)
+	meta := FileMeta{Dir: "abc", Name: "notes.txt", Size: 5}
+
+	done := make(chan error, 1)
+	go func() { done <- ix.put(meta) }()
+	require.Eventually(t, func() bool {
+		// The index stays readable while the store is written.
+		_, ok := ix.get("abc", "notes.txt")
+		return ok
+	}, 5*time.Second, time.Millisecond)
+	close(store.gate)
+	require.NoError(t, <-done)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, ix.addServed("abc", "notes.txt", 5))
+		}()
+		go func() {
+			defer wg.Done()
+			latest, _ := ix.get("abc", "notes.txt")
+			latest.Description = "edited"
+			require.NoError(t, ix.put(latest))
+		}()
+	}
+	wg.Wait()
+	files, _, err := store.Load()
+	require.NoError(t, err)
+	indexed, _ := ix.get("abc", "notes.txt")
+	require.Equal(t, indexed, files["abc/notes.txt"])
+}
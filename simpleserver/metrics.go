@@ -0,0 +1,129 @@
+package simpleserver
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	metricsPath      = "/metrics"
+	metricsNamespace = "simpleserver"
+)
+
+// serverMetrics are exported at /metrics. Every Server keeps its own registry
+// so several can run in one process.
+type serverMetrics struct {
+	registry        *prometheus.Registry
+	uploads         prometheus.Counter
+	downloads       prometheus.Counter
+	deletes         prometheus.Counter
+	uploadBytes     prometheus.Counter
+	downloadBytes   prometheus.Counter
+	corruptions     prometheus.Counter
+	activeRequests  prometheus.Gauge
+	requestDuration *prometheus.HistogramVec
+}
+
+func newServerMetrics(index *metaIndex) *serverMetrics {
+	counter := func(name, help string) prometheus.Counter {
+		return prometheus.NewCounter(prometheus.CounterOpts{Namespace: metricsNamespace, Name: name, Help: help})
+	}
+	m := &serverMetrics{
+		registry:      prometheus.NewRegistry(),
+		uploads:       counter("uploads_total", "Number of files stored"),
+		downloads:     counter("downloads_total", "Number of downloads served, including partial ones"),
+		deletes:       counter("deletes_total", "Number of files deleted"),
+		uploadBytes:   counter("upload_bytes_total", "Bytes of files stored"),
+		downloadBytes: counter("download_bytes_total", "Body bytes sent for downloads"),
+		corruptions:   counter("corrupted_files_total", "Number of stored files the scrubber found not matching their SHA-256"),
+		activeRequests: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "active_requests",
+			Help:      "Number of requests being handled",
+		}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "request_duration_seconds",
+			Help:      "Time taken to handle requests, by method, route and status code",
+			Buckets:   []float64{0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300},
+		}, []string{"method", "route", "code"}),
+	}
+	m.registry.MustRegister(m.uploads, m.downloads, m.deletes, m.uploadBytes, m.downloadBytes, m.corruptions,
+		m.activeRequests, m.requestDuration,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "stored_bytes",
+			Help:      "Space taken by all uploads in the storage backend",
+		}, func() float64 { return float64(index.storedBytes()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "stored_files",
+			Help:      "Number of uploads in the storage backend",
+		}, func() float64 { return float64(index.len()) }),
+	)
+	return m
+}
+
+// observe counts a published event.
+func (m *serverMetrics) observe(event Event) {
+	switch event.Type {
+	case EventUpload:
+		m.uploads.Inc()
+		m.uploadBytes.Add(float64(event.Size))
+	case EventDownload:
+		m.downloads.Inc()
+		m.downloadBytes.Add(float64(event.Bytes))
+	case EventDelete, EventExpire:
+		m.deletes.Inc()
+	}
+}
+
+// instrument tracks the requests in flight and how long they take. Requests
+// are labelled with their route rather than their path to keep the number of
+// series bounded.
+func (s *Server) instrument(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		s.metrics.activeRequests.Inc()
+		defer s.metrics.activeRequests.Dec()
+		start := time.Now()
+		err := next(c)
+		status := c.Response().Status
+		if httpErr, ok := err.(*echo.HTTPError); ok && !c.Response().Committed {
+			status = httpErr.Code
+		}
+		s.metrics.requestDuration.
+			WithLabelValues(c.Request().Method, c.Path(), strconv.Itoa(status)).
+			Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+func (s *Server) metricsHandler() echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.HandlerFor(s.metrics.registry, promhttp.HandlerOpts{}))
+}
+
+// serveMetrics serves /metrics alone on MetricsPort until shutdownC is
+// closed.
+func (s *Server) serveMetrics(shutdownC <-chan struct{}) {
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.GET(metricsPath, s.metricsHandler())
+	ln, err := s.listen(s.config.MetricsPort)
+	if err != nil {
+		log.Printf("Failed to serve metrics: %v\n", err)
+		return
+	}
+	e.Listener = ln
+	fmt.Printf("Metrics available on port %d at %s\n", ln.Addr().(*net.TCPAddr).Port, metricsPath)
+	if err := s.serve(e, shutdownC); err != nil {
+		log.Printf("Metrics server stopped: %v\n", err)
+	}
+}
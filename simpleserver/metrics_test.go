@@ -0,0 +1,79 @@
+package simpleserver
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T, s *Server) string {
+	t.Helper()
+	rec := serve(s, httptest.NewRequest(http.MethodGet, metricsPath, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String()
+}
+
+func TestMetricsCountTransfers(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/hello.txt", strings.NewReader("hello")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	url := downloadURLs(t, rec.Body.String())[0]
+	require.Equal(t, http.StatusOK, download(t, s, url).Code)
+	require.Equal(t, http.StatusPartialContent, serve(s, rangeRequest(url, "bytes=0-1")).Code)
+
+	metrics := scrape(t, s)
+	for _, line := range []string{
+		"simpleserver_uploads_total 1",
+		"simpleserver_upload_bytes_total 5",
+		"simpleserver_downloads_total 2",
+		"simpleserver_download_bytes_total 7",
+		"simpleserver_stored_bytes 5",
+		"simpleserver_stored_files 1",
+		// The scrape itself is in flight.
+		"simpleserver_active_requests 1",
+		`simpleserver_request_duration_seconds_count{code="201",method="PUT",route="/*"} 1`,
+		`simpleserver_request_duration_seconds_count{code="206",method="GET",route="/:dir/*"} 1`,
+	} {
+		require.Contains(t, metrics, line+"\n")
+	}
+}
+
+func TestMetricsOnSeparatePort(t *testing.T) {
+	ln, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+	require.NoError(t, ln.Close())
+	s := newTestServer(t, Config{MetricsPort: port})
+	rec := serve(s, httptest.NewRequest(http.MethodGet, metricsPath, nil))
+	require.NotEqual(t, http.StatusOK, rec.Code)
+
+	shutdownC := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		s.serveMetrics(shutdownC)
+		close(done)
+	}()
+	defer func() {
+		close(shutdownC)
+		<-done
+	}()
+
+	var resp *http.Response
+	require.Eventually(t, func() bool {
+		var err error
+		resp, err = http.Get(fmt.Sprintf("http://127.0.0.1:%d%s", port, metricsPath))
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "simpleserver_stored_files 0\n")
+}
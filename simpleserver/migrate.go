@@ -0,0 +1,264 @@
+package simpleserver
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// The layout of the archives of Export. Every file is a metaPrefix entry
+// holding its FileMeta as JSON, followed by a contentPrefix entry holding the
+// uploaded bytes. The content is stored decoded, so the importing server
+// applies its own at-rest compression and encryption.
+const (
+	exportManifest = "simpleserver-export.json"
+	exportVersion  = 1
+	metaPrefix     = "meta/"
+	contentPrefix  = "files/"
+)
+
+var errInvalidExport = errors.New("not an export of this server")
+
+type exportManifestEntry struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Files     int       `json:"files"`
+}
+
+// Export writes every stored upload, with its metadata including expiry,
+// download counts, short link and delete token, to w as a zstd compressed
+// tar archive that Import restores on another host or storage backend.
+// Expired uploads and those still being processed are left out. It returns
+// how many uploads were exported.
+func (s *Server) Export(ctx context.Context, w io.Writer) (int, error) {
+	now := time.Now()
+	var files []FileMeta
+	for _, meta := range s.index.all() {
+		if !meta.expired(now) && !meta.Pending {
+			files = append(files, meta)
+		}
+	}
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return 0, err
+	}
+	tw := tar.NewWriter(zw)
+	manifest, err := json.Marshal(exportManifestEntry{Version: exportVersion, CreatedAt: now.UTC(), Files: len(files)})
+	if err != nil {
+		return 0, err
+	}
+	if err := writeTarEntry(tw, exportManifest, now, manifest); err != nil {
+		return 0, err
+	}
+	for i, meta := range files {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+		if err := s.exportFile(ctx, tw, meta); err != nil {
+			return i, fmt.Errorf("failed to export %s: %w", meta.key(), err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return len(files), err
+	}
+	return len(files), zw.Close()
+}
+
+func (s *Server) exportFile(ctx context.Context, tw *tar.Writer, meta FileMeta) error {
+	obj, err := s.storage.Get(ctx, meta.key())
+	if err != nil {
+		return err
+	}
+	defer obj.Content.Close()
+	r, err := s.decodedReader(obj.Content, meta)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	// How the file is stored is up to the importing server.
+	exported := meta
+	exported.Encoding, exported.Encryption, exported.KeyID, exported.StoredSize, exported.Blob = "", "", "", 0, ""
+	encoded, err := json.Marshal(exported)
+	if err != nil {
+		return err
+	}
+	if err := writeTarEntry(tw, metaPrefix+meta.key()+".json", meta.CreatedAt, encoded); err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    contentPrefix + meta.key(),
+		Mode:    0644,
+		Size:    meta.Size,
+		ModTime: meta.CreatedAt,
+	}); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(tw, r, meta.Size); err != nil {
+		return err
+	}
+	return nil
+}
+
+func writeTarEntry(tw *tar.Writer, name string, modTime time.Time, content []byte) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), ModTime: modTime}); err != nil {
+		return err
+	}
+	_, err := tw.Write(content)
+	return err
+}
+
+// Import restores the uploads of an archive written by Export, under their
+// original links. Uploads already stored with the same content are skipped,
+// so an interrupted import can be run again; other conflicts fail it. It
+// returns how many uploads were imported.
+func (s *Server) Import(ctx context.Context, r io.Reader) (int, error) {
+	br := bufio.NewReader(r)
+	// Plain tar archives are taken as well, such as decompressed exports.
+	if magic, _ := br.Peek(4); bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}) {
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return 0, err
+		}
+		defer zr.Close()
+		r = zr
+	} else {
+		r = br
+	}
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != exportManifest {
+		return 0, errInvalidExport
+	}
+	var manifest exportManifestEntry
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil || manifest.Version != exportVersion {
+		return 0, fmt.Errorf("%w: unsupported version", errInvalidExport)
+	}
+	imported := 0
+	var pending *FileMeta
+	for {
+		if err := ctx.Err(); err != nil {
+			return imported, err
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return imported, err
+		}
+		switch {
+		case strings.HasPrefix(hdr.Name, metaPrefix):
+			var meta FileMeta
+			if err := json.NewDecoder(tr).Decode(&meta); err != nil {
+				return imported, fmt.Errorf("%w: %s: %v", errInvalidExport, hdr.Name, err)
+			}
+			if err := checkImportedMeta(meta, hdr.Name); err != nil {
+				return imported, err
+			}
+			pending = &meta
+		case strings.HasPrefix(hdr.Name, contentPrefix):
+			if pending == nil || hdr.Name != contentPrefix+pending.key() {
+				return imported, fmt.Errorf("%w: %s has no metadata", errInvalidExport, hdr.Name)
+			}
+			restored, err := s.importFile(ctx, *pending, tr)
+			if err != nil {
+				return imported, fmt.Errorf("failed to import %s: %w", pending.key(), err)
+			}
+			if restored {
+				imported++
+			}
+			pending = nil
+		default:
+			return imported, fmt.Errorf("%w: unexpected %s", errInvalidExport, hdr.Name)
+		}
+	}
+	return imported, nil
+}
+
+// checkImportedMeta makes sure meta names a file inside the upload dir, as
+// the archive may not come from a trusted server.
+func checkImportedMeta(meta FileMeta, entry string) error {
+	name, err := cleanRelativePath(meta.Name)
+	if err != nil || name != meta.Name || !isShareDir(meta.Dir) || entry != metaPrefix+meta.key()+".json" {
+		return fmt.Errorf("%w: %s names an unsafe path", errInvalidExport, entry)
+	}
+	return nil
+}
+
+// importFile stores the content of meta from r the way this server stores
+// uploads and records meta. It reports false for files already stored.
+func (s *Server) importFile(ctx context.Context, meta FileMeta, r io.Reader) (bool, error) {
+	if existing, ok := s.index.get(meta.Dir, meta.Name); ok {
+		if existing.SHA256 == meta.SHA256 {
+			return false, nil
+		}
+		return false, errors.New("a different file is stored under its name")
+	}
+	meta.Encoding, meta.Encryption, meta.KeyID, meta.StoredSize, meta.Blob = "", "", "", 0, ""
+	if s.config.CompressAtRest && s.compressible(meta.ContentType) {
+		meta.Encoding = encodingGzip
+	}
+	spoolDir := filepath.Join(s.getUploadDir(), spoolDirName)
+	if err := os.MkdirAll(spoolDir, 0755); err != nil {
+		return false, err
+	}
+	tmp := filepath.Join(spoolDir, base58(12)+partSuffix)
+	defer os.Remove(tmp)
+	file, err := os.Create(tmp)
+	if err != nil {
+		return false, err
+	}
+	var w io.Writer = file
+	var encrypter io.WriteCloser
+	if s.cipher != nil {
+		if encrypter, err = s.cipher.encrypter(file); err != nil {
+			file.Close()
+			return false, err
+		}
+		w = encrypter
+		meta.Encryption, meta.KeyID = encryptionAESGCM, s.cipher.keyID
+	}
+	hash := sha256.New()
+	size, err := copyEncoded(w, io.TeeReader(r, hash), meta.Encoding)
+	if err == nil && encrypter != nil {
+		err = encrypter.Close()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return false, err
+	}
+	if size != meta.Size || (meta.SHA256 != "" && hex.EncodeToString(hash.Sum(nil)) != meta.SHA256) {
+		return false, errChecksumMismatch
+	}
+	if !meta.storedVerbatim() {
+		if info, err := os.Stat(tmp); err == nil {
+			meta.StoredSize = info.Size()
+		}
+	}
+	if err := s.putObject(ctx, meta.key(), tmp); err != nil {
+		return false, err
+	}
+	if s.dedupeEnabled() {
+		meta.Blob = base58(12)
+	}
+	if err := s.index.put(meta); err != nil {
+		s.storage.Delete(ctx, meta.key())
+		return false, err
+	}
+	return true, nil
+}
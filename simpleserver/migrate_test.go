@@ -0,0 +1,72 @@
+package simpleserver
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImportKeepsLinks(t *testing.T) {
+	src := newTestServer(t, Config{TTL: time.Hour, ShortLinks: true})
+	rec := serve(src, httptest.NewRequest(http.MethodPut, "/report.txt", strings.NewReader(strings.Repeat("quarterly ", 100))))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	link := downloadURLs(t, rec.Body.String())[0]
+	deleteToken := rec.Header().Get(deleteTokenHeader)
+	require.Equal(t, http.StatusOK, download(t, src, link).Code)
+	original := findMeta(t, src, "report.txt")
+
+	var archive bytes.Buffer
+	n, err := src.Export(context.Background(), &archive)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	// The new host compresses and encrypts at rest, the old one did not.
+	dst := newTestServer(t, Config{EncryptKey: testEncryptKey, CompressAtRest: true, ShortLinks: true})
+	n, err = dst.Import(context.Background(), bytes.NewReader(archive.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	restored := findMeta(t, dst, "report.txt")
+	require.Equal(t, original.Dir, restored.Dir)
+	require.Equal(t, original.Alias, restored.Alias)
+	require.True(t, original.ExpiresAt.Equal(restored.ExpiresAt))
+	require.Equal(t, int64(1), restored.Downloads)
+	require.Equal(t, encryptionAESGCM, restored.Encryption)
+
+	rec = download(t, dst, link)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, strings.Repeat("quarterly ", 100), rec.Body.String())
+	require.Equal(t, http.StatusOK, serve(dst, httptest.NewRequest(http.MethodGet, "/s/"+original.Alias, nil)).Code)
+	require.NotEqual(t, original.Alias, dst.index.nextAlias("new/file.txt"), "new short links do not reuse imported ones")
+
+	// Importing again skips what is already there.
+	n, err = dst.Import(context.Background(), bytes.NewReader(archive.Bytes()))
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	req := httptest.NewRequest(http.MethodDelete, "/"+restored.key(), nil)
+	req.Header.Set(deleteTokenHeader, deleteToken)
+	require.Equal(t, http.StatusNoContent, serve(dst, req).Code, "delete tokens keep working")
+}
+
+func TestImportRejectsUnsafePaths(t *testing.T) {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	now := time.Now()
+	require.NoError(t, writeTarEntry(tw, exportManifest, now, []byte(`{"version":1}`)))
+	require.NoError(t, writeTarEntry(tw, metaPrefix+"abc/../../etc/passwd.json", now, []byte(`{"dir":"abc","name":"../../etc/passwd"}`)))
+	require.NoError(t, tw.Close())
+
+	s := newTestServer(t, Config{})
+	_, err := s.Import(context.Background(), &archive)
+	require.ErrorIs(t, err, errInvalidExport)
+
+	_, err = s.Import(context.Background(), strings.NewReader("not an archive"))
+	require.ErrorIs(t, err, errInvalidExport)
+}
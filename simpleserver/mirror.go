@@ -0,0 +1,306 @@
+package simpleserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	mirrorQueueSize = 4096
+	mirrorTimeout   = 10 * time.Minute
+	// mirrorBackoff is the wait before the first retry of a failed copy,
+	// doubled after every failed attempt up to mirrorMaxBackoff.
+	mirrorBackoff    = time.Second
+	mirrorMaxBackoff = 5 * time.Minute
+)
+
+// newMirrorStorage builds the backend MirrorTo names: "memory",
+// "s3://bucket[/prefix]" or "file:///path".
+func newMirrorStorage(config Config) (Storage, error) {
+	if err := config.checkMirrorTo(); err != nil {
+		return nil, err
+	}
+	if dir, ok := strings.CutPrefix(config.MirrorTo, "file://"); ok {
+		return localStorage{root: filepath.Clean(dir)}, nil
+	}
+	return newStorage(Config{Storage: config.MirrorTo, S3Endpoint: config.S3Endpoint, S3Region: config.S3Region}, "")
+}
+
+// checkMirrorTo rejects a MirrorTo that is no storage URL, or that is the
+// primary storage itself.
+func (c Config) checkMirrorTo() error {
+	if dir, ok := strings.CutPrefix(c.MirrorTo, "file://"); ok {
+		if !filepath.IsAbs(dir) {
+			return fmt.Errorf("%q needs an absolute path, as in file:///var/backup", c.MirrorTo)
+		}
+		if (c.Storage == "" || c.Storage == "local") && filepath.Clean(dir) == filepath.Clean(c.uploadDir()) {
+			return fmt.Errorf("%q is the upload dir itself", c.MirrorTo)
+		}
+		return nil
+	}
+	switch {
+	case c.MirrorTo == "memory":
+	case strings.HasPrefix(c.MirrorTo, "s3://"):
+		if c.MirrorTo == c.Storage {
+			return fmt.Errorf("%q is the primary storage itself", c.MirrorTo)
+		}
+	default:
+		return fmt.Errorf("unknown storage %q, expected memory, s3://bucket[/prefix] or file:///path", c.MirrorTo)
+	}
+	return nil
+}
+
+// mirrorJob copies key to the mirror, or deletes it there.
+type mirrorJob struct {
+	Key         string    `json:"key"`
+	Delete      bool      `json:"delete,omitempty"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+	NextAttempt time.Time `json:"next_attempt"`
+}
+
+// replicationStatus answers GET /admin/replication.
+type replicationStatus struct {
+	Target string `json:"target"`
+	// Pending counts the objects waiting to be copied or deleted, including
+	// Failing ones.
+	Pending          int         `json:"pending"`
+	Replicated       int64       `json:"replicated"`
+	Deleted          int64       `json:"deleted"`
+	Failures         int64       `json:"failures"`
+	Dropped          int64       `json:"dropped"`
+	LastReplicatedAt *time.Time  `json:"last_replicated_at"`
+	Failing          []mirrorJob `json:"failing"`
+}
+
+// replicator copies committed uploads from the primary storage to a second
+// backend in the background and deletes them there when they go. Changes
+// wait in a bounded queue that keeps the latest change per key, and copies
+// that fail are retried with exponential backoff until they succeed or are
+// superseded. The queue lives in memory; objects missed while the server was
+// down are copied by catchUp at the next start.
+type replicator struct {
+	target  string
+	primary Storage
+	mirror  Storage
+	backoff time.Duration
+
+	mu       sync.Mutex
+	pending  map[string]*mirrorJob
+	wake     chan struct{}
+	status   replicationStatus
+	inFlight string
+}
+
+func newReplicator(target string, primary, mirror Storage) *replicator {
+	return &replicator{
+		target:  redactURL(target),
+		primary: primary,
+		mirror:  mirror,
+		backoff: mirrorBackoff,
+		pending: make(map[string]*mirrorJob),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// copy schedules key to be copied to the mirror without blocking.
+func (r *replicator) copy(key string) {
+	r.enqueue(key, false)
+}
+
+// remove schedules key to be deleted from the mirror without blocking.
+func (r *replicator) remove(key string) {
+	r.enqueue(key, true)
+}
+
+func (r *replicator) enqueue(key string, remove bool) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	if job, ok := r.pending[key]; ok {
+		*job = mirrorJob{Key: key, Delete: remove}
+	} else if len(r.pending) >= mirrorQueueSize {
+		r.status.Dropped++
+		r.mu.Unlock()
+		log.Printf("Dropping replication of %s, the replication queue is full\n", key)
+		return
+	} else {
+		r.pending[key] = &mirrorJob{Key: key, Delete: remove}
+	}
+	r.mu.Unlock()
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *replicator) loop() {
+	for {
+		job, wait := r.next(time.Now())
+		if job == nil {
+			timer := time.NewTimer(wait)
+			select {
+			case <-r.wake:
+			case <-timer.C:
+			}
+			timer.Stop()
+			continue
+		}
+		r.done(job, r.replicate(job))
+	}
+}
+
+// next takes the job that is due first off the queue, or tells how long to
+// wait for one.
+func (r *replicator) next(now time.Time) (*mirrorJob, time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var first *mirrorJob
+	for _, job := range r.pending {
+		if first == nil || job.NextAttempt.Before(first.NextAttempt) {
+			first = job
+		}
+	}
+	if first == nil {
+		return nil, mirrorMaxBackoff
+	}
+	if wait := first.NextAttempt.Sub(now); wait > 0 {
+		return nil, wait
+	}
+	delete(r.pending, first.Key)
+	r.inFlight = first.Key
+	return first, 0
+}
+
+func (r *replicator) replicate(job *mirrorJob) error {
+	ctx, cancel := context.WithTimeout(context.Background(), mirrorTimeout)
+	defer cancel()
+	if job.Delete {
+		return r.mirror.Delete(ctx, job.Key)
+	}
+	obj, err := r.primary.Get(ctx, job.Key)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Deleted since, which queued its removal from the mirror.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer obj.Content.Close()
+	return r.mirror.Put(ctx, job.Key, obj.Content)
+}
+
+// done records the outcome of job and queues it again when it failed,
+// unless a newer change of its key was queued meanwhile.
+func (r *replicator) done(job *mirrorJob, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inFlight = ""
+	now := time.Now().UTC()
+	if err == nil {
+		if job.Delete {
+			r.status.Deleted++
+		} else {
+			r.status.Replicated++
+		}
+		r.status.LastReplicatedAt = &now
+		return
+	}
+	r.status.Failures++
+	log.Printf("Failed to replicate %s to %s: %v\n", job.Key, r.target, err)
+	if _, newer := r.pending[job.Key]; newer {
+		return
+	}
+	wait := r.backoff << min(job.Attempts, 16)
+	if wait > mirrorMaxBackoff {
+		wait = mirrorMaxBackoff
+	}
+	job.Attempts++
+	job.LastError = err.Error()
+	job.NextAttempt = now.Add(wait)
+	r.pending[job.Key] = job
+}
+
+// catchUp queues the objects of the primary storage that are missing from
+// the mirror or differ in size there, such as uploads stored while the
+// mirror was not configured or changes lost to a restart.
+func (r *replicator) catchUp(ctx context.Context) error {
+	primary, err := r.primary.List(ctx, "")
+	if err != nil {
+		return err
+	}
+	mirrored, err := r.mirror.List(ctx, "")
+	if err != nil {
+		return err
+	}
+	sizes := make(map[string]int64, len(mirrored))
+	for _, obj := range mirrored {
+		sizes[obj.Key] = obj.Size
+	}
+	for _, obj := range primary {
+		if size, ok := sizes[obj.Key]; !ok || size != obj.Size {
+			r.copy(obj.Key)
+		}
+	}
+	return nil
+}
+
+func (r *replicator) snapshot() replicationStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := r.status
+	status.Target = r.target
+	status.Pending = len(r.pending)
+	if r.inFlight != "" {
+		status.Pending++
+	}
+	status.Failing = []mirrorJob{}
+	for _, job := range r.pending {
+		if job.Attempts > 0 {
+			status.Failing = append(status.Failing, *job)
+		}
+	}
+	sort.Slice(status.Failing, func(i, j int) bool { return status.Failing[i].Key < status.Failing[j].Key })
+	return status
+}
+
+// startReplication begins mirroring to MirrorTo, first catching up on what
+// the mirror misses.
+func (s *Server) startReplication() error {
+	if s.config.MirrorTo == "" {
+		return nil
+	}
+	mirror, err := newMirrorStorage(s.config)
+	if err != nil {
+		return fmt.Errorf("--mirror-to: %w", err)
+	}
+	s.replicator = newReplicator(s.config.MirrorTo, s.storage, mirror)
+	go s.replicator.loop()
+	go func() {
+		if err := s.replicator.catchUp(context.Background()); err != nil {
+			log.Printf("Failed to compare the storage with its mirror %s: %v\n", s.replicator.target, err)
+		}
+	}()
+	return nil
+}
+
+// handleReplication answers GET /admin/replication with the progress of
+// mirroring to MirrorTo.
+func (s *Server) handleReplication(c echo.Context) error {
+	if s.replicator == nil {
+		return fail(c, http.StatusNotFound, "Replication is not enabled, set --mirror-to")
+	}
+	return c.JSON(http.StatusOK, s.replicator.snapshot())
+}
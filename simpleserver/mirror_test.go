@@ -0,0 +1,139 @@
+package simpleserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// flakyStorage fails the first failures puts.
+type flakyStorage struct {
+	*memoryStorage
+	failures atomic.Int32
+}
+
+func (f *flakyStorage) Put(ctx context.Context, key string, r io.Reader) error {
+	if f.failures.Add(-1) >= 0 {
+		return errors.New("mirror unavailable")
+	}
+	return f.memoryStorage.Put(ctx, key, r)
+}
+
+func mirrored(t *testing.T, mirror Storage, key string) string {
+	t.Helper()
+	obj, err := mirror.Get(context.Background(), key)
+	if err != nil {
+		return ""
+	}
+	defer obj.Content.Close()
+	content, err := io.ReadAll(obj.Content)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestMirrorReplicatesUploadsAndDeletes(t *testing.T) {
+	s := newTestServer(t, Config{MirrorTo: "memory", AdminToken: testAdminToken})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("durable")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	meta := findMeta(t, s, "notes.txt")
+	mirror := s.replicator.mirror
+	require.Eventually(t, func() bool { return mirrored(t, mirror, meta.key()) == "durable" }, 5*time.Second, 10*time.Millisecond)
+
+	req := httptest.NewRequest(http.MethodDelete, "/"+meta.key(), nil)
+	req.Header.Set(deleteTokenHeader, rec.Header().Get(deleteTokenHeader))
+	require.Equal(t, http.StatusNoContent, serve(s, req).Code)
+	require.Eventually(t, func() bool {
+		_, err := mirror.Get(context.Background(), meta.key())
+		return errors.Is(err, fs.ErrNotExist)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	rec = serve(s, adminRequest(http.MethodGet, "/admin/replication", ""))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var status replicationStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	require.Equal(t, "memory", status.Target)
+	require.EqualValues(t, 1, status.Replicated)
+	require.EqualValues(t, 1, status.Deleted)
+	require.Zero(t, status.Pending)
+	require.NotNil(t, status.LastReplicatedAt)
+}
+
+func TestReplicationDisabled(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken})
+	require.Equal(t, http.StatusNotFound, serve(s, adminRequest(http.MethodGet, "/admin/replication", "")).Code)
+}
+
+func TestReplicatorRetries(t *testing.T) {
+	primary := newMemoryStorage()
+	require.NoError(t, primary.Put(context.Background(), "abc/notes.txt", strings.NewReader("retried")))
+	mirror := &flakyStorage{memoryStorage: newMemoryStorage()}
+	mirror.failures.Store(2)
+	r := newReplicator("memory", primary, mirror)
+	r.backoff = 10 * time.Millisecond
+
+	r.copy("abc/notes.txt")
+	job, _ := r.next(time.Now())
+	r.done(job, r.replicate(job))
+	status := r.snapshot()
+	require.Equal(t, 1, status.Pending)
+	require.Len(t, status.Failing, 1)
+	require.Equal(t, "mirror unavailable", status.Failing[0].LastError)
+	job, wait := r.next(time.Now())
+	require.Nil(t, job, "failed copies wait for their backoff")
+	require.Positive(t, wait)
+
+	go r.loop()
+	require.Eventually(t, func() bool { return mirrored(t, mirror, "abc/notes.txt") == "retried" }, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool { return r.snapshot().Replicated == 1 }, 5*time.Second, 10*time.Millisecond)
+	status = r.snapshot()
+	require.EqualValues(t, 2, status.Failures)
+	require.Empty(t, status.Failing)
+}
+
+func TestReplicatorKeepsLatestChange(t *testing.T) {
+	r := newReplicator("memory", newMemoryStorage(), newMemoryStorage())
+	r.copy("abc/notes.txt")
+	r.remove("abc/notes.txt")
+	job, _ := r.next(time.Now())
+	require.True(t, job.Delete)
+	job, _ = r.next(time.Now())
+	require.Nil(t, job)
+}
+
+func TestReplicatorCatchUp(t *testing.T) {
+	ctx := context.Background()
+	primary, mirror := newMemoryStorage(), newMemoryStorage()
+	require.NoError(t, primary.Put(ctx, "abc/same.txt", strings.NewReader("same")))
+	require.NoError(t, primary.Put(ctx, "abc/changed.txt", strings.NewReader("longer")))
+	require.NoError(t, primary.Put(ctx, "abc/missing.txt", strings.NewReader("missing")))
+	require.NoError(t, mirror.Put(ctx, "abc/same.txt", strings.NewReader("same")))
+	require.NoError(t, mirror.Put(ctx, "abc/changed.txt", strings.NewReader("short")))
+
+	r := newReplicator("memory", primary, mirror)
+	require.NoError(t, r.catchUp(ctx))
+	var keys []string
+	for job, _ := r.next(time.Now()); job != nil; job, _ = r.next(time.Now()) {
+		keys = append(keys, job.Key)
+	}
+	require.ElementsMatch(t, []string{"abc/changed.txt", "abc/missing.txt"}, keys)
+}
+
+func TestValidateMirrorTo(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, Config{UploadDir: dir, MirrorTo: "file:///var/backup"}.Validate())
+	require.NoError(t, Config{UploadDir: dir, MirrorTo: "s3://backup"}.Validate())
+	require.ErrorContains(t, Config{UploadDir: dir, MirrorTo: "file://backup"}.Validate(), "absolute path")
+	require.ErrorContains(t, Config{UploadDir: dir, MirrorTo: "file://" + dir}.Validate(), "upload dir itself")
+	require.ErrorContains(t, Config{UploadDir: dir, Storage: "s3://files", MirrorTo: "s3://files"}.Validate(), "primary storage")
+	require.ErrorContains(t, Config{UploadDir: dir, MirrorTo: "ftp://backup"}.Validate(), "--mirror-to")
+}
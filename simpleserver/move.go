@@ -0,0 +1,115 @@
+package simpleserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path"
+
+	"github.com/labstack/echo/v4"
+)
+
+var errTargetExists = errors.New("target already exists")
+
+// moveRequest is the body of POST /:dir/:filename/move. An empty Dir moves
+// the file into a new share directory; an empty Bucket keeps the current one.
+type moveRequest struct {
+	Dir    string `json:"dir"`
+	Bucket string `json:"bucket"`
+}
+
+type moveResponse struct {
+	URL    string `json:"url"`
+	Dir    string `json:"dir"`
+	Name   string `json:"name"`
+	Bucket string `json:"bucket,omitempty"`
+}
+
+// fileAction handles POST /:dir/:filename/<action> for the file at dir/name.
+type fileAction func(c echo.Context, dir, name string) error
+
+func (s *Server) fileActions() map[string]fileAction {
+	return map[string]fileAction{
+		"move":  s.handleMove,
+		"sign":  s.handleSign,
+		"delta": s.handleDelta,
+	}
+}
+
+// handleFileAction dispatches POST requests on a stored file to the action
+// named by the last path segment.
+func (s *Server) handleFileAction(c echo.Context) error {
+	dir, target, err := downloadTarget(c.Request())
+	if err != nil || path.Dir(target) == "." {
+		return fail(c, http.StatusNotFound, "Not found")
+	}
+	action, ok := s.fileActions()[path.Base(target)]
+	if !ok {
+		return fail(c, http.StatusNotFound, "Not found")
+	}
+	return action(c, dir, path.Dir(target))
+}
+
+func (s *Server) handleMove(c echo.Context, dir, name string) error {
+	if !validBearer(c.Request(), s.settings().AdminToken) {
+		return adminUnauthorized(c)
+	}
+	meta, ok := s.index.get(dir, name)
+	if !ok {
+		return fail(c, http.StatusNotFound, "File not found")
+	}
+	var req moveRequest
+	if err := c.Bind(&req); err != nil {
+		return fail(c, http.StatusBadRequest, "Invalid move request")
+	}
+	if req.Dir == "" {
+		req.Dir = s.newShareDir()
+	}
+	if !isShareDir(req.Dir) {
+		return fail(c, http.StatusBadRequest, "Invalid target directory")
+	}
+	if req.Bucket != "" {
+		if _, ok := s.settings().Buckets[req.Bucket]; !ok {
+			return fail(c, http.StatusBadRequest, "Unknown bucket")
+		}
+	}
+
+	ctx := c.Request().Context()
+	moved := meta
+	moved.Dir = req.Dir
+	if req.Bucket != "" {
+		moved.Bucket = req.Bucket
+	}
+	if err := s.relocateFile(ctx, meta, moved); errors.Is(err, errTargetExists) {
+		return fail(c, http.StatusConflict, "Target already exists")
+	} else if err != nil {
+		return fail(c, http.StatusInternalServerError, "Failed to move file")
+	}
+	return c.JSON(http.StatusOK, moveResponse{
+		URL:    s.downloadURL(c, moved.Dir, moved.Name),
+		Dir:    moved.Dir,
+		Name:   moved.Name,
+		Bucket: moved.Bucket,
+	})
+}
+
+// relocateFile moves the upload meta, object and metadata, to where moved
+// says. It never replaces an existing object.
+func (s *Server) relocateFile(ctx context.Context, meta, moved FileMeta) error {
+	if exists, err := s.objectExists(ctx, moved.key()); err != nil {
+		return err
+	} else if exists {
+		return errTargetExists
+	}
+	if err := s.renameObject(ctx, meta.key(), moved.key()); err != nil {
+		return err
+	}
+	if err := s.index.put(moved); err != nil {
+		s.renameObject(ctx, moved.key(), meta.key())
+		return err
+	}
+	s.index.delete(meta.Dir, meta.Name)
+	s.replicator.copy(moved.key())
+	s.replicator.remove(meta.key())
+	return nil
+}
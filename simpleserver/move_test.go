@@ -0,0 +1,86 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func moveRequestTo(target, body string) *http.Request {
+	req := adminRequest(http.MethodPost, target, body)
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestMoveFile(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken, Buckets: map[string]BucketConfig{"archive": {}}})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/report.txt", strings.NewReader("quarterly")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	oldURL := downloadURLs(t, rec.Body.String())[0]
+	oldDir := shareDirs(t, s)[0]
+
+	rec = serve(s, moveRequestTo("/"+oldDir+"/report.txt/move", `{"dir": "reports", "bucket": "archive"}`))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var moved moveResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &moved))
+	require.Equal(t, "reports", moved.Dir)
+	require.Equal(t, "archive", moved.Bucket)
+	require.True(t, strings.HasSuffix(moved.URL, "/reports/report.txt"))
+
+	rec = download(t, s, moved.URL)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "quarterly", rec.Body.String())
+	require.Equal(t, http.StatusNotFound, download(t, s, oldURL).Code)
+
+	_, ok := s.index.get(oldDir, "report.txt")
+	require.False(t, ok)
+	meta, ok := s.index.get("reports", "report.txt")
+	require.True(t, ok)
+	require.Equal(t, "archive", meta.Bucket)
+	require.Equal(t, []string{"reports"}, shareDirs(t, s))
+}
+
+func TestMoveFileIntoNewDir(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("a")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	dir := shareDirs(t, s)[0]
+
+	rec = serve(s, moveRequestTo("/"+dir+"/a.txt/move", `{}`))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var moved moveResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &moved))
+	require.NotEqual(t, dir, moved.Dir)
+	require.Equal(t, "a", download(t, s, moved.URL).Body.String())
+}
+
+func TestMoveFileValidation(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("a")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	dir := shareDirs(t, s)[0]
+	target := "/" + dir + "/a.txt/move"
+
+	unauthenticated := httptest.NewRequest(http.MethodPost, target, strings.NewReader(`{"dir": "x"}`))
+	require.Equal(t, http.StatusUnauthorized, serve(s, unauthenticated).Code)
+
+	for _, body := range []string{`{"dir": "../outside"}`, `{"dir": ".meta"}`, `{"dir": "a/b"}`, `{"bucket": "missing"}`} {
+		require.Equal(t, http.StatusBadRequest, serve(s, moveRequestTo(target, body)).Code, body)
+	}
+	require.Equal(t, http.StatusNotFound, serve(s, moveRequestTo("/"+dir+"/missing.txt/move", `{}`)).Code)
+	require.Equal(t, http.StatusNotFound, serve(s, moveRequestTo("/"+dir+"/a.txt/unknown", `{}`)).Code)
+
+	rec = serve(s, httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("other a")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var otherDir string
+	for _, d := range shareDirs(t, s) {
+		if d != dir {
+			otherDir = d
+		}
+	}
+	require.Equal(t, http.StatusConflict, serve(s, moveRequestTo(target, `{"dir": "`+otherDir+`"}`)).Code)
+}
@@ -0,0 +1,163 @@
+package simpleserver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	multipartAbortPolicy = "abort"
+	multipartSkip        = "skip"
+)
+
+var errMalformedPart = errors.New("malformed multipart part")
+
+func isMultipart(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get(echo.HeaderContentType))
+	return err == nil && mediaType == echo.MIMEMultipartForm
+}
+
+// partFilename returns the filename parameter of a part exactly as the client
+// sent it. multipart.Part.FileName strips any directory, which would make
+// PreservePaths impossible. Parts without a filename are plain form fields.
+func partFilename(part *multipart.Part) (string, error) {
+	_, params, err := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+	if err != nil {
+		return "", errMalformedPart
+	}
+	return params["filename"], nil
+}
+
+// storedName decides where a part is written inside its upload directory.
+func (s *Server) storedName(clientName string) (string, error) {
+	if !s.config.PreservePaths || !strings.ContainsAny(clientName, "/\\") {
+		return s.uploadFilename(clientName)
+	}
+	return cleanRelativePath(clientName)
+}
+
+// partFailure describes a part that could not be stored.
+type partFailure struct {
+	Filename string
+	Err      error
+}
+
+func (f partFailure) String() string {
+	return fmt.Sprintf("%q: %s", f.Filename, uploadErrorMessage(f.Err))
+}
+
+// handleFormUpload accepts the multipart/form-data bodies sent by curl -F
+// and HTML forms on POST /.
+func (s *Server) handleFormUpload(c echo.Context) error {
+	if !isMultipart(c.Request()) {
+		return fail(c, http.StatusUnsupportedMediaType, "POST / expects a multipart/form-data body")
+	}
+	return s.handleMultipartUpload(c)
+}
+
+func (s *Server) handleMultipartUpload(c echo.Context) error {
+	reader, err := c.Request().MultipartReader()
+	if err != nil {
+		return fail(c, http.StatusBadRequest, "Invalid multipart body")
+	}
+
+	var dir = s.uploadDirFor(c)
+	var stored []FileMeta
+	var failures []partFailure
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// The stream itself is broken, no further part can be read.
+			failures = append(failures, partFailure{Err: errMalformedPart})
+			break
+		}
+		meta, failure, ok := s.storePart(c, dir, part)
+		if failure != nil {
+			failures = append(failures, *failure)
+			if s.config.MultipartOnError != multipartSkip {
+				break
+			}
+		} else if ok {
+			stored = append(stored, meta)
+		}
+	}
+
+	if len(failures) > 0 && s.config.MultipartOnError != multipartSkip {
+		for _, meta := range stored {
+			s.deleteFile(meta)
+		}
+		return s.multipartAbort(c, failures[0])
+	}
+	if len(stored) == 0 {
+		if len(failures) > 0 {
+			return s.batchUploaded(c, http.StatusBadRequest, nil, failures)
+		}
+		return fail(c, http.StatusBadRequest, "No files in multipart body")
+	}
+	return s.batchUploaded(c, http.StatusCreated, stored, failures)
+}
+
+// storePart stores a single file part. ok is false for plain form fields.
+func (s *Server) storePart(c echo.Context, dir string, part *multipart.Part) (meta FileMeta, failure *partFailure, ok bool) {
+	defer part.Close()
+	clientName, err := partFilename(part)
+	if err != nil {
+		return FileMeta{}, &partFailure{Err: err}, false
+	}
+	if clientName == "" {
+		if part.FormName() == metaField {
+			if err := readFormMeta(c, part); err != nil {
+				return FileMeta{}, &partFailure{Filename: metaField, Err: err}, false
+			}
+		}
+		return FileMeta{}, nil, false
+	}
+	name, err := s.storedName(clientName)
+	if err != nil {
+		return FileMeta{}, &partFailure{Filename: clientName, Err: err}, false
+	}
+	meta, err = s.saveUpload(c, dir, name, part)
+	if err != nil {
+		return FileMeta{}, &partFailure{Filename: clientName, Err: err}, false
+	}
+	return meta, nil, true
+}
+
+// multipartAbort answers a batch rejected under the abort policy. Server side
+// failures keep their 5xx status so clients know to retry.
+func (s *Server) multipartAbort(c echo.Context, failure partFailure) error {
+	if status := uploadErrorStatus(failure.Err); status >= 500 {
+		return s.uploadError(c, failure.Err)
+	}
+	return failWith(c, http.StatusBadRequest, uploadErrorCode(failure.Err), "Upload aborted, no file was stored. Failed part "+failure.String())
+}
+
+func (s *Server) multipartReport(c echo.Context, stored []FileMeta, failures []partFailure) string {
+	var b strings.Builder
+	if len(stored) > 0 {
+		b.WriteString("Files uploaded successfully. Download at:\n")
+		for _, meta := range stored {
+			b.WriteString(s.downloadURL(c, meta.Dir, meta.Name))
+			b.WriteString("\n")
+			b.WriteString(s.uploadDetails(c, meta))
+		}
+	}
+	if len(failures) > 0 {
+		b.WriteString("Failed to upload:\n")
+		for _, failure := range failures {
+			b.WriteString(failure.String())
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,202 @@
+package simpleserver
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testPart struct {
+	filename string
+	content  string
+}
+
+func multipartRequest(t *testing.T, method, target string, parts ...testPart) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, p := range parts {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, p.filename))
+		header.Set("Content-Type", "application/octet-stream")
+		pw, err := w.CreatePart(header)
+		require.NoError(t, err)
+		_, err = pw.Write([]byte(p.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	req := httptest.NewRequest(method, target, &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req
+}
+
+func TestMultipartUploadFlattensPathsByDefault(t *testing.T) {
+	s := newTestServer(t, Config{})
+
+	rec := serve(s, multipartRequest(t, http.MethodPut, "/", testPart{"docs/readme.md", "# readme"}))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	urls := downloadURLs(t, rec.Body.String())
+	require.Len(t, urls, 1)
+	require.True(t, strings.HasSuffix(urls[0], "/readme.md"))
+	require.NotContains(t, urls[0], "/docs/")
+}
+
+func TestMultipartUploadPreservesPaths(t *testing.T) {
+	s := newTestServer(t, Config{PreservePaths: true})
+
+	rec := serve(s, multipartRequest(t, http.MethodPut, "/",
+		testPart{"docs/readme.md", "# readme"},
+		testPart{"docs/img/logo.svg", "<svg/>"},
+		testPart{"top.txt", "top"},
+	))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	urls := downloadURLs(t, rec.Body.String())
+	require.Len(t, urls, 3)
+	require.True(t, strings.HasSuffix(urls[0], "/docs/readme.md"))
+	require.True(t, strings.HasSuffix(urls[1], "/docs/img/logo.svg"))
+	require.True(t, strings.HasSuffix(urls[2], "/top.txt"))
+
+	dirs := shareDirs(t, s)
+	require.Len(t, dirs, 1)
+	content, err := os.ReadFile(filepath.Join(s.config.UploadDir, dirs[0], "docs", "img", "logo.svg"))
+	require.NoError(t, err)
+	require.Equal(t, "<svg/>", string(content))
+
+	for i, want := range []string{"# readme", "<svg/>", "top"} {
+		rec = download(t, s, urls[i])
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, want, rec.Body.String())
+	}
+}
+
+func TestMultipartUploadRejectsTraversal(t *testing.T) {
+	for _, name := range []string{
+		"../escape.txt",
+		"docs/../../escape.txt",
+		"/etc/passwd",
+		"docs//readme.md",
+		`docs\..\escape.txt`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(t, Config{PreservePaths: true})
+
+			rec := serve(s, multipartRequest(t, http.MethodPut, "/", testPart{name, "payload"}))
+			require.Equal(t, http.StatusBadRequest, rec.Code)
+
+			_, err := os.Stat(filepath.Join(filepath.Dir(s.config.UploadDir), "escape.txt"))
+			require.True(t, os.IsNotExist(err))
+		})
+	}
+}
+
+func TestCleanRelativePath(t *testing.T) {
+	valid := map[string]string{
+		"readme.md":        "readme.md",
+		"docs/readme.md":   "docs/readme.md",
+		"a/b/c/report.pdf": "a/b/c/report.pdf",
+	}
+	for in, want := range valid {
+		got, err := cleanRelativePath(in)
+		require.NoError(t, err, in)
+		require.Equal(t, want, got)
+	}
+	for _, in := range []string{"", "..", "a/../b", "./a", "/a", "a/", "a\x00b", " a/b", "docs/CON.txt", "a/\xffb", strings.Repeat("a", 256)} {
+		_, err := cleanRelativePath(in)
+		require.ErrorIs(t, err, errUnsafePath, in)
+	}
+}
+
+func TestMultipartOnErrorAbort(t *testing.T) {
+	s := newTestServer(t, Config{PreservePaths: true})
+
+	rec := serve(s, multipartRequest(t, http.MethodPut, "/",
+		testPart{"first.txt", "first"},
+		testPart{"../escape.txt", "evil"},
+		testPart{"last.txt", "last"},
+	))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "../escape.txt")
+	require.Empty(t, shareDirs(t, s))
+	require.Zero(t, s.index.len())
+}
+
+func TestMultipartOnErrorSkip(t *testing.T) {
+	s := newTestServer(t, Config{PreservePaths: true, MultipartOnError: multipartSkip})
+
+	rec := serve(s, multipartRequest(t, http.MethodPut, "/",
+		testPart{"first.txt", "first"},
+		testPart{"../escape.txt", "evil"},
+		testPart{"last.txt", "last"},
+	))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	body := rec.Body.String()
+	urls := downloadURLs(t, body)
+	require.Len(t, urls, 2)
+	require.Contains(t, body, "Failed to upload:\n\"../escape.txt\"")
+	require.Equal(t, "first", download(t, s, urls[0]).Body.String())
+	require.Equal(t, "last", download(t, s, urls[1]).Body.String())
+	require.Equal(t, 2, s.index.len())
+}
+
+func TestMultipartOnErrorSkipAllFailed(t *testing.T) {
+	s := newTestServer(t, Config{PreservePaths: true, MultipartOnError: multipartSkip})
+
+	rec := serve(s, multipartRequest(t, http.MethodPut, "/", testPart{"../escape.txt", "evil"}))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "Failed to upload:")
+}
+
+func TestMultipartMalformedPart(t *testing.T) {
+	body := "--b\r\n" +
+		"Content-Disposition: form-data; name=\"file\"; filename=\"ok.txt\"\r\n\r\n" +
+		"fine\r\n" +
+		"--b\r\n" +
+		"Content-Disposition: form-data; name=\"file\"; filename=\"unterminated\r\n\r\n" +
+		"broken\r\n" +
+		"--b--\r\n"
+	for _, policy := range []string{multipartAbortPolicy, multipartSkip} {
+		t.Run(policy, func(t *testing.T) {
+			s := newTestServer(t, Config{MultipartOnError: policy})
+			req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+			req.Header.Set("Content-Type", "multipart/form-data; boundary=b")
+			rec := serve(s, req)
+			if policy == multipartSkip {
+				require.Equal(t, http.StatusCreated, rec.Code)
+				require.Len(t, downloadURLs(t, rec.Body.String()), 1)
+				require.Contains(t, rec.Body.String(), errMalformedPart.Error())
+			} else {
+				require.Equal(t, http.StatusBadRequest, rec.Code)
+				require.Zero(t, s.index.len())
+			}
+		})
+	}
+}
+
+func TestFormUploadOnPost(t *testing.T) {
+	s := newTestServer(t, Config{})
+
+	rec := serve(s, multipartRequest(t, http.MethodPost, "/", testPart{"a.txt", "first"}, testPart{"b.txt", "second"}))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	urls := downloadURLs(t, rec.Body.String())
+	require.Len(t, urls, 2)
+	require.Equal(t, path.Dir(urls[0]), path.Dir(urls[1]))
+	require.Equal(t, "first", download(t, s, urls[0]).Body.String())
+	require.Equal(t, "second", download(t, s, urls[1]).Body.String())
+}
+
+func TestFormUploadRequiresMultipart(t *testing.T) {
+	s := newTestServer(t, Config{})
+
+	rec := serve(s, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("raw")))
+	require.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+}
@@ -0,0 +1,105 @@
+package simpleserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultEventsSubject = "simpleserver.events"
+
+// natsPublisher publishes events with the NATS text protocol to
+// <subject>.<event type>. The connection is opened lazily and reopened after
+// a failure.
+type natsPublisher struct {
+	addr    string
+	subject string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newNATSPublisher(rawURL, subject string) *natsPublisher {
+	addr := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		addr = u.Host
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "4222")
+	}
+	if subject == "" {
+		subject = defaultEventsSubject
+	}
+	return &natsPublisher{addr: addr, subject: subject}
+}
+
+func (p *natsPublisher) Publish(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		if p.conn, err = p.dial(ctx); err != nil {
+			return err
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		p.conn.SetWriteDeadline(deadline)
+	}
+	msg := fmt.Sprintf("PUB %s.%s %d\r\n%s\r\n", p.subject, event.Type, len(payload), payload)
+	if _, err := p.conn.Write([]byte(msg)); err != nil {
+		p.conn.Close()
+		p.conn = nil
+		return err
+	}
+	p.conn.SetWriteDeadline(time.Time{})
+	return nil
+}
+
+// dial connects and completes the handshake: the server greets with INFO and
+// the client answers with CONNECT.
+func (p *natsPublisher) dial(ctx context.Context) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", p.addr)
+	if err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	info, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(info, "INFO ") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected NATS greeting from %s", p.addr)
+	}
+	if _, err := conn.Write([]byte("CONNECT {\"verbose\":false,\"pedantic\":false,\"name\":\"simpleserver\"}\r\n")); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go p.keepAlive(conn, reader)
+	return conn, nil
+}
+
+// keepAlive answers server PINGs so the connection is not dropped as stale.
+func (p *natsPublisher) keepAlive(conn net.Conn, reader *bufio.Reader) {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if strings.TrimSpace(line) == "PING" {
+			p.mu.Lock()
+			_, err = conn.Write([]byte("PONG\r\n"))
+			p.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package simpleserver
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// notifyHeader names up to maxNotifyRecipients addresses, separated by
+	// commas, that are emailed the download link of an upload.
+	notifyHeader        = "X-Notify"
+	maxNotifyRecipients = 5
+
+	defaultSMTPPort = 587
+	mailQueueSize   = 256
+	mailAttempts    = 5
+	// mailBackoff is the wait before the first retry, doubled after every
+	// failed attempt.
+	mailBackoff = 5 * time.Second
+)
+
+var (
+	errInvalidNotify  = errors.New(notifyHeader + " must list up to 5 email addresses")
+	errNotifyDisabled = errors.New(notifyHeader + " needs --smtp-host")
+)
+
+// defaultNotifyTemplate is the email sent to the recipients of an upload
+// unless Config.TemplatesDir holds a notifyTemplate.
+var defaultNotifyTemplate = texttemplate.Must(texttemplate.New(notifyTemplate).Parse(`{{range .Files}}{{.Name}} was shared with you.
+
+Download: {{.URL}}
+SHA-256: {{.SHA256}}
+{{if .ExpiresAt}}The link expires on {{.ExpiresAt.Format "2006-01-02 15:04 MST"}}.{{else}}The link does not expire.{{end}}
+
+{{end}}`))
+
+// notification is what notifyTemplate is rendered with: the address it is
+// sent .To and the uploaded .Files, with the fields of their JSON answer.
+type notification struct {
+	To    string
+	Files []uploadResponse
+}
+
+// requestNotify returns the addresses an upload asks to notify.
+func (s *Server) requestNotify(c echo.Context) ([]string, error) {
+	value := strings.TrimSpace(c.Request().Header.Get(notifyHeader))
+	if value == "" {
+		return nil, nil
+	}
+	if s.mailer == nil {
+		return nil, errNotifyDisabled
+	}
+	list, err := mail.ParseAddressList(value)
+	if err != nil || len(list) > maxNotifyRecipients {
+		return nil, errInvalidNotify
+	}
+	to := make([]string, len(list))
+	for i, address := range list {
+		to[i] = address.Address
+	}
+	return to, nil
+}
+
+// notifyRecipients emails the links of files to the addresses of the
+// notifyHeader of c. The emails are rendered right away and sent in the
+// background.
+func (s *Server) notifyRecipients(c echo.Context, files []FileMeta) {
+	to, err := s.requestNotify(c)
+	if err != nil || len(to) == 0 || len(files) == 0 {
+		return
+	}
+	data := notification{Files: make([]uploadResponse, len(files))}
+	for i, meta := range files {
+		data.Files[i] = s.uploadResponse(c, meta)
+	}
+	tmpl := defaultNotifyTemplate
+	if s.templates != nil && s.templates.notify != nil {
+		tmpl = s.templates.notify
+	}
+	subject := files[0].Name + " was shared with you"
+	if len(files) > 1 {
+		subject = strconv.Itoa(len(files)) + " files were shared with you"
+	}
+	for _, recipient := range to {
+		data.To = recipient
+		var body strings.Builder
+		if err := tmpl.Execute(&body, data); err != nil {
+			log.Printf("Failed to render %s: %v\n", notifyTemplate, err)
+			return
+		}
+		s.mailer.enqueue(recipient, subject, body.String())
+	}
+}
+
+// outgoingMail is an email waiting in the mailer queue.
+type outgoingMail struct {
+	to  string
+	msg []byte
+}
+
+// mailer sends emails through Config.SMTPHost. Like webhookSender, emails
+// wait in a bounded queue and are sent one at a time by a single worker,
+// retried with exponential backoff, and dropped once the queue is full.
+type mailer struct {
+	addr    string
+	from    string
+	auth    smtp.Auth
+	send    func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+	backoff time.Duration
+
+	once  sync.Once
+	queue chan outgoingMail
+}
+
+func newMailer(config Config) *mailer {
+	if config.SMTPHost == "" {
+		return nil
+	}
+	port := config.SMTPPort
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	m := &mailer{
+		addr:    net.JoinHostPort(config.SMTPHost, strconv.Itoa(port)),
+		from:    config.SMTPFrom,
+		send:    smtp.SendMail,
+		backoff: mailBackoff,
+	}
+	if config.SMTPUsername != "" {
+		m.auth = smtp.PlainAuth("", config.SMTPUsername, config.SMTPPassword, config.SMTPHost)
+	}
+	return m
+}
+
+// enqueue schedules an email for delivery without blocking.
+func (m *mailer) enqueue(to, subject, body string) {
+	m.once.Do(func() {
+		m.queue = make(chan outgoingMail, mailQueueSize)
+		go m.loop()
+	})
+	select {
+	case m.queue <- outgoingMail{to: to, msg: m.message(to, subject, body)}:
+	default:
+		log.Printf("Dropping email to %s, the mail queue is full\n", to)
+	}
+}
+
+// message renders the email to to, with body converted to CRLF line endings.
+func (m *mailer) message(to, subject, body string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+func (m *mailer) loop() {
+	for mail := range m.queue {
+		m.deliver(mail)
+	}
+}
+
+// deliver sends mail until the server accepts it or mailAttempts are used
+// up.
+func (m *mailer) deliver(mail outgoingMail) {
+	wait := m.backoff
+	for attempt := 1; ; attempt++ {
+		err := m.send(m.addr, m.auth, m.from, []string{mail.to}, mail.msg)
+		if err == nil {
+			return
+		}
+		if attempt == mailAttempts {
+			log.Printf("Failed to email %s through %s after %d attempts: %v\n", mail.to, m.addr, attempt, err)
+			return
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
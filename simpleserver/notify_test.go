@@ -0,0 +1,97 @@
+package simpleserver
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// sentMail is an email handed to a fake SMTP server.
+type sentMail struct {
+	addr string
+	from string
+	to   []string
+	msg  string
+}
+
+func fakeSMTP(t *testing.T, s *Server, failures int32) <-chan sentMail {
+	t.Helper()
+	require.NotNil(t, s.mailer)
+	sent := make(chan sentMail, 10)
+	var attempts atomic.Int32
+	s.mailer.backoff = time.Millisecond
+	s.mailer.send = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		if attempts.Add(1) <= failures {
+			return errors.New("421 try again later")
+		}
+		sent <- sentMail{addr: addr, from: from, to: to, msg: string(msg)}
+		return nil
+	}
+	return sent
+}
+
+func TestNotifyEmailsTheDownloadLink(t *testing.T) {
+	s := newTestServer(t, Config{SMTPHost: "smtp.example.com", SMTPFrom: "files@example.com", TTL: time.Hour})
+	sent := fakeSMTP(t, s, 2)
+
+	req := httptest.NewRequest(http.MethodPut, "/report.pdf", strings.NewReader("quarterly"))
+	req.Header.Set(notifyHeader, "Bob <bob@example.com>")
+	rec := serve(s, req)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	link := downloadURLs(t, rec.Body.String())[0]
+
+	select {
+	case mail := <-sent:
+		require.Equal(t, "smtp.example.com:587", mail.addr)
+		require.Equal(t, "files@example.com", mail.from)
+		require.Equal(t, []string{"bob@example.com"}, mail.to)
+		require.Contains(t, mail.msg, "Subject: report.pdf was shared with you\r\n")
+		require.Contains(t, mail.msg, "Download: "+link+"\r\n")
+		require.Contains(t, mail.msg, "SHA-256: "+sha256Hex("quarterly")+"\r\n")
+		require.Contains(t, mail.msg, "The link expires on ")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email was sent")
+	}
+}
+
+func TestNotifyTemplate(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{notifyTemplate: "Hi {{.To}}, grab {{range .Files}}{{.Name}} {{end}}"})
+	s := newTestServer(t, Config{SMTPHost: "smtp.example.com", SMTPFrom: "files@example.com", TemplatesDir: dir})
+	sent := fakeSMTP(t, s, 0)
+
+	req := httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("hi"))
+	req.Header.Set(notifyHeader, "carol@example.com")
+	require.Equal(t, http.StatusCreated, serve(s, req).Code)
+	select {
+	case mail := <-sent:
+		require.True(t, strings.HasSuffix(mail.msg, "\r\n\r\nHi carol@example.com, grab notes.txt "), mail.msg)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email was sent")
+	}
+}
+
+func TestInvalidNotify(t *testing.T) {
+	s := newTestServer(t, Config{})
+	req := httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("hi"))
+	req.Header.Set(notifyHeader, "bob@example.com")
+	rec := serve(s, req)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), errNotifyDisabled.Error())
+
+	s = newTestServer(t, Config{SMTPHost: "smtp.example.com", SMTPFrom: "files@example.com"})
+	for _, value := range []string{"not an address", "a@x.com, b@x.com, c@x.com, d@x.com, e@x.com, f@x.com"} {
+		req := httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("hi"))
+		req.Header.Set(notifyHeader, value)
+		require.Equal(t, http.StatusBadRequest, serve(s, req).Code, value)
+	}
+	require.Zero(t, s.index.len())
+
+	require.ErrorContains(t, Config{UploadDir: t.TempDir(), SMTPHost: "smtp.example.com"}.Validate(), "--smtp-from")
+}
@@ -0,0 +1,118 @@
+package simpleserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// errChecksumChanged reports a stored file whose content no longer hashes to
+// the checksum recorded when it was uploaded.
+var errChecksumChanged = errors.New("content does not match the recorded SHA-256")
+
+// Open loads the store of the server without serving it, for the maintenance
+// commands. They work on the state a stopped server left behind; a running
+// server would not see their changes and could undo them.
+func (s *Server) Open() error {
+	if err := s.prepare(); err != nil {
+		return err
+	}
+	return s.openStore()
+}
+
+// ParseAge reads a positive duration such as 24h or a number of days such
+// as 7d.
+func ParseAge(value string) (time.Duration, error) {
+	return parseRetentionTTL(value)
+}
+
+// Purge deletes every upload created more than olderThan ago, bypassing the
+// trash, along with the share dirs it leaves empty. With dryRun it only
+// returns what it would delete.
+func (s *Server) Purge(olderThan time.Duration, dryRun bool) ([]FileInfo, error) {
+	cutoff := time.Now().Add(-olderThan)
+	var purged []FileInfo
+	for _, meta := range s.index.all() {
+		if !meta.CreatedAt.Before(cutoff) {
+			continue
+		}
+		if !dryRun {
+			if err := s.removeFile(meta); err != nil {
+				return purged, fmt.Errorf("failed to delete %s: %w", meta.key(), err)
+			}
+		}
+		purged = append(purged, hookFileInfo(meta))
+	}
+	if !dryRun {
+		for _, dir := range s.emptyShareDirs() {
+			if err := os.Remove(filepath.Join(s.getUploadDir(), dir)); err != nil {
+				log.Printf("Failed to remove empty dir %s: %v\n", dir, err)
+			}
+		}
+	}
+	return purged, nil
+}
+
+// VerifyFailure is a stored upload that failed verification.
+type VerifyFailure struct {
+	File FileInfo
+	Err  error
+}
+
+// Verify reads every stored upload back and checks it against the SHA-256
+// recorded in its metadata, calling progress with each file checked. Uploads
+// stored without a checksum are skipped.
+func (s *Server) Verify(ctx context.Context, progress func(FileInfo)) ([]VerifyFailure, error) {
+	var failures []VerifyFailure
+	for _, meta := range s.index.all() {
+		if err := ctx.Err(); err != nil {
+			return failures, err
+		}
+		if meta.SHA256 == "" || meta.Pending {
+			continue
+		}
+		if err := s.verifyFile(ctx, meta, nil); err != nil {
+			failures = append(failures, VerifyFailure{File: hookFileInfo(meta), Err: err})
+		}
+		if progress != nil {
+			progress(hookFileInfo(meta))
+		}
+	}
+	return failures, nil
+}
+
+// verifyFile hashes the stored content of meta, reading it no faster than
+// limiter allows unless it is nil.
+func (s *Server) verifyFile(ctx context.Context, meta FileMeta, limiter *rate.Limiter) error {
+	obj, err := s.storage.Get(ctx, meta.key())
+	if err != nil {
+		return err
+	}
+	defer obj.Content.Close()
+	content := obj.Content
+	if limiter != nil {
+		content = &throttledReader{ReadCloser: obj.Content, ctx: ctx, limiter: limiter}
+	}
+	r, err := s.decodedReader(content, meta)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != meta.SHA256 {
+		return errChecksumChanged
+	}
+	return nil
+}
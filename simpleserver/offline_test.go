@@ -0,0 +1,69 @@
+package simpleserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenLoadsTheStoreOfAStoppedServer(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestServer(t, Config{UploadDir: dir})
+	for _, name := range []string{"old.txt", "new.txt"} {
+		require.Equal(t, http.StatusCreated, serve(s, httptest.NewRequest(http.MethodPut, "/"+name, strings.NewReader(name))).Code)
+	}
+	old := findMeta(t, s, "old.txt")
+	old.CreatedAt = time.Now().Add(-8 * 24 * time.Hour)
+	require.NoError(t, s.index.put(old))
+
+	offline := New(Config{UploadDir: dir})
+	require.NoError(t, offline.Open())
+	require.Equal(t, 2, offline.Stats().Files)
+
+	age, err := ParseAge("7d")
+	require.NoError(t, err)
+	purged, err := offline.Purge(age, true)
+	require.NoError(t, err)
+	require.Len(t, purged, 1)
+	require.Equal(t, 2, offline.index.len(), "a dry run deletes nothing")
+
+	purged, err = offline.Purge(age, false)
+	require.NoError(t, err)
+	require.Equal(t, "old.txt", purged[0].Name)
+	require.Equal(t, 1, offline.index.len())
+	_, err = os.Stat(filepath.Join(dir, old.Dir))
+	require.ErrorIs(t, err, os.ErrNotExist, "the emptied share dir is removed")
+}
+
+func TestVerifyFindsChangedAndMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestServer(t, Config{UploadDir: dir})
+	for _, name := range []string{"intact.txt", "changed.txt", "missing.txt"} {
+		require.Equal(t, http.StatusCreated, serve(s, httptest.NewRequest(http.MethodPut, "/"+name, strings.NewReader(name))).Code)
+	}
+	changed := findMeta(t, s, "changed.txt")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, changed.Dir, changed.Name), []byte("bit rot"), 0644))
+	missing := findMeta(t, s, "missing.txt")
+	require.NoError(t, os.Remove(filepath.Join(dir, missing.Dir, missing.Name)))
+
+	offline := New(Config{UploadDir: dir})
+	require.NoError(t, offline.Open())
+	checked := 0
+	failures, err := offline.Verify(context.Background(), func(FileInfo) { checked++ })
+	require.NoError(t, err)
+	require.Equal(t, 3, checked)
+	require.Len(t, failures, 2)
+	byName := make(map[string]error)
+	for _, failure := range failures {
+		byName[failure.File.Name] = failure.Err
+	}
+	require.ErrorIs(t, byName["changed.txt"], errChecksumChanged)
+	require.ErrorIs(t, byName["missing.txt"], os.ErrNotExist)
+}
@@ -0,0 +1,31 @@
+package simpleserver
+
+import (
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// onceHeader, or the once query parameter, marks an upload as download
+// once: its link stops working after the first complete download.
+const onceHeader = "X-Once"
+
+func requestOnce(c echo.Context) bool {
+	value := c.Request().Header.Get(onceHeader)
+	if value == "" {
+		value = c.QueryParam("once")
+	}
+	once, _ := strconv.ParseBool(value)
+	return once
+}
+
+// claimOnce reserves a download once file for a single download, so two
+// concurrent requests can never both receive it.
+func (s *Server) claimOnce(key string) bool {
+	_, taken := s.onceClaims.LoadOrStore(key, struct{}{})
+	return !taken
+}
+
+func (s *Server) releaseOnce(key string) {
+	s.onceClaims.Delete(key)
+}
@@ -0,0 +1,63 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func onceUpload(t *testing.T, s *Server, req *http.Request) string {
+	t.Helper()
+	rec := serve(s, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	urls := downloadURLs(t, rec.Body.String())
+	require.Len(t, urls, 1)
+	return urls[0]
+}
+
+func TestDownloadOnce(t *testing.T) {
+	s := newTestServer(t, Config{})
+	u := onceUpload(t, s, httptest.NewRequest(http.MethodPut, "/secret.txt?once=true", strings.NewReader("burn me")))
+
+	rec := serve(s, rangeRequest(u, "bytes=0-3"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "burn me", rec.Body.String())
+
+	rec = download(t, s, u)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.Zero(t, s.index.len())
+}
+
+func TestDownloadOnceHeader(t *testing.T) {
+	s := newTestServer(t, Config{})
+	req := httptest.NewRequest(http.MethodPut, "/secret.txt", strings.NewReader("burn me"))
+	req.Header.Set(onceHeader, "true")
+	u := onceUpload(t, s, req)
+
+	require.Equal(t, "burn me", download(t, s, u).Body.String())
+	require.Equal(t, http.StatusNotFound, download(t, s, u).Code)
+}
+
+func TestDownloadOnceConcurrent(t *testing.T) {
+	s := newTestServer(t, Config{})
+	u := onceUpload(t, s, httptest.NewRequest(http.MethodPut, "/secret.txt?once=1", strings.NewReader("burn me")))
+	key := findMeta(t, s, "secret.txt").key()
+
+	require.True(t, s.claimOnce(key))
+	rec := download(t, s, u)
+	require.Equal(t, http.StatusGone, rec.Code)
+	require.Equal(t, errorResponse{Code: codeAlreadyDownloaded, Message: "File is already being downloaded"}, errorOf(t, rec.Body.String()))
+	s.releaseOnce(key)
+	require.Equal(t, "burn me", download(t, s, u).Body.String())
+}
+
+func TestDownloadWithoutOnceIsKept(t *testing.T) {
+	s := newTestServer(t, Config{})
+	u := onceUpload(t, s, httptest.NewRequest(http.MethodPut, "/kept.txt?once=false", strings.NewReader("stay")))
+
+	require.Equal(t, "stay", download(t, s, u).Body.String())
+	require.Equal(t, "stay", download(t, s, u).Body.String())
+}
@@ -0,0 +1,411 @@
+package simpleserver
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+)
+
+// The OpenAPI 3 document served at /openapi.json is generated from
+// apiOperations, which annotate the routes of newRouter, and from the types
+// of the JSON bodies they exchange. A test fails when a route is added
+// without being described here or listed in undocumentedRoutes.
+const (
+	openAPIPath    = "/openapi.json"
+	apiDocsPath    = "/docs"
+	openAPIVersion = "3.0.3"
+	// apiDocsCSP lets the Swagger UI page load its assets from unpkg.com.
+	apiDocsCSP = "default-src 'self'; script-src 'unsafe-inline' https://unpkg.com; style-src 'unsafe-inline' https://unpkg.com; img-src 'self' data: https://unpkg.com; frame-ancestors 'none'"
+)
+
+// Security requirements of operations, each mapping to a scheme of
+// openAPISecuritySchemes.
+const (
+	apiPublic   = ""
+	apiUpload   = "upload"
+	apiDownload = "download"
+	apiAdmin    = "admin"
+)
+
+// apiParam is a header, query or path parameter of an operation.
+type apiParam struct {
+	Name, In, Description string
+}
+
+// apiOperation describes a route. Request and Response are values of the
+// types of JSON bodies, nil for plain text or no body.
+type apiOperation struct {
+	Method string
+	Path   string
+	// Route is the echo route serving Path, when they differ.
+	Route    string
+	Tag      string
+	Summary  string
+	Security string
+	Params   []apiParam
+	// RequestType is the media type of a body that is not JSON.
+	RequestType string
+	Request     any
+	Status      int
+	// ResponseType is the media type of a body that is not JSON or text.
+	ResponseType string
+	Response     any
+}
+
+var uploadParams = []apiParam{
+	{bucketHeader, "header", "Bucket to upload into, with its own limits"},
+	{uploadTokenHeader, "header", "Upload token charged with the upload"},
+	{contentSHA256Header, "header", "Hex SHA-256 the upload must match"},
+	{customPathHeader, "header", "Share dir to upload into instead of a random one"},
+	{maxDownloadsHeader, "header", "Delete the file after this many downloads"},
+	{onceHeader, "header", "Delete the file after its first download"},
+	{passwordHeader, "header", "Password downloads must present"},
+	{visibilityHeader, "header", "public, unlisted or restricted"},
+	{allowedEmailsHeader, "header", "Identities allowed to download a restricted file"},
+	{notifyHeader, "header", "Email addresses sent the download link"},
+	{metaHeaderPrefix + "Description", "header", "Description of the file"},
+	{metaHeaderPrefix + "{key}", "header", "Tag the file with key and the header value"},
+}
+
+var downloadParams = []apiParam{
+	{"password", "query", "Password of a protected file, or the " + passwordHeader + " header"},
+	{"expires", "query", "Expiry of a signed URL"},
+	{"sig", "query", "Signature of a signed URL"},
+	{"inline", "query", "Show the file in the browser rather than downloading it"},
+	{downloadParam, "query", "Serve browsers the file rather than its share page"},
+}
+
+// apiOperations lists the documented routes, in the order of the document.
+var apiOperations = []apiOperation{
+	{Method: http.MethodPut, Path: "/:name", Route: "*", Tag: "upload", Summary: "Upload a file into a new share", Security: apiUpload,
+		Params: uploadParams, RequestType: "application/octet-stream", Status: http.StatusCreated, Response: uploadResponse{}},
+	{Method: http.MethodPut, Path: "/:dir/*", Tag: "upload", Summary: "Upload a file into a share, multipart/form-data or a tar archive to extract", Security: apiUpload,
+		Params: uploadParams, RequestType: "application/octet-stream", Status: http.StatusCreated, Response: uploadResponse{}},
+	{Method: http.MethodPatch, Path: "/:dir/*", Tag: "upload", Summary: "Append to a stored file", Security: apiUpload,
+		RequestType: "application/octet-stream", Status: http.StatusOK},
+	{Method: http.MethodGet, Path: "/", Tag: "upload", Summary: "Show the upload page", ResponseType: echo.MIMETextHTML, Status: http.StatusOK},
+	{Method: http.MethodPost, Path: "/", Tag: "upload", Summary: "Upload the files of a multipart/form-data form", Security: apiUpload,
+		Params: uploadParams, RequestType: "multipart/form-data", Status: http.StatusCreated, Response: batchResponse{}},
+	{Method: http.MethodPost, Path: pastePath, Tag: "upload", Summary: "Store text as a paste", Security: apiUpload,
+		Params:      []apiParam{{"syntax", "query", "Language to highlight"}, {"ttl", "query", "Delete the paste after this long"}},
+		RequestType: "text/plain", Status: http.StatusCreated, Response: uploadResponse{}},
+	{Method: http.MethodPost, Path: batchPath, Tag: "upload", Summary: "Commit a batch of files described by a manifest", Security: apiUpload,
+		Params: []apiParam{{batchIDHeader, "header", "Batch the files were uploaded with"}}, Request: batchManifest{}, Status: http.StatusCreated, Response: batchResponse{}},
+	{Method: http.MethodPost, Path: fetchPath, Tag: "upload", Summary: "Download a public URL into a new share", Security: apiUpload,
+		Request: fetchRequest{}, Status: http.StatusCreated, Response: uploadResponse{}},
+	{Method: http.MethodPost, Path: tusPath, Tag: "resumable", Summary: "Create a tus resumable upload", Security: apiUpload,
+		Params: []apiParam{{tusResumableHeader, "header", "tus version, " + tusVersion}, {uploadLengthHeader, "header", "Size of the upload"}, {uploadMetaHeader, "header", "tus metadata, such as the filename"}},
+		Status: http.StatusCreated},
+	{Method: http.MethodOptions, Path: tusPath, Tag: "resumable", Summary: "Discover the tus protocol support", Status: http.StatusNoContent},
+	{Method: http.MethodHead, Path: tusPath + "/:id", Tag: "resumable", Summary: "Get the offset to resume a tus upload from", Security: apiUpload, Status: http.StatusOK},
+	{Method: http.MethodPatch, Path: tusPath + "/:id", Tag: "resumable", Summary: "Send content of a tus upload", Security: apiUpload,
+		Params: []apiParam{{uploadOffsetHeader, "header", "Offset the content starts at"}}, RequestType: tusOffsetMediaType, Status: http.StatusNoContent},
+	{Method: http.MethodPost, Path: chunkedPath, Tag: "chunked", Summary: "Start a chunked upload", Security: apiUpload,
+		Request: struct {
+			Filename string `json:"filename"`
+		}{}, Status: http.StatusCreated, Response: chunkedUpload{}},
+	{Method: http.MethodGet, Path: chunkedPath + "/:id", Tag: "chunked", Summary: "List the parts of a chunked upload", Security: apiUpload, Status: http.StatusOK, Response: chunkedUpload{}},
+	{Method: http.MethodPut, Path: chunkedPath + "/:id/parts/:n", Tag: "chunked", Summary: "Store a part of a chunked upload", Security: apiUpload,
+		Params: []apiParam{{contentSHA256Header, "header", "Hex SHA-256 the part must match"}}, RequestType: "application/octet-stream", Status: http.StatusOK, Response: chunkPart{}},
+	{Method: http.MethodPost, Path: chunkedPath + "/:id/complete", Tag: "chunked", Summary: "Join the parts of a chunked upload into a file", Security: apiUpload,
+		Params: uploadParams, Request: struct {
+			Parts []chunkPart `json:"parts,omitempty"`
+		}{}, Status: http.StatusCreated, Response: uploadResponse{}},
+	{Method: http.MethodDelete, Path: chunkedPath + "/:id", Tag: "chunked", Summary: "Abort a chunked upload", Security: apiUpload, Status: http.StatusNoContent},
+	{Method: http.MethodPut, Path: clipPath + "/:name", Tag: "clipboard", Summary: "Set a clipboard entry", Security: apiUpload,
+		Params: []apiParam{{"ttl", "query", "Forget the entry after this long"}}, RequestType: "application/octet-stream", Status: http.StatusNoContent},
+	{Method: http.MethodGet, Path: clipPath + "/:name", Tag: "clipboard", Summary: "Get a clipboard entry", Security: apiDownload, ResponseType: "application/octet-stream", Status: http.StatusOK},
+	{Method: http.MethodPut, Path: pipePath + "/:id", Tag: "pipe", Summary: "Stream a body to the receiver of a pipe", Security: apiUpload, RequestType: "application/octet-stream", Status: http.StatusOK},
+	{Method: http.MethodGet, Path: pipePath + "/:id", Tag: "pipe", Summary: "Receive the body streamed into a pipe", Security: apiDownload, ResponseType: "application/octet-stream", Status: http.StatusOK},
+
+	{Method: http.MethodGet, Path: "/:dir/*", Tag: "download", Summary: "Download a file", Security: apiDownload,
+		Params: downloadParams, ResponseType: "application/octet-stream", Status: http.StatusOK},
+	{Method: http.MethodHead, Path: "/:dir/*", Tag: "download", Summary: "Get the headers of a download", Security: apiDownload, Params: downloadParams, Status: http.StatusOK},
+	{Method: http.MethodGet, Path: "/:name", Route: "/:dir", Tag: "download", Summary: "List the files of a share, or download them as a zip", Security: apiDownload,
+		Params: []apiParam{{"format", "query", "zip to download every file at once"}, {"expires", "query", "Expiry of a signed link"}, {"sig", "query", "Signature of a signed link"}},
+		Status: http.StatusOK, Response: listingResponse{}},
+	{Method: http.MethodGet, Path: searchPath, Tag: "download", Summary: "Search the files by filename, tags and description", Security: apiDownload,
+		Params: []apiParam{{"q", "query", "Terms every file must hold, term* matching as a prefix"}, {"limit", "query", "Files per page"}, {"offset", "query", "Files to skip"}},
+		Status: http.StatusOK, Response: searchResponse{}},
+	{Method: http.MethodGet, Path: "/s/:alias", Tag: "download", Summary: "Follow a short link", Security: apiDownload, ResponseType: "application/octet-stream", Status: http.StatusOK},
+	{Method: http.MethodDelete, Path: "/:dir/*", Tag: "download", Summary: "Delete a file with its delete token",
+		Params: []apiParam{{deleteTokenHeader, "header", "Token handed out with the upload"}, {"delete_token", "query", "Delete token, or the " + deleteTokenHeader + " header"}}, Status: http.StatusNoContent},
+	{Method: http.MethodPost, Path: "/:dir/:path/move", Route: "/:dir/*", Tag: "admin", Summary: "Move a file to another share or bucket", Security: apiAdmin,
+		Request: moveRequest{}, Status: http.StatusOK, Response: moveResponse{}},
+	{Method: http.MethodPost, Path: "/:dir/:path/sign", Route: "/:dir/*", Tag: "admin", Summary: "Create a signed download URL", Security: apiAdmin,
+		Params: []apiParam{{"ttl", "query", "How long the URL is valid"}}, Status: http.StatusOK, Response: signResponse{}},
+	{Method: http.MethodGet, Path: "/:dir/:path/" + signaturePathSuffix, Route: "/:dir/*", Tag: "upload", Summary: "Get the block signature of a file to compute a delta against", Security: apiUpload,
+		Params: []apiParam{{"block_size", "query", "Bytes per block, about the square root of the size by default"}}, Status: http.StatusOK, Response: fileSignature{}},
+	{Method: http.MethodPost, Path: "/:dir/:path/delta", Route: "/:dir/*", Tag: "upload", Summary: "Update a file with a delta of copied blocks and literal bytes", Security: apiUpload,
+		Params:      []apiParam{{"If-Match", "header", "ETag of the version the delta was computed against"}, {contentSHA256Header, "header", "Hex SHA-256 the updated file must match"}},
+		RequestType: "application/octet-stream", Status: http.StatusCreated, Response: uploadResponse{}},
+
+	{Method: http.MethodPost, Path: dropSharesPath, Tag: "shares", Summary: "Create a drop share others can upload into", Security: apiAdmin,
+		Request: createDropShareRequest{}, Status: http.StatusCreated, Response: dropShareResponse{}},
+	{Method: http.MethodGet, Path: dropSharesPath + "/:id", Tag: "shares", Summary: "List the files of a drop share", Security: apiAdmin, Status: http.StatusOK, Response: dropShareListing{}},
+	{Method: http.MethodGet, Path: dropSharesPath + "/:id/*", Tag: "shares", Summary: "Download a file of a drop share", Security: apiAdmin, ResponseType: "application/octet-stream", Status: http.StatusOK},
+	{Method: http.MethodPut, Path: dropSharesPath + "/:id/*", Tag: "shares", Summary: "Upload into a drop share with its token",
+		Params: []apiParam{{uploadTokenHeader, "header", "Token of the drop share"}}, RequestType: "application/octet-stream", Status: http.StatusCreated, Response: uploadResponse{}},
+
+	{Method: http.MethodGet, Path: "/admin/files", Tag: "admin", Summary: "List every upload", Security: apiAdmin,
+		Params: []apiParam{{"dir", "query", "Only list this share"}, {"unlisted", "query", "Include unlisted and restricted uploads"},
+			{"tag", "query", "Only list uploads tagged key=value, or with key, repeatable"}}, Status: http.StatusOK, Response: adminFilesResponse{}},
+	{Method: http.MethodDelete, Path: "/admin/files/:dir/*", Tag: "admin", Summary: "Delete an upload", Security: apiAdmin, Status: http.StatusNoContent},
+	{Method: http.MethodGet, Path: "/admin/trash", Tag: "admin", Summary: "List the uploads in the trash", Security: apiAdmin, Status: http.StatusOK, Response: trashResponse{}},
+	{Method: http.MethodPost, Path: "/admin/files/:id/restore", Tag: "admin", Summary: "Restore an upload from the trash", Security: apiAdmin, Status: http.StatusOK, Response: uploadResponse{}},
+	{Method: http.MethodGet, Path: "/admin/usage", Tag: "admin", Summary: "Show the space taken by uploads", Security: apiAdmin, Status: http.StatusOK, Response: usageResponse{}},
+	{Method: http.MethodGet, Path: "/admin/tokens/:token/usage", Tag: "admin", Summary: "Show what an upload token was charged with", Security: apiAdmin, Status: http.StatusOK, Response: tokenUsageResponse{}},
+	{Method: http.MethodGet, Path: "/admin/stats", Tag: "admin", Summary: "Show upload and download statistics", Security: apiAdmin,
+		Params: []apiParam{{"top", "query", "Number of most downloaded files to show"}}, Status: http.StatusOK, Response: Stats{}},
+	{Method: http.MethodGet, Path: "/admin/stats/export", Tag: "admin", Summary: "Export daily statistics as JSON or CSV", Security: apiAdmin,
+		Params: []apiParam{{"format", "query", "json or csv"}}, Status: http.StatusOK, Response: statsExport{}},
+	{Method: http.MethodGet, Path: "/admin/config", Tag: "admin", Summary: "Show the effective configuration, secrets left out", Security: apiAdmin, Status: http.StatusOK, Response: map[string]any{}},
+	{Method: http.MethodPost, Path: "/admin/shares/:dir/link", Tag: "admin", Summary: "Create an expiring link to the listing of a share", Security: apiAdmin,
+		Params: []apiParam{{"ttl", "query", "How long the link is valid"}}, Status: http.StatusOK, Response: signResponse{}},
+	{Method: http.MethodPost, Path: "/admin/presign-upload", Tag: "admin", Summary: "Create presigned upload URLs", Security: apiAdmin,
+		Request: presignRequest{}, Status: http.StatusOK, Response: presignResponse{}},
+	{Method: http.MethodGet, Path: "/admin/gc", Tag: "admin", Summary: "Show what garbage collection would remove", Security: apiAdmin, Status: http.StatusOK, Response: gcReport{}},
+	{Method: http.MethodPost, Path: "/admin/gc", Tag: "admin", Summary: "Collect garbage now", Security: apiAdmin, Status: http.StatusOK, Response: gcReport{}},
+	{Method: http.MethodGet, Path: "/admin/integrity", Tag: "admin", Summary: "Show the scrubber state and the quarantined uploads", Security: apiAdmin, Status: http.StatusOK, Response: integrityResponse{}},
+	{Method: http.MethodPost, Path: "/admin/integrity", Tag: "admin", Summary: "Start scrubbing now", Security: apiAdmin, Status: http.StatusAccepted},
+	{Method: http.MethodGet, Path: "/admin/maintenance", Tag: "admin", Summary: "Show whether uploads are paused", Security: apiAdmin, Status: http.StatusOK, Response: maintenanceResponse{}},
+	{Method: http.MethodPost, Path: "/admin/maintenance", Tag: "admin", Summary: "Pause or resume uploads", Security: apiAdmin,
+		Params: []apiParam{{"uploads", "query", "on or off"}}, Status: http.StatusOK, Response: maintenanceResponse{}},
+	{Method: http.MethodGet, Path: "/admin/mode", Tag: "admin", Summary: "Show whether the server is read-only", Security: apiAdmin, Status: http.StatusOK, Response: modeResponse{}},
+	{Method: http.MethodPost, Path: "/admin/mode", Tag: "admin", Summary: "Switch read-only mode on or off", Security: apiAdmin,
+		Request: modeRequest{}, Status: http.StatusOK, Response: modeResponse{}},
+	{Method: http.MethodGet, Path: "/admin/reconcile", Tag: "admin", Summary: "Show what startup reconciliation adopted and tombstoned", Security: apiAdmin, Status: http.StatusOK, Response: reconcileResponse{}},
+	{Method: http.MethodGet, Path: "/admin/replication", Tag: "admin", Summary: "Show the replication status", Security: apiAdmin, Status: http.StatusOK, Response: replicationStatus{}},
+	{Method: http.MethodGet, Path: "/admin/audit", Tag: "admin", Summary: "Query the audit log", Security: apiAdmin,
+		Params: []apiParam{{"limit", "query", "Most records to return"}, {"type", "query", "Only return records of this type"}}, Status: http.StatusOK, Response: []AuditRecord{}},
+	{Method: http.MethodGet, Path: eventsPath, Tag: "admin", Summary: "Stream upload, download and delete events", Security: apiAdmin,
+		Params: []apiParam{{"types", "query", "Comma separated event types to stream"}}, ResponseType: "text/event-stream", Status: http.StatusOK},
+
+	{Method: http.MethodGet, Path: "/capabilities", Tag: "meta", Summary: "Discover what this server supports", Status: http.StatusOK, Response: capabilities{}},
+	{Method: http.MethodGet, Path: receiptKeyPath, Tag: "meta", Summary: "Get the base64 public key upload receipts are signed with", Status: http.StatusOK},
+	{Method: http.MethodGet, Path: progressPath + "/:id", Tag: "meta", Summary: "Follow the progress of a transfer over a WebSocket", Status: http.StatusSwitchingProtocols},
+	{Method: http.MethodGet, Path: openAPIPath, Tag: "meta", Summary: "Get this document", Status: http.StatusOK, Response: map[string]any{}},
+	{Method: http.MethodGet, Path: healthPath, Tag: "probes", Summary: "Check whether the server is healthy", Status: http.StatusOK, Response: probeStatus{}},
+	{Method: http.MethodHead, Path: healthPath, Tag: "probes", Summary: "Check whether the server is healthy, without a body", Status: http.StatusOK},
+	{Method: http.MethodGet, Path: readyPath, Tag: "probes", Summary: "Check whether the server takes requests", Status: http.StatusOK, Response: probeStatus{}},
+	{Method: http.MethodHead, Path: readyPath, Tag: "probes", Summary: "Check whether the server takes requests, without a body", Status: http.StatusOK},
+	{Method: http.MethodGet, Path: livePath, Tag: "probes", Summary: "Check whether the server is alive", Status: http.StatusOK, Response: probeStatus{}},
+	{Method: http.MethodGet, Path: startupPath, Tag: "probes", Summary: "Check whether the server finished starting", Status: http.StatusOK, Response: probeStatus{}},
+}
+
+// undocumentedRoutes are served but left out of the document: protocols
+// with specs of their own, pages for browsers and routes between servers.
+var undocumentedRoutes = []string{"/favicon.ico", apiDocsPath, metricsPath, davPrefix, clusterBlobsPath}
+
+// openAPISecuritySchemes are the credentials operations ask for. Upload
+// and download credentials are only needed when the server is configured
+// to require them.
+var openAPISecuritySchemes = map[string]any{
+	apiUpload:   map[string]any{"type": "http", "scheme": "bearer", "description": "Auth token or upload token, or the basic auth of a user"},
+	apiDownload: map[string]any{"type": "http", "scheme": "bearer", "description": "Auth token when downloads are protected"},
+	apiAdmin:    map[string]any{"type": "http", "scheme": "bearer", "description": "Admin token"},
+}
+
+// openAPIRoute turns an echo route such as /:dir/* into /{dir}/{path}.
+func openAPIRoute(route string) (string, []string) {
+	segments := strings.Split(route, "/")
+	var params []string
+	for i, segment := range segments {
+		name, ok := strings.CutPrefix(segment, ":")
+		if segment == "*" {
+			name, ok = "path", true
+		}
+		if ok {
+			segments[i] = "{" + name + "}"
+			params = append(params, name)
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// openAPIDocument builds the document for the server at baseURL.
+func (s *Server) openAPIDocument(baseURL string) map[string]any {
+	schemas := make(map[string]any)
+	paths := make(map[string]map[string]any)
+	errorSchema := jsonSchema(reflect.TypeOf(errorResponse{}), schemas)
+	schemas[schemaName(reflect.TypeOf(errorResponse{}))].(map[string]any)["properties"].(map[string]any)["code"] = map[string]any{"type": "string", "enum": errorCodes()}
+	errorContent := map[string]any{"description": "Error", "content": map[string]any{echo.MIMEApplicationJSON: map[string]any{"schema": errorSchema}}}
+	for _, op := range apiOperations {
+		route, pathParams := openAPIRoute(op.Path)
+		var params []any
+		for _, name := range pathParams {
+			params = append(params, map[string]any{"name": name, "in": "path", "required": true, "schema": map[string]any{"type": "string"}})
+		}
+		for _, p := range op.Params {
+			params = append(params, map[string]any{"name": p.Name, "in": p.In, "description": p.Description, "schema": map[string]any{"type": "string"}})
+		}
+		response := map[string]any{"description": http.StatusText(op.Status)}
+		switch {
+		case op.Response != nil:
+			response["content"] = map[string]any{echo.MIMEApplicationJSON: map[string]any{"schema": jsonSchema(reflect.TypeOf(op.Response), schemas)}}
+		case op.ResponseType != "":
+			response["content"] = map[string]any{op.ResponseType: map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}}
+		}
+		operation := map[string]any{
+			"tags":      []string{op.Tag},
+			"summary":   op.Summary,
+			"responses": map[string]any{strconv.Itoa(op.Status): response, "default": errorContent},
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+		switch {
+		case op.Request != nil:
+			operation["requestBody"] = map[string]any{"content": map[string]any{echo.MIMEApplicationJSON: map[string]any{"schema": jsonSchema(reflect.TypeOf(op.Request), schemas)}}}
+		case op.RequestType != "":
+			operation["requestBody"] = map[string]any{"content": map[string]any{op.RequestType: map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}}}
+		}
+		if op.Security != apiPublic {
+			operation["security"] = []any{map[string]any{op.Security: []string{}}}
+		}
+		if paths[route] == nil {
+			paths[route] = make(map[string]any)
+		}
+		paths[route][strings.ToLower(op.Method)] = operation
+	}
+	return map[string]any{
+		"openapi": openAPIVersion,
+		"info": map[string]any{
+			"title":       "simpleserver",
+			"description": "Share files through a tunnel",
+			"version":     "1",
+		},
+		"servers": []any{map[string]any{"url": baseURL}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas":         schemas,
+			"securitySchemes": openAPISecuritySchemes,
+		},
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// jsonSchema describes the JSON encoding of t. Named structs are added to
+// schemas and referenced.
+func jsonSchema(t reflect.Type, schemas map[string]any) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Pointer:
+		schema := jsonSchema(t.Elem(), schemas)
+		if _, ref := schema["$ref"]; ref {
+			return map[string]any{"allOf": []any{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": jsonSchema(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": jsonSchema(t.Elem(), schemas)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, schemas)
+		}
+		name := schemaName(t)
+		if _, ok := schemas[name]; !ok {
+			// Claimed first, in case the type refers to itself.
+			schemas[name] = nil
+			schemas[name] = structSchema(t, schemas)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{}
+}
+
+func schemaName(t reflect.Type) string {
+	name := []rune(t.Name())
+	name[0] = unicode.ToUpper(name[0])
+	return string(name)
+}
+
+func structSchema(t reflect.Type, schemas map[string]any) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+	addFields(t, schemas, properties, &required)
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+// addFields adds the properties encoding/json writes for the fields of t,
+// including those of embedded structs.
+func addFields(t reflect.Type, schemas map[string]any, properties map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			addFields(field.Type, schemas, properties, required)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = jsonSchema(field.Type, schemas)
+		if !strings.Contains(options, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func (s *Server) handleOpenAPI(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.openAPIDocument(s.baseURL(c)))
+}
+
+// apiDocsPage shows /openapi.json in Swagger UI.
+const apiDocsPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>simpleserver API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>
+SwaggerUIBundle({url: "openapi.json", dom_id: "#swagger-ui"});
+</script>
+</body>
+</html>
+`
+
+func (s *Server) handleAPIDocs(c echo.Context) error {
+	s.pageCSP(c, apiDocsCSP)
+	return c.HTML(http.StatusOK, apiDocsPage)
+}
@@ -0,0 +1,79 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken, AuditLog: filepath.Join(t.TempDir(), "audit.log"), APIDocs: true})
+	documented := make(map[string]bool)
+	for _, op := range apiOperations {
+		route := op.Path
+		if op.Route != "" {
+			route = op.Route
+		}
+		documented[op.Method+" "+route] = true
+	}
+	for _, route := range s.newRouter().Routes() {
+		// Not found handlers of route groups.
+		if strings.Contains(route.Name, "labstack/echo") {
+			continue
+		}
+		undocumented := false
+		for _, prefix := range undocumentedRoutes {
+			undocumented = undocumented || route.Path == prefix || strings.HasPrefix(route.Path, prefix+"/")
+		}
+		if !undocumented {
+			require.True(t, documented[route.Method+" "+route.Path], "%s %s is not documented", route.Method, route.Path)
+		}
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodGet, openAPIPath, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]any `json:"properties"`
+				Required   []string                  `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	require.Equal(t, openAPIVersion, doc.OpenAPI)
+	require.Equal(t, "http://example.com", doc.Servers[0].URL)
+	require.Contains(t, doc.Paths["/{dir}/{path}"], "get")
+	require.Contains(t, doc.Paths["/admin/files/{dir}/{path}"], "delete")
+	require.Contains(t, doc.Paths["/uploads/{id}/parts/{n}"], "put")
+
+	upload := doc.Components.Schemas["UploadResponse"]
+	require.NotEmpty(t, upload.Properties)
+	for _, name := range upload.Required {
+		require.Contains(t, upload.Properties, name)
+	}
+	chunked := doc.Components.Schemas["ChunkedUpload"]
+	require.Equal(t, "#/components/schemas/ChunkPart", chunked.Properties["parts"]["items"].(map[string]any)["$ref"])
+	require.Equal(t, "date-time", chunked.Properties["created_at"]["format"])
+	require.Contains(t, doc.Components.Schemas["ErrorResponse"].Properties["code"]["enum"], codeFileTooLarge)
+
+	require.Equal(t, http.StatusNotFound, serve(s, httptest.NewRequest(http.MethodGet, apiDocsPath, nil)).Code)
+	s = newTestServer(t, Config{APIDocs: true})
+	rec = serve(s, httptest.NewRequest(http.MethodGet, apiDocsPath, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "swagger-ui")
+	require.Contains(t, rec.Header().Get("Content-Security-Policy"), "https://unpkg.com")
+}
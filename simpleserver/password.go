@@ -0,0 +1,78 @@
+package simpleserver
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordHeader, or the password query parameter, sets the password of an
+// upload and unlocks a protected download.
+const passwordHeader = "X-Password"
+
+func requestPassword(c echo.Context) string {
+	if password := c.Request().Header.Get(passwordHeader); password != "" {
+		return password
+	}
+	return c.QueryParam("password")
+}
+
+// hashPassword returns the bcrypt hash stored in place of an upload password.
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// checkPassword reports whether the request unlocks meta.
+func checkPassword(c echo.Context, meta FileMeta) bool {
+	password := requestPassword(c)
+	if password == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(meta.PasswordHash), []byte(password)) == nil
+}
+
+var passwordPage = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Name}}</title>
+</head>
+<body style="font-family: system-ui, sans-serif; max-width: 30rem; margin: 3rem auto; padding: 0 1rem">
+<h1>{{.Name}} is password protected</h1>
+{{if .Wrong}}<p style="color: #c0392b">Wrong password, try again.</p>{{end}}
+<form method="get">
+<input type="password" name="password" autofocus required>
+<button type="submit">Download</button>
+</form>
+</body>
+</html>
+`))
+
+// passwordRequired answers a download of a protected file that was not
+// unlocked, with a prompt page for browsers and plain text otherwise.
+func passwordRequired(c echo.Context, meta FileMeta) error {
+	wrong := requestPassword(c) != ""
+	if !strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMETextHTML) {
+		if wrong {
+			return fail(c, http.StatusUnauthorized, "Wrong password")
+		}
+		return fail(c, http.StatusUnauthorized, "Password required, send it in "+passwordHeader+" or ?password=")
+	}
+	var page strings.Builder
+	err := passwordPage.Execute(&page, struct {
+		Name  string
+		Wrong bool
+	}{meta.displayName(), wrong})
+	if err != nil {
+		return err
+	}
+	return c.HTML(http.StatusUnauthorized, page.String())
+}
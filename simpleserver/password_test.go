@@ -0,0 +1,76 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func protectedUpload(t *testing.T, s *Server) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPut, "/secret.txt", strings.NewReader("top secret"))
+	req.Header.Set(passwordHeader, "hunter2")
+	rec := serve(s, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	return downloadURLs(t, rec.Body.String())[0]
+}
+
+func TestPasswordProtectedDownload(t *testing.T) {
+	s := newTestServer(t, Config{})
+	u := protectedUpload(t, s)
+
+	rec := download(t, s, u)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.NotContains(t, rec.Body.String(), "top secret")
+
+	rec = download(t, s, u+"?password=wrong")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Equal(t, errorResponse{Code: codeUnauthorized, Message: "Wrong password"}, errorOf(t, rec.Body.String()))
+
+	rec = download(t, s, u+"?password=hunter2")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "top secret", rec.Body.String())
+
+	req := httptest.NewRequest(http.MethodGet, mustRequestURI(t, u), nil)
+	req.Header.Set(passwordHeader, "hunter2")
+	require.Equal(t, "top secret", serve(s, req).Body.String())
+}
+
+func mustRequestURI(t *testing.T, rawURL string) string {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+	return u.RequestURI()
+}
+
+func TestPasswordPromptPage(t *testing.T) {
+	s := newTestServer(t, Config{})
+	u := protectedUpload(t, s)
+
+	req := httptest.NewRequest(http.MethodGet, mustRequestURI(t, u), nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	rec := serve(s, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Header().Get("Content-Type"), "text/html")
+	require.Contains(t, rec.Body.String(), `name="password"`)
+	require.Contains(t, rec.Body.String(), "secret.txt is password protected")
+}
+
+func TestPasswordStoredHashed(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestServer(t, Config{UploadDir: dir})
+	protectedUpload(t, s)
+
+	meta := findMeta(t, s, "secret.txt")
+	require.NotEmpty(t, meta.PasswordHash)
+	sidecar, err := os.ReadFile(filepath.Join(dir, metaDirName, meta.Dir, meta.Name+".json"))
+	require.NoError(t, err)
+	require.NotContains(t, string(sidecar), "hunter2")
+	require.Contains(t, string(sidecar), meta.PasswordHash)
+}
@@ -0,0 +1,115 @@
+package simpleserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	pastePath = "/paste"
+	// rawPathSuffix serves a paste as plain text, as in
+	// /<dir>/<filename>/raw.
+	rawPathSuffix = "raw"
+)
+
+var (
+	errUnknownSyntax = errors.New("unknown syntax")
+	errInvalidTTL    = errors.New("ttl must be a positive duration such as 90s, 2h or a number of seconds")
+)
+
+// handlePaste answers POST /paste, storing the raw body as a text file
+// shown highlighted at its link, in the style of termbin and sprunge:
+//
+//	echo hi | curl --data-binary @- host/paste
+//
+// ?syntax= names the language to highlight and ?ttl= deletes the paste
+// once it passed, though never later than the server's TTL.
+func (s *Server) handlePaste(c echo.Context) error {
+	name := "paste.txt"
+	if hint := c.QueryParam("syntax"); hint != "" {
+		language, ok := syntaxName(hint)
+		if !ok {
+			return s.uploadError(c, fmt.Errorf("%w %q", errUnknownSyntax, hint))
+		}
+		name = "paste." + language
+	}
+	opts, err := s.uploadOptions(c)
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	opts.Paste = true
+	if value := c.QueryParam("ttl"); value != "" {
+		ttl, err := parseTTL(value)
+		if err != nil {
+			return s.uploadError(c, err)
+		}
+		if opts.TTL <= 0 || ttl < opts.TTL {
+			opts.TTL = ttl
+		}
+	}
+	// A paste is only worth keeping while it can be shown.
+	limit := min(int64(s.maxSize())<<20, maxPreviewSize)
+	if size := c.Request().ContentLength; size > limit {
+		return s.uploadError(c, &sizeLimitError{limit: limit, over: size - limit})
+	}
+	meta, err := s.saveUploadWith(c, s.uploadDirFor(c), name, &maxBytesReader{r: c.Request().Body, n: limit}, opts)
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	c.Response().Header().Set(checksumHeader, meta.SHA256)
+	c.Response().Header().Set(deleteTokenHeader, deleteTokenOf(c, meta))
+	if s.wantsJSON(c) {
+		return c.JSON(http.StatusCreated, s.uploadResponse(c, meta))
+	}
+	return c.String(http.StatusCreated, s.downloadURL(c, meta.Dir, meta.Name)+"\nRaw: "+s.rawURL(c, meta)+"\n")
+}
+
+// syntaxName returns the canonical name of a language the highlighter
+// knows, which pastes are stored with as extension.
+func syntaxName(language string) (string, bool) {
+	if _, ok := syntaxFor(language); !ok {
+		return "", false
+	}
+	language = strings.ToLower(language)
+	if alias, ok := syntaxAliases[language]; ok {
+		return alias, true
+	}
+	return language, true
+}
+
+// parseTTL reads a duration such as 2h, or a plain number of seconds.
+func parseTTL(value string) (time.Duration, error) {
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, convErr := strconv.ParseInt(value, 10, 64)
+		if convErr != nil {
+			return 0, errInvalidTTL
+		}
+		ttl = time.Duration(seconds) * time.Second
+	}
+	if ttl <= 0 {
+		return 0, errInvalidTTL
+	}
+	return ttl, nil
+}
+
+// rawTarget reports whether name asks for the plain text of a paste.
+func (s *Server) rawTarget(dir, name string) (string, bool) {
+	target, ok := s.suffixTarget(dir, name, rawPathSuffix)
+	if !ok {
+		return "", false
+	}
+	meta, _ := s.index.get(dir, target)
+	return target, meta.Paste
+}
+
+// rawURL is where a paste is served as plain text.
+func (s *Server) rawURL(c echo.Context, meta FileMeta) string {
+	return s.downloadURL(c, meta.Dir, meta.Name) + "/" + rawPathSuffix
+}
@@ -0,0 +1,66 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasteServesHighlightedAndRawViews(t *testing.T) {
+	s := newTestServer(t, Config{})
+	req := httptest.NewRequest(http.MethodPost, "/paste?syntax=golang", strings.NewReader("func main() {}\n"))
+	// curl --data-binary sends pastes as form data, the body must be kept raw.
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := serve(s, req)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	urls := downloadURLs(t, rec.Body.String())
+	require.True(t, strings.HasSuffix(urls[0], "/paste.go"), urls[0])
+	require.Contains(t, rec.Body.String(), "Raw: "+urls[0]+"/raw\n")
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, urls[0], nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Header().Get(echo.HeaderContentType), "text/html")
+	require.Contains(t, rec.Body.String(), `<span class="k">func</span> main()`)
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, urls[0]+"/raw", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, echo.MIMETextPlainCharsetUTF8, rec.Header().Get(echo.HeaderContentType))
+	require.True(t, strings.HasPrefix(rec.Header().Get(echo.HeaderContentDisposition), "inline"))
+	require.Equal(t, "func main() {}\n", rec.Body.String())
+}
+
+func TestPasteOptions(t *testing.T) {
+	s := newTestServer(t, Config{TTL: 24 * time.Hour})
+	req := httptest.NewRequest(http.MethodPost, "/paste?ttl=1h", strings.NewReader("hello"))
+	req.Header.Set(echo.HeaderAccept, echo.MIMEApplicationJSON)
+	rec := serve(s, req)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var resp uploadResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, "paste.txt", resp.Name)
+	require.Equal(t, resp.URL+"/raw", resp.RawURL)
+	require.WithinDuration(t, time.Now().Add(time.Hour), *resp.ExpiresAt, time.Minute)
+
+	// A paste never outlives the server's TTL.
+	req = httptest.NewRequest(http.MethodPost, "/paste?ttl=720h", strings.NewReader("hello"))
+	req.Header.Set(echo.HeaderAccept, echo.MIMEApplicationJSON)
+	rec = serve(s, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.WithinDuration(t, time.Now().Add(24*time.Hour), *resp.ExpiresAt, time.Minute)
+
+	require.Equal(t, http.StatusBadRequest, serve(s, httptest.NewRequest(http.MethodPost, "/paste?syntax=cobol", strings.NewReader("x"))).Code)
+	require.Equal(t, http.StatusBadRequest, serve(s, httptest.NewRequest(http.MethodPost, "/paste?ttl=-1h", strings.NewReader("x"))).Code)
+	require.Equal(t, http.StatusRequestEntityTooLarge, serve(s, httptest.NewRequest(http.MethodPost, "/paste", strings.NewReader(strings.Repeat("x", maxPreviewSize+1)))).Code)
+
+	// Ordinary uploads keep their /raw path free.
+	rec = serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("hello")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Equal(t, http.StatusNotFound, serve(s, httptest.NewRequest(http.MethodGet, downloadURLs(t, rec.Body.String())[0]+"/raw", nil)).Code)
+}
@@ -0,0 +1,140 @@
+package simpleserver
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const defaultFilename = "uploaded-file"
+
+// maxFilenameBytes is the longest path segment most filesystems accept.
+const maxFilenameBytes = 255
+
+// windowsReservedNames cannot be created on Windows, with or without an
+// extension, which breaks clients saving downloads under their own names.
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+func isReservedName(segment string) bool {
+	stem, _, _ := strings.Cut(segment, ".")
+	return windowsReservedNames[strings.ToUpper(strings.TrimRight(stem, " "))]
+}
+
+// truncateFilename shortens name to maxFilenameBytes, cutting the stem so
+// the extension survives and never splitting a character.
+func truncateFilename(name string) string {
+	if len(name) <= maxFilenameBytes {
+		return name
+	}
+	ext := path.Ext(name)
+	if len(ext) >= maxFilenameBytes/2 {
+		ext = ""
+	}
+	stem := name[:maxFilenameBytes-len(ext)]
+	for !utf8.ValidString(stem) {
+		stem = stem[:len(stem)-1]
+	}
+	return stem + ext
+}
+
+// Name strategies decide the stored filename of an upload. Opaque names keep
+// the extension so content types can still be inferred.
+const (
+	NameOriginal = "original"
+	NameHash     = "hash"
+	NameRandom   = "random"
+)
+
+var (
+	errUnsafePath     = errors.New("unsafe path")
+	errNoSafeFilename = errors.New("filename has no safe characters; send a name made of printable characters other than slashes")
+)
+
+// sanitizeFilename reduces a client supplied name to a single safe path
+// segment, falling back to defaultFilename when nothing usable is left.
+func sanitizeFilename(name string) string {
+	if name = cleanFilename(name); name == "" {
+		return defaultFilename
+	}
+	return name
+}
+
+// cleanFilename is sanitizeFilename without the fallback: it returns "" when
+// nothing usable is left. Invalid UTF-8 and control characters are dropped,
+// long names shortened and reserved Windows device names refused.
+func cleanFilename(name string) string {
+	name = strings.ToValidUTF8(name, "")
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '/' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "." || name == ".." || isReservedName(name) {
+		return ""
+	}
+	return truncateFilename(name)
+}
+
+// uploadFilename sanitizes the name of a flat upload. With StrictFilename a
+// name that sanitizes to nothing is rejected instead of replaced, so client
+// bugs do not go unnoticed.
+func (s *Server) uploadFilename(name string) (string, error) {
+	if !s.config.StrictFilename {
+		return sanitizeFilename(name), nil
+	}
+	if name = cleanFilename(name); name == "" {
+		return "", errNoSafeFilename
+	}
+	return name, nil
+}
+
+// isShareDir reports whether dir can name an upload directory. Dot prefixed
+// names are reserved for server state such as the metadata sidecars.
+func isShareDir(dir string) bool {
+	return dir != "" && !strings.HasPrefix(dir, ".") && !strings.ContainsAny(dir, "/\\")
+}
+
+// cleanRelativePath validates a slash separated relative path such as the
+// ones browsers send for webkitdirectory uploads. Unlike sanitizeFilename it
+// refuses to guess: absolute paths, traversal segments, empty segments,
+// control characters, invalid UTF-8, overlong segments and reserved Windows
+// names are all rejected.
+func cleanRelativePath(name string) (string, error) {
+	if name == "" || !utf8.ValidString(name) || strings.ContainsRune(name, '\\') || path.IsAbs(name) || filepath.IsAbs(name) {
+		return "", errUnsafePath
+	}
+	segments := strings.Split(name, "/")
+	for _, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." || strings.TrimSpace(segment) != segment {
+			return "", errUnsafePath
+		}
+		if strings.IndexFunc(segment, unicode.IsControl) >= 0 || filepath.VolumeName(segment) != "" ||
+			len(segment) > maxFilenameBytes || isReservedName(segment) {
+			return "", errUnsafePath
+		}
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// storageName maps a validated upload name to the name it is stored under.
+// Any directories in name are kept, only the last segment is replaced.
+func (s *Server) storageName(name, sha256Hex string) string {
+	dir, base := path.Split(name)
+	switch s.config.NameStrategy {
+	case NameHash:
+		return dir + sha256Hex[:32] + path.Ext(base)
+	case NameRandom:
+		return dir + base58(16) + path.Ext(base)
+	}
+	return name
+}
@@ -0,0 +1,103 @@
+package simpleserver
+
+import (
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	for in, want := range map[string]string{
+		"/report.pdf":        "report.pdf",
+		"/a/b/c.txt":         "c.txt",
+		`C:\Users\me\x.txt`:  "x.txt",
+		"/bad\x00name\n.txt": "badname.txt",
+		"/":                  defaultFilename,
+		"/..":                defaultFilename,
+		"/nul":               defaultFilename,
+		"/Com1.log":          defaultFilename,
+		"/console.log":       "console.log",
+		"/caf\xe9.txt":       "caf.txt",
+	} {
+		require.Equal(t, want, sanitizeFilename(in), in)
+	}
+
+	long := sanitizeFilename("/" + strings.Repeat("é", 200) + ".tar.gz")
+	require.Len(t, long, maxFilenameBytes)
+	require.True(t, strings.HasSuffix(long, ".gz"))
+	require.True(t, utf8.ValidString(long))
+}
+
+func TestNameStrategyKeepsOriginalNameForDownload(t *testing.T) {
+	for strategy, pattern := range map[string]string{
+		NameHash:   `^[0-9a-f]{32}\.pdf$`,
+		NameRandom: `^[1-9A-HJ-NP-Za-km-z]{16}\.pdf$`,
+	} {
+		t.Run(strategy, func(t *testing.T) {
+			s := newTestServer(t, Config{NameStrategy: strategy})
+			rec := serve(s, httptest.NewRequest(http.MethodPut, "/report.pdf", strings.NewReader("%PDF-1.4 quarterly")))
+			require.Equal(t, http.StatusCreated, rec.Code)
+			fileURL := downloadURLs(t, rec.Body.String())[0]
+			require.NotContains(t, fileURL, "report")
+			storedName := fileURL[strings.LastIndex(fileURL, "/")+1:]
+			require.Regexp(t, regexp.MustCompile(pattern), storedName)
+
+			rec = download(t, s, fileURL)
+			require.Equal(t, http.StatusOK, rec.Code)
+			require.Equal(t, "%PDF-1.4 quarterly", rec.Body.String())
+			_, params, err := mime.ParseMediaType(rec.Header().Get("Content-Disposition"))
+			require.NoError(t, err)
+			require.Equal(t, "report.pdf", params["filename"])
+		})
+	}
+}
+
+func TestHashNameIsDeterministic(t *testing.T) {
+	s := newTestServer(t, Config{NameStrategy: NameHash})
+	names := make(map[string]bool)
+	for _, filename := range []string{"/a.txt", "/b.txt"} {
+		rec := serve(s, httptest.NewRequest(http.MethodPut, filename, strings.NewReader("same content")))
+		require.Equal(t, http.StatusCreated, rec.Code)
+		fileURL := downloadURLs(t, rec.Body.String())[0]
+		names[fileURL[strings.LastIndex(fileURL, "/")+1:]] = true
+	}
+	require.Len(t, names, 1)
+}
+
+func TestOriginalNameStrategyIsAttachment(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/report.pdf", strings.NewReader("%PDF-1.4")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	rec = download(t, s, downloadURLs(t, rec.Body.String())[0])
+	require.Equal(t, `attachment; filename="report.pdf"`, rec.Header().Get("Content-Disposition"))
+}
+
+func TestContentDisposition(t *testing.T) {
+	require.Equal(t, `attachment; filename="report.pdf"`, contentDisposition("attachment", "report.pdf"))
+	require.Equal(t, `attachment; filename="r_sum_.pdf"; filename*=UTF-8''r%C3%A9sum%C3%A9.pdf`, contentDisposition("attachment", "résumé.pdf"))
+}
+
+func TestStrictFilename(t *testing.T) {
+	for _, target := range []string{"/%01%02", "/%20%0A", "/.."} {
+		s := newTestServer(t, Config{})
+		rec := serve(s, httptest.NewRequest(http.MethodPut, target, strings.NewReader("data")))
+		require.Equal(t, http.StatusCreated, rec.Code, target)
+		require.True(t, strings.HasSuffix(downloadURLs(t, rec.Body.String())[0], "/"+defaultFilename), target)
+
+		s = newTestServer(t, Config{StrictFilename: true})
+		rec = serve(s, httptest.NewRequest(http.MethodPut, target, strings.NewReader("data")))
+		require.Equal(t, http.StatusBadRequest, rec.Code, target)
+		require.Contains(t, rec.Body.String(), "no safe characters")
+		require.Empty(t, shareDirs(t, s))
+	}
+
+	s := newTestServer(t, Config{StrictFilename: true})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/ok.txt", strings.NewReader("data")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+}
@@ -0,0 +1,180 @@
+package simpleserver
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Pipes relay a PUT /pipe/<id> body straight to the GET /pipe/<id> on the
+// other end, in the style of patchbay and piping-server, without storing
+// anything:
+//
+//	tar c dir | curl -T - host/pipe/x
+//	curl host/pipe/x | tar x
+//
+// Whichever side comes first waits up to pipeWait for the other.
+const (
+	pipePath = "/pipe"
+	pipeWait = 10 * time.Minute
+)
+
+// pipeTransfer is what a sender hands to the receiver of its pipe. The
+// receiver reports how the copy went on done.
+type pipeTransfer struct {
+	body        io.Reader
+	contentType string
+	size        int64
+	done        chan pipeResult
+}
+
+type pipeResult struct {
+	n   int64
+	err error
+}
+
+// pipe pairs one sender with one receiver.
+type pipe struct {
+	handoff   chan pipeTransfer
+	sending   bool
+	receiving bool
+}
+
+type pipeRelay struct {
+	mu    sync.Mutex
+	pipes map[string]*pipe
+}
+
+func newPipeRelay() *pipeRelay {
+	return &pipeRelay{pipes: make(map[string]*pipe)}
+}
+
+// join takes the sending or receiving end of pipe id, and reports false
+// when another client holds it.
+func (r *pipeRelay) join(id string, sending bool) (*pipe, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.pipes[id]
+	if p == nil {
+		p = &pipe{handoff: make(chan pipeTransfer)}
+		r.pipes[id] = p
+	}
+	end := &p.receiving
+	if sending {
+		end = &p.sending
+	}
+	if *end {
+		return nil, false
+	}
+	*end = true
+	return p, true
+}
+
+func (r *pipeRelay) leave(id string, sending bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.pipes[id]
+	if p == nil {
+		return
+	}
+	if sending {
+		p.sending = false
+	} else {
+		p.receiving = false
+	}
+	if !p.sending && !p.receiving {
+		delete(r.pipes, id)
+	}
+}
+
+// handlePipeSend answers PUT /pipe/:id once a receiver took the whole body.
+func (s *Server) handlePipeSend(c echo.Context) error {
+	id := c.Param("id")
+	if !validSlug(id) {
+		return fail(c, http.StatusBadRequest, errInvalidSlug.Error())
+	}
+	p, ok := s.pipes.join(id, true)
+	if !ok {
+		return fail(c, http.StatusConflict, "Another sender is using this pipe")
+	}
+	defer s.pipes.leave(id, true)
+	req := c.Request()
+	transfer := pipeTransfer{
+		body:        req.Body,
+		contentType: req.Header.Get(echo.HeaderContentType),
+		size:        req.ContentLength,
+		done:        make(chan pipeResult, 1),
+	}
+	timeout := time.NewTimer(pipeWait)
+	defer timeout.Stop()
+	select {
+	case p.handoff <- transfer:
+	case <-timeout.C:
+		return fail(c, http.StatusRequestTimeout, "No receiver connected to the pipe")
+	case <-req.Context().Done():
+		return nil
+	}
+	result := <-transfer.done
+	if result.err != nil {
+		log.Printf("Failed to stream pipe %s after %d bytes: %v\n", id, result.n, result.err)
+		return fail(c, http.StatusBadGateway, fmt.Sprintf("Transfer broke off after %d bytes", result.n))
+	}
+	return c.String(http.StatusOK, fmt.Sprintf("Sent %d bytes\n", result.n))
+}
+
+// handlePipeReceive answers GET /pipe/:id with the body of its sender,
+// flushed as it arrives.
+func (s *Server) handlePipeReceive(c echo.Context) error {
+	id := c.Param("id")
+	if !validSlug(id) {
+		return fail(c, http.StatusBadRequest, errInvalidSlug.Error())
+	}
+	p, ok := s.pipes.join(id, false)
+	if !ok {
+		return fail(c, http.StatusConflict, "Another receiver is using this pipe")
+	}
+	defer s.pipes.leave(id, false)
+	timeout := time.NewTimer(pipeWait)
+	defer timeout.Stop()
+	var transfer pipeTransfer
+	select {
+	case transfer = <-p.handoff:
+	case <-timeout.C:
+		return fail(c, http.StatusRequestTimeout, "No sender connected to the pipe")
+	case <-c.Request().Context().Done():
+		return nil
+	}
+
+	w := c.Response()
+	contentType := transfer.contentType
+	if contentType == "" {
+		contentType = echo.MIMEOctetStream
+	}
+	w.Header().Set(echo.HeaderContentType, contentType)
+	w.Header().Set(echo.HeaderCacheControl, "no-store")
+	if transfer.size >= 0 {
+		w.Header().Set(echo.HeaderContentLength, strconv.FormatInt(transfer.size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Flush()
+	n, err := io.Copy(flushWriter{w}, transfer.body)
+	transfer.done <- pipeResult{n: n, err: err}
+	return nil
+}
+
+// flushWriter sends every write to the client at once.
+type flushWriter struct {
+	w *echo.Response
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	f.w.Flush()
+	return n, err
+}
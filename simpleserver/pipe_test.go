@@ -0,0 +1,93 @@
+package simpleserver
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func pipeJoined(s *Server, id string, sending bool) func() bool {
+	return func() bool {
+		s.pipes.mu.Lock()
+		defer s.pipes.mu.Unlock()
+		p := s.pipes.pipes[id]
+		return p != nil && (sending && p.sending || !sending && p.receiving)
+	}
+}
+
+func TestPipeStreamsToReceiver(t *testing.T) {
+	s := newTestServer(t, Config{})
+	ts := httptest.NewServer(s.newRouter())
+	defer ts.Close()
+
+	body, feed := io.Pipe()
+	sent := make(chan string, 1)
+	go func() {
+		req, _ := http.NewRequest(http.MethodPut, ts.URL+pipePath+"/x", body)
+		req.Header.Set("Content-Type", "text/plain")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			sent <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		content, _ := io.ReadAll(resp.Body)
+		sent <- string(content)
+	}()
+	require.Eventually(t, pipeJoined(s, "x", true), 5*time.Second, 10*time.Millisecond)
+
+	resp, err := (&http.Client{Timeout: 5 * time.Second}).Get(ts.URL + pipePath + "/x")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+	received := bufio.NewReader(resp.Body)
+	for _, line := range []string{"first\n", "second\n"} {
+		_, err := feed.Write([]byte(line))
+		require.NoError(t, err)
+		got, err := received.ReadString('\n')
+		require.NoError(t, err)
+		require.Equal(t, line, got, "each write reaches the receiver before the next one")
+	}
+	require.NoError(t, feed.Close())
+	_, err = received.ReadByte()
+	require.ErrorIs(t, err, io.EOF)
+	require.Equal(t, "Sent 13 bytes\n", <-sent)
+	require.Eventually(t, func() bool { return !pipeJoined(s, "x", true)() }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestPipeReceiverWaitsForSender(t *testing.T) {
+	s := newTestServer(t, Config{})
+	ts := httptest.NewServer(s.newRouter())
+	defer ts.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(ts.URL + pipePath + "/y")
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		content, _ := io.ReadAll(resp.Body)
+		received <- string(content)
+	}()
+	require.Eventually(t, pipeJoined(s, "y", false), 5*time.Second, 10*time.Millisecond)
+	rec := serve(s, httptest.NewRequest(http.MethodGet, pipePath+"/y", nil))
+	require.Equal(t, http.StatusConflict, rec.Code, "one receiver per pipe")
+
+	req, err := http.NewRequest(http.MethodPut, ts.URL+pipePath+"/y", strings.NewReader("hello"))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "hello", <-received)
+	require.Equal(t, http.StatusBadRequest, serve(s, httptest.NewRequest(http.MethodGet, pipePath+"/no.dots", nil)).Code)
+}
@@ -0,0 +1,190 @@
+package simpleserver
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/labstack/echo/v4"
+)
+
+// variantDirName holds the pre-compressed variants of text uploads, named
+// after their content as <sha256>.gz and <sha256>.zst.
+const variantDirName = ".precompressed"
+
+var variantExtensions = map[string]string{
+	encodingZstd: ".zst",
+	encodingGzip: ".gz",
+}
+
+// precompressible reports whether a compressed variant of meta is stored at
+// upload time. Encrypted uploads never get one, it would keep their content
+// readable on disk.
+func (s *Server) precompressible(meta FileMeta) bool {
+	return s.config.Precompress && s.cipher == nil && textContentType(meta.ContentType)
+}
+
+func (s *Server) variantPath(sha256, encoding string) string {
+	return filepath.Join(s.getUploadDir(), variantDirName, sha256+variantExtensions[encoding])
+}
+
+// variantWriter compresses an upload into its variants while it is stored.
+// Failing to make them never fails the upload, it is only served
+// uncompressed.
+type variantWriter struct {
+	dir   string
+	files map[string]*os.File
+	encs  map[string]io.WriteCloser
+	err   error
+}
+
+func (s *Server) newVariantWriter() (*variantWriter, error) {
+	v := &variantWriter{
+		dir:   filepath.Join(s.getUploadDir(), variantDirName),
+		files: make(map[string]*os.File),
+		encs:  make(map[string]io.WriteCloser),
+	}
+	if err := os.MkdirAll(v.dir, 0755); err != nil {
+		return nil, err
+	}
+	for encoding := range variantExtensions {
+		file, err := os.CreateTemp(v.dir, "*"+partSuffix)
+		if err != nil {
+			v.discard()
+			return nil, err
+		}
+		v.files[encoding] = file
+		// Uploads are compressed once and downloaded many times, so the
+		// slowest settings pay off.
+		if encoding == encodingZstd {
+			v.encs[encoding], err = zstd.NewWriter(file, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+		} else {
+			v.encs[encoding], err = gzip.NewWriterLevel(file, gzip.BestCompression)
+		}
+		if err != nil {
+			v.discard()
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+func (v *variantWriter) Write(p []byte) (int, error) {
+	for _, enc := range v.encs {
+		if _, err := enc.Write(p); err != nil && v.err == nil {
+			v.err = err
+		}
+	}
+	return len(p), nil
+}
+
+// commit names the variants after sha256, dropping those that came out no
+// smaller than the size bytes of the upload.
+func (v *variantWriter) commit(sha256 string, size int64) error {
+	defer v.discard()
+	if v.err != nil {
+		return v.err
+	}
+	for encoding, file := range v.files {
+		if err := v.encs[encoding].Close(); err != nil {
+			return err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		if info.Size() >= size {
+			continue
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+		if err := os.Rename(file.Name(), filepath.Join(v.dir, sha256+variantExtensions[encoding])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discard removes the variants that were not committed.
+func (v *variantWriter) discard() {
+	for _, file := range v.files {
+		file.Close()
+		os.Remove(file.Name())
+	}
+}
+
+// dropVariants removes the variants of meta once no upload has its content
+// anymore.
+func (s *Server) dropVariants(meta FileMeta) {
+	if meta.SHA256 == "" || s.index.hasContent(meta.SHA256) {
+		return
+	}
+	for encoding := range variantExtensions {
+		if err := os.Remove(s.variantPath(meta.SHA256, encoding)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Failed to remove compressed variant of %s: %v\n", meta.key(), err)
+		}
+	}
+}
+
+// hasContent reports whether an upload with the given checksum is stored.
+func (ix *metaIndex) hasContent(sha256 string) bool {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	for _, meta := range ix.files {
+		if meta.SHA256 == sha256 {
+			return true
+		}
+	}
+	return false
+}
+
+// openVariant opens the stored variant of meta in the encoding the client
+// prefers. Ranged requests and downloads that are counted get none, their
+// bytes must be those of the file itself.
+func (s *Server) openVariant(c echo.Context, meta FileMeta) (*os.File, string) {
+	if !s.config.Precompress || meta.SHA256 == "" || meta.Once || meta.MaxDownloads > 0 || c.Request().Header.Get("Range") != "" {
+		return nil, ""
+	}
+	var offers []string
+	for _, encoding := range responseEncodings {
+		if _, err := os.Stat(s.variantPath(meta.SHA256, encoding)); err == nil {
+			offers = append(offers, encoding)
+		}
+	}
+	encoding := negotiateEncoding(c.Request().Header.Get("Accept-Encoding"), offers)
+	if encoding == "" {
+		return nil, ""
+	}
+	variant, err := os.Open(s.variantPath(meta.SHA256, encoding))
+	if err != nil {
+		return nil, ""
+	}
+	return variant, encoding
+}
+
+// serveVariant answers with a pre-compressed variant, sparing the response
+// compression.
+func serveVariant(c echo.Context, variant *os.File, encoding string) error {
+	defer variant.Close()
+	info, err := variant.Stat()
+	if err != nil {
+		return err
+	}
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentEncoding, encoding)
+	header.Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+	header.Set(echo.HeaderContentLength, strconv.FormatInt(info.Size(), 10))
+	c.Response().WriteHeader(http.StatusOK)
+	if c.Request().Method == http.MethodHead {
+		return nil
+	}
+	return sendBody(c, variant)
+}
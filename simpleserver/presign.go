@@ -0,0 +1,184 @@
+package simpleserver
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type presignRequest struct {
+	// Dir is the share the file goes to, a new one when empty.
+	Dir  string `json:"dir"`
+	Name string `json:"name"`
+	// MaxBytes caps the upload, at MaxSize when zero.
+	MaxBytes  int64  `json:"max_bytes"`
+	ExpiresIn string `json:"expires_in"`
+}
+
+type presignResponse struct {
+	URL       string    `json:"url"`
+	Method    string    `json:"method"`
+	Dir       string    `json:"dir"`
+	Name      string    `json:"name"`
+	MaxBytes  int64     `json:"max_bytes"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// presignedUpload is what the query of a pre-signed upload URL grants.
+type presignedUpload struct {
+	maxBytes int64
+	expires  int64
+	nonce    string
+}
+
+// presignedUploads remembers the nonces of pre-signed URLs that were used,
+// until they expire, so each URL uploads only once. Nonces of uploads in
+// progress are held as well and given back when the upload fails.
+type presignedUploads struct {
+	mu   sync.Mutex
+	used map[string]int64
+}
+
+func newPresignedUploads() *presignedUploads {
+	return &presignedUploads{used: make(map[string]int64)}
+}
+
+// claim takes nonce, or reports false when it was taken already. release
+// gives it back for another attempt.
+func (p *presignedUploads) claim(nonce string, expires int64) (release func(), ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now().Unix()
+	for used, until := range p.used {
+		if now > until {
+			delete(p.used, used)
+		}
+	}
+	if _, taken := p.used[nonce]; taken {
+		return nil, false
+	}
+	p.used[nonce] = expires
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(p.used, nonce)
+	}, true
+}
+
+// signUpload returns the signature allowing one PUT of up to maxBytes to
+// dir/name until the unix time expires.
+func (s *Server) signUpload(dir, name string, grant presignedUpload) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte("PUT\n" + metaKey(dir, name) + "\n" + strconv.FormatInt(grant.maxBytes, 10) + "\n" +
+		strconv.FormatInt(grant.expires, 10) + "\n" + grant.nonce))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// presignedGrant reports whether the request carries the query of a
+// pre-signed upload URL, and whether it is a valid one that has not expired.
+func (s *Server) presignedGrant(c echo.Context) (grant presignedUpload, signed, valid bool) {
+	sig := c.QueryParam("sig")
+	if sig == "" || c.Request().Method != http.MethodPut {
+		return grant, false, false
+	}
+	dir, name, err := downloadTarget(c.Request())
+	if err != nil {
+		return grant, true, false
+	}
+	grant.nonce = c.QueryParam("nonce")
+	grant.maxBytes, err = strconv.ParseInt(c.QueryParam("max"), 10, 64)
+	if err != nil || grant.nonce == "" {
+		return grant, true, false
+	}
+	grant.expires, err = strconv.ParseInt(c.QueryParam("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > grant.expires {
+		return grant, true, false
+	}
+	return grant, true, hmac.Equal([]byte(sig), []byte(s.signUpload(dir, name, grant)))
+}
+
+// handlePresign answers POST /admin/presign-upload with a URL that uploads
+// one file of up to max_bytes to dir/name with PUT, without credentials,
+// until it expires expires_in after now.
+func (s *Server) handlePresign(c echo.Context) error {
+	var req presignRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return fail(c, http.StatusBadRequest, "Invalid JSON body")
+	}
+	name, err := s.uploadFilename(req.Name)
+	if req.Name == "" || err != nil {
+		return fail(c, http.StatusBadRequest, "name must be a valid file name")
+	}
+	limit := int64(s.maxSize()) << 20
+	if req.MaxBytes < 0 || req.MaxBytes > limit {
+		return fail(c, http.StatusBadRequest, "max_bytes must be between 0 and "+strconv.FormatInt(limit, 10))
+	}
+	if req.MaxBytes == 0 {
+		req.MaxBytes = limit
+	}
+	ttl := defaultSignedURLTTL
+	if req.ExpiresIn != "" {
+		if ttl, err = time.ParseDuration(req.ExpiresIn); err != nil || ttl <= 0 || ttl > maxSignedURLTTL {
+			return fail(c, http.StatusBadRequest, "expires_in must be a positive duration of at most "+maxSignedURLTTL.String())
+		}
+	}
+	dir := req.Dir
+	if dir == "" {
+		dir = s.newShareDir()
+	} else if !validSlug(dir) || s.claimedByDropShare(dir) || s.isUserDir(dir) {
+		return fail(c, http.StatusBadRequest, "dir must be a share name that is not reserved")
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second).UTC()
+	grant := presignedUpload{maxBytes: req.MaxBytes, expires: expiresAt.Unix(), nonce: hex.EncodeToString(nonce)}
+	url := s.downloadURL(c, dir, name) + "?expires=" + strconv.FormatInt(grant.expires, 10) +
+		"&max=" + strconv.FormatInt(grant.maxBytes, 10) + "&nonce=" + grant.nonce + "&sig=" + s.signUpload(dir, name, grant)
+	return c.JSON(http.StatusOK, presignResponse{
+		URL:       url,
+		Method:    http.MethodPut,
+		Dir:       dir,
+		Name:      name,
+		MaxBytes:  grant.maxBytes,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// handlePresignedUpload stores the file sent to a pre-signed upload URL at
+// the dir and name it was signed for. requireUploadAuth checked the
+// signature already.
+func (s *Server) handlePresignedUpload(c echo.Context, grant presignedUpload) error {
+	dir, name, err := downloadTarget(c.Request())
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	if _, exists := s.index.get(dir, name); exists {
+		return fail(c, http.StatusConflict, "File already exists")
+	}
+	release, ok := s.presigned.claim(grant.nonce, grant.expires)
+	if !ok {
+		return failWith(c, http.StatusGone, codeLinkUsed, "Upload link was already used")
+	}
+	if size := c.Request().ContentLength; size > grant.maxBytes {
+		release()
+		return s.uploadError(c, &sizeLimitError{limit: grant.maxBytes, over: size - grant.maxBytes})
+	}
+	meta, err := s.saveUpload(c, dir, name, &maxBytesReader{r: c.Request().Body, n: grant.maxBytes})
+	if err != nil {
+		release()
+		return s.uploadError(c, err)
+	}
+	return s.uploaded(c, meta)
+}
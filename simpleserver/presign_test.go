@@ -0,0 +1,78 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func presign(t *testing.T, s *Server, body string) presignResponse {
+	t.Helper()
+	rec := serve(s, adminRequest(http.MethodPost, "/admin/presign-upload", body))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var response presignResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	return response
+}
+
+func presignedPut(s *Server, rawURL, content string) *httptest.ResponseRecorder {
+	u, _ := url.Parse(rawURL)
+	return serve(s, httptest.NewRequest(http.MethodPut, u.RequestURI(), strings.NewReader(content)))
+}
+
+func TestPresignedUploadWorksOnce(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken, AuthToken: "secret"})
+	grant := presign(t, s, `{"dir":"reports","name":"q3.pdf","max_bytes":10,"expires_in":"10m"}`)
+	require.Equal(t, "reports", grant.Dir)
+	require.Equal(t, http.MethodPut, grant.Method)
+
+	rec := presignedPut(s, grant.URL, "report")
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	require.Equal(t, int64(6), findMeta(t, s, "q3.pdf").Size)
+	require.Equal(t, "reports", findMeta(t, s, "q3.pdf").Dir)
+
+	rec = presignedPut(s, grant.URL, "again")
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.NoError(t, s.deleteFile(findMeta(t, s, "q3.pdf")))
+	rec = presignedPut(s, grant.URL, "again")
+	require.Equal(t, http.StatusGone, rec.Code)
+	require.Equal(t, codeLinkUsed, errorOf(t, rec.Body.String()).Code)
+}
+
+func TestPresignedUploadLimits(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken, AuthToken: "secret"})
+	grant := presign(t, s, `{"name":"small.txt","max_bytes":4}`)
+	require.NotEmpty(t, grant.Dir)
+
+	rec := presignedPut(s, grant.URL, "too large")
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	rec = presignedPut(s, grant.URL, "ok")
+	require.Equal(t, http.StatusCreated, rec.Code, "a failed attempt leaves the link usable")
+
+	tampered := strings.Replace(grant.URL, "max=4", "max=400", 1)
+	rec = presignedPut(s, tampered, "ok")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	other := strings.Replace(grant.URL, "/small.txt?", "/other.txt?", 1)
+	rec = presignedPut(s, other, "ok")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestPresignRejectsInvalidRequests(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken, MaxSize: 1})
+	for _, body := range []string{
+		`{}`,
+		`{"name":"a.txt","max_bytes":2097152}`,
+		`{"name":"a.txt","expires_in":"-1h"}`,
+		`{"name":"a.txt","dir":"admin"}`,
+	} {
+		rec := serve(s, adminRequest(http.MethodPost, "/admin/presign-upload", body))
+		require.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+	rec := serve(s, httptest.NewRequest(http.MethodPost, "/admin/presign-upload", strings.NewReader(`{"name":"a.txt"}`)))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
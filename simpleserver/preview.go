@@ -0,0 +1,183 @@
+package simpleserver
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/russross/blackfriday/v2"
+)
+
+const (
+	previewPathSuffix = "preview"
+	// maxPreviewSize bounds the files rendered in the browser, larger ones
+	// are better downloaded.
+	maxPreviewSize = 1 << 20
+	// previewCSP keeps anything a rendered file smuggles past the sanitizer
+	// from running: no scripts, frames or remote styles at all.
+	previewCSP = "default-src 'none'; img-src * data:; style-src 'unsafe-inline'"
+)
+
+var errNotText = errors.New("file is not text")
+
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Name}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 52rem; margin: 2rem auto; padding: 0 1rem; line-height: 1.5; color: #222 }
+header { display: flex; justify-content: space-between; border-bottom: 1px solid #ddd; margin-bottom: 1rem }
+pre { background: #f6f8fa; padding: 1rem; overflow-x: auto; line-height: 1.4 }
+code { font-family: ui-monospace, monospace; font-size: .9em }
+img { max-width: 100% }
+.c { color: #6a737d } .s { color: #032f62 } .k { color: #d73a49 } .n { color: #005cc5 }
+</style>
+</head>
+<body>
+<header><strong>{{.Name}}</strong><a href="{{.DownloadURL}}">{{if .Raw}}Raw{{else}}Download{{end}}</a></header>
+{{if .Markdown}}{{.Content}}{{else}}<pre><code>{{.Content}}</code></pre>{{end}}
+</body>
+</html>
+`))
+
+// previewTarget reports whether name asks for the preview of a stored file,
+// as in /<dir>/<filename>/preview.
+func (s *Server) previewTarget(dir, name string) (string, bool) {
+	return s.suffixTarget(dir, name, previewPathSuffix)
+}
+
+// isMarkdown reports whether meta holds Markdown.
+func isMarkdown(meta FileMeta) bool {
+	mediaType, _, _ := mime.ParseMediaType(meta.contentType())
+	ext := strings.ToLower(path.Ext(meta.Name))
+	return mediaType == "text/markdown" || ext == ".md" || ext == ".markdown"
+}
+
+// previewable reports whether meta may be rendered in the browser. Files
+// limited in downloads are left out, a preview would give the content away
+// without counting a download.
+func previewable(meta FileMeta) bool {
+	if meta.Once || meta.MaxDownloads > 0 {
+		return false
+	}
+	_, known := syntaxFor(fileLanguage(meta.Name))
+	return isMarkdown(meta) || textContentType(meta.contentType()) || known
+}
+
+// servePreview answers dir/name rendered as HTML: Markdown is converted and
+// stripped of raw HTML, other text is shown highlighted when its language
+// is known.
+func (s *Server) servePreview(c echo.Context, dir, name string) error {
+	meta, _ := s.index.get(dir, name)
+	if s.hiddenDropShare(c, dir) || !previewable(meta) {
+		return fail(c, http.StatusNotFound, "No preview for this file")
+	}
+	if meta.expired(time.Now()) {
+		return fail(c, http.StatusGone, "File has expired")
+	}
+	if meta.Pending {
+		return s.tooEarly(c, meta)
+	}
+	noteFile(c, meta)
+	if meta.PasswordHash != "" && !checkPassword(c, meta) {
+		return passwordRequired(c, meta)
+	}
+	if meta.Size > maxPreviewSize {
+		return fail(c, http.StatusRequestEntityTooLarge, "File is too large to preview, download it instead")
+	}
+	src, err := s.readText(c, meta)
+	if errors.Is(err, errNotText) {
+		return fail(c, http.StatusUnsupportedMediaType, "File is not text, download it instead")
+	}
+	if err != nil {
+		log.Printf("Failed to read %s/%s for preview: %v\n", dir, name, err)
+		return fail(c, http.StatusInternalServerError, "Failed to read file")
+	}
+
+	markdown := isMarkdown(meta)
+	var content template.HTML
+	if markdown {
+		content = renderMarkdown(src)
+	} else {
+		content = template.HTML(highlight(string(src), fileLanguage(name)))
+	}
+	// The link of a paste is this page, its content is served at /raw.
+	downloadURL := s.downloadURL(c, dir, name)
+	if meta.Paste {
+		downloadURL = s.rawURL(c, meta)
+	}
+	var page bytes.Buffer
+	err = previewPage.Execute(&page, struct {
+		Name        string
+		DownloadURL string
+		Raw         bool
+		Markdown    bool
+		Content     template.HTML
+	}{meta.displayName(), downloadURL, meta.Paste, markdown, content})
+	if err != nil {
+		return err
+	}
+	c.Response().Header().Set("Content-Security-Policy", previewCSP)
+	c.Response().Header().Set("X-Content-Type-Options", "nosniff")
+	return c.HTMLBlob(http.StatusOK, page.Bytes())
+}
+
+// readText reads the decoded content of meta, refusing binary files.
+func (s *Server) readText(c echo.Context, meta FileMeta) ([]byte, error) {
+	obj, err := s.storage.Get(c.Request().Context(), meta.key())
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Content.Close()
+	content, err := s.decodedReader(obj.Content, meta)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	src, err := io.ReadAll(io.LimitReader(content, maxPreviewSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(src) > maxPreviewSize || bytes.IndexByte(src, 0) >= 0 {
+		return nil, errNotText
+	}
+	return src, nil
+}
+
+// renderMarkdown converts src to HTML. Raw HTML is dropped, links are
+// limited to safe protocols and fenced code blocks are highlighted.
+func renderMarkdown(src []byte) template.HTML {
+	renderer := &markdownRenderer{blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{
+		Flags: blackfriday.CommonHTMLFlags | blackfriday.SkipHTML | blackfriday.Safelink |
+			blackfriday.NofollowLinks | blackfriday.NoreferrerLinks | blackfriday.HrefTargetBlank,
+	})}
+	return template.HTML(blackfriday.Run(src, blackfriday.WithRenderer(renderer),
+		blackfriday.WithExtensions(blackfriday.CommonExtensions)))
+}
+
+// markdownRenderer is blackfriday's HTML renderer with highlighted code
+// blocks.
+type markdownRenderer struct {
+	*blackfriday.HTMLRenderer
+}
+
+func (r *markdownRenderer) RenderNode(w io.Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	if node.Type != blackfriday.CodeBlock {
+		return r.HTMLRenderer.RenderNode(w, node, entering)
+	}
+	language, _, _ := strings.Cut(string(node.Info), " ")
+	io.WriteString(w, "<pre><code>")
+	io.WriteString(w, highlight(string(node.Literal), language))
+	io.WriteString(w, "</code></pre>\n")
+	return blackfriday.GoToNext
+}
@@ -0,0 +1,64 @@
+package simpleserver
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreviewRendersSanitizedMarkdown(t *testing.T) {
+	s := newTestServer(t, Config{})
+	note := "# Notes\n\n<script>alert(1)</script>\n\n[bad](javascript:alert(1)) [good](https://example.com)\n\n```go\nfunc main() {} // entry\n```\n"
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.md", strings.NewReader(note)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, downloadURLs(t, rec.Body.String())[0]+"/preview", nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Contains(t, rec.Header().Get("Content-Type"), "text/html")
+	require.Equal(t, previewCSP, rec.Header().Get("Content-Security-Policy"))
+	body := rec.Body.String()
+	require.Contains(t, body, "<h1>Notes</h1>")
+	require.NotContains(t, body, "<script>")
+	require.NotContains(t, body, `href="javascript:`)
+	require.Contains(t, body, `href="https://example.com"`)
+	require.Contains(t, body, `<span class="k">func</span>`)
+	require.Contains(t, body, `<span class="c">// entry</span>`)
+}
+
+func TestPreviewHighlightsCode(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/run.py", strings.NewReader("def run():\n    return \"<done>\" # 42\n")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, downloadURLs(t, rec.Body.String())[0]+"/preview", nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	body := rec.Body.String()
+	require.Contains(t, body, `<span class="k">def</span> run()`)
+	require.Contains(t, body, `<span class="s">&#34;&lt;done&gt;&#34;</span>`)
+	require.Contains(t, body, `<span class="c"># 42</span>`)
+}
+
+func TestPreviewRejectsBinaryAndChecksPassword(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/data.txt", bytes.NewReader([]byte("a\x00b"))))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Equal(t, http.StatusUnsupportedMediaType, serve(s, httptest.NewRequest(http.MethodGet, downloadURLs(t, rec.Body.String())[0]+"/preview", nil)).Code)
+
+	rec = serve(s, httptest.NewRequest(http.MethodPut, "/photo.png", bytes.NewReader(gradientPNG(t, 4, 4))))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Equal(t, http.StatusNotFound, serve(s, httptest.NewRequest(http.MethodGet, downloadURLs(t, rec.Body.String())[0]+"/preview", nil)).Code)
+
+	req := httptest.NewRequest(http.MethodPut, "/secret.txt", strings.NewReader("hidden"))
+	req.Header.Set(passwordHeader, "secret")
+	rec = serve(s, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	url := downloadURLs(t, rec.Body.String())[0] + "/preview"
+	require.Equal(t, http.StatusUnauthorized, serve(s, httptest.NewRequest(http.MethodGet, url, nil)).Code)
+	rec = serve(s, httptest.NewRequest(http.MethodGet, url+"?password=secret", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "hidden")
+}
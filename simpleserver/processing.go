@@ -0,0 +1,96 @@
+package simpleserver
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const defaultProcessingWorkers = 2
+
+// processor inspects a freshly stored upload before it becomes downloadable.
+// content reads the bytes as uploaded. Returning an error discards the
+// upload.
+type processor func(ctx context.Context, meta FileMeta, content io.Reader) error
+
+// processingEnabled reports whether uploads go through the worker pool
+// before they can be downloaded.
+func (s *Server) processingEnabled() bool {
+	return s.config.ProcessingDelay > 0 || len(s.processors) > 0
+}
+
+// startProcessing launches the worker pool and requeues uploads that were
+// still pending when the server last stopped.
+func (s *Server) startProcessing() {
+	if !s.processingEnabled() {
+		return
+	}
+	workers := s.config.ProcessingWorkers
+	if workers <= 0 {
+		workers = defaultProcessingWorkers
+	}
+	for i := 0; i < workers; i++ {
+		go s.processLoop()
+	}
+	for _, meta := range s.index.pending() {
+		s.enqueueProcessing(meta)
+	}
+}
+
+// enqueueProcessing hands meta to the pool without blocking the caller.
+func (s *Server) enqueueProcessing(meta FileMeta) {
+	go func() { s.processQueue <- meta }()
+}
+
+func (s *Server) processLoop() {
+	for meta := range s.processQueue {
+		s.process(meta)
+	}
+}
+
+func (s *Server) process(meta FileMeta) {
+	if delay := s.config.ProcessingDelay - time.Since(meta.CreatedAt); delay > 0 {
+		time.Sleep(delay)
+	}
+	for _, p := range s.processors {
+		if err := s.runProcessor(p, meta); err != nil {
+			log.Printf("Discarding %s/%s after processing failed: %v\n", meta.Dir, meta.Name, err)
+			s.deleteFile(meta)
+			return
+		}
+	}
+	meta.Pending = false
+	if err := s.index.put(meta); err != nil {
+		log.Printf("Failed to mark %s/%s as processed: %v\n", meta.Dir, meta.Name, err)
+	}
+}
+
+func (s *Server) runProcessor(p processor, meta FileMeta) error {
+	ctx := context.Background()
+	obj, err := s.storage.Get(ctx, meta.key())
+	if err != nil {
+		return err
+	}
+	defer obj.Content.Close()
+	content, err := s.decodedReader(obj.Content, meta)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	return p(ctx, meta, content)
+}
+
+// tooEarly answers downloads of uploads that are still being processed.
+func (s *Server) tooEarly(c echo.Context, meta FileMeta) error {
+	retry := time.Second
+	if remaining := time.Until(meta.CreatedAt.Add(s.config.ProcessingDelay)); remaining > retry {
+		retry = remaining.Round(time.Second)
+	}
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int(retry.Seconds())))
+	return fail(c, http.StatusTooEarly, "File is still being processed, try again later")
+}
@@ -0,0 +1,92 @@
+package simpleserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadTooEarlyWhileProcessing(t *testing.T) {
+	s := New(Config{UploadDir: t.TempDir()})
+	release := make(chan struct{})
+	s.processors = []processor{func(ctx context.Context, meta FileMeta, content io.Reader) error {
+		<-release
+		return nil
+	}}
+	require.NoError(t, s.startup())
+
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/scan-me.txt", strings.NewReader("content")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	fileURL := downloadURLs(t, rec.Body.String())[0]
+
+	rec = download(t, s, fileURL)
+	require.Equal(t, http.StatusTooEarly, rec.Code)
+	require.NotEmpty(t, rec.Header().Get("Retry-After"))
+
+	close(release)
+	require.Eventually(t, func() bool {
+		return download(t, s, fileURL).Code == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, "content", download(t, s, fileURL).Body.String())
+}
+
+func TestProcessingDelay(t *testing.T) {
+	s := newTestServer(t, Config{ProcessingDelay: 200 * time.Millisecond})
+
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/later.txt", strings.NewReader("later")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	fileURL := downloadURLs(t, rec.Body.String())[0]
+	require.Equal(t, http.StatusTooEarly, download(t, s, fileURL).Code)
+
+	require.Eventually(t, func() bool {
+		return download(t, s, fileURL).Code == http.StatusOK
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestRejectedByProcessor(t *testing.T) {
+	s := New(Config{UploadDir: t.TempDir()})
+	s.processors = []processor{func(ctx context.Context, meta FileMeta, content io.Reader) error {
+		return errors.New("rejected")
+	}}
+	require.NoError(t, s.startup())
+
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/bad.txt", strings.NewReader("bad")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	fileURL := downloadURLs(t, rec.Body.String())[0]
+
+	require.Eventually(t, func() bool {
+		return download(t, s, fileURL).Code == http.StatusNotFound
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Zero(t, s.index.len())
+}
+
+func TestPendingUploadsResumeAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	s := New(Config{UploadDir: dir})
+	block := make(chan struct{})
+	t.Cleanup(func() { close(block) })
+	s.processors = []processor{func(ctx context.Context, meta FileMeta, content io.Reader) error {
+		<-block
+		return errors.New("server stopped")
+	}}
+	require.NoError(t, s.startup())
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/stuck.txt", strings.NewReader("stuck")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	fileURL := downloadURLs(t, rec.Body.String())[0]
+
+	restarted := New(Config{UploadDir: dir})
+	restarted.processors = []processor{func(ctx context.Context, meta FileMeta, content io.Reader) error {
+		return nil
+	}}
+	require.NoError(t, restarted.startup())
+	require.Eventually(t, func() bool {
+		return download(t, restarted, fileURL).Code == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+}
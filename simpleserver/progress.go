@@ -0,0 +1,245 @@
+package simpleserver
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+// Clients that want to follow a transfer name it with the X-Transfer-Id
+// header or the transfer_id query parameter, and subscribe to
+// /ws/progress/<id> over a WebSocket before or while it runs.
+const (
+	progressPath       = "/ws/progress"
+	transferIDHeader   = "X-Transfer-Id"
+	transferIDParam    = "transfer_id"
+	minTransferIDLen   = 8
+	progressInterval   = 250 * time.Millisecond
+	progressBufferSize = 16
+)
+
+// progressEvent reports how far a transfer got. Total is -1 while the size
+// is unknown, and so is ETASeconds.
+type progressEvent struct {
+	ID             string  `json:"id"`
+	Direction      string  `json:"direction"`
+	Bytes          int64   `json:"bytes"`
+	Total          int64   `json:"total"`
+	BytesPerSecond float64 `json:"bytes_per_second"`
+	ETASeconds     float64 `json:"eta_seconds"`
+	Done           bool    `json:"done,omitempty"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// progressHub fans the progress events of every transfer out to the
+// WebSockets subscribed to it. Subscribers that fall behind miss events
+// instead of slowing the transfer down.
+type progressHub struct {
+	mu   sync.Mutex
+	subs map[string]map[chan progressEvent]struct{}
+}
+
+func newProgressHub() *progressHub {
+	return &progressHub{subs: make(map[string]map[chan progressEvent]struct{})}
+}
+
+func (h *progressHub) subscribe(id string) (<-chan progressEvent, func()) {
+	ch := make(chan progressEvent, progressBufferSize)
+	h.mu.Lock()
+	if h.subs[id] == nil {
+		h.subs[id] = make(map[chan progressEvent]struct{})
+	}
+	h.subs[id][ch] = struct{}{}
+	h.mu.Unlock()
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subs[id], ch)
+		if len(h.subs[id]) == 0 {
+			delete(h.subs, id)
+		}
+		h.mu.Unlock()
+	}
+}
+
+func (h *progressHub) publish(event progressEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[event.ID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// transferID returns the id the client named the transfer with, if any.
+// Short ids are ignored, as anyone guessing one could watch the transfer.
+func transferID(c echo.Context) string {
+	id := c.Request().Header.Get(transferIDHeader)
+	if id == "" {
+		id = c.QueryParam(transferIDParam)
+	}
+	if len(id) < minTransferIDLen || !validSlug(id) {
+		return ""
+	}
+	return id
+}
+
+// trackProgress publishes the progress of uploads and downloads named with
+// a transfer id: the request body read for uploads, the response written
+// for downloads.
+func (s *Server) trackProgress(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id := transferID(c)
+		if id == "" {
+			return next(c)
+		}
+		req := c.Request()
+		tracker := &progressTracker{hub: s.progress, event: progressEvent{ID: id, Total: -1}, start: time.Now()}
+		switch req.Method {
+		case http.MethodPut, http.MethodPost:
+			tracker.event.Direction = "upload"
+			tracker.event.Total = req.ContentLength
+			req.Body = &progressReader{ReadCloser: req.Body, tracker: tracker}
+		case http.MethodGet:
+			tracker.event.Direction = "download"
+			c.Response().Writer = &progressWriter{ResponseWriter: c.Response().Writer, tracker: tracker}
+		default:
+			return next(c)
+		}
+		err := next(c)
+		status := c.Response().Status
+		if he, ok := err.(*echo.HTTPError); ok {
+			status = he.Code
+		}
+		if status >= http.StatusBadRequest {
+			tracker.finish(http.StatusText(status))
+		} else {
+			tracker.finish("")
+		}
+		return err
+	}
+}
+
+// progressTracker counts the bytes of a transfer and publishes them at
+// most every progressInterval.
+type progressTracker struct {
+	hub   *progressHub
+	mu    sync.Mutex
+	event progressEvent
+	start time.Time
+	last  time.Time
+}
+
+func (t *progressTracker) add(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.event.Bytes += int64(n)
+	if now := time.Now(); now.Sub(t.last) >= progressInterval {
+		t.last = now
+		t.publish(now)
+	}
+}
+
+func (t *progressTracker) finish(errText string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.event.Done, t.event.Error = true, errText
+	t.publish(time.Now())
+}
+
+func (t *progressTracker) publish(now time.Time) {
+	event := t.event
+	if elapsed := now.Sub(t.start).Seconds(); elapsed > 0 {
+		event.BytesPerSecond = float64(event.Bytes) / elapsed
+	}
+	switch {
+	case event.Done:
+	case event.Total < 0 || event.BytesPerSecond == 0:
+		event.ETASeconds = -1
+	default:
+		event.ETASeconds = float64(max(event.Total-event.Bytes, 0)) / event.BytesPerSecond
+	}
+	t.hub.publish(event)
+}
+
+type progressReader struct {
+	io.ReadCloser
+	tracker *progressTracker
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.tracker.add(n)
+	return n, err
+}
+
+// progressWriter takes the total from the Content-Length of the response.
+type progressWriter struct {
+	http.ResponseWriter
+	tracker    *progressTracker
+	sawHeaders bool
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	if !w.sawHeaders {
+		w.sawHeaders = true
+		if size, err := strconv.ParseInt(w.Header().Get(echo.HeaderContentLength), 10, 64); err == nil {
+			w.tracker.mu.Lock()
+			w.tracker.event.Total = size
+			w.tracker.mu.Unlock()
+		}
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.tracker.add(n)
+	return n, err
+}
+
+func (w *progressWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+var progressUpgrader = websocket.Upgrader{}
+
+// handleProgress streams the progress events of a transfer as JSON
+// messages until it is done or the client goes away.
+func (s *Server) handleProgress(c echo.Context) error {
+	id := c.Param("id")
+	if len(id) < minTransferIDLen || !validSlug(id) {
+		return fail(c, http.StatusBadRequest, "Invalid transfer id")
+	}
+	events, cancel := s.progress.subscribe(id)
+	defer cancel()
+	conn, err := progressUpgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		// The upgrader already replied with an error.
+		return nil
+	}
+	defer conn.Close()
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case event := <-events:
+			if err := conn.WriteJSON(event); err != nil || event.Done {
+				return nil
+			}
+		case <-closed:
+			return nil
+		}
+	}
+}
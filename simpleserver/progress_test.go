@@ -0,0 +1,85 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func subscribeProgress(t *testing.T, ts *httptest.Server, id string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+progressPath+"/"+id, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// lastProgress reads events until the one marking the transfer done.
+func lastProgress(t *testing.T, conn *websocket.Conn) progressEvent {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var event progressEvent
+		require.NoError(t, conn.ReadJSON(&event))
+		if event.Done {
+			return event
+		}
+	}
+}
+
+func TestProgressOfUploadAndDownload(t *testing.T) {
+	s := newTestServer(t, Config{})
+	ts := httptest.NewServer(s.newRouter())
+	defer ts.Close()
+
+	conn := subscribeProgress(t, ts, "transfer-1")
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/notes.txt", strings.NewReader("meeting notes"))
+	require.NoError(t, err)
+	req.Header.Set(transferIDHeader, "transfer-1")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	event := lastProgress(t, conn)
+	require.Equal(t, "upload", event.Direction)
+	require.Equal(t, int64(len("meeting notes")), event.Bytes)
+	require.Equal(t, event.Bytes, event.Total)
+	require.Empty(t, event.Error)
+
+	meta := findMeta(t, s, "notes.txt")
+	conn = subscribeProgress(t, ts, "transfer-2")
+	resp, err = http.Get(ts.URL + "/" + meta.Dir + "/notes.txt?" + transferIDParam + "=transfer-2")
+	require.NoError(t, err)
+	resp.Body.Close()
+	event = lastProgress(t, conn)
+	require.Equal(t, "download", event.Direction)
+	require.Equal(t, int64(len("meeting notes")), event.Bytes)
+
+	conn = subscribeProgress(t, ts, "transfer-3")
+	resp, err = http.Get(ts.URL + "/" + meta.Dir + "/missing.txt?" + transferIDParam + "=transfer-3")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusText(http.StatusNotFound), lastProgress(t, conn).Error)
+}
+
+func TestProgressRejectsShortIDs(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodGet, progressPath+"/abc", nil))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestProgressETA(t *testing.T) {
+	hub := newProgressHub()
+	events, cancel := hub.subscribe("transfer-1")
+	defer cancel()
+	tracker := &progressTracker{hub: hub, event: progressEvent{ID: "transfer-1", Total: 100}, start: time.Now().Add(-time.Second)}
+	tracker.add(25)
+	event := <-events
+	require.Equal(t, int64(25), event.Bytes)
+	require.InDelta(t, 3, event.ETASeconds, 0.5)
+}
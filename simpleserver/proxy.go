@@ -0,0 +1,73 @@
+package simpleserver
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// proxySharePrefix is where the file share lives when every other path
+	// goes to Config.ProxyTarget.
+	proxySharePrefix = "/files"
+	// basePathKey holds the prefix a request was stripped of, which the
+	// links handed to clients start with.
+	basePathKey = "simpleserver.basePath"
+)
+
+// parseProxyTarget validates a Config.ProxyTarget.
+func parseProxyTarget(target string) (*url.URL, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("proxy target %q is not an http or https URL", target)
+	}
+	return u, nil
+}
+
+// proxyUpstream forwards every request outside proxySharePrefix to target,
+// WebSocket upgrades included, before the router sees it. Requests for the
+// share are stripped of the prefix and routed as usual.
+func proxyUpstream(target *url.URL) echo.MiddlewareFunc {
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.SetXForwarded()
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("Failed to proxy %s to %s: %v\n", r.URL.Path, target, err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			r := c.Request()
+			rest, ok := strings.CutPrefix(r.URL.Path, proxySharePrefix)
+			if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+				proxy.ServeHTTP(c.Response(), r)
+				return nil
+			}
+			if rest == "" {
+				rest = "/"
+			}
+			r.URL.Path = rest
+			r.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, proxySharePrefix)
+			c.Set(basePathKey, proxySharePrefix)
+			return next(c)
+		}
+	}
+}
+
+// basePath is the prefix the share is served under, empty unless requests
+// are proxied.
+func basePath(c echo.Context) string {
+	prefix, _ := c.Get(basePathKey).(string)
+	return prefix
+}
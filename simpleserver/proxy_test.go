@@ -0,0 +1,104 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// startProxied serves s in front of an upstream app that answers with the
+// path it was asked for and echoes WebSocket messages.
+func startProxied(t *testing.T, config Config) *httptest.Server {
+	t.Helper()
+	var upgrader websocket.Upgrader
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if websocket.IsWebSocketUpgrade(r) {
+			conn, err := upgrader.Upgrade(w, r, nil)
+			require.NoError(t, err)
+			defer conn.Close()
+			kind, message, err := conn.ReadMessage()
+			require.NoError(t, err)
+			require.NoError(t, conn.WriteMessage(kind, append([]byte("echo: "), message...)))
+			return
+		}
+		w.Header().Set("X-Upstream-Host", r.Header.Get("X-Forwarded-Host"))
+		io.WriteString(w, "app "+r.URL.Path)
+	}))
+	t.Cleanup(upstream.Close)
+	config.ProxyTarget = upstream.URL
+	ts := httptest.NewServer(newTestServer(t, config).newRouter())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestProxyForwardsAppRoutes(t *testing.T) {
+	ts := startProxied(t, Config{})
+	for _, target := range []string{"/", "/dashboard/", "/filesystem"} {
+		resp, err := http.Get(ts.URL + target)
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "app "+target, string(body))
+		require.Equal(t, strings.TrimPrefix(ts.URL, "http://"), resp.Header.Get("X-Upstream-Host"))
+	}
+}
+
+func TestProxyServesShareUnderFiles(t *testing.T) {
+	ts := startProxied(t, Config{})
+	req, err := http.NewRequest(http.MethodPut, ts.URL+proxySharePrefix+"/notes.txt", strings.NewReader("hello"))
+	require.NoError(t, err)
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	var uploaded uploadResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&uploaded))
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, ts.URL+proxySharePrefix+"/"+uploaded.ID+"/notes.txt", uploaded.URL)
+
+	resp, err = http.Get(uploaded.URL)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "hello", string(body))
+
+	resp, err = http.Get(ts.URL + proxySharePrefix + "/")
+	require.NoError(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Contains(t, string(body), "<h1>Upload files</h1>")
+}
+
+func TestProxyForwardsWebSockets(t *testing.T) {
+	ts := startProxied(t, Config{})
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/socket", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("ping")))
+	_, message, err := conn.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, "echo: ping", string(message))
+}
+
+func TestProxyUnreachableUpstream(t *testing.T) {
+	s := newTestServer(t, Config{ProxyTarget: "http://127.0.0.1:1"})
+	rec := serve(s, httptest.NewRequest(http.MethodGet, "/app", nil))
+	require.Equal(t, http.StatusBadGateway, rec.Code)
+}
+
+func TestParseProxyTarget(t *testing.T) {
+	_, err := parseProxyTarget("http://localhost:3000")
+	require.NoError(t, err)
+	for _, target := range []string{"localhost:3000", "ftp://localhost", "http://"} {
+		_, err := parseProxyTarget(target)
+		require.Error(t, err, target)
+	}
+}
@@ -0,0 +1,529 @@
+package simpleserver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// This file implements just enough of ISO/IEC 18004 to encode a download
+// link: byte mode, error correction level M and every version up to 40.
+
+const (
+	qrQuietZone  = 4
+	qrMinVersion = 1
+	qrMaxVersion = 40
+)
+
+var errQRTooLong = errors.New("too long for a QR code")
+
+// qrECCPerBlock and qrBlocks give the error correction codewords per block
+// and the number of blocks for level M, indexed by version.
+var (
+	qrECCPerBlock = [qrMaxVersion + 1]int{0,
+		10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26,
+		26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28}
+	qrBlocks = [qrMaxVersion + 1]int{0,
+		1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16,
+		17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49}
+)
+
+// qrCode is a square of modules, true meaning dark. isFunction marks the
+// finder, timing, alignment, format and version modules that data and masks
+// leave alone.
+type qrCode struct {
+	size       int
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+// encodeQR encodes data in the smallest version that holds it.
+func encodeQR(data []byte) (*qrCode, error) {
+	return encodeQRWithMask(data, -1)
+}
+
+// encodeQRWithMask is encodeQR with a fixed mask, or the one scoring the
+// lowest penalty when mask is negative.
+func encodeQRWithMask(data []byte, mask int) (*qrCode, error) {
+	version := qrMinVersion
+	for ; ; version++ {
+		if version > qrMaxVersion {
+			return nil, errQRTooLong
+		}
+		if 4+qrCountBits(version)+8*len(data) <= 8*qrDataCodewords(version) {
+			break
+		}
+	}
+
+	var bits qrBits
+	bits.append(0x4, 4) // byte mode
+	bits.append(len(data), qrCountBits(version))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	capacity := 8 * qrDataCodewords(version)
+	bits.append(0, min(4, capacity-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+	codewords := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		codewords[i>>3] |= byte(bit) << (7 - i&7)
+	}
+
+	qr := newQRCode(version)
+	qr.drawCodewords(qrAddECC(codewords, version))
+	if mask < 0 {
+		bestPenalty := -1
+		for candidate := 0; candidate < 8; candidate++ {
+			qr.applyMask(candidate)
+			qr.drawFormatBits(candidate)
+			if penalty := qr.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+				mask, bestPenalty = candidate, penalty
+			}
+			qr.applyMask(candidate) // masks are their own inverse
+		}
+	}
+	qr.applyMask(mask)
+	qr.drawFormatBits(mask)
+	return qr, nil
+}
+
+type qrBits []byte
+
+func (b *qrBits) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		*b = append(*b, byte(value>>i&1))
+	}
+}
+
+func qrCountBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// qrRawModules is the number of modules left for data and error correction
+// once the function patterns are drawn.
+func qrRawModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		result -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+func qrDataCodewords(version int) int {
+	return qrRawModules(version)/8 - qrECCPerBlock[version]*qrBlocks[version]
+}
+
+// qrAddECC splits data into blocks, appends their Reed-Solomon codewords and
+// interleaves the result.
+func qrAddECC(data []byte, version int) []byte {
+	numBlocks, eccLen := qrBlocks[version], qrECCPerBlock[version]
+	rawCodewords := qrRawModules(version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	divisor := rsDivisor(eccLen)
+	blocks := make([][]byte, numBlocks)
+	for i, k := 0, 0; i < numBlocks; i++ {
+		dataLen := shortBlockLen - eccLen
+		if i >= numShortBlocks {
+			dataLen++
+		}
+		block := append([]byte{}, data[k:k+dataLen]...)
+		k += dataLen
+		if i < numShortBlocks {
+			// Placeholder keeping all blocks the same length, skipped
+			// when interleaving.
+			block = append(block, 0)
+		}
+		blocks[i] = append(block, rsRemainder(data[k-dataLen:k], divisor)...)
+	}
+
+	result := make([]byte, 0, rawCodewords)
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			if i != shortBlockLen-eccLen || j >= numShortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// gfMul multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMul(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+// rsDivisor returns the generator polynomial of the given degree, highest
+// coefficient first and the leading 1 omitted.
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMul(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMul(root, 0x02)
+	}
+	return result
+}
+
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coef := range divisor {
+			result[i] ^= gfMul(coef, factor)
+		}
+	}
+	return result
+}
+
+func newQRCode(version int) *qrCode {
+	size := version*4 + 17
+	qr := &qrCode{size: size, modules: make([][]bool, size), isFunction: make([][]bool, size)}
+	for y := range qr.modules {
+		qr.modules[y] = make([]bool, size)
+		qr.isFunction[y] = make([]bool, size)
+	}
+
+	for i := 0; i < size; i++ {
+		qr.setFunction(6, i, i%2 == 0)
+		qr.setFunction(i, 6, i%2 == 0)
+	}
+	qr.drawFinder(3, 3)
+	qr.drawFinder(size-4, 3)
+	qr.drawFinder(3, size-4)
+
+	positions := qrAlignmentPositions(version)
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// The corners taken by finder patterns get none.
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					qr.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// Reserve the format modules, they are drawn once the mask is known.
+	qr.drawFormatBits(0)
+	if version >= 7 {
+		rem := version
+		for i := 0; i < 12; i++ {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+		}
+		bits := version<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := bits>>i&1 != 0
+			a, b := size-11+i%3, i/3
+			qr.setFunction(a, b, dark)
+			qr.setFunction(b, a, dark)
+		}
+	}
+	return qr
+}
+
+func qrAlignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	numAlign := version/7 + 2
+	step := (version*8 + numAlign*3 + 5) / (numAlign*4 - 4) * 2
+	positions := make([]int, numAlign)
+	positions[0] = 6
+	for i, pos := numAlign-1, version*4+10; i > 0; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+func (qr *qrCode) setFunction(x, y int, dark bool) {
+	qr.modules[y][x] = dark
+	qr.isFunction[y][x] = true
+}
+
+func (qr *qrCode) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= qr.size || yy < 0 || yy >= qr.size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			qr.setFunction(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+// drawFormatBits draws both copies of the level M format information for
+// mask.
+func (qr *qrCode) drawFormatBits(mask int) {
+	data := mask // level M is 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 != 0 }
+
+	for i := 0; i <= 5; i++ {
+		qr.setFunction(8, i, bit(i))
+	}
+	qr.setFunction(8, 7, bit(6))
+	qr.setFunction(8, 8, bit(7))
+	qr.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		qr.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		qr.setFunction(qr.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		qr.setFunction(8, qr.size-15+i, bit(i))
+	}
+	qr.setFunction(8, qr.size-8, true)
+}
+
+// drawCodewords places data in the zigzag of two module wide columns, from
+// the bottom right corner.
+func (qr *qrCode) drawCodewords(data []byte) {
+	i := 0
+	for right := qr.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < qr.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = qr.size - 1 - vert
+				}
+				if !qr.isFunction[y][x] && i < len(data)*8 {
+					qr.modules[y][x] = data[i>>3]>>(7-i&7)&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (qr *qrCode) applyMask(mask int) {
+	for y := 0; y < qr.size; y++ {
+		for x := 0; x < qr.size; x++ {
+			if qr.isFunction[y][x] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			qr.modules[y][x] = qr.modules[y][x] != invert
+		}
+	}
+}
+
+// penalty scores how hard the symbol is to scan, following the four rules
+// of the specification. The mask with the lowest score is used.
+func (qr *qrCode) penalty() int {
+	score, dark := 0, 0
+	finderLike := [][]bool{
+		{true, false, true, true, true, false, true, false, false, false, false},
+		{false, false, false, false, true, false, true, true, true, false, true},
+	}
+	line := make([]bool, qr.size)
+	for pass := 0; pass < 2; pass++ {
+		for i := 0; i < qr.size; i++ {
+			for j := range line {
+				if pass == 0 {
+					line[j] = qr.modules[i][j]
+				} else {
+					line[j] = qr.modules[j][i]
+				}
+			}
+			run := 1
+			for j := 1; j <= qr.size; j++ {
+				if j < qr.size && line[j] == line[j-1] {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += 3 + run - 5
+				}
+				run = 1
+			}
+			for j := 0; j+11 <= qr.size; j++ {
+				for _, pattern := range finderLike {
+					if matchModules(line[j:j+11], pattern) {
+						score += 40
+					}
+				}
+			}
+		}
+	}
+	for y := 0; y < qr.size; y++ {
+		for x := 0; x < qr.size; x++ {
+			if qr.modules[y][x] {
+				dark++
+			}
+			if x+1 < qr.size && y+1 < qr.size {
+				c := qr.modules[y][x]
+				if c == qr.modules[y][x+1] && c == qr.modules[y+1][x] && c == qr.modules[y+1][x+1] {
+					score += 3
+				}
+			}
+		}
+	}
+	total := qr.size * qr.size
+	score += ((abs(dark*20-total*10)+total-1)/total - 1) * 10
+	return score
+}
+
+func matchModules(a, b []bool) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// image renders the symbol with scale pixels per module and the quiet zone
+// scanners expect around it.
+func (qr *qrCode) image(scale int) *image.Gray {
+	side := (qr.size + 2*qrQuietZone) * scale
+	img := image.NewGray(image.Rect(0, 0, side, side))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	for y, row := range qr.modules {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetGray((x+qrQuietZone)*scale+dx, (y+qrQuietZone)*scale+dy, color.Gray{})
+				}
+			}
+		}
+	}
+	return img
+}
+
+// svg renders the symbol as a single path, one unit per module.
+func (qr *qrCode) svg() string {
+	side := qr.size + 2*qrQuietZone
+	var path strings.Builder
+	for y, row := range qr.modules {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&path, "M%d,%dh1v1h-1z", x+qrQuietZone, y+qrQuietZone)
+			}
+		}
+	}
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="100%%" height="100%%" fill="#fff"/><path fill="#000" d="%s"/></svg>`, side, side, path.String())
+}
+
+const (
+	qrPathSuffix = "qr"
+	// qrScale is the size in pixels of a module in PNG QR codes.
+	qrScale = 8
+)
+
+// qrTarget reports whether name asks for the QR code of a stored file, as
+// GET /:dir/:filename/qr does. A file actually stored under that name wins.
+func (s *Server) qrTarget(dir, name string) (string, bool) {
+	if !s.config.EnableQR {
+		return "", false
+	}
+	return s.suffixTarget(dir, name, qrPathSuffix)
+}
+
+// serveQR answers the QR code encoding the download link of dir/name, as
+// PNG or with ?format=svg as SVG.
+func (s *Server) serveQR(c echo.Context, dir, name string) error {
+	meta, _ := s.index.get(dir, name)
+	if meta.expired(time.Now()) {
+		return fail(c, http.StatusGone, "File has expired")
+	}
+	format := c.QueryParam("format")
+	if format != "" && format != "png" && format != "svg" {
+		return fail(c, http.StatusBadRequest, "Unsupported QR code format, use png or svg")
+	}
+	qr, err := encodeQR([]byte(s.downloadURL(c, dir, name)))
+	if err != nil {
+		return fail(c, http.StatusBadRequest, "Download link is "+err.Error())
+	}
+	if format == "svg" {
+		return c.Blob(http.StatusOK, "image/svg+xml", []byte(qr.svg()))
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, qr.image(qrScale)); err != nil {
+		return err
+	}
+	return c.Blob(http.StatusOK, "image/png", buf.Bytes())
+}
+
+// qrURL is where the QR code of a stored file is served.
+func (s *Server) qrURL(c echo.Context, meta FileMeta) string {
+	return s.downloadURL(c, meta.Dir, meta.Name) + "/" + qrPathSuffix
+}
@@ -0,0 +1,83 @@
+package simpleserver
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQRCodeEndpoint(t *testing.T) {
+	s := newTestServer(t, Config{EnableQR: true})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/report.pdf", strings.NewReader("%PDF-1.4")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	meta := findMeta(t, s, "report.pdf")
+	qrURL := "http://example.com/" + meta.Dir + "/report.pdf/qr"
+	require.Contains(t, rec.Body.String(), "QR code: "+qrURL+"\n")
+
+	rec = download(t, s, qrURL)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+	img, err := png.Decode(bytes.NewReader(rec.Body.Bytes()))
+	require.NoError(t, err)
+	qr, err := encodeQR([]byte("http://example.com/" + meta.Dir + "/report.pdf"))
+	require.NoError(t, err)
+	require.Equal(t, (qr.size+2*qrQuietZone)*qrScale, img.Bounds().Dx())
+
+	rec = download(t, s, qrURL+"?format=svg")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "image/svg+xml", rec.Header().Get("Content-Type"))
+	require.True(t, strings.HasPrefix(rec.Body.String(), "<svg "))
+
+	require.Equal(t, http.StatusBadRequest, download(t, s, qrURL+"?format=gif").Code)
+	require.Equal(t, http.StatusNotFound, download(t, s, "http://example.com/"+meta.Dir+"/missing.pdf/qr").Code)
+
+	rec = serve(s, jsonRequest(httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("a"))))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Contains(t, rec.Body.String(), `"qr_url":"http://example.com/`)
+}
+
+func TestQRCodeDisabled(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/report.pdf", strings.NewReader("%PDF-1.4")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.NotContains(t, rec.Body.String(), "QR code")
+	meta := findMeta(t, s, "report.pdf")
+	require.Equal(t, http.StatusNotFound, download(t, s, "http://example.com/"+meta.Dir+"/report.pdf/qr").Code)
+}
+
+func TestQRCapacity(t *testing.T) {
+	require.Equal(t, 16, qrDataCodewords(1))
+	require.Equal(t, 216, qrDataCodewords(10))
+	require.Equal(t, 2334, qrDataCodewords(40))
+
+	qr, err := encodeQR(bytes.Repeat([]byte("a"), 2331))
+	require.NoError(t, err)
+	require.Equal(t, 177, qr.size)
+	_, err = encodeQR(bytes.Repeat([]byte("a"), 2332))
+	require.ErrorIs(t, err, errQRTooLong)
+}
+
+func TestReedSolomon(t *testing.T) {
+	// Version 1-M codewords of "HELLO WORLD" in alphanumeric mode.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	require.Equal(t, []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}, rsRemainder(data, rsDivisor(10)))
+}
+
+func TestQRFinderPatterns(t *testing.T) {
+	qr, err := encodeQR([]byte("hello"))
+	require.NoError(t, err)
+	require.Equal(t, 21, qr.size)
+	for _, corner := range [][2]int{{0, 0}, {qr.size - 7, 0}, {0, qr.size - 7}} {
+		for i := 0; i < 7; i++ {
+			require.True(t, qr.modules[corner[1]][corner[0]+i])
+			require.True(t, qr.modules[corner[1]+6][corner[0]+i])
+		}
+		require.False(t, qr.modules[corner[1]+1][corner[0]+1])
+		require.True(t, qr.modules[corner[1]+3][corner[0]+3])
+	}
+}
@@ -0,0 +1,79 @@
+package simpleserver
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errQuotaExceeded = errors.New("upload would exceed the storage quota")
+
+// storedBytes is the space meta takes in the storage backend.
+func (m FileMeta) storedBytes() int64 {
+	if m.storedVerbatim() {
+		return m.Size
+	}
+	return m.StoredSize
+}
+
+// storedBytes sums the space taken by every upload, counting the blob shared
+// by deduplicated uploads once.
+func (ix *metaIndex) storedBytes() int64 {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	var total int64
+	counted := make(map[string]bool)
+	for _, meta := range ix.files {
+		if meta.Blob != "" {
+			if counted[meta.Blob] {
+				continue
+			}
+			counted[meta.Blob] = true
+		}
+		total += meta.storedBytes()
+	}
+	return total
+}
+
+// oldest returns the upload stored first.
+func (ix *metaIndex) oldest() (FileMeta, bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	var oldest FileMeta
+	found := false
+	for _, meta := range ix.files {
+		if !found || meta.CreatedAt.Before(oldest.CreatedAt) {
+			oldest, found = meta, true
+		}
+	}
+	return oldest, found
+}
+
+// reserveQuota claims n bytes of the MaxTotalSize quota for an upload that is
+// about to be stored, until release is called once it is in the index. With
+// EvictOldest the oldest uploads are deleted until n bytes fit.
+func (s *Server) reserveQuota(n int64) (release func(), err error) {
+	if s.settings().MaxTotalSize <= 0 {
+		return func() {}, nil
+	}
+	limit := int64(s.settings().MaxTotalSize) << 20
+	if n > limit {
+		return nil, errQuotaExceeded
+	}
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+	for s.index.storedBytes()+s.quotaReserved+n > limit {
+		oldest, ok := s.index.oldest()
+		if !s.config.EvictOldest || !ok {
+			return nil, errQuotaExceeded
+		}
+		if err := s.deleteFile(oldest); err != nil {
+			return nil, fmt.Errorf("evict %s: %w", oldest.key(), err)
+		}
+	}
+	s.quotaReserved += n
+	return func() {
+		s.quotaMu.Lock()
+		s.quotaReserved -= n
+		s.quotaMu.Unlock()
+	}, nil
+}
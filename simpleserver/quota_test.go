@@ -0,0 +1,46 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func quotaUpload(s *Server, name string, size int) *httptest.ResponseRecorder {
+	return serve(s, httptest.NewRequest(http.MethodPut, "/"+name, strings.NewReader(strings.Repeat("x", size))))
+}
+
+func TestMaxTotalSize(t *testing.T) {
+	s := newTestServer(t, Config{MaxTotalSize: 1})
+
+	require.Equal(t, http.StatusCreated, quotaUpload(s, "a.bin", 600<<10).Code)
+	rec := quotaUpload(s, "b.bin", 600<<10)
+	require.Equal(t, http.StatusInsufficientStorage, rec.Code)
+	require.Equal(t, errorResponse{Code: codeQuotaExceeded, Message: errQuotaExceeded.Error()}, errorOf(t, rec.Body.String()))
+	require.Equal(t, 1, s.index.len())
+
+	require.Equal(t, http.StatusCreated, quotaUpload(s, "c.bin", 400<<10).Code)
+}
+
+func TestEvictOldest(t *testing.T) {
+	s := newTestServer(t, Config{MaxTotalSize: 1, EvictOldest: true})
+
+	rec := quotaUpload(s, "a.bin", 400<<10)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	first := downloadURLs(t, rec.Body.String())[0]
+	rec = quotaUpload(s, "b.bin", 400<<10)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	second := downloadURLs(t, rec.Body.String())[0]
+
+	require.Equal(t, http.StatusCreated, quotaUpload(s, "c.bin", 400<<10).Code)
+	require.Equal(t, http.StatusNotFound, download(t, s, first).Code)
+	require.Equal(t, http.StatusOK, download(t, s, second).Code)
+	require.Equal(t, 2, s.index.len())
+
+	// Nothing can make room for an upload larger than the quota.
+	require.Equal(t, http.StatusInsufficientStorage, quotaUpload(s, "huge.bin", 2<<20).Code)
+	require.Equal(t, 2, s.index.len())
+}
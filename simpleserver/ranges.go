@@ -0,0 +1,41 @@
+package simpleserver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const defaultMaxRanges = 10
+
+// countRanges returns how many byte ranges a Range header asks for.
+func countRanges(header string) int {
+	specs, ok := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+	if !ok {
+		return 0
+	}
+	count := 0
+	for _, spec := range strings.Split(specs, ",") {
+		if strings.TrimSpace(spec) != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// tooManyRanges reports whether the request asks for more ranges than the
+// server is willing to assemble into a multipart/byteranges response.
+func (s *Server) tooManyRanges(r *http.Request) bool {
+	limit := s.config.MaxRanges
+	if limit <= 0 {
+		limit = defaultMaxRanges
+	}
+	return countRanges(r.Header.Get("Range")) > limit
+}
+
+func rangeNotSatisfiable(c echo.Context, size int64) error {
+	c.Response().Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+	return fail(c, http.StatusRequestedRangeNotSatisfiable, "Too many ranges requested")
+}
@@ -0,0 +1,147 @@
+package simpleserver
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func rangeRequest(target, ranges string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("Range", ranges)
+	return req
+}
+
+func TestMultiRangeLimit(t *testing.T) {
+	s := newTestServer(t, Config{MaxRanges: 3})
+	content := strings.Repeat("0123456789", 10)
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/digits.txt", strings.NewReader(content)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	target := "/" + shareDirs(t, s)[0] + "/digits.txt"
+
+	rec = serve(s, rangeRequest(target, "bytes=0-1,10-11,20-21"))
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	mediaType, _, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/byteranges", mediaType)
+
+	rec = serve(s, rangeRequest(target, "bytes=0-1,10-11,20-21,30-31"))
+	require.Equal(t, http.StatusRequestedRangeNotSatisfiable, rec.Code)
+	require.Equal(t, fmt.Sprintf("bytes */%d", len(content)), rec.Header().Get("Content-Range"))
+
+	rec = serve(s, rangeRequest(target, "bytes=5-9"))
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	require.Equal(t, "56789", rec.Body.String())
+}
+
+func TestDefaultMaxRanges(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/digits.txt", strings.NewReader(strings.Repeat("x", 100))))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	target := "/" + shareDirs(t, s)[0] + "/digits.txt"
+
+	var ranges []string
+	for i := 0; i <= defaultMaxRanges; i++ {
+		ranges = append(ranges, fmt.Sprintf("%d-%d", i*2, i*2))
+	}
+	require.Equal(t, http.StatusRequestedRangeNotSatisfiable, serve(s, rangeRequest(target, "bytes="+strings.Join(ranges, ","))).Code)
+	require.Equal(t, http.StatusPartialContent, serve(s, rangeRequest(target, "bytes="+strings.Join(ranges[1:], ","))).Code)
+}
+
+func TestCountRanges(t *testing.T) {
+	require.Equal(t, 0, countRanges(""))
+	require.Equal(t, 0, countRanges("items=0-1"))
+	require.Equal(t, 1, countRanges("bytes=0-1"))
+	require.Equal(t, 3, countRanges("bytes=0-1, 5-, -3"))
+}
+
+// unseekableStorage stands in for an object store without ranged reads.
+type unseekableStorage struct {
+	Storage
+}
+
+func (unseekableStorage) Seekable(FileMeta) bool {
+	return false
+}
+
+func TestRangesFollowStorageCapability(t *testing.T) {
+	content := strings.Repeat("0123456789", 10)
+	for name, tc := range map[string]struct {
+		config       Config
+		unseekable   bool
+		status       int
+		acceptRanges string
+		body         string
+	}{
+		"local":      {status: http.StatusPartialContent, acceptRanges: "bytes", body: "56789"},
+		"compressed": {config: Config{CompressAtRest: true}, status: http.StatusOK, acceptRanges: "none", body: content},
+		"unseekable": {unseekable: true, status: http.StatusOK, acceptRanges: "none", body: content},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(t, tc.config)
+			if tc.unseekable {
+				s.storage = unseekableStorage{s.storage}
+			}
+			rec := serve(s, httptest.NewRequest(http.MethodPut, "/digits.txt", strings.NewReader(content)))
+			require.Equal(t, http.StatusCreated, rec.Code)
+			target := "/" + shareDirs(t, s)[0] + "/digits.txt"
+
+			rec = serve(s, rangeRequest(target, "bytes=5-9"))
+			require.Equal(t, tc.status, rec.Code)
+			require.Equal(t, tc.acceptRanges, rec.Header().Get("Accept-Ranges"))
+			require.Equal(t, tc.body, rec.Body.String())
+		})
+	}
+}
+
+func TestHeadAdvertisesRanges(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/digits.txt", strings.NewReader("0123456789")))
+	u := downloadURLs(t, rec.Body.String())[0]
+
+	rec = serve(s, httptest.NewRequest(http.MethodHead, mustRequestURI(t, u), nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "bytes", rec.Header().Get("Accept-Ranges"))
+	require.Equal(t, "10", rec.Header().Get("Content-Length"))
+	require.Empty(t, rec.Body.String())
+	require.Zero(t, findMeta(t, s, "digits.txt").Downloads)
+}
+
+func TestIfRange(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/digits.txt", strings.NewReader("0123456789")))
+	u := mustRequestURI(t, downloadURLs(t, rec.Body.String())[0])
+	etag := `"` + findMeta(t, s, "digits.txt").SHA256 + `"`
+
+	req := rangeRequest(u, "bytes=5-")
+	req.Header.Set("If-Range", etag)
+	rec = serve(s, req)
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	require.Equal(t, "56789", rec.Body.String())
+
+	// The file changed since the client got its first part: start over.
+	req = rangeRequest(u, "bytes=5-")
+	req.Header.Set("If-Range", `"stale"`)
+	rec = serve(s, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "0123456789", rec.Body.String())
+}
+
+func TestRangesAreNotGzipped(t *testing.T) {
+	s := newTestServer(t, Config{})
+	content := strings.Repeat("0123456789", 1000)
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/digits.txt", strings.NewReader(content)))
+	u := mustRequestURI(t, downloadURLs(t, rec.Body.String())[0])
+
+	req := rangeRequest(u, "bytes=0-99")
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec = serve(s, req)
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	require.Empty(t, rec.Header().Get("Content-Encoding"))
+	require.Equal(t, content[:100], rec.Body.String())
+}
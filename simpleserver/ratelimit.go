@@ -0,0 +1,193 @@
+package simpleserver
+
+import (
+	"context"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// bytesPerMB converts BandwidthLimit to bytes.
+const bytesPerMB = 1 << 20
+
+// rateLimit describes a token bucket holding up to burst tokens and refilled
+// with rate tokens per second.
+type rateLimit struct {
+	rate  float64
+	burst float64
+}
+
+// rateStore keeps the token buckets of every client. The Redis backend lets
+// several replicas behind one hostname share them.
+type rateStore interface {
+	// take spends n tokens from the bucket key. When fewer are left nothing
+	// is spent unless force is set, and take reports how long until the
+	// bucket holds n tokens again. Forced spending may leave the bucket in
+	// debt.
+	take(ctx context.Context, key string, n float64, limit rateLimit, force bool) (time.Duration, error)
+}
+
+func newRateStore(config Config) (rateStore, error) {
+	if config.RateLimitRedis != "" {
+		return newRedisRateStore(config.RateLimitRedis)
+	}
+	return newMemoryRateStore(), nil
+}
+
+// memoryRateStore keeps token buckets in memory.
+type memoryRateStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newMemoryRateStore() *memoryRateStore {
+	return &memoryRateStore{buckets: make(map[string]*tokenBucket), now: time.Now}
+}
+
+func (m *memoryRateStore) take(_ context.Context, key string, n float64, limit rateLimit, force bool) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	bucket, ok := m.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: limit.burst, last: now}
+		m.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(limit.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*limit.rate)
+	bucket.last = now
+	if force || bucket.tokens >= n {
+		bucket.tokens -= n
+		m.prune(now, limit)
+		return 0, nil
+	}
+	return time.Duration((n - bucket.tokens) / limit.rate * float64(time.Second)), nil
+}
+
+// prune forgets buckets that have refilled completely, which behave exactly
+// like new ones. It runs at most once a minute, and only once many clients
+// were seen.
+func (m *memoryRateStore) prune(now time.Time, limit rateLimit) {
+	if len(m.buckets) < 1024 || now.Sub(m.lastPrune) < time.Minute {
+		return
+	}
+	m.lastPrune = now
+	for key, bucket := range m.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*limit.rate >= limit.burst {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// requestLimit is the bucket of RateLimit requests per second. Bursts of up
+// to one second worth of requests are allowed.
+func (s *Server) requestLimit() rateLimit {
+	rate := s.settings().RateLimit
+	return rateLimit{rate: rate, burst: math.Max(1, math.Ceil(rate))}
+}
+
+// bandwidthLimit is the bucket of BandwidthLimit MB per hour, which may all
+// be used at once.
+func (s *Server) bandwidthLimit() rateLimit {
+	burst := float64(s.settings().BandwidthLimit) * bytesPerMB
+	return rateLimit{rate: burst / time.Hour.Seconds(), burst: burst}
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// rateLimitClients limits every client, told apart by rateLimitIdentity, to
+// RateLimit requests per second and BandwidthLimit MB per hour of uploads
+// and downloads. Bandwidth is charged once a request is done, so the
+// request that exhausts the budget completes and the next ones are
+// refused. Health probes are never limited. When the store fails requests
+// are let through.
+func (s *Server) rateLimitClients(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		settings := s.settings()
+		if (settings.RateLimit <= 0 && settings.BandwidthLimit <= 0) || isProbePath(c.Request().URL.Path) {
+			return next(c)
+		}
+		ctx := c.Request().Context()
+		identity := rateIdentity(s.rateLimitIdentity(c))
+		if settings.RateLimit > 0 {
+			if wait := s.takeRate(ctx, "req:"+identity, 1, s.requestLimit(), false); wait > 0 {
+				return rateLimited(c, wait, "Too many requests")
+			}
+		}
+		if settings.BandwidthLimit <= 0 {
+			return next(c)
+		}
+		if wait := s.takeRate(ctx, "bw:"+identity, 0, s.bandwidthLimit(), false); wait > 0 {
+			return rateLimited(c, wait, "Bandwidth limit exceeded")
+		}
+		body := &countingReader{ReadCloser: c.Request().Body}
+		c.Request().Body = body
+		err := next(c)
+		s.takeRate(context.Background(), "bw:"+identity, float64(body.n+c.Response().Size), s.bandwidthLimit(), true)
+		return err
+	}
+}
+
+func (s *Server) takeRate(ctx context.Context, key string, n float64, limit rateLimit, force bool) time.Duration {
+	wait, err := s.rates.take(ctx, key, n, limit, force)
+	if err != nil {
+		log.Printf("Rate limit store failed, letting the request through: %v\n", err)
+		return 0
+	}
+	return wait
+}
+
+func rateLimited(c echo.Context, wait time.Duration, message string) error {
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return fail(c, http.StatusTooManyRequests, message)
+}
+
+// rateLimitIdentity names the client like uploaderIdentity, but without
+// checking passwords: a bcrypt per request would let a flood of wrong ones
+// burn CPU even while it is throttled. A known user name counts together
+// with the client IP, so made up passwords share a bucket with the IP they
+// come from rather than drain that of the user. Tokens that do not validate
+// count as the IP.
+func (s *Server) rateLimitIdentity(c echo.Context) string {
+	if identity, ok := s.tokenIdentity(c); ok {
+		return identity
+	}
+	if name, _, ok := c.Request().BasicAuth(); ok {
+		if _, known := s.users[name]; known {
+			return "user:" + name + "@" + c.RealIP()
+		}
+	}
+	return "ip:" + c.RealIP()
+}
+
+// rateIdentity keeps credentials out of the rate store by hashing them.
+func rateIdentity(identity string) string {
+	kind, value, _ := strings.Cut(identity, ":")
+	if kind == "ip" {
+		return identity
+	}
+	return kind + ":" + hexSHA256([]byte(value))
+}
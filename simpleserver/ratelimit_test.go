@@ -0,0 +1,208 @@
+package simpleserver
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRateStore(t *testing.T) {
+	now := time.Unix(1000, 0)
+	m := newMemoryRateStore()
+	m.now = func() time.Time { return now }
+	limit := rateLimit{rate: 2, burst: 2}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		wait, err := m.take(ctx, "a", 1, limit, false)
+		require.NoError(t, err)
+		require.Zero(t, wait)
+	}
+	wait, err := m.take(ctx, "a", 1, limit, false)
+	require.NoError(t, err)
+	require.Equal(t, 500*time.Millisecond, wait)
+
+	// Other keys have their own bucket.
+	wait, _ = m.take(ctx, "b", 1, limit, false)
+	require.Zero(t, wait)
+
+	now = now.Add(500 * time.Millisecond)
+	wait, _ = m.take(ctx, "a", 1, limit, false)
+	require.Zero(t, wait)
+
+	// Forced spending goes into debt.
+	wait, _ = m.take(ctx, "a", 4, limit, true)
+	require.Zero(t, wait)
+	wait, _ = m.take(ctx, "a", 0, limit, false)
+	require.Equal(t, 2*time.Second, wait)
+}
+
+// getFrom requests target for ip through a local proxy.
+func getFrom(ip, target string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.RemoteAddr = "127.0.0.1:4242"
+	req.Header.Set("X-Real-IP", ip)
+	return req
+}
+
+func TestRateLimitRequests(t *testing.T) {
+	s := newTestServer(t, Config{RateLimit: 1})
+
+	require.Equal(t, http.StatusOK, serve(s, getFrom("192.0.2.10", "/capabilities")).Code)
+	rec := serve(s, getFrom("192.0.2.10", "/capabilities"))
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	require.Equal(t, http.StatusOK, serve(s, getFrom("192.0.2.11", "/capabilities")).Code)
+	require.Equal(t, http.StatusOK, serve(s, getFrom("192.0.2.10", livePath)).Code)
+}
+
+func TestRateLimitIgnoresInvalidCredentials(t *testing.T) {
+	s := newTestServer(t, Config{RateLimit: 1, AuthToken: testAuthToken, UploadTokens: []UploadToken{{Token: "alice"}}})
+
+	// Made up credentials count as the client IP.
+	limited := 0
+	for i := 0; i < 20; i++ {
+		req := getFrom("192.0.2.10", "/capabilities")
+		req.Header.Set("Authorization", "Bearer rnd"+strconv.Itoa(i))
+		req.Header.Set(uploadTokenHeader, "rnd"+strconv.Itoa(i))
+		if serve(s, req).Code == http.StatusTooManyRequests {
+			limited++
+		}
+	}
+	require.Equal(t, 19, limited)
+
+	// Valid ones have a bucket of their own.
+	require.Equal(t, http.StatusOK, serve(s, authorized(getFrom("192.0.2.10", "/capabilities"), testAuthToken)).Code)
+	req := getFrom("192.0.2.10", "/capabilities")
+	req.Header.Set(uploadTokenHeader, "alice")
+	require.Equal(t, http.StatusOK, serve(s, req).Code)
+}
+
+func TestBandwidthLimit(t *testing.T) {
+	s := newTestServer(t, Config{BandwidthLimit: 1})
+
+	req := httptest.NewRequest(http.MethodPut, "/big.bin", strings.NewReader(strings.Repeat("x", bytesPerMB)))
+	rec := serve(s, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	u := downloadURLs(t, rec.Body.String())[0]
+
+	rec = download(t, s, u)
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	retry, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+	require.NoError(t, err)
+	require.Positive(t, retry)
+
+	require.Equal(t, http.StatusOK, serve(s, getFrom("192.0.2.11", mustRequestURI(t, u))).Code)
+}
+
+// fakeRedis answers EVAL with a memoryRateStore, checking the command
+// arguments the way Redis would receive them.
+func fakeRedis(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	store := newMemoryRateStore()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					reply, err := readRESP(reader)
+					if err != nil {
+						return
+					}
+					args := reply.([]interface{})
+					switch args[0] {
+					case "AUTH":
+						if args[1] != "secret" {
+							conn.Write([]byte("-WRONGPASS invalid password\r\n"))
+							continue
+						}
+						conn.Write([]byte("+OK\r\n"))
+					case "SELECT":
+						conn.Write([]byte("+OK\r\n"))
+					case "EVAL":
+						float := func(i int) float64 {
+							f, _ := strconv.ParseFloat(args[i].(string), 64)
+							return f
+						}
+						wait, _ := store.take(context.Background(), args[3].(string), float(6),
+							rateLimit{rate: float(4), burst: float(5)}, args[7] == "1")
+						conn.Write([]byte(":" + strconv.FormatInt(wait.Milliseconds(), 10) + "\r\n"))
+					default:
+						conn.Write([]byte("-ERR unknown command\r\n"))
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestRedisRateStore(t *testing.T) {
+	addr := fakeRedis(t)
+	r, err := newRedisRateStore("redis://:secret@" + addr + "/2")
+	require.NoError(t, err)
+	ctx := context.Background()
+	limit := rateLimit{rate: 1, burst: 1}
+
+	wait, err := r.take(ctx, "a", 1, limit, false)
+	require.NoError(t, err)
+	require.Zero(t, wait)
+	wait, err = r.take(ctx, "a", 1, limit, false)
+	require.NoError(t, err)
+	require.Positive(t, wait)
+
+	r, err = newRedisRateStore("redis://:wrong@" + addr)
+	require.NoError(t, err)
+	_, err = r.take(ctx, "a", 1, limit, false)
+	require.ErrorContains(t, err, "WRONGPASS")
+}
+
+func TestRedisRateStoreURL(t *testing.T) {
+	r, err := newRedisRateStore("redis://cache")
+	require.NoError(t, err)
+	require.Equal(t, "cache:6379", r.addr)
+	require.Zero(t, r.db)
+
+	_, err = newRedisRateStore("http://cache")
+	require.Error(t, err)
+	_, err = newRedisRateStore("redis://cache/db")
+	require.Error(t, err)
+}
+
+func TestRateLimitSkipsPasswordChecks(t *testing.T) {
+	s := newTestServer(t, Config{UsersFile: newUsersServer(t).config.UsersFile, RateLimit: 1})
+	e := s.newRouter()
+
+	c := e.NewContext(userRequest(http.MethodGet, "/capabilities", "alice", "wrong", ""), httptest.NewRecorder())
+	require.Equal(t, "user:alice@192.0.2.1", s.rateLimitIdentity(c))
+	require.Nil(t, c.Get(requestUserKey), "the password must not be verified")
+	c = e.NewContext(userRequest(http.MethodGet, "/capabilities", "mallory", "wrong", ""), httptest.NewRecorder())
+	require.Equal(t, "ip:192.0.2.1", s.rateLimitIdentity(c))
+
+	limited := 0
+	for i := 0; i < 10; i++ {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, userRequest(http.MethodGet, "/capabilities", "alice", "wrong"+strconv.Itoa(i), ""))
+		if rec.Code == http.StatusTooManyRequests {
+			limited++
+		}
+	}
+	require.Equal(t, 9, limited)
+}
@@ -0,0 +1,51 @@
+package simpleserver
+
+import (
+	"log"
+	"time"
+)
+
+const defaultReapInterval = time.Minute
+
+// startReaper deletes expired uploads in the background. Expired files are
+// already refused with 410 until the reaper gets to them. It always runs, as
+// any upload may set a download limit.
+func (s *Server) startReaper() {
+	interval := s.config.ReapInterval
+	if interval <= 0 {
+		interval = defaultReapInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stopC:
+				return
+			case <-ticker.C:
+			}
+			if s.readOnly.Load() {
+				continue
+			}
+			now := time.Now()
+			s.reapExpired(now)
+			s.purgeTrash(now)
+			s.reapBatches(now)
+		}
+	}()
+}
+
+// reapExpired deletes every upload expired at now, out of downloads or no
+// longer kept by the retention rules, together with the share dirs left
+// empty, and returns how many were removed.
+func (s *Server) reapExpired(now time.Time) int {
+	removed := 0
+	for _, meta := range s.index.expired(now) {
+		if err := s.expireFile(meta); err != nil {
+			log.Printf("Failed to delete expired %s/%s: %v\n", meta.Dir, meta.Name, err)
+			continue
+		}
+		removed++
+	}
+	return removed + s.reapRetained(now)
+}
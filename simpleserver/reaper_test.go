@@ -0,0 +1,50 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReapExpired(t *testing.T) {
+	s := newTestServer(t, Config{TTL: time.Hour})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/old.txt", strings.NewReader("old")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	meta := findMeta(t, s, "old.txt")
+	require.WithinDuration(t, meta.CreatedAt.Add(time.Hour), meta.ExpiresAt, 0)
+
+	require.Zero(t, s.reapExpired(time.Now()))
+	require.Len(t, shareDirs(t, s), 1)
+
+	require.Equal(t, 1, s.reapExpired(time.Now().Add(2*time.Hour)))
+	require.Empty(t, shareDirs(t, s))
+	require.Zero(t, s.index.len())
+}
+
+func TestBucketTTLOverridesGlobal(t *testing.T) {
+	s := newTestServer(t, Config{TTL: time.Hour, Buckets: map[string]BucketConfig{"short": {TTL: time.Minute}}})
+	require.Equal(t, http.StatusCreated, bucketUpload(s, "short", "", "a.txt", []byte("a")).Code)
+	meta := findMeta(t, s, "a.txt")
+	require.WithinDuration(t, meta.CreatedAt.Add(time.Minute), meta.ExpiresAt, 0)
+}
+
+func TestReaperRunsInBackground(t *testing.T) {
+	s := newTestServer(t, Config{TTL: 20 * time.Millisecond, ReapInterval: 10 * time.Millisecond})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/brief.txt", strings.NewReader("brief")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Eventually(t, func() bool {
+		return s.index.len() == 0 && len(shareDirs(t, s)) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestNoTTLKeepsUploads(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/keep.txt", strings.NewReader("keep")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.True(t, findMeta(t, s, "keep.txt").ExpiresAt.IsZero())
+	require.Zero(t, s.reapExpired(time.Now().Add(24*365*time.Hour)))
+}
@@ -0,0 +1,76 @@
+package simpleserver
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const receiptKeyPath = "/receipt-key"
+
+// Receipt is the signed statement of what was uploaded. The signature covers
+// the exact JSON encoding printed in the upload response.
+type Receipt struct {
+	Dir       string    `json:"dir"`
+	Filename  string    `json:"filename"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// loadReceiptKey reads the hex encoded seed in path, generating and saving a
+// new key when the file does not exist yet.
+func loadReceiptKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		seed := make([]byte, ed25519.SeedSize)
+		if _, err := rand.Read(seed); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, []byte(hex.EncodeToString(seed)+"\n"), 0600); err != nil {
+			return nil, err
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("receipt key %s must hold a hex encoded %d byte seed", path, ed25519.SeedSize)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// signReceipt returns the receipt for meta and its base64 signature.
+func (s *Server) signReceipt(meta FileMeta) (string, string) {
+	receipt, _ := json.Marshal(Receipt{
+		Dir:       meta.Dir,
+		Filename:  meta.displayName(),
+		Size:      meta.Size,
+		SHA256:    meta.SHA256,
+		Timestamp: meta.CreatedAt,
+	})
+	signature := ed25519.Sign(s.receiptKey, receipt)
+	return string(receipt), base64.StdEncoding.EncodeToString(signature)
+}
+
+// handleReceiptKey serves the base64 public key verifying upload receipts.
+func (s *Server) handleReceiptKey(c echo.Context) error {
+	if s.receiptKey == nil {
+		return fail(c, http.StatusNotFound, "Receipts are not enabled")
+	}
+	public := s.receiptKey.Public().(ed25519.PublicKey)
+	return c.String(http.StatusOK, base64.StdEncoding.EncodeToString(public)+"\n")
+}
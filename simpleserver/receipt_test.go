@@ -0,0 +1,84 @@
+package simpleserver
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// responseLine returns the value of the "<prefix><value>" line in body.
+func responseLine(t *testing.T, body, prefix string) string {
+	t.Helper()
+	for _, line := range strings.Split(body, "\n") {
+		if value, ok := strings.CutPrefix(line, prefix); ok {
+			return value
+		}
+	}
+	t.Fatalf("no %q line in %q", prefix, body)
+	return ""
+}
+
+func TestUploadReceiptVerifies(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "receipt.key")
+	s := newTestServer(t, Config{ReceiptKeyFile: keyFile})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("signed notes")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	receipt := responseLine(t, rec.Body.String(), "Receipt: ")
+	signature, err := base64.StdEncoding.DecodeString(responseLine(t, rec.Body.String(), "Signature: "))
+	require.NoError(t, err)
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, receiptKeyPath, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	public, err := base64.StdEncoding.DecodeString(strings.TrimSpace(rec.Body.String()))
+	require.NoError(t, err)
+	require.True(t, ed25519.Verify(public, []byte(receipt), signature))
+
+	var details Receipt
+	require.NoError(t, json.Unmarshal([]byte(receipt), &details))
+	require.Equal(t, "notes.txt", details.Filename)
+	require.Equal(t, int64(len("signed notes")), details.Size)
+	require.Equal(t, shareDirs(t, s)[0], details.Dir)
+
+	for _, alter := range []func(*Receipt){
+		func(r *Receipt) { r.Dir = "other" },
+		func(r *Receipt) { r.Filename = "other.txt" },
+		func(r *Receipt) { r.Size++ },
+		func(r *Receipt) { r.SHA256 = strings.Repeat("0", 64) },
+		func(r *Receipt) { r.Timestamp = r.Timestamp.Add(1) },
+	} {
+		altered := details
+		alter(&altered)
+		forged, err := json.Marshal(altered)
+		require.NoError(t, err)
+		require.False(t, ed25519.Verify(public, forged, signature))
+	}
+}
+
+func TestReceiptKeyPersists(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "receipt.key")
+	first, err := loadReceiptKey(keyFile)
+	require.NoError(t, err)
+	second, err := loadReceiptKey(keyFile)
+	require.NoError(t, err)
+	require.True(t, first.Equal(second))
+
+	require.NoError(t, os.WriteFile(keyFile, []byte("not hex"), 0600))
+	_, err = loadReceiptKey(keyFile)
+	require.Error(t, err)
+}
+
+func TestReceiptsDisabledByDefault(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("notes")))
+	require.NotContains(t, rec.Body.String(), "Receipt")
+	rec = serve(s, httptest.NewRequest(http.MethodGet, receiptKeyPath, nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,180 @@
+package simpleserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// tombstoneDirName keeps the metadata of uploads whose stored object was
+// gone on startup, in <id>.json each. Their entries leave the index, but
+// what was lost can still be told.
+const tombstoneDirName = ".tombstones"
+
+// tombstone is the metadata of an upload whose stored object went missing.
+type tombstone struct {
+	ID         string    `json:"id"`
+	Meta       FileMeta  `json:"meta"`
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// reconcileReport lists what the last reconciliation of the stored objects
+// with the metadata index changed.
+type reconcileReport struct {
+	RanAt time.Time `json:"ran_at"`
+	// Adopted are stored objects the index had no entry for.
+	Adopted []string `json:"adopted"`
+	// Tombstoned are entries whose stored object is gone.
+	Tombstoned []string `json:"tombstoned"`
+}
+
+// reconciler holds the report of the reconciliation run on startup.
+type reconciler struct {
+	mu   sync.Mutex
+	last *reconcileReport
+}
+
+func (s *Server) tombstonePath(id string) string {
+	return filepath.Join(s.getUploadDir(), tombstoneDirName, id+".json")
+}
+
+// reconcile brings the metadata index in line with the stored objects
+// before requests are taken, so switching metadata stores or restoring the
+// upload directory from a backup leaves no upload unreachable. Objects
+// without an entry are adopted, dated by their modification time, and
+// entries without an object are tombstoned.
+func (s *Server) reconcile(now time.Time) reconcileReport {
+	report := reconcileReport{RanAt: now.UTC(), Adopted: []string{}, Tombstoned: []string{}}
+	for _, meta := range s.missingFiles() {
+		if err := s.tombstoneFile(meta, now); err != nil {
+			log.Printf("Failed to tombstone missing %s: %v\n", meta.key(), err)
+			continue
+		}
+		report.Tombstoned = append(report.Tombstoned, meta.key())
+	}
+	for _, meta := range s.orphanedObjects(now) {
+		if err := s.index.put(meta); err != nil {
+			log.Printf("Failed to adopt %s: %v\n", meta.key(), err)
+			continue
+		}
+		report.Adopted = append(report.Adopted, meta.key())
+	}
+	if len(report.Adopted) > 0 || len(report.Tombstoned) > 0 {
+		log.Printf("Reconciliation adopted %d stored files without metadata and tombstoned %d entries of missing files\n",
+			len(report.Adopted), len(report.Tombstoned))
+	}
+	s.reconciler.mu.Lock()
+	s.reconciler.last = &report
+	s.reconciler.mu.Unlock()
+	return report
+}
+
+// orphanedObjects returns entries for the stored uploads the index lacks.
+// Their content type is left to their extension and they get a full TTL
+// from now, as their own age says little about when they were shared.
+func (s *Server) orphanedObjects(now time.Time) []FileMeta {
+	objects, err := s.storage.List(context.Background(), "")
+	if err != nil {
+		log.Printf("Failed to list stored files: %v\n", err)
+		return nil
+	}
+	var orphans []FileMeta
+	for _, obj := range objects {
+		dir, name, ok := strings.Cut(obj.Key, "/")
+		if !ok || !isShareDir(dir) || strings.HasSuffix(name, partSuffix) {
+			continue
+		}
+		if _, ok := s.index.get(dir, name); ok {
+			continue
+		}
+		meta := FileMeta{Dir: dir, Name: name, Size: obj.Size, CreatedAt: obj.ModTime.UTC()}
+		if s.config.TTL > 0 {
+			meta.ExpiresAt = now.UTC().Add(s.config.TTL)
+		}
+		orphans = append(orphans, meta)
+	}
+	return orphans
+}
+
+// tombstoneFile records meta in the tombstones and drops it from the index.
+func (s *Server) tombstoneFile(meta FileMeta, now time.Time) error {
+	item := tombstone{ID: base58(12), Meta: meta, DetectedAt: now.UTC()}
+	content, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.tombstonePath(item.ID)), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.tombstonePath(item.ID), content, 0644); err != nil {
+		return err
+	}
+	return s.index.delete(meta.Dir, meta.Name)
+}
+
+// tombstones lists the tombstoned uploads, most recently detected first.
+func (s *Server) tombstones() ([]tombstone, error) {
+	entries, err := os.ReadDir(filepath.Join(s.getUploadDir(), tombstoneDirName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var items []tombstone
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		var item tombstone
+		content, err := os.ReadFile(s.tombstonePath(id))
+		if err == nil {
+			err = json.Unmarshal(content, &item)
+		}
+		if err != nil {
+			log.Printf("Failed to read tombstone %s: %v\n", id, err)
+			continue
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].DetectedAt.After(items[j].DetectedAt) })
+	return items, nil
+}
+
+type reconcileResponse struct {
+	// LastRun is nil when reconciliation is disabled.
+	LastRun    *reconcileReport `json:"last_run,omitempty"`
+	Tombstones []tombstone      `json:"tombstones"`
+}
+
+// handleReconcile answers GET /admin/reconcile with the report of the
+// reconciliation run on startup and every tombstoned upload.
+func (s *Server) handleReconcile(c echo.Context) error {
+	items, err := s.tombstones()
+	if err != nil {
+		log.Printf("Failed to list tombstones: %v\n", err)
+		return fail(c, http.StatusInternalServerError, "Failed to list tombstones")
+	}
+	response := reconcileResponse{Tombstones: []tombstone{}}
+	s.reconciler.mu.Lock()
+	response.LastRun = s.reconciler.last
+	s.reconciler.mu.Unlock()
+	for _, item := range items {
+		item.Meta.PasswordHash = ""
+		item.Meta.DeleteTokenHash = ""
+		response.Tombstones = append(response.Tombstones, item)
+	}
+	return c.JSON(http.StatusOK, response)
+}
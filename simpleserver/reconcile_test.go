@@ -0,0 +1,58 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartupReconcilesStoreWithIndex(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestServer(t, Config{UploadDir: dir})
+	require.Equal(t, http.StatusCreated, serve(s, httptest.NewRequest(http.MethodPut, "/lost.txt", strings.NewReader("lost"))).Code)
+	lost := findMeta(t, s, "lost.txt")
+	require.NoError(t, os.Remove(filepath.Join(dir, lost.Dir, lost.Name)))
+
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	orphan := filepath.Join(dir, "legacy", "old.txt")
+	require.NoError(t, os.MkdirAll(filepath.Dir(orphan), 0755))
+	require.NoError(t, os.WriteFile(orphan, []byte("from before"), 0644))
+	require.NoError(t, os.Chtimes(orphan, modTime, modTime))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "legacy", "new.txt"+partSuffix), []byte("half"), 0644))
+
+	s = newTestServer(t, Config{UploadDir: dir, AdminToken: testAdminToken, TTL: time.Hour})
+	adopted, ok := s.index.get("legacy", "old.txt")
+	require.True(t, ok)
+	require.Equal(t, int64(len("from before")), adopted.Size)
+	require.True(t, modTime.Equal(adopted.CreatedAt))
+	require.True(t, adopted.ExpiresAt.After(time.Now()))
+	_, ok = s.index.get("legacy", "new.txt"+partSuffix)
+	require.False(t, ok)
+	_, ok = s.index.get(lost.Dir, lost.Name)
+	require.False(t, ok)
+
+	rec := serve(s, adminRequest(http.MethodGet, "/admin/reconcile", ""))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var response reconcileResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	require.Equal(t, []string{"legacy/old.txt"}, response.LastRun.Adopted)
+	require.Equal(t, []string{lost.key()}, response.LastRun.Tombstoned)
+	require.Len(t, response.Tombstones, 1)
+	require.Equal(t, lost.key(), response.Tombstones[0].Meta.key())
+	require.Empty(t, response.Tombstones[0].Meta.DeleteTokenHash)
+
+	// Nothing is left to reconcile on the next start.
+	s = newTestServer(t, Config{UploadDir: dir})
+	require.Empty(t, s.reconciler.last.Adopted)
+	require.Empty(t, s.reconciler.last.Tombstoned)
+
+	s = newTestServer(t, Config{UploadDir: t.TempDir(), NoReconcile: true})
+	require.Nil(t, s.reconciler.last)
+}
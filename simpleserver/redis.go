@@ -0,0 +1,215 @@
+package simpleserver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const redisRateKeyPrefix = "simpleserver:rate:"
+
+// redisTakeScript is the token bucket of memoryRateStore.take run atomically
+// inside Redis, on Redis' clock so replicas agree on the time. It returns
+// how many milliseconds are left until the bucket holds n tokens, 0 when
+// they were spent.
+const redisTakeScript = `
+local rate, burst, n, force = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), ARGV[4] == "1"
+local time = redis.call("TIME")
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+local state = redis.call("HMGET", KEYS[1], "tokens", "last")
+local tokens, last = tonumber(state[1]), tonumber(state[2])
+if tokens == nil then
+  tokens, last = burst, now
+end
+tokens = math.min(burst, tokens + (now - last) * rate)
+local wait = 0
+if force or tokens >= n then
+  tokens = tokens - n
+else
+  wait = math.ceil((n - tokens) / rate * 1000)
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "last", tostring(now))
+redis.call("PEXPIRE", KEYS[1], math.ceil((burst - math.min(tokens, 0)) / rate * 1000) + 1000)
+return wait
+`
+
+// redisRateStore keeps token buckets in Redis.
+type redisRateStore struct {
+	*redisClient
+}
+
+func newRedisRateStore(rawURL string) (*redisRateStore, error) {
+	client, err := newRedisClient(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &redisRateStore{client}, nil
+}
+
+// redisClient speaks RESP to Redis over a single connection that is opened
+// lazily and reopened after a failure.
+type redisClient struct {
+	addr     string
+	password string
+	db       int
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// newRedisClient parses redis://[:password@]host[:port][/db].
+func newRedisClient(rawURL string) (*redisClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "redis" || u.Host == "" {
+		return nil, fmt.Errorf("invalid Redis URL %q, expected redis://[:password@]host[:port][/db]", rawURL)
+	}
+	r := &redisClient{addr: u.Host}
+	if _, _, err := net.SplitHostPort(r.addr); err != nil {
+		r.addr = net.JoinHostPort(r.addr, "6379")
+	}
+	if password, ok := u.User.Password(); ok {
+		r.password = password
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if r.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid Redis database %q", db)
+		}
+	}
+	return r, nil
+}
+
+func (r *redisRateStore) take(ctx context.Context, key string, n float64, limit rateLimit, force bool) (time.Duration, error) {
+	forced := "0"
+	if force {
+		forced = "1"
+	}
+	reply, err := r.do(ctx, "EVAL", redisTakeScript, "1", redisRateKeyPrefix+key,
+		formatFloat(limit.rate), formatFloat(limit.burst), formatFloat(n), forced)
+	if err != nil {
+		return 0, err
+	}
+	wait, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected Redis reply %v", reply)
+	}
+	return time.Duration(wait) * time.Millisecond, nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// redisError is an error reply sent by Redis.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// do sends a command and reads its reply.
+func (r *redisClient) do(ctx context.Context, args ...string) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		if err := r.dial(ctx); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := r.roundTrip(ctx, args)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		r.conn.Close()
+		r.conn = nil
+	}
+	return reply, err
+}
+
+func (r *redisClient) dial(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return err
+	}
+	r.conn, r.reader = conn, bufio.NewReader(conn)
+	if r.password != "" {
+		_, err = r.roundTrip(ctx, []string{"AUTH", r.password})
+	}
+	if err == nil && r.db != 0 {
+		_, err = r.roundTrip(ctx, []string{"SELECT", strconv.Itoa(r.db)})
+	}
+	if err != nil {
+		conn.Close()
+		r.conn = nil
+	}
+	return err
+}
+
+func (r *redisClient) roundTrip(ctx context.Context, args []string) (interface{}, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	r.conn.SetDeadline(deadline)
+	var cmd strings.Builder
+	fmt.Fprintf(&cmd, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&cmd, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(r.conn, cmd.String()); err != nil {
+		return nil, err
+	}
+	return readRESP(r.reader)
+}
+
+// readRESP reads a single RESP reply. Arrays become []interface{}, integers
+// int64, strings string and nil replies nil.
+func readRESP(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil || count < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, count)
+		for i := range items {
+			if items[i], err = readRESP(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
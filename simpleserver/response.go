@@ -0,0 +1,142 @@
+package simpleserver
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// uploadResponse describes a stored file to clients asking for JSON.
+type uploadResponse struct {
+	URL string `json:"url"`
+	// ID is the upload directory, shared by all files of a batch.
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	// ContentType is the sniffed type downloads are served with.
+	ContentType string `json:"content_type"`
+	// ExpiresAt is null for files that never expire.
+	ExpiresAt *time.Time `json:"expires_at"`
+	ShortURL  string     `json:"short_url,omitempty"`
+	QRURL     string     `json:"qr_url,omitempty"`
+	ThumbURL  string     `json:"thumb_url,omitempty"`
+	// RawURL serves a paste as plain text, URL shows it highlighted.
+	RawURL    string `json:"raw_url,omitempty"`
+	Receipt   string `json:"receipt,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	// DeleteToken deletes the file with DELETE on URL, as does DeleteURL.
+	DeleteToken string `json:"delete_token,omitempty"`
+	DeleteURL   string `json:"delete_url,omitempty"`
+
+	// MaxDownloads is omitted for uploads without a download limit.
+	MaxDownloads int64 `json:"max_downloads,omitempty"`
+	// Visibility is omitted for public uploads.
+	Visibility string `json:"visibility,omitempty"`
+	// Description and Tags are omitted for uploads without them.
+	Description string            `json:"description,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+// batchResponse answers multipart and tar uploads, and committed batches
+// along with the URL of their manifest.
+type batchResponse struct {
+	Manifest string           `json:"manifest,omitempty"`
+	Files    []uploadResponse `json:"files"`
+	Failed   []failedUpload   `json:"failed,omitempty"`
+}
+
+// failedUpload is a part of a batch that was not stored, with the code and
+// message of errorResponse.
+type failedUpload struct {
+	Filename string `json:"filename"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+}
+
+// wantsJSON reports whether results are rendered as JSON, either because the
+// client accepts it or because JSONResponses is set.
+func (s *Server) wantsJSON(c echo.Context) bool {
+	return s.config.JSONResponses || strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMEApplicationJSON)
+}
+
+func (s *Server) uploadResponse(c echo.Context, meta FileMeta) uploadResponse {
+	resp := uploadResponse{
+		URL:         s.downloadURL(c, meta.Dir, meta.Name),
+		ID:          meta.Dir,
+		Name:        meta.Name,
+		Size:        meta.Size,
+		SHA256:      meta.SHA256,
+		ContentType: meta.contentType(),
+	}
+	if !meta.ExpiresAt.IsZero() {
+		resp.ExpiresAt = &meta.ExpiresAt
+	}
+	resp.MaxDownloads = meta.MaxDownloads
+	resp.Visibility = meta.Visibility
+	resp.Description = meta.Description
+	resp.Tags = meta.Tags
+	if meta.Alias != "" {
+		resp.ShortURL = s.shortURL(c, meta.Alias)
+	}
+	if s.config.EnableQR {
+		resp.QRURL = s.qrURL(c, meta)
+	}
+	if s.thumbnailable(meta) {
+		resp.ThumbURL = s.thumbURL(c, meta)
+	}
+	if meta.Paste {
+		resp.RawURL = s.rawURL(c, meta)
+	}
+	if s.receiptKey != nil {
+		resp.Receipt, resp.Signature = s.signReceipt(meta)
+	}
+	if token := deleteTokenOf(c, meta); token != "" {
+		resp.DeleteToken, resp.DeleteURL = token, s.deleteURL(c, meta, token)
+	}
+	return resp
+}
+
+// uploaded answers a single stored file.
+func (s *Server) uploaded(c echo.Context, meta FileMeta) error {
+	s.notifyRecipients(c, []FileMeta{meta})
+	c.Response().Header().Set(checksumHeader, meta.SHA256)
+	if token := deleteTokenOf(c, meta); token != "" {
+		c.Response().Header().Set(deleteTokenHeader, token)
+	}
+	if s.wantsJSON(c) {
+		return c.JSON(http.StatusCreated, s.uploadResponse(c, meta))
+	}
+	if s.templates != nil && s.templates.uploaded != nil {
+		// The file is stored by now, so a broken template falls back to
+		// the built-in answer rather than failing the upload.
+		var response strings.Builder
+		err := s.templates.uploaded.Execute(&response, s.uploadResponse(c, meta))
+		if err == nil {
+			return c.String(http.StatusCreated, response.String())
+		}
+		log.Printf("Failed to render %s: %v\n", uploadedTemplate, err)
+	}
+	response := translate(c, "File uploaded successfully. Download at:") + "\n" + s.downloadURL(c, meta.Dir, meta.Name) + "\n"
+	return c.String(http.StatusCreated, response+s.uploadDetails(c, meta))
+}
+
+// batchUploaded answers a multipart or tar upload with the files it stored
+// and the parts that failed.
+func (s *Server) batchUploaded(c echo.Context, status int, stored []FileMeta, failures []partFailure) error {
+	s.notifyRecipients(c, stored)
+	if !s.wantsJSON(c) {
+		return c.String(status, s.multipartReport(c, stored, failures))
+	}
+	resp := batchResponse{Files: make([]uploadResponse, 0, len(stored))}
+	for _, meta := range stored {
+		resp.Files = append(resp.Files, s.uploadResponse(c, meta))
+	}
+	for _, failure := range failures {
+		resp.Failed = append(resp.Failed, failedUpload{Filename: failure.Filename, Code: uploadErrorCode(failure.Err), Message: translate(c, uploadErrorMessage(failure.Err))})
+	}
+	return c.JSON(status, resp)
+}
@@ -0,0 +1,97 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func jsonRequest(req *http.Request) *http.Request {
+	req.Header.Set("Accept", "application/json")
+	return req
+}
+
+func TestUploadAnswersJSON(t *testing.T) {
+	s := newTestServer(t, Config{TTL: time.Hour, ShortLinks: true})
+
+	rec := serve(s, jsonRequest(httptest.NewRequest(http.MethodPut, "/hello.txt", strings.NewReader("hello"))))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Contains(t, rec.Header().Get("Content-Type"), "application/json")
+	var resp uploadResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+
+	meta := findMeta(t, s, "hello.txt")
+	require.Equal(t, "http://example.com/"+meta.Dir+"/hello.txt", resp.URL)
+	require.Equal(t, meta.Dir, resp.ID)
+	require.Equal(t, "hello.txt", resp.Name)
+	require.Equal(t, int64(5), resp.Size)
+	require.Equal(t, sha256Hex("hello"), resp.SHA256)
+	require.NotNil(t, resp.ExpiresAt)
+	require.True(t, resp.ExpiresAt.Equal(meta.ExpiresAt))
+	require.NotEmpty(t, resp.ShortURL)
+
+	rec = download(t, s, resp.URL)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "hello", rec.Body.String())
+}
+
+func TestJSONResponsesFlag(t *testing.T) {
+	s := newTestServer(t, Config{JSONResponses: true})
+
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/hello.txt", strings.NewReader("hello")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Contains(t, resp, "expires_at")
+	require.Nil(t, resp["expires_at"])
+	require.NotContains(t, resp, "short_url")
+}
+
+func TestPlainTextStaysDefault(t *testing.T) {
+	s := newTestServer(t, Config{})
+
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/hello.txt", strings.NewReader("hello")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.True(t, strings.HasPrefix(rec.Body.String(), "File uploaded successfully"))
+	require.Len(t, downloadURLs(t, rec.Body.String()), 1)
+}
+
+func TestMultipartAnswersJSON(t *testing.T) {
+	s := newTestServer(t, Config{MultipartOnError: multipartSkip, StrictFilename: true})
+
+	rec := serve(s, jsonRequest(multipartRequest(t, http.MethodPost, "/",
+		testPart{"a.txt", "a"},
+		testPart{"..", "dots"},
+		testPart{"b.txt", "bb"},
+	)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var resp batchResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.Files, 2)
+	require.Equal(t, resp.Files[0].ID, resp.Files[1].ID)
+	require.Equal(t, "a.txt", resp.Files[0].Name)
+	require.Equal(t, int64(2), resp.Files[1].Size)
+	require.Len(t, resp.Failed, 1)
+	require.Equal(t, "..", resp.Failed[0].Filename)
+	require.Equal(t, codeBadRequest, resp.Failed[0].Code)
+	require.NotEmpty(t, resp.Failed[0].Message)
+}
+
+func TestUploadErrorsAnswerJSON(t *testing.T) {
+	s := newTestServer(t, Config{MaxTotalSize: 1})
+
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/big.bin", strings.NewReader(strings.Repeat("x", 2<<20))))
+	require.Equal(t, http.StatusInsufficientStorage, rec.Code)
+	var resp errorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, codeQuotaExceeded, resp.Code)
+	require.Equal(t, errQuotaExceeded.Error(), resp.Message)
+	require.Equal(t, rec.Header().Get(echo.HeaderXRequestID), resp.RequestID)
+	require.NotEmpty(t, resp.RequestID)
+}
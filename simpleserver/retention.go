@@ -0,0 +1,150 @@
+package simpleserver
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// retentionRule is an entry of Config.RetentionFile. Files whose name
+// matches Pattern in a share dir matching Dir are deleted TTL after they
+// were stored, and only the MaxCount newest of them are kept in each dir.
+// Every rule applies to the files it matches, so the strictest one wins.
+type retentionRule struct {
+	Pattern  string `yaml:"pattern"`
+	Dir      string `yaml:"dir"`
+	TTL      string `yaml:"ttl"`
+	MaxCount int    `yaml:"max_count"`
+
+	ttl time.Duration
+}
+
+// loadRetention reads a retention rules file:
+//
+//	rules:
+//	  - pattern: "*.log"
+//	    ttl: 24h
+//	  - pattern: "*.iso"
+//	    ttl: 7d
+//	  - max_count: 50
+//
+// Patterns and dirs are globs as understood by path.Match and default to
+// "*". TTLs are Go durations or a number of days such as 7d.
+func loadRetention(file string) ([]retentionRule, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var parsed struct {
+		Rules []retentionRule `yaml:"rules"`
+	}
+	if err := yaml.Unmarshal(content, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	rules := parsed.Rules
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Pattern == "" {
+			rule.Pattern = "*"
+		}
+		if rule.Dir == "" {
+			rule.Dir = "*"
+		}
+		for _, glob := range []string{rule.Pattern, rule.Dir} {
+			if _, err := path.Match(glob, ""); err != nil {
+				return nil, fmt.Errorf("retention rule %d in %s has an invalid pattern %q", i+1, file, glob)
+			}
+		}
+		if rule.TTL != "" {
+			if rule.ttl, err = parseRetentionTTL(rule.TTL); err != nil {
+				return nil, fmt.Errorf("retention rule %d in %s: %w", i+1, file, err)
+			}
+		}
+		if rule.MaxCount < 0 {
+			return nil, fmt.Errorf("retention rule %d in %s has a negative max_count", i+1, file)
+		}
+		if rule.ttl == 0 && rule.MaxCount == 0 {
+			return nil, fmt.Errorf("retention rule %d in %s sets neither ttl nor max_count", i+1, file)
+		}
+	}
+	return rules, nil
+}
+
+// parseRetentionTTL reads a positive duration such as 24h or a number of
+// days such as 7d.
+func parseRetentionTTL(value string) (time.Duration, error) {
+	var ttl time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("ttl %q is not a duration such as 24h or 7d", value)
+		}
+		ttl = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if ttl, err = time.ParseDuration(value); err != nil {
+			return 0, fmt.Errorf("ttl %q is not a duration such as 24h or 7d", value)
+		}
+	}
+	if ttl <= 0 {
+		return 0, fmt.Errorf("ttl %q must be positive", value)
+	}
+	return ttl, nil
+}
+
+func (r retentionRule) matches(meta FileMeta) bool {
+	name, _ := path.Match(r.Pattern, path.Base(meta.Name))
+	dir, _ := path.Match(r.Dir, meta.Dir)
+	return name && dir
+}
+
+// retained returns the files the retention rules no longer keep at now.
+func (s *Server) retained(now time.Time) []FileMeta {
+	if len(s.retention) == 0 {
+		return nil
+	}
+	files := s.index.all()
+	drop := make(map[string]FileMeta)
+	for _, rule := range s.retention {
+		counts := make(map[string]int)
+		// all lists the newest files first, so the oldest go once a dir has
+		// MaxCount of them.
+		for _, meta := range files {
+			if !rule.matches(meta) {
+				continue
+			}
+			counts[meta.Dir]++
+			if (rule.ttl > 0 && !now.Before(meta.CreatedAt.Add(rule.ttl))) ||
+				(rule.MaxCount > 0 && counts[meta.Dir] > rule.MaxCount) {
+				drop[meta.key()] = meta
+			}
+		}
+	}
+	dropped := make([]FileMeta, 0, len(drop))
+	for _, meta := range drop {
+		dropped = append(dropped, meta)
+	}
+	sort.Slice(dropped, func(i, j int) bool { return dropped[i].key() < dropped[j].key() })
+	return dropped
+}
+
+// reapRetained deletes the files the retention rules no longer keep and
+// returns how many were removed.
+func (s *Server) reapRetained(now time.Time) int {
+	removed := 0
+	for _, meta := range s.retained(now) {
+		if err := s.expireFile(meta); err != nil {
+			log.Printf("Failed to delete %s/%s past its retention: %v\n", meta.Dir, meta.Name, err)
+			continue
+		}
+		removed++
+	}
+	return removed
+}
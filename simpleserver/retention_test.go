@@ -0,0 +1,82 @@
+package simpleserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeRetention(t *testing.T, rules string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "retention.yml")
+	require.NoError(t, os.WriteFile(file, []byte(rules), 0600))
+	return file
+}
+
+func TestRetentionTTLByPattern(t *testing.T) {
+	s := newTestServer(t, Config{RetentionFile: writeRetention(t, `
+rules:
+  - pattern: "*.log"
+    ttl: 24h
+  - pattern: "*.iso"
+    ttl: 7d
+`)})
+	for _, name := range []string{"app.log", "disk.iso", "notes.txt"} {
+		rec := serve(s, httptest.NewRequest(http.MethodPut, "/"+name, strings.NewReader(name)))
+		require.Equal(t, http.StatusCreated, rec.Code)
+	}
+
+	require.Zero(t, s.reapExpired(time.Now().Add(time.Hour)))
+	require.Equal(t, 1, s.reapExpired(time.Now().Add(25*time.Hour)))
+	_, ok := s.index.get(findMeta(t, s, "disk.iso").Dir, "disk.iso")
+	require.True(t, ok)
+	require.Equal(t, 1, s.reapExpired(time.Now().Add(8*24*time.Hour)))
+	require.Equal(t, 1, s.index.len(), "files matching no rule are kept")
+	findMeta(t, s, "notes.txt")
+}
+
+func TestRetentionMaxCountPerDir(t *testing.T) {
+	s := newTestServer(t, Config{RetentionFile: writeRetention(t, `
+rules:
+  - dir: "team"
+    max_count: 2
+`)})
+	for i, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		meta, err := s.storeFile(context.Background(), "team", name, strings.NewReader(name), uploadOptions{})
+		require.NoError(t, err)
+		meta.CreatedAt = time.Now().Add(time.Duration(i) * time.Minute)
+		require.NoError(t, s.index.put(meta))
+	}
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/other.txt", strings.NewReader("other")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	require.Equal(t, 1, s.reapExpired(time.Now()))
+	_, ok := s.index.get("team", "a.txt")
+	require.False(t, ok, "the oldest file goes")
+	for _, name := range []string{"b.txt", "c.txt"} {
+		_, ok := s.index.get("team", name)
+		require.True(t, ok, name)
+	}
+	findMeta(t, s, "other.txt")
+}
+
+func TestLoadRetentionRejectsInvalidRules(t *testing.T) {
+	for rules, want := range map[string]string{
+		"rules:\n  - pattern: \"[\"\n    ttl: 1h\n": "invalid pattern",
+		"rules:\n  - ttl: soon\n":                   "not a duration",
+		"rules:\n  - ttl: -1h\n":                    "must be positive",
+		"rules:\n  - max_count: -1\n":               "negative max_count",
+		"rules:\n  - pattern: \"*.log\"\n":          "neither ttl nor max_count",
+		"rules: [":                                  "failed to parse",
+	} {
+		_, err := loadRetention(writeRetention(t, rules))
+		require.ErrorContains(t, err, want, rules)
+	}
+}
@@ -0,0 +1,553 @@
+package simpleserver
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultS3AccessKey = "simpleserver"
+	// s3MaxSkew is how far the clock of a client signing requests may be
+	// off, as on AWS.
+	s3MaxSkew  = 15 * time.Minute
+	s3MaxKeys  = 1000
+	s3DateTime = "20060102T150405Z"
+	// s3MaxChunkSize bounds the aws-chunked chunks held in memory until
+	// their signature is checked. Clients send 64 KB chunks.
+	s3MaxChunkSize = 16 << 20
+	// s3EmptySHA256 is the hex SHA-256 of nothing.
+	s3EmptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// s3APIError is an error answered to S3 clients with its code.
+type s3APIError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *s3APIError) Error() string {
+	return e.Message
+}
+
+var (
+	errS3Unsigned         = &s3APIError{http.StatusForbidden, "AccessDenied", "Requests must be signed with AWS Signature Version 4"}
+	errS3Malformed        = &s3APIError{http.StatusBadRequest, "AuthorizationHeaderMalformed", "The authorization header is malformed"}
+	errS3AccessKey        = &s3APIError{http.StatusForbidden, "InvalidAccessKeyId", "The access key ID does not exist"}
+	errS3Skewed           = &s3APIError{http.StatusForbidden, "RequestTimeTooSkewed", "The difference between the request time and the server's time is too large"}
+	errS3Signature        = &s3APIError{http.StatusForbidden, "SignatureDoesNotMatch", "The request signature does not match"}
+	errS3ChunkSignature   = &s3APIError{http.StatusForbidden, "SignatureDoesNotMatch", "A chunk signature does not match"}
+	errS3MalformedChunk   = &s3APIError{http.StatusBadRequest, "IncompleteBody", "The aws-chunked body is malformed"}
+	errS3UnsupportedHash  = &s3APIError{http.StatusBadRequest, "InvalidRequest", "Unsupported x-amz-content-sha256"}
+	errS3NoSuchBucket     = &s3APIError{http.StatusNotFound, "NoSuchBucket", "The bucket does not exist"}
+	errS3NoSuchKey        = &s3APIError{http.StatusNotFound, "NoSuchKey", "The key does not exist"}
+	errS3AccessDenied     = &s3APIError{http.StatusForbidden, "AccessDenied", "The file needs a password or counts its downloads"}
+	errS3InvalidKey       = &s3APIError{http.StatusBadRequest, "InvalidArgument", "Keys must be safe file names, with slashes only when paths are preserved"}
+	errS3InvalidArgument  = &s3APIError{http.StatusBadRequest, "InvalidArgument", "Invalid max-keys or continuation-token"}
+	errS3Paused           = &s3APIError{http.StatusServiceUnavailable, "ServiceUnavailable", "Uploads are paused"}
+	errS3ReadOnly         = &s3APIError{http.StatusServiceUnavailable, "ServiceUnavailable", "The server is read-only"}
+	errS3ListBuckets      = &s3APIError{http.StatusNotImplemented, "NotImplemented", "Listing buckets is not supported, every share dir is a bucket"}
+	errS3BucketOperation  = &s3APIError{http.StatusNotImplemented, "NotImplemented", "Only ListObjectsV2 is supported on buckets"}
+	errS3MultipartUpload  = &s3APIError{http.StatusNotImplemented, "NotImplemented", "Multipart uploads are not supported"}
+	errS3ObjectOperation  = &s3APIError{http.StatusNotImplemented, "NotImplemented", "Only PutObject, GetObject, HeadObject and DeleteObject are supported on objects"}
+	errS3InternalError    = &s3APIError{http.StatusInternalServerError, "InternalError", "Internal error"}
+	errS3ChecksumMismatch = &s3APIError{http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The body does not match x-amz-content-sha256"}
+)
+
+type s3ErrorResponse struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string
+	Message  string
+	Resource string
+}
+
+func s3Fail(c echo.Context, err *s3APIError) error {
+	if c.Request().Method == http.MethodHead {
+		return c.NoContent(err.Status)
+	}
+	return c.XML(err.Status, s3ErrorResponse{Code: err.Code, Message: err.Message, Resource: c.Request().URL.Path})
+}
+
+func (s *Server) s3AccessKey() string {
+	if s.config.S3AccessKey != "" {
+		return s.config.S3AccessKey
+	}
+	return defaultS3AccessKey
+}
+
+// serveS3 serves the S3 API on S3Port until shutdownC is closed. It uses the
+// same certificate as HTTPS when TLS is enabled.
+func (s *Server) serveS3(shutdownC <-chan struct{}) {
+	if s.settings().AuthToken == "" {
+		log.Printf("Failed to serve S3: --s3-port requires --auth-token\n")
+		return
+	}
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		log.Printf("Failed to serve S3: %v\n", err)
+		return
+	}
+	ln, err := s.listen(s.config.S3Port)
+	if err != nil {
+		log.Printf("Failed to serve S3: %v\n", err)
+		return
+	}
+	fmt.Printf("S3 API available on port %d\n", ln.Addr().(*net.TCPAddr).Port)
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	e := s.newS3Router()
+	e.Listener = ln
+	s.applyTimeouts(e)
+	if err := s.serve(e, shutdownC); err != nil {
+		log.Printf("S3 server stopped: %v\n", err)
+	}
+}
+
+// newS3Router serves a subset of the S3 API with path style addressing:
+// every share dir is a bucket holding its files as objects. Like WebDAV it
+// leaves out the files that need a password or count their downloads.
+// Requests are signed with AWS Signature Version 4, using S3AccessKey as
+// access key ID and AuthToken as secret key.
+func (s *Server) newS3Router() *echo.Echo {
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.Any("/*", s.handleS3)
+	return e
+}
+
+func (s *Server) handleS3(c echo.Context) error {
+	r := c.Request()
+	auth, err := s.verifySigV4(r, time.Now())
+	if err != nil {
+		return s3Fail(c, err)
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+	switch {
+	case bucket == "":
+		return s3Fail(c, errS3ListBuckets)
+	case key == "" && r.Method == http.MethodGet && query.Get("list-type") == "2":
+		return s.s3List(c, bucket)
+	case key == "":
+		return s3Fail(c, errS3BucketOperation)
+	case query.Has("uploads") || query.Has("uploadId"):
+		return s3Fail(c, errS3MultipartUpload)
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return s.s3Get(c, bucket, key)
+	case http.MethodPut:
+		if r.Header.Get("X-Amz-Copy-Source") != "" {
+			return s3Fail(c, errS3ObjectOperation)
+		}
+		return s.s3Put(c, auth, bucket, key)
+	case http.MethodDelete:
+		return s.s3Delete(c, bucket, key)
+	}
+	return s3Fail(c, errS3ObjectOperation)
+}
+
+// sigV4Request is a request whose signature checked out, with what is
+// needed to check the signatures of the chunks of its body.
+type sigV4Request struct {
+	amzDate     string
+	scope       string
+	key         []byte
+	signature   string
+	payloadHash string
+}
+
+// verifySigV4 checks the AWS Signature Version 4 in the Authorization header
+// of r. Presigned URLs are not supported.
+func (s *Server) verifySigV4(r *http.Request, now time.Time) (sigV4Request, *s3APIError) {
+	fields, ok := strings.CutPrefix(r.Header.Get(echo.HeaderAuthorization), "AWS4-HMAC-SHA256 ")
+	if !ok {
+		return sigV4Request{}, errS3Unsigned
+	}
+	params := make(map[string]string)
+	for _, field := range strings.Split(fields, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		params[name] = value
+	}
+	credential := strings.Split(params["Credential"], "/")
+	signedHeaders := strings.Split(params["SignedHeaders"], ";")
+	if len(credential) != 5 || credential[3] != "s3" || credential[4] != "aws4_request" || !slices.Contains(signedHeaders, "host") {
+		return sigV4Request{}, errS3Malformed
+	}
+	accessKey, date, region := credential[0], credential[1], credential[2]
+	if subtle.ConstantTimeCompare([]byte(accessKey), []byte(s.s3AccessKey())) != 1 {
+		return sigV4Request{}, errS3AccessKey
+	}
+	amzDate := r.Header.Get("X-Amz-Date")
+	signedAt, err := time.Parse(s3DateTime, amzDate)
+	if err != nil || !strings.HasPrefix(amzDate, date) {
+		return sigV4Request{}, errS3Malformed
+	}
+	if signedAt.Sub(now).Abs() > s3MaxSkew {
+		return sigV4Request{}, errS3Skewed
+	}
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		return sigV4Request{}, errS3UnsupportedHash
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, name := range signedHeaders {
+		values := r.Header.Values(name)
+		switch name {
+		case "host":
+			values = []string{r.Host}
+		case "transfer-encoding":
+			values = r.TransferEncoding
+		}
+		for i, value := range values {
+			values[i] = strings.Join(strings.Fields(value), " ")
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.Join(values, ",") + "\n")
+	}
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		awsEscape(r.URL.Path, false),
+		canonicalQuery(r.URL.Query()),
+		canonicalHeaders.String(),
+		params["SignedHeaders"],
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hexSHA256([]byte(canonicalRequest))
+	key := sigV4Key(s.settings().AuthToken, date, region)
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	if !hmac.Equal([]byte(signature), []byte(params["Signature"])) {
+		return sigV4Request{}, errS3Signature
+	}
+	return sigV4Request{amzDate: amzDate, scope: scope, key: key, signature: signature, payloadHash: payloadHash}, nil
+}
+
+// body returns the content of a PutObject request, decoding aws-chunked
+// streaming uploads.
+func (a sigV4Request) body(r *http.Request) (io.Reader, *s3APIError) {
+	switch a.payloadHash {
+	case "UNSIGNED-PAYLOAD":
+		return r.Body, nil
+	case "STREAMING-AWS4-HMAC-SHA256-PAYLOAD", "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER":
+		return &awsChunkedReader{r: bufio.NewReader(r.Body), auth: &a, prev: a.signature}, nil
+	case "STREAMING-UNSIGNED-PAYLOAD-TRAILER":
+		return &awsChunkedReader{r: bufio.NewReader(r.Body)}, nil
+	}
+	if _, err := parseChecksum(a.payloadHash); err != nil {
+		return nil, errS3UnsupportedHash
+	}
+	return r.Body, nil
+}
+
+// verifyChunk reports whether signature signs data following the chunk
+// signed with prev.
+func (a *sigV4Request) verifyChunk(prev, signature string, data []byte) bool {
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256-PAYLOAD", a.amzDate, a.scope, prev, s3EmptySHA256, hexSHA256(data)}, "\n")
+	expected := hex.EncodeToString(hmacSHA256(a.key, stringToSign))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// awsChunkedReader decodes the aws-chunked body of a streaming upload,
+// checking the signature of every chunk when auth is set. Trailing
+// checksums are skipped, the SHA-256 of the upload is recorded anyway.
+type awsChunkedReader struct {
+	r    *bufio.Reader
+	auth *sigV4Request
+	prev string
+	buf  []byte
+	done bool
+}
+
+func (cr *awsChunkedReader) Read(p []byte) (int, error) {
+	for len(cr.buf) == 0 {
+		if cr.done {
+			return 0, io.EOF
+		}
+		if err := cr.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, cr.buf)
+	cr.buf = cr.buf[n:]
+	return n, nil
+}
+
+// next reads the next chunk, and the trailers after the last one.
+func (cr *awsChunkedReader) next() error {
+	line, err := cr.readLine()
+	if err != nil {
+		return err
+	}
+	sizeField, extension, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(sizeField, 16, 64)
+	if err != nil || size < 0 || size > s3MaxChunkSize {
+		return errS3MalformedChunk
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(cr.r, data); err != nil {
+		return err
+	}
+	if cr.auth != nil {
+		signature, ok := strings.CutPrefix(extension, "chunk-signature=")
+		if !ok || !cr.auth.verifyChunk(cr.prev, signature, data) {
+			return errS3ChunkSignature
+		}
+		cr.prev = signature
+	}
+	if size == 0 {
+		cr.done = true
+		for {
+			if line, err := cr.readLine(); err != nil || line == "" {
+				return err
+			}
+		}
+	}
+	if line, err := cr.readLine(); err != nil || line != "" {
+		return errS3MalformedChunk
+	}
+	cr.buf = data
+	return nil
+}
+
+func (cr *awsChunkedReader) readLine() (string, error) {
+	line, err := cr.r.ReadSlice('\n')
+	switch {
+	case errors.Is(err, io.EOF):
+		return "", io.ErrUnexpectedEOF
+	case err != nil:
+		return "", errS3MalformedChunk
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+func s3ETag(meta FileMeta) string {
+	return `"` + meta.SHA256 + `"`
+}
+
+// s3Bucket reports whether bucket is a share dir holding files.
+func (s *Server) s3Bucket(bucket string) bool {
+	return isShareDir(bucket) && s.index.hasDir(bucket)
+}
+
+// s3Put stores an object, creating its bucket when it is a free share dir
+// name. Only files WebDAV could overwrite are replaced.
+func (s *Server) s3Put(c echo.Context, auth sigV4Request, bucket, key string) error {
+	if s.uploadsOff() {
+		return s3Fail(c, errS3Paused)
+	}
+	name, err := cleanRelativePath(key)
+	if err != nil || strings.Contains(name, "/") && !s.config.PreservePaths {
+		return s3Fail(c, errS3InvalidKey)
+	}
+	if !s.s3Bucket(bucket) && !(validSlug(bucket) && s.shareDirFree(bucket)) {
+		return s3Fail(c, errS3NoSuchBucket)
+	}
+	if meta, ok := s.index.get(bucket, name); ok && !meta.servedInBulk(time.Now()) {
+		return s3Fail(c, errS3AccessDenied)
+	}
+	r := c.Request()
+	body, apiErr := auth.body(r)
+	if apiErr != nil {
+		return s3Fail(c, apiErr)
+	}
+	ctx := r.Context()
+	opts := uploadOptions{TTL: s.config.TTL, MaxBytes: int64(s.maxSize()) << 20}
+	if sum, err := parseChecksum(auth.payloadHash); err == nil {
+		opts.SHA256 = sum
+	}
+	meta, err := s.storeFile(ctx, bucket, name, body, opts)
+	if err == nil {
+		if err = s.confirmUpload(ctx, meta); err != nil {
+			s.removeFile(meta)
+		}
+	}
+	if err != nil {
+		return s3Fail(c, s3UploadError(err))
+	}
+	s.publishEvent(Event{Type: EventUpload, Dir: meta.Dir, Filename: meta.Name, Size: meta.Size, SHA256: meta.SHA256, ClientIP: c.RealIP()})
+	c.Response().Header().Set("ETag", s3ETag(meta))
+	return c.NoContent(http.StatusOK)
+}
+
+// s3UploadError maps an error returned by storeFile to an S3 error, the
+// same way uploadErrorStatus does for HTTP.
+func s3UploadError(err error) *s3APIError {
+	var apiErr *s3APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	if errors.Is(err, errChecksumMismatch) {
+		return errS3ChecksumMismatch
+	}
+	switch status := uploadErrorStatus(err); status {
+	case http.StatusRequestEntityTooLarge:
+		return &s3APIError{status, "EntityTooLarge", err.Error()}
+	case http.StatusInsufficientStorage:
+		return &s3APIError{status, "QuotaExceeded", err.Error()}
+	case http.StatusForbidden:
+		return &s3APIError{status, "AccessDenied", err.Error()}
+	case http.StatusRequestTimeout:
+		return &s3APIError{http.StatusBadRequest, "RequestTimeout", err.Error()}
+	case http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return &s3APIError{http.StatusServiceUnavailable, "ServiceUnavailable", err.Error()}
+	case http.StatusInternalServerError:
+		log.Printf("Failed to save S3 upload: %v\n", err)
+		return errS3InternalError
+	default:
+		return &s3APIError{http.StatusBadRequest, "InvalidArgument", err.Error()}
+	}
+}
+
+// s3Get answers GetObject and HeadObject, with ranges.
+func (s *Server) s3Get(c echo.Context, bucket, key string) error {
+	meta, ok := s.index.get(bucket, key)
+	if !ok || !meta.servedInBulk(time.Now()) {
+		return s3Fail(c, errS3NoSuchKey)
+	}
+	r := c.Request()
+	file := &davFile{s: s, ctx: r.Context(), meta: meta}
+	defer file.Close()
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, meta.contentType())
+	if meta.SHA256 != "" {
+		header.Set("ETag", s3ETag(meta))
+	}
+	http.ServeContent(c.Response(), r, meta.Name, meta.CreatedAt, file)
+	if r.Method == http.MethodGet {
+		s.publishEvent(Event{Type: EventDownload, Dir: meta.Dir, Filename: meta.Name, Size: meta.Size, Bytes: c.Response().Size, ClientIP: c.RealIP()})
+	}
+	return nil
+}
+
+// s3Delete answers DeleteObject. Deleting a missing key succeeds, as on S3.
+func (s *Server) s3Delete(c echo.Context, bucket, key string) error {
+	if s.readOnly.Load() {
+		return s3Fail(c, errS3ReadOnly)
+	}
+	meta, ok := s.index.get(bucket, key)
+	if !ok {
+		return c.NoContent(http.StatusNoContent)
+	}
+	if !meta.servedInBulk(time.Now()) {
+		return s3Fail(c, errS3AccessDenied)
+	}
+	if err := s.deleteFile(meta); err != nil {
+		log.Printf("Failed to delete %s/%s: %v\n", meta.Dir, meta.Name, err)
+		return s3Fail(c, errS3InternalError)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+type s3Object struct {
+	Key          string
+	LastModified string
+	ETag         string `xml:",omitempty"`
+	Size         int64
+	StorageClass string
+}
+
+type s3CommonPrefix struct {
+	Prefix string
+}
+
+type s3ListResult struct {
+	XMLName               xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string
+	Prefix                string
+	Delimiter             string `xml:",omitempty"`
+	StartAfter            string `xml:",omitempty"`
+	ContinuationToken     string `xml:",omitempty"`
+	NextContinuationToken string `xml:",omitempty"`
+	MaxKeys               int
+	KeyCount              int
+	IsTruncated           bool
+	Contents              []s3Object
+	CommonPrefixes        []s3CommonPrefix
+}
+
+// s3List answers ListObjectsV2. Continuation tokens are the last key or
+// common prefix returned, so listings stay consistent across uploads.
+func (s *Server) s3List(c echo.Context, bucket string) error {
+	if !s.s3Bucket(bucket) {
+		return s3Fail(c, errS3NoSuchBucket)
+	}
+	query := c.Request().URL.Query()
+	result := s3ListResult{
+		Name:              bucket,
+		Prefix:            query.Get("prefix"),
+		Delimiter:         query.Get("delimiter"),
+		StartAfter:        query.Get("start-after"),
+		ContinuationToken: query.Get("continuation-token"),
+		MaxKeys:           s3MaxKeys,
+	}
+	if value := query.Get("max-keys"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return s3Fail(c, errS3InvalidArgument)
+		}
+		result.MaxKeys = min(n, s3MaxKeys)
+	}
+	marker := result.StartAfter
+	if result.ContinuationToken != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(result.ContinuationToken)
+		if err != nil {
+			return s3Fail(c, errS3InvalidArgument)
+		}
+		marker = string(decoded)
+	}
+
+	now := time.Now()
+	last := ""
+	// Files are sorted by name, so the common prefixes come in order too.
+	for _, meta := range s.index.inDir(bucket) {
+		if !meta.servedInBulk(now) || !strings.HasPrefix(meta.Name, result.Prefix) {
+			continue
+		}
+		entry, common := meta.Name, false
+		if result.Delimiter != "" {
+			if i := strings.Index(meta.Name[len(result.Prefix):], result.Delimiter); i >= 0 {
+				entry, common = meta.Name[:len(result.Prefix)+i+len(result.Delimiter)], true
+			}
+		}
+		if entry <= marker || entry == last {
+			continue
+		}
+		if result.KeyCount == result.MaxKeys {
+			result.IsTruncated = true
+			result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+			break
+		}
+		result.KeyCount++
+		last = entry
+		if common {
+			result.CommonPrefixes = append(result.CommonPrefixes, s3CommonPrefix{Prefix: entry})
+			continue
+		}
+		object := s3Object{Key: meta.Name, LastModified: meta.CreatedAt.UTC().Format("2006-01-02T15:04:05.000Z"), Size: meta.Size, StorageClass: "STANDARD"}
+		if meta.SHA256 != "" {
+			object.ETag = s3ETag(meta)
+		}
+		result.Contents = append(result.Contents, object)
+	}
+	return c.XML(http.StatusOK, result)
+}
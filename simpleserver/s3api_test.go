@@ -0,0 +1,189 @@
+package simpleserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// startS3 serves the S3 API of a test server and returns the S3 storage
+// backend as a client for its bucket.
+func startS3(t *testing.T, config Config, bucket string) (*Server, *s3Storage) {
+	t.Helper()
+	s := newTestServer(t, config)
+	ts := httptest.NewServer(s.newS3Router())
+	t.Cleanup(ts.Close)
+	endpoint, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	return s, &s3Storage{
+		client:    ts.Client(),
+		endpoint:  endpoint,
+		bucket:    bucket,
+		region:    defaultS3Region,
+		accessKey: defaultS3AccessKey,
+		secretKey: config.AuthToken,
+		now:       time.Now,
+	}
+}
+
+func TestS3API(t *testing.T) {
+	s, client := startS3(t, Config{AuthToken: testAdminToken, PreservePaths: true}, "backups")
+	ctx := context.Background()
+
+	require.NoError(t, client.Put(ctx, "a.txt", strings.NewReader("first")))
+	require.NoError(t, client.Put(ctx, "nested/b.txt", strings.NewReader("second")))
+	meta := findMeta(t, s, "nested/b.txt")
+	require.Equal(t, "backups", meta.Dir)
+	require.Equal(t, "nested/b.txt", meta.Name)
+	require.Equal(t, sha256Hex("second"), meta.SHA256)
+
+	obj, err := client.Get(ctx, "nested/b.txt")
+	require.NoError(t, err)
+	content, err := io.ReadAll(obj.Content)
+	obj.Content.Close()
+	require.NoError(t, err)
+	require.Equal(t, "second", string(content))
+
+	objects, err := client.List(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, objects, 2)
+	require.Equal(t, "a.txt", objects[0].Key)
+	require.Equal(t, int64(5), objects[0].Size)
+	require.Equal(t, "nested/b.txt", objects[1].Key)
+
+	require.NoError(t, client.Delete(ctx, "a.txt"))
+	_, err = client.Get(ctx, "a.txt")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	require.NoError(t, client.Delete(ctx, "a.txt"))
+}
+
+func TestS3ListObjectsPages(t *testing.T) {
+	s, client := startS3(t, Config{AuthToken: testAdminToken, PreservePaths: true}, "photos")
+	ctx := context.Background()
+	for _, key := range []string{"2023/a.jpg", "2023/b.jpg", "2024/c.jpg", "d.jpg", "e.jpg"} {
+		require.NoError(t, client.Put(ctx, key, strings.NewReader(key)))
+	}
+
+	list := func(query url.Values) s3ListResult {
+		query.Set("list-type", "2")
+		resp, err := client.do(ctx, http.MethodGet, client.objectURL("", query), nil, 0)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var result s3ListResult
+		require.NoError(t, xml.NewDecoder(resp.Body).Decode(&result))
+		return result
+	}
+
+	result := list(url.Values{"delimiter": {"/"}, "max-keys": {"2"}})
+	require.True(t, result.IsTruncated)
+	require.Equal(t, []s3CommonPrefix{{"2023/"}, {"2024/"}}, result.CommonPrefixes)
+	require.Empty(t, result.Contents)
+
+	result = list(url.Values{"delimiter": {"/"}, "max-keys": {"2"}, "continuation-token": {result.NextContinuationToken}})
+	require.False(t, result.IsTruncated)
+	require.Equal(t, 2, result.KeyCount)
+	require.Equal(t, "d.jpg", result.Contents[0].Key)
+	require.Equal(t, `"`+sha256Hex("d.jpg")+`"`, result.Contents[0].ETag)
+
+	result = list(url.Values{"prefix": {"2023/"}, "start-after": {"2023/a.jpg"}})
+	require.Len(t, result.Contents, 1)
+	require.Equal(t, "2023/b.jpg", result.Contents[0].Key)
+
+	missing := *client
+	missing.bucket = "missing"
+	_, err := missing.List(ctx, "")
+	require.ErrorContains(t, err, "NoSuchBucket")
+	require.Len(t, s.index.inDir("photos"), 5)
+}
+
+func TestS3RejectsBadSignatures(t *testing.T) {
+	s, client := startS3(t, Config{AuthToken: testAdminToken}, "bucket")
+	client.secretKey = "wrong"
+	err := client.Put(context.Background(), "a.txt", strings.NewReader("data"))
+	require.ErrorContains(t, err, "SignatureDoesNotMatch")
+
+	client.secretKey = testAdminToken
+	client.now = func() time.Time { return time.Now().Add(-time.Hour) }
+	err = client.Put(context.Background(), "a.txt", strings.NewReader("data"))
+	require.ErrorContains(t, err, "RequestTimeTooSkewed")
+	require.Empty(t, s.index.all())
+
+	rec := httptest.NewRecorder()
+	s.newS3Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/bucket/a.txt", nil))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Contains(t, rec.Body.String(), "<Code>AccessDenied</Code>")
+}
+
+func TestS3PutChecksSignedPayload(t *testing.T) {
+	s, client := startS3(t, Config{AuthToken: testAdminToken}, "bucket")
+	put := func(payloadHash, body string) *http.Response {
+		req, err := http.NewRequest(http.MethodPut, client.objectURL("a.txt", nil).String(), strings.NewReader(body))
+		require.NoError(t, err)
+		client.sign(req, payloadHash, time.Now().UTC())
+		resp, err := client.client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+	require.Equal(t, http.StatusBadRequest, put(sha256Hex("other"), "data").StatusCode)
+	require.Empty(t, s.index.all())
+	resp := put(sha256Hex("data"), "data")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, `"`+sha256Hex("data")+`"`, resp.Header.Get("ETag"))
+}
+
+// signedChunks encodes data as aws-chunked with a chunk signature chained to
+// the signature of the request.
+func signedChunks(client *s3Storage, amzDate, seed string, chunks ...string) string {
+	date := amzDate[:8]
+	key := sigV4Key(client.secretKey, date, client.region)
+	scope := date + "/" + client.region + "/s3/aws4_request"
+	var body bytes.Buffer
+	prev := seed
+	for _, chunk := range append(chunks, "") {
+		stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256-PAYLOAD", amzDate, scope, prev, s3EmptySHA256, hexSHA256([]byte(chunk))}, "\n")
+		prev = hex.EncodeToString(hmacSHA256(key, stringToSign))
+		fmt.Fprintf(&body, "%x;chunk-signature=%s\r\n%s\r\n", len(chunk), prev, chunk)
+	}
+	return body.String()
+}
+
+func TestS3StreamingUpload(t *testing.T) {
+	s, client := startS3(t, Config{AuthToken: testAdminToken}, "bucket")
+	upload := func(tamper bool) int {
+		req, err := http.NewRequest(http.MethodPut, client.objectURL("a.txt", nil).String(), nil)
+		require.NoError(t, err)
+		req.Header.Set("Content-Encoding", "aws-chunked")
+		client.sign(req, "STREAMING-AWS4-HMAC-SHA256-PAYLOAD", time.Now().UTC())
+		_, seed, _ := strings.Cut(req.Header.Get("Authorization"), "Signature=")
+		body := signedChunks(client, req.Header.Get("X-Amz-Date"), seed, "hello ", "world")
+		if tamper {
+			body = strings.Replace(body, "world", "WORLD", 1)
+		}
+		req.Body = io.NopCloser(strings.NewReader(body))
+		req.ContentLength = int64(len(body))
+		resp, err := client.client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	require.Equal(t, http.StatusForbidden, upload(true))
+	require.Empty(t, s.index.all())
+	require.Equal(t, http.StatusOK, upload(false))
+	rec := download(t, s, "/bucket/a.txt")
+	require.Equal(t, "hello world", rec.Body.String())
+}
@@ -0,0 +1,147 @@
+package simpleserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	clamdChunkSize = 64 << 10
+	// clamdIOTimeout bounds every exchange with clamd, so a stuck daemon
+	// fails the upload instead of holding it forever.
+	clamdIOTimeout = 30 * time.Second
+)
+
+var (
+	errInfected   = errors.New("upload is infected")
+	errScanFailed = errors.New("upload could not be scanned for viruses")
+)
+
+// Scanner checks uploads for malware while they are received.
+type Scanner interface {
+	// Scan reads r to the end and returns the name of the signature found
+	// in it, or "" when it is clean.
+	Scan(ctx context.Context, r io.Reader) (signature string, err error)
+}
+
+// clamdScanner streams uploads to clamd with the INSTREAM command.
+type clamdScanner struct {
+	network string
+	address string
+}
+
+// newClamdScanner accepts host:port, tcp://host:port, or unix:///path and
+// plain paths for clamd's local socket.
+func newClamdScanner(address string) *clamdScanner {
+	switch {
+	case strings.HasPrefix(address, "unix://"):
+		return &clamdScanner{network: "unix", address: strings.TrimPrefix(address, "unix://")}
+	case strings.HasPrefix(address, "/"):
+		return &clamdScanner{network: "unix", address: address}
+	}
+	return &clamdScanner{network: "tcp", address: strings.TrimPrefix(address, "tcp://")}
+}
+
+func (cs *clamdScanner) Scan(ctx context.Context, r io.Reader) (string, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, cs.network, cs.address)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(clamdIOTimeout))
+	if _, err := io.WriteString(conn, "zINSTREAM\x00"); err != nil {
+		return "", err
+	}
+	chunk := make([]byte, 4+clamdChunkSize)
+	for {
+		n, err := r.Read(chunk[4:])
+		if n > 0 {
+			conn.SetDeadline(time.Now().Add(clamdIOTimeout))
+			binary.BigEndian.PutUint32(chunk, uint32(n))
+			if _, err := conn.Write(chunk[:4+n]); err != nil {
+				return "", err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return "", err
+	}
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		return "", err
+	}
+	return parseClamdReply(strings.TrimSuffix(reply, "\x00"))
+}
+
+// parseClamdReply reads "stream: OK", "stream: <signature> FOUND" or an
+// error such as "INSTREAM size limit exceeded. ERROR".
+func parseClamdReply(reply string) (string, error) {
+	result := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case result == "OK":
+		return "", nil
+	case strings.HasSuffix(result, " FOUND"):
+		return strings.TrimSuffix(result, " FOUND"), nil
+	}
+	return "", fmt.Errorf("clamd: %s", reply)
+}
+
+// scanJob runs a Scanner over everything written to it.
+type scanJob struct {
+	pw     *io.PipeWriter
+	result chan scanResult
+}
+
+type scanResult struct {
+	signature string
+	err       error
+}
+
+func (s *Server) startScan(ctx context.Context) *scanJob {
+	pr, pw := io.Pipe()
+	job := &scanJob{pw: pw, result: make(chan scanResult, 1)}
+	go func() {
+		signature, err := s.scanner.Scan(ctx, pr)
+		if err == nil {
+			// Drain whatever the scanner left unread so the upload is
+			// never stuck writing to it.
+			_, err = io.Copy(io.Discard, pr)
+		}
+		pr.CloseWithError(errScanFailed)
+		job.result <- scanResult{signature, err}
+	}()
+	return job
+}
+
+func (j *scanJob) Write(p []byte) (int, error) {
+	return j.pw.Write(p)
+}
+
+// finish ends the scan once the whole upload was written, or aborts it with
+// cause.
+func (j *scanJob) finish(cause error) (string, error) {
+	if cause != nil {
+		j.pw.CloseWithError(cause)
+	} else {
+		j.pw.Close()
+	}
+	result := <-j.result
+	if result.err != nil {
+		return "", fmt.Errorf("%w: %v", errScanFailed, result.err)
+	}
+	return result.signature, nil
+}
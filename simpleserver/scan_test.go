@@ -0,0 +1,111 @@
+package simpleserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd answers INSTREAM scans, flagging streams containing EICAR.
+func fakeClamd(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				if cmd, err := r.ReadString(0); err != nil || cmd != "zINSTREAM\x00" {
+					return
+				}
+				var stream bytes.Buffer
+				for {
+					var size uint32
+					if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					if _, err := io.CopyN(&stream, r, int64(size)); err != nil {
+						return
+					}
+				}
+				if strings.Contains(stream.String(), "EICAR") {
+					io.WriteString(conn, "stream: Eicar-Test-Signature FOUND\x00")
+				} else {
+					io.WriteString(conn, "stream: OK\x00")
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestScanAcceptsCleanUploads(t *testing.T) {
+	s := newTestServer(t, Config{ClamAVAddress: fakeClamd(t)})
+	content := strings.Repeat("clean ", 50000)
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/clean.txt", strings.NewReader(content)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	rec = download(t, s, downloadURLs(t, rec.Body.String())[0])
+	require.Equal(t, content, rec.Body.String())
+}
+
+func TestScanRejectsInfectedUploads(t *testing.T) {
+	s := newTestServer(t, Config{ClamAVAddress: "tcp://" + fakeClamd(t), CompressAtRest: true})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/eicar.com", strings.NewReader(eicar)))
+	require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	require.Contains(t, rec.Body.String(), "Eicar-Test-Signature")
+	require.Empty(t, shareDirs(t, s))
+	require.Zero(t, s.index.len())
+
+	rec = serve(s, multipartRequest(t, http.MethodPost, "/", testPart{"ok.txt", "ok"}, testPart{"eicar.com", eicar}))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Zero(t, s.index.len())
+}
+
+func TestScanFailsClosed(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+
+	s := newTestServer(t, Config{ClamAVAddress: addr})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("a")))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Zero(t, s.index.len())
+}
+
+func TestParseClamdReply(t *testing.T) {
+	signature, err := parseClamdReply("stream: OK")
+	require.NoError(t, err)
+	require.Empty(t, signature)
+	signature, err = parseClamdReply("stream: Win.Test.EICAR_HDB-1 FOUND")
+	require.NoError(t, err)
+	require.Equal(t, "Win.Test.EICAR_HDB-1", signature)
+	_, err = parseClamdReply("INSTREAM size limit exceeded. ERROR")
+	require.Error(t, err)
+}
+
+func TestNewClamdScannerAddresses(t *testing.T) {
+	require.Equal(t, &clamdScanner{network: "tcp", address: "localhost:3310"}, newClamdScanner("localhost:3310"))
+	require.Equal(t, &clamdScanner{network: "tcp", address: "localhost:3310"}, newClamdScanner("tcp://localhost:3310"))
+	require.Equal(t, &clamdScanner{network: "unix", address: "/run/clamd.sock"}, newClamdScanner("unix:///run/clamd.sock"))
+	require.Equal(t, &clamdScanner{network: "unix", address: "/run/clamd.sock"}, newClamdScanner("/run/clamd.sock"))
+}
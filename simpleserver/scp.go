@@ -0,0 +1,167 @@
+package simpleserver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// scpSinkTarget parses the command the legacy scp protocol runs on the
+// server to upload, as in "scp -t -- /dir". Downloads with scp -f are
+// refused, recent clients fetch files over SFTP anyway.
+func scpSinkTarget(command string) (string, bool) {
+	fields := strings.Fields(command)
+	if len(fields) < 2 || fields[0] != "scp" {
+		return "", false
+	}
+	target := "."
+	sink := false
+	for i, field := range fields[1:] {
+		if field == "--" || !strings.HasPrefix(field, "-") {
+			if field == "--" {
+				i++
+			}
+			target = strings.Join(fields[i+1:], " ")
+			break
+		}
+		if strings.ContainsRune(field, 'f') {
+			return "", false
+		}
+		if strings.ContainsRune(field, 't') {
+			sink = true
+		}
+	}
+	if len(target) >= 2 && target[0] == '\'' && target[len(target)-1] == '\'' {
+		target = target[1 : len(target)-1]
+	}
+	return target, sink
+}
+
+// scpSink receives files sent by scp into target, which is a directory or,
+// for a single file, the name to store it as. Directories sent with -r are
+// created on the way. Files that cannot be stored are reported to the
+// client, which moves on to the next one.
+func (s *Server) scpSink(ctx context.Context, rw io.ReadWriter, target string) uint32 {
+	dav := davFS{s: s}
+	r := bufio.NewReader(rw)
+	dirs := []string{sftpPath(target)}
+	status := uint32(0)
+	ack := func(err error) bool {
+		if err == nil {
+			_, err = rw.Write([]byte{0})
+			return err == nil
+		}
+		status = 1
+		_, err = fmt.Fprintf(rw, "\x01scp: %s\n", err)
+		return err == nil
+	}
+	if !ack(nil) {
+		return 1
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) && line == "" {
+				return status
+			}
+			return 1
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return 1
+		}
+		cwd := dirs[len(dirs)-1]
+		switch line[0] {
+		case 'C', 'D':
+			size, name, ok := parseSCPEntry(line)
+			if !ok {
+				ack(errors.New("protocol error"))
+				return 1
+			}
+			dst := cwd
+			if info, err := dav.Stat(ctx, cwd); err == nil && info.IsDir() {
+				dst = path.Join(cwd, name)
+			}
+			if line[0] == 'D' {
+				err := dav.Mkdir(ctx, dst, 0755)
+				if errors.Is(err, os.ErrExist) {
+					err = nil
+				}
+				if err == nil {
+					dirs = append(dirs, dst)
+				}
+				if !ack(scpError(name, err)) || err != nil {
+					return 1
+				}
+				continue
+			}
+			file, err := dav.OpenFile(ctx, dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+			if !ack(scpError(name, err)) {
+				return 1
+			}
+			if err != nil {
+				// The client does not send the content of refused files.
+				continue
+			}
+			_, err = io.CopyN(file, r, size)
+			if err != nil {
+				file.(*davUpload).abort()
+				return 1
+			}
+			if _, err := r.ReadByte(); err != nil {
+				file.(*davUpload).abort()
+				return 1
+			}
+			if !ack(scpError(name, file.Close())) {
+				return 1
+			}
+		case 'E':
+			if len(dirs) > 1 {
+				dirs = dirs[:len(dirs)-1]
+			}
+			if !ack(nil) {
+				return 1
+			}
+		case 'T':
+			// Times sent with -p are not kept.
+			if !ack(nil) {
+				return 1
+			}
+		default:
+			// The client reports its own errors the same way.
+			return 1
+		}
+	}
+}
+
+// parseSCPEntry parses "C0644 <size> <name>" and "D0755 0 <name>".
+func parseSCPEntry(line string) (int64, string, bool) {
+	fields := strings.SplitN(line[1:], " ", 3)
+	if len(fields) != 3 {
+		return 0, "", false
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	name := fields[2]
+	if err != nil || size < 0 || name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return 0, "", false
+	}
+	return size, name, true
+}
+
+func scpError(name string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("%s: No such file or directory", name)
+	case errors.Is(err, os.ErrPermission):
+		return fmt.Errorf("%s: Permission denied", name)
+	}
+	return fmt.Errorf("%s: %v", name, err)
+}
@@ -0,0 +1,264 @@
+package simpleserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// quarantineDirName holds the uploads the scrubber found corrupted.
+	// Each is moved in the backend to .quarantine/<id>, with its metadata
+	// and what was wrong with it next to it in <id>.json, so an operator
+	// can look into it before deleting it or restoring it from a replica.
+	quarantineDirName = ".quarantine"
+	// defaultScrubSpeed keeps scrubbing from competing with downloads.
+	defaultScrubSpeed = "8M"
+)
+
+// quarantinedFile is an upload taken out of service by the scrubber.
+type quarantinedFile struct {
+	ID         string    `json:"id"`
+	Meta       FileMeta  `json:"meta"`
+	Error      string    `json:"error"`
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// scrubber tracks the passes that read every stored upload back in the
+// background and check it against its recorded SHA-256. Only one runs at a
+// time.
+type scrubber struct {
+	mu      sync.Mutex
+	running bool
+	last    scrubPass
+}
+
+// scrubPass describes a pass of the scrubber.
+type scrubPass struct {
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Checked    int        `json:"checked"`
+	Corrupted  int        `json:"corrupted"`
+	Failed     int        `json:"failed"`
+}
+
+// record counts a file checked by the running pass.
+func (b *scrubber) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.last.Checked++
+	switch {
+	case errors.Is(err, errChecksumChanged):
+		b.last.Corrupted++
+	case err != nil:
+		b.last.Failed++
+	}
+}
+
+func quarantineKey(id string) string {
+	return quarantineDirName + "/" + id
+}
+
+func (s *Server) quarantinePath(id string) string {
+	return filepath.Join(s.getUploadDir(), quarantineDirName, id+".json")
+}
+
+// startScrubber runs a pass every ScrubInterval in the background. The first
+// one waits for an interval, so restarts do not read the whole store again.
+func (s *Server) startScrubber() {
+	if s.config.ScrubInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(s.config.ScrubInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stopC:
+				return
+			case <-ticker.C:
+			}
+			s.scrub()
+		}
+	}()
+}
+
+// scrub checks every stored upload once, quarantining the corrupted ones,
+// unless a pass is running already. It stops early on Shutdown.
+func (s *Server) scrub() {
+	if s.readOnly.Load() {
+		return
+	}
+	s.scrubber.mu.Lock()
+	if s.scrubber.running {
+		s.scrubber.mu.Unlock()
+		return
+	}
+	s.scrubber.running = true
+	s.scrubber.last = scrubPass{StartedAt: time.Now().UTC()}
+	s.scrubber.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.stopC:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	var limiter *rate.Limiter
+	// Validate made sure the speed parses.
+	if speed, _ := parseSpeed(s.config.ScrubSpeed); speed > 0 {
+		limiter = newTransferLimiter(speed)
+	}
+
+	for _, meta := range s.index.all() {
+		if ctx.Err() != nil {
+			break
+		}
+		if meta.SHA256 == "" || meta.Pending {
+			continue
+		}
+		err := s.verifyFile(ctx, meta, limiter)
+		if ctx.Err() != nil || errors.Is(err, fs.ErrNotExist) {
+			// The server is shutting down, or the file was deleted
+			// meanwhile.
+			continue
+		}
+		if errors.Is(err, errChecksumChanged) {
+			s.quarantineCorrupted(meta, err)
+		} else if err != nil {
+			log.Printf("Failed to scrub %s: %v\n", meta.key(), err)
+		}
+		s.scrubber.record(err)
+	}
+
+	s.scrubber.mu.Lock()
+	defer s.scrubber.mu.Unlock()
+	s.scrubber.running = false
+	if ctx.Err() == nil {
+		finished := time.Now().UTC()
+		s.scrubber.last.FinishedAt = &finished
+	}
+	if pass := s.scrubber.last; pass.Corrupted > 0 {
+		log.Printf("Scrubbing found %d corrupted files out of %d\n", pass.Corrupted, pass.Checked)
+	}
+}
+
+// quarantineCorrupted takes a corrupted upload out of service, unless it
+// was replaced while it was checked.
+func (s *Server) quarantineCorrupted(meta FileMeta, reason error) {
+	if current, ok := s.index.get(meta.Dir, meta.Name); !ok || current.SHA256 != meta.SHA256 || !current.CreatedAt.Equal(meta.CreatedAt) {
+		return
+	}
+	s.metrics.corruptions.Inc()
+	log.Printf("Quarantining %s: %v\n", meta.key(), reason)
+	if err := s.quarantineFile(meta, reason); err != nil {
+		log.Printf("Failed to quarantine %s: %v\n", meta.key(), err)
+	}
+}
+
+// quarantineFile moves an upload into the quarantine. Replicas are left
+// alone, as they may be the last good copy.
+func (s *Server) quarantineFile(meta FileMeta, reason error) error {
+	item := quarantinedFile{ID: base58(12), Meta: meta, Error: reason.Error(), DetectedAt: time.Now().UTC()}
+	content, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.quarantinePath(item.ID)), 0755); err != nil {
+		return err
+	}
+	if err := s.renameObject(context.Background(), meta.key(), quarantineKey(item.ID)); err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.quarantinePath(item.ID), content, 0644); err != nil {
+		return err
+	}
+	if err := s.index.delete(meta.Dir, meta.Name); err != nil {
+		return err
+	}
+	s.cache.remove(meta.key())
+	s.dropVariants(meta)
+	return nil
+}
+
+// quarantined lists the quarantined uploads, most recently detected first.
+func (s *Server) quarantined() ([]quarantinedFile, error) {
+	entries, err := os.ReadDir(filepath.Join(s.getUploadDir(), quarantineDirName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var items []quarantinedFile
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		var item quarantinedFile
+		content, err := os.ReadFile(s.quarantinePath(id))
+		if err == nil {
+			err = json.Unmarshal(content, &item)
+		}
+		if err != nil {
+			log.Printf("Failed to read quarantined %s: %v\n", id, err)
+			continue
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].DetectedAt.After(items[j].DetectedAt) })
+	return items, nil
+}
+
+type integrityResponse struct {
+	Enabled bool `json:"enabled"`
+	Running bool `json:"running"`
+	// LastPass is the running pass, or the last one.
+	LastPass    *scrubPass        `json:"last_pass,omitempty"`
+	Quarantined []quarantinedFile `json:"quarantined"`
+}
+
+// handleIntegrity answers GET /admin/integrity with the state of the
+// scrubber and the quarantined uploads. POST /admin/integrity starts a pass
+// right away and answers 202.
+func (s *Server) handleIntegrity(c echo.Context) error {
+	if c.Request().Method == http.MethodPost {
+		go s.scrub()
+		return c.NoContent(http.StatusAccepted)
+	}
+	items, err := s.quarantined()
+	if err != nil {
+		log.Printf("Failed to list quarantine: %v\n", err)
+		return fail(c, http.StatusInternalServerError, "Failed to list quarantine")
+	}
+	response := integrityResponse{Enabled: s.config.ScrubInterval > 0, Quarantined: []quarantinedFile{}}
+	s.scrubber.mu.Lock()
+	response.Running = s.scrubber.running
+	if !s.scrubber.last.StartedAt.IsZero() {
+		pass := s.scrubber.last
+		response.LastPass = &pass
+	}
+	s.scrubber.mu.Unlock()
+	for _, item := range items {
+		item.Meta.PasswordHash = ""
+		item.Meta.DeleteTokenHash = ""
+		response.Quarantined = append(response.Quarantined, item)
+	}
+	return c.JSON(http.StatusOK, response)
+}
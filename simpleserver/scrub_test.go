@@ -0,0 +1,71 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func integrityStatus(t *testing.T, s *Server) integrityResponse {
+	t.Helper()
+	rec := serve(s, adminRequest(http.MethodGet, "/admin/integrity", ""))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var status integrityResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	return status
+}
+
+func TestScrubberQuarantinesCorruptedFiles(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken})
+	links := make(map[string]string)
+	for _, name := range []string{"intact.txt", "rotten.txt"} {
+		rec := serve(s, httptest.NewRequest(http.MethodPut, "/"+name, strings.NewReader(name)))
+		require.Equal(t, http.StatusCreated, rec.Code)
+		links[name] = downloadURLs(t, rec.Body.String())[0]
+	}
+	rotten := findMeta(t, s, "rotten.txt")
+	require.NoError(t, os.WriteFile(filepath.Join(s.getUploadDir(), rotten.Dir, rotten.Name), []byte("bit rot"), 0644))
+
+	status := integrityStatus(t, s)
+	require.False(t, status.Enabled)
+	require.Nil(t, status.LastPass)
+	require.Empty(t, status.Quarantined)
+
+	require.Equal(t, http.StatusAccepted, serve(s, adminRequest(http.MethodPost, "/admin/integrity", "")).Code)
+	require.Eventually(t, func() bool {
+		status = integrityStatus(t, s)
+		return status.LastPass != nil && status.LastPass.FinishedAt != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, 2, status.LastPass.Checked)
+	require.Equal(t, 1, status.LastPass.Corrupted)
+	require.Len(t, status.Quarantined, 1)
+	require.Equal(t, "rotten.txt", status.Quarantined[0].Meta.Name)
+	require.Equal(t, errChecksumChanged.Error(), status.Quarantined[0].Error)
+	require.Empty(t, status.Quarantined[0].Meta.DeleteTokenHash)
+
+	require.Equal(t, http.StatusNotFound, download(t, s, links["rotten.txt"]).Code)
+	require.Equal(t, "intact.txt", download(t, s, links["intact.txt"]).Body.String())
+	require.FileExists(t, filepath.Join(s.getUploadDir(), quarantineDirName, status.Quarantined[0].ID))
+
+	rec := serve(s, httptest.NewRequest(http.MethodGet, metricsPath, nil))
+	require.Contains(t, rec.Body.String(), "simpleserver_corrupted_files_total 1")
+}
+
+func TestScrubberSkipsReplacedFiles(t *testing.T) {
+	s := newTestServer(t, Config{})
+	require.Equal(t, http.StatusCreated, serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("v1"))).Code)
+	meta := findMeta(t, s, "notes.txt")
+	stale := meta
+	stale.SHA256 = sha256Hex("v0")
+	s.quarantineCorrupted(stale, errChecksumChanged)
+	require.Equal(t, meta, findMeta(t, s, "notes.txt"))
+
+	require.ErrorContains(t, Config{UploadDir: t.TempDir(), ScrubSpeed: "fast"}.Validate(), "--scrub-speed")
+}
@@ -0,0 +1,310 @@
+package simpleserver
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	searchPath = "/search"
+
+	defaultSearchLimit = 50
+	maxSearchLimit     = 1000
+	// maxSearchTerms bounds the work a single query asks for.
+	maxSearchTerms = 16
+)
+
+// searchTerms splits text into the lowercased runs of letters and digits the
+// search index is keyed by, so "Build-Log_2024.txt" is found by build, log,
+// 2024 and txt.
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// indexedText is what a search looks through: the filename, the tags and
+// the description of an upload.
+func (m FileMeta) indexedText() []string {
+	text := []string{m.Name, m.OriginalName, m.Description}
+	for key, value := range m.Tags {
+		text = append(text, key, value)
+	}
+	return text
+}
+
+// addTerms and dropTerms keep the search index in step with the files. The
+// caller must hold ix.mu.
+func (ix *metaIndex) addTerms(meta FileMeta) {
+	key := meta.key()
+	for _, text := range meta.indexedText() {
+		for _, term := range searchTerms(text) {
+			keys, ok := ix.terms[term]
+			if !ok {
+				keys = make(map[string]struct{})
+				ix.terms[term] = keys
+			}
+			keys[key] = struct{}{}
+		}
+	}
+}
+
+func (ix *metaIndex) dropTerms(meta FileMeta) {
+	key := meta.key()
+	for _, text := range meta.indexedText() {
+		for _, term := range searchTerms(text) {
+			keys, ok := ix.terms[term]
+			if !ok {
+				continue
+			}
+			delete(keys, key)
+			if len(keys) == 0 {
+				delete(ix.terms, term)
+			}
+		}
+	}
+}
+
+// searchQuery is a parsed query: every term must match, exactly or, for
+// those written with a trailing *, as a prefix.
+type searchQuery struct {
+	terms    []string
+	prefixes []string
+}
+
+func parseSearchQuery(q string) searchQuery {
+	var query searchQuery
+	for _, word := range strings.Fields(q) {
+		terms := searchTerms(word)
+		for i, term := range terms {
+			if i == len(terms)-1 && strings.HasSuffix(word, "*") {
+				query.prefixes = append(query.prefixes, term)
+			} else {
+				query.terms = append(query.terms, term)
+			}
+		}
+	}
+	return query
+}
+
+func (q searchQuery) empty() bool {
+	return len(q.terms) == 0 && len(q.prefixes) == 0
+}
+
+// search returns the files matching every term of query, those with the
+// terms in their filename first, then newest first.
+func (ix *metaIndex) search(query searchQuery) []FileMeta {
+	ix.mu.RLock()
+	var matches map[string]struct{}
+	narrow := func(keys map[string]struct{}) {
+		if matches == nil {
+			matches = make(map[string]struct{}, len(keys))
+			for key := range keys {
+				matches[key] = struct{}{}
+			}
+			return
+		}
+		for key := range matches {
+			if _, ok := keys[key]; !ok {
+				delete(matches, key)
+			}
+		}
+	}
+	for _, term := range query.terms {
+		narrow(ix.terms[term])
+	}
+	for _, prefix := range query.prefixes {
+		keys := make(map[string]struct{})
+		for term, termKeys := range ix.terms {
+			if strings.HasPrefix(term, prefix) {
+				for key := range termKeys {
+					keys[key] = struct{}{}
+				}
+			}
+		}
+		narrow(keys)
+	}
+	files := make([]FileMeta, 0, len(matches))
+	for key := range matches {
+		files = append(files, ix.files[key])
+	}
+	ix.mu.RUnlock()
+
+	inName := make(map[string]int, len(files))
+	for _, meta := range files {
+		inName[meta.key()] = query.inName(meta)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if a, b := inName[files[i].key()], inName[files[j].key()]; a != b {
+			return a > b
+		}
+		if !files[i].CreatedAt.Equal(files[j].CreatedAt) {
+			return files[i].CreatedAt.After(files[j].CreatedAt)
+		}
+		return files[i].key() < files[j].key()
+	})
+	return files
+}
+
+// inName counts the terms of q found in the filename of meta.
+func (q searchQuery) inName(meta FileMeta) int {
+	names := make(map[string]bool)
+	for _, term := range searchTerms(meta.Name + " " + meta.OriginalName) {
+		names[term] = true
+	}
+	n := 0
+	for _, term := range q.terms {
+		if names[term] {
+			n++
+		}
+	}
+	for _, prefix := range q.prefixes {
+		for term := range names {
+			if strings.HasPrefix(term, prefix) {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
+
+type searchResult struct {
+	Dir string `json:"dir"`
+	listedFile
+}
+
+type searchResponse struct {
+	Query  string         `json:"query"`
+	Total  int            `json:"total"`
+	Offset int            `json:"offset"`
+	Limit  int            `json:"limit"`
+	Files  []searchResult `json:"files"`
+	// NextURL and PrevURL page through the results, they are empty on the
+	// last and first page.
+	NextURL string `json:"next_url,omitempty"`
+	PrevURL string `json:"prev_url,omitempty"`
+}
+
+var searchPage = template.Must(template.New("search").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Search{{if .Query}}: {{.Query}}{{end}}</title>
+</head>
+<body style="font-family: system-ui, sans-serif; max-width: 50rem; margin: 3rem auto; padding: 0 1rem">
+<form action="/search" method="get"><input type="search" name="q" value="{{.Query}}" autofocus style="width: 70%"> <button>Search</button></form>
+{{if .Query}}<p>{{.Total}} {{if eq .Total 1}}file{{else}}files{{end}}</p>
+<table style="width: 100%; border-collapse: collapse">
+<tr><th align="left">Name</th><th align="left">Tags</th><th align="right">Size</th><th align="right">Uploaded</th></tr>
+{{range .Files}}<tr><td><a href="{{.URL}}">{{.Name}}</a>{{if .Description}}<br><small>{{.Description}}</small>{{end}}</td><td>{{range $key, $value := .Tags}}<code>{{$key}}={{$value}}</code> {{end}}</td><td align="right">{{.Size}}</td><td align="right">{{.CreatedAt.Format "2006-01-02 15:04"}}</td></tr>
+{{end}}</table>
+<p>{{if .PrevURL}}<a href="{{.PrevURL}}">Previous</a> {{end}}{{if .NextURL}}<a href="{{.NextURL}}">Next</a>{{end}}</p>{{end}}
+</body>
+</html>
+`))
+
+// searchAvailable reports whether anyone may search: holders of
+// Config.AuthToken through every upload, users through their own.
+func (s *Server) searchAvailable() bool {
+	return s.settings().AuthToken != "" || len(s.users) > 0
+}
+
+// searchScope returns the upload directory a search is confined to, empty
+// for Config.AuthToken holders who search every directory but those of
+// users and drop shares, which they may not list either.
+func (s *Server) searchScope(c echo.Context) (string, bool) {
+	if token := s.settings().AuthToken; token != "" && validBearer(c.Request(), token) {
+		return "", true
+	}
+	return s.requestUser(c)
+}
+
+// handleSearch answers GET /search?q=<terms>&limit=<n>&offset=<n> with the
+// uploads whose filename, tags or description hold every term, a term*
+// matching as a prefix. Expired, pending and unlisted files are left out.
+// Results are JSON for clients asking for it and an HTML page otherwise.
+func (s *Server) handleSearch(c echo.Context) error {
+	if !s.searchAvailable() {
+		return fail(c, http.StatusNotFound, "Not found")
+	}
+	dir, ok := s.searchScope(c)
+	if !ok {
+		if len(s.users) > 0 {
+			return userUnauthorized(c)
+		}
+		return authUnauthorized(c)
+	}
+	limit, offset := defaultSearchLimit, 0
+	if value := c.QueryParam("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > maxSearchLimit {
+			return fail(c, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxSearchLimit))
+		}
+		limit = n
+	}
+	if value := c.QueryParam("offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fail(c, http.StatusBadRequest, "offset must be a non-negative integer")
+		}
+		offset = n
+	}
+	q := strings.TrimSpace(c.QueryParam("q"))
+	query := parseSearchQuery(q)
+	if len(query.terms)+len(query.prefixes) > maxSearchTerms {
+		return fail(c, http.StatusBadRequest, "q may hold at most "+strconv.Itoa(maxSearchTerms)+" terms")
+	}
+	resp := searchResponse{Query: q, Offset: offset, Limit: limit, Files: []searchResult{}}
+	if !query.empty() {
+		now := time.Now()
+		var hits []FileMeta
+		for _, meta := range s.index.search(query) {
+			if meta.expired(now) || meta.Pending || !meta.listed() {
+				continue
+			}
+			if dir != "" && meta.Dir != dir || dir == "" && (s.isUserDir(meta.Dir) || s.claimedByDropShare(meta.Dir)) {
+				continue
+			}
+			hits = append(hits, meta)
+		}
+		resp.Total = len(hits)
+		// offset may be as large as an int gets, adding limit to it would
+		// overflow.
+		start := min(offset, len(hits))
+		for _, meta := range hits[start : start+min(limit, len(hits)-start)] {
+			resp.Files = append(resp.Files, searchResult{Dir: meta.Dir, listedFile: s.listedFile(c, meta)})
+		}
+		if start+limit < len(hits) {
+			resp.NextURL = s.searchURL(c, q, limit, offset+limit)
+		}
+		if offset > 0 {
+			resp.PrevURL = s.searchURL(c, q, limit, max(offset-limit, 0))
+		}
+	}
+	if s.wantsJSON(c) {
+		return c.JSON(http.StatusOK, resp)
+	}
+	var page strings.Builder
+	if err := searchPage.Execute(&page, resp); err != nil {
+		return err
+	}
+	return c.HTML(http.StatusOK, page.String())
+}
+
+func (s *Server) searchURL(c echo.Context, q string, limit, offset int) string {
+	query := url.Values{"q": {q}, "offset": {strconv.Itoa(offset)}}
+	if limit != defaultSearchLimit {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	return s.baseURL(c) + searchPath + "?" + query.Encode()
+}
@@ -0,0 +1,137 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func searchFiles(t *testing.T, s *Server, query url.Values) searchResponse {
+	t.Helper()
+	rec := serve(s, authorized(jsonRequest(httptest.NewRequest(http.MethodGet, searchPath+"?"+query.Encode(), nil)), testAuthToken))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp searchResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return resp
+}
+
+func searchNames(resp searchResponse) []string {
+	names := []string{}
+	for _, file := range resp.Files {
+		names = append(names, file.Name)
+	}
+	return names
+}
+
+func TestSearch(t *testing.T) {
+	s := newTestServer(t, Config{AuthToken: testAuthToken})
+	upload := func(name string, headers map[string]string) {
+		req := authorized(httptest.NewRequest(http.MethodPut, "/"+name, strings.NewReader(name)), testAuthToken)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		rec := serve(s, req)
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	}
+	upload("Build-Log_2024.txt", map[string]string{"X-Meta-Build": "nightly"})
+	upload("release-notes.md", map[string]string{"X-Meta-Description": "Notes for the nightly build"})
+	upload("holiday.jpg", map[string]string{"X-Meta-Album": "summer"})
+	upload("secret.txt", map[string]string{visibilityHeader: visibilityUnlisted})
+
+	require.Equal(t, []string{"Build-Log_2024.txt"}, searchNames(searchFiles(t, s, url.Values{"q": {"log 2024"}})))
+	// Filename matches rank before tag and description ones.
+	require.Equal(t, []string{"Build-Log_2024.txt", "release-notes.md"}, searchNames(searchFiles(t, s, url.Values{"q": {"BUILD"}})))
+	// Otherwise the newest come first.
+	require.Equal(t, []string{"release-notes.md", "Build-Log_2024.txt"}, searchNames(searchFiles(t, s, url.Values{"q": {"nightly"}})))
+	require.Equal(t, []string{"holiday.jpg"}, searchNames(searchFiles(t, s, url.Values{"q": {"holi*"}})))
+	require.Empty(t, searchFiles(t, s, url.Values{"q": {"holi"}}).Files)
+	require.Equal(t, []string{"holiday.jpg"}, searchNames(searchFiles(t, s, url.Values{"q": {"album summer"}})))
+	require.Empty(t, searchFiles(t, s, url.Values{"q": {"secret"}}).Files)
+	require.Empty(t, searchFiles(t, s, url.Values{"q": {""}}).Files)
+
+	resp := searchFiles(t, s, url.Values{"q": {"build"}})
+	require.Equal(t, "nightly", resp.Files[0].Tags["build"])
+	require.NotEmpty(t, resp.Files[0].Dir)
+	require.Equal(t, "Notes for the nightly build", resp.Files[1].Description)
+
+	// Deleted files and dropped tags leave the index.
+	meta := findMeta(t, s, "release-notes.md")
+	require.NoError(t, s.index.delete(meta.Dir, meta.Name))
+	require.Equal(t, []string{"Build-Log_2024.txt"}, searchNames(searchFiles(t, s, url.Values{"q": {"nightly"}})))
+	meta = findMeta(t, s, "Build-Log_2024.txt")
+	meta.Tags = nil
+	require.NoError(t, s.index.put(meta))
+	require.Empty(t, searchFiles(t, s, url.Values{"q": {"nightly"}}).Files)
+}
+
+func TestSearchPages(t *testing.T) {
+	s := newTestServer(t, Config{AuthToken: testAuthToken})
+	for i := 0; i < 5; i++ {
+		rec := serve(s, authorized(httptest.NewRequest(http.MethodPut, fmt.Sprintf("/report-%d.pdf", i), strings.NewReader("x")), testAuthToken))
+		require.Equal(t, http.StatusCreated, rec.Code)
+	}
+	var names []string
+	query := url.Values{"q": {"report"}, "limit": {"2"}}
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 3)
+		resp := searchFiles(t, s, query)
+		require.Equal(t, 5, resp.Total)
+		names = append(names, searchNames(resp)...)
+		if resp.NextURL == "" {
+			break
+		}
+		next, err := url.Parse(resp.NextURL)
+		require.NoError(t, err)
+		require.Equal(t, searchPath, next.Path)
+		query = next.Query()
+	}
+	require.Len(t, names, 5)
+	require.ElementsMatch(t, []string{"report-0.pdf", "report-1.pdf", "report-2.pdf", "report-3.pdf", "report-4.pdf"}, names)
+
+	rec := serve(s, authorized(httptest.NewRequest(http.MethodGet, searchPath+"?q=report&limit=0", nil), testAuthToken))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = serve(s, authorized(httptest.NewRequest(http.MethodGet, searchPath+"?q=report&offset=-1", nil), testAuthToken))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	resp := searchFiles(t, s, url.Values{"q": {"report"}, "offset": {"9223372036854775807"}})
+	require.Equal(t, 5, resp.Total)
+	require.Empty(t, resp.Files)
+	require.Empty(t, resp.NextURL)
+	require.NotEmpty(t, resp.PrevURL)
+}
+
+func TestSearchAuth(t *testing.T) {
+	s := newTestServer(t, Config{})
+	require.Equal(t, http.StatusNotFound, serve(s, httptest.NewRequest(http.MethodGet, searchPath+"?q=a", nil)).Code)
+
+	s = newTestServer(t, Config{AuthToken: testAuthToken})
+	require.Equal(t, http.StatusUnauthorized, serve(s, httptest.NewRequest(http.MethodGet, searchPath+"?q=a", nil)).Code)
+	rec := serve(s, authorized(httptest.NewRequest(http.MethodGet, searchPath+"?q=%3Cb%3E", nil), testAuthToken))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Header().Get("Content-Type"), "text/html")
+	require.Contains(t, rec.Body.String(), `value="&lt;b&gt;"`)
+}
+
+func TestSearchUsersSeeTheirOwnFiles(t *testing.T) {
+	s := newUsersServer(t)
+	require.Equal(t, http.StatusCreated, serve(s, userRequest(http.MethodPut, "/plan.txt", "alice", "wonderland", "a")).Code)
+	require.Equal(t, http.StatusCreated, serve(s, userRequest(http.MethodPut, "/plan.txt", "bob", "builder", "b")).Code)
+
+	require.Equal(t, http.StatusUnauthorized, serve(s, userRequest(http.MethodGet, searchPath+"?q=plan", "alice", "wrong", "")).Code)
+	req := jsonRequest(userRequest(http.MethodGet, searchPath+"?q=plan", "alice", "wonderland", ""))
+	rec := serve(s, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp searchResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.Files, 1)
+	require.Equal(t, "alice", resp.Files[0].Dir)
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Contains(t, rec.Body.String(), `action="/search"`)
+}
@@ -0,0 +1,81 @@
+package simpleserver
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+// copyBufferSize is the size of the buffers transfers are copied through.
+// Larger buffers than io.Copy's 32K mean fewer syscalls for large files.
+const copyBufferSize = 256 << 10
+
+var copyBuffers = sync.Pool{New: func() any {
+	buf := make([]byte, copyBufferSize)
+	return &buf
+}}
+
+// writerOnly hides the ReadFrom of a writer, which for files allocates a
+// buffer of its own when the source is not a file as well.
+type writerOnly struct {
+	io.Writer
+}
+
+// copyBuffer is io.Copy through a pooled buffer. Files are handed to the
+// destination as they are, so it can move them with sendfile or
+// copy_file_range without going through user space.
+func copyBuffer(dst io.Writer, src io.Reader) (int64, error) {
+	if isFile(src) {
+		if rf, ok := dst.(io.ReaderFrom); ok {
+			return rf.ReadFrom(src)
+		}
+	}
+	buf := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(buf)
+	return io.CopyBuffer(writerOnly{dst}, src, *buf)
+}
+
+// isFile reports whether r reads straight from a file, as the kernel can
+// copy from those without a buffer.
+func isFile(r io.Reader) bool {
+	if limited, ok := r.(*io.LimitedReader); ok {
+		r = limited.R
+	}
+	_, ok := r.(*os.File)
+	return ok
+}
+
+// sendfileResponse lets http.ServeContent and copyBuffer reach the ReadFrom
+// of the connection, which sends files with sendfile, through echo's
+// response. echo.Response only implements Write, so files would otherwise be
+// copied through user space in 32K steps.
+type sendfileResponse struct {
+	*echo.Response
+}
+
+func (w sendfileResponse) ReadFrom(r io.Reader) (int64, error) {
+	if !w.Committed {
+		if w.Status == 0 {
+			w.Status = http.StatusOK
+		}
+		w.WriteHeader(w.Status)
+	}
+	var n int64
+	var err error
+	if rf, ok := w.Writer.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		n, err = copyBuffer(w.Writer, r)
+	}
+	w.Size += n
+	return n, err
+}
+
+// sendBody writes r as the body of the response of c.
+func sendBody(c echo.Context, r io.Reader) error {
+	_, err := copyBuffer(sendfileResponse{c.Response()}, r)
+	return err
+}
@@ -0,0 +1,127 @@
+package simpleserver
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadOverConnection(t *testing.T) {
+	s := newTestServer(t, Config{})
+	// Archives are sent as they are even to clients accepting compressed
+	// responses, straight from the file.
+	content := append([]byte("PK\x03\x04"), bytes.Repeat([]byte("0123456789abcdef"), 1<<16)...)
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/big.zip", bytes.NewReader(content)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	u := downloadURLs(t, rec.Body.String())[0]
+	srv := httptest.NewServer(s.newRouter())
+	defer srv.Close()
+	path := u[strings.Index(u, "/"+shareDirs(t, s)[0]):]
+
+	res, err := http.Get(srv.URL + path)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, strconv.Itoa(len(content)), res.Header.Get("Content-Length"))
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, content, body)
+}
+
+func TestSendfileResponseCountsBytes(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "data")
+	require.NoError(t, os.WriteFile(file, []byte("hello world"), 0644))
+	f, err := os.Open(file)
+	require.NoError(t, err)
+	defer f.Close()
+
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+	require.NoError(t, sendBody(c, f))
+	require.Equal(t, int64(11), c.Response().Size)
+	require.True(t, c.Response().Committed)
+	require.Equal(t, "hello world", rec.Body.String())
+}
+
+// benchmarkFile creates a sparse file to download, 2GB unless
+// SIMPLESERVER_BENCH_SIZE names another size in bytes.
+func benchmarkFile(b *testing.B) (string, int64) {
+	size := int64(2 << 30)
+	if value := os.Getenv("SIMPLESERVER_BENCH_SIZE"); value != "" {
+		var err error
+		size, err = strconv.ParseInt(value, 10, 64)
+		require.NoError(b, err)
+	}
+	path := filepath.Join(b.TempDir(), "big.bin")
+	f, err := os.Create(path)
+	require.NoError(b, err)
+	require.NoError(b, f.Truncate(size))
+	require.NoError(b, f.Close())
+	return path, size
+}
+
+func benchmarkGet(b *testing.B, url string, size int64) {
+	// The file is all zeros, compressing it would measure gzip instead.
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	b.SetBytes(size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res, err := client.Get(url)
+		require.NoError(b, err)
+		n, err := io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		require.NoError(b, err)
+		require.Equal(b, size, n)
+	}
+}
+
+// BenchmarkServeContent compares sending a file through echo's response,
+// which copies it through user space, with sendfileResponse.
+func BenchmarkServeContent(b *testing.B) {
+	path, size := benchmarkFile(b)
+	for _, bench := range []struct {
+		name string
+		wrap func(*echo.Response) http.ResponseWriter
+	}{
+		{"echo", func(r *echo.Response) http.ResponseWriter { return r }},
+		{"sendfile", func(r *echo.Response) http.ResponseWriter { return sendfileResponse{r} }},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			e := echo.New()
+			e.GET("/", func(c echo.Context) error {
+				f, err := os.Open(path)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				http.ServeContent(bench.wrap(c.Response()), c.Request(), "big.bin", time.Time{}, f)
+				return nil
+			})
+			srv := httptest.NewServer(e)
+			defer srv.Close()
+			benchmarkGet(b, srv.URL, size)
+		})
+	}
+}
+
+// BenchmarkDownload downloads a file through the whole middleware chain.
+func BenchmarkDownload(b *testing.B) {
+	path, size := benchmarkFile(b)
+	s := newTestServer(b, Config{})
+	require.NoError(b, os.MkdirAll(filepath.Join(s.getUploadDir(), "bench"), 0755))
+	require.NoError(b, os.Rename(path, filepath.Join(s.getUploadDir(), "bench", "big.bin")))
+	require.NoError(b, s.index.put(FileMeta{Dir: "bench", Name: "big.bin", Size: size, ContentType: "application/octet-stream", CreatedAt: time.Now()}))
+	srv := httptest.NewServer(s.newRouter())
+	defer srv.Close()
+	benchmarkGet(b, srv.URL+"/bench/big.bin", size)
+}
@@ -0,0 +1,597 @@
+package simpleserver
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/webdav"
+)
+
+// sftpHostKeyName is the host key generated inside the upload dir when
+// neither SFTPHostKey nor StateDir is set.
+const sftpHostKeyName = ".sftp_host_key"
+
+// sftpMaxPacket bounds the packets a client may send. OpenSSH writes 32KB
+// chunks and other clients stay well below this.
+const sftpMaxPacket = 256 << 10
+
+// SFTP version 3 packet types and status codes, as spoken by OpenSSH. See
+// draft-ietf-secsh-filexfer-02.
+const (
+	sshFxpInit     = 1
+	sshFxpVersion  = 2
+	sshFxpOpen     = 3
+	sshFxpClose    = 4
+	sshFxpRead     = 5
+	sshFxpWrite    = 6
+	sshFxpLstat    = 7
+	sshFxpFstat    = 8
+	sshFxpSetstat  = 9
+	sshFxpFsetstat = 10
+	sshFxpOpendir  = 11
+	sshFxpReaddir  = 12
+	sshFxpRemove   = 13
+	sshFxpMkdir    = 14
+	sshFxpRmdir    = 15
+	sshFxpRealpath = 16
+	sshFxpStat     = 17
+	sshFxpRename   = 18
+	sshFxpStatus   = 101
+	sshFxpHandle   = 102
+	sshFxpData     = 103
+	sshFxpName     = 104
+	sshFxpAttrs    = 105
+
+	sshFxOK               = 0
+	sshFxEOF              = 1
+	sshFxNoSuchFile       = 2
+	sshFxPermissionDenied = 3
+	sshFxFailure          = 4
+	sshFxBadMessage       = 5
+	sshFxOpUnsupported    = 8
+
+	sshFxfRead   = 0x01
+	sshFxfWrite  = 0x02
+	sshFxfAppend = 0x04
+	sshFxfExcl   = 0x20
+
+	sshFileXferAttrSize        = 0x01
+	sshFileXferAttrPermissions = 0x04
+	sshFileXferAttrACModTime   = 0x08
+)
+
+var errSSHDenied = errors.New("permission denied")
+
+// serveSFTP accepts SSH connections on SFTPPort until shutdownC is closed.
+// Clients get an SFTP subsystem and scp uploads on the same file system
+// WebDAV serves.
+func (s *Server) serveSFTP(shutdownC <-chan struct{}) {
+	config, err := s.sshConfig()
+	if err != nil {
+		log.Printf("Failed to serve SFTP: %v\n", err)
+		return
+	}
+	ln, err := s.listen(s.config.SFTPPort)
+	if err != nil {
+		log.Printf("Failed to serve SFTP: %v\n", err)
+		return
+	}
+	fmt.Printf("SFTP available on port %d\n", ln.Addr().(*net.TCPAddr).Port)
+	go func() {
+		<-shutdownC
+		ln.Close()
+	}()
+	s.acceptSSH(ln, config)
+}
+
+func (s *Server) acceptSSH(ln net.Listener, config *ssh.ServerConfig) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleSSH(conn, config)
+	}
+}
+
+// sshConfig authenticates clients with Config.AuthToken as password or
+// with a key listed in SFTPAuthorizedKeys, whatever the user name.
+func (s *Server) sshConfig() (*ssh.ServerConfig, error) {
+	config := &ssh.ServerConfig{}
+	if s.settings().AuthToken != "" {
+		config.PasswordCallback = func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if subtle.ConstantTimeCompare(password, []byte(s.settings().AuthToken)) == 1 {
+				return nil, nil
+			}
+			return nil, errSSHDenied
+		}
+	}
+	if s.config.SFTPAuthorizedKeys != "" {
+		keys, err := loadAuthorizedKeys(s.config.SFTPAuthorizedKeys)
+		if err != nil {
+			return nil, err
+		}
+		config.PublicKeyCallback = func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if keys[string(key.Marshal())] {
+				return nil, nil
+			}
+			return nil, errSSHDenied
+		}
+	}
+	if config.PasswordCallback == nil && config.PublicKeyCallback == nil {
+		return nil, errors.New("SFTP needs an auth token or authorized keys to authenticate clients")
+	}
+	hostKey := s.config.sftpHostKey()
+	if s.config.SFTPHostKey == "" {
+		if err := os.MkdirAll(filepath.Dir(hostKey), 0755); err != nil {
+			return nil, err
+		}
+	}
+	signer, err := loadHostKey(hostKey)
+	if err != nil {
+		return nil, err
+	}
+	config.AddHostKey(signer)
+	return config, nil
+}
+
+// loadHostKey reads a PEM or OpenSSH private key, generating an Ed25519
+// key at path when there is none yet so clients see the same host key after
+// a restart.
+func loadHostKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		block, err := ssh.MarshalPrivateKey(key, "simpleserver")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+			return nil, err
+		}
+		return ssh.NewSignerFromKey(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKey(data)
+}
+
+// loadAuthorizedKeys reads an OpenSSH authorized_keys file. Options are
+// ignored.
+func loadAuthorizedKeys(path string) (map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]bool)
+	for len(data) > 0 {
+		key, _, _, rest, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			if len(keys) == 0 {
+				return nil, fmt.Errorf("no authorized keys in %s: %w", path, err)
+			}
+			break
+		}
+		keys[string(key.Marshal())] = true
+		data = rest
+	}
+	return keys, nil
+}
+
+func (s *Server) handleSSH(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		// Failed handshakes and logins only concern the client.
+		return
+	}
+	defer sconn.Close()
+	go ssh.DiscardRequests(reqs)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			newChan.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		ch, requests, err := newChan.Accept()
+		if err != nil {
+			continue
+		}
+		go s.handleSSHSession(ctx, ch, requests)
+	}
+}
+
+// handleSSHSession runs the sftp subsystem or an scp upload, whichever the
+// client asks for first. Shells and other commands are refused.
+func (s *Server) handleSSHSession(ctx context.Context, ch ssh.Channel, requests <-chan *ssh.Request) {
+	started := false
+	run := func(serve func() uint32) {
+		started = true
+		go func() {
+			status := serve()
+			ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+			ch.Close()
+		}()
+	}
+	for req := range requests {
+		var payload struct{ Value string }
+		ok := !started && ssh.Unmarshal(req.Payload, &payload) == nil
+		switch {
+		case ok && req.Type == "subsystem" && payload.Value == "sftp":
+			run(func() uint32 { return s.serveSFTPSession(ctx, ch) })
+		case ok && req.Type == "exec":
+			target, sink := scpSinkTarget(payload.Value)
+			if ok = sink; ok {
+				run(func() uint32 { return s.scpSink(ctx, ch, target) })
+			}
+		default:
+			ok = false
+		}
+		if req.WantReply {
+			req.Reply(ok, nil)
+		}
+	}
+}
+
+// sftpSession serves one SFTP subsystem. Requests are answered in order.
+type sftpSession struct {
+	fs      davFS
+	ctx     context.Context
+	rw      io.ReadWriter
+	handles map[string]webdav.File
+	next    int
+}
+
+func (s *Server) serveSFTPSession(ctx context.Context, rw io.ReadWriter) uint32 {
+	sess := &sftpSession{fs: davFS{s: s}, ctx: ctx, rw: rw, handles: make(map[string]webdav.File)}
+	defer sess.closeAll()
+	for {
+		typ, body, err := sess.readPacket()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				return 1
+			}
+			return 0
+		}
+		if err := sess.handle(typ, body); err != nil {
+			return 1
+		}
+	}
+}
+
+func (sess *sftpSession) readPacket() (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(sess.rw, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	if length < 1 || length > sftpMaxPacket {
+		return 0, nil, fmt.Errorf("sftp packet of %d bytes", length)
+	}
+	body := make([]byte, length-1)
+	if _, err := io.ReadFull(sess.rw, body); err != nil {
+		return 0, nil, err
+	}
+	return header[4], body, nil
+}
+
+func (sess *sftpSession) send(typ byte, body []byte) error {
+	packet := make([]byte, 5, 5+len(body))
+	binary.BigEndian.PutUint32(packet, uint32(1+len(body)))
+	packet[4] = typ
+	_, err := sess.rw.Write(append(packet, body...))
+	return err
+}
+
+func (sess *sftpSession) status(id, code uint32, message string) error {
+	return sess.send(sshFxpStatus, ssh.Marshal(struct {
+		ID      uint32
+		Code    uint32
+		Message string
+		Lang    string
+	}{id, code, message, ""}))
+}
+
+// fail answers a request with the status matching err.
+func (sess *sftpSession) fail(id uint32, err error) error {
+	switch {
+	case err == nil:
+		return sess.status(id, sshFxOK, "")
+	case errors.Is(err, os.ErrNotExist):
+		return sess.status(id, sshFxNoSuchFile, "No such file")
+	case errors.Is(err, os.ErrPermission):
+		return sess.status(id, sshFxPermissionDenied, "Permission denied")
+	case errors.Is(err, os.ErrExist):
+		return sess.status(id, sshFxFailure, "File exists")
+	}
+	return sess.status(id, sshFxFailure, err.Error())
+}
+
+// sftpPath resolves a client path. The root of the file system is the
+// home directory as well.
+func sftpPath(p string) string {
+	return path.Join("/", p)
+}
+
+// handle answers a single request. Only failing to write the reply ends
+// the session.
+func (sess *sftpSession) handle(typ byte, body []byte) error {
+	if typ == sshFxpInit {
+		return sess.send(sshFxpVersion, ssh.Marshal(struct{ Version uint32 }{3}))
+	}
+	if len(body) < 4 {
+		return errors.New("sftp request without id")
+	}
+	id := binary.BigEndian.Uint32(body)
+	var req struct {
+		ID   uint32
+		Path string
+		Rest []byte `ssh:"rest"`
+	}
+	var handle webdav.File
+	switch typ {
+	case sshFxpClose, sshFxpRead, sshFxpWrite, sshFxpFstat, sshFxpFsetstat, sshFxpReaddir:
+		if ssh.Unmarshal(body, &req) != nil {
+			return sess.status(id, sshFxBadMessage, "Malformed request")
+		}
+		if handle = sess.handles[req.Path]; handle == nil {
+			return sess.status(id, sshFxFailure, "Invalid handle")
+		}
+	case sshFxpOpen, sshFxpLstat, sshFxpStat, sshFxpSetstat, sshFxpOpendir, sshFxpRemove, sshFxpMkdir, sshFxpRmdir, sshFxpRealpath, sshFxpRename:
+		if ssh.Unmarshal(body, &req) != nil {
+			return sess.status(id, sshFxBadMessage, "Malformed request")
+		}
+		req.Path = sftpPath(req.Path)
+	default:
+		return sess.status(id, sshFxOpUnsupported, "Unsupported request")
+	}
+
+	switch typ {
+	case sshFxpRealpath:
+		return sess.names(id, []sftpName{{name: req.Path}})
+	case sshFxpStat, sshFxpLstat:
+		info, err := sess.fs.Stat(sess.ctx, req.Path)
+		if err != nil {
+			return sess.fail(id, err)
+		}
+		return sess.send(sshFxpAttrs, append(ssh.Marshal(struct{ ID uint32 }{id}), sftpAttrs(info)...))
+	case sshFxpFstat:
+		info, err := handle.Stat()
+		if err != nil {
+			return sess.fail(id, err)
+		}
+		return sess.send(sshFxpAttrs, append(ssh.Marshal(struct{ ID uint32 }{id}), sftpAttrs(info)...))
+	case sshFxpSetstat, sshFxpFsetstat:
+		// Stored files keep the times and modes the server gave them.
+		return sess.status(id, sshFxOK, "")
+	case sshFxpOpen:
+		return sess.open(id, req.Path, req.Rest)
+	case sshFxpOpendir:
+		if info, err := sess.fs.Stat(sess.ctx, req.Path); err != nil {
+			return sess.fail(id, err)
+		} else if !info.IsDir() {
+			return sess.status(id, sshFxFailure, "Not a directory")
+		}
+		file, err := sess.fs.OpenFile(sess.ctx, req.Path, os.O_RDONLY, 0)
+		if err != nil {
+			return sess.fail(id, err)
+		}
+		return sess.sendHandle(id, file)
+	case sshFxpClose:
+		delete(sess.handles, req.Path)
+		return sess.fail(id, handle.Close())
+	case sshFxpRead:
+		return sess.read(id, handle, req.Rest)
+	case sshFxpWrite:
+		return sess.write(id, handle, req.Rest)
+	case sshFxpReaddir:
+		entries, err := handle.Readdir(100)
+		if errors.Is(err, io.EOF) || err == nil && len(entries) == 0 {
+			return sess.status(id, sshFxEOF, "")
+		}
+		if err != nil {
+			return sess.fail(id, err)
+		}
+		names := make([]sftpName, len(entries))
+		for i, entry := range entries {
+			names[i] = sftpName{name: entry.Name(), info: entry}
+		}
+		return sess.names(id, names)
+	case sshFxpRemove:
+		if info, err := sess.fs.Stat(sess.ctx, req.Path); err != nil {
+			return sess.fail(id, err)
+		} else if info.IsDir() {
+			return sess.status(id, sshFxFailure, "Is a directory")
+		}
+		return sess.fail(id, sess.fs.RemoveAll(sess.ctx, req.Path))
+	case sshFxpRmdir:
+		info, err := sess.fs.Stat(sess.ctx, req.Path)
+		switch {
+		case err != nil:
+			return sess.fail(id, err)
+		case !info.IsDir():
+			return sess.status(id, sshFxFailure, "Not a directory")
+		case len(sess.fs.readDir(davPath(req.Path))) > 0:
+			return sess.status(id, sshFxFailure, "Directory not empty")
+		}
+		return sess.fail(id, sess.fs.RemoveAll(sess.ctx, req.Path))
+	case sshFxpMkdir:
+		return sess.fail(id, sess.fs.Mkdir(sess.ctx, req.Path, 0755))
+	case sshFxpRename:
+		var target struct{ Path string }
+		if ssh.Unmarshal(req.Rest, &target) != nil {
+			return sess.status(id, sshFxBadMessage, "Malformed request")
+		}
+		return sess.fail(id, sess.fs.Rename(sess.ctx, req.Path, sftpPath(target.Path)))
+	}
+	return nil
+}
+
+// open opens a file for reading or starts an upload. Uploads always replace
+// the whole file, appending is refused.
+func (sess *sftpSession) open(id uint32, name string, rest []byte) error {
+	var req struct {
+		Flags uint32
+		Attrs []byte `ssh:"rest"`
+	}
+	if ssh.Unmarshal(rest, &req) != nil {
+		return sess.status(id, sshFxBadMessage, "Malformed request")
+	}
+	if req.Flags&sshFxfAppend != 0 {
+		return sess.status(id, sshFxOpUnsupported, "Appending to uploads is not supported")
+	}
+	flag := os.O_RDONLY
+	if req.Flags&sshFxfWrite != 0 {
+		if req.Flags&sshFxfExcl != 0 {
+			if _, err := sess.fs.Stat(sess.ctx, name); err == nil {
+				return sess.fail(id, os.ErrExist)
+			}
+		}
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	} else if info, err := sess.fs.Stat(sess.ctx, name); err != nil {
+		return sess.fail(id, err)
+	} else if info.IsDir() {
+		return sess.status(id, sshFxFailure, "Is a directory")
+	}
+	file, err := sess.fs.OpenFile(sess.ctx, name, flag, 0644)
+	if err != nil {
+		return sess.fail(id, err)
+	}
+	return sess.sendHandle(id, file)
+}
+
+func (sess *sftpSession) sendHandle(id uint32, file webdav.File) error {
+	sess.next++
+	handle := strconv.Itoa(sess.next)
+	sess.handles[handle] = file
+	return sess.send(sshFxpHandle, ssh.Marshal(struct {
+		ID     uint32
+		Handle string
+	}{id, handle}))
+}
+
+func (sess *sftpSession) read(id uint32, file webdav.File, rest []byte) error {
+	var req struct {
+		Offset uint64
+		Length uint32
+	}
+	if ssh.Unmarshal(rest, &req) != nil {
+		return sess.status(id, sshFxBadMessage, "Malformed request")
+	}
+	if _, err := file.Seek(int64(req.Offset), io.SeekStart); err != nil {
+		return sess.fail(id, err)
+	}
+	data := make([]byte, min(req.Length, sftpMaxPacket-1024))
+	n, err := io.ReadFull(file, data)
+	if n == 0 && errors.Is(err, io.EOF) {
+		return sess.status(id, sshFxEOF, "")
+	}
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return sess.fail(id, err)
+	}
+	return sess.send(sshFxpData, ssh.Marshal(struct {
+		ID   uint32
+		Data []byte
+	}{id, data[:n]}))
+}
+
+// write appends to an upload, which has to be written front to back.
+func (sess *sftpSession) write(id uint32, file webdav.File, rest []byte) error {
+	var req struct {
+		Offset uint64
+		Data   []byte
+	}
+	if ssh.Unmarshal(rest, &req) != nil {
+		return sess.status(id, sshFxBadMessage, "Malformed request")
+	}
+	upload, ok := file.(*davUpload)
+	if !ok {
+		return sess.fail(id, os.ErrPermission)
+	}
+	if int64(req.Offset) != upload.written {
+		return sess.status(id, sshFxFailure, "Uploads must be written sequentially")
+	}
+	_, err := upload.Write(req.Data)
+	return sess.fail(id, err)
+}
+
+// closeAll releases the handles a client left open. Unfinished uploads are
+// dropped instead of stored truncated.
+func (sess *sftpSession) closeAll() {
+	for handle, file := range sess.handles {
+		if upload, ok := file.(*davUpload); ok {
+			upload.abort()
+		} else {
+			file.Close()
+		}
+		delete(sess.handles, handle)
+	}
+}
+
+// sftpName is an entry of a NAME reply. info is nil for REALPATH.
+type sftpName struct {
+	name string
+	info os.FileInfo
+}
+
+func (sess *sftpSession) names(id uint32, names []sftpName) error {
+	body := ssh.Marshal(struct {
+		ID    uint32
+		Count uint32
+	}{id, uint32(len(names))})
+	for _, n := range names {
+		longname := n.name
+		attrs := ssh.Marshal(struct{ Flags uint32 }{0})
+		if n.info != nil {
+			longname = lsLine(n.info)
+			attrs = sftpAttrs(n.info)
+		}
+		body = append(body, ssh.Marshal(struct{ Name, Longname string }{n.name, longname})...)
+		body = append(body, attrs...)
+	}
+	return sess.send(sshFxpName, body)
+}
+
+// lsLine renders info like ls -l does, which is what SFTP and FTP clients
+// expect in listings.
+func lsLine(info os.FileInfo) string {
+	return fmt.Sprintf("%s 1 simpleserver simpleserver %12d %s %s",
+		info.Mode(), info.Size(), info.ModTime().Format("Jan _2 15:04"), info.Name())
+}
+
+// sftpAttrs encodes the size, mode and modification time of info.
+func sftpAttrs(info os.FileInfo) []byte {
+	mode := uint32(info.Mode().Perm())
+	if info.IsDir() {
+		mode |= 0040000
+	} else {
+		mode |= 0100000
+	}
+	mtime := uint32(info.ModTime().Unix())
+	return ssh.Marshal(struct {
+		Flags        uint32
+		Size         uint64
+		Mode         uint32
+		Atime, Mtime uint32
+	}{sshFileXferAttrSize | sshFileXferAttrPermissions | sshFileXferAttrACModTime, uint64(info.Size()), mode, mtime, mtime})
+}
@@ -0,0 +1,244 @@
+package simpleserver
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func startSSH(t *testing.T, config Config) (*Server, string) {
+	t.Helper()
+	s := newTestServer(t, config)
+	sshConfig, err := s.sshConfig()
+	require.NoError(t, err)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go s.acceptSSH(ln, sshConfig)
+	return s, ln.Addr().String()
+}
+
+func dialSSH(t *testing.T, addr string, auth ssh.AuthMethod) (*ssh.Client, error) {
+	t.Helper()
+	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            "anyone",
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err == nil {
+		t.Cleanup(func() { client.Close() })
+	}
+	return client, err
+}
+
+// sftpClient speaks just enough SFTP to drive the server in tests.
+type sftpClient struct {
+	t  *testing.T
+	w  io.Writer
+	r  io.Reader
+	id uint32
+}
+
+func newSFTPClient(t *testing.T, client *ssh.Client) *sftpClient {
+	t.Helper()
+	session, err := client.NewSession()
+	require.NoError(t, err)
+	w, err := session.StdinPipe()
+	require.NoError(t, err)
+	r, err := session.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, session.RequestSubsystem("sftp"))
+	c := &sftpClient{t: t, w: w, r: r}
+	typ, _ := c.roundTrip(sshFxpInit, ssh.Marshal(struct{ Version uint32 }{3}))
+	require.Equal(t, byte(sshFxpVersion), typ)
+	return c
+}
+
+func (c *sftpClient) roundTrip(typ byte, body []byte) (byte, []byte) {
+	c.t.Helper()
+	packet := binary.BigEndian.AppendUint32(nil, uint32(1+len(body)))
+	_, err := c.w.Write(append(append(packet, typ), body...))
+	require.NoError(c.t, err)
+	var header [5]byte
+	_, err = io.ReadFull(c.r, header[:])
+	require.NoError(c.t, err)
+	reply := make([]byte, binary.BigEndian.Uint32(header[:4])-1)
+	_, err = io.ReadFull(c.r, reply)
+	require.NoError(c.t, err)
+	return header[4], reply
+}
+
+// call sends a request with the next id followed by fields and returns the
+// reply without its id.
+func (c *sftpClient) call(typ byte, fields ...any) (byte, []byte) {
+	c.t.Helper()
+	c.id++
+	body := binary.BigEndian.AppendUint32(nil, c.id)
+	for _, field := range fields {
+		switch v := field.(type) {
+		case string:
+			body = append(body, ssh.Marshal(struct{ V string }{v})...)
+		case uint32:
+			body = binary.BigEndian.AppendUint32(body, v)
+		case uint64:
+			body = binary.BigEndian.AppendUint64(body, v)
+		}
+	}
+	replyType, reply := c.roundTrip(typ, body)
+	require.Equal(c.t, c.id, binary.BigEndian.Uint32(reply))
+	return replyType, reply[4:]
+}
+
+func (c *sftpClient) status(typ byte, reply []byte) uint32 {
+	c.t.Helper()
+	require.Equal(c.t, byte(sshFxpStatus), typ)
+	return binary.BigEndian.Uint32(reply)
+}
+
+func (c *sftpClient) handle(typ byte, reply []byte) string {
+	c.t.Helper()
+	require.Equal(c.t, byte(sshFxpHandle), typ, "status %v", reply)
+	var handle struct{ Handle string }
+	require.NoError(c.t, ssh.Unmarshal(reply, &handle))
+	return handle.Handle
+}
+
+func TestSFTPUploadAndDownload(t *testing.T) {
+	s, addr := startSSH(t, Config{AuthToken: testAuthToken})
+	client, err := dialSSH(t, addr, ssh.Password(testAuthToken))
+	require.NoError(t, err)
+	c := newSFTPClient(t, client)
+
+	require.Equal(t, uint32(sshFxOK), c.status(c.call(sshFxpMkdir, "photos", uint32(0))))
+	handle := c.handle(c.call(sshFxpOpen, "/photos/cat.txt", uint32(sshFxfWrite|0x08|0x10), uint32(0)))
+	require.Equal(t, uint32(sshFxOK), c.status(c.call(sshFxpWrite, handle, uint64(0), "me")))
+	require.Equal(t, uint32(sshFxFailure), c.status(c.call(sshFxpWrite, handle, uint64(5), "??")))
+	require.Equal(t, uint32(sshFxOK), c.status(c.call(sshFxpWrite, handle, uint64(2), "ow")))
+	require.Equal(t, uint32(sshFxOK), c.status(c.call(sshFxpClose, handle)))
+	meta, ok := s.index.get("photos", "cat.txt")
+	require.True(t, ok)
+	require.Equal(t, int64(len("meow")), meta.Size)
+
+	handle = c.handle(c.call(sshFxpOpen, "/photos/cat.txt", uint32(sshFxfRead), uint32(0)))
+	typ, reply := c.call(sshFxpRead, handle, uint64(1), uint32(1024))
+	require.Equal(t, byte(sshFxpData), typ)
+	var data struct{ Data string }
+	require.NoError(t, ssh.Unmarshal(reply, &data))
+	require.Equal(t, "eow", data.Data)
+	require.Equal(t, uint32(sshFxEOF), c.status(c.call(sshFxpRead, handle, uint64(4), uint32(1024))))
+	require.Equal(t, uint32(sshFxOK), c.status(c.call(sshFxpClose, handle)))
+
+	handle = c.handle(c.call(sshFxpOpendir, "/photos"))
+	typ, reply = c.call(sshFxpReaddir, handle)
+	require.Equal(t, byte(sshFxpName), typ)
+	require.Equal(t, uint32(1), binary.BigEndian.Uint32(reply))
+	require.Contains(t, string(reply), "cat.txt")
+	require.Equal(t, uint32(sshFxEOF), c.status(c.call(sshFxpReaddir, handle)))
+
+	require.Equal(t, uint32(sshFxOK), c.status(c.call(sshFxpRemove, "/photos/cat.txt")))
+	_, ok = s.index.get("photos", "cat.txt")
+	require.False(t, ok)
+	require.Equal(t, uint32(sshFxNoSuchFile), c.status(c.call(sshFxpStat, "/photos/cat.txt")))
+}
+
+func TestSFTPAuthentication(t *testing.T) {
+	signer := newSSHKey(t)
+	authorizedKeys := filepath.Join(t.TempDir(), "authorized_keys")
+	require.NoError(t, os.WriteFile(authorizedKeys, ssh.MarshalAuthorizedKey(signer.PublicKey()), 0600))
+	s, addr := startSSH(t, Config{AuthToken: testAuthToken, SFTPAuthorizedKeys: authorizedKeys})
+
+	_, err := dialSSH(t, addr, ssh.Password("wrong"))
+	require.Error(t, err)
+	other := newSSHKey(t)
+	_, err = dialSSH(t, addr, ssh.PublicKeys(other))
+	require.Error(t, err)
+	_, err = dialSSH(t, addr, ssh.PublicKeys(signer))
+	require.NoError(t, err)
+
+	// The generated host key is kept for the next start.
+	_, err = os.Stat(filepath.Join(s.config.UploadDir, sftpHostKeyName))
+	require.NoError(t, err)
+
+	_, err = newTestServer(t, Config{}).sshConfig()
+	require.Error(t, err)
+}
+
+func newSSHKey(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	return signer
+}
+
+func TestSCPUpload(t *testing.T) {
+	s, addr := startSSH(t, Config{AuthToken: testAuthToken})
+	req := authorized(httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("notes")), testAuthToken)
+	require.Equal(t, http.StatusCreated, serve(s, req).Code)
+	dir := shareDirs(t, s)[0]
+
+	client, err := dialSSH(t, addr, ssh.Password(testAuthToken))
+	require.NoError(t, err)
+	session, err := client.NewSession()
+	require.NoError(t, err)
+	w, err := session.StdinPipe()
+	require.NoError(t, err)
+	r, err := session.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, session.Start("scp -t -- /"+dir))
+	ack := func() byte {
+		var b [1]byte
+		_, err := io.ReadFull(r, b[:])
+		require.NoError(t, err)
+		return b[0]
+	}
+	require.Equal(t, byte(0), ack())
+	_, err = io.WriteString(w, "C0644 4 dog.txt\n")
+	require.NoError(t, err)
+	require.Equal(t, byte(0), ack())
+	_, err = io.WriteString(w, "woof\x00")
+	require.NoError(t, err)
+	require.Equal(t, byte(0), ack())
+
+	_, err = io.WriteString(w, "C0644 4 ../x.txt\n")
+	require.NoError(t, err)
+	require.Equal(t, byte(1), ack())
+	var exit *ssh.ExitError
+	require.ErrorAs(t, session.Wait(), &exit)
+	require.Equal(t, 1, exit.ExitStatus())
+
+	meta, ok := s.index.get(dir, "dog.txt")
+	require.True(t, ok)
+	require.Equal(t, int64(len("woof")), meta.Size)
+	require.Equal(t, "woof", download(t, s, "/"+dir+"/dog.txt").Body.String())
+}
+
+func TestSCPSinkTarget(t *testing.T) {
+	for command, want := range map[string]string{
+		"scp -t -- /abc":     "/abc",
+		"scp -r -t /abc/x":   "/abc/x",
+		"scp -t -- '/a b'":   "/a b",
+		"scp -t":             ".",
+		"scp -v -d -t -- -x": "-x",
+	} {
+		target, ok := scpSinkTarget(command)
+		require.True(t, ok, command)
+		require.Equal(t, want, target, command)
+	}
+	for _, command := range []string{"scp -f /abc", "ls /", "scp"} {
+		_, ok := scpSinkTarget(command)
+		require.False(t, ok, command)
+	}
+}
@@ -0,0 +1,189 @@
+package simpleserver
+
+import (
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// downloadParam asks a browser visiting a file link for the file itself
+// rather than its share page.
+const downloadParam = "download"
+
+var sharePage = template.Must(template.New("share").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Name}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 40rem; margin: 2rem auto; padding: 0 1rem; line-height: 1.5; color: #222 }
+h1 { font-size: 1.4rem; overflow-wrap: anywhere }
+dl { display: grid; grid-template-columns: auto 1fr; gap: .25rem 1rem }
+dd { margin: 0; overflow-wrap: anywhere }
+code { font-family: ui-monospace, monospace; font-size: .85em }
+img, video, audio { display: block; max-width: 100%; margin: 1rem 0 }
+.link { display: flex; gap: .5rem; margin: 1rem 0 }
+.link input { flex: 1; min-width: 0; padding: .6rem; font-size: 1rem }
+button, .download { padding: .6rem 1rem; font-size: 1rem; border-radius: .3rem; border: 1px solid #0969da; background: #fff; color: #0969da; cursor: pointer }
+.download { display: block; text-align: center; text-decoration: none; background: #0969da; color: #fff }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+{{if eq .Preview "image"}}<img src="{{.InlineURL}}" alt="{{.Name}}">
+{{else if eq .Preview "video"}}<video src="{{.InlineURL}}" controls preload="metadata"></video>
+{{else if eq .Preview "audio"}}<audio src="{{.InlineURL}}" controls preload="metadata"></audio>
+{{else if eq .Preview "text"}}<p><a href="{{.PreviewURL}}">Preview</a></p>
+{{end}}<dl>
+<dt>Size</dt><dd>{{.Size}}</dd>
+{{if .SHA256}}<dt>SHA-256</dt><dd><code>{{.SHA256}}</code></dd>
+{{end}}{{if .ExpiresAt}}<dt>Expires</dt><dd><time id="expires" datetime="{{.ExpiresAt}}">{{.ExpiresAt}}</time></dd>
+{{end}}{{if .Once}}<dt>Downloads</dt><dd>Deleted after the first download</dd>
+{{else if .DownloadsLeft}}<dt>Downloads</dt><dd>{{.DownloadsLeft}} left</dd>
+{{end}}</dl>
+<div class="link"><input id="link" value="{{.Link}}" readonly aria-label="Link"><button id="copy" type="button">Copy link</button></div>
+<a class="download" href="{{.DownloadURL}}">Download</a>
+<script>
+document.getElementById("copy").addEventListener("click", function () {
+  var link = document.getElementById("link"), button = this;
+  var done = function () { button.textContent = "Copied"; setTimeout(function () { button.textContent = "Copy link"; }, 2000); };
+  if (navigator.clipboard) {
+    navigator.clipboard.writeText(link.value).then(done);
+  } else {
+    link.select();
+    document.execCommand("copy");
+    done();
+  }
+});
+var expires = document.getElementById("expires");
+if (expires) {
+  var at = Date.parse(expires.getAttribute("datetime"));
+  var tick = function () {
+    var left = Math.max(0, Math.floor((at - Date.now()) / 1000));
+    if (left === 0) { expires.textContent = "Expired"; return; }
+    var d = Math.floor(left / 86400), h = Math.floor(left % 86400 / 3600), m = Math.floor(left % 3600 / 60), s = left % 60;
+    expires.textContent = "in " + (d ? d + "d " : "") + (d || h ? h + "h " : "") + (d || h || m ? m + "m " : "") + s + "s";
+    setTimeout(tick, 1000);
+  };
+  tick();
+}
+</script>
+</body>
+</html>
+`))
+
+type sharePageData struct {
+	Name          string
+	Size          string
+	SHA256        string
+	ExpiresAt     string
+	Once          bool
+	DownloadsLeft int64
+	// Preview is image, video, audio or text, or empty when the file is
+	// not shown on the page.
+	Preview     string
+	InlineURL   string
+	PreviewURL  string
+	Link        string
+	DownloadURL string
+}
+
+// formatSize writes n bytes the way people read them, as in 1.5 MB.
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// wantsSharePage reports whether a download of meta should be answered with
+// its share page: browsers get it unless they ask for the file with
+// ?download or ?inline. Files the page could not unlock, and pastes, which
+// have a page of their own, are served as before.
+func (s *Server) wantsSharePage(c echo.Context, meta FileMeta) bool {
+	r := c.Request()
+	if r.Method != http.MethodGet || !strings.Contains(r.Header.Get(echo.HeaderAccept), echo.MIMETextHTML) {
+		return false
+	}
+	query := r.URL.Query()
+	if query.Has(downloadParam) || query.Has("inline") {
+		return false
+	}
+	if meta.Paste || meta.Pending || meta.expired(time.Now()) || s.hiddenDropShare(c, meta.Dir) {
+		return false
+	}
+	return meta.PasswordHash == "" || checkPassword(c, meta)
+}
+
+// shareQuery is the query of the request with extra set, minus the
+// parameters that only made sense for it. A password the visitor typed in is
+// kept on the download links but left out of the link they copy.
+func shareQuery(r *http.Request, keepPassword bool, extra string) string {
+	query := r.URL.Query()
+	query.Del(downloadParam)
+	query.Del("inline")
+	if !keepPassword {
+		query.Del("password")
+	}
+	if extra != "" {
+		query.Set(extra, "1")
+	}
+	if len(query) == 0 {
+		return ""
+	}
+	return "?" + query.Encode()
+}
+
+// serveSharePage answers a browser visiting the link of meta with a page
+// showing what the file is and how to get it.
+func (s *Server) serveSharePage(c echo.Context, meta FileMeta) error {
+	r := c.Request()
+	link := s.downloadURL(c, meta.Dir, meta.Name)
+	data := sharePageData{
+		Name:        meta.displayName(),
+		Size:        formatSize(meta.Size),
+		SHA256:      meta.SHA256,
+		Once:        meta.Once,
+		Link:        link + shareQuery(r, false, ""),
+		DownloadURL: link + shareQuery(r, true, downloadParam),
+	}
+	if !meta.ExpiresAt.IsZero() {
+		data.ExpiresAt = meta.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	if meta.MaxDownloads > 0 {
+		data.DownloadsLeft = max(meta.MaxDownloads-meta.Downloads, 0)
+	}
+	// Showing files that downloads use up would use them up.
+	if !meta.Once && meta.MaxDownloads == 0 {
+		mediaType, _, _ := mime.ParseMediaType(meta.contentType())
+		kind, _, _ := strings.Cut(mediaType, "/")
+		switch {
+		case kind == "image" || kind == "video" || kind == "audio":
+			data.Preview = kind
+			data.InlineURL = link + shareQuery(r, true, "inline")
+		case previewable(meta):
+			data.Preview = "text"
+			data.PreviewURL = link + "/" + previewPathSuffix + shareQuery(r, true, "")
+		}
+	}
+
+	var page strings.Builder
+	if err := sharePage.Execute(&page, data); err != nil {
+		return err
+	}
+	c.Response().Header().Set(echo.HeaderCacheControl, "private, no-cache")
+	s.pageCSP(c, uiCSP)
+	return c.HTML(http.StatusOK, page.String())
+}
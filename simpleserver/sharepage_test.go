@@ -0,0 +1,78 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func browse(t *testing.T, s *Server, rawURL string) *httptest.ResponseRecorder {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodGet, u.RequestURI(), nil)
+	req.Header.Set(echo.HeaderAccept, "text/html,application/xhtml+xml,*/*;q=0.8")
+	return serve(s, req)
+}
+
+func TestBrowsersGetSharePage(t *testing.T) {
+	s := newTestServer(t, Config{TTL: time.Hour})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/report.txt", strings.NewReader("quarterly numbers")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	link := downloadURLs(t, rec.Body.String())[0]
+
+	rec = browse(t, s, link)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Header().Get(echo.HeaderContentType), "text/html")
+	require.Contains(t, rec.Header().Values(echo.HeaderVary), echo.HeaderAccept)
+	page := rec.Body.String()
+	require.Contains(t, page, "<h1>report.txt</h1>")
+	require.Contains(t, page, "17 B")
+	require.Contains(t, page, sha256Hex("quarterly numbers"))
+	require.Contains(t, page, `id="expires"`)
+	require.Contains(t, page, `value="`+link+`"`)
+	require.Contains(t, page, `href="`+link+`?download=1"`)
+	require.Contains(t, page, `href="`+link+`/preview"`)
+
+	require.Equal(t, "quarterly numbers", browse(t, s, link+"?download=1").Body.String())
+	rec = download(t, s, link)
+	require.Equal(t, "quarterly numbers", rec.Body.String())
+	require.Contains(t, rec.Header().Values(echo.HeaderVary), echo.HeaderAccept)
+
+	s = newTestServer(t, Config{NoSharePage: true})
+	rec = serve(s, httptest.NewRequest(http.MethodPut, "/report.txt", strings.NewReader("quarterly numbers")))
+	require.Equal(t, "quarterly numbers", browse(t, s, downloadURLs(t, rec.Body.String())[0]).Body.String())
+}
+
+func TestSharePageOfProtectedFiles(t *testing.T) {
+	s := newTestServer(t, Config{})
+	req := httptest.NewRequest(http.MethodPut, "/secret.png", strings.NewReader("not really a png"))
+	req.Header.Set(passwordHeader, "hunter2")
+	req.Header.Set(onceHeader, "true")
+	rec := serve(s, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	link := downloadURLs(t, rec.Body.String())[0]
+
+	require.Equal(t, http.StatusUnauthorized, browse(t, s, link).Code)
+	page := browse(t, s, link+"?password=hunter2").Body.String()
+	require.Contains(t, page, "Deleted after the first download")
+	require.NotContains(t, page, "<img")
+	require.Contains(t, page, `value="`+link+`"`)
+	require.Contains(t, page, `href="`+link+`?download=1&amp;password=hunter2"`)
+
+	// Showing the page does not use up the download.
+	require.Equal(t, "not really a png", browse(t, s, link+"?download=1&password=hunter2").Body.String())
+	require.Equal(t, http.StatusNotFound, browse(t, s, link+"?download=1&password=hunter2").Code)
+}
+
+func TestFormatSize(t *testing.T) {
+	require.Equal(t, "512 B", formatSize(512))
+	require.Equal(t, "1.5 KB", formatSize(1536))
+	require.Equal(t, "2.0 GB", formatSize(2<<30))
+}
@@ -0,0 +1,35 @@
+package simpleserver
+
+import (
+	"fmt"
+
+	"github.com/labstack/echo/v4"
+)
+
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// aliasLength is the length of short link ids, shorter than the share dirs
+// they stand for. Ids are random base62 rather than sequential: the 62^5 of
+// them are too many to walk through the uploads, and the id of a deleted
+// upload is not handed out again but by a long chance.
+const aliasLength = 5
+
+func base62(size int) string {
+	return randomString(base62Alphabet, size)
+}
+
+func (s *Server) shortURL(c echo.Context, alias string) string {
+	return fmt.Sprintf("%s/s/%s", s.baseURL(c), alias)
+}
+
+// handleShortLink serves the file an alias points to.
+func (s *Server) handleShortLink(c echo.Context) error {
+	meta, ok := s.index.resolveAlias(c.Param("alias"))
+	if !ok {
+		return s.fileNotFound(c)
+	}
+	if !s.mayDownload(c, meta) {
+		return s.restrictedDownload(c)
+	}
+	return s.serveFile(c, meta.Dir, meta.Name)
+}
@@ -0,0 +1,85 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// shortLink extracts the alias link printed in an upload response.
+func shortLink(t *testing.T, body string) string {
+	t.Helper()
+	return responseLine(t, body, "Short link: ")
+}
+
+func TestShortLinkDownload(t *testing.T) {
+	s := newTestServer(t, Config{ShortLinks: true})
+	var links []string
+	for _, content := range []string{"first file", "second file"} {
+		rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader(content)))
+		require.Equal(t, http.StatusCreated, rec.Code)
+		links = append(links, shortLink(t, rec.Body.String()))
+	}
+	for _, link := range links {
+		require.Regexp(t, `^http://example\.com/s/[`+base62Alphabet+`]{5}$`, link)
+	}
+	require.NotEqual(t, links[0], links[1])
+
+	rec := download(t, s, links[1])
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "second file", rec.Body.String())
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, "/s/zzz", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestShortLinksDisabledByDefault(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("notes")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.NotContains(t, rec.Body.String(), "Short link")
+}
+
+func TestShortLinksSurviveRestart(t *testing.T) {
+	s := newTestServer(t, Config{ShortLinks: true})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("notes")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	link := shortLink(t, rec.Body.String())
+
+	restarted := newTestServer(t, Config{ShortLinks: true, UploadDir: s.config.UploadDir})
+	rec = download(t, restarted, link)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "notes", rec.Body.String())
+}
+
+func TestShortLinksAreNotReusedAfterRestart(t *testing.T) {
+	s := newTestServer(t, Config{ShortLinks: true})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("notes")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	link := shortLink(t, rec.Body.String())
+	meta := findMeta(t, s, "notes.txt")
+	require.NoError(t, s.index.delete(meta.Dir, meta.Name))
+
+	restarted := newTestServer(t, Config{ShortLinks: true, UploadDir: s.config.UploadDir})
+	rec = serve(restarted, httptest.NewRequest(http.MethodPut, "/other.txt", strings.NewReader("other")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.NotEqual(t, link, shortLink(t, rec.Body.String()))
+	require.Equal(t, http.StatusNotFound, serve(restarted, httptest.NewRequest(http.MethodGet, link, nil)).Code)
+}
+
+func TestNextAliasReservesTheID(t *testing.T) {
+	ix := newMetaIndex(sidecarStore{root: t.TempDir()})
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		alias := ix.nextAlias("abc/notes.txt")
+		require.Len(t, alias, aliasLength)
+		require.False(t, seen[alias])
+		seen[alias] = true
+	}
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	require.Len(t, ix.aliases, 100, "every id is reserved when it is handed out")
+}
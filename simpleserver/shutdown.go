@@ -0,0 +1,70 @@
+package simpleserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/http2"
+)
+
+const defaultGracePeriod = 30 * time.Second
+
+// serve runs e until it fails or shutdownC is closed, then lets in-flight
+// requests finish for up to GracePeriod. Plain HTTP also accepts HTTP/2
+// without TLS (h2c), which cloudflared can multiplex its origin requests
+// over; HTTPS negotiates HTTP/2 as usual.
+func (s *Server) serve(e *echo.Echo, shutdownC <-chan struct{}) error {
+	errC := make(chan error, 1)
+	go func() {
+		if e.TLSListener != nil {
+			errC <- e.StartServer(e.TLSServer)
+			return
+		}
+		errC <- e.StartH2CServer("", &http2.Server{})
+	}()
+
+	select {
+	case err := <-errC:
+		return err
+	case <-shutdownC:
+	}
+
+	grace := s.config.GracePeriod
+	if grace <= 0 {
+		grace = defaultGracePeriod
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			e.Close()
+			return fmt.Errorf("graceful shutdown timed out after %s", grace)
+		}
+		return err
+	}
+	if err := <-errC; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func waitForSignal(graceShutdownC chan struct{}) {
+	signals := make(chan os.Signal, 10)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+
+	select {
+	case s := <-signals:
+		log.Printf("Initiating graceful shutdown due to signal %s ...\n", s)
+		close(graceShutdownC)
+	case <-graceShutdownC:
+	}
+}
@@ -0,0 +1,116 @@
+package simpleserver
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+)
+
+// startServing runs s on a free port and returns its address, the channel
+// triggering shutdown and the channel serve's result arrives on.
+func startServing(t *testing.T, s *Server) (string, chan struct{}, chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	e := s.newRouter()
+	e.Listener = ln
+	shutdownC := make(chan struct{})
+	errC := make(chan error, 1)
+	go func() { errC <- s.serve(e, shutdownC) }()
+	return ln.Addr().String(), shutdownC, errC
+}
+
+// pipedUpload starts a PUT whose body is written through the returned pipe.
+func pipedUpload(t *testing.T, addr string) (*io.PipeWriter, chan *http.Response) {
+	t.Helper()
+	body, w := io.Pipe()
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("http://%s/slow.txt", addr), body)
+	require.NoError(t, err)
+	respC := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			respC <- nil
+			return
+		}
+		resp.Body.Close()
+		respC <- resp
+	}()
+	return w, respC
+}
+
+// waitForSpool waits until an upload is being received, so the server
+// counts it as in flight.
+func waitForSpool(t *testing.T, s *Server) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		entries, _ := os.ReadDir(filepath.Join(s.getUploadDir(), spoolDirName))
+		return len(entries) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestShutdownWaitsForInFlightUploads(t *testing.T) {
+	s := newTestServer(t, Config{GracePeriod: 5 * time.Second})
+	addr, shutdownC, errC := startServing(t, s)
+
+	w, respC := pipedUpload(t, addr)
+	first := strings.Repeat("a", 64*1024)
+	_, err := w.Write([]byte(first))
+	require.NoError(t, err)
+	waitForSpool(t, s)
+	close(shutdownC)
+	time.Sleep(100 * time.Millisecond)
+	_, err = w.Write([]byte("end"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	resp := <-respC
+	require.NotNil(t, resp)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.NoError(t, <-errC)
+	require.Equal(t, first+"end", download(t, s, "/"+findMeta(t, s, "slow.txt").key()).Body.String())
+}
+
+func TestShutdownTimesOut(t *testing.T) {
+	s := newTestServer(t, Config{GracePeriod: 50 * time.Millisecond})
+	addr, shutdownC, errC := startServing(t, s)
+
+	w, _ := pipedUpload(t, addr)
+	defer w.Close()
+	_, err := w.Write(make([]byte, 64*1024))
+	require.NoError(t, err)
+	waitForSpool(t, s)
+	close(shutdownC)
+
+	require.EqualError(t, <-errC, "graceful shutdown timed out after 50ms")
+}
+
+func TestServeAcceptsH2C(t *testing.T) {
+	s := newTestServer(t, Config{})
+	addr, shutdownC, errC := startServing(t, s)
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	resp, err := client.Get("http://" + addr + livePath)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, 2, resp.ProtoMajor)
+
+	close(shutdownC)
+	require.NoError(t, <-errC)
+}
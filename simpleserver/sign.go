@@ -0,0 +1,140 @@
+package simpleserver
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultSignedURLTTL = time.Hour
+	maxSignedURLTTL     = 7 * 24 * time.Hour
+)
+
+type signResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// newSigningKey returns Config.URLSigningKey, or a random key that only
+// lives as long as the process when there is none.
+func newSigningKey(configured string) ([]byte, error) {
+	if configured != "" {
+		return []byte(configured), nil
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (s *Server) sign(subject string, expires int64) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte(subject + "\n" + strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// signDownload returns the signature of a download of dir/name that is valid
+// until the unix time expires.
+func (s *Server) signDownload(dir, name string, expires int64) string {
+	return s.sign(metaKey(dir, name), expires)
+}
+
+// signListing returns the signature of the listing of dir, and of its zip,
+// valid until the unix time expires. The leading slash keeps it apart from
+// the signatures of downloads, whose keys never start with one.
+func (s *Server) signListing(dir string, expires int64) string {
+	return s.sign("/"+dir, expires)
+}
+
+// signedQuery returns the query of a link signed with sig until expires.
+func signedQuery(expires int64, sig string) string {
+	return "?expires=" + strconv.FormatInt(expires, 10) + "&sig=" + sig
+}
+
+// signedRequest reports whether the request carries a signature, and
+// whether it is a valid one that has not expired, as computed by sign.
+func signedRequest(c echo.Context, sign func(expires int64) string) (signed, valid bool) {
+	sig := c.QueryParam("sig")
+	if sig == "" {
+		return false, false
+	}
+	expires, err := strconv.ParseInt(c.QueryParam("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return true, false
+	}
+	return true, hmac.Equal([]byte(sig), []byte(sign(expires)))
+}
+
+// signedDownload reports whether the request carries a signature, and
+// whether it is a valid one for dir/name that has not expired.
+func (s *Server) signedDownload(c echo.Context, dir, name string) (signed, valid bool) {
+	return signedRequest(c, func(expires int64) string { return s.signDownload(dir, name, expires) })
+}
+
+// signedListing is signedDownload for the listing of dir.
+func (s *Server) signedListing(c echo.Context, dir string) (signed, valid bool) {
+	return signedRequest(c, func(expires int64) string { return s.signListing(dir, expires) })
+}
+
+// signedURLTTL parses ?ttl=<duration>, defaultSignedURLTTL without one.
+func signedURLTTL(c echo.Context) (time.Duration, bool) {
+	value := c.QueryParam("ttl")
+	if value == "" {
+		return defaultSignedURLTTL, true
+	}
+	ttl, err := time.ParseDuration(value)
+	return ttl, err == nil && ttl > 0 && ttl <= maxSignedURLTTL
+}
+
+func badSignedURLTTL(c echo.Context) error {
+	return fail(c, http.StatusBadRequest, "ttl must be a positive duration of at most "+maxSignedURLTTL.String())
+}
+
+// handleSign answers POST /:dir/:filename/sign with a download link that
+// works without credentials until it expires, ?ttl=<duration> after now.
+func (s *Server) handleSign(c echo.Context, dir, name string) error {
+	if s.settings().AuthToken == "" {
+		return fail(c, http.StatusNotFound, "Not found")
+	}
+	if !validBearer(c.Request(), s.settings().AuthToken) {
+		return authUnauthorized(c)
+	}
+	ttl, ok := signedURLTTL(c)
+	if !ok {
+		return badSignedURLTTL(c)
+	}
+	if _, ok := s.index.get(dir, name); !ok {
+		return fail(c, http.StatusNotFound, "File not found")
+	}
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second).UTC()
+	expires := expiresAt.Unix()
+	url := s.downloadURL(c, dir, name) + signedQuery(expires, s.signDownload(dir, name, expires))
+	return c.JSON(http.StatusOK, signResponse{URL: url, ExpiresAt: expiresAt})
+}
+
+// handleShareLink answers POST /admin/shares/:dir/link with a link to the
+// listing of dir that works without credentials until it expires,
+// ?ttl=<duration> after now. The listing it opens links its files and its
+// zip with signatures that expire along with it.
+func (s *Server) handleShareLink(c echo.Context) error {
+	dir := c.Param("dir")
+	ttl, ok := signedURLTTL(c)
+	if !ok {
+		return badSignedURLTTL(c)
+	}
+	if !isShareDir(dir) || s.claimedByDropShare(dir) || !s.index.hasDir(dir) {
+		return fail(c, http.StatusNotFound, "Directory not found")
+	}
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second).UTC()
+	expires := expiresAt.Unix()
+	url := s.baseURL(c) + "/" + dir + signedQuery(expires, s.signListing(dir, expires))
+	return c.JSON(http.StatusOK, signResponse{URL: url, ExpiresAt: expiresAt})
+}
@@ -0,0 +1,132 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func protectedServer(t *testing.T) (*Server, FileMeta) {
+	t.Helper()
+	s := newTestServer(t, Config{AuthToken: testAuthToken, ProtectDownloads: true, URLSigningKey: "sign-secret"})
+	req := authorized(httptest.NewRequest(http.MethodPut, "/report.txt", strings.NewReader("quarterly numbers")), testAuthToken)
+	require.Equal(t, http.StatusCreated, serve(s, req).Code)
+	return s, findMeta(t, s, "report.txt")
+}
+
+func signURL(t *testing.T, s *Server, meta FileMeta, query string) signResponse {
+	t.Helper()
+	req := authorized(httptest.NewRequest(http.MethodPost, "/"+meta.Dir+"/"+meta.Name+"/sign"+query, nil), testAuthToken)
+	rec := serve(s, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp signResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestSignedURLBypassesDownloadAuth(t *testing.T) {
+	s, meta := protectedServer(t)
+	require.Equal(t, http.StatusUnauthorized, download(t, s, "/"+meta.Dir+"/report.txt").Code)
+
+	signed := signURL(t, s, meta, "?ttl=10m")
+	require.WithinDuration(t, time.Now().Add(10*time.Minute), signed.ExpiresAt, 2*time.Second)
+	rec := download(t, s, signed.URL)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "quarterly numbers", rec.Body.String())
+
+	rec = serve(s, rangeRequest(signed.URL, "bytes=0-8"))
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	require.Equal(t, "quarterly", rec.Body.String())
+}
+
+func TestSignedURLRejectsTampering(t *testing.T) {
+	s, meta := protectedServer(t)
+	req := authorized(httptest.NewRequest(http.MethodPut, "/other.txt", strings.NewReader("other")), testAuthToken)
+	require.Equal(t, http.StatusCreated, serve(s, req).Code)
+	other := findMeta(t, s, "other.txt")
+
+	u, err := url.Parse(signURL(t, s, meta, "").URL)
+	require.NoError(t, err)
+	query := u.Query()
+
+	u.Path = "/" + other.Dir + "/other.txt"
+	require.Equal(t, http.StatusUnauthorized, download(t, s, u.String()).Code)
+
+	u.Path = "/" + meta.Dir + "/report.txt"
+	query.Set("expires", strconv.FormatInt(time.Now().Add(30*24*time.Hour).Unix(), 10))
+	u.RawQuery = query.Encode()
+	require.Equal(t, http.StatusUnauthorized, download(t, s, u.String()).Code)
+
+	// With the right token the bad signature is still refused.
+	rec := serve(s, authorized(httptest.NewRequest(http.MethodGet, u.String(), nil), testAuthToken))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestSignedURLExpires(t *testing.T) {
+	s, meta := protectedServer(t)
+	expires := time.Now().Add(-time.Minute).Unix()
+	u := "/" + meta.Dir + "/report.txt?expires=" + strconv.FormatInt(expires, 10) + "&sig=" + s.signDownload(meta.Dir, meta.Name, expires)
+	require.Equal(t, http.StatusUnauthorized, download(t, s, u).Code)
+}
+
+func TestSignRequiresAuth(t *testing.T) {
+	s, meta := protectedServer(t)
+	rec := serve(s, httptest.NewRequest(http.MethodPost, "/"+meta.Dir+"/report.txt/sign", nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	for _, ttl := range []string{"forever", "-1h", "720h"} {
+		req := authorized(httptest.NewRequest(http.MethodPost, "/"+meta.Dir+"/report.txt/sign?ttl="+ttl, nil), testAuthToken)
+		require.Equal(t, http.StatusBadRequest, serve(s, req).Code, ttl)
+	}
+	req := authorized(httptest.NewRequest(http.MethodPost, "/"+meta.Dir+"/missing.txt/sign", nil), testAuthToken)
+	require.Equal(t, http.StatusNotFound, serve(s, req).Code)
+
+	open := newTestServer(t, Config{})
+	require.Equal(t, http.StatusNotFound, serve(open, httptest.NewRequest(http.MethodPost, "/"+meta.Dir+"/report.txt/sign", nil)).Code)
+}
+
+func TestShareLinkOpensListing(t *testing.T) {
+	s := newTestServer(t, Config{AuthToken: testAuthToken, AdminToken: testAdminToken, ProtectDownloads: true, URLSigningKey: "sign-secret"})
+	rec := serve(s, authorized(multipartRequest(t, http.MethodPost, "/", testPart{"a.txt", "first"}, testPart{"b.txt", "second"}), testAuthToken))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	dir := shareDirs(t, s)[0]
+
+	require.Equal(t, http.StatusNotFound, serve(s, adminRequest(http.MethodPost, "/admin/shares/missing/link", "")).Code)
+	require.Equal(t, http.StatusBadRequest, serve(s, adminRequest(http.MethodPost, "/admin/shares/"+dir+"/link?ttl=720h", "")).Code)
+	rec = serve(s, adminRequest(http.MethodPost, "/admin/shares/"+dir+"/link?ttl=10m", ""))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var link signResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &link))
+	require.WithinDuration(t, time.Now().Add(10*time.Minute), link.ExpiresAt, 2*time.Second)
+
+	require.Equal(t, http.StatusUnauthorized, serve(s, jsonRequest(httptest.NewRequest(http.MethodGet, "/"+dir, nil))).Code)
+	rec = serve(s, jsonRequest(httptest.NewRequest(http.MethodGet, link.URL, nil)))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var listing listingResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &listing))
+	require.Len(t, listing.Files, 2)
+	require.Equal(t, "first", download(t, s, listing.Files[0].URL).Body.String())
+	rec = download(t, s, listing.ZipURL)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "application/zip", rec.Header().Get("Content-Type"))
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, link.URL, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "b.txt")
+
+	// The signature covers the directory and the deadline.
+	u, err := url.Parse(link.URL)
+	require.NoError(t, err)
+	u.Path = "/other"
+	require.Equal(t, http.StatusForbidden, serve(s, httptest.NewRequest(http.MethodGet, u.String(), nil)).Code)
+	expired := time.Now().Add(-time.Minute).Unix()
+	target := "/" + dir + signedQuery(expired, s.signListing(dir, expired))
+	require.Equal(t, http.StatusForbidden, serve(s, httptest.NewRequest(http.MethodGet, target, nil)).Code)
+}
@@ -1,29 +1,468 @@
 package simpleserver
 
 import (
-	"crypto/rand"
+	"crypto/ed25519"
 	"fmt"
-	"io"
 	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
-	"os/signal"
 	"path/filepath"
-	"syscall"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/urfave/cli/v2"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Config struct {
-	Port      int
-	MaxSize   int
-	UploadDir string
+	Port int
+	// AutoPort moves on to the next free port when Port is taken.
+	AutoPort bool
+	// Listen binds these host:port addresses and UnixSocket a unix socket
+	// instead of Port, so the HTTP port need not be exposed at all.
+	Listen     []string
+	UnixSocket string
+	// TLSCert and TLSKey serve HTTPS with the given PEM files, and
+	// TLSSelfSigned with a certificate generated at startup.
+	TLSCert       string
+	TLSKey        string
+	TLSSelfSigned bool
+	// AutoTLSDomains gets certificates for these names from Let's Encrypt,
+	// cached in AutoTLSCacheDir, <state-dir>/autocert or <upload-dir>/.autocert.
+	AutoTLSDomains  []string
+	AutoTLSCacheDir string
+	// GracePeriod is how long Start waits for in-flight requests after
+	// SIGINT or SIGTERM before giving up. It follows cloudflared's
+	// --grace-period and defaults to 30s.
+	GracePeriod time.Duration
+	MaxSize     int
+	UploadDir   string
+	// StateDir holds everything the server writes when set: uploads and
+	// their metadata in uploads/, temporary files in tmp/, the autocert
+	// cache and the generated SFTP host key. A writable volume mounted there
+	// is all the server needs on a read-only root filesystem.
+	StateDir string
+	// MaxTotalSize caps, in MB, the space all uploads may take together.
+	// EvictOldest makes room for new uploads by deleting the oldest ones
+	// instead of rejecting them.
+	MaxTotalSize int
+	EvictOldest  bool
+	// MinFreeSpace is the MB that must stay free on the disk of the upload
+	// dir for /readyz to report ready. 0 disables the check.
+	MinFreeSpace int
+	// Storage selects the backend files are kept in: the upload dir when
+	// empty, "memory", or "s3://bucket[/prefix]". Metadata and in-flight
+	// uploads always live in the upload dir.
+	Storage    string
+	S3Endpoint string
+	S3Region   string
+	// PreservePaths keeps the relative directories of multipart filenames,
+	// such as those of a folder upload, under the share dir instead of
+	// flattening them to the base name. Parts whose path is absolute or
+	// holds ".." or empty segments fail as unsafe rather than being cleaned
+	// up, which answers 400 unless MultipartOnError skips them.
+	PreservePaths bool
+	// MirrorTo replicates every stored upload to a second backend in the
+	// background: "memory", "s3://bucket[/prefix]" or "file:///path".
+	MirrorTo string
+	// MetadataStore selects how the metadata index is persisted: a JSON
+	// sidecar per upload when empty or "files", "journal" for a single
+	// append-only file that is read at once on startup, or a redis:// URL
+	// for an index several servers share.
+	MetadataStore string
+	// StrictFilename rejects uploads whose name sanitizes to nothing
+	// instead of storing them as "uploaded-file".
+	StrictFilename bool
+	// NameStrategy is NameOriginal (default), NameHash or NameRandom.
+	NameStrategy string
+	// TarMaxEntries and TarMaxSize (in MB) cap archives uploaded with
+	// ?extract=1. TarMaxEntrySize (in MB) caps each of their files and
+	// defaults to MaxSize.
+	TarMaxEntries   int
+	TarMaxSize      int
+	TarMaxEntrySize int
+	// TTL deletes uploads this long after they were stored. Buckets may
+	// set their own. The reaper checks for expired files every
+	// ReapInterval.
+	TTL          time.Duration
+	ReapInterval time.Duration
+	// GCInterval is how often empty share dirs, stale .part files and the
+	// metadata of missing files are cleaned up, hourly by default.
+	GCInterval time.Duration
+	// NoReconcile skips adopting stored files the metadata index lacks and
+	// tombstoning entries of missing files on startup.
+	NoReconcile bool
+	// ReadOnly starts the server in read-only mode, which POST /admin/mode
+	// switches off. Reconciliation is skipped then.
+	ReadOnly bool
+	// ScrubInterval is how often every stored upload is read back and
+	// checked against its SHA-256, quarantining the corrupted ones. Off
+	// when 0.
+	ScrubInterval time.Duration
+	// ScrubSpeed caps the bytes per second the scrubber reads, written like
+	// 512K or 10M, so it does not compete with downloads.
+	ScrubSpeed string
+	// TrashPeriod keeps expired and deleted uploads in the trash this long,
+	// where POST /admin/files/:id/restore can bring them back. They are
+	// deleted at once when 0.
+	TrashPeriod time.Duration
+	// RetentionFile holds rules deleting uploads by name and share dir
+	// sooner than TTL or past a number of files per dir, see
+	// loadRetention.
+	RetentionFile string
+	// NoUI disables the upload page served at GET /.
+	NoUI bool
+	// NoSharePage serves browsers visiting a file link the file itself
+	// rather than a page showing it with a download button.
+	NoSharePage bool
+	// APIDocs serves Swagger UI at /docs, showing the OpenAPI document
+	// always served at /openapi.json. A share dir named docs can then no
+	// longer be listed.
+	APIDocs bool
+	// TemplatesDir holds templates replacing the upload page, the answer
+	// to uploads and the page of missing files, see loadTemplates.
+	TemplatesDir string
+	// Lang is the language of the web UI and of error messages for clients
+	// whose Accept-Language names none of the catalogs in i18n.go.
+	Lang string
+	// NoFetch disables POST /fetch, which downloads a public URL into a new
+	// share within FetchTimeout, 10 minutes by default.
+	NoFetch      bool
+	FetchTimeout time.Duration
+	// ClipTTL is how long clips put to /clip/<name> are held in memory, 10
+	// minutes by default.
+	ClipTTL time.Duration
+	// CORSOrigins are the origins browsers may call the server from, any
+	// when empty. CORSMethods narrows the methods they may use and
+	// CORSCredentials lets them send cookies and Authorization headers.
+	// NoCORS answers no cross-origin request at all.
+	CORSOrigins     []string
+	CORSMethods     []string
+	CORSCredentials bool
+	NoCORS          bool
+	// AllowCIDRs, when set, admits only clients in these ranges and
+	// DenyCIDRs refuses clients in them. The client address, also used by
+	// rate limits and logs, is taken from CF-Connecting-IP and
+	// X-Forwarded-For when TrustedProxies names the peer, and defaults to
+	// loopback addresses for cloudflared running on the same host.
+	AllowCIDRs     []string
+	DenyCIDRs      []string
+	TrustedProxies []string
+	// ContentSecurityPolicy, FrameOptions and ReferrerPolicy are sent with
+	// every response and default to strict values, "off" leaves one out.
+	// X-Content-Type-Options: nosniff is always sent.
+	ContentSecurityPolicy string
+	FrameOptions          string
+	ReferrerPolicy        string
+	// ProxyTarget forwards every request outside /files to this upstream
+	// URL, WebSockets included, so one hostname serves an app and the file
+	// share under /files.
+	ProxyTarget string
+	// ServeDir turns the server into a read-only static file server for the
+	// files below this directory, with index pages for directories lacking
+	// an index.html. Uploads are disabled.
+	ServeDir string
+	// ShortLinks additionally returns a random /s/:alias link.
+	ShortLinks bool
+	// PublicURL is the scheme and host links handed to clients start with.
+	// When empty they follow the request, honoring X-Forwarded-Proto and
+	// X-Forwarded-Host from TrustedProxies.
+	PublicURL string
+	// AllowCustomPaths stores a PUT to /<slug>/<filename> under <slug>
+	// instead of a random dir, as X-Custom-Path: true does per request.
+	AllowCustomPaths bool
+	// SlugLength is the length of random upload dirs, 6 by default.
+	SlugLength int
+	// IDScheme picks how random upload dirs are named: base58, uuid or
+	// words. SlugLength only applies to base58, the default.
+	IDScheme string
+	// EnableQR serves a QR code of every download link at
+	// /:dir/:filename/qr.
+	EnableQR bool
+	// NoThumbnails stops serving image thumbnails at
+	// /:dir/:filename/thumb?w=320.
+	NoThumbnails bool
+	// WebDAV serves the uploads at /dav/ to be mounted as a network drive,
+	// guarded by AuthToken.
+	WebDAV bool
+	// SFTPPort serves the same files over SFTP and scp. Clients log in with
+	// AuthToken as password or a key from SFTPAuthorizedKeys. The host key
+	// is read from SFTPHostKey, or generated in the state or upload dir.
+	SFTPPort           int
+	SFTPHostKey        string
+	SFTPAuthorizedKeys string
+	// FTPPort serves passive mode FTP for devices that speak nothing else.
+	// Every login uploads into a share dir of its own. The password is
+	// AuthToken when one is set. FTPPassivePorts is the "min-max" range
+	// data connections listen on.
+	FTPPort         int
+	FTPPassivePorts string
+	// GRPCPort serves the FileService of fileservice.proto, guarded by
+	// AuthToken.
+	GRPCPort int
+	// S3Port serves a subset of the S3 API, with share dirs as buckets.
+	// Requests are signed with S3AccessKey as access key ID and AuthToken as
+	// secret key.
+	S3Port      int
+	S3AccessKey string
+	// MultipartOnError is "abort" (default) to drop a whole multipart
+	// batch when one part fails, or "skip" to keep the valid parts.
+	MultipartOnError string
+	// JSONResponses answers uploads and directory listings with JSON even
+	// to clients that do not send Accept: application/json.
+	JSONResponses bool
+	// Fsync syncs every upload, and every journal record, to disk before it
+	// is acknowledged. An upload whose Sync fails is answered with 500 and
+	// its partial file is removed.
+	Fsync bool
+	// AckTimeout holds the upload response until the storage backend
+	// confirms the file is durable, answering 504 once it expires.
+	AckTimeout time.Duration
+	// ReceiptKeyFile holds the Ed25519 seed used to sign upload receipts.
+	// Receipts are only issued when it is set.
+	ReceiptKeyFile string
+	// EncryptKey is the hex encoded AES-256 key uploads are encrypted with
+	// at rest, or "auto" for a key generated at startup.
+	EncryptKey string
+	// CompressAtRest gzips uploads on disk unless their content type
+	// matches one of CompressSkipTypes. Responses of those types are not
+	// compressed either.
+	CompressAtRest    bool
+	CompressSkipTypes []string
+	// Precompress stores gzip and zstd variants of text uploads next to
+	// them, served to clients accepting them without compressing every
+	// download again.
+	Precompress bool
+	// Dedupe stores uploads with the same content once, linking every
+	// further copy to it.
+	Dedupe bool
+	// ClamAVAddress scans every upload with the clamd listening there
+	// before it is stored.
+	ClamAVAddress string
+	// AllowExtensions, when set, limits uploads to files with one of these
+	// extensions whose content matches them. BlockMIME refuses content
+	// types, or type prefixes ending in "/", by extension and content.
+	AllowExtensions []string
+	BlockMIME       []string
+	// VerifyContent refuses uploads whose content is HTML, XML or an
+	// executable while their extension declares another type.
+	VerifyContent bool
+	// ProcessingDelay holds new uploads back from downloads for at least
+	// this long while the processing pool works on them.
+	ProcessingDelay   time.Duration
+	ProcessingWorkers int
+	UploadTokens      []UploadToken
+	AdminToken        string
+	// AuthToken, when set, must be presented as a bearer token to upload,
+	// and to download as well with ProtectDownloads.
+	AuthToken        string
+	ProtectDownloads bool
+	// URLSigningKey signs the temporary download links handed out by
+	// POST /:dir/:filename/sign. A random key is used when empty, so links
+	// stop working on restart.
+	URLSigningKey string
+	// RateLimit caps the requests per second and BandwidthLimit the MB per
+	// hour uploaded and downloaded by a single credential or client IP.
+	// RateLimitRedis shares the limits of several replicas through Redis.
+	RateLimit      float64
+	BandwidthLimit int
+	RateLimitRedis string
+	// Peers are the base URLs of the other servers of a cluster sharing a
+	// redis:// MetadataStore. Downloads of files stored by one of them are
+	// copied from it, authenticated with ClusterSecret.
+	Peers         []string
+	ClusterSecret string
+	// ReadTimeout, WriteTimeout and IdleTimeout bound how long a connection
+	// may take to send a whole request, to receive a whole response and to
+	// stay open between requests. ReadTimeout and WriteTimeout also cut
+	// off large transfers, so they are off when 0.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// StallTimeout aborts request bodies that send nothing for this long,
+	// or less than MinUploadSpeed bytes per second over as long, written
+	// like 1K. Off when 0.
+	StallTimeout   time.Duration
+	MinUploadSpeed string
+	// MaxDownloadSpeed and MaxUploadSpeed cap the bytes per second of every
+	// single response and request body, written like 512K or 10M.
+	MaxDownloadSpeed string
+	MaxUploadSpeed   string
+	// CacheSize keeps small, frequently downloaded files in memory up to
+	// this many bytes, written like 512M. No cache when empty.
+	CacheSize string
+	// CacheMaxAge lets shared caches, such as the edge of Cloudflare, keep
+	// public downloads this long. Downloads are revalidated every time when 0.
+	CacheMaxAge time.Duration
+	// MaxUploadsPerUser caps the uploads a single credential, or client IP
+	// for anonymous uploads, may run at the same time.
+	MaxUploadsPerUser int
+	// MaxConcurrentUploads and MaxConcurrentDownloads cap the transfers in
+	// progress across all clients. Further ones wait up to QueueTimeout for
+	// a slot and are answered 429 after that.
+	MaxConcurrentUploads   int
+	MaxConcurrentDownloads int
+	QueueTimeout           time.Duration
+
+	// WebhookURL receives every upload, download, expire and delete event
+	// as a JSON POST, signed with WebhookSecret when it is set.
+	WebhookURL    string
+	WebhookSecret string
+	// DownloadWebhookURL receives a DownloadEvent as a JSON POST after
+	// every successful download.
+	DownloadWebhookURL string
+	// SMTPHost enables emailing the download links of uploads to the
+	// addresses of their X-Notify header, from SMTPFrom. SMTPPort defaults
+	// to 587, and SMTPUsername and SMTPPassword are sent with PLAIN auth
+	// when set.
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	// EventsNATSURL enables publishing upload, download and delete events
+	// to NATS under EventsSubject.<type>.
+	EventsNATSURL string
+	EventsSubject string
+	// MaxRanges caps the ranges honored in a single Range header.
+	MaxRanges int
+	// MetricsPort serves /metrics on its own listener instead of next to
+	// the uploads.
+	MetricsPort int
+	// AuditLog is the JSON lines file every upload, download, delete and
+	// rejected credential is appended to.
+	AuditLog string
+	// LogLevel is debug, info (default), warn or error and LogFormat text
+	// (default) or json.
+	LogLevel  string
+	LogFormat string
+	// OTelEndpoint is the base URL of an OpenTelemetry collector receiving
+	// OTLP over HTTP. Requests, uploads and downloads are traced when set.
+	OTelEndpoint string
+
+	// Buckets holds per bucket overrides, usually loaded from ConfigFile.
+	Buckets map[string]BucketConfig
+	// UsersFile enables user accounts, see UserAccount.
+	UsersFile string
+	// AccessTeamDomain, or OIDCIssuer for other providers, makes every
+	// request present a token issued for one of AccessAUD. The
+	// AccessIdentityClaim of the token, the email by default, names the
+	// client's own upload directory.
+	AccessTeamDomain    string
+	OIDCIssuer          string
+	AccessAUD           []string
+	AccessIdentityClaim string
+	// ConfigFile overrides the flags with the settings it holds. Auth
+	// tokens, buckets, quotas and rate limits are reloaded while serving;
+	// the other settings take effect on restart.
+	ConfigFile string
 }
 
 type Server struct {
 	config Config
+	// live holds the settings a reload of Config.ConfigFile may change.
+	live        atomic.Pointer[liveSettings]
+	index       *metaIndex
+	indexLoader func() error
+	createFile  func(path string) (uploadFile, error)
+	storage     Storage
+	replicator  *replicator
+	receiptKey  ed25519.PrivateKey
+	cipher      *fileCipher
+	signingKey  []byte
+	scanner     Scanner
+	tokens      *tokenTracker
+	tus         *tusStore
+	scrubber    scrubber
+	reconciler  reconciler
+	chunked     *chunkedStore
+	metrics     *serverMetrics
+	logger      *slog.Logger
+	// tracer records spans, tracerProvider sends them and is nil when
+	// tracing is off.
+	tracer         trace.Tracer
+	tracerProvider *tracesdk.TracerProvider
+	// onceClaims holds the download once files currently being downloaded.
+	onceClaims sync.Map
+	// slugClaims holds the custom slugs of uploads in progress.
+	slugClaims sync.Map
+	// ids names random upload dirs.
+	ids IDGenerator
+	// writeClaims holds the keys of conditional writes in progress.
+	writeClaims sync.Map
+	// drops holds the drop shares created by admins.
+	drops *dropShares
+	// clients admits clients by address and finds their address behind
+	// proxies.
+	clients ipFilter
+	// retention holds the rules of Config.RetentionFile.
+	retention []retentionRule
+	// users holds the accounts of Config.UsersFile by name.
+	users map[string]UserAccount
+	// access validates Cloudflare Access or OIDC tokens when enabled.
+	access   *accessVerifier
+	auditLog *auditLog
+	// templates holds the templates of Config.TemplatesDir.
+	templates *pageTemplates
+	// hooks holds the hooks registered by a program embedding the server.
+	hooks hookSet
+	// davDirs holds the empty collections created over WebDAV.
+	davDirs sync.Map
+	started atomic.Bool
+	// handler is the router Handler hands out, built on its first call.
+	handler     http.Handler
+	handlerOnce sync.Once
+	// stopC is closed by Shutdown.
+	stopC    chan struct{}
+	stopOnce sync.Once
+	// uploadsPaused is set while an operator has uploads off for maintenance.
+	uploadsPaused atomic.Bool
+	// readOnly is set while nothing may change the store, see handleMode.
+	readOnly atomic.Bool
+
+	processors   []processor
+	processQueue chan FileMeta
+	userUploads  *concurrencyLimiter
+	// uploadQueue and downloadQueue are nil when unlimited.
+	uploadQueue   *transferQueue
+	downloadQueue *transferQueue
+	rates         rateStore
+	// quotaReserved counts the bytes of uploads being stored under the
+	// MaxTotalSize quota, userQuotaReserved those under each user's quota.
+	quotaMu           sync.Mutex
+	quotaReserved     int64
+	userQuotaReserved map[string]int64
+
+	webhooks         *webhookSender
+	downloadWebhooks *webhookSender
+	mailer           *mailer
+	events           EventPublisher
+	eventsOnce       sync.Once
+	eventQueue       chan Event
+	progress         *progressHub
+	feed             *eventFeed
+
+	// fetchClient downloads the URLs posted to /fetch.
+	fetchClient *http.Client
+	// peerClient copies files from the peers of a cluster.
+	peerClient *http.Client
+	// cache holds hot downloads in memory, nil without CacheSize.
+	cache *downloadCache
+	// clips holds the in-memory clips of /clip.
+	clips *clipboard
+	// pipes pairs the senders and receivers of /pipe.
+	pipes *pipeRelay
+	// batches holds the files of batches until they are committed.
+	batches *batchStager
+	// presigned holds the nonces of used pre-signed upload URLs.
+	presigned *presignedUploads
 }
 
 func Flags() []cli.Flag {
@@ -32,100 +471,1159 @@ func Flags() []cli.Flag {
 			Name:    "port",
 			Value:   8080,
 			Usage:   "HTTP Server port number",
+			EnvVars: []string{"SIMPLESERVER_PORT"},
+		},
+		&cli.BoolFlag{
+			Name:    "auto-port",
+			Usage:   "Use the next free port when the configured one is already in use",
+			EnvVars: []string{"SIMPLESERVER_AUTO_PORT"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "listen",
+			Usage:   "Serve on this host:port instead of --port, may be repeated (e.g. --listen 127.0.0.1:8080 --listen [::1]:8080)",
+			EnvVars: []string{"SIMPLESERVER_LISTEN"},
+		},
+		&cli.StringFlag{
+			Name:    "tls-cert",
+			Usage:   "PEM certificate to serve uploads over HTTPS with, together with --tls-key",
+			EnvVars: []string{"SIMPLESERVER_TLS_CERT"},
+		},
+		&cli.StringFlag{
+			Name:    "tls-key",
+			Usage:   "PEM private key of --tls-cert",
+			EnvVars: []string{"SIMPLESERVER_TLS_KEY"},
+		},
+		&cli.BoolFlag{
+			Name:    "tls-self-signed",
+			Usage:   "Serve uploads over HTTPS with a self-signed certificate generated at startup",
+			EnvVars: []string{"SIMPLESERVER_TLS_SELF_SIGNED"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "auto-tls-domain",
+			Usage:   "Serve HTTPS with Let's Encrypt certificates for this domain, obtained on port 443. May be repeated",
+			EnvVars: []string{"SIMPLESERVER_AUTO_TLS_DOMAIN"},
+		},
+		&cli.StringFlag{
+			Name:    "auto-tls-cache-dir",
+			Usage:   "Directory ACME accounts and certificates are cached in. Defaults to autocert in the state dir, or .autocert in the upload dir",
+			EnvVars: []string{"SIMPLESERVER_AUTO_TLS_CACHE_DIR"},
 		},
 		&cli.IntFlag{
 			Name:    "maxsize",
 			Value:   100,
 			Usage:   "Max upload file size in MB",
+			EnvVars: []string{"SIMPLESERVER_MAXSIZE"},
 		},
 		&cli.StringFlag{
 			Name:    "upload-dir",
 			Value:   "",
 			Usage:   "Directory for uploads",
+			EnvVars: []string{"SIMPLESERVER_UPLOAD_DIR"},
+		},
+		&cli.StringFlag{
+			Name:    "state-dir",
+			Usage:   "Directory all uploads, metadata, temporary files and caches are written to, e.g. a volume when the root filesystem is read-only",
+			EnvVars: []string{"SIMPLESERVER_STATE_DIR"},
+		},
+		&cli.IntFlag{
+			Name:    "max-total-size",
+			Usage:   "Max MB all uploads may take together, further uploads are rejected with 507. Unlimited when 0",
+			EnvVars: []string{"SIMPLESERVER_MAX_TOTAL_SIZE"},
+		},
+		&cli.BoolFlag{
+			Name:    "evict-oldest",
+			Usage:   "Delete the oldest uploads to make room when --max-total-size is reached instead of rejecting new ones",
+			EnvVars: []string{"SIMPLESERVER_EVICT_OLDEST"},
+		},
+		&cli.IntFlag{
+			Name:    "min-free-space",
+			Value:   defaultMinFreeSpace,
+			Usage:   "MB that must stay free on the disk of the upload dir for /readyz to report ready. 0 disables the check",
+			EnvVars: []string{"SIMPLESERVER_MIN_FREE_SPACE"},
+		},
+		&cli.StringFlag{
+			Name:    "storage",
+			Usage:   "Where uploaded files are stored: the upload dir (default), memory, or s3://bucket[/prefix] using the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY credentials",
+			EnvVars: []string{"SIMPLESERVER_STORAGE"},
+		},
+		&cli.StringFlag{
+			Name:    "s3-endpoint",
+			Usage:   "Endpoint of an S3 compatible service, addressed path style. AWS is used when empty",
+			EnvVars: []string{"SIMPLESERVER_S3_ENDPOINT"},
+		},
+		&cli.StringFlag{
+			Name:    "s3-region",
+			Usage:   "Region of the S3 bucket, defaults to AWS_REGION or " + defaultS3Region,
+			EnvVars: []string{"SIMPLESERVER_S3_REGION"},
+		},
+		&cli.StringFlag{
+			Name:    "mirror-to",
+			Usage:   "Replicate every upload in the background to a second storage: memory, s3://bucket[/prefix] or file:///path. GET /admin/replication shows the progress",
+			EnvVars: []string{"SIMPLESERVER_MIRROR_TO"},
+		},
+		&cli.StringFlag{
+			Name:    "metadata-store",
+			Usage:   "How upload metadata is persisted: files for one JSON sidecar per upload (default), journal for a single append-only index file, imported from the sidecars on first start, or redis://[:password@]host[:port][/db] to share it with the --peers of a cluster",
+			EnvVars: []string{"SIMPLESERVER_METADATA_STORE"},
+		},
+		&cli.BoolFlag{
+			Name:    "preserve-paths",
+			Usage:   "Keep the relative directory structure sent in multipart filenames instead of flattening them",
+			EnvVars: []string{"SIMPLESERVER_PRESERVE_PATHS"},
+		},
+		&cli.BoolFlag{
+			Name:    "strict-filename",
+			Usage:   "Reject uploads whose filename has no safe characters instead of naming them " + defaultFilename,
+			EnvVars: []string{"SIMPLESERVER_STRICT_FILENAME"},
+		},
+		&cli.StringFlag{
+			Name:    "name-strategy",
+			Value:   NameOriginal,
+			Usage:   "How stored files are named: the client filename, a content hash or a random id. Downloads keep offering the original name. {original, hash, random}",
+			EnvVars: []string{"SIMPLESERVER_NAME_STRATEGY"},
+		},
+		&cli.IntFlag{
+			Name:    "tar-max-entries",
+			Value:   defaultTarMaxEntries,
+			Usage:   "Max entries in a tar archive uploaded with ?extract=1",
+			EnvVars: []string{"SIMPLESERVER_TAR_MAX_ENTRIES"},
+		},
+		&cli.IntFlag{
+			Name:    "tar-max-size",
+			Value:   defaultTarMaxSizeInMB,
+			Usage:   "Max total size in MB of the files extracted from a tar archive",
+			EnvVars: []string{"SIMPLESERVER_TAR_MAX_SIZE"},
+		},
+		&cli.IntFlag{
+			Name:    "tar-max-entry-size",
+			Usage:   "Max size in MB of a single file extracted from a tar archive, --maxsize when 0",
+			EnvVars: []string{"SIMPLESERVER_TAR_MAX_ENTRY_SIZE"},
+		},
+		&cli.DurationFlag{
+			Name:    "ttl",
+			Usage:   "Delete uploads this long after they were stored (e.g. 24h). Uploads never expire when 0",
+			EnvVars: []string{"SIMPLESERVER_TTL"},
+		},
+		&cli.DurationFlag{
+			Name:    "reap-interval",
+			Value:   defaultReapInterval,
+			Usage:   "How often expired uploads are looked for and deleted",
+			EnvVars: []string{"SIMPLESERVER_REAP_INTERVAL"},
+		},
+		&cli.DurationFlag{
+			Name:    "gc-interval",
+			Value:   defaultGCInterval,
+			Usage:   "How often empty share dirs, stale .part files and the metadata of missing files are removed",
+			EnvVars: []string{"SIMPLESERVER_GC_INTERVAL"},
+		},
+		&cli.BoolFlag{
+			Name:    "no-reconcile",
+			Usage:   "Do not reconcile the upload directory with the metadata index on startup",
+			EnvVars: []string{"SIMPLESERVER_NO_RECONCILE"},
+		},
+		&cli.BoolFlag{
+			Name:    "read-only",
+			Usage:   "Start read-only: refuse every request that changes the store with 503 and pause expiry and cleanups, while downloads keep working",
+			EnvVars: []string{"SIMPLESERVER_READ_ONLY"},
+		},
+		&cli.DurationFlag{
+			Name:    "scrub-interval",
+			Usage:   "How often every upload is read back and checked against its SHA-256, moving corrupted ones to quarantine. Off when 0",
+			EnvVars: []string{"SIMPLESERVER_SCRUB_INTERVAL"},
+		},
+		&cli.StringFlag{
+			Name:    "scrub-speed",
+			Value:   defaultScrubSpeed,
+			Usage:   "Max bytes per second read by the scrubber, e.g. 512K or 10M. Unlimited when empty",
+			EnvVars: []string{"SIMPLESERVER_SCRUB_SPEED"},
+		},
+		&cli.DurationFlag{
+			Name:    "trash-period",
+			Usage:   "Keep expired and deleted uploads in a trash this long before purging them, restored with POST /admin/files/<id>/restore. Deleted at once when 0",
+			EnvVars: []string{"SIMPLESERVER_TRASH_PERIOD"},
+		},
+		&cli.StringFlag{
+			Name:    "retention",
+			Usage:   "YAML file of retention rules, each a glob pattern with a ttl and/or max_count of files per share dir, enforced by the reaper",
+			EnvVars: []string{"SIMPLESERVER_RETENTION"},
+		},
+		&cli.BoolFlag{
+			Name:    "no-ui",
+			Usage:   "Do not serve the drag-and-drop upload page at /, for API only deployments",
+			EnvVars: []string{"SIMPLESERVER_NO_UI"},
+		},
+		&cli.BoolFlag{
+			Name:    "no-share-page",
+			Usage:   "Serve browsers visiting a file link the file itself rather than a page with its details and a download button",
+			EnvVars: []string{"SIMPLESERVER_NO_SHARE_PAGE"},
+		},
+		&cli.BoolFlag{
+			Name:    "api-docs",
+			Usage:   "Serve Swagger UI for the API at /docs, loading its assets from unpkg.com",
+			EnvVars: []string{"SIMPLESERVER_API_DOCS"},
+		},
+		&cli.StringFlag{
+			Name:    "templates-dir",
+			Usage:   "Directory of templates replacing the upload page (index.html), the answer to uploads (uploaded.txt) and the page of missing files (404.html)",
+			EnvVars: []string{"SIMPLESERVER_TEMPLATES_DIR"},
+		},
+		&cli.StringFlag{
+			Name:    "lang",
+			Value:   defaultLang,
+			Usage:   "Language of the upload page and error messages when Accept-Language names none available: " + strings.Join(languages(), ", "),
+			EnvVars: []string{"SIMPLESERVER_LANG"},
+		},
+		&cli.BoolFlag{
+			Name:    "no-fetch",
+			Usage:   "Do not download URLs posted to /fetch into new shares",
+			EnvVars: []string{"SIMPLESERVER_NO_FETCH"},
+		},
+		&cli.DurationFlag{
+			Name:    "fetch-timeout",
+			Value:   defaultFetchTimeout,
+			Usage:   "Give up downloading a URL posted to /fetch after this long",
+			EnvVars: []string{"SIMPLESERVER_FETCH_TIMEOUT"},
+		},
+		&cli.DurationFlag{
+			Name:    "clip-ttl",
+			Value:   defaultClipTTL,
+			Usage:   "Hold clips put to /clip/<name> in memory for this long",
+			EnvVars: []string{"SIMPLESERVER_CLIP_TTL"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "cors-origins",
+			Usage:   "Origins browsers may call the server from, such as https://app.example.com. Any origin when empty",
+			EnvVars: []string{"SIMPLESERVER_CORS_ORIGINS"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "cors-methods",
+			Usage:   "Methods cross-origin requests may use. GET, HEAD, PUT, PATCH, POST and DELETE when empty",
+			EnvVars: []string{"SIMPLESERVER_CORS_METHODS"},
+		},
+		&cli.BoolFlag{
+			Name:    "cors-credentials",
+			Usage:   "Let cross-origin requests send cookies and Authorization headers. Requires --cors-origins",
+			EnvVars: []string{"SIMPLESERVER_CORS_CREDENTIALS"},
+		},
+		&cli.BoolFlag{
+			Name:    "no-cors",
+			Usage:   "Answer no cross-origin request, for deployments only used by non-browser clients or the built-in page",
+			EnvVars: []string{"SIMPLESERVER_NO_CORS"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "allow-cidr",
+			Usage:   "Only admit clients in these address ranges such as 10.0.0.0/8",
+			EnvVars: []string{"SIMPLESERVER_ALLOW_CIDR"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "deny-cidr",
+			Usage:   "Refuse clients in these address ranges, even when --allow-cidr admits them",
+			EnvVars: []string{"SIMPLESERVER_DENY_CIDR"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "trusted-proxies",
+			Usage:   "Only trust CF-Connecting-IP and X-Forwarded-For from these address ranges and the unix socket, such as the address of cloudflared when it runs on another host. Loopback addresses when empty, 0.0.0.0/0 and ::/0 trust every client",
+			EnvVars: []string{"SIMPLESERVER_TRUSTED_PROXIES"},
+		},
+		&cli.StringFlag{
+			Name:    "content-security-policy",
+			Usage:   "Content-Security-Policy sent with every response, off to send none. Defaults to a policy running no scripts outside the upload page",
+			EnvVars: []string{"SIMPLESERVER_CONTENT_SECURITY_POLICY"},
+		},
+		&cli.StringFlag{
+			Name:    "frame-options",
+			Value:   defaultFrameOptions,
+			Usage:   "X-Frame-Options sent with every response {DENY, SAMEORIGIN, off}",
+			EnvVars: []string{"SIMPLESERVER_FRAME_OPTIONS"},
+		},
+		&cli.StringFlag{
+			Name:    "referrer-policy",
+			Value:   defaultReferrerPolicy,
+			Usage:   "Referrer-Policy sent with every response, off to send none",
+			EnvVars: []string{"SIMPLESERVER_REFERRER_POLICY"},
+		},
+		&cli.StringFlag{
+			Name:    "proxy-target",
+			Usage:   "Forward every request outside /files, WebSockets included, to this upstream such as http://localhost:3000 and serve the file share under /files",
+			EnvVars: []string{"SIMPLESERVER_PROXY_TARGET"},
+		},
+		&cli.StringFlag{
+			Name:    "serve-dir",
+			Usage:   "Serve this directory read-only as a static site with index pages and ETags instead of accepting uploads",
+			EnvVars: []string{"SIMPLESERVER_SERVE_DIR"},
+		},
+		&cli.BoolFlag{
+			Name:    "short-links",
+			Usage:   "Also return a short /s/<alias> link for every upload",
+			EnvVars: []string{"SIMPLESERVER_SHORT_LINKS"},
+		},
+		&cli.StringFlag{
+			Name:    "public-url",
+			Usage:   "URL the server is reached at (e.g. https://files.example.com), used for the links handed out instead of the request host",
+			EnvVars: []string{"SIMPLESERVER_PUBLIC_URL"},
+		},
+		&cli.BoolFlag{
+			Name:    "allow-custom-paths",
+			Usage:   "Store PUT /<slug>/<filename> under the given slug, as the X-Custom-Path: true header does",
+			EnvVars: []string{"SIMPLESERVER_ALLOW_CUSTOM_PATHS"},
+		},
+		&cli.IntFlag{
+			Name:    "slug-length",
+			Value:   defaultSlugLength,
+			Usage:   "Length of the random directory every upload is stored in",
+			EnvVars: []string{"SIMPLESERVER_SLUG_LENGTH"},
+		},
+		&cli.StringFlag{
+			Name:    "id-scheme",
+			Value:   idSchemeBase58,
+			Usage:   "How random upload directories are named: base58, uuid or words, like otter-lava-plum-reef",
+			EnvVars: []string{"SIMPLESERVER_ID_SCHEME"},
+		},
+		&cli.BoolFlag{
+			Name:    "enable-qr",
+			Usage:   "Serve a QR code of every download link at /<dir>/<filename>/qr, as PNG or with ?format=svg as SVG",
+			EnvVars: []string{"SIMPLESERVER_ENABLE_QR"},
+		},
+		&cli.BoolFlag{
+			Name:    "no-thumbnails",
+			Usage:   "Do not serve JPEG, PNG and GIF thumbnails at /<dir>/<filename>/thumb?w=<width>",
+			EnvVars: []string{"SIMPLESERVER_NO_THUMBNAILS"},
+		},
+		&cli.BoolFlag{
+			Name:    "webdav",
+			Usage:   "Serve the uploads over WebDAV at /dav/ to mount them as a network drive. Requires --auth-token",
+			EnvVars: []string{"SIMPLESERVER_WEBDAV"},
+		},
+		&cli.IntFlag{
+			Name:    "sftp-port",
+			Usage:   "Serve the uploads over SFTP and scp on this port. Clients log in with --auth-token as password or a key from --sftp-authorized-keys",
+			EnvVars: []string{"SIMPLESERVER_SFTP_PORT"},
+		},
+		&cli.StringFlag{
+			Name:    "sftp-host-key",
+			Usage:   "Private key the SFTP server identifies with. Defaults to a key generated in the state dir, or the upload dir",
+			EnvVars: []string{"SIMPLESERVER_SFTP_HOST_KEY"},
+		},
+		&cli.StringFlag{
+			Name:    "sftp-authorized-keys",
+			Usage:   "authorized_keys file listing the public keys allowed to log in over SFTP",
+			EnvVars: []string{"SIMPLESERVER_SFTP_AUTHORIZED_KEYS"},
+		},
+		&cli.IntFlag{
+			Name:    "ftp-port",
+			Usage:   "Serve passive mode FTP on this port, storing the uploads of every login in a new share directory. The password is --auth-token when set",
+			EnvVars: []string{"SIMPLESERVER_FTP_PORT"},
+		},
+		&cli.StringFlag{
+			Name:    "ftp-passive-ports",
+			Usage:   "Port range FTP data connections listen on, such as 30000-30009. Defaults to any free port",
+			EnvVars: []string{"SIMPLESERVER_FTP_PASSIVE_PORTS"},
+		},
+		&cli.IntFlag{
+			Name:    "grpc-port",
+			Usage:   "Serve the gRPC FileService on this port to upload, download, list and delete files. Requires --auth-token",
+			EnvVars: []string{"SIMPLESERVER_GRPC_PORT"},
+		},
+		&cli.IntFlag{
+			Name:    "s3-port",
+			Usage:   "Serve PutObject, GetObject, ListObjectsV2 and DeleteObject of the S3 API on this port, with share dirs as buckets. Requires --auth-token as secret key",
+			EnvVars: []string{"SIMPLESERVER_S3_PORT"},
+		},
+		&cli.StringFlag{
+			Name:    "s3-access-key",
+			Value:   defaultS3AccessKey,
+			Usage:   "Access key ID S3 clients sign requests with",
+			EnvVars: []string{"SIMPLESERVER_S3_ACCESS_KEY"},
+		},
+		&cli.StringFlag{
+			Name:    "multipart-on-error",
+			Value:   multipartAbortPolicy,
+			Usage:   "What to do when one part of a multipart upload fails: abort the whole batch or skip the part. {abort, skip}",
+			EnvVars: []string{"SIMPLESERVER_MULTIPART_ON_ERROR"},
+		},
+		&cli.BoolFlag{
+			Name:    "json-responses",
+			Usage:   "Answer uploads and directory listings with JSON, as when clients send Accept: application/json",
+			EnvVars: []string{"SIMPLESERVER_JSON_RESPONSES"},
+		},
+		&cli.BoolFlag{
+			Name:    "fsync",
+			Usage:   "Sync every upload to disk before acknowledging it",
+			EnvVars: []string{"SIMPLESERVER_FSYNC"},
+		},
+		&cli.DurationFlag{
+			Name:    "ack-timeout",
+			Usage:   "Wait up to this long for the storage backend to confirm an upload is durable before answering 504. 0 acknowledges as soon as the upload is written",
+			EnvVars: []string{"SIMPLESERVER_ACK_TIMEOUT"},
+		},
+		&cli.StringFlag{
+			Name:    "receipt-key",
+			Usage:   "File with the hex encoded Ed25519 seed used to sign upload receipts, created when missing. The public key is served at " + receiptKeyPath,
+			EnvVars: []string{"SIMPLESERVER_RECEIPT_KEY"},
+		},
+		&cli.StringFlag{
+			Name:    "encrypt-key",
+			Usage:   "Encrypt uploads at rest with AES-256-GCM using this hex encoded 32 byte key, or auto to generate one that is lost on restart",
+			EnvVars: []string{"SIMPLESERVER_ENCRYPT_KEY"},
+		},
+		&cli.BoolFlag{
+			Name:    "compress-at-rest",
+			Usage:   "Store uploads gzip compressed on disk. Downloads are decompressed transparently",
+			EnvVars: []string{"SIMPLESERVER_COMPRESS_AT_REST"},
+		},
+		&cli.BoolFlag{
+			Name:    "precompress",
+			Usage:   "Store gzip and zstd compressed copies of text uploads and serve them to clients accepting those encodings",
+			EnvVars: []string{"SIMPLESERVER_PRECOMPRESS"},
+		},
+		&cli.BoolFlag{
+			Name:    "dedupe",
+			Usage:   "Store identical uploads once, hardlinking further copies to the first. The blob is kept until its last upload is deleted",
+			EnvVars: []string{"SIMPLESERVER_DEDUPE"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "compress-skip-types",
+			Value:   cli.NewStringSlice(defaultCompressSkipTypes...),
+			Usage:   "Content types, or type prefixes ending in /, that --compress-at-rest stores as is and responses are sent uncompressed",
+			EnvVars: []string{"SIMPLESERVER_COMPRESS_SKIP_TYPES"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "allow-extensions",
+			Usage:   "Only accept uploads with these file extensions whose content matches them, e.g. jpg,png,pdf",
+			EnvVars: []string{"SIMPLESERVER_ALLOW_EXTENSIONS"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "block-mime",
+			Usage:   "Refuse uploads of these content types, or type prefixes ending in /, detected from the name or the content",
+			EnvVars: []string{"SIMPLESERVER_BLOCK_MIME"},
+		},
+		&cli.BoolFlag{
+			Name:    "verify-content",
+			Usage:   "Refuse with 422 uploads whose content is HTML, XML or an executable while their extension declares another type, e.g. a .png holding a script",
+			EnvVars: []string{"SIMPLESERVER_VERIFY_CONTENT"},
+		},
+		&cli.StringFlag{
+			Name:    "clamav-address",
+			Usage:   "clamd address (host:port or unix socket path) every upload is scanned with before it is stored",
+			EnvVars: []string{"SIMPLESERVER_CLAMAV_ADDRESS"},
+		},
+		&cli.DurationFlag{
+			Name:    "processing-delay",
+			Usage:   "Keep new uploads unavailable for this long while they are processed. Downloads answer 425 meanwhile",
+			EnvVars: []string{"SIMPLESERVER_PROCESSING_DELAY"},
+		},
+		&cli.IntFlag{
+			Name:    "processing-workers",
+			Value:   defaultProcessingWorkers,
+			Usage:   "Number of workers processing new uploads",
+			EnvVars: []string{"SIMPLESERVER_PROCESSING_WORKERS"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "upload-token",
+			Usage:   "Upload token accepted via the X-Upload-Token header, as token[:max-uploads[:max-bytes]]. Can be repeated",
+			EnvVars: []string{"SIMPLESERVER_UPLOAD_TOKEN"},
+		},
+		&cli.StringFlag{
+			Name:    "admin-token",
+			Usage:   "Bearer token protecting the /admin endpoints and the /events feed. Both are disabled when empty",
+			EnvVars: []string{"SIMPLESERVER_ADMIN_TOKEN"},
+		},
+		&cli.StringFlag{
+			Name:    "users-file",
+			Usage:   "YAML file of user accounts with bcrypt password hashes and quotas. Users upload with HTTP basic auth into their own directory",
+			EnvVars: []string{"SIMPLESERVER_USERS_FILE"},
+		},
+		&cli.StringFlag{
+			Name:    "access-team-domain",
+			Usage:   "Cloudflare Access team domain, e.g. myteam.cloudflareaccess.com. Requests must carry a Cf-Access-Jwt-Assertion issued for --access-aud",
+			EnvVars: []string{"SIMPLESERVER_ACCESS_TEAM_DOMAIN"},
+		},
+		&cli.StringFlag{
+			Name:    "oidc-issuer",
+			Usage:   "OIDC issuer URL whose bearer tokens, issued for --access-aud, every request must carry. An alternative to --access-team-domain",
+			EnvVars: []string{"SIMPLESERVER_OIDC_ISSUER"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "access-aud",
+			Usage:   "Audience tag of the Access application, or OIDC client ID, tokens must be issued for. Can be repeated",
+			EnvVars: []string{"SIMPLESERVER_ACCESS_AUD"},
+		},
+		&cli.StringFlag{
+			Name:    "access-identity-claim",
+			Value:   defaultIdentityClaim,
+			Usage:   "Token claim naming the client, used for its upload directory and in the request log",
+			EnvVars: []string{"SIMPLESERVER_ACCESS_IDENTITY_CLAIM"},
+		},
+		&cli.StringFlag{
+			Name:    "auth-token",
+			Usage:   "Bearer token required to upload. Uploads are open to anyone when empty",
+			EnvVars: []string{"SIMPLESERVER_AUTH_TOKEN"},
+		},
+		&cli.BoolFlag{
+			Name:    "protect-downloads",
+			Usage:   "Require the --auth-token bearer token for downloads as well",
+			EnvVars: []string{"SIMPLESERVER_PROTECT_DOWNLOADS"},
+		},
+		&cli.StringFlag{
+			Name:    "url-signing-key",
+			Usage:   "Secret signing the temporary download links handed out by POST /<dir>/<file>/sign. A random key is used when empty, so links stop working on restart",
+			EnvVars: []string{"SIMPLESERVER_URL_SIGNING_KEY"},
+		},
+		&cli.Float64Flag{
+			Name:    "rate-limit",
+			Usage:   "Max requests per second from a single upload token, bearer token or client IP. Unlimited when 0",
+			EnvVars: []string{"SIMPLESERVER_RATE_LIMIT"},
+		},
+		&cli.IntFlag{
+			Name:    "bandwidth-limit",
+			Usage:   "Max MB per hour a single upload token, bearer token or client IP may upload and download. Unlimited when 0",
+			EnvVars: []string{"SIMPLESERVER_BANDWIDTH_LIMIT"},
+		},
+		&cli.DurationFlag{
+			Name:    "read-timeout",
+			Usage:   "Close connections taking longer to send a whole request, uploads included. No limit when 0",
+			EnvVars: []string{"SIMPLESERVER_READ_TIMEOUT"},
+		},
+		&cli.DurationFlag{
+			Name:    "write-timeout",
+			Usage:   "Close connections taking longer to receive a whole response, downloads included. No limit when 0",
+			EnvVars: []string{"SIMPLESERVER_WRITE_TIMEOUT"},
+		},
+		&cli.DurationFlag{
+			Name:    "idle-timeout",
+			Value:   defaultIdleTimeout,
+			Usage:   "Close keep-alive connections idle this long between requests",
+			EnvVars: []string{"SIMPLESERVER_IDLE_TIMEOUT"},
+		},
+		&cli.DurationFlag{
+			Name:    "stall-timeout",
+			Value:   defaultStallTimeout,
+			Usage:   "Abort uploads sending nothing, or less than --min-upload-speed, for this long. Off when 0",
+			EnvVars: []string{"SIMPLESERVER_STALL_TIMEOUT"},
+		},
+		&cli.StringFlag{
+			Name:    "min-upload-speed",
+			Usage:   "Min bytes per second uploads must keep up over --stall-timeout, e.g. 1K",
+			EnvVars: []string{"SIMPLESERVER_MIN_UPLOAD_SPEED"},
+		},
+		&cli.StringFlag{
+			Name:    "max-download-speed",
+			Usage:   "Max bytes per second of every single download, e.g. 512K or 10M. Unlimited when empty",
+			EnvVars: []string{"SIMPLESERVER_MAX_DOWNLOAD_SPEED"},
+		},
+		&cli.StringFlag{
+			Name:    "max-upload-speed",
+			Usage:   "Max bytes per second of every single upload, e.g. 512K or 10M. Unlimited when empty",
+			EnvVars: []string{"SIMPLESERVER_MAX_UPLOAD_SPEED"},
+		},
+		&cli.StringFlag{
+			Name:    "cache-size",
+			Usage:   "Memory for caching small files that are downloaded repeatedly, e.g. 512M. No cache when empty",
+			EnvVars: []string{"SIMPLESERVER_CACHE_SIZE"},
+		},
+		&cli.DurationFlag{
+			Name:    "cache-max-age",
+			Usage:   "Let shared caches keep public downloads this long, even once they are deleted. Revalidated every time when 0",
+			EnvVars: []string{"SIMPLESERVER_CACHE_MAX_AGE"},
+		},
+		&cli.StringFlag{
+			Name:    "rate-limit-redis",
+			Usage:   "Keep rate limits in Redis, as redis://[:password@]host[:port][/db], so replicas share them",
+			EnvVars: []string{"SIMPLESERVER_RATE_LIMIT_REDIS"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "peers",
+			Usage:   "Base URLs of the other servers of a cluster sharing --metadata-store redis://..., which downloads of files stored elsewhere are copied from",
+			EnvVars: []string{"SIMPLESERVER_PEERS"},
+		},
+		&cli.StringFlag{
+			Name:    "cluster-secret",
+			Usage:   "Secret the servers of a cluster present to copy files from each other. Required with --peers",
+			EnvVars: []string{"SIMPLESERVER_CLUSTER_SECRET"},
+		},
+		&cli.IntFlag{
+			Name:    "max-uploads-per-user",
+			Usage:   "Maximum concurrent uploads per upload token, bearer token or anonymous client IP. 0 means unlimited",
+			EnvVars: []string{"SIMPLESERVER_MAX_UPLOADS_PER_USER"},
+		},
+		&cli.IntFlag{
+			Name:    "max-concurrent-uploads",
+			Usage:   "Maximum uploads in progress across all clients. 0 means unlimited",
+			EnvVars: []string{"SIMPLESERVER_MAX_CONCURRENT_UPLOADS"},
+		},
+		&cli.IntFlag{
+			Name:    "max-concurrent-downloads",
+			Usage:   "Maximum downloads in progress across all clients. 0 means unlimited",
+			EnvVars: []string{"SIMPLESERVER_MAX_CONCURRENT_DOWNLOADS"},
+		},
+		&cli.DurationFlag{
+			Name:    "queue-timeout",
+			Usage:   "How long transfers over --max-concurrent-uploads or --max-concurrent-downloads wait for a slot before they are answered 429. They are refused at once when 0",
+			EnvVars: []string{"SIMPLESERVER_QUEUE_TIMEOUT"},
+		},
+		&cli.StringFlag{
+			Name:    "simpleserver-config",
+			Usage:   "YAML or JSON file with server and per bucket settings; auth tokens, quotas and rate limits are reloaded on SIGHUP or when it changes",
+			EnvVars: []string{"SIMPLESERVER_CONFIG"},
+		},
+		&cli.IntFlag{
+			Name:    "max-ranges",
+			Value:   defaultMaxRanges,
+			Usage:   "Maximum number of byte ranges accepted in a single Range request",
+			EnvVars: []string{"SIMPLESERVER_MAX_RANGES"},
+		},
+		&cli.IntFlag{
+			Name:    "metrics-port",
+			Usage:   "Serve Prometheus metrics on this port instead of at /metrics on the upload port",
+			EnvVars: []string{"SIMPLESERVER_METRICS_PORT"},
+		},
+		&cli.StringFlag{
+			Name:    "audit-log",
+			Usage:   "Append every upload, download, delete and rejected credential to this JSON lines file, queried with GET /admin/audit",
+			EnvVars: []string{"SIMPLESERVER_AUDIT_LOG"},
+		},
+		&cli.StringFlag{
+			Name:    "log-level",
+			Value:   "info",
+			Usage:   "Upload server logging level {debug, info, warn, error}",
+			EnvVars: []string{"SIMPLESERVER_LOG_LEVEL"},
+		},
+		&cli.StringFlag{
+			Name:    "log-format",
+			Value:   logFormatText,
+			Usage:   "Upload server log format {text, json}, json matches cloudflared's JSON logs",
+			EnvVars: []string{"SIMPLESERVER_LOG_FORMAT"},
+		},
+		&cli.StringFlag{
+			Name:    "otel-endpoint",
+			Usage:   "OpenTelemetry collector URL, such as http://localhost:4318, that request, upload and download spans are sent to over OTLP/HTTP",
+			EnvVars: []string{"SIMPLESERVER_OTEL_ENDPOINT"},
+		},
+		&cli.StringFlag{
+			Name:    "download-webhook-url",
+			Usage:   "URL notified with a JSON POST after every successful download",
+			EnvVars: []string{"SIMPLESERVER_DOWNLOAD_WEBHOOK_URL"},
+		},
+		&cli.StringFlag{
+			Name:    "webhook-url",
+			Usage:   "URL notified with a JSON POST whenever a file is uploaded, downloaded, expired or deleted",
+			EnvVars: []string{"SIMPLESERVER_WEBHOOK_URL"},
+		},
+		&cli.StringFlag{
+			Name:    "webhook-secret",
+			Usage:   "Key for the HMAC-SHA256 signature sent with webhooks in the X-Webhook-Signature-256 header",
+			EnvVars: []string{"SIMPLESERVER_WEBHOOK_SECRET"},
+		},
+		&cli.StringFlag{
+			Name:    "smtp-host",
+			Usage:   "SMTP server that emails the download links of uploads to the addresses of their X-Notify header",
+			EnvVars: []string{"SIMPLESERVER_SMTP_HOST"},
+		},
+		&cli.IntFlag{
+			Name:    "smtp-port",
+			Value:   defaultSMTPPort,
+			Usage:   "Port of the SMTP server",
+			EnvVars: []string{"SIMPLESERVER_SMTP_PORT"},
+		},
+		&cli.StringFlag{
+			Name:    "smtp-username",
+			Usage:   "User to authenticate to the SMTP server as",
+			EnvVars: []string{"SIMPLESERVER_SMTP_USERNAME"},
+		},
+		&cli.StringFlag{
+			Name:    "smtp-password",
+			Usage:   "Password to authenticate to the SMTP server with",
+			EnvVars: []string{"SIMPLESERVER_SMTP_PASSWORD"},
+		},
+		&cli.StringFlag{
+			Name:    "smtp-from",
+			Usage:   "Sender address of notification emails",
+			EnvVars: []string{"SIMPLESERVER_SMTP_FROM"},
+		},
+		&cli.StringFlag{
+			Name:    "events-nats-url",
+			Usage:   "NATS server (nats://host:port) that upload, download and delete events are published to",
+			EnvVars: []string{"SIMPLESERVER_EVENTS_NATS_URL"},
+		},
+		&cli.StringFlag{
+			Name:    "events-subject",
+			Value:   defaultEventsSubject,
+			Usage:   "Subject prefix for published events, the event type is appended",
+			EnvVars: []string{"SIMPLESERVER_EVENTS_SUBJECT"},
 		},
 	}
 }
 
-func New(config Config) *Server {
-	return &Server{config: config}
+func newServer(config Config) *Server {
+	s := &Server{config: config, stopC: make(chan struct{})}
+	s.live.Store(newLiveSettings(config))
+	s.readOnly.Store(config.ReadOnly)
+	s.index = newMetaIndex(sidecarStore{root: filepath.Join(s.getUploadDir(), metaDirName)})
+	s.tus = newTusStore(s.getUploadDir())
+	s.chunked = newChunkedStore(s.getUploadDir())
+	s.drops = newDropShares(s.getUploadDir())
+	s.metrics = newServerMetrics(s.index)
+	logger, err := newLogger(os.Stderr, config.LogLevel, config.LogFormat)
+	if err != nil {
+		log.Printf("Ignoring logging settings: %v\n", err)
+		logger, _ = newLogger(os.Stderr, "", "")
+	}
+	s.logger = logger
+	s.tracerProvider, s.tracer = newTracing(config)
+	s.indexLoader = s.index.load
+	s.createFile = createUploadFile
+	s.tokens = newTokenTracker(s.index, config.UploadTokens)
+	webhookClient := &http.Client{Timeout: webhookTimeout}
+	s.webhooks = newWebhookSender(config.WebhookURL, config.WebhookSecret, webhookClient)
+	s.downloadWebhooks = newWebhookSender(config.DownloadWebhookURL, config.WebhookSecret, webhookClient)
+	s.mailer = newMailer(config)
+	s.fetchClient = newFetchClient(s.fetchTimeout())
+	s.peerClient = &http.Client{}
+	ids, err := newIDGenerator(config.IDScheme, s.slugLength())
+	if err != nil {
+		log.Printf("Ignoring the id scheme: %v\n", err)
+		ids, _ = newIDGenerator("", s.slugLength())
+	}
+	s.ids = ids
+	cacheSize, _ := parseByteSize(config.CacheSize, "size")
+	s.cache = newDownloadCache(cacheSize)
+	s.clips = newClipboard()
+	s.pipes = newPipeRelay()
+	s.batches = newBatchStager()
+	s.presigned = newPresignedUploads()
+	s.events = newEventPublisher(config)
+	s.progress = newProgressHub()
+	s.feed = newEventFeed()
+	s.processQueue = make(chan FileMeta, 64)
+	s.userUploads = newConcurrencyLimiter(config.MaxUploadsPerUser)
+	s.uploadQueue = newTransferQueue(config.MaxConcurrentUploads)
+	s.downloadQueue = newTransferQueue(config.MaxConcurrentDownloads)
+	s.userQuotaReserved = make(map[string]int64)
+	s.clients = newIPFilter(config)
+	return s
 }
 
 func WithCtx(c *cli.Context) *Server {
+	var tokens []UploadToken
+	for _, value := range c.StringSlice("upload-token") {
+		token, err := parseUploadToken(value)
+		if err != nil {
+			log.Printf("Ignoring upload token: %v\n", err)
+			continue
+		}
+		tokens = append(tokens, token)
+	}
 	config := Config{
-		Port:      c.Int("port"),
-		MaxSize:   c.Int("size"),
-		UploadDir: c.String("upload-dir"),
+		Port:            c.Int("port"),
+		AutoPort:        c.Bool("auto-port"),
+		GracePeriod:     c.Duration("grace-period"),
+		MaxSize:         c.Int("maxsize"),
+		UploadDir:       c.String("upload-dir"),
+		StateDir:        c.String("state-dir"),
+		MaxTotalSize:    c.Int("max-total-size"),
+		EvictOldest:     c.Bool("evict-oldest"),
+		MinFreeSpace:    c.Int("min-free-space"),
+		PreservePaths:   c.Bool("preserve-paths"),
+		StrictFilename:  c.Bool("strict-filename"),
+		NameStrategy:    c.String("name-strategy"),
+		TarMaxEntries:   c.Int("tar-max-entries"),
+		TarMaxSize:      c.Int("tar-max-size"),
+		NoUI:            c.Bool("no-ui"),
+		NoSharePage:     c.Bool("no-share-page"),
+		APIDocs:         c.Bool("api-docs"),
+		TemplatesDir:    c.String("templates-dir"),
+		Lang:            c.String("lang"),
+		NoFetch:         c.Bool("no-fetch"),
+		FetchTimeout:    c.Duration("fetch-timeout"),
+		ClipTTL:         c.Duration("clip-ttl"),
+		CORSOrigins:     c.StringSlice("cors-origins"),
+		CORSMethods:     c.StringSlice("cors-methods"),
+		CORSCredentials: c.Bool("cors-credentials"),
+		NoCORS:          c.Bool("no-cors"),
+		AllowCIDRs:      c.StringSlice("allow-cidr"),
+		DenyCIDRs:       c.StringSlice("deny-cidr"),
+		TrustedProxies:  c.StringSlice("trusted-proxies"),
+		ServeDir:        c.String("serve-dir"),
+		ProxyTarget:     c.String("proxy-target"),
+		ShortLinks:      c.Bool("short-links"),
+		PublicURL:       c.String("public-url"),
+		TTL:             c.Duration("ttl"),
+		ReapInterval:    c.Duration("reap-interval"),
+		GCInterval:      c.Duration("gc-interval"),
+		NoReconcile:     c.Bool("no-reconcile"),
+		ReadOnly:        c.Bool("read-only"),
+		ScrubInterval:   c.Duration("scrub-interval"),
+		ScrubSpeed:      c.String("scrub-speed"),
+		TrashPeriod:     c.Duration("trash-period"),
+		RetentionFile:   c.String("retention"),
+
+		ContentSecurityPolicy: c.String("content-security-policy"),
+		FrameOptions:          c.String("frame-options"),
+		ReferrerPolicy:        c.String("referrer-policy"),
+
+		Listen: c.StringSlice("listen"),
+		// --unix-socket also points the tunnel at the socket, so a single
+		// flag connects the two without exposing a port.
+		UnixSocket: c.String("unix-socket"),
+
+		Storage:       c.String("storage"),
+		S3Endpoint:    c.String("s3-endpoint"),
+		S3Region:      c.String("s3-region"),
+		MirrorTo:      c.String("mirror-to"),
+		MetadataStore: c.String("metadata-store"),
+
+		TarMaxEntrySize:  c.Int("tar-max-entry-size"),
+		AllowCustomPaths: c.Bool("allow-custom-paths"),
+		SlugLength:       c.Int("slug-length"),
+		IDScheme:         c.String("id-scheme"),
+		EnableQR:         c.Bool("enable-qr"),
+		NoThumbnails:     c.Bool("no-thumbnails"),
+		WebDAV:           c.Bool("webdav"),
+
+		SFTPPort:           c.Int("sftp-port"),
+		SFTPHostKey:        c.String("sftp-host-key"),
+		SFTPAuthorizedKeys: c.String("sftp-authorized-keys"),
+		FTPPort:            c.Int("ftp-port"),
+		FTPPassivePorts:    c.String("ftp-passive-ports"),
+		GRPCPort:           c.Int("grpc-port"),
+		S3Port:             c.Int("s3-port"),
+		S3AccessKey:        c.String("s3-access-key"),
+
+		TLSCert:         c.String("tls-cert"),
+		TLSKey:          c.String("tls-key"),
+		TLSSelfSigned:   c.Bool("tls-self-signed"),
+		AutoTLSDomains:  c.StringSlice("auto-tls-domain"),
+		AutoTLSCacheDir: c.String("auto-tls-cache-dir"),
+
+		MultipartOnError: c.String("multipart-on-error"),
+		JSONResponses:    c.Bool("json-responses"),
+
+		Fsync:      c.Bool("fsync"),
+		AckTimeout: c.Duration("ack-timeout"),
+
+		ReceiptKeyFile: c.String("receipt-key"),
+		EncryptKey:     c.String("encrypt-key"),
+
+		CompressAtRest:    c.Bool("compress-at-rest"),
+		CompressSkipTypes: c.StringSlice("compress-skip-types"),
+		Precompress:       c.Bool("precompress"),
+		Dedupe:            c.Bool("dedupe"),
+		ClamAVAddress:     c.String("clamav-address"),
+		AllowExtensions:   c.StringSlice("allow-extensions"),
+		BlockMIME:         c.StringSlice("block-mime"),
+		VerifyContent:     c.Bool("verify-content"),
+		ProcessingDelay:   c.Duration("processing-delay"),
+		ProcessingWorkers: c.Int("processing-workers"),
+
+		UploadTokens: tokens,
+		AdminToken:   c.String("admin-token"),
+
+		AuthToken:        c.String("auth-token"),
+		ProtectDownloads: c.Bool("protect-downloads"),
+		URLSigningKey:    c.String("url-signing-key"),
+		UsersFile:        c.String("users-file"),
+
+		AccessTeamDomain:    c.String("access-team-domain"),
+		OIDCIssuer:          c.String("oidc-issuer"),
+		AccessAUD:           c.StringSlice("access-aud"),
+		AccessIdentityClaim: c.String("access-identity-claim"),
+
+		RateLimit:      c.Float64("rate-limit"),
+		BandwidthLimit: c.Int("bandwidth-limit"),
+		RateLimitRedis: c.String("rate-limit-redis"),
+		Peers:          c.StringSlice("peers"),
+		ClusterSecret:  c.String("cluster-secret"),
+
+		MaxDownloadSpeed: c.String("max-download-speed"),
+		MaxUploadSpeed:   c.String("max-upload-speed"),
+		ReadTimeout:      c.Duration("read-timeout"),
+		WriteTimeout:     c.Duration("write-timeout"),
+		IdleTimeout:      c.Duration("idle-timeout"),
+		StallTimeout:     c.Duration("stall-timeout"),
+		MinUploadSpeed:   c.String("min-upload-speed"),
+		CacheSize:        c.String("cache-size"),
+		CacheMaxAge:      c.Duration("cache-max-age"),
+
+		MaxUploadsPerUser:      c.Int("max-uploads-per-user"),
+		MaxConcurrentUploads:   c.Int("max-concurrent-uploads"),
+		MaxConcurrentDownloads: c.Int("max-concurrent-downloads"),
+		QueueTimeout:           c.Duration("queue-timeout"),
+
+		DownloadWebhookURL: c.String("download-webhook-url"),
+		WebhookURL:         c.String("webhook-url"),
+		WebhookSecret:      c.String("webhook-secret"),
+		SMTPHost:           c.String("smtp-host"),
+		SMTPPort:           c.Int("smtp-port"),
+		SMTPUsername:       c.String("smtp-username"),
+		SMTPPassword:       c.String("smtp-password"),
+		SMTPFrom:           c.String("smtp-from"),
+		EventsNATSURL:      c.String("events-nats-url"),
+		EventsSubject:      c.String("events-subject"),
+		MaxRanges:          c.Int("max-ranges"),
+		MetricsPort:        c.Int("metrics-port"),
+		AuditLog:           c.String("audit-log"),
+		LogLevel:           c.String("log-level"),
+		LogFormat:          c.String("log-format"),
+		OTelEndpoint:       c.String("otel-endpoint"),
+
+		ConfigFile: c.String("simpleserver-config"),
+	}
+	if config.ConfigFile != "" {
+		if err := loadConfigFile(config.ConfigFile, &config); err != nil {
+			log.Printf("Ignoring simpleserver config file: %v\n", err)
+		}
 	}
 	return New(config)
 }
 
 func (s *Server) Start() error {
-	var config = s.config
+	if err := s.prepare(); err != nil {
+		return err
+	}
+	defer s.shutdownTracing()
+	e := s.newRouter()
+	var port = 8080
+	if s.config.Port > 0 {
+		port = s.config.Port
+	}
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		return err
+	}
+	ln, err := s.listenHTTP(port)
+	if err != nil {
+		return err
+	}
+	attachListener(e, ln, tlsConfig)
+	s.applyTimeouts(e)
+	go func() {
+		if err := s.startup(); err != nil {
+			log.Printf("Failed to load upload index: %v\n", err)
+		}
+	}()
+	protocols := "HTTP/1.1, h2c"
+	if tlsConfig != nil {
+		protocols = "HTTPS, HTTP/2"
+	}
+	fmt.Printf("Server starting on %s (%s)...\n", s.listenAddrs(ln), protocols)
+	s.printBanner()
+	shutdownC := make(chan struct{})
+	go waitForSignal(shutdownC)
+	if s.config.ConfigFile != "" {
+		go s.watchConfig(shutdownC)
+	}
+	if s.config.MetricsPort > 0 {
+		go s.serveMetrics(shutdownC)
+	}
+	if s.config.SFTPPort > 0 {
+		go s.serveSFTP(shutdownC)
+	}
+	if s.config.FTPPort > 0 {
+		go s.serveFTP(shutdownC)
+	}
+	if s.config.GRPCPort > 0 {
+		go s.serveGRPC(shutdownC)
+	}
+	if s.config.S3Port > 0 {
+		go s.serveS3(shutdownC)
+	}
+	return s.serve(e, shutdownC)
+}
+
+func (s *Server) newRouter() *echo.Echo {
 	e := echo.New()
 	e.Debug = false
 	e.HideBanner = true
-	e.Use(middleware.Logger())
-	e.Use(middleware.CORS())
-	e.Pre(middleware.RemoveTrailingSlash())
-	var maxSize = 100
-	if config.MaxSize > 0 {
-		maxSize = config.MaxSize
-	}
-	e.Use(middleware.BodyLimit(fmt.Sprintf("%dM", maxSize)))
-	e.Use(middleware.GzipWithConfig(middleware.GzipConfig{
-		Level: 5,
+	e.HTTPErrorHandler = s.handleHTTPError
+	e.IPExtractor = s.clients.clientIP
+	e.Use(middleware.RequestID())
+	e.Use(s.negotiateLanguage)
+	e.Use(s.securityHeaders())
+	e.Use(s.requestLogger())
+	e.Use(s.traceRequests)
+	e.Use(s.auditAuthFailures)
+	e.Use(s.instrument)
+	if s.clients.enabled() {
+		e.Use(s.filterClients)
+	}
+	e.Use(s.requireStarted)
+	if !s.config.NoCORS {
+		e.Use(middleware.CORSWithConfig(s.corsConfig()))
+	}
+	e.Use(s.rateLimitClients)
+	if s.config.AccessTeamDomain != "" || s.config.OIDCIssuer != "" {
+		e.Use(s.requireAccess)
+	}
+	if target, err := parseProxyTarget(s.config.ProxyTarget); err == nil {
+		e.Pre(proxyUpstream(target))
+	}
+	// Relative links of static sites depend on the trailing slash of
+	// directories.
+	if s.config.ServeDir == "" {
+		e.Pre(middleware.RemoveTrailingSlash())
+	}
+	e.Use(middleware.BodyLimitWithConfig(middleware.BodyLimitConfig{
+		Limit:   fmt.Sprintf("%dM", s.maxSize()),
+		Skipper: isSingleFileUpload,
+	}))
+	// The guard watches the body as the client sends it, under any
+	// throttling of our own.
+	if s.config.StallTimeout > 0 {
+		e.Use(s.guardSlowClients)
+	}
+	upload, _ := parseSpeed(s.config.MaxUploadSpeed)
+	download, _ := parseSpeed(s.config.MaxDownloadSpeed)
+	if upload > 0 || download > 0 {
+		e.Use(throttleTransfers(upload, download))
+	}
+	// Byte ranges refer to the file itself, compressing them would leave
+	// clients unable to stitch them together. WebSockets are hijacked and
+	// never written through the middleware, and event streams and pipes must
+	// reach clients as soon as they are flushed.
+	e.Use(s.compressResponses(func(c echo.Context) bool {
+		urlPath := c.Request().URL.Path
+		return c.Request().Header.Get("Range") != "" || strings.HasPrefix(urlPath, progressPath+"/") || urlPath == eventsPath ||
+			strings.HasPrefix(urlPath, pipePath+"/")
 	}))
+	e.Use(s.trackProgress)
 
+	if s.config.ClusterSecret != "" {
+		e.GET(clusterBlobsPath+"/*", s.handlePeerBlob)
+	}
+	e.GET(startupPath, s.handleStartup)
+	e.GET(livePath, s.handleLive)
+	e.GET(healthPath, s.handleHealth)
+	e.GET(readyPath, s.handleReady)
+	// Some health checkers, like wget --spider, only send HEAD requests.
+	e.HEAD(healthPath, s.handleHealth)
+	e.HEAD(readyPath, s.handleReady)
+	if s.config.MetricsPort <= 0 {
+		e.GET(metricsPath, s.metricsHandler())
+	}
+	if s.config.ServeDir != "" {
+		s.registerStaticRoutes(e)
+		return e
+	}
 	e.GET("/favicon.ico", s.handleFavicon)
-	e.PUT("*", s.handleUpload)
-	e.GET("/:dir/:filename", s.handleDownload)
+	s.registerAdminRoutes(e)
+	s.registerDropShareRoutes(e)
+	s.registerTusRoutes(e)
+	s.registerChunkedRoutes(e)
+	s.registerDAVRoutes(e)
+	e.PUT("*", s.handleUpload, s.requireUploadAuth, s.rejectInMaintenance, s.limitUploadsPerUser, s.queueUploads)
+	e.PUT("/:dir/*", s.handleUpload, s.requireUploadAuth, s.rejectInMaintenance, s.limitUploadsPerUser, s.queueUploads)
+	e.PATCH("/:dir/*", s.handleAppend, s.requireUploadAuth, s.rejectInMaintenance, s.limitUploadsPerUser, s.queueUploads)
+	if !s.config.NoUI {
+		e.GET("/", s.handleUI)
+	}
+	e.POST("/", s.handleFormUpload, s.requireUploadAuth, s.rejectInMaintenance, s.limitUploadsPerUser, s.queueUploads)
+	e.POST(pastePath, s.handlePaste, s.requireUploadAuth, s.rejectInMaintenance, s.limitUploadsPerUser, s.queueUploads)
+	e.PUT(clipPath+"/:name", s.handleClipPut, s.requireUploadAuth, s.rejectInMaintenance)
+	e.GET(clipPath+"/:name", s.handleClipGet, s.requireDownloadAuth)
+	e.PUT(pipePath+"/:id", s.handlePipeSend, s.requireUploadAuth, s.rejectInMaintenance)
+	e.GET(pipePath+"/:id", s.handlePipeReceive, s.requireDownloadAuth)
+	e.POST(batchPath, s.handleBatch, s.requireUploadAuth, s.rejectInMaintenance, s.limitUploadsPerUser, s.queueUploads)
+	if !s.config.NoFetch {
+		e.POST(fetchPath, s.handleFetch, s.requireUploadAuth, s.rejectInMaintenance, s.limitUploadsPerUser, s.queueUploads)
+	}
+	e.GET("/s/:alias", s.handleShortLink, s.requireDownloadAuth, s.queueDownloads)
+	e.GET(receiptKeyPath, s.handleReceiptKey)
+	e.GET("/capabilities", s.handleCapabilities)
+	e.GET(searchPath, s.handleSearch)
+	e.GET(openAPIPath, s.handleOpenAPI)
+	if s.config.APIDocs {
+		e.GET(apiDocsPath, s.handleAPIDocs)
+	}
+	e.GET(progressPath+"/:id", s.handleProgress)
+	e.GET("/:dir", s.handleListing, s.requireListingAuth)
+	e.GET("/:dir/*", s.handleDownload, s.requireDownloadAuth, s.queueDownloads)
+	e.HEAD("/:dir/*", s.handleDownload, s.requireDownloadAuth)
+	e.POST("/:dir/*", s.handleFileAction, s.rejectInMaintenance)
+	e.DELETE("/:dir/*", s.handleDelete, s.rejectInMaintenance)
+	return e
+}
 
-	var port = 8080
-	if config.Port > 0 {
-		port = config.Port
+// maxSize is the request body limit in MB.
+func (s *Server) maxSize() int {
+	if s.config.MaxSize > 0 {
+		return s.config.MaxSize
 	}
-	fmt.Printf("Server starting on port %d...\n", port)
-	return e.Start(fmt.Sprintf(":%d", port))
+	return 100
+}
+
+// isSingleFileUpload reports whether c streams a single file with PUT, the
+// requests handleUpload enforces MaxSize on by itself.
+func isSingleFileUpload(c echo.Context) bool {
+	r := c.Request()
+	return r.Method == http.MethodPut && !isMultipart(r) && !isTarExtract(r)
 }
 
 func (s *Server) handleUpload(c echo.Context) error {
-	var dir = base58(6)
-	var uploadDir = filepath.Join(s.getUploadDir(), dir)
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		return c.String(http.StatusInternalServerError, "Failed to create upload directory")
+	if grant, signed, _ := s.presignedGrant(c); signed {
+		return s.handlePresignedUpload(c, grant)
 	}
-
-	filename := filepath.Base(c.Request().URL.Path)
-	if filename == "" {
-		filename = "uploaded-file"
+	if conditionalWrite(c.Request()) {
+		return s.handleConditionalUpload(c)
 	}
-
-	path := filepath.Join(uploadDir, filename)
-	file, err := os.Create(path)
+	if isMultipart(c.Request()) {
+		return s.handleMultipartUpload(c)
+	}
+	if isTarExtract(c.Request()) {
+		return s.handleTarUpload(c)
+	}
+	if id := c.Request().Header.Get(batchIDHeader); id != "" {
+		return s.stageBatchUpload(c, id)
+	}
+	dir, clientName := s.uploadDirFor(c), c.Request().URL.Path
+	if slug, name, ok := customSlug(clientName); ok && s.wantsCustomPath(c) && !s.isUserDir(dir) {
+		release, err := s.claimSlug(slug)
+		if err != nil {
+			return s.uploadError(c, err)
+		}
+		defer release()
+		dir, clientName = slug, name
+	}
+	filename, err := s.uploadFilename(clientName)
 	if err != nil {
-		return c.String(http.StatusInternalServerError, "Failed to create file")
+		return s.uploadError(c, err)
 	}
-	defer file.Close()
-
-	_, err = io.Copy(file, c.Request().Body)
+	// Single file uploads skip the body limit middleware and are held to
+	// MaxSize while they are copied, so they fail with errTooLarge. A known
+	// length is checked before any of the body is read, which spares
+	// clients sending Expect: 100-continue from sending it at all.
+	limit := int64(s.maxSize()) << 20
+	if size := c.Request().ContentLength; size > limit {
+		return s.uploadError(c, &sizeLimitError{limit: limit, over: size - limit})
+	}
+	meta, err := s.saveUpload(c, dir, filename, &maxBytesReader{r: c.Request().Body, n: limit})
 	if err != nil {
-		return c.String(http.StatusInternalServerError, "Failed to save file")
+		return s.uploadError(c, err)
 	}
-
-	downloadURL := fmt.Sprintf("http://%s/%s/%s", c.Request().Host, dir, filename)
-	return c.String(http.StatusCreated, fmt.Sprintf("File uploaded successfully. Download at:\n%s\n", downloadURL))
+	return s.uploaded(c, meta)
 }
 
-func (s *Server) handleDownload(c echo.Context) error {
-	dir := c.Param("dir")
-	filename := c.Param("filename")
-	path := filepath.Join(s.getUploadDir(), dir, filename)
-
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return c.String(http.StatusNotFound, "File not found")
+// uploadDetails renders the lines printed under a download link: the
+// checksum, then the short link and receipt when enabled.
+func (s *Server) uploadDetails(c echo.Context, meta FileMeta) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "SHA-256: %s\n", meta.SHA256)
+	if meta.MaxDownloads > 0 {
+		fmt.Fprintf(&b, "Downloads allowed: %d\n", meta.MaxDownloads)
 	}
-
-	return c.File(path)
+	if meta.Alias != "" {
+		fmt.Fprintf(&b, "Short link: %s\n", s.shortURL(c, meta.Alias))
+	}
+	if s.config.EnableQR {
+		fmt.Fprintf(&b, "QR code: %s\n", s.qrURL(c, meta))
+	}
+	if s.receiptKey != nil {
+		receipt, signature := s.signReceipt(meta)
+		fmt.Fprintf(&b, "Receipt: %s\nSignature: %s\n", receipt, signature)
+	}
+	if token := deleteTokenOf(c, meta); token != "" {
+		fmt.Fprintf(&b, "Delete with: curl -X DELETE '%s'\n", s.deleteURL(c, meta, token))
+	}
+	return b.String()
 }
 
 func (s *Server) handleFavicon(c echo.Context) error {
@@ -136,38 +1634,51 @@ func (s *Server) handleFavicon(c echo.Context) error {
 	return c.Blob(http.StatusOK, "image/svg+xml", []byte(svg))
 }
 
-func (s *Server) getUploadDir() string {
-	uploadDir := s.config.UploadDir
-	if uploadDir == "" {
-		uploadDir = filepath.Join(os.TempDir(), "uploads")
+// downloadURL builds the public link for a stored file. name may contain
+// forward slashes when the upload preserved its directory structure.
+func (s *Server) downloadURL(c echo.Context, dir, name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
 	}
-	return uploadDir
+	return fmt.Sprintf("%s/%s/%s", s.baseURL(c), dir, strings.Join(segments, "/"))
 }
 
-func base58(size int) string {
-	const (
-		alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
-	)
-
-	var id = make([]byte, size)
-	if _, err := rand.Read(id); err != nil {
-		return "0"
+// baseURL is the scheme, host and base path links handed to clients start
+// with. Behind cloudflared or another proxy the request itself is plain
+// HTTP to localhost, so the forwarded headers are preferred.
+func (s *Server) baseURL(c echo.Context) string {
+	if s.config.PublicURL != "" {
+		return strings.TrimSuffix(s.config.PublicURL, "/") + basePath(c)
+	}
+	req := c.Request()
+	if !s.clients.trustsPeer(req) {
+		// Anyone else could make links point at a host of their choosing.
+		scheme := "http"
+		if req.TLS != nil {
+			scheme = "https"
+		}
+		return scheme + "://" + req.Host + basePath(c)
 	}
-	for i, p := range id {
-		id[i] = alphabet[int(p)%len(alphabet)] // discard everything but the least significant bits
+	host := req.Host
+	if forwarded := req.Header.Get("X-Forwarded-Host"); forwarded != "" {
+		host, _, _ = strings.Cut(forwarded, ",")
+		host = strings.TrimSpace(host)
 	}
-	return string(id)
+	scheme, _, _ := strings.Cut(c.Scheme(), ",")
+	return strings.TrimSpace(scheme) + "://" + host + basePath(c)
 }
 
-func waitForSignal(graceShutdownC chan struct{}) {
-	signals := make(chan os.Signal, 10)
-	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
-	defer signal.Stop(signals)
+func (s *Server) getUploadDir() string {
+	return s.config.uploadDir()
+}
 
-	select {
-	case s := <-signals:
-		log.Printf("Initiating graceful shutdown due to signal %s ...\n", s)
-		close(graceShutdownC)
-	case <-graceShutdownC:
+func (c Config) uploadDir() string {
+	switch {
+	case c.UploadDir != "":
+		return c.UploadDir
+	case c.StateDir != "":
+		return filepath.Join(c.StateDir, stateUploadsDir)
 	}
+	return filepath.Join(os.TempDir(), "uploads")
 }
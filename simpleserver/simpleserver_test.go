@@ -0,0 +1,150 @@
+package simpleserver
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func newTestServer(t testing.TB, config Config) *Server {
+	t.Helper()
+	if config.UploadDir == "" {
+		config.UploadDir = t.TempDir()
+	}
+	s := New(config)
+	require.NoError(t, s.startup())
+	return s
+}
+
+func serve(s *Server, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.newRouter().ServeHTTP(rec, req)
+	return rec
+}
+
+// downloadURLs extracts the links printed in a plain text upload response.
+func downloadURLs(t *testing.T, body string) []string {
+	t.Helper()
+	var urls []string
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "http://") || strings.HasPrefix(line, "https://") {
+			urls = append(urls, line)
+		}
+	}
+	require.NotEmpty(t, urls, "no download url in %q", body)
+	return urls
+}
+
+// shareDirs lists the upload directories, skipping server state.
+func shareDirs(t *testing.T, s *Server) []string {
+	t.Helper()
+	entries, err := os.ReadDir(s.getUploadDir())
+	require.NoError(t, err)
+	var dirs []string
+	for _, entry := range entries {
+		if isShareDir(entry.Name()) {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+	return dirs
+}
+
+func download(t *testing.T, s *Server, rawURL string) *httptest.ResponseRecorder {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+	return serve(s, httptest.NewRequest(http.MethodGet, u.RequestURI(), nil))
+}
+
+func TestWithCtxReadsEnvironment(t *testing.T) {
+	t.Setenv("SIMPLESERVER_PORT", "9090")
+	t.Setenv("SIMPLESERVER_UPLOAD_DIR", "/srv/uploads")
+	t.Setenv("SIMPLESERVER_AUTH_TOKEN", "secret")
+	t.Setenv("SIMPLESERVER_MAXSIZE", "25")
+	var config Config
+	app := &cli.App{
+		Flags: Flags(),
+		Action: func(c *cli.Context) error {
+			config = WithCtx(c).config
+			return nil
+		},
+	}
+	require.NoError(t, app.Run([]string{"simpleserver", "--port", "7070"}))
+	require.Equal(t, 7070, config.Port, "flags win over the environment")
+	require.Equal(t, "/srv/uploads", config.UploadDir)
+	require.Equal(t, "secret", config.AuthToken)
+	require.Equal(t, 25, config.MaxSize)
+}
+
+func TestDownloadLinksFollowForwardedHeaders(t *testing.T) {
+	s := newTestServer(t, Config{})
+	req := httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("hello"))
+	req.RemoteAddr = "127.0.0.1:4321"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "files.example.com, proxy.internal")
+	rec := serve(s, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Regexp(t, `^https://files\.example\.com/\w+/notes\.txt$`, downloadURLs(t, rec.Body.String())[0])
+
+	// Only trusted proxies may name the host and scheme.
+	req = httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("hello"))
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "evil.example.com")
+	rec = serve(s, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Regexp(t, `^http://example\.com/\w+/notes\.txt$`, downloadURLs(t, rec.Body.String())[0])
+
+	s = newTestServer(t, Config{PublicURL: "https://share.example.com/"})
+	rec = serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("hello")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Regexp(t, `^https://share\.example\.com/\w+/notes\.txt$`, downloadURLs(t, rec.Body.String())[0])
+}
+
+func TestUploadAndDownload(t *testing.T) {
+	s := newTestServer(t, Config{})
+
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/hello.txt", strings.NewReader("hello world")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	urls := downloadURLs(t, rec.Body.String())
+	require.Len(t, urls, 1)
+	require.True(t, strings.HasSuffix(urls[0], "/hello.txt"))
+
+	rec = download(t, s, urls[0])
+	require.Equal(t, http.StatusOK, rec.Code)
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(body))
+}
+
+func TestExpectContinueRejectsBeforeTheBody(t *testing.T) {
+	s := newTestServer(t, Config{AuthToken: "secret", MaxSize: 1})
+	ts := httptest.NewServer(s.newRouter())
+	defer ts.Close()
+	// firstLine sends the head of an upload and returns the first status
+	// line the server answers with before any of the body is sent.
+	firstLine := func(head string) string {
+		t.Helper()
+		conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = io.WriteString(conn, head+"Host: example.com\r\nExpect: 100-continue\r\n\r\n")
+		require.NoError(t, err)
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		require.NoError(t, err)
+		return strings.TrimSpace(line)
+	}
+
+	require.Equal(t, "HTTP/1.1 100 Continue", firstLine("PUT /hello.txt HTTP/1.1\r\nAuthorization: Bearer secret\r\nContent-Length: 5\r\n"))
+	require.Equal(t, "HTTP/1.1 413 Request Entity Too Large", firstLine("PUT /hello.txt HTTP/1.1\r\nAuthorization: Bearer secret\r\nContent-Length: 2000000\r\n"))
+	require.Equal(t, "HTTP/1.1 401 Unauthorized", firstLine("PUT /hello.txt HTTP/1.1\r\nContent-Length: 5\r\n"))
+	require.Equal(t, "HTTP/1.1 413 Request Entity Too Large", firstLine("POST /upload HTTP/1.1\r\nAuthorization: Bearer secret\r\nContent-Type: multipart/form-data; boundary=x\r\nContent-Length: 2000000\r\n"))
+}
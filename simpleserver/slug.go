@@ -0,0 +1,151 @@
+package simpleserver
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	customPathHeader  = "X-Custom-Path"
+	defaultSlugLength = 6
+	maxSlugLength     = 64
+)
+
+var (
+	errInvalidSlug = errors.New("custom path may only use letters, digits, '-' and '_'")
+	errSlugTaken   = errors.New("custom path is already taken")
+)
+
+// reservedSlugs are the first path segments of the server's own routes. A
+// share dir named after one of them could not be downloaded from.
+var reservedSlugs = map[string]bool{
+	"admin":                                 true,
+	"s":                                     true,
+	"capabilities":                          true,
+	"favicon.ico":                           true,
+	"ws":                                    true,
+	"cluster":                               true,
+	strings.TrimPrefix(dropSharesPath, "/"): true,
+	strings.TrimPrefix(pastePath, "/"):      true,
+	strings.TrimPrefix(fetchPath, "/"):      true,
+	strings.TrimPrefix(clipPath, "/"):       true,
+	strings.TrimPrefix(pipePath, "/"):       true,
+	strings.TrimPrefix(batchPath, "/"):      true,
+	strings.TrimPrefix(eventsPath, "/"):     true,
+	strings.TrimPrefix(tusPath, "/"):        true,
+	strings.TrimPrefix(chunkedPath, "/"):    true,
+	strings.TrimPrefix(davPrefix, "/"):      true,
+	strings.TrimPrefix(startupPath, "/"):    true,
+	strings.TrimPrefix(livePath, "/"):       true,
+	strings.TrimPrefix(healthPath, "/"):     true,
+	strings.TrimPrefix(readyPath, "/"):      true,
+	strings.TrimPrefix(metricsPath, "/"):    true,
+	strings.TrimPrefix(receiptKeyPath, "/"): true,
+	strings.TrimPrefix(openAPIPath, "/"):    true,
+	strings.TrimPrefix(searchPath, "/"):     true,
+}
+
+// hasDir reports whether any file is stored in the upload directory dir.
+func (ix *metaIndex) hasDir(dir string) bool {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.dirs[dir] > 0
+}
+
+// addDir and dropDir count the files of every upload directory. The caller
+// must hold ix.mu.
+func (ix *metaIndex) addDir(meta FileMeta) {
+	ix.dirs[meta.Dir]++
+}
+
+func (ix *metaIndex) dropDir(meta FileMeta) {
+	if ix.dirs[meta.Dir]--; ix.dirs[meta.Dir] <= 0 {
+		delete(ix.dirs, meta.Dir)
+	}
+}
+
+func (s *Server) slugLength() int {
+	if s.config.SlugLength > 0 {
+		return min(s.config.SlugLength, maxSlugLength)
+	}
+	return defaultSlugLength
+}
+
+// newShareDir picks a random upload directory that is not in use yet,
+// drawing again on every collision: with files in the index, a custom slug
+// being claimed, a drop share, a user dir or a directory left on disk.
+// Collisions only become likely with a short SlugLength, or once custom
+// slugs take names that random ones could also produce.
+func (s *Server) newShareDir() string {
+	for {
+		dir := s.ids.NewID()
+		if s.shareDirFree(dir) {
+			return dir
+		}
+	}
+}
+
+func (s *Server) shareDirFree(dir string) bool {
+	if _, claimed := s.slugClaims.Load(dir); claimed {
+		return false
+	}
+	// /docs is only taken when Swagger UI is served, as it is a common
+	// name for a share.
+	if s.config.APIDocs && "/"+dir == apiDocsPath {
+		return false
+	}
+	if s.index.hasDir(dir) || reservedSlugs[dir] || s.claimedByDropShare(dir) || s.isUserDir(dir) {
+		return false
+	}
+	_, err := os.Lstat(filepath.Join(s.getUploadDir(), dir))
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+// wantsCustomPath reports whether a PUT to /<slug>/<filename> stores the
+// file under <slug>, either because the client asked for it with
+// X-Custom-Path: true or because AllowCustomPaths is set.
+func (s *Server) wantsCustomPath(c echo.Context) bool {
+	return s.config.AllowCustomPaths || strings.EqualFold(c.Request().Header.Get(customPathHeader), "true")
+}
+
+// customSlug splits a /<slug>/<filename> upload path. ok is false for paths
+// without a slug, which get a random directory as usual.
+func customSlug(urlPath string) (slug, filename string, ok bool) {
+	slug, filename, ok = strings.Cut(strings.TrimPrefix(urlPath, "/"), "/")
+	return slug, filename, ok && filename != ""
+}
+
+func validSlug(slug string) bool {
+	if slug == "" || len(slug) > maxSlugLength || reservedSlugs[slug] {
+		return false
+	}
+	for _, r := range slug {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// claimSlug reserves slug for a single upload. It fails with errSlugTaken
+// when the slug already holds files or another upload is claiming it. The
+// returned release must be called once the upload is stored or failed.
+func (s *Server) claimSlug(slug string) (release func(), err error) {
+	if !validSlug(slug) {
+		return nil, errInvalidSlug
+	}
+	if _, taken := s.slugClaims.LoadOrStore(slug, struct{}{}); taken {
+		return nil, errSlugTaken
+	}
+	release = func() { s.slugClaims.Delete(slug) }
+	if s.index.hasDir(slug) || s.claimedByDropShare(slug) || s.isUserDir(slug) {
+		release()
+		return nil, errSlugTaken
+	}
+	return release, nil
+}
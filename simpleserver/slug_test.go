@@ -0,0 +1,100 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func customPathRequest(target, content string) *http.Request {
+	req := httptest.NewRequest(http.MethodPut, target, strings.NewReader(content))
+	req.Header.Set(customPathHeader, "true")
+	return req
+}
+
+func TestCustomPathUpload(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, customPathRequest("/quarterly-report/report.txt", "q3"))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Equal(t, []string{"http://example.com/quarterly-report/report.txt"}, downloadURLs(t, rec.Body.String()))
+	require.Equal(t, "q3", download(t, s, "http://example.com/quarterly-report/report.txt").Body.String())
+
+	rec = serve(s, customPathRequest("/quarterly-report/other.txt", "other"))
+	require.Equal(t, http.StatusConflict, rec.Code)
+
+	// Without the header the first segment is dropped as before.
+	rec = serve(s, httptest.NewRequest(http.MethodPut, "/quarterly-report/plain.txt", strings.NewReader("plain")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.NotEqual(t, "quarterly-report", findMeta(t, s, "plain.txt").Dir)
+}
+
+func TestCustomPathValidation(t *testing.T) {
+	s := newTestServer(t, Config{AllowCustomPaths: true})
+	for _, target := range []string{"/receipt-key/a.txt", "/livez/a.txt", "/.meta/a.txt", "/sp%20ace/a.txt", "/" + strings.Repeat("x", maxSlugLength+1) + "/a.txt"} {
+		rec := serve(s, httptest.NewRequest(http.MethodPut, target, strings.NewReader("a")))
+		require.Equal(t, http.StatusBadRequest, rec.Code, target)
+	}
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/my_slug-1/a.txt", strings.NewReader("a")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Equal(t, "my_slug-1", findMeta(t, s, "a.txt").Dir)
+	require.Zero(t, len(s.index.inDir("admin")))
+}
+
+func TestConcurrentCustomPathsCollide(t *testing.T) {
+	s := newTestServer(t, Config{AllowCustomPaths: true})
+	// The router is built once, as building one per request races.
+	h := s.newRouter()
+	var wg sync.WaitGroup
+	codes := make(chan int, 8)
+	for i := 0; i < cap(codes); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/shared/a.txt", strings.NewReader("a")))
+			codes <- rec.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	created := 0
+	for code := range codes {
+		if code == http.StatusCreated {
+			created++
+		} else {
+			require.Equal(t, http.StatusConflict, code)
+		}
+	}
+	require.Equal(t, 1, created)
+}
+
+func TestSlugLength(t *testing.T) {
+	s := newTestServer(t, Config{SlugLength: 12})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("a")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Len(t, findMeta(t, s, "a.txt").Dir, 12)
+}
+
+func TestIndexTracksDirs(t *testing.T) {
+	ix := newMetaIndex(sidecarStore{root: t.TempDir()})
+	a := FileMeta{Dir: "share", Name: "a.txt"}
+	b := FileMeta{Dir: "share", Name: "b.txt"}
+	require.NoError(t, ix.put(a))
+	require.NoError(t, ix.put(b))
+	require.NoError(t, ix.put(b))
+	require.True(t, ix.hasDir("share"))
+	require.False(t, ix.hasDir("shar"))
+
+	require.NoError(t, ix.delete("share", "a.txt"))
+	require.True(t, ix.hasDir("share"))
+	require.NoError(t, ix.delete("share", "b.txt"))
+	require.False(t, ix.hasDir("share"))
+
+	require.NoError(t, ix.put(a))
+	require.NoError(t, ix.load())
+	require.True(t, ix.hasDir("share"))
+}
@@ -0,0 +1,101 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	eventsPath = "/events"
+	// eventsKeepAlive is how often an idle feed sends a comment, so proxies
+	// and the tunnel do not close it.
+	eventsKeepAlive   = 30 * time.Second
+	eventsFeedBacklog = 64
+)
+
+// eventFeed hands every published event to the clients following
+// GET /events. Clients that fall behind miss events instead of holding up
+// the others.
+type eventFeed struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+func newEventFeed() *eventFeed {
+	return &eventFeed{subs: make(map[chan Event]struct{})}
+}
+
+func (f *eventFeed) subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, eventsFeedBacklog)
+	f.mu.Lock()
+	f.subs[ch] = struct{}{}
+	f.mu.Unlock()
+	return ch, func() {
+		f.mu.Lock()
+		delete(f.subs, ch)
+		f.mu.Unlock()
+	}
+}
+
+func (f *eventFeed) publish(event Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subs {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// handleEvents streams events as Server-Sent Events, named after their
+// type. ?types=upload,expire narrows the feed to those types.
+func (s *Server) handleEvents(c echo.Context) error {
+	var types map[string]bool
+	if param := c.QueryParam("types"); param != "" {
+		types = make(map[string]bool)
+		for _, t := range strings.Split(param, ",") {
+			types[strings.TrimSpace(t)] = true
+		}
+	}
+	events, cancel := s.feed.subscribe()
+	defer cancel()
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set(echo.HeaderCacheControl, "no-cache")
+	w.WriteHeader(http.StatusOK)
+	w.Flush()
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	var id int64
+	for {
+		select {
+		case event := <-events:
+			if types != nil && !types[event.Type] {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			id++
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, event.Type, data); err != nil {
+				return nil
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+		case <-c.Request().Context().Done():
+			return nil
+		}
+		w.Flush()
+	}
+}
@@ -0,0 +1,84 @@
+package simpleserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func followEvents(t *testing.T, ts *httptest.Server, query string) *bufio.Reader {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, ts.URL+eventsPath+query, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	return bufio.NewReader(resp.Body)
+}
+
+// nextSSE reads the next event of an event stream.
+func nextSSE(t *testing.T, r *bufio.Reader) (string, Event) {
+	t.Helper()
+	var name string
+	var event Event
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && name != "":
+			return name, event
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event))
+		}
+	}
+}
+
+func TestEventsFeed(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken})
+	ts := httptest.NewServer(s.newRouter())
+	// Registered first so it runs after the streams are closed.
+	t.Cleanup(ts.Close)
+	all := followEvents(t, ts, "")
+	deletes := followEvents(t, ts, "?types=delete")
+
+	req := httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("notes"))
+	require.Equal(t, http.StatusCreated, serve(s, req).Code)
+	meta := findMeta(t, s, "notes.txt")
+	require.Equal(t, http.StatusOK, download(t, s, "/"+meta.Dir+"/notes.txt").Code)
+	require.NoError(t, s.deleteFile(meta))
+
+	name, event := nextSSE(t, all)
+	require.Equal(t, EventUpload, name)
+	require.Equal(t, meta.Name, event.Filename)
+	require.Equal(t, meta.SHA256, event.SHA256)
+	name, _ = nextSSE(t, all)
+	require.Equal(t, EventDownload, name)
+	name, _ = nextSSE(t, all)
+	require.Equal(t, EventDelete, name)
+	name, event = nextSSE(t, deletes)
+	require.Equal(t, EventDelete, name)
+	require.Equal(t, meta.Dir, event.Dir)
+}
+
+func TestEventsFeedRequiresAdminToken(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken})
+	rec := serve(s, httptest.NewRequest(http.MethodGet, eventsPath, nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	s = newTestServer(t, Config{})
+	rec = serve(s, httptest.NewRequest(http.MethodGet, eventsPath, nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
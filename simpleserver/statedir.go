@@ -0,0 +1,63 @@
+package simpleserver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// The layout of Config.StateDir. Only uploads/ is served, so the rest needs
+// no dot names to stay out of listings.
+const (
+	stateUploadsDir  = "uploads"
+	stateTempDir     = "tmp"
+	stateAutocertDir = "autocert"
+	stateSFTPHostKey = "sftp_host_key"
+)
+
+// checkStateDir creates the dirs of StateDir and makes sure they are
+// writable, as nothing outside of them is when the root filesystem is
+// read-only.
+func (c Config) checkStateDir() error {
+	for _, dir := range []string{c.StateDir, filepath.Join(c.StateDir, stateTempDir)} {
+		if err := checkWritableDir(dir); err != nil {
+			return fmt.Errorf("--state-dir %s is not writable, mount a writable volume there: %w", c.StateDir, err)
+		}
+	}
+	return nil
+}
+
+// useStateTempDir points the temporary dir of the process into StateDir, so
+// temporary files of libraries and processing commands stay off the root
+// filesystem as well.
+func (c Config) useStateTempDir() error {
+	if c.StateDir == "" {
+		return nil
+	}
+	env := "TMPDIR"
+	if runtime.GOOS == "windows" {
+		env = "TMP"
+	}
+	return os.Setenv(env, filepath.Join(c.StateDir, stateTempDir))
+}
+
+func (c Config) autoTLSCacheDir() string {
+	switch {
+	case c.AutoTLSCacheDir != "":
+		return c.AutoTLSCacheDir
+	case c.StateDir != "":
+		return filepath.Join(c.StateDir, stateAutocertDir)
+	}
+	return filepath.Join(c.uploadDir(), autoTLSCacheDirName)
+}
+
+func (c Config) sftpHostKey() string {
+	switch {
+	case c.SFTPHostKey != "":
+		return c.SFTPHostKey
+	case c.StateDir != "":
+		return filepath.Join(c.StateDir, stateSFTPHostKey)
+	}
+	return filepath.Join(c.uploadDir(), sftpHostKeyName)
+}
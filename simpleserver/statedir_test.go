@@ -0,0 +1,48 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateDirHoldsWritablePaths(t *testing.T) {
+	state := t.TempDir()
+	config := Config{StateDir: state}
+	require.NoError(t, config.Validate())
+	require.Equal(t, filepath.Join(state, "uploads"), config.uploadDir())
+	require.Equal(t, filepath.Join(state, "autocert"), config.autoTLSCacheDir())
+	require.Equal(t, filepath.Join(state, "sftp_host_key"), config.sftpHostKey())
+	require.DirExists(t, filepath.Join(state, "tmp"))
+
+	config.UploadDir = t.TempDir()
+	config.AutoTLSCacheDir = "/etc/autocert"
+	require.Equal(t, config.UploadDir, config.uploadDir())
+	require.Equal(t, "/etc/autocert", config.autoTLSCacheDir())
+
+	s := New(Config{StateDir: state})
+	require.NoError(t, s.startup())
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("notes")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	meta := findMeta(t, s, "notes.txt")
+	require.FileExists(t, filepath.Join(state, "uploads", filepath.FromSlash(meta.key())))
+}
+
+func TestUnwritableStateDir(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "state")
+	require.NoError(t, os.WriteFile(state, nil, 0644))
+	require.ErrorContains(t, Config{StateDir: state}.Validate(), "--state-dir")
+}
+
+func TestHealthAnswersHead(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodHead, healthPath, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = serve(s, httptest.NewRequest(http.MethodHead, readyPath, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+}
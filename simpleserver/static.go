@@ -0,0 +1,189 @@
+package simpleserver
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// staticIndex is served for a directory instead of its listing.
+	staticIndex = "index.html"
+	// staticCacheControl lets clients keep served files but revalidate them
+	// with their ETag first, since a build output changes under the same
+	// names.
+	staticCacheControl = "no-cache"
+)
+
+var errNotDir = errors.New("not a directory")
+
+// checkServeDir fails for a Config.ServeDir that is not a directory.
+func checkServeDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s: %w", dir, errNotDir)
+	}
+	return nil
+}
+
+// registerStaticRoutes serves Config.ServeDir read-only in place of the
+// upload routes.
+func (s *Server) registerStaticRoutes(e *echo.Echo) {
+	e.GET("/*", s.handleStatic, s.requireDownloadAuth)
+	e.HEAD("/*", s.handleStatic, s.requireDownloadAuth)
+}
+
+// staticName maps a request path to a name in the served directory. Paths
+// naming dot files, such as .git or .env, are refused.
+func staticName(urlPath string) (string, bool) {
+	name := strings.Trim(path.Clean("/"+urlPath), "/")
+	if name == "" {
+		return ".", true
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return "", false
+		}
+	}
+	return name, fs.ValidPath(name)
+}
+
+func (s *Server) handleStatic(c echo.Context) error {
+	urlPath := c.Request().URL.Path
+	name, ok := staticName(urlPath)
+	if !ok {
+		return s.fileNotFound(c)
+	}
+	root := os.DirFS(s.config.ServeDir)
+	info, err := fs.Stat(root, name)
+	if err != nil {
+		return s.fileNotFound(c)
+	}
+	if !info.IsDir() {
+		return serveStaticFile(c, root, name, info)
+	}
+	// Relative links of index pages resolve against the directory only
+	// with a trailing slash.
+	if !strings.HasSuffix(urlPath, "/") {
+		target := (&url.URL{Path: basePath(c) + urlPath + "/", RawQuery: c.Request().URL.RawQuery}).String()
+		return c.Redirect(http.StatusMovedPermanently, target)
+	}
+	index := path.Join(name, staticIndex)
+	if info, err := fs.Stat(root, index); err == nil && info.Mode().IsRegular() {
+		return serveStaticFile(c, root, index, info)
+	}
+	return serveStaticListing(c, root, name, urlPath)
+}
+
+// serveStaticFile answers with name, honoring ranges and conditional
+// requests against its ETag and modification time.
+func serveStaticFile(c echo.Context, root fs.FS, name string, info fs.FileInfo) error {
+	if !info.Mode().IsRegular() {
+		return fail(c, http.StatusNotFound, "File not found")
+	}
+	file, err := root.Open(name)
+	if err != nil {
+		return fail(c, http.StatusNotFound, "File not found")
+	}
+	defer file.Close()
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		return fail(c, http.StatusInternalServerError, "File not seekable")
+	}
+	header := c.Response().Header()
+	header.Set("ETag", staticETag(info))
+	header.Set("Cache-Control", staticCacheControl)
+	http.ServeContent(c.Response(), c.Request(), info.Name(), info.ModTime(), content)
+	return nil
+}
+
+// staticETag derives a validator from the size and modification time of a
+// file, so serving it never needs to read it whole.
+func staticETag(info fs.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+type staticEntry struct {
+	Name    string
+	Href    string
+	Dir     bool
+	Size    int64
+	ModTime time.Time
+}
+
+type staticListing struct {
+	Path    string
+	Parent  bool
+	Entries []staticEntry
+}
+
+var staticListingPage = template.Must(template.New("static").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Index of {{.Path}}</title>
+</head>
+<body style="font-family: system-ui, sans-serif; max-width: 50rem; margin: 3rem auto; padding: 0 1rem">
+<h1>Index of {{.Path}}</h1>
+<table style="width: 100%; border-collapse: collapse">
+<tr><th align="left">Name</th><th align="right">Size</th><th align="right">Modified</th></tr>
+{{if .Parent}}<tr><td><a href="../">../</a></td><td></td><td></td></tr>
+{{end}}{{range .Entries}}<tr><td><a href="{{.Href}}">{{.Name}}{{if .Dir}}/{{end}}</a></td><td align="right">{{if not .Dir}}{{.Size}}{{end}}</td><td align="right">{{.ModTime.Format "2006-01-02 15:04"}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// serveStaticListing renders the index page of the directory name, listing
+// its subdirectories first. Dot files are left out, as they are not served.
+func serveStaticListing(c echo.Context, root fs.FS, name, urlPath string) error {
+	entries, err := fs.ReadDir(root, name)
+	if err != nil {
+		return fail(c, http.StatusNotFound, "File not found")
+	}
+	listing := staticListing{Path: urlPath, Parent: name != ".", Entries: []staticEntry{}}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		href := url.PathEscape(entry.Name())
+		if entry.IsDir() {
+			href += "/"
+		}
+		listing.Entries = append(listing.Entries, staticEntry{
+			Name:    entry.Name(),
+			Href:    href,
+			Dir:     entry.IsDir(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+	sort.SliceStable(listing.Entries, func(i, j int) bool {
+		return listing.Entries[i].Dir && !listing.Entries[j].Dir
+	})
+	var page strings.Builder
+	if err := staticListingPage.Execute(&page, listing); err != nil {
+		return err
+	}
+	c.Response().Header().Set("Cache-Control", staticCacheControl)
+	return c.HTML(http.StatusOK, page.String())
+}
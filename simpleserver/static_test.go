@@ -0,0 +1,93 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newStaticServer(t *testing.T) *Server {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "docs", "img"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "site"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.js"), []byte("console.log('hi')"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docs", "guide.txt"), []byte("read me"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "site", "index.html"), []byte("<h1>site</h1>"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".env"), []byte("SECRET=1"), 0644))
+	return newTestServer(t, Config{ServeDir: dir})
+}
+
+func TestStaticServesFilesWithETags(t *testing.T) {
+	s := newStaticServer(t)
+	rec := serve(s, httptest.NewRequest(http.MethodGet, "/app.js", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "console.log('hi')", rec.Body.String())
+	require.Equal(t, staticCacheControl, rec.Header().Get("Cache-Control"))
+	require.NotEmpty(t, rec.Header().Get("Last-Modified"))
+	etag := rec.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	req := httptest.NewRequest(http.MethodGet, "/app.js", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = serve(s, req)
+	require.Equal(t, http.StatusNotModified, rec.Code)
+	require.Empty(t, rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/docs/guide.txt", nil)
+	req.Header.Set("Range", "bytes=0-3")
+	rec = serve(s, req)
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	require.Equal(t, "read", rec.Body.String())
+}
+
+func TestStaticDirectoryIndex(t *testing.T) {
+	s := newStaticServer(t)
+	rec := serve(s, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	require.Contains(t, body, `<a href="docs/">docs/</a>`)
+	require.Contains(t, body, `<a href="app.js">app.js</a>`)
+	require.NotContains(t, body, ".env")
+	require.Less(t, strings.Index(body, "docs/"), strings.Index(body, "app.js"))
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	require.Equal(t, http.StatusMovedPermanently, rec.Code)
+	require.Equal(t, "/docs/", rec.Header().Get("Location"))
+	rec = serve(s, httptest.NewRequest(http.MethodGet, "/docs/", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `<a href="img/">img/</a>`)
+	require.Contains(t, rec.Body.String(), `<a href="../">../</a>`)
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, "/site/", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "<h1>site</h1>", rec.Body.String())
+}
+
+func TestStaticIsReadOnly(t *testing.T) {
+	s := newStaticServer(t)
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/upload.txt", strings.NewReader("data")))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	rec = serve(s, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("data")))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	_, err := os.Stat(filepath.Join(s.config.ServeDir, "upload.txt"))
+	require.True(t, os.IsNotExist(err))
+
+	for _, target := range []string{"/.env", "/docs/../.env", "/missing.txt"} {
+		rec = serve(s, httptest.NewRequest(http.MethodGet, target, nil))
+		require.Equal(t, http.StatusNotFound, rec.Code, target)
+	}
+}
+
+func TestCheckServeDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, checkServeDir(dir))
+	file := filepath.Join(dir, "file.txt")
+	require.NoError(t, os.WriteFile(file, nil, 0644))
+	require.ErrorIs(t, checkServeDir(file), errNotDir)
+}
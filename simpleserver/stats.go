@@ -0,0 +1,134 @@
+package simpleserver
+
+import (
+	"encoding/csv"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	statsDateLayout = "2006-01-02"
+	// defaultStatsDays is the range exported without ?from.
+	defaultStatsDays = 30
+	maxStatsDays     = 366
+	defaultStatsTop  = 5
+)
+
+// dayStats sums the uploads of a single UTC day. The metadata does not
+// record when downloads happened, so Downloads and BytesOut count those of
+// the files uploaded that day, as of the export.
+type dayStats struct {
+	Date      string      `json:"date"`
+	Uploads   int         `json:"uploads"`
+	BytesIn   int64       `json:"bytes_in"`
+	Downloads int64       `json:"downloads"`
+	BytesOut  int64       `json:"bytes_out"`
+	TopFiles  []fileUsage `json:"top_files"`
+}
+
+type statsExport struct {
+	From string     `json:"from"`
+	To   string     `json:"to"`
+	Days []dayStats `json:"days"`
+}
+
+// handleStatsExport reports per day upload counts, bytes in and out and
+// the files that served the most bytes between ?from and ?to, both
+// inclusive UTC dates, as JSON or, with ?format=csv, one CSV row per day.
+// Files that were deleted or expired are no longer counted.
+func (s *Server) handleStatsExport(c echo.Context) error {
+	format := c.QueryParam("format")
+	if format != "" && format != "json" && format != "csv" {
+		return fail(c, http.StatusBadRequest, "format must be json or csv")
+	}
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	from := to.AddDate(0, 0, 1-defaultStatsDays)
+	for name, bound := range map[string]*time.Time{"from": &from, "to": &to} {
+		if value := c.QueryParam(name); value != "" {
+			parsed, err := time.Parse(statsDateLayout, value)
+			if err != nil {
+				return fail(c, http.StatusBadRequest, name+" must be a date such as 2024-01-31")
+			}
+			*bound = parsed
+		}
+	}
+	if to.Before(from) {
+		return fail(c, http.StatusBadRequest, "from must not be after to")
+	}
+	days := int(to.Sub(from)/(24*time.Hour)) + 1
+	if days > maxStatsDays {
+		return fail(c, http.StatusBadRequest, "at most "+strconv.Itoa(maxStatsDays)+" days can be exported at once")
+	}
+	top := defaultStatsTop
+	if value := c.QueryParam("top"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fail(c, http.StatusBadRequest, "top must be a non-negative integer")
+		}
+		top = n
+	}
+
+	export := statsExport{From: from.Format(statsDateLayout), To: to.Format(statsDateLayout), Days: make([]dayStats, days)}
+	served := make([][]FileMeta, days)
+	for i := range export.Days {
+		export.Days[i] = dayStats{Date: from.AddDate(0, 0, i).Format(statsDateLayout), TopFiles: []fileUsage{}}
+	}
+	for _, meta := range s.index.all() {
+		created := meta.CreatedAt.UTC()
+		if created.Before(from) || !created.Before(to.AddDate(0, 0, 1)) {
+			continue
+		}
+		i := int(created.Sub(from) / (24 * time.Hour))
+		day := &export.Days[i]
+		day.Uploads++
+		day.BytesIn += meta.Size
+		day.Downloads += meta.Downloads
+		day.BytesOut += meta.BytesServed
+		if meta.BytesServed > 0 && meta.listed() {
+			served[i] = append(served[i], meta)
+		}
+	}
+	for i, files := range served {
+		sort.SliceStable(files, func(a, b int) bool { return files[a].BytesServed > files[b].BytesServed })
+		for _, meta := range files[:min(top, len(files))] {
+			export.Days[i].TopFiles = append(export.Days[i].TopFiles, fileUsage{
+				URL:         s.downloadURL(c, meta.Dir, meta.Name),
+				Dir:         meta.Dir,
+				Name:        meta.Name,
+				Downloads:   meta.Downloads,
+				BytesServed: meta.BytesServed,
+			})
+		}
+	}
+
+	if format != "csv" {
+		return c.JSON(http.StatusOK, export)
+	}
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	header.Set(echo.HeaderContentDisposition, `attachment; filename="stats-`+export.From+`-`+export.To+`.csv"`)
+	c.Response().WriteHeader(http.StatusOK)
+	w := csv.NewWriter(c.Response())
+	w.Write([]string{"date", "uploads", "bytes_in", "downloads", "bytes_out", "top_files"})
+	for _, day := range export.Days {
+		names := make([]string, len(day.TopFiles))
+		for i, file := range day.TopFiles {
+			names[i] = metaKey(file.Dir, file.Name)
+		}
+		w.Write([]string{
+			day.Date,
+			strconv.Itoa(day.Uploads),
+			strconv.FormatInt(day.BytesIn, 10),
+			strconv.FormatInt(day.Downloads, 10),
+			strconv.FormatInt(day.BytesOut, 10),
+			strings.Join(names, ";"),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,79 @@
+package simpleserver
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsExportGroupsByDay(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken})
+	for name, size := range map[string]int{"old.txt": 10, "a.txt": 100, "b.txt": 1000} {
+		rec := serve(s, httptest.NewRequest(http.MethodPut, "/"+name, strings.NewReader(strings.Repeat("x", size))))
+		require.Equal(t, http.StatusCreated, rec.Code)
+		require.Equal(t, http.StatusOK, download(t, s, downloadURLs(t, rec.Body.String())[0]).Code)
+	}
+	old := findMeta(t, s, "old.txt")
+	old.CreatedAt = old.CreatedAt.AddDate(0, 0, -2)
+	require.NoError(t, s.index.put(old))
+	today := time.Now().UTC().Format(statsDateLayout)
+	twoDaysAgo := time.Now().UTC().AddDate(0, 0, -2).Format(statsDateLayout)
+
+	rec := serve(s, adminRequest(http.MethodGet, "/admin/stats/export?from="+twoDaysAgo+"&to="+today+"&top=1", ""))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var export statsExport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &export))
+	require.Len(t, export.Days, 3)
+	require.Len(t, export.Days[0].TopFiles, 1)
+	require.True(t, strings.HasSuffix(export.Days[0].TopFiles[0].URL, "/"+old.key()))
+	require.Equal(t, dayStats{Date: twoDaysAgo, Uploads: 1, BytesIn: 10, Downloads: 1, BytesOut: 10, TopFiles: []fileUsage{{
+		URL: export.Days[0].TopFiles[0].URL, Dir: old.Dir, Name: old.Name, Downloads: 1, BytesServed: 10,
+	}}}, export.Days[0])
+	require.Zero(t, export.Days[1].Uploads)
+	require.Empty(t, export.Days[1].TopFiles)
+	require.Equal(t, 2, export.Days[2].Uploads)
+	require.Equal(t, int64(1100), export.Days[2].BytesIn)
+	require.Equal(t, int64(1100), export.Days[2].BytesOut)
+	require.Len(t, export.Days[2].TopFiles, 1)
+	require.Equal(t, "b.txt", export.Days[2].TopFiles[0].Name)
+
+	rec = serve(s, adminRequest(http.MethodGet, "/admin/stats/export?format=csv&from="+today+"&to="+today, ""))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "text/csv; charset=utf-8", rec.Header().Get("Content-Type"))
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	require.NoError(t, err)
+	b := findMeta(t, s, "b.txt")
+	a := findMeta(t, s, "a.txt")
+	require.Equal(t, [][]string{
+		{"date", "uploads", "bytes_in", "downloads", "bytes_out", "top_files"},
+		{today, "2", "1100", "2", "1100", b.key() + ";" + a.key()},
+	}, rows)
+}
+
+func TestStatsExportValidation(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken})
+	require.Equal(t, http.StatusUnauthorized, serve(s, httptest.NewRequest(http.MethodGet, "/admin/stats/export", nil)).Code)
+	for _, query := range []string{
+		"format=xml",
+		"from=yesterday",
+		"from=2024-02-01&to=2024-01-01",
+		"from=2020-01-01&to=2024-01-01",
+		"top=-1",
+	} {
+		rec := serve(s, adminRequest(http.MethodGet, "/admin/stats/export?"+query, ""))
+		require.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+
+	rec := serve(s, adminRequest(http.MethodGet, "/admin/stats/export", ""))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var export statsExport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &export))
+	require.Len(t, export.Days, defaultStatsDays)
+	require.Equal(t, time.Now().UTC().Format(statsDateLayout), export.To)
+}
@@ -0,0 +1,347 @@
+package simpleserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var errAckTimeout = errors.New("storage did not confirm the upload in time")
+
+// Storage is the backend holding uploaded files. Objects are addressed by
+// "<dir>/<name>" keys, the same keys the metadata index uses.
+type Storage interface {
+	// Put stores the content of r under key, replacing any existing object.
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Get opens key for reading. It fails with fs.ErrNotExist when there is
+	// no such object.
+	Get(ctx context.Context, key string) (*Object, error)
+	// Delete removes key. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+	// List returns the objects whose key starts with prefix.
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Confirm blocks until meta is durably persisted or ctx is done.
+	// Backends that write asynchronously report completion here.
+	Confirm(ctx context.Context, meta FileMeta) error
+	// Seekable reports whether meta can be served in byte ranges. Files
+	// that are not are downloaded whole with Accept-Ranges: none.
+	Seekable(meta FileMeta) bool
+}
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Object is an open stored object. Content also implements io.Seeker when
+// the backend can read it at arbitrary offsets.
+type Object struct {
+	ObjectInfo
+	Content io.ReadCloser
+}
+
+// fileImporter is implemented by backends that can adopt a spooled upload
+// without copying it.
+type fileImporter interface {
+	PutFile(ctx context.Context, key, path string) error
+}
+
+// renamer is implemented by backends that can move an object in place.
+type renamer interface {
+	Rename(ctx context.Context, from, to string) error
+}
+
+// newStorage builds the backend selected by Config.Storage: the upload dir
+// when empty or "local", "memory", or "s3://bucket[/prefix]".
+func newStorage(config Config, uploadDir string) (Storage, error) {
+	switch {
+	case config.Storage == "" || config.Storage == "local":
+		return localStorage{root: filepath.Clean(uploadDir)}, nil
+	case config.Storage == "memory":
+		return newMemoryStorage(), nil
+	case strings.HasPrefix(config.Storage, "s3://"):
+		u, err := url.Parse(config.Storage)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid storage %q, expected s3://bucket[/prefix]", config.Storage)
+		}
+		return newS3Storage(u.Host, strings.Trim(u.Path, "/"), config.S3Endpoint, config.S3Region)
+	}
+	return nil, fmt.Errorf("unknown storage %q", config.Storage)
+}
+
+// putObject moves the spooled upload at spool into the backend under key.
+func (s *Server) putObject(ctx context.Context, key, spool string) error {
+	defer recordStorageLatency(ctx, time.Now())
+	if importer, ok := s.storage.(fileImporter); ok {
+		return importer.PutFile(ctx, key, spool)
+	}
+	file, err := os.Open(spool)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return s.storage.Put(ctx, key, file)
+}
+
+// renameObject moves an object, copying it when the backend cannot rename.
+func (s *Server) renameObject(ctx context.Context, from, to string) error {
+	if r, ok := s.storage.(renamer); ok {
+		return r.Rename(ctx, from, to)
+	}
+	obj, err := s.storage.Get(ctx, from)
+	if err != nil {
+		return err
+	}
+	err = s.storage.Put(ctx, to, obj.Content)
+	obj.Content.Close()
+	if err != nil {
+		return err
+	}
+	return s.storage.Delete(ctx, from)
+}
+
+// objectExists reports whether key is stored.
+func (s *Server) objectExists(ctx context.Context, key string) (bool, error) {
+	obj, err := s.storage.Get(ctx, key)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	obj.Content.Close()
+	return true, nil
+}
+
+// localStorage keeps uploads as <root>/<dir>/<name>. Dot prefixed entries
+// of root hold server state and are never listed.
+type localStorage struct {
+	root string
+}
+
+func (l localStorage) path(key string) string {
+	return filepath.Join(l.root, filepath.FromSlash(key))
+}
+
+// Put writes r to a hidden temporary file first, so a failed write never
+// leaves a truncated object or an empty directory behind.
+func (l localStorage) Put(ctx context.Context, key string, r io.Reader) error {
+	dst := l.path(key)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(dst), "."+base58(12)+partSuffix)
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = copyBuffer(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		l.prune(filepath.Dir(dst))
+	}
+	return err
+}
+
+func (l localStorage) PutFile(ctx context.Context, key, spool string) error {
+	dst := l.path(key)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := moveFile(spool, dst); err != nil {
+		l.prune(filepath.Dir(dst))
+		return err
+	}
+	return nil
+}
+
+// moveFile renames src to dst, falling back to copy and delete when they
+// live on different devices. The copy goes to a hidden file next to dst, so
+// dst only ever appears complete.
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := filepath.Join(filepath.Dir(dst), "."+base58(12)+partSuffix)
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := copyBuffer(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// resolve follows any symlinks in the path of key, failing with
+// fs.ErrNotExist when they lead outside root.
+func (l localStorage) resolve(key string) (string, error) {
+	root, err := filepath.EvalSymlinks(l.root)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(l.path(key))
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+		return "", fs.ErrNotExist
+	}
+	return resolved, nil
+}
+
+func (l localStorage) Get(ctx context.Context, key string) (*Object, error) {
+	resolved, err := l.resolve(key)
+	var file *os.File
+	if err == nil {
+		file, err = os.Open(resolved)
+	}
+	if errors.Is(err, syscall.ENOTDIR) {
+		// A parent of key is a file, so key cannot exist either.
+		err = fs.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err == nil && info.IsDir() {
+		err = fs.ErrNotExist
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &Object{
+		ObjectInfo: ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()},
+		Content:    file,
+	}, nil
+}
+
+// Delete removes key and prunes the directories it leaves empty.
+func (l localStorage) Delete(ctx context.Context, key string) error {
+	p := l.path(key)
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	l.prune(filepath.Dir(p))
+	return nil
+}
+
+func (l localStorage) prune(dir string) {
+	for ; dir != l.root && strings.HasPrefix(dir, l.root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+}
+
+func (l localStorage) Rename(ctx context.Context, from, to string) error {
+	dst := l.path(to)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := moveFile(l.path(from), dst); err != nil {
+		return err
+	}
+	l.prune(filepath.Dir(l.path(from)))
+	return nil
+}
+
+func (l localStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := filepath.WalkDir(l.root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == l.root {
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(l.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) || path.Dir(key) == "." {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return objects, err
+}
+
+// Confirm has nothing to wait for: a file is durable once it is renamed into
+// place.
+func (localStorage) Confirm(context.Context, FileMeta) error {
+	return nil
+}
+
+// Seekable is false for files compressed or encrypted at rest, whose stored
+// bytes do not line up with the ranges a client asks for.
+func (localStorage) Seekable(meta FileMeta) bool {
+	return meta.storedVerbatim()
+}
+
+// confirmUpload waits up to AckTimeout for the backend to confirm meta.
+// Without an AckTimeout the upload is acknowledged as soon as it is written.
+func (s *Server) confirmUpload(ctx context.Context, meta FileMeta) error {
+	if s.config.AckTimeout <= 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.config.AckTimeout)
+	defer cancel()
+	err := s.storage.Confirm(ctx, meta)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errAckTimeout
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+package simpleserver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryStorage keeps every object in memory. It is meant for tests and
+// throwaway instances; everything is lost when the process exits.
+type memoryStorage struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{objects: make(map[string]memoryObject)}
+}
+
+func (m *memoryStorage) Put(ctx context.Context, key string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.objects[key] = memoryObject{data: data, modTime: time.Now()}
+	m.mu.Unlock()
+	return nil
+}
+
+// bytesObject is a seekable object body.
+type bytesObject struct {
+	*bytes.Reader
+}
+
+func (bytesObject) Close() error {
+	return nil
+}
+
+func (m *memoryStorage) Get(ctx context.Context, key string) (*Object, error) {
+	m.mu.RLock()
+	obj, ok := m.objects[key]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return &Object{
+		ObjectInfo: ObjectInfo{Key: key, Size: int64(len(obj.data)), ModTime: obj.modTime},
+		Content:    bytesObject{bytes.NewReader(obj.data)},
+	}, nil
+}
+
+func (m *memoryStorage) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	delete(m.objects, key)
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *memoryStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var objects []ObjectInfo
+	for key, obj := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, ObjectInfo{Key: key, Size: int64(len(obj.data)), ModTime: obj.modTime})
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (m *memoryStorage) Confirm(context.Context, FileMeta) error {
+	return nil
+}
+
+func (m *memoryStorage) Seekable(meta FileMeta) bool {
+	return meta.storedVerbatim()
+}
@@ -0,0 +1,155 @@
+package simpleserver
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// slowStorage confirms every upload after a fixed delay.
+type slowStorage struct {
+	Storage
+	delay time.Duration
+}
+
+func (s slowStorage) Confirm(ctx context.Context, meta FileMeta) error {
+	select {
+	case <-time.After(s.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestAckTimeout(t *testing.T) {
+	for name, tc := range map[string]struct {
+		delay  time.Duration
+		status int
+	}{
+		"confirmed": {delay: 10 * time.Millisecond, status: http.StatusCreated},
+		"timed out": {delay: time.Second, status: http.StatusGatewayTimeout},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(t, Config{AckTimeout: 100 * time.Millisecond})
+			s.storage = slowStorage{Storage: s.storage, delay: tc.delay}
+			rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("notes")))
+			require.Equal(t, tc.status, rec.Code)
+			if tc.status == http.StatusGatewayTimeout {
+				require.Empty(t, shareDirs(t, s))
+				require.Zero(t, s.index.len())
+			}
+		})
+	}
+}
+
+func TestNoAckTimeoutSkipsConfirm(t *testing.T) {
+	s := newTestServer(t, Config{})
+	s.storage = slowStorage{Storage: s.storage, delay: time.Hour}
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("notes")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+}
+
+func TestStorageBackends(t *testing.T) {
+	for _, storage := range []string{"", "memory"} {
+		t.Run("storage="+storage, func(t *testing.T) {
+			s := newTestServer(t, Config{Storage: storage, AdminToken: testAdminToken})
+			rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("0123456789")))
+			require.Equal(t, http.StatusCreated, rec.Code)
+			dir := findMeta(t, s, "notes.txt").Dir
+
+			rec = download(t, s, downloadURLs(t, rec.Body.String())[0])
+			require.Equal(t, http.StatusOK, rec.Code)
+			require.Equal(t, "0123456789", rec.Body.String())
+			rec = serve(s, rangeRequest("/"+dir+"/notes.txt", "bytes=2-4"))
+			require.Equal(t, http.StatusPartialContent, rec.Code)
+			require.Equal(t, "234", rec.Body.String())
+
+			objects, err := s.storage.List(context.Background(), dir+"/")
+			require.NoError(t, err)
+			require.Len(t, objects, 1)
+			require.Equal(t, dir+"/notes.txt", objects[0].Key)
+			require.Equal(t, int64(10), objects[0].Size)
+
+			rec = serve(s, moveRequestTo("/"+dir+"/notes.txt/move", `{"dir": "moved"}`))
+			require.Equal(t, http.StatusOK, rec.Code)
+			rec = serve(s, httptest.NewRequest(http.MethodGet, "/moved/notes.txt", nil))
+			require.Equal(t, "0123456789", rec.Body.String())
+			rec = serve(s, httptest.NewRequest(http.MethodGet, "/"+dir+"/notes.txt", nil))
+			require.Equal(t, http.StatusNotFound, rec.Code)
+
+			require.NoError(t, s.deleteFile(findMeta(t, s, "notes.txt")))
+			objects, err = s.storage.List(context.Background(), "")
+			require.NoError(t, err)
+			require.Empty(t, objects)
+		})
+	}
+}
+
+func TestUnknownStorage(t *testing.T) {
+	s := New(Config{UploadDir: t.TempDir(), Storage: "ftp://example.com"})
+	require.ErrorContains(t, s.startup(), "unknown storage")
+	s = New(Config{UploadDir: t.TempDir(), Storage: "s3://"})
+	require.ErrorContains(t, s.startup(), "invalid storage")
+}
+
+// brokenReader returns some content, then fails as a dropped connection does.
+type brokenReader struct {
+	content io.Reader
+}
+
+func (r brokenReader) Read(p []byte) (int, error) {
+	n, err := r.content.Read(p)
+	if err == io.EOF {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func TestInterruptedUploadLeavesNothingBehind(t *testing.T) {
+	s := newTestServer(t, Config{})
+	req := httptest.NewRequest(http.MethodPut, "/partial.txt", brokenReader{strings.NewReader(strings.Repeat("half of the file ", 100))})
+	req.ContentLength = -1
+	rec := serve(s, req)
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	require.Empty(t, shareDirs(t, s))
+	entries, err := os.ReadDir(filepath.Join(s.getUploadDir(), spoolDirName))
+	require.NoError(t, err)
+	require.Empty(t, entries)
+	require.Zero(t, s.index.len())
+}
+
+func TestLocalPutRemovesEmptyDirOnFailure(t *testing.T) {
+	root := t.TempDir()
+	storage := localStorage{root: root}
+	err := storage.Put(context.Background(), "Ab3dEf/partial.txt", brokenReader{strings.NewReader("half")})
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	_, err = os.Stat(filepath.Join(root, "Ab3dEf"))
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestDownloadRefusesSymlinksOutOfUploadDir(t *testing.T) {
+	s := newTestServer(t, Config{})
+	secret := filepath.Join(t.TempDir(), "secret.txt")
+	require.NoError(t, os.WriteFile(secret, []byte("secret"), 0600))
+	dir := filepath.Join(s.getUploadDir(), "Ab3dEf")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.Symlink(secret, filepath.Join(dir, "leak.txt")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "real.txt"), []byte("real"), 0644))
+	require.NoError(t, os.Symlink("real.txt", filepath.Join(dir, "alias.txt")))
+
+	rec := serve(s, httptest.NewRequest(http.MethodGet, "/Ab3dEf/leak.txt", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	rec = serve(s, httptest.NewRequest(http.MethodGet, "/Ab3dEf/alias.txt", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "real", rec.Body.String())
+}
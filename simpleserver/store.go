@@ -0,0 +1,449 @@
+package simpleserver
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const partSuffix = ".part"
+
+// spoolDirName holds uploads while they are being received.
+const spoolDirName = ".spool"
+
+var (
+	errNotDurable     = errors.New("upload could not be synced to disk")
+	errTooLarge       = errors.New("upload exceeds the maximum size")
+	errTypeNotAllowed = errors.New("content type is not allowed")
+)
+
+// uploadFile is the subset of *os.File used while writing an upload.
+type uploadFile interface {
+	io.Writer
+	Sync() error
+	Close() error
+}
+
+func createUploadFile(path string) (uploadFile, error) {
+	return os.Create(path)
+}
+
+// uploadOptions carries the per request settings applied by storeFile.
+type uploadOptions struct {
+	Bucket string
+	// MaxBytes caps the upload size when positive.
+	MaxBytes     int64
+	AllowedTypes []string
+	TTL          time.Duration
+	// Once deletes the upload after its first complete download.
+	Once bool
+	// MaxDownloads limits how many times the upload can be downloaded.
+	MaxDownloads int64
+	// Password protects downloads of the upload when set.
+	Password string
+	// SHA256 is the checksum the client expects the upload to have.
+	SHA256 string
+	// Trailer holds the trailers of a chunked upload that announced a
+	// Content-SHA256 trailer. They are only filled in once the body is read.
+	Trailer http.Header
+	// Paste stores the upload as a paste.
+	Paste bool
+	// DeleteToken lets whoever holds it delete the upload.
+	DeleteToken string
+	// Visibility and AllowedEmails restrict who sees the upload, see
+	// requestVisibility.
+	Visibility    string
+	AllowedEmails []string
+	// Description and Tags are stored with the upload.
+	Description string
+	Tags        map[string]string
+}
+
+// sizeLimitError is an errTooLarge telling how far an upload went over its
+// limit. Streamed uploads are aborted as soon as they cross it, so for them
+// only a lower bound of the excess is known.
+type sizeLimitError struct {
+	limit   int64
+	over    int64
+	atLeast bool
+}
+
+func (e *sizeLimitError) Error() string {
+	if e.atLeast {
+		return fmt.Sprintf("%v of %d bytes by at least %d bytes", errTooLarge, e.limit, e.over)
+	}
+	return fmt.Sprintf("%v of %d bytes by %d bytes", errTooLarge, e.limit, e.over)
+}
+
+func (e *sizeLimitError) Unwrap() error {
+	return errTooLarge
+}
+
+// maxBytesReader fails with errTooLarge once more than n bytes are read.
+type maxBytesReader struct {
+	r    io.Reader
+	n    int64
+	read int64
+}
+
+func (m *maxBytesReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > m.n+1 {
+		p = p[:m.n+1]
+	}
+	n, err := m.r.Read(p)
+	if int64(n) > m.n {
+		return 0, &sizeLimitError{limit: m.read + m.n, over: int64(n) - m.n, atLeast: true}
+	}
+	m.n -= int64(n)
+	m.read += int64(n)
+	return n, err
+}
+
+// storeFile stores r as <dir>/<name> in the storage backend, where the final
+// name follows the configured NameStrategy, recording an upload span.
+func (s *Server) storeFile(ctx context.Context, dir, name string, r io.Reader, opts uploadOptions) (FileMeta, error) {
+	ctx, span := s.tracer.Start(ctx, "upload")
+	meta, err := s.spoolFile(ctx, dir, name, r, opts)
+	if err == nil {
+		span.SetAttributes(fileAttributes(meta)...)
+	}
+	endSpan(span, err)
+	return meta, err
+}
+
+// spoolFile does the work of storeFile. The content is spooled to a
+// temporary .part file and only handed to the backend once it is complete, so
+// a failed upload never leaves a truncated file behind.
+func (s *Server) spoolFile(ctx context.Context, dir, name string, r io.Reader, opts uploadOptions) (FileMeta, error) {
+	meta := FileMeta{Dir: dir, Name: name, Bucket: opts.Bucket, Once: opts.Once, MaxDownloads: opts.MaxDownloads, Paste: opts.Paste,
+		Visibility: opts.Visibility, AllowedEmails: opts.AllowedEmails, Description: opts.Description, Tags: opts.Tags}
+	if opts.Password != "" {
+		hash, err := hashPassword(opts.Password)
+		if err != nil {
+			return FileMeta{}, err
+		}
+		meta.PasswordHash = hash
+	}
+	if opts.DeleteToken != "" {
+		meta.DeleteTokenHash = hashDeleteToken(opts.DeleteToken)
+	}
+	if opts.MaxBytes > 0 {
+		r = &maxBytesReader{r: r, n: opts.MaxBytes}
+	}
+	br := bufio.NewReaderSize(r, sniffLen)
+	head, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		return FileMeta{}, err
+	}
+	if err := s.checkFileType(name, head); err != nil {
+		return FileMeta{}, err
+	}
+	meta.ContentType = detectContentType(name, head)
+	if len(opts.AllowedTypes) > 0 && !matchContentType(opts.AllowedTypes, meta.ContentType) {
+		return FileMeta{}, errTypeNotAllowed
+	}
+	if s.config.CompressAtRest && s.compressible(meta.ContentType) {
+		meta.Encoding = encodingGzip
+	}
+
+	// The final name may depend on the content, so spool the upload first
+	// and only hand it to the storage backend once it is complete.
+	spoolDir := filepath.Join(s.getUploadDir(), spoolDirName)
+	if err := os.MkdirAll(spoolDir, 0755); err != nil {
+		return FileMeta{}, err
+	}
+	tmp := filepath.Join(spoolDir, base58(12)+partSuffix)
+	defer os.Remove(tmp)
+	file, err := s.createFile(tmp)
+	if err != nil {
+		return FileMeta{}, err
+	}
+	var w io.Writer = file
+	var encrypter io.WriteCloser
+	if s.cipher != nil {
+		if encrypter, err = s.cipher.encrypter(file); err != nil {
+			file.Close()
+			return FileMeta{}, err
+		}
+		w = encrypter
+		meta.Encryption, meta.KeyID = encryptionAESGCM, s.cipher.keyID
+	}
+	hash := sha256.New()
+	src := io.TeeReader(br, hash)
+	var scan *scanJob
+	if s.scanner != nil {
+		scan = s.startScan(ctx)
+		src = io.TeeReader(src, scan)
+	}
+	var variants *variantWriter
+	if s.precompressible(meta) {
+		if variants, err = s.newVariantWriter(); err != nil {
+			log.Printf("Failed to compress %s/%s ahead of downloads: %v\n", dir, name, err)
+		} else {
+			defer variants.discard()
+			src = io.TeeReader(src, variants)
+		}
+	}
+	meta.Size, err = copyEncoded(w, src, meta.Encoding)
+	if scan != nil {
+		signature, scanErr := scan.finish(err)
+		switch {
+		case scanErr != nil && (err == nil || errors.Is(err, errScanFailed)):
+			err = scanErr
+		case err == nil && signature != "":
+			log.Printf("Rejected upload %s/%s, infected with %s\n", dir, name, signature)
+			err = fmt.Errorf("%w with %s", errInfected, signature)
+		}
+	}
+	if err == nil && encrypter != nil {
+		err = encrypter.Close()
+	}
+	if err == nil && s.config.Fsync {
+		if syncErr := file.Sync(); syncErr != nil {
+			err = errNotDurable
+		}
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return FileMeta{}, err
+	}
+	meta.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	if opts.SHA256 != "" && opts.SHA256 != meta.SHA256 {
+		return FileMeta{}, errChecksumMismatch
+	}
+	if sum, err := trailerChecksum(opts.Trailer); err != nil {
+		return FileMeta{}, err
+	} else if sum != "" && sum != meta.SHA256 {
+		return FileMeta{}, errChecksumMismatch
+	}
+	meta.Name = s.storageName(name, meta.SHA256)
+	if meta.Name != name {
+		meta.OriginalName = path.Base(name)
+	}
+	if err := s.checkHooks(ctx, beforeUpload, meta); err != nil {
+		return FileMeta{}, err
+	}
+	if !meta.storedVerbatim() {
+		if info, err := os.Stat(tmp); err == nil {
+			meta.StoredSize = info.Size()
+		}
+	}
+	// A duplicate takes no extra space, so it bypasses the quota.
+	if !s.dedupeEnabled() || !s.linkDuplicate(ctx, &meta) {
+		release, err := s.reserveQuota(meta.storedBytes())
+		if err != nil {
+			return FileMeta{}, err
+		}
+		defer release()
+		releaseUser, err := s.reserveUserQuota(dir, meta.storedBytes())
+		if err != nil {
+			return FileMeta{}, err
+		}
+		defer releaseUser()
+		if err := s.putObject(ctx, meta.key(), tmp); err != nil {
+			return FileMeta{}, err
+		}
+		if s.dedupeEnabled() {
+			meta.Blob = base58(12)
+		}
+	}
+
+	meta.CreatedAt = time.Now().UTC()
+	if opts.TTL > 0 {
+		meta.ExpiresAt = meta.CreatedAt.Add(opts.TTL)
+	}
+	meta.Pending = s.processingEnabled()
+	if s.config.ShortLinks {
+		meta.Alias = s.index.nextAlias(meta.key())
+	}
+	if err := s.index.put(meta); err != nil {
+		s.storage.Delete(ctx, meta.key())
+		return FileMeta{}, err
+	}
+	s.replicator.copy(meta.key())
+	s.runHooks(ctx, afterUpload, meta)
+	if variants != nil {
+		if err := variants.commit(meta.SHA256, meta.Size); err != nil {
+			log.Printf("Failed to compress %s ahead of downloads: %v\n", meta.key(), err)
+		}
+	}
+	if meta.Pending {
+		s.enqueueProcessing(meta)
+	}
+	return meta, nil
+}
+
+// saveUpload stores a single file, charging it to the upload token presented
+// with the request.
+func (s *Server) saveUpload(c echo.Context, dir, name string, r io.Reader) (FileMeta, error) {
+	opts, err := s.uploadOptions(c)
+	if err != nil {
+		return FileMeta{}, err
+	}
+	return s.saveUploadWith(c, dir, name, r, opts)
+}
+
+// saveUploadWith is saveUpload with the upload options already settled.
+func (s *Server) saveUploadWith(c echo.Context, dir, name string, r io.Reader, opts uploadOptions) (FileMeta, error) {
+	grant, err := s.reserveUpload(c)
+	if err != nil {
+		return FileMeta{}, err
+	}
+	opts.DeleteToken = base58(20)
+	meta, err := s.storeFile(c.Request().Context(), dir, name, grant.reader(r), opts)
+	if err == nil {
+		if err = s.confirmUpload(c.Request().Context(), meta); err != nil {
+			s.removeFile(meta)
+		}
+	}
+	if finishErr := grant.finish(err == nil); err == nil {
+		err = finishErr
+	}
+	if err == nil {
+		noteFile(c, meta)
+		rememberDeleteToken(c, meta, opts.DeleteToken)
+		s.publishEvent(Event{
+			Type:     EventUpload,
+			Dir:      meta.Dir,
+			Filename: meta.Name,
+			Size:     meta.Size,
+			SHA256:   meta.SHA256,
+			ClientIP: c.RealIP(),
+			Identity: requestIdentity(c),
+		})
+	}
+	return meta, err
+}
+
+// removeFile deletes a stored upload together with its metadata.
+func (s *Server) removeFile(meta FileMeta) error {
+	if err := s.storage.Delete(context.Background(), meta.key()); err != nil {
+		return err
+	}
+	if err := s.index.delete(meta.Dir, meta.Name); err != nil {
+		return err
+	}
+	s.replicator.remove(meta.key())
+	s.cache.remove(meta.key())
+	s.dropVariants(meta)
+	return nil
+}
+
+// deleteFile removes an upload that was already acknowledged to the client
+// and announces the deletion.
+func (s *Server) deleteFile(meta FileMeta) error {
+	if err := s.removeFile(meta); err != nil {
+		return err
+	}
+	s.publishEvent(Event{Type: EventDelete, Dir: meta.Dir, Filename: meta.Name, Size: meta.Size})
+	return nil
+}
+
+// deleteFileFor removes an upload on behalf of the client of c, keeping it
+// in the trash when enabled.
+func (s *Server) deleteFileFor(c echo.Context, meta FileMeta) error {
+	ctx := c.Request().Context()
+	if err := s.checkHooks(ctx, beforeDelete, meta); err != nil {
+		return err
+	}
+	if err := s.disposeFile(meta); err != nil {
+		return err
+	}
+	s.runHooks(ctx, afterDelete, meta)
+	s.publishEvent(Event{Type: EventDelete, Dir: meta.Dir, Filename: meta.Name, Size: meta.Size, ClientIP: c.RealIP(), Identity: requestIdentity(c)})
+	return nil
+}
+
+// expireFile removes an upload whose TTL ran out and announces the expiry.
+// It is kept in the trash when enabled.
+func (s *Server) expireFile(meta FileMeta) error {
+	if err := s.disposeFile(meta); err != nil {
+		return err
+	}
+	s.publishEvent(Event{Type: EventExpire, Dir: meta.Dir, Filename: meta.Name, Size: meta.Size})
+	return nil
+}
+
+// disposeFile moves an upload to the trash, or removes it when there is
+// none.
+func (s *Server) disposeFile(meta FileMeta) error {
+	if s.trashEnabled() {
+		return s.trashFile(meta)
+	}
+	return s.removeFile(meta)
+}
+
+// uploadErrorStatus maps an error returned by saveUpload to a status code.
+func uploadErrorStatus(err error) int {
+	if status, ok := tokenErrorStatus(err); ok {
+		return status
+	}
+	if status, ok := bucketErrorStatus(err); ok {
+		return status
+	}
+	switch {
+	case errors.Is(err, errUnsafePath), errors.Is(err, errNoSafeFilename), errors.Is(err, errMalformedPart), errors.Is(err, errUnsupportedType),
+		errors.Is(err, errInvalidChecksum), errors.Is(err, errChecksumMismatch), errors.Is(err, errInvalidSlug), errors.Is(err, errInvalidMaxDownloads),
+		errors.Is(err, errInvalidVisibility), errors.Is(err, errNoAllowedEmails), errors.Is(err, errNoIdentities),
+		errors.Is(err, errInvalidNotify), errors.Is(err, errNotifyDisabled),
+		errors.Is(err, errUnknownSyntax), errors.Is(err, errInvalidTTL), errors.Is(err, errInvalidFetchURL),
+		errors.Is(err, errInvalidBatch), errors.Is(err, errInvalidContentRange), errors.Is(err, errInvalidDelta), errors.Is(err, errInvalidTags):
+		return http.StatusBadRequest
+	case errors.Is(err, errTooLarge), errors.Is(err, errTooManyEntries):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, errTypeNotAllowed), errors.Is(err, errExtensionNotAllowed):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, errFetchBlocked), errors.Is(err, errOverwriteForbidden), errors.Is(err, errRejected):
+		return http.StatusForbidden
+	case errors.Is(err, errPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, errDeltaNeedsTag):
+		return http.StatusPreconditionRequired
+	case errors.Is(err, errSlugTaken):
+		return http.StatusConflict
+	case errors.Is(err, errUploadStalled), errors.Is(err, errUploadTooSlow):
+		return http.StatusRequestTimeout
+	case errors.Is(err, errAckTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, errQuotaExceeded), errors.Is(err, errUserQuotaExceeded):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, errInfected):
+		return http.StatusUnprocessableEntity
+	case errors.As(err, new(*contentMismatchError)):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, errScanFailed):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// uploadErrorMessage tells clients about an error returned by saveUpload.
+// Those of the server only get a summary, their details may name its paths.
+func uploadErrorMessage(err error) string {
+	switch {
+	case uploadErrorStatus(err) != http.StatusInternalServerError:
+		return err.Error()
+	case errors.Is(err, errNotDurable):
+		return "Failed to persist file to disk"
+	}
+	return "Failed to save file"
+}
+
+// uploadError renders an error returned by saveUpload.
+func (s *Server) uploadError(c echo.Context, err error) error {
+	return failWith(c, uploadErrorStatus(err), uploadErrorCode(err), uploadErrorMessage(err))
+}
@@ -0,0 +1,124 @@
+package simpleserver
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// failingSyncFile writes to a real file but reports every Sync as failed.
+type failingSyncFile struct {
+	*os.File
+	syncCalls int
+}
+
+func (f *failingSyncFile) Sync() error {
+	f.syncCalls++
+	return errors.New("injected sync failure")
+}
+
+func TestFsyncFailureReturnsServerErrorAndCleansUp(t *testing.T) {
+	s := newTestServer(t, Config{Fsync: true})
+	var created []*failingSyncFile
+	s.createFile = func(path string) (uploadFile, error) {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		file := &failingSyncFile{File: f}
+		created = append(created, file)
+		return file, nil
+	}
+
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/durable.txt", strings.NewReader("must be durable")))
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	require.Len(t, created, 1)
+	require.Equal(t, 1, created[0].syncCalls)
+
+	for _, dir := range shareDirs(t, s) {
+		entries, err := os.ReadDir(filepath.Join(s.config.UploadDir, dir))
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	}
+	require.Zero(t, s.index.len())
+}
+
+func TestSyncSkippedWithoutFsync(t *testing.T) {
+	s := newTestServer(t, Config{})
+	s.createFile = func(path string) (uploadFile, error) {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		return &failingSyncFile{File: f}, nil
+	}
+
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/fast.txt", strings.NewReader("fast")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	rec = download(t, s, downloadURLs(t, rec.Body.String())[0])
+	require.Equal(t, "fast", rec.Body.String())
+}
+
+func TestOversizedUploadIsRejectedWhileStreaming(t *testing.T) {
+	s := newTestServer(t, Config{MaxSize: 1})
+	oversized := strings.Repeat("x", 1<<20+100)
+
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/big.txt", strings.NewReader(oversized)))
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	require.Contains(t, rec.Body.String(), "by 100 bytes")
+
+	// Without a Content-Length the upload is only caught while copying.
+	req := httptest.NewRequest(http.MethodPut, "/big.txt", io.MultiReader(strings.NewReader(oversized)))
+	req.ContentLength = -1
+	rec = serve(s, req)
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	require.Contains(t, rec.Body.String(), "by at least 1 bytes")
+
+	entries, err := os.ReadDir(filepath.Join(s.getUploadDir(), spoolDirName))
+	require.NoError(t, err)
+	require.Empty(t, entries)
+	require.Zero(t, s.index.len())
+}
+
+// BenchmarkUpload uploads files through the whole middleware chain from
+// parallel clients, so contention in the store and the index shows.
+func BenchmarkUpload(b *testing.B) {
+	for _, size := range []int{1 << 10, 1 << 20} {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			s := newTestServer(b, Config{})
+			srv := httptest.NewServer(s.newRouter())
+			defer srv.Close()
+			content := bytes.Repeat([]byte("x"), size)
+			var n atomic.Int64
+			b.SetBytes(int64(size))
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					req, err := http.NewRequest(http.MethodPut, srv.URL+"/bench-"+strconv.FormatInt(n.Add(1), 10)+".bin", bytes.NewReader(content))
+					if err != nil {
+						b.Fatal(err)
+					}
+					res, err := http.DefaultClient.Do(req)
+					if err != nil {
+						b.Fatal(err)
+					}
+					io.Copy(io.Discard, res.Body)
+					res.Body.Close()
+					if res.StatusCode != http.StatusCreated {
+						b.Fatalf("upload failed with status %d", res.StatusCode)
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// metaHeaderPrefix starts the headers tagging an upload, as in
+	// X-Meta-Build: nightly. X-Meta-Description sets its description.
+	metaHeaderPrefix = "X-Meta-"
+	// metaField is the multipart form field holding the tags and
+	// description, as JSON, of the file parts after it.
+	metaField = "meta"
+	// formMetaKey keeps the last metaField of a multipart upload in the echo
+	// context.
+	formMetaKey = "simpleserver.form_meta"
+
+	// maxFormMetaSize bounds the metaField read into memory.
+	maxFormMetaSize = 64 << 10
+
+	maxTags              = 32
+	maxTagKeyLength      = 64
+	maxTagValueLength    = 256
+	maxDescriptionLength = 1024
+)
+
+var errInvalidTags = fmt.Errorf("invalid tags, at most %d keys of letters, digits, '-', '_' and '.' up to %d bytes with values up to %d bytes, and a description up to %d bytes",
+	maxTags, maxTagKeyLength, maxTagValueLength, maxDescriptionLength)
+
+// uploadMeta is what a client tells about an upload, in metaField or the
+// X-Meta-* headers.
+type uploadMeta struct {
+	Description string            `json:"description,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+func validTagKey(key string) bool {
+	if key == "" || len(key) > maxTagKeyLength {
+		return false
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// normalize lowercases the keys, as headers have no case, and checks the
+// limits.
+func (m uploadMeta) normalize() (uploadMeta, error) {
+	m.Description = strings.TrimSpace(m.Description)
+	if len(m.Description) > maxDescriptionLength || len(m.Tags) > maxTags {
+		return uploadMeta{}, errInvalidTags
+	}
+	if len(m.Tags) == 0 {
+		m.Tags = nil
+		return m, nil
+	}
+	tags := make(map[string]string, len(m.Tags))
+	for key, value := range m.Tags {
+		key = strings.ToLower(key)
+		value = strings.TrimSpace(value)
+		if !validTagKey(key) || len(value) > maxTagValueLength {
+			return uploadMeta{}, errInvalidTags
+		}
+		tags[key] = value
+	}
+	m.Tags = tags
+	return m, nil
+}
+
+// requestMeta returns the tags and description of an upload: those of the
+// last metaField of a multipart form, overridden key by key by the X-Meta-*
+// headers.
+func requestMeta(c echo.Context) (uploadMeta, error) {
+	var meta uploadMeta
+	if form, ok := c.Get(formMetaKey).(uploadMeta); ok {
+		meta.Description = form.Description
+		meta.Tags = make(map[string]string, len(form.Tags))
+		for key, value := range form.Tags {
+			meta.Tags[key] = value
+		}
+	}
+	for name, values := range c.Request().Header {
+		key, ok := strings.CutPrefix(name, metaHeaderPrefix)
+		if !ok || len(values) == 0 {
+			continue
+		}
+		if strings.EqualFold(key, "description") {
+			meta.Description = values[0]
+			continue
+		}
+		if meta.Tags == nil {
+			meta.Tags = make(map[string]string)
+		}
+		meta.Tags[strings.ToLower(key)] = values[0]
+	}
+	return meta.normalize()
+}
+
+// readFormMeta reads a metaField part for the file parts after it.
+func readFormMeta(c echo.Context, part *multipart.Part) error {
+	var meta uploadMeta
+	body, err := io.ReadAll(io.LimitReader(part, maxFormMetaSize))
+	if err != nil {
+		return errMalformedPart
+	}
+	if err := json.Unmarshal(body, &meta); err != nil {
+		return errInvalidTags
+	}
+	if meta, err = meta.normalize(); err != nil {
+		return err
+	}
+	c.Set(formMetaKey, meta)
+	return nil
+}
+
+// hasTags reports whether meta carries every tag of filters, each key=value
+// or just a key any value matches.
+func (m FileMeta) hasTags(filters []string) bool {
+	for _, filter := range filters {
+		key, value, withValue := strings.Cut(filter, "=")
+		got, ok := m.Tags[strings.ToLower(key)]
+		if !ok || withValue && got != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package simpleserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func taggedUpload(s *Server, name, content string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/"+name, strings.NewReader(content))
+	req.Header.Set("Accept", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	return serve(s, req)
+}
+
+func adminFiles(t *testing.T, s *Server, query string) []adminFile {
+	t.Helper()
+	rec := serve(s, adminRequest(http.MethodGet, "/admin/files"+query, ""))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var response adminFilesResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	return response.Files
+}
+
+func TestUploadTags(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken})
+	rec := taggedUpload(s, "nightly.tar", "nightly", map[string]string{
+		"X-Meta-Build": "nightly", "X-Meta-Branch": "main", "X-Meta-Description": " Nightly build of main ",
+	})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var uploaded uploadResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &uploaded))
+	require.Equal(t, map[string]string{"build": "nightly", "branch": "main"}, uploaded.Tags)
+	require.Equal(t, "Nightly build of main", uploaded.Description)
+
+	rec = taggedUpload(s, "release.tar", "release", map[string]string{"X-Meta-Build": "release", "X-Meta-Branch": "main"})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	rec = taggedUpload(s, "plain.tar", "plain", nil)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	files := adminFiles(t, s, "?tag=build=nightly")
+	require.Len(t, files, 1)
+	require.Equal(t, "nightly.tar", files[0].Name)
+	require.Equal(t, "Nightly build of main", files[0].Description)
+	require.Len(t, adminFiles(t, s, "?tag=branch=main"), 2)
+	require.Len(t, adminFiles(t, s, "?tag=Branch"), 2)
+	require.Empty(t, adminFiles(t, s, "?tag=branch=main&tag=build=beta"))
+	require.Len(t, adminFiles(t, s, ""), 3)
+}
+
+func TestUploadTagsAreLimited(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := taggedUpload(s, "a.txt", "a", map[string]string{"X-Meta-Build": strings.Repeat("x", maxTagValueLength+1)})
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = taggedUpload(s, "a.txt", "a", map[string]string{"X-Meta-Description": strings.Repeat("x", maxDescriptionLength+1)})
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Empty(t, s.index.all())
+}
+
+func TestMultipartUploadTags(t *testing.T) {
+	s := newTestServer(t, Config{AuthToken: testAuthToken})
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	require.NoError(t, w.WriteField(metaField, `{"description": "Build logs", "tags": {"Build": "nightly"}}`))
+	part, err := w.CreateFormFile("file", "build.log")
+	require.NoError(t, err)
+	part.Write([]byte("ok"))
+	require.NoError(t, w.Close())
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set("X-Meta-Arch", "arm64")
+	rec := serve(s, authorized(req, testAuthToken))
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	meta := findMeta(t, s, "build.log")
+	require.Equal(t, "Build logs", meta.Description)
+	require.Equal(t, map[string]string{"build": "nightly", "arch": "arm64"}, meta.Tags)
+	rec = serve(s, authorized(jsonRequest(httptest.NewRequest(http.MethodGet, "/"+meta.Dir, nil)), testAuthToken))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"description":"Build logs","tags":{"arch":"arm64","build":"nightly"}`)
+
+	body.Reset()
+	w = multipart.NewWriter(&body)
+	require.NoError(t, w.WriteField(metaField, `{"tags": {"bad key": "x"}}`))
+	require.NoError(t, w.Close())
+	req = httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	rec = serve(s, authorized(req, testAuthToken))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
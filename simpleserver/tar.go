@@ -0,0 +1,139 @@
+package simpleserver
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	tarContentType        = "application/x-tar"
+	defaultTarMaxEntries  = 1000
+	defaultTarMaxSizeInMB = 1024
+)
+
+var (
+	errTooManyEntries  = errors.New("archive has too many entries")
+	errUnsupportedType = errors.New("archive entry is not a regular file or directory")
+)
+
+// tarGzipContentTypes are the media types gzip compressed archives are sent
+// with. Their bodies are decompressed before being read as tar.
+var tarGzipContentTypes = map[string]bool{
+	"application/gzip":             true,
+	"application/x-gzip":           true,
+	"application/x-compressed-tar": true,
+	"application/x-tgz":            true,
+}
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// isTarExtract reports whether r asks for its tar or tar.gz body to be
+// unpacked with ?extract=1 or ?extract=true. Bodies sent without a
+// Content-Type, as curl --upload-file does, are taken for archives too.
+func isTarExtract(r *http.Request) bool {
+	if extract, _ := strconv.ParseBool(r.URL.Query().Get("extract")); !extract {
+		return false
+	}
+	mediaType := strings.TrimSpace(strings.Split(r.Header.Get(echo.HeaderContentType), ";")[0])
+	return mediaType == tarContentType || tarGzipContentTypes[mediaType] || mediaType == ""
+}
+
+// tarReader reads the archive in body, gunzipping it first when it starts
+// with the gzip magic bytes.
+func tarReader(body io.Reader) (*tar.Reader, error) {
+	br := bufio.NewReader(body)
+	if head, _ := br.Peek(len(gzipMagic)); !bytes.Equal(head, gzipMagic) {
+		return tar.NewReader(br), nil
+	}
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	return tar.NewReader(gz), nil
+}
+
+// handleTarUpload unpacks a tar or tar.gz archive into a new share dir.
+// Entries keep their relative paths, which are validated like preserved
+// multipart paths. Each entry may be as large as a single upload, and the
+// archive as a whole TarMaxSize once decompressed. Any bad entry aborts the
+// whole archive.
+func (s *Server) handleTarUpload(c echo.Context) error {
+	maxEntries := s.config.TarMaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultTarMaxEntries
+	}
+	maxSize := int64(s.config.TarMaxSize)
+	if maxSize <= 0 {
+		maxSize = defaultTarMaxSizeInMB
+	}
+	remaining := maxSize * 1024 * 1024
+	maxEntrySize := int64(s.config.TarMaxEntrySize)
+	if maxEntrySize <= 0 {
+		maxEntrySize = int64(s.maxSize())
+	}
+	maxEntrySize *= 1024 * 1024
+
+	var dir = s.uploadDirFor(c)
+	var stored []FileMeta
+	abort := func(entry string, err error) error {
+		for _, meta := range stored {
+			s.deleteFile(meta)
+		}
+		if status := uploadErrorStatus(err); status >= 500 {
+			return s.uploadError(c, err)
+		}
+		return failWith(c, uploadErrorStatus(err), uploadErrorCode(err), fmt.Sprintf("Upload aborted, no file was stored. Failed entry %q: %v", entry, err))
+	}
+
+	reader, err := tarReader(c.Request().Body)
+	if err != nil {
+		return abort("", errMalformedPart)
+	}
+	for entries := 0; ; entries++ {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return abort("", errMalformedPart)
+		}
+		if entries >= maxEntries {
+			return abort(header.Name, errTooManyEntries)
+		}
+		switch header.Typeflag {
+		case tar.TypeReg:
+		case tar.TypeDir:
+			// Directories are created as needed for the files inside them.
+			continue
+		default:
+			return abort(header.Name, errUnsupportedType)
+		}
+		name, err := cleanRelativePath(strings.TrimPrefix(header.Name, "./"))
+		if err != nil {
+			return abort(header.Name, err)
+		}
+		if header.Size > remaining || header.Size > maxEntrySize {
+			return abort(header.Name, errTooLarge)
+		}
+		remaining -= header.Size
+		meta, err := s.saveUpload(c, dir, name, reader)
+		if err != nil {
+			return abort(header.Name, err)
+		}
+		stored = append(stored, meta)
+	}
+	if len(stored) == 0 {
+		return fail(c, http.StatusBadRequest, "No files in archive")
+	}
+	return s.batchUploaded(c, http.StatusCreated, stored, nil)
+}
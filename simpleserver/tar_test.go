@@ -0,0 +1,140 @@
+package simpleserver
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type tarEntry struct {
+	name    string
+	content string
+	kind    byte
+}
+
+func tarBody(t *testing.T, entries ...tarEntry) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		kind := entry.kind
+		if kind == 0 {
+			kind = tar.TypeReg
+		}
+		header := &tar.Header{Name: entry.name, Typeflag: kind, Mode: 0644, Size: int64(len(entry.content))}
+		if kind == tar.TypeSymlink {
+			header.Linkname = "/etc/passwd"
+		}
+		require.NoError(t, tw.WriteHeader(header))
+		_, err := tw.Write([]byte(entry.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return &buf
+}
+
+func tarUpload(s *Server, target string, body *bytes.Buffer) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, target, body)
+	req.Header.Set("Content-Type", tarContentType)
+	return serve(s, req)
+}
+
+func TestTarExtraction(t *testing.T) {
+	s := newTestServer(t, Config{})
+	body := tarBody(t,
+		tarEntry{name: "site/", kind: tar.TypeDir},
+		tarEntry{name: "site/index.html", content: "<h1>home</h1>"},
+		tarEntry{name: "site/css/main.css", content: "body{}"},
+		tarEntry{name: "./README", content: "readme"},
+	)
+	rec := tarUpload(s, "/site.tar?extract=1", body)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	urls := downloadURLs(t, rec.Body.String())
+	dir := shareDirs(t, s)[0]
+	var names []string
+	for _, u := range urls {
+		names = append(names, strings.TrimPrefix(u, "http://example.com/"+dir+"/"))
+	}
+	sort.Strings(names)
+	require.Equal(t, []string{"README", "site/css/main.css", "site/index.html"}, names)
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, "/"+dir+"/site/css/main.css", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "body{}", rec.Body.String())
+}
+
+func TestTarWithoutExtractIsStored(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := tarUpload(s, "/site.tar", tarBody(t, tarEntry{name: "a.txt", content: "a"}))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.True(t, strings.HasSuffix(downloadURLs(t, rec.Body.String())[0], "/site.tar"))
+}
+
+func TestTarExtractionRejectsBadEntries(t *testing.T) {
+	for name, tc := range map[string]struct {
+		config  Config
+		entries []tarEntry
+		status  int
+	}{
+		"traversal": {entries: []tarEntry{{name: "ok.txt", content: "ok"}, {name: "../../etc/cron.d/x", content: "pwned"}}, status: http.StatusBadRequest},
+		"absolute":  {entries: []tarEntry{{name: "/etc/passwd", content: "pwned"}}, status: http.StatusBadRequest},
+		"symlink":   {entries: []tarEntry{{name: "link", kind: tar.TypeSymlink}}, status: http.StatusBadRequest},
+		"too many":  {config: Config{TarMaxEntries: 1}, entries: []tarEntry{{name: "a", content: "a"}, {name: "b", content: "b"}}, status: http.StatusRequestEntityTooLarge},
+		"empty":     {entries: []tarEntry{{name: "dir/", kind: tar.TypeDir}}, status: http.StatusBadRequest},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(t, tc.config)
+			rec := tarUpload(s, "/bundle.tar?extract=1", tarBody(t, tc.entries...))
+			require.Equal(t, tc.status, rec.Code, rec.Body.String())
+			require.Empty(t, shareDirs(t, s))
+			require.Zero(t, s.index.len())
+		})
+	}
+}
+
+func TestTarGzipExtraction(t *testing.T) {
+	s := newTestServer(t, Config{})
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	_, err := io.Copy(gz, tarBody(t,
+		tarEntry{name: "build/app.js", content: "console.log(1)"},
+		tarEntry{name: "build/app.css", content: "body{}"},
+	))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	// curl --upload-file sends no Content-Type, the body is sniffed.
+	req := httptest.NewRequest(http.MethodPut, "/?extract=true", bytes.NewReader(gzipped.Bytes()))
+	rec := serve(s, req)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	require.Len(t, downloadURLs(t, rec.Body.String()), 2)
+	dir := shareDirs(t, s)[0]
+	rec = serve(s, httptest.NewRequest(http.MethodGet, "/"+dir+"/build/app.js", nil))
+	require.Equal(t, "console.log(1)", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodPut, "/build.tgz?extract=1", bytes.NewReader(gzipped.Bytes()))
+	req.Header.Set("Content-Type", "application/gzip")
+	require.Equal(t, http.StatusCreated, serve(s, req).Code)
+
+	req = httptest.NewRequest(http.MethodPut, "/?extract=true", bytes.NewReader(append([]byte{}, gzipped.Bytes()[:20]...)))
+	require.Equal(t, http.StatusBadRequest, serve(s, req).Code)
+}
+
+func TestTarEntrySizeLimit(t *testing.T) {
+	s := newTestServer(t, Config{TarMaxEntrySize: 1})
+	rec := tarUpload(s, "/bundle.tar?extract=1", tarBody(t,
+		tarEntry{name: "small.txt", content: "small"},
+		tarEntry{name: "big.bin", content: strings.Repeat("x", 1<<20+1)},
+	))
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code, rec.Body.String())
+	require.Zero(t, s.index.len())
+}
@@ -0,0 +1,89 @@
+package simpleserver
+
+import (
+	"errors"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Templates of Config.TemplatesDir that replace built-in responses. Those
+// missing from it keep the built-in ones.
+const (
+	// uploadedTemplate is a text/template rendering the answer to an upload,
+	// given the fields of its JSON answer, such as .URL and .SHA256.
+	uploadedTemplate = "uploaded.txt"
+	// notFoundTemplate is an html/template shown to browsers for a missing
+	// file, given its .Path.
+	notFoundTemplate = "404.html"
+	// uiTemplate is an html/template replacing the upload page, given the
+	// .MaxSize of uploads in bytes, the .Lang of the request and .T, which
+	// translates a message into it as in {{call .T "Upload files"}}.
+	uiTemplate = "index.html"
+	// notifyTemplate is a text/template rendering the emails of X-Notify,
+	// given a notification.
+	notifyTemplate = "notify.txt"
+)
+
+// pageTemplates holds the templates loaded from Config.TemplatesDir.
+type pageTemplates struct {
+	uploaded *texttemplate.Template
+	notify   *texttemplate.Template
+	notFound *template.Template
+	ui       *template.Template
+}
+
+// loadTemplates parses the templates found in dir.
+func loadTemplates(dir string) (*pageTemplates, error) {
+	pages := &pageTemplates{}
+	read := func(name string) (string, bool, error) {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", false, nil
+		}
+		return string(content), err == nil, err
+	}
+	for name, text := range map[string]**texttemplate.Template{uploadedTemplate: &pages.uploaded, notifyTemplate: &pages.notify} {
+		content, ok, err := read(name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			if *text, err = texttemplate.New(name).Parse(content); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for name, page := range map[string]**template.Template{notFoundTemplate: &pages.notFound, uiTemplate: &pages.ui} {
+		text, ok, err := read(name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			if *page, err = template.New(name).Parse(text); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return pages, nil
+}
+
+// fileNotFound answers a download of a missing file, with the 404.html
+// template for browsers when there is one.
+func (s *Server) fileNotFound(c echo.Context) error {
+	accept := c.Request().Header.Get(echo.HeaderAccept)
+	if s.templates == nil || s.templates.notFound == nil || !strings.Contains(accept, echo.MIMETextHTML) {
+		return fail(c, http.StatusNotFound, "File not found")
+	}
+	var page strings.Builder
+	if err := s.templates.notFound.Execute(&page, struct{ Path string }{c.Request().URL.Path}); err != nil {
+		return err
+	}
+	return c.HTML(http.StatusNotFound, page.String())
+}
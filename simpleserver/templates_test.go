@@ -0,0 +1,60 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeTemplates(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestTemplatesReplaceBuiltInResponses(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		uploadedTemplate: "Thanks for sharing {{.Name}}!\n{{.URL}}\n",
+		notFoundTemplate: `<h1>Nothing at {{.Path}}</h1>`,
+		uiTemplate:       `<h1>Acme file drop</h1><p>Up to {{.MaxSize}} bytes</p>`,
+	})
+	s := newTestServer(t, Config{TemplatesDir: dir, MaxSize: 1})
+
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("branded")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.True(t, strings.HasPrefix(rec.Body.String(), "Thanks for sharing notes.txt!\n"), rec.Body.String())
+	require.Equal(t, "branded", download(t, s, downloadURLs(t, rec.Body.String())[0]).Body.String())
+
+	req := httptest.NewRequest(http.MethodGet, "/abcdef/<missing>.txt", nil)
+	req.Header.Set("Accept", "text/html,*/*")
+	rec = serve(s, req)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.Contains(t, rec.Body.String(), "<h1>Nothing at /abcdef/&lt;missing&gt;.txt</h1>")
+	// Other clients still get the error.
+	rec = serve(s, httptest.NewRequest(http.MethodGet, "/abcdef/missing.txt", nil))
+	require.Equal(t, errorResponse{Code: codeNotFound, Message: "File not found"}, errorOf(t, rec.Body.String()))
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "<h1>Acme file drop</h1><p>Up to 1048576 bytes</p>", rec.Body.String())
+}
+
+func TestMissingTemplatesKeepTheDefaults(t *testing.T) {
+	s := newTestServer(t, Config{TemplatesDir: writeTemplates(t, nil)})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("plain")))
+	require.Contains(t, rec.Body.String(), "File uploaded successfully")
+	require.Contains(t, serve(s, httptest.NewRequest(http.MethodGet, "/", nil)).Body.String(), `xhr.open("POST", window.location.pathname)`)
+}
+
+func TestValidateRejectsBrokenTemplates(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{notFoundTemplate: "{{.Path"})
+	require.ErrorContains(t, Config{UploadDir: t.TempDir(), TemplatesDir: dir}.Validate(), "--templates-dir")
+}
@@ -0,0 +1,145 @@
+package simpleserver
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/time/rate"
+)
+
+// maxThrottleChunk bounds the bytes a throttled transfer moves at once, so
+// it flows steadily instead of in bursts of whole buffers.
+const maxThrottleChunk = 32 << 10
+
+// parseSpeed reads a transfer speed in bytes per second such as 512K, 10M or
+// 1G, with binary multiples. Empty and 0 mean unlimited.
+func parseSpeed(value string) (int64, error) {
+	return parseByteSize(value, "speed")
+}
+
+// ParseSize reads a number of bytes such as 512K, 10M or 1G, with binary
+// multiples.
+func ParseSize(value string) (int64, error) {
+	return parseByteSize(value, "size")
+}
+
+// parseByteSize reads a number of bytes such as 512K, 10M or 1G, with binary
+// multiples, naming what it is in errors. Empty means 0.
+func parseByteSize(value, what string) (int64, error) {
+	number := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B")
+	if number == "" {
+		return 0, nil
+	}
+	shift := 0
+	switch number[len(number)-1] {
+	case 'K':
+		shift = 10
+	case 'M':
+		shift = 20
+	case 'G':
+		shift = 30
+	}
+	if shift > 0 {
+		number = number[:len(number)-1]
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a %s such as 512K or 10M", value, what)
+	}
+	return int64(n * float64(int64(1)<<shift)), nil
+}
+
+// newTransferLimiter returns a limiter for a single transfer of speed bytes
+// per second.
+func newTransferLimiter(speed int64) *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(speed), int(min(speed, maxThrottleChunk)))
+}
+
+// throttledReader reads no faster than its limiter allows.
+type throttledReader struct {
+	io.ReadCloser
+	ctx     context.Context
+	limiter *rate.Limiter
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > r.limiter.Burst() {
+		p = p[:r.limiter.Burst()]
+	}
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.WaitN(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// throttledWriter writes no faster than its limiter allows.
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	limiter *rate.Limiter
+}
+
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), w.limiter.Burst())]
+		if err := w.limiter.WaitN(w.ctx, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := w.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (w *throttledWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *throttledWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func (w *throttledWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// throttleTransfers caps every request body at MaxUploadSpeed and every
+// response at MaxDownloadSpeed, so a single large transfer cannot take the
+// whole uplink of the origin. Each request is limited on its own.
+func throttleTransfers(upload, download int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if isProbePath(c.Request().URL.Path) {
+				return next(c)
+			}
+			ctx := c.Request().Context()
+			if upload > 0 {
+				c.Request().Body = &throttledReader{ReadCloser: c.Request().Body, ctx: ctx, limiter: newTransferLimiter(upload)}
+			}
+			if download > 0 {
+				res := c.Response()
+				original := res.Writer
+				res.Writer = &throttledWriter{ResponseWriter: original, ctx: ctx, limiter: newTransferLimiter(download)}
+				defer func() { res.Writer = original }()
+			}
+			return next(c)
+		}
+	}
+}
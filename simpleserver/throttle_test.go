@@ -0,0 +1,58 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSpeed(t *testing.T) {
+	for value, want := range map[string]int64{
+		"":      0,
+		"0":     0,
+		"100":   100,
+		"512K":  512 << 10,
+		"10M":   10 << 20,
+		"10mb":  10 << 20,
+		"1.5G":  3 << 29,
+		" 2KB ": 2 << 10,
+	} {
+		speed, err := parseSpeed(value)
+		require.NoError(t, err, value)
+		require.Equal(t, want, speed, value)
+	}
+	for _, value := range []string{"fast", "-1M", "10T"} {
+		_, err := parseSpeed(value)
+		require.Error(t, err, value)
+	}
+}
+
+func TestTransfersAreThrottled(t *testing.T) {
+	s := newTestServer(t, Config{MaxUploadSpeed: "64K", MaxDownloadSpeed: "64K"})
+	content := strings.Repeat("x", 64<<10)
+
+	// The first 32K pass at once, the remaining 32K take half a second.
+	start := time.Now()
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/big.bin", strings.NewReader(content)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+
+	start = time.Now()
+	rec = download(t, s, downloadURLs(t, rec.Body.String())[0])
+	require.Equal(t, content, rec.Body.String())
+	require.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+
+	// Small responses are not held up.
+	start = time.Now()
+	require.Equal(t, http.StatusOK, serve(s, httptest.NewRequest(http.MethodGet, "/capabilities", nil)).Code)
+	require.Less(t, time.Since(start), 200*time.Millisecond)
+}
+
+func TestValidateSpeeds(t *testing.T) {
+	require.ErrorContains(t, Config{UploadDir: t.TempDir(), MaxDownloadSpeed: "fast"}.Validate(), "--max-download-speed")
+	require.NoError(t, Config{UploadDir: t.TempDir(), MaxUploadSpeed: "10M"}.Validate())
+}
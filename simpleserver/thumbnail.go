@@ -0,0 +1,211 @@
+package simpleserver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	thumbPathSuffix   = "thumb"
+	thumbDirName      = ".thumbs"
+	defaultThumbWidth = 320
+	maxThumbWidth     = 1920
+	// maxThumbSourcePixels keeps a small file declaring huge dimensions from
+	// exhausting memory while it is decoded.
+	maxThumbSourcePixels = 50_000_000
+	// thumbHeaderLen is read to learn the dimensions before decoding, it
+	// covers the largest JPEG metadata segment.
+	thumbHeaderLen = 256 << 10
+)
+
+var errThumbSourceTooLarge = errors.New("image is too large to preview")
+
+// thumbnailTypes maps the image types thumbnails are made of to the format
+// they are encoded in. The standard library has no WebP decoder, so WebP
+// images are served without one.
+var thumbnailTypes = map[string]string{
+	"image/jpeg": "image/jpeg",
+	"image/png":  "image/png",
+	"image/gif":  "image/png",
+}
+
+// thumbnailable reports whether a thumbnail of meta may be served. Files
+// that are password protected or limited in downloads are left out, their
+// thumbnail would give the content away without counting a download.
+func (s *Server) thumbnailable(meta FileMeta) bool {
+	if s.config.NoThumbnails || meta.PasswordHash != "" || meta.Once || meta.MaxDownloads > 0 {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(meta.contentType())
+	_, ok := thumbnailTypes[mediaType]
+	return ok
+}
+
+// thumbTarget reports whether name asks for the thumbnail of a stored file,
+// as in /<dir>/<filename>/thumb.
+func (s *Server) thumbTarget(dir, name string) (string, bool) {
+	if s.config.NoThumbnails {
+		return "", false
+	}
+	return s.suffixTarget(dir, name, thumbPathSuffix)
+}
+
+// thumbURL is where the thumbnail of a stored file is served.
+func (s *Server) thumbURL(c echo.Context, meta FileMeta) string {
+	return s.downloadURL(c, meta.Dir, meta.Name) + "/" + thumbPathSuffix
+}
+
+// serveThumb answers the thumbnail of dir/name, ?w= pixels wide. Thumbnails
+// are made on first request and cached by content and width under the
+// upload dir.
+func (s *Server) serveThumb(c echo.Context, dir, name string) error {
+	meta, _ := s.index.get(dir, name)
+	if s.hiddenDropShare(c, dir) || !s.thumbnailable(meta) {
+		return fail(c, http.StatusNotFound, "No thumbnail for this file")
+	}
+	if meta.expired(time.Now()) {
+		return fail(c, http.StatusGone, "File has expired")
+	}
+	if meta.Pending {
+		return s.tooEarly(c, meta)
+	}
+	width := defaultThumbWidth
+	if value := c.QueryParam("w"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > maxThumbWidth {
+			return fail(c, http.StatusBadRequest, fmt.Sprintf("w must be between 1 and %d", maxThumbWidth))
+		}
+		width = n
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(meta.contentType())
+	contentType := thumbnailTypes[mediaType]
+	cached := filepath.Join(s.getUploadDir(), thumbDirName, fmt.Sprintf("%s-%d", meta.SHA256, width))
+	thumb, err := os.ReadFile(cached)
+	if errors.Is(err, fs.ErrNotExist) || meta.SHA256 == "" {
+		thumb, err = s.makeThumb(c, meta, width, contentType)
+		if errors.Is(err, errThumbSourceTooLarge) {
+			return fail(c, http.StatusUnprocessableEntity, err.Error())
+		}
+		if err != nil {
+			log.Printf("Failed to make thumbnail of %s/%s: %v\n", dir, name, err)
+			return fail(c, http.StatusUnprocessableEntity, "Failed to make thumbnail")
+		}
+		if meta.SHA256 != "" {
+			if err := writeThumb(cached, thumb); err != nil {
+				log.Printf("Failed to cache thumbnail of %s/%s: %v\n", dir, name, err)
+			}
+		}
+	} else if err != nil {
+		return err
+	}
+	c.Response().Header().Set("Cache-Control", "public, max-age=86400")
+	return c.Blob(http.StatusOK, contentType, thumb)
+}
+
+func (s *Server) makeThumb(c echo.Context, meta FileMeta, width int, contentType string) ([]byte, error) {
+	obj, err := s.storage.Get(c.Request().Context(), meta.key())
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Content.Close()
+	content, err := s.decodedReader(obj.Content, meta)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	src := bufio.NewReaderSize(content, thumbHeaderLen)
+	header, err := src.Peek(thumbHeaderLen)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(header))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > maxThumbSourcePixels {
+		return nil, errThumbSourceTooLarge
+	}
+	img, _, err := image.Decode(src)
+	if err != nil {
+		return nil, err
+	}
+	small := scaleDown(img, width)
+	var out bytes.Buffer
+	if contentType == "image/jpeg" {
+		err = jpeg.Encode(&out, small, &jpeg.Options{Quality: 80})
+	} else {
+		err = png.Encode(&out, small)
+	}
+	return out.Bytes(), err
+}
+
+// writeThumb caches a thumbnail, renamed into place so concurrent requests
+// never read a partial one.
+func writeThumb(cached string, thumb []byte) error {
+	if err := os.MkdirAll(filepath.Dir(cached), 0755); err != nil {
+		return err
+	}
+	tmp := cached + "." + base58(8) + partSuffix
+	if err := os.WriteFile(tmp, thumb, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, cached); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// scaleDown shrinks img to width pixels, keeping its aspect ratio, by
+// averaging the source pixels each target pixel covers. Images already
+// narrower are only converted.
+func scaleDown(img image.Image, width int) *image.RGBA {
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	if width >= bounds.Dx() {
+		return src
+	}
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*bounds.Dy()/height, max((y+1)*bounds.Dy()/height, y*bounds.Dy()/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*bounds.Dx()/width, max((x+1)*bounds.Dx()/width, x*bounds.Dx()/width+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					for i := 0; i < 4; i++ {
+						sum[i] += int(row[sx*4+i])
+					}
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			offset := y*dst.Stride + x*4
+			for i := 0; i < 4; i++ {
+				dst.Pix[offset+i] = uint8(sum[i] / n)
+			}
+		}
+	}
+	return dst
+}
@@ -0,0 +1,88 @@
+package simpleserver
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func gradientPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestThumbnailIsScaledAndCached(t *testing.T) {
+	s := newTestServer(t, Config{})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/photo.png", bytes.NewReader(gradientPNG(t, 640, 480))))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	url := downloadURLs(t, rec.Body.String())[0]
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, url+"/thumb?w=160", nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+	thumb, err := png.Decode(rec.Body)
+	require.NoError(t, err)
+	require.Equal(t, image.Rect(0, 0, 160, 120), thumb.Bounds())
+
+	cached, err := filepath.Glob(filepath.Join(s.getUploadDir(), thumbDirName, "*-160"))
+	require.NoError(t, err)
+	require.Len(t, cached, 1)
+	require.NoError(t, os.WriteFile(cached[0], []byte("cached"), 0644))
+	rec = serve(s, httptest.NewRequest(http.MethodGet, url+"/thumb?w=160", nil))
+	require.Equal(t, "cached", rec.Body.String(), "thumbnails are only made once")
+
+	// Images are never scaled up.
+	rec = serve(s, httptest.NewRequest(http.MethodGet, url+"/thumb?w=1000", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	thumb, err = png.Decode(rec.Body)
+	require.NoError(t, err)
+	require.Equal(t, 640, thumb.Bounds().Dx())
+
+	require.Equal(t, http.StatusBadRequest, serve(s, httptest.NewRequest(http.MethodGet, url+"/thumb?w=0", nil)).Code)
+}
+
+func TestThumbnailKeepsJPEGFormat(t *testing.T) {
+	s := newTestServer(t, Config{})
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 400, 200)), nil))
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/photo.jpg", &buf))
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, downloadURLs(t, rec.Body.String())[0]+"/thumb", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "image/jpeg", rec.Header().Get("Content-Type"))
+	thumb, err := jpeg.Decode(rec.Body)
+	require.NoError(t, err)
+	require.Equal(t, image.Rect(0, 0, defaultThumbWidth, 160), thumb.Bounds())
+}
+
+func TestNoThumbnailForProtectedOrNonImageFiles(t *testing.T) {
+	s := newTestServer(t, Config{})
+
+	req := httptest.NewRequest(http.MethodPut, "/photo.png", bytes.NewReader(gradientPNG(t, 10, 10)))
+	req.Header.Set(passwordHeader, "secret")
+	rec := serve(s, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Equal(t, http.StatusNotFound, serve(s, httptest.NewRequest(http.MethodGet, downloadURLs(t, rec.Body.String())[0]+"/thumb", nil)).Code)
+
+	rec = serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", bytes.NewReader([]byte("hello"))))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Equal(t, http.StatusNotFound, serve(s, httptest.NewRequest(http.MethodGet, downloadURLs(t, rec.Body.String())[0]+"/thumb", nil)).Code)
+}
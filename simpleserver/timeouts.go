@@ -0,0 +1,111 @@
+package simpleserver
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// readHeaderTimeout closes connections that take longer to send their
+	// request headers, the classic slowloris attack.
+	readHeaderTimeout   = 30 * time.Second
+	defaultIdleTimeout  = 2 * time.Minute
+	defaultStallTimeout = time.Minute
+)
+
+var (
+	errUploadStalled = errors.New("upload stalled")
+	errUploadTooSlow = errors.New("upload is slower than the minimum upload speed")
+)
+
+// applyTimeouts sets the connection timeouts of the HTTP servers of e.
+func (s *Server) applyTimeouts(e *echo.Echo) {
+	for _, srv := range []*http.Server{e.Server, e.TLSServer} {
+		srv.ReadHeaderTimeout = readHeaderTimeout
+		srv.ReadTimeout = s.config.ReadTimeout
+		srv.WriteTimeout = s.config.WriteTimeout
+		srv.IdleTimeout = s.config.IdleTimeout
+	}
+}
+
+// guardSlowClients aborts request bodies that send nothing for StallTimeout
+// or less than MinUploadSpeed bytes per second over as long, so stalled
+// uploads give back their file handles and temporary space. Bodies are only
+// watched once the handler reads them, as pipes wait for their receiver
+// first.
+func (s *Server) guardSlowClients(next echo.HandlerFunc) echo.HandlerFunc {
+	// Validate made sure the speed parses.
+	minSpeed, _ := parseSpeed(s.config.MinUploadSpeed)
+	return func(c echo.Context) error {
+		r := c.Request()
+		if r.Body == nil || r.Body == http.NoBody || isProbePath(r.URL.Path) {
+			return next(c)
+		}
+		guard := &stallGuard{
+			ReadCloser: r.Body,
+			rc:         http.NewResponseController(c.Response().Writer),
+			window:     s.config.StallTimeout,
+			minBytes:   int64(float64(minSpeed) * s.config.StallTimeout.Seconds()),
+		}
+		r.Body = guard
+		defer guard.release()
+		return next(c)
+	}
+}
+
+// stallGuard pushes the read deadline of the connection a window ahead
+// before every read, and fails reads once a whole window brought fewer than
+// minBytes.
+type stallGuard struct {
+	io.ReadCloser
+	rc       *http.ResponseController
+	window   time.Duration
+	minBytes int64
+
+	windowStart time.Time
+	windowBytes int64
+	aborted     bool
+}
+
+// release lifts the read deadline for the next request on the connection.
+// An aborted body keeps it in the past: otherwise the server would wait for
+// the rest of the body before answering, and the connection is closed
+// after the answer anyway.
+func (g *stallGuard) release() {
+	if !g.aborted {
+		g.rc.SetReadDeadline(time.Time{})
+	}
+}
+
+func (g *stallGuard) abort(err error) error {
+	g.aborted = true
+	g.rc.SetReadDeadline(time.Now())
+	return err
+}
+
+func (g *stallGuard) Read(p []byte) (int, error) {
+	now := time.Now()
+	if g.windowStart.IsZero() {
+		g.windowStart = now
+	}
+	// Without deadline support, as with some test recorders, only the
+	// minimum speed is enforced.
+	g.rc.SetReadDeadline(now.Add(g.window))
+	n, err := g.ReadCloser.Read(p)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return n, g.abort(errUploadStalled)
+	}
+	g.windowBytes += int64(n)
+	if time.Since(g.windowStart) >= g.window {
+		if g.windowBytes < g.minBytes {
+			return n, g.abort(errUploadTooSlow)
+		}
+		g.windowStart, g.windowBytes = time.Now(), 0
+	}
+	return n, err
+}
@@ -0,0 +1,73 @@
+package simpleserver
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// stallingUpload sends the headers of a PUT announcing 1000 bytes, then writes
+// send to the connection, and returns the response.
+func stallingUpload(t *testing.T, s *Server, send func(conn net.Conn)) (*http.Response, string) {
+	t.Helper()
+	ts := httptest.NewServer(s.newRouter())
+	defer ts.Close()
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "PUT /slow.txt HTTP/1.1\r\nHost: example.com\r\nContent-Length: 1000\r\n\r\n")
+	require.NoError(t, err)
+	send(conn)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(body)
+}
+
+func TestStalledUploadsAreAborted(t *testing.T) {
+	s := newTestServer(t, Config{StallTimeout: 200 * time.Millisecond})
+	resp, body := stallingUpload(t, s, func(conn net.Conn) {
+		io.WriteString(conn, "a few bytes")
+	})
+	require.Equal(t, http.StatusRequestTimeout, resp.StatusCode)
+	require.Equal(t, errUploadStalled.Error(), errorOf(t, body).Message)
+	require.Zero(t, s.index.len())
+}
+
+func TestTricklingUploadsAreAborted(t *testing.T) {
+	s := newTestServer(t, Config{StallTimeout: 200 * time.Millisecond, MinUploadSpeed: "1K"})
+	resp, body := stallingUpload(t, s, func(conn net.Conn) {
+		// 10 bytes every 20ms is about 500 bytes per second.
+		for i := 0; i < 30; i++ {
+			if _, err := io.WriteString(conn, strings.Repeat("x", 10)); err != nil {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	})
+	require.Equal(t, http.StatusRequestTimeout, resp.StatusCode)
+	require.Equal(t, errUploadTooSlow.Error(), errorOf(t, body).Message)
+	require.Zero(t, s.index.len())
+}
+
+func TestTimeoutsAreValidated(t *testing.T) {
+	require.ErrorContains(t, Config{UploadDir: t.TempDir(), StallTimeout: -time.Second}.Validate(), "--stall-timeout")
+	require.ErrorContains(t, Config{UploadDir: t.TempDir(), MinUploadSpeed: "1M", MaxUploadSpeed: "512K"}.Validate(), "--min-upload-speed")
+
+	s := newTestServer(t, Config{ReadTimeout: time.Hour, IdleTimeout: time.Minute})
+	e := s.newRouter()
+	s.applyTimeouts(e)
+	require.Equal(t, time.Hour, e.Server.ReadTimeout)
+	require.Equal(t, time.Minute, e.TLSServer.IdleTimeout)
+	require.Equal(t, readHeaderTimeout, e.Server.ReadHeaderTimeout)
+}
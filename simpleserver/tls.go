@@ -0,0 +1,124 @@
+package simpleserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	selfSignedValidity = 365 * 24 * time.Hour
+	// autoTLSCacheDirName keeps ACME accounts and certificates inside the
+	// upload dir unless AutoTLSCacheDir or StateDir say otherwise.
+	autoTLSCacheDirName = ".autocert"
+)
+
+// tlsEnabled reports whether Start serves HTTPS.
+func (s *Server) tlsEnabled() bool {
+	return s.config.TLSCert != "" || s.config.TLSKey != "" || s.config.TLSSelfSigned || len(s.config.AutoTLSDomains) > 0
+}
+
+// tlsConfig loads TLSCert and TLSKey, obtains certificates for
+// AutoTLSDomains from Let's Encrypt, or generates a certificate with
+// TLSSelfSigned. It returns nil when serving plain HTTP.
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+	switch {
+	case !s.tlsEnabled():
+		return nil, nil
+	case len(s.config.AutoTLSDomains) > 0:
+		if s.config.TLSCert != "" || s.config.TLSKey != "" || s.config.TLSSelfSigned {
+			return nil, errors.New("--auto-tls-domain cannot be combined with other TLS options")
+		}
+		return s.autoTLSConfig(), nil
+	case s.config.TLSCert != "" || s.config.TLSKey != "":
+		if s.config.TLSCert == "" || s.config.TLSKey == "" {
+			return nil, errors.New("--tls-cert and --tls-key must be given together")
+		}
+		cert, err = tls.LoadX509KeyPair(s.config.TLSCert, s.config.TLSKey)
+	default:
+		cert, err = selfSignedCert()
+		if err == nil {
+			log.Printf("Serving HTTPS with a self-signed certificate, clients will not trust it\n")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}, nil
+}
+
+// autoTLSConfig obtains and renews certificates for AutoTLSDomains with the
+// TLS-ALPN-01 challenge, which is answered on the HTTPS port itself. The
+// server must therefore be reachable on port 443 under those names.
+func (s *Server) autoTLSConfig() *tls.Config {
+	cacheDir := s.config.autoTLSCacheDir()
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(s.config.AutoTLSDomains...),
+		Cache:      autocert.DirCache(cacheDir),
+	}
+	config := manager.TLSConfig()
+	config.MinVersion = tls.VersionTLS12
+	return config
+}
+
+// attachListener makes e serve on ln, over TLS when config is set.
+func attachListener(e *echo.Echo, ln net.Listener, config *tls.Config) {
+	if config == nil {
+		e.Listener = ln
+		return
+	}
+	e.TLSServer.TLSConfig = config
+	e.TLSListener = tls.NewListener(ln, config)
+}
+
+// selfSignedCert generates an in-memory certificate for localhost and the
+// machine's hostname, good for local use without a tunnel in front.
+func selfSignedCert() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"simpleserver"}, CommonName: "localhost"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "localhost" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -0,0 +1,125 @@
+package simpleserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/acme"
+)
+
+// serveTLS serves s over HTTPS on a loopback port and returns a client
+// trusting its certificate.
+func serveTLS(t *testing.T, s *Server) (string, *http.Client) {
+	t.Helper()
+	config, err := s.tlsConfig()
+	require.NoError(t, err)
+	require.NotNil(t, config)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	e := s.newRouter()
+	attachListener(e, ln, config)
+	shutdownC := make(chan struct{})
+	errC := make(chan error, 1)
+	go func() { errC <- s.serve(e, shutdownC) }()
+	t.Cleanup(func() {
+		close(shutdownC)
+		require.NoError(t, <-errC)
+	})
+
+	leaf, err := x509.ParseCertificate(config.Certificates[0].Certificate[0])
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "localhost"}}}
+	t.Cleanup(client.CloseIdleConnections)
+	return ln.Addr().String(), client
+}
+
+func TestSelfSignedTLS(t *testing.T) {
+	s := newTestServer(t, Config{TLSSelfSigned: true})
+	addr, client := serveTLS(t, s)
+
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("https://%s/hello.txt", addr), strings.NewReader("hello"))
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	urls := downloadURLs(t, string(body))
+	require.Len(t, urls, 1)
+	require.True(t, strings.HasPrefix(urls[0], "https://"+addr+"/"), urls[0])
+
+	resp, err = client.Get(urls[0])
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "hello", string(body))
+}
+
+func TestTLSFromFiles(t *testing.T) {
+	cert, err := selfSignedCert()
+	require.NoError(t, err)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	der, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+
+	s := newTestServer(t, Config{TLSCert: certFile, TLSKey: keyFile})
+	addr, client := serveTLS(t, s)
+	resp, err := client.Get(fmt.Sprintf("https://%s%s", addr, livePath))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	_, err = New(Config{TLSCert: certFile}).tlsConfig()
+	require.Error(t, err)
+	_, err = New(Config{TLSCert: filepath.Join(dir, "missing.pem"), TLSKey: keyFile}).tlsConfig()
+	require.Error(t, err)
+}
+
+func TestPlainHTTPHasNoTLSConfig(t *testing.T) {
+	config, err := New(Config{}).tlsConfig()
+	require.NoError(t, err)
+	require.Nil(t, config)
+}
+
+func TestShortLinksFollowScheme(t *testing.T) {
+	s := newTestServer(t, Config{ShortLinks: true})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "https://example.com/a.txt", strings.NewReader("a")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Contains(t, rec.Body.String(), "https://example.com/"+findMeta(t, s, "a.txt").Dir+"/a.txt\n")
+	require.Contains(t, rec.Body.String(), "Short link: https://example.com/s/")
+}
+
+func TestAutoTLSConfig(t *testing.T) {
+	s := newTestServer(t, Config{AutoTLSDomains: []string{"files.example.com"}})
+	config, err := s.tlsConfig()
+	require.NoError(t, err)
+	require.NotNil(t, config.GetCertificate)
+	require.Contains(t, config.NextProtos, acme.ALPNProto)
+
+	// Names outside the allow list are refused before Let's Encrypt is
+	// ever contacted.
+	_, err = config.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.example.com"})
+	require.Error(t, err)
+
+	_, err = New(Config{AutoTLSDomains: []string{"files.example.com"}, TLSSelfSigned: true}).tlsConfig()
+	require.Error(t, err)
+}
@@ -0,0 +1,247 @@
+package simpleserver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+const uploadTokenHeader = "X-Upload-Token"
+
+var (
+	errUnknownToken    = errors.New("unknown upload token")
+	errTokenExhausted  = errors.New("upload token has no uploads left")
+	errTokenBytesQuota = errors.New("upload token byte quota exceeded")
+)
+
+// UploadToken lets integrators hand out upload access with limits. Zero
+// limits mean unlimited.
+type UploadToken struct {
+	Token      string
+	MaxUploads int64
+	MaxBytes   int64
+}
+
+// TokenUsage is what a token has consumed so far.
+type TokenUsage struct {
+	Uploads int64 `json:"uploads"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// parseUploadToken parses the token[:max-uploads[:max-bytes]] flag syntax.
+func parseUploadToken(value string) (UploadToken, error) {
+	fields := strings.Split(value, ":")
+	if len(fields) > 3 || fields[0] == "" {
+		return UploadToken{}, fmt.Errorf("invalid upload token %q, expected token[:max-uploads[:max-bytes]]", value)
+	}
+	token := UploadToken{Token: fields[0]}
+	limits := []*int64{&token.MaxUploads, &token.MaxBytes}
+	for i, field := range fields[1:] {
+		n, err := strconv.ParseInt(field, 10, 64)
+		if err != nil || n < 0 {
+			return UploadToken{}, fmt.Errorf("invalid limit %q in upload token %q", field, fields[0])
+		}
+		*limits[i] = n
+	}
+	return token, nil
+}
+
+// tokenTracker enforces UploadToken limits. Committed usage lives in the
+// metadata index; in-flight uploads are reserved here so concurrent requests
+// cannot overshoot a limit together.
+type tokenTracker struct {
+	index    *metaIndex
+	tokens   map[string]UploadToken
+	mu       sync.Mutex
+	inflight map[string]TokenUsage
+}
+
+func newTokenTracker(index *metaIndex, tokens []UploadToken) *tokenTracker {
+	t := &tokenTracker{index: index, inflight: make(map[string]TokenUsage)}
+	t.setTokens(tokens)
+	return t
+}
+
+// setTokens replaces the accepted tokens. Uploads in progress keep the
+// limits they were granted with.
+func (t *tokenTracker) setTokens(tokens []UploadToken) {
+	byToken := make(map[string]UploadToken, len(tokens))
+	for _, token := range tokens {
+		byToken[token.Token] = token
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tokens = byToken
+}
+
+// lookup returns the limits of token.
+func (t *tokenTracker) lookup(token string) (UploadToken, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	limits, ok := t.tokens[token]
+	return limits, ok
+}
+
+// tokenGrant tracks a single upload made with a token.
+type tokenGrant struct {
+	tracker *tokenTracker
+	token   UploadToken
+	written int64
+	done    bool
+}
+
+// reserve claims one upload slot for token.
+func (t *tokenTracker) reserve(token string) (*tokenGrant, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	limits, ok := t.tokens[token]
+	if !ok {
+		return nil, errUnknownToken
+	}
+	used := t.index.tokenUsage(token)
+	pending := t.inflight[token]
+	if limits.MaxUploads > 0 && used.Uploads+pending.Uploads >= limits.MaxUploads {
+		return nil, errTokenExhausted
+	}
+	if limits.MaxBytes > 0 && used.Bytes+pending.Bytes >= limits.MaxBytes {
+		return nil, errTokenBytesQuota
+	}
+	pending.Uploads++
+	t.inflight[token] = pending
+	return &tokenGrant{tracker: t, token: limits}, nil
+}
+
+// claimBytes accounts n more bytes against the token while streaming.
+func (g *tokenGrant) claimBytes(n int64) error {
+	t := g.tracker
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	pending := t.inflight[g.token.Token]
+	if g.token.MaxBytes > 0 && t.index.tokenUsage(g.token.Token).Bytes+pending.Bytes+n > g.token.MaxBytes {
+		return errTokenBytesQuota
+	}
+	pending.Bytes += n
+	t.inflight[g.token.Token] = pending
+	g.written += n
+	return nil
+}
+
+// finish releases the reservation and, when the upload was stored, moves its
+// usage into the persisted counters.
+func (g *tokenGrant) finish(stored bool) error {
+	if g == nil || g.done {
+		return nil
+	}
+	g.done = true
+	t := g.tracker
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	pending := t.inflight[g.token.Token]
+	pending.Uploads--
+	pending.Bytes -= g.written
+	if pending.Uploads == 0 {
+		delete(t.inflight, g.token.Token)
+	} else {
+		t.inflight[g.token.Token] = pending
+	}
+	if !stored {
+		return nil
+	}
+	usage := t.index.tokenUsage(g.token.Token)
+	usage.Uploads++
+	usage.Bytes += g.written
+	return t.index.putTokenUsage(g.token.Token, usage)
+}
+
+// reader wraps r so every byte read is charged to the token.
+func (g *tokenGrant) reader(r io.Reader) io.Reader {
+	if g == nil {
+		return r
+	}
+	return &tokenReader{grant: g, r: r}
+}
+
+type tokenReader struct {
+	grant *tokenGrant
+	r     io.Reader
+}
+
+func (tr *tokenReader) Read(p []byte) (int, error) {
+	n, err := tr.r.Read(p)
+	if n > 0 {
+		if claimErr := tr.grant.claimBytes(int64(n)); claimErr != nil {
+			return 0, claimErr
+		}
+	}
+	return n, err
+}
+
+// requestToken returns the upload token presented by the client, if any.
+func requestToken(c echo.Context) string {
+	if token := c.Request().Header.Get(uploadTokenHeader); token != "" {
+		return token
+	}
+	return c.QueryParam("token")
+}
+
+// reserveUpload claims an upload slot when the request carries a token. A nil
+// grant means the upload is anonymous.
+func (s *Server) reserveUpload(c echo.Context) (*tokenGrant, error) {
+	token := requestToken(c)
+	if token == "" {
+		return nil, nil
+	}
+	return s.tokens.reserve(token)
+}
+
+func tokenErrorStatus(err error) (int, bool) {
+	switch {
+	case errors.Is(err, errUnknownToken):
+		return http.StatusUnauthorized, true
+	case errors.Is(err, errTokenExhausted), errors.Is(err, errTokenBytesQuota):
+		return http.StatusForbidden, true
+	}
+	return 0, false
+}
+
+type tokenUsageResponse struct {
+	Token string `json:"token"`
+	TokenUsage
+	MaxUploads       int64  `json:"max_uploads"`
+	MaxBytes         int64  `json:"max_bytes"`
+	RemainingUploads *int64 `json:"remaining_uploads"`
+	RemainingBytes   *int64 `json:"remaining_bytes"`
+}
+
+func remaining(limit, used int64) *int64 {
+	if limit == 0 {
+		return nil
+	}
+	left := limit - used
+	if left < 0 {
+		left = 0
+	}
+	return &left
+}
+
+func (s *Server) handleTokenUsage(c echo.Context) error {
+	token, ok := s.tokens.lookup(c.Param("token"))
+	if !ok {
+		return fail(c, http.StatusNotFound, "Unknown token")
+	}
+	usage := s.index.tokenUsage(token.Token)
+	return c.JSON(http.StatusOK, tokenUsageResponse{
+		Token:            token.Token,
+		TokenUsage:       usage,
+		MaxUploads:       token.MaxUploads,
+		MaxBytes:         token.MaxBytes,
+		RemainingUploads: remaining(token.MaxUploads, usage.Uploads),
+		RemainingBytes:   remaining(token.MaxBytes, usage.Bytes),
+	})
+}
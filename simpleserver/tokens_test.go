@@ -0,0 +1,106 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testAdminToken = "admin-secret"
+
+func adminRequest(method, target string, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	return req
+}
+
+func tokenUpload(s *Server, token, name, content string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/"+name, strings.NewReader(content))
+	req.Header.Set(uploadTokenHeader, token)
+	return serve(s, req)
+}
+
+func tokenUsageOf(t *testing.T, s *Server, token string) tokenUsageResponse {
+	t.Helper()
+	rec := serve(s, adminRequest(http.MethodGet, "/admin/tokens/"+token+"/usage", ""))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var usage tokenUsageResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &usage))
+	return usage
+}
+
+func TestParseUploadToken(t *testing.T) {
+	token, err := parseUploadToken("abc:3:1024")
+	require.NoError(t, err)
+	require.Equal(t, UploadToken{Token: "abc", MaxUploads: 3, MaxBytes: 1024}, token)
+
+	token, err = parseUploadToken("abc")
+	require.NoError(t, err)
+	require.Equal(t, UploadToken{Token: "abc"}, token)
+
+	for _, invalid := range []string{"", ":1", "abc:x", "abc:1:-1", "a:1:2:3"} {
+		_, err := parseUploadToken(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestTokenUsageEndpoint(t *testing.T) {
+	s := newTestServer(t, Config{
+		AdminToken: testAdminToken,
+		UploadTokens: []UploadToken{
+			{Token: "partner", MaxUploads: 2, MaxBytes: 100},
+			{Token: "unlimited"},
+		},
+	})
+
+	require.Equal(t, http.StatusCreated, tokenUpload(s, "partner", "a.txt", "12345").Code)
+	require.Equal(t, http.StatusCreated, tokenUpload(s, "partner", "b.txt", "1234567890").Code)
+	require.Equal(t, http.StatusForbidden, tokenUpload(s, "partner", "c.txt", "x").Code)
+	require.Equal(t, http.StatusUnauthorized, tokenUpload(s, "bogus", "d.txt", "x").Code)
+	require.Equal(t, http.StatusCreated, tokenUpload(s, "unlimited", "e.txt", "abc").Code)
+
+	usage := tokenUsageOf(t, s, "partner")
+	require.Equal(t, int64(2), usage.Uploads)
+	require.Equal(t, int64(15), usage.Bytes)
+	require.Equal(t, int64(0), *usage.RemainingUploads)
+	require.Equal(t, int64(85), *usage.RemainingBytes)
+
+	usage = tokenUsageOf(t, s, "unlimited")
+	require.Equal(t, int64(1), usage.Uploads)
+	require.Equal(t, int64(3), usage.Bytes)
+	require.Nil(t, usage.RemainingUploads)
+
+	rec := serve(s, adminRequest(http.MethodGet, "/admin/tokens/bogus/usage", ""))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	// Usage survives a restart because it is kept in the metadata index.
+	restarted := newTestServer(t, s.config)
+	require.Equal(t, int64(2), tokenUsageOf(t, restarted, "partner").Uploads)
+}
+
+func TestTokenByteQuotaAbortsUpload(t *testing.T) {
+	s := newTestServer(t, Config{
+		AdminToken:   testAdminToken,
+		UploadTokens: []UploadToken{{Token: "small", MaxBytes: 8}},
+	})
+
+	require.Equal(t, http.StatusForbidden, tokenUpload(s, "small", "big.txt", "more than eight bytes").Code)
+	require.Equal(t, http.StatusCreated, tokenUpload(s, "small", "ok.txt", "12345678").Code)
+
+	usage := tokenUsageOf(t, s, "small")
+	require.Equal(t, int64(1), usage.Uploads)
+	require.Equal(t, int64(8), usage.Bytes)
+}
+
+func TestTokenUsageRequiresAdmin(t *testing.T) {
+	s := newTestServer(t, Config{
+		AdminToken:   testAdminToken,
+		UploadTokens: []UploadToken{{Token: "partner"}},
+	})
+	rec := serve(s, httptest.NewRequest(http.MethodGet, "/admin/tokens/partner/usage", nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
@@ -0,0 +1,178 @@
+package simpleserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/contrib/propagators/jaeger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	tracerName       = "github.com/cloudflare/cloudflared/simpleserver"
+	otlpTracesPath   = "/v1/traces"
+	otlpTimeout      = 10 * time.Second
+	cfRayHeader      = "Cf-Ray"
+	tracingShutdown  = 5 * time.Second
+	storageLatencyMS = attribute.Key("storage.latency_ms")
+)
+
+// tracePropagator reads the trace context of incoming requests: W3C
+// traceparent, and the uber-trace-id header cloudflared sends when it traces
+// the request itself.
+var tracePropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, jaeger.Jaeger{})
+
+// newTracing returns the tracer spans are recorded with. Spans go to the
+// OTLP/HTTP collector at OTelEndpoint; without one they are not recorded at
+// all and the provider is nil.
+func newTracing(config Config) (*tracesdk.TracerProvider, trace.Tracer) {
+	if config.OTelEndpoint == "" {
+		return nil, noop.NewTracerProvider().Tracer(tracerName)
+	}
+	exporter := otlptrace.NewUnstarted(&otlpHTTPClient{
+		url:    strings.TrimSuffix(config.OTelEndpoint, "/") + otlpTracesPath,
+		client: &http.Client{Timeout: otlpTimeout},
+	})
+	provider := tracesdk.NewTracerProvider(
+		tracesdk.WithBatcher(exporter),
+		tracesdk.WithResource(resource.NewSchemaless(semconv.ServiceName("simpleserver"))),
+	)
+	return provider, provider.Tracer(tracerName)
+}
+
+// shutdownTracing sends the spans still buffered.
+func (s *Server) shutdownTracing() {
+	if s.tracerProvider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tracingShutdown)
+	defer cancel()
+	if err := s.tracerProvider.Shutdown(ctx); err != nil {
+		log.Printf("Failed to send traces: %v\n", err)
+	}
+}
+
+// traceRequests records a span for every request, continuing the trace
+// cloudflared or the client started. The span carries the request ID and
+// the Cf-Ray of the request so a trace can be found from either.
+func (s *Server) traceRequests(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := tracePropagator.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		route := c.Path()
+		if route == "" {
+			route = req.URL.Path
+		}
+		ctx, span := s.tracer.Start(ctx, req.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(req.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(req.URL.Path),
+				semconv.ClientAddress(c.RealIP()),
+				attribute.String("request.id", c.Response().Header().Get(echo.HeaderXRequestID)),
+			))
+		defer span.End()
+		if ray := req.Header.Get(cfRayHeader); ray != "" {
+			span.SetAttributes(attribute.String("cf.ray", ray))
+		}
+		c.SetRequest(req.WithContext(ctx))
+		err := next(c)
+		status := c.Response().Status
+		if httpErr, ok := err.(*echo.HTTPError); ok && !c.Response().Committed {
+			status = httpErr.Code
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		return err
+	}
+}
+
+// endSpan ends span, marking it failed with err.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// fileAttributes describe the file a span transfers.
+func fileAttributes(meta FileMeta) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("file.dir", meta.Dir),
+		attribute.String("file.name", meta.Name),
+		attribute.Int64("file.size", meta.Size),
+	}
+}
+
+// recordStorageLatency notes on the span of ctx how long the storage
+// backend took since start.
+func recordStorageLatency(ctx context.Context, start time.Time) {
+	trace.SpanFromContext(ctx).SetAttributes(storageLatencyMS.Float64(float64(time.Since(start).Microseconds()) / 1000))
+}
+
+// otlpHTTPClient sends spans to an OpenTelemetry collector over OTLP/HTTP
+// in protobuf encoding.
+type otlpHTTPClient struct {
+	url    string
+	client *http.Client
+}
+
+func (o *otlpHTTPClient) Start(context.Context) error {
+	return nil
+}
+
+func (o *otlpHTTPClient) Stop(context.Context) error {
+	return nil
+}
+
+func (o *otlpHTTPClient) UploadTraces(ctx context.Context, spans []*tracepb.ResourceSpans) error {
+	body, err := proto.Marshal(&coltracepb.ExportTraceServiceRequest{ResourceSpans: spans})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(echo.HeaderContentType, "application/x-protobuf")
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector answered %s", resp.Status)
+	}
+	return nil
+}
+
+// validOTelEndpoint reports whether endpoint is the http(s) base URL of a
+// collector.
+func validOTelEndpoint(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,112 @@
+package simpleserver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// recordSpans makes s record its spans in memory.
+func recordSpans(s *Server) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	s.tracer = tracesdk.NewTracerProvider(tracesdk.WithSpanProcessor(recorder)).Tracer(tracerName)
+	return recorder
+}
+
+func spanAttributes(span tracesdk.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestRequestsContinueIncomingTrace(t *testing.T) {
+	s := newTestServer(t, Config{})
+	recorder := recordSpans(s)
+
+	req := httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("notes"))
+	req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(cfRayHeader, "8a1b2c3d4e5f6a7b-LHR")
+	rec := serve(s, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	requestID := rec.Header().Get("X-Request-Id")
+	require.NotEmpty(t, requestID)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	upload, request := spans[0], spans[1]
+	require.Equal(t, "upload", upload.Name())
+	require.Equal(t, request.SpanContext().SpanID(), upload.Parent().SpanID())
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", request.SpanContext().TraceID().String())
+	require.Equal(t, "00f067aa0ba902b7", request.Parent().SpanID().String())
+
+	attrs := spanAttributes(request)
+	require.Equal(t, requestID, attrs["request.id"].AsString())
+	require.Equal(t, "8a1b2c3d4e5f6a7b-LHR", attrs["cf.ray"].AsString())
+	require.Equal(t, int64(http.StatusCreated), attrs["http.response.status_code"].AsInt64())
+	attrs = spanAttributes(upload)
+	require.Equal(t, int64(len("notes")), attrs["file.size"].AsInt64())
+	require.Contains(t, attrs, storageLatencyMS)
+
+	rec = download(t, s, downloadURLs(t, rec.Body.String())[0])
+	require.Equal(t, http.StatusOK, rec.Code)
+	spans = recorder.Ended()
+	downloadSpan := spans[len(spans)-2]
+	require.Equal(t, "download", downloadSpan.Name())
+	attrs = spanAttributes(downloadSpan)
+	require.Equal(t, "notes.txt", attrs["file.name"].AsString())
+	require.Contains(t, attrs, storageLatencyMS)
+}
+
+func TestRequestIDIsKept(t *testing.T) {
+	s := newTestServer(t, Config{})
+	req := httptest.NewRequest(http.MethodGet, healthPath, nil)
+	req.Header.Set("X-Request-Id", "from-the-edge")
+	require.Equal(t, "from-the-edge", serve(s, req).Header().Get("X-Request-Id"))
+}
+
+func TestSpansAreSentToCollector(t *testing.T) {
+	received := make(chan *coltracepb.ExportTraceServiceRequest, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, otlpTracesPath, r.URL.Path)
+		require.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var export coltracepb.ExportTraceServiceRequest
+		require.NoError(t, proto.Unmarshal(body, &export))
+		received <- &export
+	}))
+	defer collector.Close()
+
+	s := newTestServer(t, Config{OTelEndpoint: collector.URL})
+	require.NotNil(t, s.tracerProvider)
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("notes")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	s.shutdownTracing()
+
+	export := <-received
+	var names []string
+	for _, resourceSpans := range export.ResourceSpans {
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			for _, span := range scopeSpans.Spans {
+				names = append(names, span.Name)
+			}
+		}
+	}
+	require.Contains(t, names, "upload")
+}
+
+func TestValidateOTelEndpoint(t *testing.T) {
+	require.ErrorContains(t, Config{UploadDir: t.TempDir(), OTelEndpoint: "collector:4318"}.Validate(), "--otel-endpoint")
+	require.NoError(t, Config{UploadDir: t.TempDir(), OTelEndpoint: "http://collector:4318"}.Validate())
+}
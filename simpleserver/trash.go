@@ -0,0 +1,194 @@
+package simpleserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// trashDirName holds the expired and deleted uploads kept for
+// Config.TrashPeriod. Each is stored in the backend under .trash/<id>, with
+// its metadata next to it in <id>.json.
+const trashDirName = ".trash"
+
+var errTrashConflict = errors.New("a file with that name exists again")
+
+// trashedFile is an upload waiting in the trash.
+type trashedFile struct {
+	ID        string    `json:"id"`
+	Meta      FileMeta  `json:"meta"`
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+func (s *Server) trashEnabled() bool {
+	return s.config.TrashPeriod > 0
+}
+
+func trashKey(id string) string {
+	return trashDirName + "/" + id
+}
+
+func (s *Server) trashPath(id string) string {
+	return filepath.Join(s.getUploadDir(), trashDirName, id+".json")
+}
+
+// trashFile moves an upload into the trash instead of deleting it.
+func (s *Server) trashFile(meta FileMeta) error {
+	now := time.Now().UTC()
+	item := trashedFile{ID: base58(12), Meta: meta, DeletedAt: now, PurgeAt: now.Add(s.config.TrashPeriod)}
+	content, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.trashPath(item.ID)), 0755); err != nil {
+		return err
+	}
+	if err := s.renameObject(context.Background(), meta.key(), trashKey(item.ID)); err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.trashPath(item.ID), content, 0644); err != nil {
+		return err
+	}
+	if err := s.index.delete(meta.Dir, meta.Name); err != nil {
+		return err
+	}
+	s.replicator.remove(meta.key())
+	s.cache.remove(meta.key())
+	s.dropVariants(meta)
+	return nil
+}
+
+// trashed lists the uploads in the trash, most recently deleted first.
+func (s *Server) trashed() ([]trashedFile, error) {
+	entries, err := os.ReadDir(filepath.Join(s.getUploadDir(), trashDirName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var items []trashedFile
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		item, err := s.readTrashed(id)
+		if err != nil {
+			log.Printf("Failed to read trashed %s: %v\n", id, err)
+			continue
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].DeletedAt.After(items[j].DeletedAt) })
+	return items, nil
+}
+
+func (s *Server) readTrashed(id string) (trashedFile, error) {
+	var item trashedFile
+	content, err := os.ReadFile(s.trashPath(id))
+	if err != nil {
+		return item, err
+	}
+	err = json.Unmarshal(content, &item)
+	return item, err
+}
+
+// restoreFile puts a trashed upload back where it was. Its expiry is
+// lifted when it already passed, or the reaper would take it again.
+func (s *Server) restoreFile(id string) (FileMeta, error) {
+	item, err := s.readTrashed(id)
+	if err != nil {
+		return FileMeta{}, err
+	}
+	meta := item.Meta
+	if _, ok := s.index.get(meta.Dir, meta.Name); ok {
+		return FileMeta{}, errTrashConflict
+	}
+	if meta.expired(time.Now()) {
+		meta.ExpiresAt = time.Time{}
+	}
+	if err := s.renameObject(context.Background(), trashKey(id), meta.key()); err != nil {
+		return FileMeta{}, err
+	}
+	if err := s.index.put(meta); err != nil {
+		return FileMeta{}, err
+	}
+	s.replicator.copy(meta.key())
+	return meta, os.Remove(s.trashPath(id))
+}
+
+// purgeTrash permanently deletes the trashed uploads whose grace period
+// ended at now and returns how many were removed.
+func (s *Server) purgeTrash(now time.Time) int {
+	items, err := s.trashed()
+	if err != nil {
+		log.Printf("Failed to list trash: %v\n", err)
+		return 0
+	}
+	purged := 0
+	for _, item := range items {
+		if now.Before(item.PurgeAt) {
+			continue
+		}
+		if err := s.storage.Delete(context.Background(), trashKey(item.ID)); err != nil {
+			log.Printf("Failed to purge trashed %s: %v\n", item.Meta.key(), err)
+			continue
+		}
+		if err := os.Remove(s.trashPath(item.ID)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Failed to purge trashed %s: %v\n", item.Meta.key(), err)
+			continue
+		}
+		purged++
+	}
+	return purged
+}
+
+type trashResponse struct {
+	Files []trashedFile `json:"files"`
+}
+
+func (s *Server) handleTrash(c echo.Context) error {
+	items, err := s.trashed()
+	if err != nil {
+		log.Printf("Failed to list trash: %v\n", err)
+		return fail(c, http.StatusInternalServerError, "Failed to list trash")
+	}
+	response := trashResponse{Files: []trashedFile{}}
+	for _, item := range items {
+		item.Meta.PasswordHash = ""
+		item.Meta.DeleteTokenHash = ""
+		response.Files = append(response.Files, item)
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// handleRestore moves the trashed upload :id back in place.
+func (s *Server) handleRestore(c echo.Context) error {
+	id := c.Param("id")
+	if !validSlug(id) {
+		return fail(c, http.StatusNotFound, "File not found in trash")
+	}
+	meta, err := s.restoreFile(id)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return fail(c, http.StatusNotFound, "File not found in trash")
+	case errors.Is(err, errTrashConflict):
+		return fail(c, http.StatusConflict, err.Error())
+	case err != nil:
+		log.Printf("Failed to restore trashed %s: %v\n", id, err)
+		return fail(c, http.StatusInternalServerError, "Failed to restore file")
+	}
+	return c.JSON(http.StatusOK, map[string]string{"url": s.downloadURL(c, meta.Dir, meta.Name)})
+}
@@ -0,0 +1,86 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func trashList(t *testing.T, s *Server) []trashedFile {
+	t.Helper()
+	rec := serve(s, adminRequest(http.MethodGet, "/admin/trash", ""))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var response trashResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	return response.Files
+}
+
+func TestAdminDeleteGoesToTrash(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken, TrashPeriod: time.Hour})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("notes")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	url := downloadURLs(t, rec.Body.String())[0]
+	meta := findMeta(t, s, "notes.txt")
+
+	rec = serve(s, adminRequest(http.MethodDelete, "/admin/files/"+meta.key(), ""))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.Equal(t, http.StatusNotFound, download(t, s, url).Code)
+	trashed := trashList(t, s)
+	require.Len(t, trashed, 1)
+	require.Equal(t, meta.key(), trashed[0].Meta.key())
+
+	rec = serve(s, adminRequest(http.MethodPost, "/admin/files/"+trashed[0].ID+"/restore", ""))
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = download(t, s, url)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "notes", rec.Body.String())
+	require.Empty(t, trashList(t, s))
+
+	rec = serve(s, adminRequest(http.MethodPost, "/admin/files/"+trashed[0].ID+"/restore", ""))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestExpiredFilesAreRestorable(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken, TTL: time.Hour, TrashPeriod: time.Hour})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/old.txt", strings.NewReader("old")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	url := downloadURLs(t, rec.Body.String())[0]
+
+	require.Equal(t, 1, s.reapExpired(time.Now().Add(2*time.Hour)))
+	trashed := trashList(t, s)
+	require.Len(t, trashed, 1)
+	rec = serve(s, adminRequest(http.MethodPost, "/admin/files/"+trashed[0].ID+"/restore", ""))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.True(t, findMeta(t, s, "old.txt").ExpiresAt.After(time.Now()), "not yet expired when restored")
+	require.Equal(t, http.StatusOK, download(t, s, url).Code)
+
+	require.Equal(t, 1, s.reapExpired(time.Now().Add(2*time.Hour)))
+	require.Zero(t, s.purgeTrash(time.Now()))
+	require.Equal(t, 1, s.purgeTrash(time.Now().Add(2*time.Hour)))
+	require.Empty(t, trashList(t, s))
+}
+
+func TestRestoreRefusesToOverwrite(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken, TrashPeriod: time.Hour})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("notes")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	meta := findMeta(t, s, "notes.txt")
+	require.NoError(t, s.trashFile(meta))
+	require.NoError(t, s.index.put(meta))
+
+	rec = serve(s, adminRequest(http.MethodPost, "/admin/files/"+trashList(t, s)[0].ID+"/restore", ""))
+	require.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestNoTrashDeletesAtOnce(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken, TTL: time.Hour})
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/old.txt", strings.NewReader("old")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Equal(t, 1, s.reapExpired(time.Now().Add(2*time.Hour)))
+	require.Empty(t, trashList(t, s))
+}
@@ -0,0 +1,370 @@
+package simpleserver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Resumable uploads follow the tus 1.0.0 core protocol and its creation
+// extension, see https://tus.io/protocols/resumable-upload. A client creates
+// an upload with POST /files, sends its content in one or more PATCH
+// requests and asks HEAD for the offset to resume from after a failure. Once
+// the last byte arrives the upload is stored like any other, and the
+// download link is returned in the X-Download-Url header.
+const (
+	tusPath            = "/files"
+	tusVersion         = "1.0.0"
+	tusExtensions      = "creation"
+	tusOffsetMediaType = "application/offset+octet-stream"
+	// tusDirName holds the state and partial content of resumable uploads.
+	tusDirName = ".tus"
+
+	tusIDLength = 16
+
+	tusResumableHeader = "Tus-Resumable"
+	tusVersionHeader   = "Tus-Version"
+	tusExtensionHeader = "Tus-Extension"
+	tusMaxSizeHeader   = "Tus-Max-Size"
+	uploadLengthHeader = "Upload-Length"
+	uploadOffsetHeader = "Upload-Offset"
+	uploadMetaHeader   = "Upload-Metadata"
+	downloadURLHeader  = "X-Download-Url"
+)
+
+// tusUpload is the state of a resumable upload. It is persisted as
+// <id>.json next to the partial content in <id>.part.
+type tusUpload struct {
+	ID        string    `json:"id"`
+	Length    int64     `json:"length"`
+	Offset    int64     `json:"offset"`
+	Filename  string    `json:"filename"`
+	CreatedAt time.Time `json:"created_at"`
+	// Dir and Name locate the stored file once the upload is complete.
+	Dir  string `json:"dir,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+func (u tusUpload) complete() bool {
+	return u.Dir != ""
+}
+
+// tusStore keeps resumable uploads under <upload-dir>/.tus. PATCH requests
+// for the same upload are serialized through locks.
+type tusStore struct {
+	root  string
+	locks sync.Map
+}
+
+func newTusStore(uploadDir string) *tusStore {
+	return &tusStore{root: filepath.Join(uploadDir, tusDirName)}
+}
+
+func (t *tusStore) statePath(id string) string {
+	return filepath.Join(t.root, id+".json")
+}
+
+func (t *tusStore) partPath(id string) string {
+	return filepath.Join(t.root, id+partSuffix)
+}
+
+// validTusID rejects ids that could escape the store directory.
+func validTusID(id string) bool {
+	if len(id) != tusIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !strings.ContainsRune(base58Alphabet, r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *tusStore) get(id string) (tusUpload, error) {
+	if !validTusID(id) {
+		return tusUpload{}, fs.ErrNotExist
+	}
+	content, err := os.ReadFile(t.statePath(id))
+	if err != nil {
+		return tusUpload{}, err
+	}
+	var upload tusUpload
+	if err := json.Unmarshal(content, &upload); err != nil {
+		return tusUpload{}, err
+	}
+	return upload, nil
+}
+
+func (t *tusStore) save(upload tusUpload) error {
+	content, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(t.root, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(t.statePath(upload.ID), content, 0644)
+}
+
+func (t *tusStore) create(upload tusUpload) error {
+	if err := os.MkdirAll(t.root, 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(t.partPath(upload.ID))
+	if err != nil {
+		return err
+	}
+	file.Close()
+	if err := t.save(upload); err != nil {
+		os.Remove(t.partPath(upload.ID))
+		return err
+	}
+	return nil
+}
+
+func (t *tusStore) remove(id string) {
+	os.Remove(t.partPath(id))
+	os.Remove(t.statePath(id))
+}
+
+// lock reserves id for a PATCH request. It reports false when another one
+// is already writing to the same upload.
+func (t *tusStore) lock(id string) (unlock func(), ok bool) {
+	mu, _ := t.locks.LoadOrStore(id, &sync.Mutex{})
+	if !mu.(*sync.Mutex).TryLock() {
+		return nil, false
+	}
+	return mu.(*sync.Mutex).Unlock, true
+}
+
+// requireTus answers every tus request with the protocol version and rejects
+// clients speaking another one, as the protocol demands.
+func requireTus(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Response().Header().Set(tusResumableHeader, tusVersion)
+		if c.Request().Method != http.MethodOptions && c.Request().Header.Get(tusResumableHeader) != tusVersion {
+			c.Response().Header().Set(tusVersionHeader, tusVersion)
+			return fail(c, http.StatusPreconditionFailed, "Unsupported tus version")
+		}
+		return next(c)
+	}
+}
+
+// isTusDiscovery reports a tus OPTIONS request. Those are answered by
+// handleTusOptions rather than as CORS preflights.
+func isTusDiscovery(c echo.Context) bool {
+	r := c.Request()
+	return r.Method == http.MethodOptions && r.Header.Get(echo.HeaderOrigin) == "" &&
+		(r.URL.Path == tusPath || strings.HasPrefix(r.URL.Path, tusPath+"/"))
+}
+
+func (s *Server) registerTusRoutes(e *echo.Echo) {
+	g := e.Group(tusPath, requireTus)
+	g.OPTIONS("", s.handleTusOptions)
+	g.POST("", s.handleTusCreate, s.requireUploadAuth, s.rejectInMaintenance)
+	g.HEAD("/:id", s.handleTusHead, s.requireUploadAuth)
+	g.PATCH("/:id", s.handleTusPatch, s.requireUploadAuth, s.rejectInMaintenance, s.limitUploadsPerUser, s.queueUploads)
+}
+
+func (s *Server) tusMaxSize() int64 {
+	return int64(s.maxSize()) << 20
+}
+
+func (s *Server) handleTusOptions(c echo.Context) error {
+	header := c.Response().Header()
+	header.Set(tusVersionHeader, tusVersion)
+	header.Set(tusExtensionHeader, tusExtensions)
+	header.Set(tusMaxSizeHeader, strconv.FormatInt(s.tusMaxSize(), 10))
+	return c.NoContent(http.StatusNoContent)
+}
+
+// tusFilename extracts the filename from Upload-Metadata, a comma separated
+// list of "key base64(value)" pairs.
+func tusFilename(metadata string) (string, error) {
+	for _, pair := range strings.Split(metadata, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key != "filename" {
+			continue
+		}
+		name, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s: %w", uploadMetaHeader, err)
+		}
+		return string(name), nil
+	}
+	return "", nil
+}
+
+func (s *Server) handleTusCreate(c echo.Context) error {
+	length, err := strconv.ParseInt(c.Request().Header.Get(uploadLengthHeader), 10, 64)
+	if err != nil || length < 0 {
+		return fail(c, http.StatusBadRequest, "Missing or invalid "+uploadLengthHeader)
+	}
+	opts, err := s.uploadOptions(c)
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	if length > s.tusMaxSize() || (opts.MaxBytes > 0 && length > opts.MaxBytes) {
+		return s.uploadError(c, errTooLarge)
+	}
+	clientName, err := tusFilename(c.Request().Header.Get(uploadMetaHeader))
+	if err != nil {
+		return fail(c, http.StatusBadRequest, err.Error())
+	}
+	filename, err := s.uploadFilename(clientName)
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	if !s.extensionAllowed(filename) {
+		return s.uploadError(c, errExtensionNotAllowed)
+	}
+
+	upload := tusUpload{
+		ID:        base58(tusIDLength),
+		Length:    length,
+		Filename:  filename,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.tus.create(upload); err != nil {
+		log.Printf("Failed to create resumable upload: %v\n", err)
+		return fail(c, http.StatusInternalServerError, "Failed to create upload")
+	}
+	c.Response().Header().Set(echo.HeaderLocation, basePath(c)+tusPath+"/"+upload.ID)
+	if length == 0 {
+		return s.finishTusUpload(c, upload, http.StatusCreated)
+	}
+	return c.NoContent(http.StatusCreated)
+}
+
+func (s *Server) handleTusHead(c echo.Context) error {
+	upload, err := s.tus.get(c.Param("id"))
+	if err != nil {
+		return tusLookupError(c, err)
+	}
+	header := c.Response().Header()
+	header.Set(echo.HeaderCacheControl, "no-store")
+	header.Set(uploadOffsetHeader, strconv.FormatInt(upload.Offset, 10))
+	header.Set(uploadLengthHeader, strconv.FormatInt(upload.Length, 10))
+	if upload.complete() {
+		header.Set(downloadURLHeader, s.downloadURL(c, upload.Dir, upload.Name))
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+func tusLookupError(c echo.Context, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	log.Printf("Failed to read resumable upload: %v\n", err)
+	return c.NoContent(http.StatusInternalServerError)
+}
+
+func (s *Server) handleTusPatch(c echo.Context) error {
+	id := c.Param("id")
+	if c.Request().Header.Get(echo.HeaderContentType) != tusOffsetMediaType {
+		return fail(c, http.StatusUnsupportedMediaType, "PATCH expects "+tusOffsetMediaType)
+	}
+	unlock, ok := s.tus.lock(id)
+	if !ok {
+		return fail(c, http.StatusLocked, "Upload is being written by another request")
+	}
+	defer unlock()
+
+	upload, err := s.tus.get(id)
+	if err != nil {
+		return tusLookupError(c, err)
+	}
+	offset, err := strconv.ParseInt(c.Request().Header.Get(uploadOffsetHeader), 10, 64)
+	if err != nil || offset != upload.Offset {
+		c.Response().Header().Set(uploadOffsetHeader, strconv.FormatInt(upload.Offset, 10))
+		return fail(c, http.StatusConflict, "Upload-Offset does not match the current offset")
+	}
+	if upload.complete() {
+		return fail(c, http.StatusConflict, "Upload is already complete")
+	}
+
+	n, err := s.tus.write(upload, c.Request().Body)
+	if errors.Is(err, errTooLarge) {
+		return fail(c, http.StatusRequestEntityTooLarge, "Upload exceeds its Upload-Length")
+	}
+	// A broken connection keeps whatever arrived, so the client can
+	// resume right after it.
+	upload.Offset += n
+	if saveErr := s.tus.save(upload); saveErr != nil {
+		log.Printf("Failed to save resumable upload %s: %v\n", id, saveErr)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+	if err != nil {
+		log.Printf("Resumable upload %s interrupted at offset %d: %v\n", id, upload.Offset, err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	if upload.Offset == upload.Length {
+		return s.finishTusUpload(c, upload, http.StatusNoContent)
+	}
+	c.Response().Header().Set(uploadOffsetHeader, strconv.FormatInt(upload.Offset, 10))
+	return c.NoContent(http.StatusNoContent)
+}
+
+// write appends r to the partial content of upload and returns how many
+// bytes were kept. Content beyond Upload-Length is refused as a whole.
+func (t *tusStore) write(upload tusUpload, r io.Reader) (int64, error) {
+	file, err := os.OpenFile(t.partPath(upload.ID), os.O_WRONLY, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	// Drop anything a previous interrupted write left past the offset.
+	if err := file.Truncate(upload.Offset); err != nil {
+		return 0, err
+	}
+	if _, err := file.Seek(upload.Offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := copyBuffer(file, &maxBytesReader{r: r, n: upload.Length - upload.Offset})
+	if errors.Is(err, errTooLarge) {
+		file.Truncate(upload.Offset)
+		return 0, err
+	}
+	return n, err
+}
+
+// finishTusUpload stores a complete upload and drops its partial content.
+// The state is kept so a client whose last response got lost can still
+// learn the download link with HEAD.
+func (s *Server) finishTusUpload(c echo.Context, upload tusUpload, status int) error {
+	file, err := os.Open(s.tus.partPath(upload.ID))
+	if err != nil {
+		return s.uploadError(c, err)
+	}
+	meta, err := s.saveUpload(c, s.uploadDirFor(c), upload.Filename, file)
+	file.Close()
+	if err != nil {
+		s.tus.remove(upload.ID)
+		return s.uploadError(c, err)
+	}
+	os.Remove(s.tus.partPath(upload.ID))
+	upload.Dir, upload.Name = meta.Dir, meta.Name
+	if err := s.tus.save(upload); err != nil {
+		log.Printf("Failed to save resumable upload %s: %v\n", upload.ID, err)
+	}
+	header := c.Response().Header()
+	header.Set(uploadOffsetHeader, strconv.FormatInt(upload.Offset, 10))
+	header.Set(downloadURLHeader, s.downloadURL(c, meta.Dir, meta.Name))
+	header.Set(checksumHeader, meta.SHA256)
+	return c.NoContent(status)
+}
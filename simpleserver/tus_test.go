@@ -0,0 +1,150 @@
+package simpleserver
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func tusRequest(method, target string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set(tusResumableHeader, tusVersion)
+	return req
+}
+
+func tusCreate(t *testing.T, s *Server, filename string, length int) string {
+	t.Helper()
+	req := tusRequest(http.MethodPost, tusPath, nil)
+	req.Header.Set(uploadLengthHeader, strconv.Itoa(length))
+	req.Header.Set(uploadMetaHeader, "filename "+base64.StdEncoding.EncodeToString([]byte(filename)))
+	rec := serve(s, req)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	location := rec.Header().Get("Location")
+	require.True(t, strings.HasPrefix(location, tusPath+"/"))
+	return location
+}
+
+func tusPatch(s *Server, location string, offset int, body io.Reader) *httptest.ResponseRecorder {
+	req := tusRequest(http.MethodPatch, location, body)
+	req.Header.Set("Content-Type", tusOffsetMediaType)
+	req.Header.Set(uploadOffsetHeader, strconv.Itoa(offset))
+	return serve(s, req)
+}
+
+func tusOffset(t *testing.T, s *Server, location string) string {
+	t.Helper()
+	rec := serve(s, tusRequest(http.MethodHead, location, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	return rec.Header().Get(uploadOffsetHeader)
+}
+
+func TestTusOptions(t *testing.T) {
+	s := newTestServer(t, Config{MaxSize: 5})
+
+	rec := serve(s, httptest.NewRequest(http.MethodOptions, tusPath, nil))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.Equal(t, tusVersion, rec.Header().Get(tusVersionHeader))
+	require.Equal(t, "creation", rec.Header().Get(tusExtensionHeader))
+	require.Equal(t, strconv.Itoa(5<<20), rec.Header().Get(tusMaxSizeHeader))
+}
+
+func TestTusUploadInChunks(t *testing.T) {
+	s := newTestServer(t, Config{})
+	location := tusCreate(t, s, "big.txt", 11)
+	require.Equal(t, "0", tusOffset(t, s, location))
+
+	rec := tusPatch(s, location, 0, strings.NewReader("hello "))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.Equal(t, "6", rec.Header().Get(uploadOffsetHeader))
+	require.Empty(t, rec.Header().Get(downloadURLHeader))
+	require.Equal(t, "6", tusOffset(t, s, location))
+
+	rec = tusPatch(s, location, 6, strings.NewReader("world"))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	downloadURL := rec.Header().Get(downloadURLHeader)
+	require.True(t, strings.HasSuffix(downloadURL, "/big.txt"))
+	require.Equal(t, "hello world", download(t, s, downloadURL).Body.String())
+
+	rec = serve(s, tusRequest(http.MethodHead, location, nil))
+	require.Equal(t, "11", rec.Header().Get(uploadOffsetHeader))
+	require.Equal(t, downloadURL, rec.Header().Get(downloadURLHeader))
+}
+
+type failingReader struct {
+	r io.Reader
+}
+
+func (f failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func TestTusResumesAfterInterruption(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestServer(t, Config{UploadDir: dir})
+	location := tusCreate(t, s, "flaky.txt", 8)
+
+	rec := tusPatch(s, location, 0, failingReader{strings.NewReader("abc")})
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	// The state survives a restart.
+	s = newTestServer(t, Config{UploadDir: dir})
+	require.Equal(t, "3", tusOffset(t, s, location))
+	rec = tusPatch(s, location, 3, strings.NewReader("defgh"))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.Equal(t, "abcdefgh", download(t, s, rec.Header().Get(downloadURLHeader)).Body.String())
+}
+
+func TestTusRejects(t *testing.T) {
+	s := newTestServer(t, Config{MaxSize: 1})
+	location := tusCreate(t, s, "a.txt", 4)
+
+	t.Run("offset mismatch", func(t *testing.T) {
+		rec := tusPatch(s, location, 2, strings.NewReader("cd"))
+		require.Equal(t, http.StatusConflict, rec.Code)
+		require.Equal(t, "0", rec.Header().Get(uploadOffsetHeader))
+	})
+	t.Run("beyond length", func(t *testing.T) {
+		rec := tusPatch(s, location, 0, strings.NewReader("abcde"))
+		require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+		require.Equal(t, "0", tusOffset(t, s, location))
+	})
+	t.Run("content type", func(t *testing.T) {
+		req := tusRequest(http.MethodPatch, location, strings.NewReader("ab"))
+		req.Header.Set(uploadOffsetHeader, "0")
+		require.Equal(t, http.StatusUnsupportedMediaType, serve(s, req).Code)
+	})
+	t.Run("version", func(t *testing.T) {
+		rec := serve(s, httptest.NewRequest(http.MethodHead, location, nil))
+		require.Equal(t, http.StatusPreconditionFailed, rec.Code)
+		require.Equal(t, tusVersion, rec.Header().Get(tusVersionHeader))
+	})
+	t.Run("too large", func(t *testing.T) {
+		req := tusRequest(http.MethodPost, tusPath, nil)
+		req.Header.Set(uploadLengthHeader, strconv.Itoa(2<<20))
+		require.Equal(t, http.StatusRequestEntityTooLarge, serve(s, req).Code)
+	})
+	t.Run("unknown upload", func(t *testing.T) {
+		rec := serve(s, tusRequest(http.MethodHead, tusPath+"/../../etc/passwd", nil))
+		require.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestTusEmptyUpload(t *testing.T) {
+	s := newTestServer(t, Config{})
+	req := tusRequest(http.MethodPost, tusPath, nil)
+	req.Header.Set(uploadLengthHeader, "0")
+	rec := serve(s, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.True(t, strings.HasSuffix(rec.Header().Get(downloadURLHeader), "/"+defaultFilename))
+}
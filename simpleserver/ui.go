@@ -0,0 +1,48 @@
+package simpleserver
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// uiPage is the drag-and-drop upload page served at GET / unless NoUI is set.
+// It posts multipart forms to the path it is served at.
+//
+//go:embed ui/index.html
+var uiPage string
+
+var uiTemplateDefault = template.Must(template.New(uiTemplate).Parse(uiPage))
+
+// uiData is what the upload page is rendered with: T translates a message
+// into Lang. Search shows a search box for GET /search.
+type uiData struct {
+	Lang    string
+	T       func(string) string
+	MaxSize int64
+	Search  bool
+}
+
+func (s *Server) handleUI(c echo.Context) error {
+	s.pageCSP(c, uiCSP)
+	page := uiTemplateDefault
+	if s.templates != nil && s.templates.ui != nil {
+		page = s.templates.ui
+	}
+	data := uiData{
+		Lang:    requestLang(c),
+		T:       func(message string) string { return translate(c, message) },
+		MaxSize: int64(s.maxSize()) << 20,
+		Search:  s.searchAvailable(),
+	}
+	var body strings.Builder
+	if err := page.Execute(&body, data); err != nil {
+		return err
+	}
+	c.Response().Header().Set("Content-Language", data.Lang)
+	c.Response().Header().Add(echo.HeaderVary, "Accept-Language")
+	return c.HTML(http.StatusOK, body.String())
+}
@@ -0,0 +1,25 @@
+package simpleserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUIServedAtRoot(t *testing.T) {
+	s := newTestServer(t, Config{})
+
+	rec := serve(s, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Header().Get("Content-Type"), "text/html")
+	require.Contains(t, rec.Body.String(), `xhr.open("POST", window.location.pathname)`)
+}
+
+func TestNoUI(t *testing.T) {
+	s := newTestServer(t, Config{NoUI: true})
+
+	rec := serve(s, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
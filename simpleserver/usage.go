@@ -0,0 +1,45 @@
+package simpleserver
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+const defaultUsageLimit = 10
+
+type fileUsage struct {
+	URL         string `json:"url"`
+	Dir         string `json:"dir"`
+	Name        string `json:"name"`
+	Downloads   int64  `json:"downloads"`
+	BytesServed int64  `json:"bytes_served"`
+}
+
+type usageResponse struct {
+	Files []fileUsage `json:"files"`
+}
+
+// handleUsage reports the files that served the most bytes, ?limit=N of them.
+func (s *Server) handleUsage(c echo.Context) error {
+	limit := defaultUsageLimit
+	if value := c.QueryParam("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fail(c, http.StatusBadRequest, "limit must be a positive integer")
+		}
+		limit = n
+	}
+	response := usageResponse{Files: []fileUsage{}}
+	for _, meta := range s.index.topServed(limit) {
+		response.Files = append(response.Files, fileUsage{
+			URL:         s.downloadURL(c, meta.Dir, meta.Name),
+			Dir:         meta.Dir,
+			Name:        meta.Name,
+			Downloads:   meta.Downloads,
+			BytesServed: meta.BytesServed,
+		})
+	}
+	return c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,72 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func usageReport(t *testing.T, s *Server, target string) usageResponse {
+	t.Helper()
+	rec := serve(s, adminRequest(http.MethodGet, target, ""))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var report usageResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	return report
+}
+
+func TestUsageReportRanksByBytesServed(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken})
+	targets := make(map[string]string)
+	for name, size := range map[string]int{"small.txt": 10, "medium.txt": 100, "large.txt": 1000} {
+		rec := serve(s, httptest.NewRequest(http.MethodPut, "/"+name, strings.NewReader(strings.Repeat("x", size))))
+		require.Equal(t, http.StatusCreated, rec.Code)
+		targets[name] = downloadURLs(t, rec.Body.String())[0]
+	}
+
+	// small: 3 full downloads = 30 bytes; medium: 1 full + a 50 byte range
+	// = 150 bytes; large: a single 100 byte range.
+	for i := 0; i < 3; i++ {
+		require.Equal(t, http.StatusOK, download(t, s, targets["small.txt"]).Code)
+	}
+	require.Equal(t, http.StatusOK, download(t, s, targets["medium.txt"]).Code)
+	dir := func(name string) string { return findMeta(t, s, name).Dir }
+	rec := serve(s, rangeRequest("/"+dir("medium.txt")+"/medium.txt", "bytes=0-49"))
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	rec = serve(s, rangeRequest("/"+dir("large.txt")+"/large.txt", "bytes=100-199"))
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+
+	report := usageReport(t, s, "/admin/usage")
+	require.Len(t, report.Files, 3)
+	var ranked []string
+	for _, file := range report.Files {
+		ranked = append(ranked, file.Name)
+	}
+	require.Equal(t, []string{"medium.txt", "large.txt", "small.txt"}, ranked)
+	require.Equal(t, int64(150), report.Files[0].BytesServed)
+	require.Equal(t, int64(2), report.Files[0].Downloads)
+	require.Equal(t, int64(100), report.Files[1].BytesServed)
+	require.Equal(t, int64(30), report.Files[2].BytesServed)
+	require.Equal(t, int64(3), report.Files[2].Downloads)
+	require.Equal(t, targets["medium.txt"], report.Files[0].URL)
+
+	report = usageReport(t, s, "/admin/usage?limit=1")
+	require.Len(t, report.Files, 1)
+	require.Equal(t, "medium.txt", report.Files[0].Name)
+
+	restarted := newTestServer(t, Config{AdminToken: testAdminToken, UploadDir: s.config.UploadDir})
+	require.Equal(t, report.Files, usageReport(t, restarted, "/admin/usage?limit=1").Files)
+}
+
+func TestUsageReportValidation(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken})
+	rec := serve(s, httptest.NewRequest(http.MethodGet, "/admin/usage", nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = serve(s, adminRequest(http.MethodGet, "/admin/usage?limit=0", ""))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Empty(t, usageReport(t, s, "/admin/usage").Files)
+}
@@ -0,0 +1,149 @@
+package simpleserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// requestUserKey caches the account a request authenticated as.
+const requestUserKey = "simpleserver.user"
+
+var errUserQuotaExceeded = errors.New("upload would exceed your storage quota")
+
+// UserAccount is an entry of Config.UsersFile. Each user uploads into an
+// upload directory named after them that only they can list and delete
+// from.
+type UserAccount struct {
+	// PasswordHash is a bcrypt hash, as printed by htpasswd -nbB.
+	PasswordHash string `yaml:"password"`
+	// Quota is the space the user's uploads may take in MB, unlimited when
+	// zero.
+	Quota int `yaml:"quota"`
+}
+
+// loadUsers reads a users file:
+//
+//	alice:
+//	  password: $2y$10$...
+//	  quota: 500
+func loadUsers(path string) (map[string]UserAccount, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	users := make(map[string]UserAccount)
+	if err := yaml.Unmarshal(content, &users); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for name, account := range users {
+		if !validSlug(name) {
+			return nil, fmt.Errorf("invalid user name %q in %s, names may only use letters, digits, '-' and '_'", name, path)
+		}
+		if _, err := bcrypt.Cost([]byte(account.PasswordHash)); err != nil {
+			return nil, fmt.Errorf("password of user %q in %s is not a bcrypt hash", name, path)
+		}
+		if account.Quota < 0 {
+			return nil, fmt.Errorf("quota of user %q in %s is negative", name, path)
+		}
+	}
+	return users, nil
+}
+
+// requestUser returns the user the request authenticates as with HTTP basic
+// auth, or the directory of its Access identity. Wrong or unknown credentials are ignored rather than rejected, the
+// routes requiring a user answer 401 themselves.
+func (s *Server) requestUser(c echo.Context) (string, bool) {
+	if name, ok := c.Get(requestUserKey).(string); ok {
+		return name, name != ""
+	}
+	if len(s.users) == 0 {
+		return "", false
+	}
+	name, password, ok := c.Request().BasicAuth()
+	account, known := s.users[name]
+	if !ok || !known || bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(password)) != nil {
+		name = ""
+	} else {
+		c.Set(requestIdentityKey, name)
+	}
+	c.Set(requestUserKey, name)
+	return name, name != ""
+}
+
+// isUserDir reports whether dir is the upload directory of a user or, with
+// Access validation, of an Access identity.
+func (s *Server) isUserDir(dir string) bool {
+	if s.access != nil && strings.HasPrefix(dir, accessDirPrefix) {
+		return true
+	}
+	_, ok := s.users[dir]
+	return ok
+}
+
+// uploadDirFor picks the upload directory of a new upload: the user's own one
+// for authenticated users, a fresh random one otherwise.
+func (s *Server) uploadDirFor(c echo.Context) string {
+	if user, ok := s.requestUser(c); ok {
+		return user
+	}
+	return s.newShareDir()
+}
+
+func userUnauthorized(c echo.Context) error {
+	c.Response().Header().Set("WWW-Authenticate", `Basic realm="simpleserver"`)
+	return fail(c, http.StatusUnauthorized, "Unauthorized")
+}
+
+// handleUserDelete deletes one of the caller's own uploads.
+func (s *Server) handleUserDelete(c echo.Context) error {
+	dir, name, err := downloadTarget(c.Request())
+	if err != nil || !s.isUserDir(dir) {
+		return fail(c, http.StatusNotFound, "File not found")
+	}
+	if user, ok := s.requestUser(c); !ok || user != dir {
+		return userUnauthorized(c)
+	}
+	meta, ok := s.index.get(dir, name)
+	if !ok {
+		return fail(c, http.StatusNotFound, "File not found")
+	}
+	if err := s.deleteFileFor(c, meta); err != nil {
+		return deleteFailed(c, meta, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// reserveUserQuota claims n bytes of the quota of the user owning dir for an
+// upload that is about to be stored, until release is called once it is in
+// the index. Uploads outside user directories are not charged.
+func (s *Server) reserveUserQuota(dir string, n int64) (release func(), err error) {
+	account, ok := s.users[dir]
+	if !ok || account.Quota <= 0 {
+		return func() {}, nil
+	}
+	limit := int64(account.Quota) << 20
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+	var used int64
+	for _, meta := range s.index.inDir(dir) {
+		used += meta.storedBytes()
+	}
+	if used+s.userQuotaReserved[dir]+n > limit {
+		return nil, errUserQuotaExceeded
+	}
+	s.userQuotaReserved[dir] += n
+	return func() {
+		s.quotaMu.Lock()
+		defer s.quotaMu.Unlock()
+		if s.userQuotaReserved[dir] -= n; s.userQuotaReserved[dir] == 0 {
+			delete(s.userQuotaReserved, dir)
+		}
+	}, nil
+}
@@ -0,0 +1,80 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newUsersServer(t *testing.T) *Server {
+	t.Helper()
+	hash := func(password string) string {
+		h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		require.NoError(t, err)
+		return string(h)
+	}
+	path := filepath.Join(t.TempDir(), "users.yaml")
+	writeConfigFile(t, path, fmt.Sprintf("alice:\n  password: %q\n  quota: 1\nbob:\n  password: %q\n", hash("wonderland"), hash("builder")))
+	return newTestServer(t, Config{UsersFile: path})
+}
+
+func userRequest(method, target, user, password, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if user != "" {
+		req.SetBasicAuth(user, password)
+	}
+	return req
+}
+
+func TestUsersUploadIntoTheirOwnDirectory(t *testing.T) {
+	s := newUsersServer(t)
+
+	require.Equal(t, http.StatusUnauthorized, serve(s, userRequest(http.MethodPut, "/notes.txt", "", "", "hi")).Code)
+	require.Equal(t, http.StatusUnauthorized, serve(s, userRequest(http.MethodPut, "/notes.txt", "alice", "wrong", "hi")).Code)
+	rec := serve(s, userRequest(http.MethodPut, "/notes.txt", "alice", "wonderland", "hi"))
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	require.Contains(t, rec.Body.String(), "/alice/notes.txt")
+	require.Equal(t, http.StatusCreated, serve(s, userRequest(http.MethodPut, "/todo.txt", "bob", "builder", "hi")).Code)
+
+	listing := userRequest(http.MethodGet, "/alice", "alice", "wonderland", "")
+	listing.Header.Set("Accept", "application/json")
+	rec = serve(s, listing)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp listingResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.Files, 1)
+	require.Equal(t, "notes.txt", resp.Files[0].Name)
+	require.Equal(t, http.StatusUnauthorized, serve(s, userRequest(http.MethodGet, "/alice", "bob", "builder", "")).Code)
+
+	require.Equal(t, http.StatusUnauthorized, serve(s, userRequest(http.MethodDelete, "/alice/notes.txt", "bob", "builder", "")).Code)
+	require.Equal(t, http.StatusNoContent, serve(s, userRequest(http.MethodDelete, "/alice/notes.txt", "alice", "wonderland", "")).Code)
+	require.Empty(t, s.index.inDir("alice"))
+	require.Len(t, s.index.inDir("bob"), 1)
+}
+
+func TestUserQuota(t *testing.T) {
+	s := newUsersServer(t)
+
+	half := strings.Repeat("x", 600<<10)
+	require.Equal(t, http.StatusCreated, serve(s, userRequest(http.MethodPut, "/a.bin", "alice", "wonderland", half)).Code)
+	rec := serve(s, userRequest(http.MethodPut, "/b.bin", "alice", "wonderland", half))
+	require.Equal(t, http.StatusInsufficientStorage, rec.Code)
+	require.Equal(t, http.StatusCreated, serve(s, userRequest(http.MethodPut, "/b.bin", "bob", "builder", half)).Code)
+}
+
+func TestLoadUsersRejectsPlainPasswords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.yaml")
+	writeConfigFile(t, path, "alice:\n  password: wonderland\n")
+	_, err := loadUsers(path)
+	require.Error(t, err)
+	writeConfigFile(t, path, "admin:\n  password: $2a$04$abcdefghijklmnopqrstuuJ3V4O0PuvyDbq4Dm.c4m6HxzDQAbCm2\n")
+	_, err = loadUsers(path)
+	require.Error(t, err, "user names may not shadow routes")
+}
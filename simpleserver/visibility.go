@@ -0,0 +1,121 @@
+package simpleserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// visibilityHeader, or the visibility query parameter, sets who can see
+	// an upload: anyone with its link (public, the default), the same minus
+	// listings and exports (unlisted), or only the identities of
+	// allowedEmailsHeader (restricted).
+	visibilityHeader = "X-Visibility"
+	// allowedEmailsHeader, or the allowed_emails query parameter, lists the
+	// comma separated emails that may download a restricted upload.
+	allowedEmailsHeader = "X-Allowed-Emails"
+
+	visibilityPublic     = "public"
+	visibilityUnlisted   = "unlisted"
+	visibilityRestricted = "restricted"
+)
+
+var (
+	errInvalidVisibility = errors.New(visibilityHeader + " must be public, unlisted or restricted")
+	errNoAllowedEmails   = errors.New("restricted uploads need " + allowedEmailsHeader)
+	errNoIdentities      = errors.New("restricted uploads need Access, OIDC or users to identify who downloads them")
+)
+
+// requestVisibility returns the visibility and allowlist an upload asks for.
+// Public uploads are stored with an empty visibility.
+func (s *Server) requestVisibility(c echo.Context) (string, []string, error) {
+	visibility := strings.ToLower(strings.TrimSpace(c.Request().Header.Get(visibilityHeader)))
+	if visibility == "" {
+		visibility = strings.ToLower(c.QueryParam("visibility"))
+	}
+	emails := c.Request().Header.Get(allowedEmailsHeader)
+	if emails == "" {
+		emails = c.QueryParam("allowed_emails")
+	}
+	var allowed []string
+	for _, email := range strings.Split(emails, ",") {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			allowed = append(allowed, email)
+		}
+	}
+	switch visibility {
+	case "", visibilityPublic:
+		if len(allowed) > 0 {
+			return "", nil, fmt.Errorf("%w, %s is only for restricted uploads", errInvalidVisibility, allowedEmailsHeader)
+		}
+		return "", nil, nil
+	case visibilityUnlisted:
+		if len(allowed) > 0 {
+			return "", nil, fmt.Errorf("%w, %s is only for restricted uploads", errInvalidVisibility, allowedEmailsHeader)
+		}
+		return visibility, nil, nil
+	case visibilityRestricted:
+		if len(allowed) == 0 {
+			return "", nil, errNoAllowedEmails
+		}
+		if s.access == nil && len(s.users) == 0 {
+			return "", nil, errNoIdentities
+		}
+		return visibility, allowed, nil
+	}
+	return "", nil, errInvalidVisibility
+}
+
+// listed reports whether meta shows up in directory listings, zip archives,
+// the admin file list and stats exports.
+func (m FileMeta) listed() bool {
+	return m.Visibility == ""
+}
+
+// downloaderIdentity is the Access identity or user a download authenticated
+// as, if any.
+func (s *Server) downloaderIdentity(c echo.Context) string {
+	s.requestUser(c)
+	return requestIdentity(c)
+}
+
+// mayDownload reports whether c may download meta: anyone may, except for
+// restricted files, which only their allowed emails may.
+func (s *Server) mayDownload(c echo.Context, meta FileMeta) bool {
+	if meta.Visibility != visibilityRestricted {
+		return true
+	}
+	identity := s.downloaderIdentity(c)
+	for _, email := range meta.AllowedEmails {
+		if strings.EqualFold(identity, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// shareFile returns the stored file a download of dir/name is for, which
+// for the /qr, /thumb, /preview and /raw variants is the file they end.
+func (s *Server) shareFile(dir, name string) (FileMeta, bool) {
+	if meta, ok := s.index.get(dir, name); ok {
+		return meta, true
+	}
+	return s.index.get(dir, path.Dir(name))
+}
+
+// restrictedDownload refuses a download of a restricted file, with 401 to
+// clients that did not authenticate so they can, 403 to everyone else.
+func (s *Server) restrictedDownload(c echo.Context) error {
+	if s.downloaderIdentity(c) == "" {
+		if len(s.users) > 0 {
+			return userUnauthorized(c)
+		}
+		return fail(c, http.StatusUnauthorized, "Unauthorized")
+	}
+	return fail(c, http.StatusForbidden, "Forbidden")
+}
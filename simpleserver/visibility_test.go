@@ -0,0 +1,81 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestrictedSharesNeedAnAllowedIdentity(t *testing.T) {
+	s := newUsersServer(t)
+	req := userRequest(http.MethodPut, "/plans.txt", "alice", "wonderland", "secret plans")
+	req.Header.Set(visibilityHeader, "restricted")
+	req.Header.Set(allowedEmailsHeader, "Bob, carol@example.com")
+	rec := serve(s, req)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	link := downloadURLs(t, rec.Body.String())[0]
+	meta := findMeta(t, s, "plans.txt")
+	require.Equal(t, visibilityRestricted, meta.Visibility)
+	require.Equal(t, []string{"bob", "carol@example.com"}, meta.AllowedEmails)
+
+	rec = download(t, s, link)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.NotEmpty(t, rec.Header().Get("WWW-Authenticate"))
+	require.Equal(t, http.StatusForbidden, serve(s, userRequest(http.MethodGet, link, "alice", "wonderland", "")).Code)
+	rec = serve(s, userRequest(http.MethodGet, link, "bob", "builder", ""))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "secret plans", rec.Body.String())
+	require.Equal(t, "private, no-cache", rec.Header().Get("Cache-Control"))
+}
+
+func TestInvalidVisibility(t *testing.T) {
+	s := newTestServer(t, Config{})
+	for query, want := range map[string]error{
+		"?visibility=secret":                      errInvalidVisibility,
+		"?allowed_emails=bob@example.com":         errInvalidVisibility,
+		"?visibility=restricted":                  errNoAllowedEmails,
+		"?visibility=restricted&allowed_emails=a": errNoIdentities,
+	} {
+		rec := serve(s, httptest.NewRequest(http.MethodPut, "/notes.txt"+query, strings.NewReader("hi")))
+		require.Equal(t, http.StatusBadRequest, rec.Code, query)
+		require.Contains(t, rec.Body.String(), want.Error(), query)
+	}
+	require.Zero(t, s.index.len())
+}
+
+func TestUnlistedSharesStayOutOfListings(t *testing.T) {
+	s := newTestServer(t, Config{AdminToken: testAdminToken, AuthToken: "secret"})
+	upload := func(name, visibility string) string {
+		req := httptest.NewRequest(http.MethodPut, "/"+name+"?visibility="+visibility, strings.NewReader(name))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := serve(s, req)
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+		return downloadURLs(t, rec.Body.String())[0]
+	}
+	upload("shown.txt", "public")
+	link := upload("hidden.txt", "unlisted")
+	require.Equal(t, "hidden.txt", download(t, s, link).Body.String(), "unlisted files are served to anyone with the link")
+
+	files := func(query string) []string {
+		rec := serve(s, adminRequest(http.MethodGet, "/admin/files"+query, ""))
+		require.Equal(t, http.StatusOK, rec.Code)
+		var resp adminFilesResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		var names []string
+		for _, file := range resp.Files {
+			names = append(names, file.Name+" "+file.Visibility)
+		}
+		return names
+	}
+	require.Equal(t, []string{"shown.txt "}, files(""))
+	require.ElementsMatch(t, []string{"shown.txt ", "hidden.txt unlisted"}, files("?unlisted=true"))
+
+	meta := findMeta(t, s, "hidden.txt")
+	req := httptest.NewRequest(http.MethodGet, "/"+meta.Dir, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	require.Equal(t, http.StatusNotFound, serve(s, req).Code, "a dir of only unlisted files has nothing to list")
+}
@@ -0,0 +1,512 @@
+package simpleserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/webdav"
+)
+
+const davPrefix = "/dav"
+
+// davMethods are the methods WebDAV clients send.
+var davMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete,
+	"PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK",
+}
+
+// registerDAVRoutes serves the uploads over WebDAV at /dav/, with one
+// collection per share dir, so they can be mounted as a network drive.
+func (s *Server) registerDAVRoutes(e *echo.Echo) {
+	if !s.config.WebDAV {
+		return
+	}
+	handler := echo.WrapHandler(&webdav.Handler{
+		Prefix:     davPrefix,
+		FileSystem: davFS{s: s},
+		LockSystem: webdav.NewMemLS(),
+	})
+	e.Match(davMethods, davPrefix, handler, s.requireDAVAuth)
+	e.Match(davMethods, davPrefix+"/*", handler, s.requireDAVAuth)
+}
+
+// requireDAVAuth guards WebDAV with Config.AuthToken, presented as a bearer
+// token or as the basic auth password file managers send. Like listings,
+// WebDAV is only served when a token is configured.
+func (s *Server) requireDAVAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token := s.settings().AuthToken
+		if token == "" {
+			return fail(c, http.StatusNotFound, "Not found")
+		}
+		if validBearer(c.Request(), token) {
+			return next(c)
+		}
+		if _, password, ok := c.Request().BasicAuth(); ok && subtle.ConstantTimeCompare([]byte(password), []byte(token)) == 1 {
+			return next(c)
+		}
+		c.Response().Header().Set("WWW-Authenticate", `Basic realm="simpleserver"`)
+		return fail(c, http.StatusUnauthorized, "Unauthorized")
+	}
+}
+
+// davFS presents the metadata index as a file system: the root holds the
+// share dirs and each of them the files uploaded into it. Only the files a
+// zip archive could hold are visible. Writes go through storeFile like any
+// other upload, and collections created with MKCOL live in memory until a
+// file is stored in them.
+type davFS struct {
+	s *Server
+}
+
+// davPath splits a WebDAV path into the share dir and the file path in it.
+func davPath(name string) (dir, rest string) {
+	dir, rest, _ = strings.Cut(strings.Trim(path.Clean("/"+name), "/"), "/")
+	return dir, rest
+}
+
+func (d davFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	if d.s.uploadsOff() {
+		return os.ErrPermission
+	}
+	dir, rest := davPath(name)
+	if _, err := d.Stat(ctx, name); err == nil {
+		return os.ErrExist
+	}
+	if rest == "" {
+		if !validSlug(dir) {
+			return os.ErrPermission
+		}
+	} else {
+		if _, err := cleanRelativePath(rest); err != nil || !d.s.config.PreservePaths {
+			return os.ErrPermission
+		}
+		if !d.isDir(dir, path.Dir(rest)) {
+			return os.ErrNotExist
+		}
+	}
+	d.s.davDirs.Store(path.Join(dir, rest), struct{}{})
+	return nil
+}
+
+func (d davFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return d.create(ctx, name)
+	}
+	dir, rest := davPath(name)
+	if meta, ok := d.visible(dir, rest); ok {
+		return &davFile{s: d.s, ctx: ctx, meta: meta}, nil
+	}
+	if !d.isDir(dir, rest) {
+		return nil, os.ErrNotExist
+	}
+	entries := d.readDir(dir, rest)
+	return &davDir{info: davDirInfo(path.Base(name), entries), entries: entries}, nil
+}
+
+// create starts an upload of name. It is stored once the returned file is
+// closed.
+func (d davFS) create(ctx context.Context, name string) (webdav.File, error) {
+	if d.s.uploadsOff() {
+		return nil, os.ErrPermission
+	}
+	dir, rest := davPath(name)
+	rest, err := cleanRelativePath(rest)
+	if dir == "" || err != nil {
+		return nil, os.ErrPermission
+	}
+	if !d.isDir(dir, path.Dir(rest)) {
+		return nil, os.ErrNotExist
+	}
+	if meta, ok := d.s.index.get(dir, rest); ok && !meta.servedInBulk(time.Now()) {
+		return nil, os.ErrPermission
+	}
+	pr, pw := io.Pipe()
+	upload := &davUpload{name: path.Base(rest), pw: pw, done: make(chan error, 1)}
+	go func() {
+		meta, err := d.s.storeFile(ctx, dir, rest, pr, uploadOptions{TTL: d.s.config.TTL, MaxBytes: int64(d.s.maxSize()) << 20})
+		if err == nil {
+			if err = d.s.confirmUpload(ctx, meta); err != nil {
+				d.s.removeFile(meta)
+			}
+		}
+		if err == nil {
+			d.s.publishEvent(Event{Type: EventUpload, Dir: meta.Dir, Filename: meta.Name, Size: meta.Size, SHA256: meta.SHA256})
+		}
+		pr.CloseWithError(err)
+		upload.done <- err
+	}()
+	return upload, nil
+}
+
+func (d davFS) RemoveAll(ctx context.Context, name string) error {
+	if d.s.readOnly.Load() {
+		return os.ErrPermission
+	}
+	dir, rest := davPath(name)
+	if dir == "" {
+		return os.ErrPermission
+	}
+	now := time.Now()
+	for _, meta := range d.s.index.inDir(dir) {
+		if rest != "" && meta.Name != rest && !strings.HasPrefix(meta.Name, rest+"/") || !meta.servedInBulk(now) {
+			continue
+		}
+		if err := d.s.deleteFile(meta); err != nil {
+			return err
+		}
+	}
+	key := path.Join(dir, rest)
+	d.s.davDirs.Range(func(k, _ any) bool {
+		if k == key || strings.HasPrefix(k.(string), key+"/") {
+			d.s.davDirs.Delete(k)
+		}
+		return true
+	})
+	return nil
+}
+
+// Rename moves a single file, directories cannot be renamed.
+func (d davFS) Rename(ctx context.Context, oldName, newName string) error {
+	if d.s.readOnly.Load() {
+		return os.ErrPermission
+	}
+	meta, ok := d.visible(davPath(oldName))
+	if !ok {
+		if _, err := d.Stat(ctx, oldName); err == nil {
+			return os.ErrPermission
+		}
+		return os.ErrNotExist
+	}
+	dir, rest := davPath(newName)
+	rest, err := cleanRelativePath(rest)
+	if dir == "" || err != nil {
+		return os.ErrPermission
+	}
+	if !d.isDir(dir, path.Dir(rest)) {
+		return os.ErrNotExist
+	}
+	moved := meta
+	moved.Dir, moved.Name, moved.OriginalName = dir, rest, ""
+	if err := d.s.relocateFile(ctx, meta, moved); errors.Is(err, errTargetExists) {
+		return os.ErrExist
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (d davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	dir, rest := davPath(name)
+	if meta, ok := d.visible(dir, rest); ok {
+		return davFileInfo(meta), nil
+	}
+	if !d.isDir(dir, rest) {
+		return nil, os.ErrNotExist
+	}
+	return davDirInfo(path.Base(name), d.readDir(dir, rest)), nil
+}
+
+// visible returns the file at dir/rest if WebDAV may show it.
+func (d davFS) visible(dir, rest string) (FileMeta, bool) {
+	if dir == "" || rest == "" {
+		return FileMeta{}, false
+	}
+	meta, ok := d.s.index.get(dir, rest)
+	return meta, ok && meta.servedInBulk(time.Now())
+}
+
+// isDir reports whether dir/rest is a collection: the root, a share dir or
+// a parent of preserved paths holding a visible file, or a collection
+// created with MKCOL.
+func (d davFS) isDir(dir, rest string) bool {
+	if rest == "." {
+		rest = ""
+	}
+	switch {
+	case dir == "":
+		return true
+	case !isShareDir(dir):
+		return false
+	}
+	if _, ok := d.s.davDirs.Load(path.Join(dir, rest)); ok {
+		return true
+	}
+	now := time.Now()
+	for _, meta := range d.s.index.inDir(dir) {
+		if (rest == "" || strings.HasPrefix(meta.Name, rest+"/")) && meta.servedInBulk(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// readDir lists the collection dir/rest, sorted by name.
+func (d davFS) readDir(dir, rest string) []os.FileInfo {
+	children := make(map[string]*davInfo)
+	addDir := func(name string, modTime time.Time) {
+		child, ok := children[name]
+		if !ok {
+			child = &davInfo{name: name, dir: true}
+			children[name] = child
+		}
+		if modTime.After(child.modTime) {
+			child.modTime = modTime
+		}
+	}
+	prefix := ""
+	if dir != "" {
+		prefix = path.Join(dir, rest) + "/"
+	}
+	d.s.davDirs.Range(func(k, _ any) bool {
+		if name, ok := strings.CutPrefix(k.(string), prefix); ok && name != "" {
+			first, _, _ := strings.Cut(name, "/")
+			addDir(first, time.Time{})
+		}
+		return true
+	})
+	now := time.Now()
+	if dir == "" {
+		for _, meta := range d.s.index.all() {
+			if meta.servedInBulk(now) {
+				addDir(meta.Dir, meta.CreatedAt)
+			}
+		}
+	} else {
+		for _, meta := range d.s.index.inDir(dir) {
+			name, ok := strings.CutPrefix(meta.key(), prefix)
+			if !ok || !meta.servedInBulk(now) {
+				continue
+			}
+			if first, _, nested := strings.Cut(name, "/"); nested {
+				addDir(first, meta.CreatedAt)
+			} else {
+				children[name] = davFileInfo(meta)
+			}
+		}
+	}
+	entries := make([]os.FileInfo, 0, len(children))
+	for _, child := range children {
+		entries = append(entries, child)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries
+}
+
+// davInfo describes a WebDAV resource. Files report the recorded content
+// type and checksum, so listings never have to read them.
+type davInfo struct {
+	name        string
+	size        int64
+	modTime     time.Time
+	dir         bool
+	contentType string
+	etag        string
+}
+
+func davFileInfo(meta FileMeta) *davInfo {
+	info := &davInfo{name: path.Base(meta.Name), size: meta.Size, modTime: meta.CreatedAt, contentType: meta.contentType()}
+	if meta.SHA256 != "" {
+		info.etag = `"` + meta.SHA256 + `"`
+	}
+	return info
+}
+
+// davDirInfo describes a collection, last modified with its newest entry.
+func davDirInfo(name string, entries []os.FileInfo) *davInfo {
+	info := &davInfo{name: name, dir: true}
+	for _, entry := range entries {
+		if entry.ModTime().After(info.modTime) {
+			info.modTime = entry.ModTime()
+		}
+	}
+	return info
+}
+
+func (i *davInfo) Name() string       { return i.name }
+func (i *davInfo) Size() int64        { return i.size }
+func (i *davInfo) ModTime() time.Time { return i.modTime }
+func (i *davInfo) IsDir() bool        { return i.dir }
+func (i *davInfo) Sys() any           { return nil }
+
+func (i *davInfo) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (i *davInfo) ContentType(ctx context.Context) (string, error) {
+	if i.contentType == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return i.contentType, nil
+}
+
+func (i *davInfo) ETag(ctx context.Context) (string, error) {
+	if i.etag == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return i.etag, nil
+}
+
+// davFile reads a stored upload. Seeking only moves the offset; the next
+// read reopens the object there, decoding and skipping up to it when the
+// stored bytes cannot be seeked.
+type davFile struct {
+	s    *Server
+	ctx  context.Context
+	meta FileMeta
+	pos  int64
+	obj  io.Closer
+	r    io.Reader
+	rpos int64
+}
+
+func (f *davFile) Read(p []byte) (int, error) {
+	if f.pos >= f.meta.Size {
+		return 0, io.EOF
+	}
+	if f.r == nil || f.rpos != f.pos {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.r.Read(p)
+	f.rpos += int64(n)
+	f.pos = f.rpos
+	return n, err
+}
+
+func (f *davFile) open() error {
+	f.Close()
+	obj, err := f.s.storage.Get(f.ctx, f.meta.key())
+	if err != nil {
+		return err
+	}
+	if seeker, ok := obj.Content.(io.ReadSeeker); ok && f.s.storage.Seekable(f.meta) {
+		if _, err := seeker.Seek(f.pos, io.SeekStart); err != nil {
+			obj.Content.Close()
+			return err
+		}
+		f.obj, f.r, f.rpos = obj.Content, obj.Content, f.pos
+		return nil
+	}
+	content, err := f.s.decodedReader(obj.Content, f.meta)
+	if err != nil {
+		obj.Content.Close()
+		return err
+	}
+	if _, err := io.CopyN(io.Discard, content, f.pos); err != nil {
+		obj.Content.Close()
+		return err
+	}
+	f.obj, f.r, f.rpos = obj.Content, content, f.pos
+	return nil
+}
+
+func (f *davFile) Seek(offset int64, whence int) (int64, error) {
+	pos := offset
+	switch whence {
+	case io.SeekCurrent:
+		pos += f.pos
+	case io.SeekEnd:
+		pos += f.meta.Size
+	}
+	if pos < 0 {
+		return 0, os.ErrInvalid
+	}
+	f.pos = pos
+	return pos, nil
+}
+
+func (f *davFile) Close() error {
+	if f.obj == nil {
+		return nil
+	}
+	err := f.obj.Close()
+	f.obj, f.r = nil, nil
+	return err
+}
+
+func (f *davFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+func (f *davFile) Stat() (os.FileInfo, error) {
+	return davFileInfo(f.meta), nil
+}
+
+func (f *davFile) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+// davDir is an open collection.
+type davDir struct {
+	info    os.FileInfo
+	entries []os.FileInfo
+}
+
+func (d *davDir) Readdir(count int) ([]os.FileInfo, error) {
+	if count <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n := min(count, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+func (d *davDir) Stat() (os.FileInfo, error)                   { return d.info, nil }
+func (d *davDir) Read(p []byte) (int, error)                   { return 0, os.ErrInvalid }
+func (d *davDir) Seek(offset int64, whence int) (int64, error) { return 0, nil }
+func (d *davDir) Write(p []byte) (int, error)                  { return 0, os.ErrPermission }
+func (d *davDir) Close() error                                 { return nil }
+
+// davUpload streams a WebDAV write into storeFile, which finishes when the
+// file is closed.
+type davUpload struct {
+	name    string
+	pw      *io.PipeWriter
+	done    chan error
+	written int64
+}
+
+func (u *davUpload) Write(p []byte) (int, error) {
+	n, err := u.pw.Write(p)
+	u.written += int64(n)
+	return n, err
+}
+
+func (u *davUpload) Close() error {
+	u.pw.Close()
+	return <-u.done
+}
+
+// abort drops the upload without storing what was written so far.
+func (u *davUpload) abort() {
+	u.pw.CloseWithError(io.ErrUnexpectedEOF)
+	<-u.done
+}
+
+func (u *davUpload) Stat() (os.FileInfo, error) {
+	return &davInfo{name: u.name, size: u.written, modTime: time.Now()}, nil
+}
+
+func (u *davUpload) Read(p []byte) (int, error)                   { return 0, os.ErrInvalid }
+func (u *davUpload) Seek(offset int64, whence int) (int64, error) { return 0, os.ErrInvalid }
+func (u *davUpload) Readdir(count int) ([]os.FileInfo, error)     { return nil, os.ErrInvalid }
@@ -0,0 +1,116 @@
+package simpleserver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func davServer(t *testing.T) (*Server, FileMeta) {
+	t.Helper()
+	s := newTestServer(t, Config{AuthToken: testAuthToken, WebDAV: true})
+	req := authorized(httptest.NewRequest(http.MethodPut, "/notes.txt", strings.NewReader("meeting notes")), testAuthToken)
+	require.Equal(t, http.StatusCreated, serve(s, req).Code)
+	return s, findMeta(t, s, "notes.txt")
+}
+
+func davRequest(method, target string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, target, body)
+	req.SetBasicAuth("anyone", testAuthToken)
+	return req
+}
+
+func TestWebDAVListsAndServesUploads(t *testing.T) {
+	s, meta := davServer(t)
+	req := davRequest("PROPFIND", "/dav/", nil)
+	req.Header.Set("Depth", "1")
+	rec := serve(s, req)
+	require.Equal(t, http.StatusMultiStatus, rec.Code)
+	require.Contains(t, rec.Body.String(), "/dav/"+meta.Dir+"/")
+
+	req = davRequest("PROPFIND", "/dav/"+meta.Dir, nil)
+	req.Header.Set("Depth", "1")
+	rec = serve(s, req)
+	require.Equal(t, http.StatusMultiStatus, rec.Code)
+	require.Contains(t, rec.Body.String(), "/dav/"+meta.Dir+"/notes.txt")
+	require.Contains(t, rec.Body.String(), meta.SHA256)
+
+	rec = serve(s, davRequest(http.MethodGet, "/dav/"+meta.Dir+"/notes.txt", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "meeting notes", rec.Body.String())
+
+	req = davRequest(http.MethodGet, "/dav/"+meta.Dir+"/notes.txt", nil)
+	req.Header.Set("Range", "bytes=8-")
+	rec = serve(s, req)
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	require.Equal(t, "notes", rec.Body.String())
+}
+
+func TestWebDAVRequiresAuthToken(t *testing.T) {
+	s, meta := davServer(t)
+	rec := serve(s, httptest.NewRequest(http.MethodGet, "/dav/"+meta.Dir+"/notes.txt", nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Header().Get("WWW-Authenticate"), "Basic")
+
+	req := httptest.NewRequest(http.MethodGet, "/dav/"+meta.Dir+"/notes.txt", nil)
+	req.SetBasicAuth("anyone", "wrong")
+	require.Equal(t, http.StatusUnauthorized, serve(s, req).Code)
+
+	req = authorized(httptest.NewRequest(http.MethodGet, "/dav/"+meta.Dir+"/notes.txt", nil), testAuthToken)
+	require.Equal(t, http.StatusOK, serve(s, req).Code)
+
+	open := newTestServer(t, Config{WebDAV: true})
+	require.Equal(t, http.StatusNotFound, serve(open, davRequest("PROPFIND", "/dav/", nil)).Code)
+}
+
+func TestWebDAVWritesUploads(t *testing.T) {
+	s, meta := davServer(t)
+	require.Equal(t, http.StatusCreated, serve(s, davRequest("MKCOL", "/dav/photos", nil)).Code)
+	require.Equal(t, http.StatusMethodNotAllowed, serve(s, davRequest("MKCOL", "/dav/photos", nil)).Code)
+
+	rec := serve(s, davRequest(http.MethodPut, "/dav/photos/cat.txt", strings.NewReader("meow")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	cat, ok := s.index.get("photos", "cat.txt")
+	require.True(t, ok)
+	require.Equal(t, int64(len("meow")), cat.Size)
+	require.Equal(t, "meow", download(t, s, "/photos/cat.txt").Body.String())
+
+	req := davRequest("MOVE", "/dav/photos/cat.txt", nil)
+	req.Header.Set("Destination", "/dav/"+meta.Dir+"/kitten.txt")
+	require.Equal(t, http.StatusCreated, serve(s, req).Code)
+	_, ok = s.index.get("photos", "cat.txt")
+	require.False(t, ok)
+	require.Equal(t, "meow", download(t, s, "/"+meta.Dir+"/kitten.txt").Body.String())
+
+	require.Equal(t, http.StatusNoContent, serve(s, davRequest(http.MethodDelete, "/dav/"+meta.Dir+"/notes.txt", nil)).Code)
+	_, ok = s.index.get(meta.Dir, "notes.txt")
+	require.False(t, ok)
+
+	rec = serve(s, davRequest(http.MethodPut, "/dav/missing/dog.txt", strings.NewReader("woof")))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestWebDAVHidesProtectedUploads(t *testing.T) {
+	s, _ := davServer(t)
+	req := authorized(httptest.NewRequest(http.MethodPut, "/vault/secret.txt", strings.NewReader("secret")), testAuthToken)
+	req.Header.Set(customPathHeader, "true")
+	req.Header.Set(passwordHeader, "hunter2")
+	require.Equal(t, http.StatusCreated, serve(s, req).Code)
+
+	req = davRequest("PROPFIND", "/dav/", nil)
+	req.Header.Set("Depth", "1")
+	rec := serve(s, req)
+	require.Equal(t, http.StatusMultiStatus, rec.Code)
+	require.NotContains(t, rec.Body.String(), "vault")
+	require.Equal(t, http.StatusNotFound, serve(s, davRequest(http.MethodGet, "/dav/vault/secret.txt", nil)).Code)
+
+	rec = serve(s, davRequest(http.MethodPut, "/dav/vault/secret.txt", strings.NewReader("overwritten")))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.Equal(t, http.StatusNotFound, serve(s, davRequest(http.MethodDelete, "/dav/vault/secret.txt", nil)).Code)
+	_, ok := s.index.get("vault", "secret.txt")
+	require.True(t, ok)
+}
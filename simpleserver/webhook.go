@@ -0,0 +1,164 @@
+package simpleserver
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	webhookTimeout   = 10 * time.Second
+	webhookQueueSize = 256
+	webhookAttempts  = 5
+	// webhookBackoff is the wait before the first retry, doubled after
+	// every failed attempt.
+	webhookBackoff = time.Second
+
+	webhookEventHeader     = "X-Webhook-Event"
+	webhookSignatureHeader = "X-Webhook-Signature-256"
+)
+
+// DownloadEvent is the payload POSTed to the download webhook.
+type DownloadEvent struct {
+	Event    string    `json:"event"`
+	Dir      string    `json:"dir"`
+	Filename string    `json:"filename"`
+	Bytes    int64     `json:"bytes"`
+	ClientIP string    `json:"client_ip"`
+	Ranged   bool      `json:"ranged"`
+	Time     time.Time `json:"time"`
+}
+
+// notifyDownload delivers event to the download webhook without blocking the
+// request that triggered it.
+func (s *Server) notifyDownload(event DownloadEvent) {
+	s.downloadWebhooks.send(event.Event, event.Dir+"/"+event.Filename, event)
+}
+
+// webhookSender POSTs payloads to a webhook URL: every published event to
+// WebhookURL, and the DownloadEvents to DownloadWebhookURL. Payloads wait in
+// a bounded queue and are delivered one at a time by a single worker,
+// retried with exponential backoff, so a slow or failing receiver never
+// holds up requests. Payloads are dropped once the queue is full.
+type webhookSender struct {
+	url     string
+	secret  []byte
+	client  *http.Client
+	backoff time.Duration
+
+	once  sync.Once
+	queue chan webhookPayload
+}
+
+// webhookPayload is a queued webhook: eventType is sent in the event header
+// and file names the file in the logs.
+type webhookPayload struct {
+	eventType string
+	file      string
+	body      any
+}
+
+// newWebhookSender returns the sender of url, or nil when it is empty.
+func newWebhookSender(url, secret string, client *http.Client) *webhookSender {
+	if url == "" {
+		return nil
+	}
+	if secret == "" {
+		log.Printf("Webhooks to %s are sent unsigned, set --webhook-secret to sign them\n", url)
+	}
+	return &webhookSender{
+		url:     url,
+		secret:  []byte(secret),
+		client:  client,
+		backoff: webhookBackoff,
+	}
+}
+
+// enqueue schedules event for delivery without blocking.
+func (w *webhookSender) enqueue(event Event) {
+	w.send(event.Type, event.Dir+"/"+event.Filename, event)
+}
+
+// send schedules body, encoded as JSON, for delivery without blocking.
+func (w *webhookSender) send(eventType, file string, body any) {
+	if w == nil {
+		return
+	}
+	w.once.Do(func() {
+		w.queue = make(chan webhookPayload, webhookQueueSize)
+		go w.loop()
+	})
+	select {
+	case w.queue <- webhookPayload{eventType: eventType, file: file, body: body}:
+	default:
+		log.Printf("Dropping %s webhook for %s, the webhook queue is full\n", eventType, file)
+	}
+}
+
+func (w *webhookSender) loop() {
+	for payload := range w.queue {
+		body, err := json.Marshal(payload.body)
+		if err != nil {
+			log.Printf("Failed to encode %s webhook for %s: %v\n", payload.eventType, payload.file, err)
+			continue
+		}
+		w.deliver(payload.eventType, body)
+	}
+}
+
+// deliver POSTs body until the receiver accepts it, it is refused with a
+// client error other than 429, or webhookAttempts are used up.
+func (w *webhookSender) deliver(eventType string, body []byte) {
+	wait := w.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := w.post(eventType, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt == webhookAttempts {
+			log.Printf("Failed to deliver %s webhook to %s after %d attempts: %v\n", eventType, w.url, attempt, err)
+			return
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+func (w *webhookSender) post(eventType string, body []byte) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, eventType)
+	if len(w.secret) > 0 {
+		req.Header.Set(webhookSignatureHeader, signWebhook(w.secret, body))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return false, fmt.Errorf("status %d", resp.StatusCode)
+}
+
+// signWebhook returns the signature header value for body: the hex
+// HMAC-SHA256 under secret, prefixed with "sha256=".
+func signWebhook(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,187 @@
+package simpleserver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func webhookReceiver(t *testing.T) (string, <-chan []byte) {
+	t.Helper()
+	received := make(chan []byte, 16)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&body); err == nil {
+			received <- body
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver.URL, received
+}
+
+func nextWebhook(t *testing.T, received <-chan []byte, v any) {
+	t.Helper()
+	select {
+	case body := <-received:
+		require.NoError(t, json.Unmarshal(body, v))
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+}
+
+func TestDownloadWebhook(t *testing.T) {
+	hookURL, received := webhookReceiver(t)
+	s := newTestServer(t, Config{DownloadWebhookURL: hookURL})
+
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/report.txt", strings.NewReader("0123456789")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	fileURL := downloadURLs(t, rec.Body.String())[0]
+	dir := shareDirs(t, s)[0]
+
+	rec = download(t, s, fileURL)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var payload map[string]any
+	nextWebhook(t, received, &payload)
+	require.Equal(t, false, payload["ranged"], "full downloads are reported as not ranged")
+	var event DownloadEvent
+	body, err := json.Marshal(payload)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(body, &event))
+	require.Equal(t, "download", event.Event)
+	require.Equal(t, dir, event.Dir)
+	require.Equal(t, "report.txt", event.Filename)
+	require.Equal(t, int64(10), event.Bytes)
+	require.NotEmpty(t, event.ClientIP)
+
+	req := httptest.NewRequest(http.MethodGet, "/"+dir+"/report.txt", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	rec = serve(s, req)
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	nextWebhook(t, received, &event)
+	require.Equal(t, int64(4), event.Bytes)
+	require.True(t, event.Ranged)
+
+	rec = serve(s, httptest.NewRequest(http.MethodGet, "/"+dir+"/missing.txt", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	select {
+	case <-received:
+		t.Fatal("failed downloads must not be reported")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDownloadWebhookAlongsideWebhook(t *testing.T) {
+	hookURL, received := webhookReceiver(t)
+	downloadHookURL, downloads := webhookReceiver(t)
+	s := newTestServer(t, Config{WebhookURL: hookURL, DownloadWebhookURL: downloadHookURL})
+
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/report.txt", strings.NewReader("0123456789")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var event Event
+	nextWebhook(t, received, &event)
+	require.Equal(t, EventUpload, event.Type)
+
+	require.Equal(t, http.StatusOK, download(t, s, downloadURLs(t, rec.Body.String())[0]).Code)
+	nextWebhook(t, received, &event)
+	require.Equal(t, EventDownload, event.Type)
+	var download DownloadEvent
+	nextWebhook(t, downloads, &download)
+	require.Equal(t, "download", download.Event)
+	select {
+	case body := <-downloads:
+		t.Fatalf("only downloads are sent to the download webhook: %s", body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+func TestEventWebhooks(t *testing.T) {
+	received := make(chan receivedWebhook, 16)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- receivedWebhook{r.Header, body}
+	}))
+	defer receiver.Close()
+	s := newTestServer(t, Config{WebhookURL: receiver.URL, WebhookSecret: "s3cret", TTL: time.Hour})
+
+	next := func(eventType string) Event {
+		t.Helper()
+		select {
+		case hook := <-received:
+			require.Equal(t, eventType, hook.header.Get(webhookEventHeader))
+			require.Equal(t, signWebhook([]byte("s3cret"), hook.body), hook.header.Get(webhookSignatureHeader))
+			var event Event
+			require.NoError(t, json.Unmarshal(hook.body, &event))
+			require.Equal(t, eventType, event.Type)
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("webhook was not delivered")
+			return Event{}
+		}
+	}
+
+	rec := serve(s, httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("hello")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	event := next(EventUpload)
+	require.Equal(t, "a.txt", event.Filename)
+	require.Equal(t, int64(5), event.Size)
+
+	require.Equal(t, http.StatusOK, download(t, s, downloadURLs(t, rec.Body.String())[0]).Code)
+	require.Equal(t, int64(5), next(EventDownload).Bytes)
+
+	require.Equal(t, 1, s.reapExpired(time.Now().Add(2*time.Hour)))
+	require.Equal(t, "a.txt", next(EventExpire).Filename)
+
+	require.Equal(t, http.StatusCreated, serve(s, httptest.NewRequest(http.MethodPut, "/b.txt", strings.NewReader("b"))).Code)
+	next(EventUpload)
+	require.NoError(t, s.deleteFile(findMeta(t, s, "b.txt")))
+	require.Equal(t, "b.txt", next(EventDelete).Filename)
+}
+
+func TestWebhookRetries(t *testing.T) {
+	var attempts atomic.Int32
+	delivered := make(chan struct{})
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		close(delivered)
+	}))
+	defer receiver.Close()
+	s := newTestServer(t, Config{WebhookURL: receiver.URL})
+	s.webhooks.backoff = time.Millisecond
+
+	require.Equal(t, http.StatusCreated, serve(s, httptest.NewRequest(http.MethodPut, "/a.txt", strings.NewReader("a"))).Code)
+	select {
+	case <-delivered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not retried")
+	}
+	require.Equal(t, int32(3), attempts.Load())
+}
+
+func TestWebhookGivesUpOnClientErrors(t *testing.T) {
+	var attempts atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer receiver.Close()
+	w := newWebhookSender(receiver.URL, "", receiver.Client())
+	w.backoff = time.Millisecond
+	w.deliver(EventUpload, []byte(`{}`))
+	require.Equal(t, int32(1), attempts.Load())
+}